@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cacheMutableRefsEnvVar, if true, also caches file contents read at a
+// branch, a tag or the default branch, which may change before the cached
+// result expires. By default only contents read at a commit are cached.
+const cacheMutableRefsEnvVar = "GITHUB_CACHE_MUTABLE_REFS"
+
+// How long the results of read tools are cached. Issues change as people
+// work on them, so they are only cached long enough to spare an agent's
+// repeated reads; the contents of a file at a commit never change.
+const (
+	issueCacheTTL  = 30 * time.Second
+	searchCacheTTL = time.Minute
+	fileCacheTTL   = time.Minute // at a branch or tag, see cacheMutableRefsEnvVar
+	commitCacheTTL = time.Hour   // at a commit
+)
+
+// cacheTTLs are the github-mcp tools whose results are cached, besides the
+// search_ tools, which are cached for searchCacheTTL.
+var cacheTTLs = map[string]time.Duration{
+	"get_file_contents": fileCacheTTL,
+	"get_issue":         issueCacheTTL,
+	"list_issues":       issueCacheTTL,
+}
+
+// commitSHA matches the full SHA-1 or SHA-256 id of a commit. Abbreviated
+// ids are not trusted to stay unambiguous.
+var commitSHA = regexp.MustCompile(`^(?:[0-9a-fA-F]{40}|[0-9a-fA-F]{64})$`)
+
+// responseCache decides which tool results are cached, and under which key.
+type responseCache struct {
+	mutableRefs bool // see cacheMutableRefsEnvVar
+}
+
+// cacheFromEnv returns the response cache configured in the environment.
+func cacheFromEnv() (*responseCache, error) {
+	c := &responseCache{}
+	if value := os.Getenv(cacheMutableRefsEnvVar); value != "" {
+		var err error
+		if c.mutableRefs, err = strconv.ParseBool(value); err != nil {
+			return nil, fmt.Errorf("%s: %q is not a boolean", cacheMutableRefsEnvVar, value)
+		}
+	}
+	return c, nil
+}
+
+// key returns the key and lifetime of the cached result of a call to tool,
+// for mcpproxy.Config.ResponseCacheKey, or a zero lifetime if it is not
+// cached. The key is made of the arguments, with the case-insensitive owner
+// and repository in lower case, so the same read is the same key however
+// the model spells them. File contents are keyed by the commit they are
+// read at, whether it is given as ref or sha.
+func (c *responseCache) key(tool string, arguments json.RawMessage) (string, time.Duration) {
+	ttl, ok := cacheTTLs[tool]
+	if !ok && strings.HasPrefix(tool, "search_") {
+		ttl, ok = searchCacheTTL, true
+	}
+	if !ok {
+		return "", 0
+	}
+
+	args := make(map[string]interface{})
+	if len(arguments) > 0 {
+		dec := json.NewDecoder(bytes.NewReader(arguments))
+		dec.UseNumber()
+		if dec.Decode(&args) != nil || args == nil {
+			return "", 0
+		}
+	}
+	for _, name := range []string{"owner", "repo"} {
+		if s, ok := args[name].(string); ok {
+			args[name] = strings.ToLower(s)
+		}
+	}
+
+	if tool == "get_file_contents" {
+		if commit := pinnedCommit(args); commit != "" {
+			delete(args, "ref")
+			args["sha"] = commit
+			ttl = commitCacheTTL
+		} else if !c.mutableRefs {
+			return "", 0
+		}
+	}
+
+	key, err := json.Marshal(args)
+	if err != nil {
+		return "", 0
+	}
+	return string(key), ttl
+}
+
+// pinnedCommit returns the commit get_file_contents reads at if its
+// arguments name one, or "" if they name a branch or tag, or nothing, for
+// the default branch. The sha argument takes precedence over ref.
+func pinnedCommit(args map[string]interface{}) string {
+	ref, _ := args["ref"].(string)
+	if sha, _ := args["sha"].(string); sha != "" {
+		ref = sha
+	}
+	if !commitSHA.MatchString(ref) {
+		return ""
+	}
+	return strings.ToLower(ref)
+}
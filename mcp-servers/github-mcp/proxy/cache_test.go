@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testCommit = "0123456789abcdef0123456789abcdef01234567"
+
+func TestCacheKey(t *testing.T) {
+	c := &responseCache{}
+	key := func(tool, arguments string) (string, time.Duration) {
+		return c.key(tool, json.RawMessage(arguments))
+	}
+
+	for _, tc := range []struct {
+		tool, arguments string
+		ttl             time.Duration
+	}{
+		{"get_file_contents", `{"owner":"my-org","repo":"app","path":"go.mod","sha":"` + testCommit + `"}`, commitCacheTTL},
+		{"get_file_contents", `{"owner":"my-org","repo":"app","path":"go.mod","ref":"` + strings.ToUpper(testCommit) + `"}`, commitCacheTTL},
+		{"get_issue", `{"owner":"my-org","repo":"app","issue_number":42}`, issueCacheTTL},
+		{"list_issues", `{"owner":"my-org","repo":"app","state":"open"}`, issueCacheTTL},
+		{"search_code", `{"query":"func main"}`, searchCacheTTL},
+		{"search_repositories", `{"query":"mcp"}`, searchCacheTTL},
+	} {
+		if k, ttl := key(tc.tool, tc.arguments); k == "" || ttl != tc.ttl {
+			t.Errorf("Expected %s %s to be cached for %s, got %q for %s", tc.tool, tc.arguments, tc.ttl, k, ttl)
+		}
+	}
+
+	for _, tc := range []struct {
+		tool, arguments string
+	}{
+		{"create_issue", `{"owner":"my-org","repo":"app","title":"Bug"}`},
+		{"get_file_contents", `{"owner":"my-org","repo":"app","path":"go.mod"}`},
+		{"get_file_contents", `{"owner":"my-org","repo":"app","path":"go.mod","ref":"main"}`},
+		{"get_file_contents", `{"owner":"my-org","repo":"app","path":"go.mod","ref":"0123456"}`},
+		{"get_file_contents", `{"owner":"my-org","repo":"app","path":"go.mod","ref":"` + testCommit + `","sha":"main"}`},
+		{"get_issue", `not json`},
+	} {
+		if k, ttl := key(tc.tool, tc.arguments); ttl != 0 {
+			t.Errorf("Expected %s %s to bypass the cache, got %q for %s", tc.tool, tc.arguments, k, ttl)
+		}
+	}
+
+	// The same read is the same key
+	a, _ := key("get_file_contents", `{"owner":"My-Org","repo":"App","path":"go.mod","ref":"`+testCommit+`"}`)
+	b, _ := key("get_file_contents", `{"path":"go.mod", "sha":"`+strings.ToUpper(testCommit)+`","repo":"app","owner":"my-org"}`)
+	if a != b {
+		t.Errorf("Expected the same key for the same commit, got %q and %q", a, b)
+	}
+	other, _ := key("get_file_contents", `{"owner":"my-org","repo":"app","path":"go.mod","sha":"`+strings.Repeat("f", 40)+`"}`)
+	if other == a {
+		t.Errorf("Expected another commit to have another key, got %q", other)
+	}
+}
+
+func TestCacheMutableRefs(t *testing.T) {
+	t.Setenv(cacheMutableRefsEnvVar, "true")
+	c, err := cacheFromEnv()
+	if err != nil {
+		t.Fatalf("cacheFromEnv() failed: %v", err)
+	}
+
+	onMain, ttl := c.key("get_file_contents", json.RawMessage(`{"owner":"my-org","repo":"app","path":"go.mod","ref":"main"}`))
+	if onMain == "" || ttl != fileCacheTTL {
+		t.Fatalf("Expected contents at a branch to be cached for %s, got %q for %s", fileCacheTTL, onMain, ttl)
+	}
+	dev, _ := c.key("get_file_contents", json.RawMessage(`{"owner":"my-org","repo":"app","path":"go.mod","ref":"dev"}`))
+	if dev == onMain {
+		t.Errorf("Expected the ref in the key, got %q for both", onMain)
+	}
+
+	t.Setenv(cacheMutableRefsEnvVar, "sometimes")
+	if _, err := cacheFromEnv(); err == nil {
+		t.Error("Expected an invalid value to be rejected")
+	}
+}
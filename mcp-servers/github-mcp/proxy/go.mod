@@ -4,5 +4,6 @@ go 1.21
 
 require github.com/rh-ai-kickstart/ai-architecture-charts/mcp-servers/mcpproxy v0.0.0-20260112200911-3c502cb8d0cf
 
-// For local development, uncomment the replace directive below
-// replace github.com/rh-ai-kickstart/ai-architecture-charts/mcp-servers/mcpproxy => ../../mcpproxy
+// The proxy is built against the mcpproxy in this repository, see the
+// Containerfile.
+replace github.com/rh-ai-kickstart/ai-architecture-charts/mcp-servers/mcpproxy => ../../mcpproxy
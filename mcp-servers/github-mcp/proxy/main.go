@@ -1,19 +1,79 @@
 package main
 
 import (
-	"log"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
 
 	"github.com/rh-ai-kickstart/ai-architecture-charts/mcp-servers/mcpproxy"
 )
 
 func main() {
-	if err := mcpproxy.Run(mcpproxy.Config{
-		ServerName:  "github-mcp",
-		CommandPath: "/server/github-mcp-server",
-		CommandArgs: []string{"stdio"},
-		PathEnvVar:  "GITHUB_MCP_PATH",
-		EnableCORS:  true,
-	}); err != nil {
-		log.Fatalf("Failed to run proxy: %v", err)
+	cfg := mcpproxy.Config{
+		ServerName:         "github-mcp",
+		CommandPath:        "/server/github-mcp-server",
+		CommandArgs:        []string{"stdio"},
+		PathEnvVar:         "GITHUB_MCP_PATH",
+		BackendVersionArgs: []string{"--version"},
+		EnableCORS:         true,
+
+		LegacySSECompat: true,
+		SSEInitialEvent: "endpoint",
+
+		RedactPatterns: githubRedactPatterns,
+		RedactValues:   githubRedactValues(),
+	}
+
+	s, err := scopeFromEnv()
+	if err != nil {
+		slog.Error("Invalid allowed owners or repositories", "error", err)
+		os.Exit(1)
+	}
+	if s != nil {
+		slog.Info("Limiting tool calls to allowed owners and repositories", "allowed", s.String())
+		cfg.RequestFilter = s.filter
+		cfg.RequestMiddleware = s.rewrite
+	}
+
+	cache, err := cacheFromEnv()
+	if err != nil {
+		slog.Error("Invalid response cache setting", "error", err)
+		os.Exit(1)
+	}
+	cfg.ResponseCacheKey = cache.key
+
+	notifier := &mcpproxy.Notifier{}
+	hook, err := webhookFromEnv(notifier)
+	if err != nil {
+		slog.Error("Invalid webhook configuration", "error", err)
+		os.Exit(1)
+	}
+	if hook != nil {
+		slog.Info("Receiving GitHub webhooks", "path", webhookPath, "events", strings.Join(sortedKeys(hook.events), ","))
+		cfg.EnableNotificationStream = true
+		cfg.Notifier = notifier
+		cfg.RedactValues = append(cfg.RedactValues, hook.secret)
+		cfg.Routes = append(cfg.Routes, mcpproxy.Route{Pattern: "POST " + webhookPath, Handler: hook.serve})
+	}
+
+	profiles, defaultProfile, err := profilesFromEnv()
+	if err != nil {
+		slog.Error("Invalid profiles", "error", err)
+		os.Exit(1)
+	}
+	if profiles == nil {
+		mcpproxy.Main(cfg)
+		return
 	}
+	// The health check needs nothing else: the profiles are served on the
+	// same port, and their /healthz and /readyz report on all of them.
+	mcpproxy.MainWith(cfg, mcpproxy.Commands{
+		Run: func(cfg mcpproxy.Config) error {
+			return serveProfiles(cfg, profiles, defaultProfile)
+		},
+		SelfTest: func(cfg mcpproxy.Config, opts mcpproxy.SelfTestOptions, w io.Writer) error {
+			return selfTestProfiles(cfg, profiles, opts, w)
+		},
+	})
 }
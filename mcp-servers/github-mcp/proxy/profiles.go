@@ -0,0 +1,380 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rh-ai-kickstart/ai-architecture-charts/mcp-servers/mcpproxy"
+)
+
+// Environment variables configuring profiles: a JSON object mapping the
+// name of each profile to its settings, see profile, which runs one MCP
+// server per profile, and the profile serving requests that select none.
+// Without a default profile, requests must select one.
+const (
+	profilesEnvVar       = "GITHUB_PROFILES"
+	defaultProfileEnvVar = "GITHUB_DEFAULT_PROFILE"
+)
+
+// Environment variables the GitHub MCP server reads its host and toolsets
+// from, set per profile.
+const (
+	hostEnvVar     = "GITHUB_HOST"
+	toolsetsEnvVar = "GITHUB_TOOLSETS"
+)
+
+// A request selects its profile with the profileHeader header or, failing
+// that, with the profileMetaKey member of its params' _meta.
+const (
+	profileHeader  = "X-GitHub-Profile"
+	profileMetaKey = "profile"
+)
+
+// profilesPrefix is where each profile's proxy is mounted, e.g.
+// /profiles/acme/metrics.
+const profilesPrefix = "/profiles/"
+
+// maxProfileRequestBytes limits the requests read to find their profile.
+// Each profile's proxy still applies its own MaxRequestBytes.
+const maxProfileRequestBytes = 16 << 20
+
+// tokenCheckInterval is how often token files are checked for changes.
+var tokenCheckInterval = 10 * time.Second
+
+var profileName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// profile is a GitHub account or organization served by its own MCP server.
+type profile struct {
+	// Host is the GitHub Enterprise Server or ghe.com host to use instead
+	// of github.com.
+	Host string `json:"host"`
+
+	// TokenFile holds the token the MCP server authenticates with. It is
+	// read whenever the server starts, and the server is restarted when it
+	// changes, so mounted secrets can be rotated in place.
+	TokenFile string `json:"tokenFile"`
+
+	// Toolsets are the toolsets the MCP server enables (default: its own
+	// defaults).
+	Toolsets []string `json:"toolsets"`
+}
+
+// profilesFromEnv returns the profiles configured in the environment and
+// the default one, or nil if none are.
+func profilesFromEnv() (map[string]profile, string, error) {
+	value := os.Getenv(profilesEnvVar)
+	if value == "" {
+		return nil, "", nil
+	}
+	var profiles map[string]profile
+	dec := json.NewDecoder(strings.NewReader(value))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&profiles); err != nil {
+		return nil, "", fmt.Errorf("%s: %w", profilesEnvVar, err)
+	}
+	if len(profiles) == 0 {
+		return nil, "", fmt.Errorf("%s: no profiles", profilesEnvVar)
+	}
+	for name, p := range profiles {
+		if !profileName.MatchString(name) {
+			return nil, "", fmt.Errorf("%s: invalid profile name %q", profilesEnvVar, name)
+		}
+		if p.TokenFile == "" {
+			return nil, "", fmt.Errorf("%s: profile %s has no tokenFile", profilesEnvVar, name)
+		}
+		if _, err := readToken(p.TokenFile); err != nil {
+			return nil, "", fmt.Errorf("%s: profile %s: %w", profilesEnvVar, name, err)
+		}
+	}
+	defaultProfile := os.Getenv(defaultProfileEnvVar)
+	if _, ok := profiles[defaultProfile]; defaultProfile != "" && !ok {
+		return nil, "", fmt.Errorf("%s: unknown profile %q", defaultProfileEnvVar, defaultProfile)
+	}
+	return profiles, defaultProfile, nil
+}
+
+// readToken returns the token in a token file, without surrounding space.
+func readToken(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", fmt.Errorf("token file %s is empty", path)
+	}
+	return token, nil
+}
+
+// environ returns the proxy's environment with the profile's settings in
+// place of any inherited ones, and the current content of its token file.
+func (p profile) environ() []string {
+	token, err := readToken(p.TokenFile)
+	if err != nil {
+		slog.Error("Cannot read token file", "file", p.TokenFile, "error", err)
+	}
+	env := []string{tokenEnvVar + "=" + token}
+	if p.Host != "" {
+		env = append(env, hostEnvVar+"="+p.Host)
+	}
+	if len(p.Toolsets) > 0 {
+		env = append(env, toolsetsEnvVar+"="+strings.Join(p.Toolsets, ","))
+	}
+	for _, kv := range os.Environ() {
+		switch name, _, _ := strings.Cut(kv, "="); name {
+		case tokenEnvVar, hostEnvVar, toolsetsEnvVar:
+		default:
+			env = append(env, kv)
+		}
+	}
+	return env
+}
+
+// config returns the configuration of the proxy serving the named profile,
+// derived from base.
+func (p profile) config(base mcpproxy.Config, name string) mcpproxy.Config {
+	cfg := base
+	cfg.ServerName = base.ServerName + "-" + name
+	cfg.Launcher = mcpproxy.LauncherFunc(func(ctx context.Context, path string, args []string) *exec.Cmd {
+		cmd := exec.CommandContext(ctx, path, args...)
+		cmd.Env = p.environ()
+		return cmd
+	})
+	// Clients stay connected while the server restarts for a new token.
+	cfg.ReplayInitialize = true
+	// Served once by the profileRouter rather than by every profile.
+	cfg.Routes = nil
+
+	cfg.RedactValues = append([]string(nil), base.RedactValues...)
+	if token, err := readToken(p.TokenFile); err == nil {
+		cfg.RedactValues = append(cfg.RedactValues, token)
+	}
+	return cfg
+}
+
+// watchToken restarts proxy's MCP server whenever the profile's token file
+// changes, until stop is closed, redacting the new token from the log. The
+// file's content is compared rather than its modification time, which
+// Kubernetes does not update when it swaps a mounted secret.
+func (p profile) watchToken(name string, proxy *mcpproxy.MCPProxy, stop <-chan struct{}) {
+	last, _ := readToken(p.TokenFile)
+	ticker := time.NewTicker(tokenCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		token, err := readToken(p.TokenFile)
+		if err != nil || token == last {
+			continue
+		}
+		last = token
+		proxy.AddRedactValues(token)
+		slog.Info("Token file changed", "profile", name, "file", p.TokenFile)
+		if err := proxy.Restart("token file changed"); err != nil {
+			return
+		}
+	}
+}
+
+// profileRouter serves every profile's MCP endpoint at the root, passing
+// each request to the proxy of the profile it selects, see profileHeader.
+// Each proxy's other routes are served under profilesPrefix, and /healthz
+// and /readyz report on all of them.
+type profileRouter struct {
+	names          []string // sorted
+	handlers       map[string]http.Handler
+	defaultProfile string
+	mux            *http.ServeMux
+}
+
+// newProfileRouter returns a profileRouter for the proxies of m, serving
+// routes besides theirs.
+func newProfileRouter(m *mcpproxy.Manager, defaultProfile string, routes []mcpproxy.Route) *profileRouter {
+	rt := &profileRouter{
+		names:          m.Names(),
+		handlers:       make(map[string]http.Handler),
+		defaultProfile: defaultProfile,
+		mux:            http.NewServeMux(),
+	}
+	for _, name := range rt.names {
+		rt.handlers[name] = m.Proxy(name).Handler()
+	}
+	rt.mux.Handle(profilesPrefix, m.Handler())
+	rt.mux.HandleFunc("/healthz", rt.checkAll)
+	rt.mux.HandleFunc("/readyz", rt.checkAll)
+	for _, route := range routes {
+		rt.mux.HandleFunc(routePath(route), methodOnly(route))
+	}
+	rt.mux.HandleFunc("/", rt.serveMCP)
+	return rt
+}
+
+// routePath returns the path of a route's pattern, without its method.
+func routePath(route mcpproxy.Route) string {
+	if _, path, ok := strings.Cut(route.Pattern, " "); ok {
+		return strings.TrimLeft(path, " ")
+	}
+	return route.Pattern
+}
+
+// methodOnly returns the handler of route, refusing other methods than the
+// one its pattern names, if any. Each path has a single route here.
+func methodOnly(route mcpproxy.Route) http.HandlerFunc {
+	method, _, ok := strings.Cut(route.Pattern, " ")
+	return func(w http.ResponseWriter, r *http.Request) {
+		if ok && r.Method != method {
+			w.Header().Set("Allow", method)
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		route.Handler(w, r)
+	}
+}
+
+func (rt *profileRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rt.mux.ServeHTTP(w, r)
+}
+
+// serveMCP passes a request for the MCP endpoint to the proxy of the
+// profile it selects.
+func (rt *profileRouter) serveMCP(w http.ResponseWriter, r *http.Request) {
+	var body []byte
+	if r.Method == http.MethodPost {
+		var err error
+		body, err = io.ReadAll(http.MaxBytesReader(w, r.Body, maxProfileRequestBytes))
+		if err != nil {
+			http.Error(w, "Error reading request", http.StatusRequestEntityTooLarge)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	name := r.Header.Get(profileHeader)
+	var msg struct {
+		ID     json.RawMessage `json:"id"`
+		Params struct {
+			Meta map[string]interface{} `json:"_meta"`
+		} `json:"params"`
+	}
+	json.Unmarshal(body, &msg)
+	if name == "" {
+		name, _ = msg.Params.Meta[profileMetaKey].(string)
+	}
+	if name == "" {
+		name = rt.defaultProfile
+	}
+
+	h := rt.handlers[name]
+	if h != nil {
+		h.ServeHTTP(w, r)
+		return
+	}
+	message := fmt.Sprintf("Unknown profile %q, expected one of %s", name, strings.Join(rt.names, ", "))
+	if name == "" {
+		message = fmt.Sprintf("No profile selected: set the %s header or the %s member of _meta to one of %s",
+			profileHeader, profileMetaKey, strings.Join(rt.names, ", "))
+	}
+	if body == nil || len(msg.ID) == 0 {
+		http.Error(w, message, http.StatusBadRequest)
+		return
+	}
+	response, _ := json.Marshal(map[string]interface{}{"jsonrpc": "2.0", "id": msg.ID,
+		"error": &mcpproxy.RPCError{Code: -32602, Message: message}})
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(response)
+}
+
+// checkAll serves /healthz or /readyz with the worst status of the
+// profiles' proxies, and which profiles are failing.
+func (rt *profileRouter) checkAll(w http.ResponseWriter, r *http.Request) {
+	status := http.StatusOK
+	var failing []string
+	for _, name := range rt.names {
+		rec := &statusRecorder{header: make(http.Header), status: http.StatusOK}
+		rt.handlers[name].ServeHTTP(rec, r)
+		if rec.status != http.StatusOK {
+			status = max(status, rec.status)
+			failing = append(failing, name)
+		}
+	}
+	if len(failing) > 0 {
+		http.Error(w, "Failing profiles: "+strings.Join(failing, ", "), status)
+		return
+	}
+	w.Write([]byte("OK"))
+}
+
+// statusRecorder is an http.ResponseWriter keeping only the status of a
+// response.
+type statusRecorder struct {
+	header http.Header
+	status int
+}
+
+func (s *statusRecorder) Header() http.Header { return s.header }
+
+func (s *statusRecorder) Write(p []byte) (int, error) { return len(p), nil }
+
+func (s *statusRecorder) WriteHeader(status int) { s.status = status }
+
+// selfTestProfiles runs mcpproxy.SelfTest for every profile, configured
+// from base, in turn, and fails if any of them does.
+func selfTestProfiles(base mcpproxy.Config, profiles map[string]profile, opts mcpproxy.SelfTestOptions, w io.Writer) error {
+	var failed []string
+	for _, name := range sortedKeys(profiles) {
+		if err := mcpproxy.SelfTest(profiles[name].config(base, name), opts, w); err != nil {
+			failed = append(failed, name)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failing profiles: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// serveProfiles runs one proxy per profile, configured from base, and
+// serves them on base.Port, or $PORT, or 8080, until the server fails.
+func serveProfiles(base mcpproxy.Config, profiles map[string]profile, defaultProfile string) error {
+	m := mcpproxy.NewManager()
+	defer m.Close()
+	stop := make(chan struct{})
+	defer close(stop)
+
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		p := profiles[name]
+		proxy, err := m.Add(name, profilesPrefix+name, p.config(base, name))
+		if err != nil {
+			return err
+		}
+		go p.watchToken(name, proxy, stop)
+	}
+
+	port := base.Port
+	if port == "" {
+		port = os.Getenv("PORT")
+	}
+	if port == "" {
+		port = "8080"
+	}
+	slog.Info("Serving GitHub profiles", "profiles", strings.Join(names, ","), "default", defaultProfile, "port", port)
+	return http.ListenAndServe(":"+port, newProfileRouter(m, defaultProfile, base.Routes))
+}
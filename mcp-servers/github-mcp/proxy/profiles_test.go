@@ -0,0 +1,271 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rh-ai-kickstart/ai-architecture-charts/mcp-servers/mcpproxy"
+)
+
+// profileServer answers every request with the token and host it was
+// started with, which it also prints to stderr on startup.
+const profileServer = `echo "starting with $GITHUB_PERSONAL_ACCESS_TOKEN" >&2
+while read -r line; do
+  id=$(printf '%s' "$line" | sed -n 's/.*"id":\([0-9]*\).*/\1/p')
+  [ -n "$id" ] && printf '{"jsonrpc":"2.0","id":%s,"result":{"token":"%s","host":"%s"}}\n' "$id" "$GITHUB_PERSONAL_ACCESS_TOKEN" "$GITHUB_HOST"
+done`
+
+func writeToken(t *testing.T, path, token string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(token+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestProfilesFromEnv(t *testing.T) {
+	dir := t.TempDir()
+	tokenFile := filepath.Join(dir, "token")
+	writeToken(t, tokenFile, "ghp_acme")
+
+	t.Setenv(profilesEnvVar, `{"acme":{"host":"https://ghe.acme.example","tokenFile":"`+tokenFile+`","toolsets":["repos","issues"]}}`)
+	t.Setenv(defaultProfileEnvVar, "acme")
+	profiles, defaultProfile, err := profilesFromEnv()
+	if err != nil {
+		t.Fatalf("profilesFromEnv() failed: %v", err)
+	}
+	if p := profiles["acme"]; p.Host != "https://ghe.acme.example" || len(p.Toolsets) != 2 || defaultProfile != "acme" {
+		t.Errorf("Unexpected profiles %+v, default %q", profiles, defaultProfile)
+	}
+
+	t.Setenv(tokenEnvVar, "ghp_inherited")
+	env := strings.Join(profiles["acme"].environ(), "\n")
+	for _, want := range []string{tokenEnvVar + "=ghp_acme", hostEnvVar + "=https://ghe.acme.example", toolsetsEnvVar + "=repos,issues"} {
+		if !strings.Contains(env, want) {
+			t.Errorf("Expected %s in the environment", want)
+		}
+	}
+	if strings.Contains(env, "ghp_inherited") {
+		t.Error("Expected the inherited token to be replaced")
+	}
+
+	t.Setenv(defaultProfileEnvVar, "")
+	for _, value := range []string{
+		`not json`,
+		`{}`,
+		`{"acme":{"tokenFile":""}}`,
+		`{"acme":{"tokenFile":"` + filepath.Join(dir, "missing") + `"}}`,
+		`{"acme":{"tokenFile":"` + tokenFile + `","tokens":"typo"}}`,
+		`{"a/b":{"tokenFile":"` + tokenFile + `"}}`,
+	} {
+		t.Setenv(profilesEnvVar, value)
+		if _, _, err := profilesFromEnv(); err == nil {
+			t.Errorf("Expected %s to be rejected", value)
+		}
+	}
+
+	t.Setenv(profilesEnvVar, `{"acme":{"tokenFile":"`+tokenFile+`"}}`)
+	t.Setenv(defaultProfileEnvVar, "other")
+	if _, _, err := profilesFromEnv(); err == nil {
+		t.Error("Expected an unknown default profile to be rejected")
+	}
+}
+
+// profilesServer serves a profile router over the given profiles, whose
+// MCP servers run profileServer.
+func profilesServer(t *testing.T, profiles map[string]profile, defaultProfile string) *httptest.Server {
+	t.Helper()
+	logs := &logBuffer{}
+	base := mcpproxy.Config{ServerName: "github-mcp", CommandPath: profileServer, UseShell: true, Logger: logs}
+	m := mcpproxy.NewManager()
+	t.Cleanup(func() { m.Close() })
+	for name, p := range profiles {
+		if _, err := m.Add(name, profilesPrefix+name, p.config(base, name)); err != nil {
+			t.Fatalf("Add(%s) failed: %v", name, err)
+		}
+	}
+	server := httptest.NewServer(newProfileRouter(m, defaultProfile, nil))
+	t.Cleanup(server.Close)
+	return server
+}
+
+type profileResult struct {
+	Result struct {
+		Token string `json:"token"`
+		Host  string `json:"host"`
+	} `json:"result"`
+	Error *mcpproxy.RPCError `json:"error"`
+}
+
+func callProfile(t *testing.T, url, header, body string) profileResult {
+	t.Helper()
+	req, _ := http.NewRequest("POST", url, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if header != "" {
+		req.Header.Set(profileHeader, header)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
+	defer resp.Body.Close()
+	var result profileResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("Cannot decode the response: %v", err)
+	}
+	return result
+}
+
+func TestProfileRouting(t *testing.T) {
+	dir := t.TempDir()
+	acme, umbrella := filepath.Join(dir, "acme"), filepath.Join(dir, "umbrella")
+	writeToken(t, acme, "ghp_acme")
+	writeToken(t, umbrella, "ghp_umbrella")
+	server := profilesServer(t, map[string]profile{
+		"acme":     {TokenFile: acme},
+		"umbrella": {TokenFile: umbrella, Host: "https://ghe.umbrella.example"},
+	}, "")
+
+	const toolsList = `{"jsonrpc":"2.0","id":1,"method":"tools/list"}`
+	if r := callProfile(t, server.URL+"/mcp", "acme", toolsList); r.Result.Token != "ghp_acme" || r.Result.Host != "" {
+		t.Errorf("Expected the header to select acme, got %+v", r)
+	}
+	r := callProfile(t, server.URL+"/mcp", "", `{"jsonrpc":"2.0","id":2,"method":"tools/list","params":{"_meta":{"profile":"umbrella"}}}`)
+	if r.Result.Token != "ghp_umbrella" || r.Result.Host != "https://ghe.umbrella.example" {
+		t.Errorf("Expected _meta to select umbrella, got %+v", r)
+	}
+	if r := callProfile(t, server.URL+"/mcp", "", toolsList); r.Error == nil || r.Error.Code != -32602 || !strings.Contains(r.Error.Message, "acme, umbrella") {
+		t.Errorf("Expected an error listing the profiles without a default, got %+v", r)
+	}
+	if r := callProfile(t, server.URL+"/mcp", "initech", toolsList); r.Error == nil || !strings.Contains(r.Error.Message, `"initech"`) {
+		t.Errorf("Expected an unknown profile to be refused, got %+v", r)
+	}
+
+	for _, path := range []string{"/healthz", "/profiles/acme/healthz", "/profiles/umbrella/status"} {
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatalf("GET %s failed: %v", path, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("Expected GET %s to succeed, got %d", path, resp.StatusCode)
+		}
+	}
+}
+
+func TestProfileTokenReload(t *testing.T) {
+	interval := tokenCheckInterval
+	tokenCheckInterval = 10 * time.Millisecond
+	t.Cleanup(func() { tokenCheckInterval = interval })
+
+	dir := t.TempDir()
+	acme, umbrella := filepath.Join(dir, "acme"), filepath.Join(dir, "umbrella")
+	writeToken(t, acme, "ghp_acme")
+	writeToken(t, umbrella, "ghp_umbrella")
+	profiles := map[string]profile{"acme": {TokenFile: acme}, "umbrella": {TokenFile: umbrella}}
+
+	logs := &logBuffer{}
+	base := mcpproxy.Config{ServerName: "github-mcp", CommandPath: profileServer, UseShell: true, Logger: logs}
+	m := mcpproxy.NewManager()
+	t.Cleanup(func() { m.Close() })
+	stop := make(chan struct{})
+	t.Cleanup(func() { close(stop) })
+	for name, p := range profiles {
+		proxy, err := m.Add(name, profilesPrefix+name, p.config(base, name))
+		if err != nil {
+			t.Fatalf("Add(%s) failed: %v", name, err)
+		}
+		go p.watchToken(name, proxy, stop)
+	}
+	server := httptest.NewServer(newProfileRouter(m, "acme", nil))
+	t.Cleanup(server.Close)
+
+	const toolsList = `{"jsonrpc":"2.0","id":1,"method":"tools/list"}`
+	if r := callProfile(t, server.URL, "", toolsList); r.Result.Token != "ghp_acme" {
+		t.Fatalf("Expected the default profile's token, got %+v", r)
+	}
+
+	writeToken(t, acme, "ghp_rotated")
+	deadline := time.Now().Add(5 * time.Second)
+	for callProfile(t, server.URL, "", toolsList).Result.Token != "ghp_rotated" {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the MCP server to be restarted with the new token")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if restarts := m.Proxy("umbrella").Status().Restarts; restarts != 0 {
+		t.Errorf("Expected the other profile's server to keep running, got %d restarts", restarts)
+	}
+
+	// The rotated token is redacted like those the proxies started with
+	for strings.Count(logs.String(), "starting with [REDACTED]") < 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected every MCP server's stderr in the log, got:\n%s", logs.String())
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if log := logs.String(); strings.Contains(log, "ghp_") {
+		t.Errorf("Expected the tokens to be redacted from the log, got:\n%s", log)
+	}
+}
+
+// logBuffer is a mcpproxy.Logger keeping the messages logged.
+type logBuffer struct {
+	mu  sync.Mutex
+	buf strings.Builder
+}
+
+func (l *logBuffer) log(msg string, kv ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	fmt.Fprintln(&l.buf, append([]interface{}{msg}, kv...)...)
+}
+
+func (l *logBuffer) Debug(msg string, kv ...interface{}) { l.log(msg, kv...) }
+func (l *logBuffer) Info(msg string, kv ...interface{})  { l.log(msg, kv...) }
+func (l *logBuffer) Warn(msg string, kv ...interface{})  { l.log(msg, kv...) }
+func (l *logBuffer) Error(msg string, kv ...interface{}) { l.log(msg, kv...) }
+
+func (l *logBuffer) String() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.buf.String()
+}
+
+func TestProfileSelfTest(t *testing.T) {
+	// Answers every request, unless started with the broken token
+	const server = `[ "$GITHUB_PERSONAL_ACCESS_TOKEN" = ghp_broken ] && exit 1
+while read -r line; do
+  id=$(printf '%s' "$line" | sed -n 's/.*"id":\("[^"]*"\).*/\1/p')
+  [ -n "$id" ] && printf '{"jsonrpc":"2.0","id":%s,"result":{"tools":[]}}\n' "$id"
+done`
+	dir := t.TempDir()
+	acme, umbrella := filepath.Join(dir, "acme"), filepath.Join(dir, "umbrella")
+	writeToken(t, acme, "ghp_acme")
+	writeToken(t, umbrella, "ghp_broken")
+	profiles := map[string]profile{"acme": {TokenFile: acme}, "umbrella": {TokenFile: umbrella}}
+	base := mcpproxy.Config{ServerName: "github-mcp", CommandPath: server, UseShell: true, Logger: &logBuffer{}}
+	opts := mcpproxy.SelfTestOptions{Timeout: 5 * time.Second}
+
+	var out strings.Builder
+	err := selfTestProfiles(base, profiles, opts, &out)
+	if err == nil || !strings.Contains(err.Error(), "umbrella") || strings.Contains(err.Error(), "acme") {
+		t.Errorf("Expected only umbrella to fail, got %v", err)
+	}
+	// A failing profile does not stop the others from being tested
+	if !strings.Contains(out.String(), "Self-test of github-mcp-acme") || !strings.Contains(out.String(), "Self-test of github-mcp-umbrella") {
+		t.Errorf("Expected a self-test of every profile, got:\n%s", out.String())
+	}
+
+	writeToken(t, umbrella, "ghp_umbrella")
+	if err := selfTestProfiles(base, profiles, opts, &out); err != nil {
+		t.Errorf("Expected every profile to pass, got %v", err)
+	}
+}
@@ -0,0 +1,27 @@
+package main
+
+import "os"
+
+// tokenEnvVar holds the token the GitHub MCP server authenticates with.
+const tokenEnvVar = "GITHUB_PERSONAL_ACCESS_TOKEN"
+
+// githubRedactPatterns match GitHub credentials the MCP server may echo in
+// error messages: tokens by their prefixes (personal, OAuth, user-to-server,
+// server-to-server and refresh tokens, and fine-grained personal access
+// tokens) and the "token" scheme of Authorization headers. The proxy
+// redacts Bearer and Basic credentials itself.
+var githubRedactPatterns = []string{
+	`\bgh[pousr]_[A-Za-z0-9]{20,}`,
+	`\bgithub_pat_[A-Za-z0-9_]{20,}`,
+	`(?i)(\btoken\s+)[A-Za-z0-9_]{20,}`,
+}
+
+// githubRedactValues returns the secrets to redact literally: the token
+// the MCP server is given, read at startup. Patterns miss tokens of
+// unusual shapes, such as those of GitHub Enterprise Server.
+func githubRedactValues() []string {
+	if token := os.Getenv(tokenEnvVar); token != "" {
+		return []string{token}
+	}
+	return nil
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/rh-ai-kickstart/ai-architecture-charts/mcp-servers/mcpproxy"
+)
+
+// Environment variables restricting the owners and repositories the MCP
+// server may act on, as comma-separated lists such as "my-org" and
+// "other-org/repo".
+const (
+	allowedOwnersEnvVar = "GITHUB_ALLOWED_OWNERS"
+	allowedReposEnvVar  = "GITHUB_ALLOWED_REPOS"
+)
+
+// toolScope names the arguments of a tool that decide what it acts on.
+type toolScope struct {
+	owner, repo string // the owner and repository acted on, if given
+	target      string // the owner a new repository is created under, which must be given
+	query       bool   // a search query in "query" or "q"
+}
+
+// defaultToolScope is the scope of the many github-mcp tools that take an
+// owner and a repo argument, and of tools that take neither, such as
+// get_me, which are let through.
+var defaultToolScope = toolScope{owner: "owner", repo: "repo"}
+
+// toolScopes are the github-mcp tools whose arguments differ from
+// defaultToolScope. Forks and new repositories go to the authenticated
+// user's account unless an organization is given, so one must be.
+var toolScopes = map[string]toolScope{
+	"fork_repository":   {owner: "owner", repo: "repo", target: "organization"},
+	"create_repository": {target: "organization"},
+
+	"search_code":          {query: true},
+	"search_commits":       {query: true},
+	"search_issues":        {query: true},
+	"search_pull_requests": {query: true},
+	"search_repositories":  {query: true},
+}
+
+// scopeQualifiers are the search qualifiers that select owners and
+// repositories.
+var scopeQualifiers = []string{"org:", "user:", "repo:"}
+
+// outOfScopeCode is the JSON-RPC error code of tool calls outside the
+// allowed owners and repositories: invalid params.
+const outOfScopeCode = -32602
+
+// scope restricts tool calls to a set of owners and repositories. Calls
+// naming anything else are refused by filter; search queries that name no
+// owner or repository are limited to the allowed ones by rewrite.
+type scope struct {
+	owners map[string]bool // lower case
+	repos  map[string]bool // lower case owner/repo
+}
+
+// scopeFromEnv returns the scope configured in the environment, or nil if
+// neither variable is set.
+func scopeFromEnv() (*scope, error) {
+	owners, repos := splitList(os.Getenv(allowedOwnersEnvVar)), splitList(os.Getenv(allowedReposEnvVar))
+	if len(owners) == 0 && len(repos) == 0 {
+		return nil, nil
+	}
+	s := &scope{owners: make(map[string]bool), repos: make(map[string]bool)}
+	for _, owner := range owners {
+		if strings.Contains(owner, "/") {
+			return nil, fmt.Errorf("%s: %q is a repository, expected an owner", allowedOwnersEnvVar, owner)
+		}
+		s.owners[strings.ToLower(owner)] = true
+	}
+	for _, repo := range repos {
+		if owner, name, ok := strings.Cut(repo, "/"); !ok || owner == "" || name == "" || strings.Contains(name, "/") {
+			return nil, fmt.Errorf("%s: %q is not of the form owner/repo", allowedReposEnvVar, repo)
+		}
+		s.repos[strings.ToLower(repo)] = true
+	}
+	return s, nil
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// allows reports whether owner, or repo of owner if repo is not empty, may
+// be acted on.
+func (s *scope) allows(owner, repo string) bool {
+	owner = strings.ToLower(owner)
+	return s.owners[owner] || (repo != "" && s.repos[owner+"/"+strings.ToLower(repo)])
+}
+
+// String lists the allowed owners and repositories.
+func (s *scope) String() string {
+	return strings.Join(append(sortedKeys(s.owners), sortedKeys(s.repos)...), ", ")
+}
+
+// toolCall is a tools/call request with string arguments; arguments of
+// other types are not used.
+type toolCall struct {
+	Method string `json:"method"`
+	Params struct {
+		Name      string                     `json:"name"`
+		Arguments map[string]json.RawMessage `json:"arguments"`
+	} `json:"params"`
+}
+
+func (c toolCall) arg(name string) string {
+	var s string
+	json.Unmarshal(c.Params.Arguments[name], &s)
+	return s
+}
+
+// queryArg returns the name of the argument holding the search query of c.
+func (c toolCall) queryArg() string {
+	if _, ok := c.Params.Arguments["q"]; ok {
+		return "q"
+	}
+	return "query"
+}
+
+// check returns what c acts on outside s, or "" if nothing.
+func (s *scope) check(c toolCall) string {
+	ts, ok := toolScopes[c.Params.Name]
+	if !ok {
+		ts = defaultToolScope
+	}
+	if ts.owner != "" {
+		if owner, repo := c.arg(ts.owner), c.arg(ts.repo); owner != "" && !s.allows(owner, repo) {
+			if repo != "" {
+				return fmt.Sprintf("repository %s/%s", owner, repo)
+			}
+			return fmt.Sprintf("owner %s", owner)
+		}
+	}
+	if ts.target != "" {
+		if target := c.arg(ts.target); target == "" {
+			return "the authenticated user's account (set " + ts.target + ")"
+		} else if !s.allows(target, "") {
+			return fmt.Sprintf("owner %s", target)
+		}
+	}
+	if ts.query {
+		for _, term := range strings.Fields(c.arg(c.queryArg())) {
+			qualifier, value, ok := scopeQualifier(term)
+			if !ok {
+				continue
+			}
+			owner, repo, _ := strings.Cut(value, "/")
+			if qualifier != "repo:" {
+				repo = ""
+			}
+			if !s.allows(owner, repo) {
+				return fmt.Sprintf("%q in the search query", term)
+			}
+		}
+	}
+	return ""
+}
+
+// scopeQualifier splits a search query term into one of scopeQualifiers,
+// in lower case, and its value. Excluding qualifiers such as "-org:x" are
+// not scope qualifiers: they do not limit the search to anything.
+func scopeQualifier(term string) (string, string, bool) {
+	for _, qualifier := range scopeQualifiers {
+		if len(term) > len(qualifier) && strings.EqualFold(term[:len(qualifier)], qualifier) {
+			return qualifier, strings.Trim(term[len(qualifier):], `"`), true
+		}
+	}
+	return "", "", false
+}
+
+// filter refuses tool calls outside s, for mcpproxy.Config.RequestFilter.
+func (s *scope) filter(method string, msg []byte) *mcpproxy.RPCError {
+	var c toolCall
+	if method != "tools/call" || json.Unmarshal(msg, &c) != nil {
+		return nil
+	}
+	outside := s.check(c)
+	if outside == "" {
+		return nil
+	}
+	return &mcpproxy.RPCError{
+		Code:    outOfScopeCode,
+		Message: fmt.Sprintf("Tool %s may not act on %s: this server is limited to %s", c.Params.Name, outside, s),
+	}
+}
+
+// rewrite limits the search queries of search tools that name no owner or
+// repository to the allowed ones, for RequestMiddleware. Queries that name
+// one have been checked by filter.
+func (s *scope) rewrite(msg []byte) []byte {
+	var c toolCall
+	if json.Unmarshal(msg, &c) != nil || c.Method != "tools/call" || !toolScopes[c.Params.Name].query {
+		return msg
+	}
+	if c.Params.Arguments == nil {
+		c.Params.Arguments = make(map[string]json.RawMessage)
+	}
+	name := c.queryArg()
+	query := c.arg(name)
+	for _, term := range strings.Fields(query) {
+		if _, _, ok := scopeQualifier(term); ok {
+			return msg
+		}
+	}
+
+	// GitHub search matches any of several org: and repo: qualifiers
+	qualifiers := []string{strings.TrimSpace(query)}
+	for _, owner := range sortedKeys(s.owners) {
+		qualifiers = append(qualifiers, "org:"+owner)
+	}
+	for _, repo := range sortedKeys(s.repos) {
+		qualifiers = append(qualifiers, "repo:"+repo)
+	}
+	c.Params.Arguments[name], _ = json.Marshal(strings.TrimSpace(strings.Join(qualifiers, " ")))
+
+	var req map[string]json.RawMessage
+	var params map[string]json.RawMessage
+	if json.Unmarshal(msg, &req) != nil || json.Unmarshal(req["params"], &params) != nil {
+		return msg
+	}
+	var err error
+	if params["arguments"], err = json.Marshal(c.Params.Arguments); err != nil {
+		return msg
+	}
+	if req["params"], err = json.Marshal(params); err != nil {
+		return msg
+	}
+	data, err := json.Marshal(req)
+	if err != nil {
+		return msg
+	}
+	return data
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
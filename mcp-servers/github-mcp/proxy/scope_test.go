@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func testScope(t *testing.T) *scope {
+	t.Helper()
+	t.Setenv(allowedOwnersEnvVar, "my-org")
+	t.Setenv(allowedReposEnvVar, "Partner/Shared, partner/docs")
+	s, err := scopeFromEnv()
+	if err != nil || s == nil {
+		t.Fatalf("scopeFromEnv() = %v, %v", s, err)
+	}
+	return s
+}
+
+func callTool(name, arguments string) []byte {
+	return []byte(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"` + name + `","arguments":` + arguments + `}}`)
+}
+
+func TestScopeFilter(t *testing.T) {
+	s := testScope(t)
+
+	for _, tc := range []struct {
+		tool, arguments string
+	}{
+		{"create_issue", `{"owner":"my-org","repo":"anything","title":"Bug"}`},
+		{"create_issue", `{"owner":"MY-ORG","repo":"anything","title":"Bug"}`},
+		{"create_issue", `{"owner":"partner","repo":"shared","title":"Bug"}`},
+		{"get_file_contents", `{"owner":"partner","repo":"docs","path":"README.md"}`},
+		{"get_file_contents", `{"owner":"my-org","repo":"app","path":"go.mod","ref":"main"}`},
+		{"search_code", `{"query":"func main"}`},
+		{"search_code", `{"query":"func main repo:partner/shared"}`},
+		{"search_code", `{"q":"func main org:my-org -org:partner"}`},
+		{"fork_repository", `{"owner":"partner","repo":"shared","organization":"my-org"}`},
+		{"get_me", `{}`},
+	} {
+		if err := s.filter("tools/call", callTool(tc.tool, tc.arguments)); err != nil {
+			t.Errorf("Expected %s %s to be allowed, got %+v", tc.tool, tc.arguments, err)
+		}
+	}
+
+	for _, tc := range []struct {
+		tool, arguments, outside string
+	}{
+		{"create_issue", `{"owner":"other","repo":"app","title":"Bug"}`, "repository other/app"},
+		{"create_issue", `{"owner":"partner","repo":"private","title":"Bug"}`, "repository partner/private"},
+		{"get_file_contents", `{"owner":"other","repo":"app","path":"README.md"}`, "repository other/app"},
+		{"list_issues", `{"owner":"partner"}`, "owner partner"},
+		{"search_code", `{"query":"password repo:other/app"}`, `"repo:other/app"`},
+		{"search_code", `{"q":"password org:my-org user:other"}`, `"user:other"`},
+		{"search_code", `{"query":"password ORG:partner"}`, `"ORG:partner"`},
+		{"fork_repository", `{"owner":"partner","repo":"shared"}`, "the authenticated user's account"},
+		{"create_repository", `{"name":"x","organization":"other"}`, "owner other"},
+	} {
+		err := s.filter("tools/call", callTool(tc.tool, tc.arguments))
+		if err == nil {
+			t.Errorf("Expected %s %s to be refused", tc.tool, tc.arguments)
+			continue
+		}
+		if err.Code != outOfScopeCode || !strings.Contains(err.Message, tc.outside) || !strings.Contains(err.Message, "my-org, partner/docs, partner/shared") {
+			t.Errorf("Unexpected error for %s %s: %+v", tc.tool, tc.arguments, err)
+		}
+	}
+
+	if err := s.filter("tools/list", []byte(`{"jsonrpc":"2.0","id":1,"method":"tools/list"}`)); err != nil {
+		t.Errorf("Expected other methods to be let through, got %+v", err)
+	}
+}
+
+func TestScopeSearchQuery(t *testing.T) {
+	s := testScope(t)
+
+	for _, tc := range []struct {
+		arguments, want string
+	}{
+		// An unqualified query is limited to the allowed scope
+		{`{"query":"func main","perPage":5}`, "func main org:my-org repo:partner/docs repo:partner/shared"},
+		{`{"q":"password -org:my-org"}`, "password -org:my-org org:my-org repo:partner/docs repo:partner/shared"},
+		{`{}`, "org:my-org repo:partner/docs repo:partner/shared"},
+		// A query that already names an allowed scope is left alone
+		{`{"query":"func main repo:partner/docs"}`, "func main repo:partner/docs"},
+	} {
+		var msg struct {
+			Params struct {
+				Arguments map[string]interface{} `json:"arguments"`
+			} `json:"params"`
+		}
+		if err := json.Unmarshal(s.rewrite(callTool("search_code", tc.arguments)), &msg); err != nil {
+			t.Fatal(err)
+		}
+		query := msg.Params.Arguments["query"]
+		if query == nil {
+			query = msg.Params.Arguments["q"]
+		}
+		if query != tc.want {
+			t.Errorf("Expected %s to be searched as %q, got %v", tc.arguments, tc.want, query)
+		}
+		if strings.Contains(tc.arguments, "perPage") && msg.Params.Arguments["perPage"] != 5.0 {
+			t.Errorf("Expected the other arguments to be kept, got %v", msg.Params.Arguments)
+		}
+	}
+
+	// Calls to other tools are not rewritten
+	msg := callTool("create_issue", `{"owner":"my-org","repo":"app","title":"q"}`)
+	if got := s.rewrite(msg); string(got) != string(msg) {
+		t.Errorf("Expected other tools to be left alone, got %s", got)
+	}
+}
+
+func TestScopeFromEnv(t *testing.T) {
+	if s, err := scopeFromEnv(); s != nil || err != nil {
+		t.Errorf("Expected no scope by default, got %v, %v", s, err)
+	}
+	t.Setenv(allowedReposEnvVar, "no-owner")
+	if _, err := scopeFromEnv(); err == nil {
+		t.Error("Expected a repository without an owner to be rejected")
+	}
+	t.Setenv(allowedReposEnvVar, "")
+	t.Setenv(allowedOwnersEnvVar, "org/repo")
+	if _, err := scopeFromEnv(); err == nil {
+		t.Error("Expected a repository among the owners to be rejected")
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/rh-ai-kickstart/ai-architecture-charts/mcp-servers/mcpproxy"
+)
+
+// Environment variables configuring the webhook receiver: the secret GitHub
+// signs deliveries with, which enables it, and the comma-separated events to
+// pass on to clients, by default defaultWebhookEvents.
+const (
+	webhookSecretEnvVar = "GITHUB_WEBHOOK_SECRET"
+	webhookEventsEnvVar = "GITHUB_WEBHOOK_EVENTS"
+)
+
+// webhookPath is where GitHub delivers webhook events.
+const webhookPath = "/webhooks/github"
+
+// maxWebhookBytes is the largest delivery accepted, GitHub's own cap on
+// webhook payloads.
+const maxWebhookBytes = 25 << 20
+
+var defaultWebhookEvents = []string{"issues", "pull_request", "push"}
+
+// webhookResources map the events the receiver understands to the URI of
+// the resource they update, see webhookPayload.
+var webhookResources = map[string]func(p webhookPayload) string{
+	"issues":        issueURI,
+	"issue_comment": issueURI,
+	"pull_request": func(p webhookPayload) string {
+		if p.PullRequest == nil || p.PullRequest.Number == 0 {
+			return ""
+		}
+		return fmt.Sprintf("repo://%s/pulls/%d", p.Repository.FullName, p.PullRequest.Number)
+	},
+	"push": func(p webhookPayload) string {
+		if p.Ref == "" {
+			return ""
+		}
+		return fmt.Sprintf("repo://%s/%s", p.Repository.FullName, p.Ref)
+	},
+}
+
+func issueURI(p webhookPayload) string {
+	if p.Issue == nil || p.Issue.Number == 0 {
+		return ""
+	}
+	return fmt.Sprintf("repo://%s/issues/%d", p.Repository.FullName, p.Issue.Number)
+}
+
+// webhookPayload holds the members of GitHub event payloads that locate the
+// resource an event updates.
+type webhookPayload struct {
+	Action     string `json:"action"`
+	Ref        string `json:"ref"`
+	Repository struct {
+		FullName string `json:"full_name"`
+	} `json:"repository"`
+	Issue *struct {
+		Number int `json:"number"`
+	} `json:"issue"`
+	PullRequest *struct {
+		Number int `json:"number"`
+	} `json:"pull_request"`
+}
+
+// webhook receives GitHub webhook deliveries and passes the selected events
+// on to clients streaming notifications, as notifications/resources/updated
+// for the issue, pull request or ref they concern.
+type webhook struct {
+	secret   string
+	events   map[string]bool
+	notifier *mcpproxy.Notifier
+}
+
+// webhookFromEnv returns the webhook receiver configured in the
+// environment, sending notifications through notifier, or nil if no secret
+// is set.
+func webhookFromEnv(notifier *mcpproxy.Notifier) (*webhook, error) {
+	secret := os.Getenv(webhookSecretEnvVar)
+	if secret == "" {
+		return nil, nil
+	}
+	events := splitList(os.Getenv(webhookEventsEnvVar))
+	if len(events) == 0 {
+		events = defaultWebhookEvents
+	}
+	h := &webhook{secret: secret, events: make(map[string]bool), notifier: notifier}
+	for _, event := range events {
+		if webhookResources[event] == nil {
+			return nil, fmt.Errorf("%s: unsupported event %q, expected one of %s",
+				webhookEventsEnvVar, event, strings.Join(supportedWebhookEvents(), ", "))
+		}
+		h.events[event] = true
+	}
+	return h, nil
+}
+
+func supportedWebhookEvents() []string {
+	events := make(map[string]bool, len(webhookResources))
+	for event := range webhookResources {
+		events[event] = true
+	}
+	return sortedKeys(events)
+}
+
+// verify reports whether signature, the X-Hub-Signature-256 header of a
+// delivery, is the HMAC-SHA256 of body with the secret.
+func (h *webhook) verify(body []byte, signature string) bool {
+	sig, ok := strings.CutPrefix(signature, "sha256=")
+	if !ok {
+		return false
+	}
+	got, err := hex.DecodeString(sig)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(h.secret))
+	mac.Write(body)
+	return hmac.Equal(got, mac.Sum(nil))
+}
+
+// serve handles a delivery. Deliveries that are too large are refused with
+// 413 and ones without a valid signature with 401; events that are not
+// selected, and GitHub's ping, are acknowledged with 204 and dropped.
+func (h *webhook) serve(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBytes))
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			slog.Warn("Refusing oversized webhook delivery", "limit", maxErr.Limit)
+			http.Error(w, "Delivery too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "Error reading delivery", http.StatusBadRequest)
+		return
+	}
+
+	delivery := r.Header.Get("X-GitHub-Delivery")
+	if !h.verify(body, r.Header.Get("X-Hub-Signature-256")) {
+		slog.Warn("Refusing webhook delivery with an invalid signature", "delivery", delivery, "remote", r.RemoteAddr)
+		http.Error(w, "Invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	event := r.Header.Get("X-GitHub-Event")
+	if !h.events[event] {
+		slog.Debug("Ignoring webhook event", "event", event, "delivery", delivery)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	var payload webhookPayload
+	if err := json.Unmarshal(body, &payload); err != nil || payload.Repository.FullName == "" {
+		http.Error(w, "Invalid payload", http.StatusBadRequest)
+		return
+	}
+	uri := webhookResources[event](payload)
+	if uri == "" {
+		http.Error(w, "Invalid payload", http.StatusBadRequest)
+		return
+	}
+
+	err = h.notifier.Notify("notifications/resources/updated", map[string]interface{}{
+		"uri": uri,
+		"_meta": map[string]string{
+			"githubEvent":    event,
+			"githubAction":   payload.Action,
+			"githubDelivery": delivery,
+		},
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	slog.Info("Received webhook event", "event", event, "action", payload.Action, "uri", uri, "delivery", delivery)
+	w.WriteHeader(http.StatusAccepted)
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rh-ai-kickstart/ai-architecture-charts/mcp-servers/mcpproxy"
+)
+
+const testWebhookSecret = "It's a Secret to Everybody"
+
+func sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestWebhookSignature(t *testing.T) {
+	h := &webhook{secret: testWebhookSecret}
+	body := []byte("Hello, World!")
+
+	// The example from GitHub's documentation on validating deliveries
+	const documented = "sha256=757107ea0eb2509fc211221cce984b8a37570b6d7586c22c46f4379c8b043e17"
+	if !h.verify(body, documented) {
+		t.Error("Expected the documented signature to be valid")
+	}
+	for _, signature := range []string{
+		"",
+		strings.TrimPrefix(documented, "sha256="),
+		"sha1=757107ea0eb2509fc211221cce984b8a37570b6d7586c22c46f4379c8b043e17",
+		"sha256=not-hex",
+		sign("another secret", body),
+	} {
+		if h.verify(body, signature) {
+			t.Errorf("Expected signature %q to be invalid", signature)
+		}
+	}
+	if h.verify([]byte("Hello, World?"), documented) {
+		t.Error("Expected the signature of another body to be invalid")
+	}
+}
+
+// webhookServer serves a proxy receiving webhooks for the given events and
+// returns it with the notifications/resources/updated messages it streams.
+func webhookServer(t *testing.T, events string) (*httptest.Server, <-chan string) {
+	t.Helper()
+	t.Setenv(webhookSecretEnvVar, testWebhookSecret)
+	t.Setenv(webhookEventsEnvVar, events)
+	notifier := &mcpproxy.Notifier{}
+	hook, err := webhookFromEnv(notifier)
+	if err != nil || hook == nil {
+		t.Fatalf("webhookFromEnv() = %v, %v", hook, err)
+	}
+	proxy, err := mcpproxy.NewMCPProxy(mcpproxy.Config{
+		ServerName:               "github-mcp",
+		CommandPath:              "cat >/dev/null",
+		UseShell:                 true,
+		EnableNotificationStream: true,
+		Notifier:                 notifier,
+		Routes:                   []mcpproxy.Route{{Pattern: "POST " + webhookPath, Handler: hook.serve}},
+	})
+	if err != nil {
+		t.Fatalf("NewMCPProxy failed: %v", err)
+	}
+	t.Cleanup(func() { proxy.Close() })
+	server := httptest.NewServer(proxy.Handler())
+	t.Cleanup(server.Close)
+
+	req, _ := http.NewRequest("GET", server.URL+"/mcp", nil)
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected a notification stream, got %d", resp.StatusCode)
+	}
+	messages := make(chan string, 10)
+	go func() {
+		defer close(messages)
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			if data, ok := strings.CutPrefix(scanner.Text(), "data: "); ok {
+				messages <- data
+			}
+		}
+	}()
+	return server, messages
+}
+
+func deliver(t *testing.T, server *httptest.Server, event string, body []byte, signature string) int {
+	t.Helper()
+	req, _ := http.NewRequest("POST", server.URL+webhookPath, strings.NewReader(string(body)))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-GitHub-Event", event)
+	req.Header.Set("X-GitHub-Delivery", "72d3162e-cc78-11e3-81ab-4c9367dc0958")
+	req.Header.Set("X-Hub-Signature-256", signature)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestWebhookEvents(t *testing.T) {
+	server, messages := webhookServer(t, "issues,pull_request,push")
+
+	for _, tc := range []struct {
+		event, uri, action string
+	}{
+		{"issues", "repo://my-org/app/issues/42", "opened"},
+		{"pull_request", "repo://my-org/app/pulls/7", "synchronize"},
+		{"push", "repo://my-org/app/refs/heads/main", ""},
+	} {
+		body, err := os.ReadFile(filepath.Join("testdata", "webhooks", tc.event+".json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status := deliver(t, server, tc.event, body, sign(testWebhookSecret, body)); status != http.StatusAccepted {
+			t.Fatalf("%s: expected 202 Accepted, got %d", tc.event, status)
+		}
+
+		var msg struct {
+			Method string `json:"method"`
+			Params struct {
+				URI  string            `json:"uri"`
+				Meta map[string]string `json:"_meta"`
+			} `json:"params"`
+		}
+		select {
+		case data := <-messages:
+			if err := json.Unmarshal([]byte(data), &msg); err != nil {
+				t.Fatalf("%s: invalid notification %s", tc.event, data)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: timed out waiting for the notification", tc.event)
+		}
+		if msg.Method != "notifications/resources/updated" || msg.Params.URI != tc.uri {
+			t.Errorf("%s: expected an update of %s, got %+v", tc.event, tc.uri, msg)
+		}
+		if msg.Params.Meta["githubEvent"] != tc.event || msg.Params.Meta["githubAction"] != tc.action {
+			t.Errorf("%s: expected the event and action in _meta, got %v", tc.event, msg.Params.Meta)
+		}
+	}
+}
+
+func TestWebhookRefused(t *testing.T) {
+	server, messages := webhookServer(t, "issues")
+	body, err := os.ReadFile(filepath.Join("testdata", "webhooks", "issues.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	push, err := os.ReadFile(filepath.Join("testdata", "webhooks", "push.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	oversized := []byte(`{"padding":"` + strings.Repeat("x", maxWebhookBytes) + `"}`)
+
+	for _, tc := range []struct {
+		name, event string
+		body        []byte
+		signature   string
+		status      int
+	}{
+		{"unsigned", "issues", body, "", http.StatusUnauthorized},
+		{"wrong secret", "issues", body, sign("guessed", body), http.StatusUnauthorized},
+		{"tampered", "issues", []byte(strings.Replace(string(body), "42", "43", 1)), sign(testWebhookSecret, body), http.StatusUnauthorized},
+		{"oversized", "issues", oversized, sign(testWebhookSecret, oversized), http.StatusRequestEntityTooLarge},
+		{"not selected", "push", push, sign(testWebhookSecret, push), http.StatusNoContent},
+		{"ping", "ping", []byte(`{"zen":"Keep it logically awesome."}`), sign(testWebhookSecret, []byte(`{"zen":"Keep it logically awesome."}`)), http.StatusNoContent},
+		{"no issue", "issues", []byte(`{"repository":{"full_name":"my-org/app"}}`), sign(testWebhookSecret, []byte(`{"repository":{"full_name":"my-org/app"}}`)), http.StatusBadRequest},
+	} {
+		if status := deliver(t, server, tc.event, tc.body, tc.signature); status != tc.status {
+			t.Errorf("%s: expected status %d, got %d", tc.name, tc.status, status)
+		}
+	}
+
+	select {
+	case data := <-messages:
+		t.Errorf("Expected no notification, got %s", data)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestWebhookConfig(t *testing.T) {
+	t.Setenv(webhookSecretEnvVar, "")
+	if h, err := webhookFromEnv(nil); h != nil || err != nil {
+		t.Errorf("Expected no receiver without a secret, got %v, %v", h, err)
+	}
+
+	t.Setenv(webhookSecretEnvVar, testWebhookSecret)
+	h, err := webhookFromEnv(nil)
+	if err != nil {
+		t.Fatalf("webhookFromEnv() failed: %v", err)
+	}
+	if got := strings.Join(sortedKeys(h.events), ","); got != "issues,pull_request,push" {
+		t.Errorf("Expected the default events, got %s", got)
+	}
+
+	t.Setenv(webhookEventsEnvVar, "issues,deployment")
+	if _, err := webhookFromEnv(nil); err == nil || !strings.Contains(err.Error(), `"deployment"`) {
+		t.Errorf("Expected the unsupported event to be rejected, got %v", err)
+	}
+}
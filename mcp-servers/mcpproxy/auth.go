@@ -0,0 +1,135 @@
+package mcpproxy
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// authTokenEnvVar is the environment variable AuthToken defaults to.
+const authTokenEnvVar = "MCP_PROXY_AUTH_TOKEN"
+
+// adminTokenEnvVar is the environment variable AdminToken defaults to, and
+// adminTokenHeader the header clients send it in.
+const (
+	adminTokenEnvVar = "MCP_PROXY_ADMIN_TOKEN"
+	adminTokenHeader = "X-Admin-Token"
+)
+
+// tokenIdentity is the identity of clients authenticated with AuthToken,
+// which is shared by all of them.
+const tokenIdentity = "token"
+
+var errInvalidToken = errors.New("missing or invalid bearer token")
+
+type identityKey struct{}
+
+// requestIdentity carries the client identity of a request. Handler puts
+// it in the request context with the remote IP, and authenticated replaces
+// it with the authenticated identity, so that the access log written by
+// Handler sees the final value.
+type requestIdentity struct {
+	name string
+}
+
+// IdentityFromContext returns the identity of the client making the HTTP
+// request that ctx belongs to: the one returned by Config.Authenticator,
+// "token" for clients authenticated with AuthToken, or otherwise the
+// client's IP address. It returns "" for contexts not derived from a
+// request served by Handler.
+func IdentityFromContext(ctx context.Context) string {
+	if id, ok := ctx.Value(identityKey{}).(*requestIdentity); ok {
+		return id.name
+	}
+	return ""
+}
+
+// withIdentity returns r with a requestIdentity initialized to the remote IP.
+func withIdentity(r *http.Request) (*http.Request, *requestIdentity) {
+	id := &requestIdentity{name: remoteIP(r)}
+	return r.WithContext(context.WithValue(r.Context(), identityKey{}, id)), id
+}
+
+// identity returns the client identity of r, falling back to the remote IP
+// for requests that did not go through Handler.
+func identity(r *http.Request) string {
+	if id := IdentityFromContext(r.Context()); id != "" {
+		return id
+	}
+	return remoteIP(r)
+}
+
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// authenticated wraps h so that, when an Authenticator or AuthToken is
+// configured, requests must pass it. CORS preflight requests are let
+// through since browsers send them without credentials.
+func (p *MCPProxy) authenticated(h http.HandlerFunc) http.HandlerFunc {
+	authenticate := p.config.Authenticator
+	if authenticate == nil && p.config.AuthToken != "" {
+		authenticate = func(r *http.Request) (string, error) {
+			if !validBearer(r, p.config.AuthToken) {
+				return "", errInvalidToken
+			}
+			return tokenIdentity, nil
+		}
+	}
+	if authenticate == nil {
+		return h
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions && p.dynamic.Load().EnableCORS {
+			h(w, r)
+			return
+		}
+		name, err := authenticate(r)
+		if err != nil {
+			p.log.Warn("Rejecting unauthenticated request", "remote", r.RemoteAddr, "path", r.URL.Path, "error", err)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="mcp-proxy"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if id, ok := r.Context().Value(identityKey{}).(*requestIdentity); ok {
+			id.name = name
+		} else {
+			r = r.WithContext(context.WithValue(r.Context(), identityKey{}, &requestIdentity{name: name}))
+		}
+		h(w, r)
+	}
+}
+
+// admin wraps h, an admin or debug endpoint, so that requests must carry
+// AdminToken when it is configured. It is checked after authenticated.
+func (p *MCPProxy) admin(h http.HandlerFunc) http.HandlerFunc {
+	token := p.config.AdminToken
+	if token == "" {
+		return h
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get(adminTokenHeader)), []byte(token)) != 1 {
+			p.log.Warn("Rejecting admin request without a valid admin token", "remote", r.RemoteAddr, "path", r.URL.Path, "identity", identity(r))
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		h(w, r)
+	}
+}
+
+// validBearer reports whether r carries token in its Authorization header.
+func validBearer(r *http.Request, token string) bool {
+	scheme, credentials, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(credentials), []byte(token)) == 1
+}
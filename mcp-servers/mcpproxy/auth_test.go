@@ -0,0 +1,151 @@
+package mcpproxy
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAuthToken(t *testing.T) {
+	handler := newFakeProxy(t, "reflect", Config{AuthToken: "s3cret", EnableMetrics: true, EnableCORS: true}).Handler()
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		auth   string
+		want   int
+	}{
+		{"missing token", "POST", "/", "", http.StatusUnauthorized},
+		{"wrong token", "POST", "/", "Bearer nope", http.StatusUnauthorized},
+		{"wrong scheme", "POST", "/", "Basic s3cret", http.StatusUnauthorized},
+		{"valid token", "POST", "/", "Bearer s3cret", http.StatusOK},
+		{"preflight", "OPTIONS", "/", "", http.StatusOK},
+		{"metrics stay open", "GET", "/metrics", "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"ping"}`))
+			if tt.auth != "" {
+				req.Header.Set("Authorization", tt.auth)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Errorf("Expected %d, got %d", tt.want, w.Code)
+			}
+			if w.Code == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+				t.Error("Expected a WWW-Authenticate challenge")
+			}
+		})
+	}
+}
+
+func TestAdminToken(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	writeConfigFile(t, path, `{}`)
+	handler := newFakeProxy(t, "reflect", Config{
+		AuthToken:            "s3cret",
+		AdminToken:           "4dmin",
+		ConfigFile:           path,
+		EnableDebugEndpoints: true,
+	}).Handler()
+
+	tests := []struct {
+		name  string
+		path  string
+		auth  string
+		admin string
+		want  int
+	}{
+		{"reload without admin token", "/admin/reload", "Bearer s3cret", "", http.StatusForbidden},
+		{"reload with wrong admin token", "/admin/reload", "Bearer s3cret", "nope", http.StatusForbidden},
+		{"reload with admin token", "/admin/reload", "Bearer s3cret", "4dmin", http.StatusOK},
+		{"reload unauthenticated", "/admin/reload", "", "4dmin", http.StatusUnauthorized},
+		{"debug without admin token", "/debug/raw", "Bearer s3cret", "", http.StatusForbidden},
+		{"debug with admin token", "/debug/raw", "Bearer s3cret", "4dmin", http.StatusOK},
+		{"MCP endpoint needs no admin token", "/", "Bearer s3cret", "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", tt.path, strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"ping"}`))
+			if tt.auth != "" {
+				req.Header.Set("Authorization", tt.auth)
+			}
+			if tt.admin != "" {
+				req.Header.Set("X-Admin-Token", tt.admin)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Errorf("Expected %d, got %d: %s", tt.want, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestIdentityInAccessLog(t *testing.T) {
+	logs := &recordingLogger{}
+	var seen string
+	proxy := newFakeProxy(t, "reflect", Config{
+		Logger:        logs,
+		EnableMetrics: true,
+		Authenticator: func(r *http.Request) (string, error) {
+			if user := r.Header.Get("X-User"); user != "" {
+				return user, nil
+			}
+			return "", errors.New("no user")
+		},
+		ExtraRoutes: map[string]http.HandlerFunc{
+			"/whoami": func(w http.ResponseWriter, r *http.Request) { seen = IdentityFromContext(r.Context()) },
+		},
+	})
+	handler := proxy.Handler()
+
+	req := httptest.NewRequest("POST", "/", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"ping"}`))
+	req.Header.Set("X-User", "alice")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", w.Code)
+	}
+	if !strings.Contains(logs.String(), `INFO Access server=test identity=alice remote=192.0.2.1:1234 method=POST path=/ status=200`) {
+		t.Errorf("Expected alice in the access log, got:\n%s", logs.String())
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("POST", "/", strings.NewReader(`{}`)))
+	if w.Code != http.StatusUnauthorized || !strings.Contains(logs.String(), `identity=192.0.2.1 remote=192.0.2.1:1234 method=POST path=/ status=401`) {
+		t.Errorf("Expected the rejected request to be logged with the remote IP, got %d:\n%s", w.Code, logs.String())
+	}
+
+	// Open routes are attributed to the remote IP
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/whoami", nil))
+	if seen != "192.0.2.1" {
+		t.Errorf("Expected the remote IP as identity, got %q", seen)
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if !strings.Contains(w.Body.String(), `mcp_proxy_requests_by_identity_total{server="test",identity="alice"} 1`) {
+		t.Errorf("Expected a per-identity count, got:\n%s", w.Body.String())
+	}
+}
+
+func TestIdentityLabelsCapped(t *testing.T) {
+	m := newMetrics("test")
+	for i := 0; i < maxIdentityLabels+5; i++ {
+		m.countIdentity(fmt.Sprintf("user%d", i))
+	}
+	m.countIdentity("user0")
+	if got := m.byIdentity.Value("other"); got != 5 {
+		t.Errorf("Expected 5 requests counted as other, got %v", got)
+	}
+	if got := m.byIdentity.Value("user0"); got != 2 {
+		t.Errorf("Expected known identities to keep their series, got %v", got)
+	}
+}
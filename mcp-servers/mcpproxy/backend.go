@@ -0,0 +1,340 @@
+package mcpproxy
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// backend is one running instance of the MCP server subprocess. Its pipes
+// are only used by the processRequests goroutine.
+type backend struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	writer *frameWriter
+	stdout *frameReader
+
+	completed completedIDs // ids of recent responses, to spot duplicates
+
+	exited  chan struct{} // closed once the process has been reaped
+	exitErr error         // result of cmd.Wait, valid once exited is closed
+
+	lingering sync.Once // see killIfLingering
+
+	// abandoned is set when the process is killed because it did not abort
+	// a tool call that timed out, see Config.ToolCallTimeout.
+	abandoned atomic.Bool
+
+	// desynced is set when the process is killed because its responses
+	// stopped matching the requests, see Config.MaxDesyncedResponses.
+	desynced atomic.Bool
+
+	// replaced is set when the process is stopped by MCPProxy.Restart.
+	replaced atomic.Bool
+
+	// stopped is set when the proxy stops or kills the process for any
+	// reason, so that its exit is not blamed on the MCP server.
+	stopped atomic.Bool
+
+	// started is when the process was started, spoken set once it has
+	// written a JSON message, and startupNoise and junk count the lines it
+	// wrote that are not, within and after its startup grace. They are
+	// only used by processRequests, see MCPProxy.junkLine.
+	started      time.Time
+	spoken       bool
+	startupNoise int
+	junk         int
+
+	// desyncs counts the responses in a row whose id matched no request,
+	// see MCPProxy.desyncedResponse. It is only used by processRequests.
+	desyncs int
+
+	// initialized is set once initialize has been sent to this instance,
+	// by a client or by replayInitialize.
+	initialized bool
+
+	// awaitingInitialized is set while the MCP server waits for a client
+	// to send notifications/initialized, until initializedTimer sends it
+	// for them, see MCPProxy.awaitInitialized. Both are only used by
+	// processRequests.
+	awaitingInitialized bool
+	initializedTimer    *time.Timer
+
+	// scratch is the process's scratch directory, see Config.ScratchRoot.
+	scratch *scratchDir
+
+	log Logger
+}
+
+// lingerGrace is how long the MCP server process may keep running after its
+// stdout closes before it is killed. A wrapper command may outlive the
+// server it runs, e.g. when the remote end of "oc exec" dies.
+var lingerGrace = 5 * time.Second
+
+// pipeDrainGrace is how long the MCP server's output is still read after it
+// has exited.
+var pipeDrainGrace = time.Second
+
+// startBackend launches the MCP server described by cfg, with env added to
+// its environment, logging to logger. Its stderr is also kept in output,
+// which may be nil.
+func startBackend(cfg Config, logger Logger, output *outputBuffer, env []string) (*backend, error) {
+	return launchBackend(cfg, logger, logger, output, env)
+}
+
+// launchBackend launches the MCP server described by cfg, with env added to
+// its environment, logging its start and exit to events and everything
+// else, such as its stderr, to logger.
+func launchBackend(cfg Config, logger, events Logger, output *outputBuffer, env []string) (*backend, error) {
+	cmdPath, err := resolveCommandPath(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build MCP server command: %w", err)
+	}
+	if cmdPath != cfg.CommandPath && os.Getenv(cfg.PathEnvVar) == "" {
+		events.Info("Expanded MCP server path", "from", cfg.CommandPath, "to", cmdPath)
+	}
+
+	events.Info("Starting MCP server", "path", cmdPath)
+
+	cmd, err := backendCommand(context.Background(), cfg, cfg.CommandArgs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build MCP server command: %w", err)
+	}
+	if cmd.Args[0] != cmdPath {
+		events.Info("Launching MCP server", "command", strings.Join(cmd.Args, " "))
+	}
+
+	scratch, err := newScratchDir(cfg, logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create scratch directory: %w", err)
+	}
+
+	// Everything opened for the MCP server is tracked in opened and closed
+	// again if it cannot be launched, so that failed attempts, which
+	// supervise and callers of NewMCPProxy may repeat many times, leak
+	// nothing.
+	var opened []io.Closer
+	launched := false
+	defer func() {
+		if launched {
+			return
+		}
+		for _, c := range opened {
+			c.Close()
+		}
+		if scratch != nil {
+			scratch.remove()
+		}
+	}()
+	if scratch != nil {
+		env = append(env[:len(env):len(env)], cfg.ScratchEnvVar+"="+scratch.path)
+		if cmd.Dir == "" {
+			cmd.Dir = scratch.path
+			env = append(env, "PWD="+scratch.path)
+		}
+	}
+	if len(env) > 0 {
+		if cmd.Env == nil {
+			cmd.Env = os.Environ()
+		}
+		cmd.Env = append(cmd.Env, env...)
+	}
+
+	// The pipes are plain pipes rather than cmd.StdinPipe and friends, so
+	// that they can all be closed on failure and cmd.Wait does not wait for
+	// them: a process the MCP server leaves behind may hold them open long
+	// after the server itself has exited, which must not keep it from being
+	// reaped.
+	stdinR, stdin, err := os.Pipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stdin pipe: %w", err)
+	}
+	opened = append(opened, stdinR, stdin)
+	stdout, stdoutW, err := os.Pipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stdout pipe: %w", err)
+	}
+	opened = append(opened, stdout, stdoutW)
+	stderr, stderrW, err := os.Pipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stderr pipe: %w", err)
+	}
+	opened = append(opened, stderr, stderrW)
+	cmd.Stdin = stdinR
+	cmd.Stdout = stdoutW
+	cmd.Stderr = stderrW
+
+	err = startChild(cmd)
+	// The child has its own copies of its ends now
+	stdinR.Close()
+	stdoutW.Close()
+	stderrW.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start MCP server: %w", err)
+	}
+
+	if err := applyProcessLimits(cmd.Process.Pid, cfg); err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		childReaped(cmd)
+		return nil, fmt.Errorf("failed to apply process limits to MCP server: %w", err)
+	}
+
+	events.Info("Started MCP server", "pid", cmd.Process.Pid)
+
+	writer, reader := newFraming(cfg, stdin, stdout)
+	b := &backend{
+		cmd:     cmd,
+		stdin:   stdin,
+		writer:  writer,
+		stdout:  reader,
+		exited:  make(chan struct{}),
+		started: time.Now(),
+		scratch: scratch,
+		log:     logger,
+	}
+	launched = true
+	if scratch != nil {
+		go scratch.watch(b.exited)
+	}
+
+	// Log stderr from the MCP server until every process holding it has
+	// closed it.
+	stderrDone := make(chan struct{})
+	go func() {
+		defer close(stderrDone)
+		scanner := bufio.NewScanner(stderr)
+		for scanner.Scan() {
+			logger.Info("MCP server stderr", "line", scanner.Text())
+			output.add(cmd.Process.Pid, "stderr", scanner.Text())
+		}
+	}()
+
+	// Reap the MCP server as soon as it exits, so it never lingers as a
+	// zombie. Output it wrote before exiting is still read for up to
+	// pipeDrainGrace; the pipes are then closed so that pending reads fail
+	// even if other processes keep them open.
+	go func() {
+		b.exitErr = cmd.Wait()
+		childReaped(cmd)
+		events.Info("MCP server exited", "pid", cmd.Process.Pid, "status", exitStatus(b.exitErr))
+		select {
+		case <-stderrDone:
+		case <-time.After(pipeDrainGrace):
+			logger.Warn("MCP server output is held open by another process, closing it", "pid", cmd.Process.Pid)
+		}
+		stdout.Close()
+		stderr.Close()
+		close(b.exited)
+		if scratch != nil {
+			scratch.remove()
+		}
+	}()
+
+	return b, nil
+}
+
+// scratchBytes returns the size of b's scratch directory, or 0 if b is nil
+// or has none.
+func (b *backend) scratchBytes() int64 {
+	if b == nil {
+		return 0
+	}
+	return b.scratch.bytes()
+}
+
+// resolveCommandPath returns the MCP server binary to run: CommandPath,
+// expanded with ExpandPath unless UseShell is set, or the value of the
+// PathEnvVar environment variable if it is set.
+func resolveCommandPath(cfg Config) (string, error) {
+	if cfg.PathEnvVar != "" {
+		if envPath := os.Getenv(cfg.PathEnvVar); envPath != "" {
+			return envPath, nil
+		}
+	}
+	if cfg.UseShell {
+		return cfg.CommandPath, nil
+	}
+	return ExpandPath(cfg.CommandPath)
+}
+
+// stop closes the MCP server's stdin to signal EOF and waits up to grace for
+// it to exit before killing it. It returns once the process has been
+// reaped. stop may be called more than once.
+func (b *backend) stop(grace time.Duration) error {
+	b.stopped.Store(true)
+	b.stdin.Close()
+
+	select {
+	case <-b.exited:
+		return nil
+	case <-time.After(grace):
+	}
+
+	b.log.Warn("MCP server did not exit in time, killing it", "pid", b.cmd.Process.Pid, "grace", grace)
+	err := b.cmd.Process.Kill()
+	<-b.exited
+	if err != nil && err != os.ErrProcessDone {
+		return fmt.Errorf("failed to kill MCP server: %w", err)
+	}
+	return nil
+}
+
+// killIfLingering kills the process if it is still running lingerGrace
+// after its stdout was found closed, so that it is reaped and restarted.
+func (b *backend) killIfLingering() {
+	b.lingering.Do(func() {
+		grace := lingerGrace
+		go func() {
+			select {
+			case <-b.exited:
+			case <-time.After(grace):
+				b.log.Warn("MCP server closed its stdout but is still running, killing it", "pid", b.cmd.Process.Pid)
+				b.stopped.Store(true)
+				b.cmd.Process.Kill()
+			}
+		}()
+	})
+}
+
+// exitStatus describes the result of cmd.Wait for logging.
+func exitStatus(err error) string {
+	if err == nil {
+		return "exit status 0"
+	}
+	return err.Error()
+}
+
+// completedIDsSize is how many response ids completedIDs remembers.
+const completedIDsSize = 64
+
+// completedIDs is a fixed-size set of the most recently completed response
+// ids, as formatted by formatID.
+type completedIDs struct {
+	ids  [completedIDsSize]string
+	next int
+}
+
+func (c *completedIDs) add(id string) {
+	c.ids[c.next] = id
+	c.next = (c.next + 1) % len(c.ids)
+}
+
+func (c *completedIDs) contains(id string) bool {
+	if id == "" {
+		return false
+	}
+	for _, seen := range c.ids {
+		if seen == id {
+			return true
+		}
+	}
+	return false
+}
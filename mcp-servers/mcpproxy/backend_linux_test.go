@@ -0,0 +1,38 @@
+//go:build linux
+
+package mcpproxy
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+// openFDs returns the number of file descriptors the test process has open.
+func openFDs(t *testing.T) int {
+	t.Helper()
+	fds, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		t.Fatalf("Cannot list file descriptors: %v", err)
+	}
+	return len(fds)
+}
+
+func TestFailedConstructionLeaksNoFDs(t *testing.T) {
+	cfg := Config{ServerName: "test", CommandPath: "/nonexistent/mcp-server", Logger: &recordingLogger{}}
+	if _, err := NewMCPProxy(cfg); err == nil {
+		t.Fatal("Expected NewMCPProxy to fail for a missing binary")
+	}
+
+	before := openFDs(t)
+	for i := 0; i < 1000; i++ {
+		proxy, err := NewMCPProxy(cfg)
+		var backendErr *BackendError
+		if proxy != nil || !errors.As(err, &backendErr) {
+			t.Fatalf("Expected a BackendError, got %v", err)
+		}
+	}
+	if after := openFDs(t); after > before {
+		t.Errorf("Expected no file descriptors to leak, had %d, now %d", before, after)
+	}
+}
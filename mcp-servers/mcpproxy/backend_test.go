@@ -0,0 +1,97 @@
+package mcpproxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func postJSON(proxy *MCPProxy, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	proxy.Handle(w, req)
+	return w
+}
+
+func TestMaxResponseBytes(t *testing.T) {
+	proxy := newFakeProxy(t, "big", Config{MaxResponseBytes: 64 << 10})
+	pid := proxy.currentBackend().cmd.Process.Pid
+
+	w := postJSON(proxy, `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"size":1048576}}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 with a JSON-RPC error, got %d", w.Code)
+	}
+	var resp struct {
+		ID    int `json:"id"`
+		Error struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Invalid response %q: %v", w.Body.String(), err)
+	}
+	if resp.ID != 1 || resp.Error.Code != -32603 || !strings.Contains(resp.Error.Message, "65536 byte limit") {
+		t.Errorf("Expected -32603 size limit error for id 1, got %+v", resp)
+	}
+
+	// The stream stays in sync without restarting the MCP server
+	w = postJSON(proxy, `{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"size":10}}`)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"id":2`) {
+		t.Errorf("Expected follow-up request to succeed, got %d %q", w.Code, w.Body.String())
+	}
+	if proxy.currentBackend().cmd.Process.Pid != pid {
+		t.Error("Expected MCP server not to be restarted")
+	}
+}
+
+func TestMaxResponseBytesDropsNotification(t *testing.T) {
+	proxy := newFakeProxy(t, "big", Config{MaxResponseBytes: 64 << 10})
+
+	w := postJSON(proxy, `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"size":10,"notifySize":1048576}}`)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"result"`) {
+		t.Errorf("Expected the response after an oversized notification, got %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestDuplicateResponsesDiscarded(t *testing.T) {
+	for _, skip := range []bool{false, true} {
+		proxy := newFakeProxy(t, "dup", Config{SkipNotifications: skip})
+
+		for id := 1; id <= 3; id++ {
+			w := postJSON(proxy, fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":"ping"}`, id))
+			var resp struct {
+				ID     int `json:"id"`
+				Result struct {
+					Echo int `json:"echo"`
+				} `json:"result"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("Failed to parse response %q: %v", w.Body.String(), err)
+			}
+			if resp.ID != id || resp.Result.Echo != id {
+				t.Errorf("SkipNotifications=%v: request %d got response for %d", skip, id, resp.ID)
+			}
+		}
+	}
+}
+
+func TestCompletedIDs(t *testing.T) {
+	var c completedIDs
+	for i := 0; i < completedIDsSize+1; i++ {
+		c.add(fmt.Sprint(i))
+	}
+	if c.contains("0") {
+		t.Error("Expected the oldest id to be forgotten")
+	}
+	if !c.contains("1") || !c.contains(fmt.Sprint(completedIDsSize)) {
+		t.Error("Expected recent ids to be remembered")
+	}
+	if c.contains("") {
+		t.Error("Empty id must never match")
+	}
+}
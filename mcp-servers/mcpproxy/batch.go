@@ -0,0 +1,111 @@
+package mcpproxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// errBatchAbortedCode is the JSON-RPC error code of the requests of a batch
+// that were not sent because an earlier one failed (see
+// Config.BatchFailFast).
+const errBatchAbortedCode = -32006
+
+// isBatch reports whether msg is a JSON-RPC batch rather than a single
+// message.
+func isBatch(msg json.RawMessage) bool {
+	trimmed := bytes.TrimLeft(msg, " \t\r\n")
+	return len(trimmed) > 0 && trimmed[0] == '['
+}
+
+// handleBatch answers a JSON-RPC batch. Its messages are handled one after
+// the other as if they had been sent alone, and the responses to its
+// requests are returned in the order of the requests, failures included as
+// JSON-RPC errors. A batch of notifications only is answered with 202.
+func (p *MCPProxy) handleBatch(w http.ResponseWriter, r *http.Request, dc *dynamicConfig, msg json.RawMessage) {
+	var batch []json.RawMessage
+	if err := json.Unmarshal(msg, &batch); err != nil {
+		p.rejectBody(w, err)
+		return
+	}
+	if len(batch) == 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(jsonRPCError(nil, -32600, "Invalid Request: the batch is empty"))
+		return
+	}
+
+	// The responses are returned together, so none can be raw content
+	r = withoutRawContent(r)
+
+	responses := make([][]byte, 0, len(batch))
+	failed := false
+	for _, elem := range batch {
+		var mcpMsg MCPMessage
+		json.Unmarshal(elem, &mcpMsg)
+		if failed && p.config.BatchFailFast {
+			if mcpMsg.HasID {
+				responses = append(responses, jsonRPCError(mcpMsg.ID, errBatchAbortedCode,
+					"Request not sent: an earlier request in the batch failed"))
+			}
+			continue
+		}
+
+		rec := newResponseBuffer()
+		p.handleMessage(rec, r, dc, elem)
+		response, ok := batchResponse(rec, mcpMsg)
+		if !ok {
+			failed = true
+		}
+		if response != nil {
+			responses = append(responses, response)
+		}
+	}
+
+	if len(responses) == 0 {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(append(append([]byte{'['}, bytes.Join(responses, []byte{','})...), ']'))
+}
+
+// batchResponse returns the response in rec to the message msg of a batch,
+// or nil for a notification, and whether the message succeeded. Failures
+// answered with plain text are turned into JSON-RPC errors.
+func batchResponse(rec *responseBuffer, msg MCPMessage) (json.RawMessage, bool) {
+	body := bytes.TrimSpace(rec.body.Bytes())
+	var resp struct {
+		Error json.RawMessage `json:"error"`
+	}
+	isJSON := json.Unmarshal(body, &resp) == nil
+	ok := rec.status < 300 && resp.Error == nil
+	switch {
+	case !msg.HasID:
+		return nil, ok
+	case isJSON:
+		return json.RawMessage(body), ok
+	case ok:
+		return nil, true
+	}
+	message := strings.TrimSpace(string(body))
+	if message == "" {
+		message = http.StatusText(rec.status)
+	}
+	return jsonRPCError(msg.ID, -32603, message), false
+}
+
+// withoutRawContent returns r without the ways of asking for raw content
+// (see Config.UnwrapSingleContent).
+func withoutRawContent(r *http.Request) *http.Request {
+	if !wantsRawContent(r) {
+		return r
+	}
+	r = r.Clone(r.Context())
+	r.Header.Del("X-MCP-Raw")
+	query := r.URL.Query()
+	query.Del("raw")
+	r.URL.RawQuery = query.Encode()
+	return r
+}
@@ -0,0 +1,87 @@
+package mcpproxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// batchResult is the outcome of one request of a batch.
+type batchResult struct {
+	ID     int `json:"id"`
+	Result *struct {
+		Calls int `json:"calls"`
+	} `json:"result"`
+	Error *RPCError `json:"error"`
+}
+
+func postBatch(t *testing.T, proxy *MCPProxy, body string) []batchResult {
+	t.Helper()
+	w := postJSON(proxy, body)
+	var results []batchResult
+	if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &results) != nil {
+		t.Fatalf("Expected a batch response, got %d %s", w.Code, w.Body.String())
+	}
+	return results
+}
+
+// mixedBatch succeeds, fails in the MCP server, succeeds, sends a
+// notification, and times out.
+const mixedBatch = `[
+	{"jsonrpc":"2.0","id":1,"method":"x"},
+	{"jsonrpc":"2.0","id":2,"method":"x","params":{"fail":true}},
+	{"jsonrpc":"2.0","id":3,"method":"x"},
+	{"jsonrpc":"2.0","method":"notifications/x"},
+	{"jsonrpc":"2.0","id":4,"method":"tools/call","params":{"name":"t","delayMs":500}}
+]`
+
+func TestBatchPartialFailure(t *testing.T) {
+	proxy := newFakeProxy(t, "slow", Config{SkipNotifications: true, ToolCallTimeout: 100 * time.Millisecond})
+	results := postBatch(t, proxy, mixedBatch)
+	if len(results) != 4 {
+		t.Fatalf("Expected 4 responses, got %+v", results)
+	}
+	for i, want := range []struct{ calls, code int }{{1, 0}, {0, -32000}, {3, 0}, {0, errToolCallTimeoutCode}} {
+		got := results[i]
+		if got.ID != i+1 {
+			t.Errorf("Expected response %d to have id %d, got %d", i, i+1, got.ID)
+		}
+		switch {
+		case want.code != 0 && (got.Error == nil || got.Error.Code != want.code):
+			t.Errorf("Expected response %d to be error %d, got %+v", i, want.code, got)
+		case want.code == 0 && (got.Result == nil || got.Result.Calls != want.calls):
+			t.Errorf("Expected response %d to be call %d, got %+v", i, want.calls, got)
+		}
+	}
+
+	// Batches of notifications only have no response
+	if w := postJSON(proxy, `[{"jsonrpc":"2.0","method":"notifications/x"}]`); w.Code != http.StatusAccepted || w.Body.Len() != 0 {
+		t.Errorf("Expected 202 without a body, got %d %s", w.Code, w.Body.String())
+	}
+	if w := postJSON(proxy, `[]`); w.Code != http.StatusBadRequest || rpcErrorOf(t, w) != -32600 {
+		t.Errorf("Expected an empty batch to be invalid, got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestBatchFailFast(t *testing.T) {
+	proxy := newFakeProxy(t, "slow", Config{SkipNotifications: true, BatchFailFast: true})
+	results := postBatch(t, proxy, mixedBatch)
+	if len(results) != 4 {
+		t.Fatalf("Expected 4 responses, got %+v", results)
+	}
+	if results[0].Result == nil || results[1].Error == nil || results[1].Error.Code != -32000 {
+		t.Errorf("Expected a result then the failure, got %+v %+v", results[0], results[1])
+	}
+	for _, got := range results[2:] {
+		if got.Error == nil || got.Error.Code != errBatchAbortedCode {
+			t.Errorf("Expected request %d to be aborted, got %+v", got.ID, got)
+		}
+	}
+
+	// The aborted requests were not sent
+	results = postBatch(t, proxy, `[{"jsonrpc":"2.0","id":5,"method":"x"}]`)
+	if results[0].Result == nil || results[0].Result.Calls != 3 {
+		t.Errorf("Expected the MCP server to have received 3 requests, got %+v", results[0])
+	}
+}
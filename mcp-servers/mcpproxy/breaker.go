@@ -0,0 +1,154 @@
+package mcpproxy
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Circuit breaker states reported in BackendStatus.CircuitBreaker.
+const (
+	BreakerClosed   = "closed"    // requests are sent to the MCP server
+	BreakerOpen     = "open"      // requests are failed without being sent
+	BreakerHalfOpen = "half_open" // a single probe request is let through
+)
+
+// breakerStates lists the states for mcp_proxy_circuit_breaker_state.
+var breakerStates = []string{BreakerClosed, BreakerOpen, BreakerHalfOpen}
+
+// defaultBreakerCooldown is the default Config.CircuitBreakerCooldown.
+const defaultBreakerCooldown = 30 * time.Second
+
+// breaker is the circuit breaker in front of the MCP server, see
+// Config.CircuitBreakerFailures. Requests are admitted before they are
+// queued, and their outcomes recorded once processRequests is done with
+// them.
+type breaker struct {
+	threshold int
+	cooldown  time.Duration
+	log       Logger
+
+	mu       sync.Mutex
+	state    string
+	failures int       // consecutive failures while closed
+	openedAt time.Time // when the breaker last opened
+	probeAt  time.Time // when the probe was admitted, zero if none is out
+}
+
+// newBreaker returns the circuit breaker for cfg, or nil if there is none.
+func newBreaker(cfg Config, log Logger) *breaker {
+	if cfg.CircuitBreakerFailures <= 0 {
+		return nil
+	}
+	return &breaker{
+		threshold: cfg.CircuitBreakerFailures,
+		cooldown:  cfg.CircuitBreakerCooldown,
+		log:       log,
+		state:     BreakerClosed,
+	}
+}
+
+// admit reports whether a request may be sent to the MCP server, returning
+// a *CircuitOpenError if not. Once the breaker has been open for its
+// cooldown, it turns half-open and admits one request, the probe; all
+// others are rejected until the probe's outcome is recorded. A probe that
+// is not resolved within the cooldown, e.g. because it was never sent, is
+// given up on and the next request probes instead.
+func (b *breaker) admit() error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	b.halfOpen(now)
+	switch {
+	case b.state == BreakerClosed:
+		return nil
+	case b.state == BreakerHalfOpen && (b.probeAt.IsZero() || now.Sub(b.probeAt) >= b.cooldown):
+		b.probeAt = now
+		b.log.Info("Circuit breaker is half-open, sending a probe request")
+		return nil
+	}
+	return &CircuitOpenError{State: b.state}
+}
+
+// halfOpen turns an open breaker half-open once its cooldown has passed.
+// b.mu must be held.
+func (b *breaker) halfOpen(now time.Time) {
+	if b.state == BreakerOpen && now.Sub(b.openedAt) >= b.cooldown {
+		b.state = BreakerHalfOpen
+		b.probeAt = time.Time{}
+	}
+}
+
+// record records the outcome of a request sent to the MCP server. A
+// failure while half-open reopens the breaker, a success closes it.
+// Outcomes recorded while the breaker is open are of requests queued
+// before it opened, and are ignored.
+func (b *breaker) record(failed bool) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch {
+	case b.state == BreakerOpen:
+	case !failed:
+		if b.state == BreakerHalfOpen {
+			b.log.Info("Circuit breaker closed, the probe request succeeded")
+		}
+		b.state = BreakerClosed
+		b.failures = 0
+	case b.state == BreakerHalfOpen:
+		b.open("the probe request failed")
+	default:
+		b.failures++
+		if b.failures >= b.threshold {
+			b.open("too many requests failed in a row")
+		}
+	}
+}
+
+// open opens the breaker for its cooldown. b.mu must be held.
+func (b *breaker) open(why string) {
+	b.log.Warn("Circuit breaker opened, "+why, "failures", b.failures, "cooldown", b.cooldown)
+	b.state = BreakerOpen
+	b.openedAt = time.Now()
+	b.probeAt = time.Time{}
+	b.failures = 0
+}
+
+// State returns the state of the breaker, or "" if there is none.
+func (b *breaker) State() string {
+	if b == nil {
+		return ""
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.halfOpen(time.Now())
+	return b.state
+}
+
+// breakerFailure reports whether a request that was answered with
+// response, nil if there was none, and failed with err counts as a failure
+// of the MCP server for the circuit breaker: it was not running or exited,
+// or the request ran over its tool call timeout.
+func breakerFailure(response json.RawMessage, err error) bool {
+	if err != nil {
+		return errors.Is(err, ErrBackendUnavailable)
+	}
+	code, ok := rpcErrorCode(response)
+	return ok && code == errToolCallTimeoutCode
+}
+
+// admitRequest admits a request with method past the circuit breaker,
+// counting it as rejected if it is not.
+func (p *MCPProxy) admitRequest(method string) error {
+	err := p.breaker.admit()
+	if err != nil {
+		p.metrics.breakerRejected.Inc(method, err.(*CircuitOpenError).State)
+	}
+	return err
+}
@@ -0,0 +1,106 @@
+package mcpproxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerHalfOpen(t *testing.T) {
+	proxy := newFakeProxy(t, "slow", Config{
+		SkipNotifications:      true,
+		ToolCallTimeout:        50 * time.Millisecond,
+		CircuitBreakerFailures: 2,
+		CircuitBreakerCooldown: 200 * time.Millisecond,
+	})
+	if state := proxy.Status().CircuitBreaker; state != BreakerClosed {
+		t.Fatalf("Expected the breaker to start closed, got %q", state)
+	}
+
+	// Tool calls that time out open the breaker
+	for i := 0; i < 2; i++ {
+		w := postJSON(proxy, `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"t","delayMs":100}}`)
+		if code := rpcErrorOf(t, w); code != errToolCallTimeoutCode {
+			t.Fatalf("Expected call %d to time out, got %d %s", i, w.Code, w.Body.String())
+		}
+	}
+	if state := proxy.Status().CircuitBreaker; state != BreakerOpen {
+		t.Fatalf("Expected the breaker to be open, got %q", state)
+	}
+	w := postJSON(proxy, `{"jsonrpc":"2.0","id":1,"method":"x"}`)
+	if w.Code != http.StatusServiceUnavailable || rpcErrorOf(t, w) != -32007 {
+		t.Errorf("Expected the open breaker to reject the request, got %d %s", w.Code, w.Body.String())
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for proxy.Status().CircuitBreaker != BreakerHalfOpen {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the breaker to turn half-open, got %+v", proxy.Status())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Of a flood of requests, only the probe reaches the MCP server
+	var wg sync.WaitGroup
+	results := make(chan *httptest.ResponseRecorder, 20)
+	for i := 0; i < cap(results); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results <- postJSON(proxy, `{"jsonrpc":"2.0","id":1,"method":"x","params":{"delayMs":50}}`)
+		}()
+	}
+	wg.Wait()
+	close(results)
+	probeCalls, rejected := 0, 0
+	for w := range results {
+		var resp struct {
+			Result *struct {
+				Calls int `json:"calls"`
+			} `json:"result"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		switch {
+		case resp.Result != nil && probeCalls == 0:
+			probeCalls = resp.Result.Calls
+		case w.Code == http.StatusServiceUnavailable && rpcErrorOf(t, w) == -32007:
+			rejected++
+		default:
+			t.Errorf("Expected a single probe and rejections, got %d %s", w.Code, w.Body.String())
+		}
+	}
+	if probeCalls == 0 || rejected != cap(results)-1 {
+		t.Fatalf("Expected 1 probe and %d rejections, got %d rejections", cap(results)-1, rejected)
+	}
+
+	// The probe succeeded and closed the breaker
+	if state := proxy.Status().CircuitBreaker; state != BreakerClosed {
+		t.Errorf("Expected the breaker to close after the probe, got %q", state)
+	}
+	w = postJSON(proxy, `{"jsonrpc":"2.0","id":1,"method":"x"}`)
+	var resp struct {
+		Result struct {
+			Calls int `json:"calls"`
+		} `json:"result"`
+	}
+	if json.Unmarshal(w.Body.Bytes(), &resp); resp.Result.Calls != probeCalls+1 {
+		t.Errorf("Expected the MCP server to have received only the probe, got call %d after %d", resp.Result.Calls, probeCalls)
+	}
+
+	w = httptest.NewRecorder()
+	proxy.metrics.handle(w, httptest.NewRequest("GET", "/metrics", nil))
+	for _, want := range []string{
+		`mcp_proxy_circuit_breaker_state{server="test",state="closed"} 1`,
+		`mcp_proxy_circuit_breaker_state{server="test",state="half_open"} 0`,
+		`mcp_proxy_circuit_breaker_rejections_total{server="test",method="x",state="open"} 1`,
+		`mcp_proxy_circuit_breaker_rejections_total{server="test",method="x",state="half_open"} 19`,
+	} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("Expected %s, got:\n%s", want, w.Body.String())
+		}
+	}
+}
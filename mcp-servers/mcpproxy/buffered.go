@@ -0,0 +1,63 @@
+package mcpproxy
+
+import "sync"
+
+// bufferedResponses accounts for responses read from the MCP server that
+// have not been written to their client yet. With a limit set, the
+// dispatcher waits in acquire until enough bytes are released, so clients
+// that are slow to read their responses hold back further reads from the MCP
+// server instead of growing the proxy's memory.
+type bufferedResponses struct {
+	limit int64
+	gauge *metricFamily
+
+	mu      sync.Mutex
+	used    int64
+	changed chan struct{} // closed and replaced whenever bytes are released
+}
+
+func newBufferedResponses(limit int64, gauge *metricFamily) *bufferedResponses {
+	gauge.Set(0)
+	return &bufferedResponses{limit: limit, gauge: gauge, changed: make(chan struct{})}
+}
+
+// acquire accounts for a response of n bytes, first waiting until it fits
+// within the limit. A response larger than the limit is let through once
+// nothing else is buffered. Once stop is closed it no longer waits.
+func (b *bufferedResponses) acquire(n int, stop <-chan struct{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for waiting := true; waiting && b.limit > 0 && b.used > 0 && b.used+int64(n) > b.limit; {
+		changed := b.changed
+		b.mu.Unlock()
+		select {
+		case <-changed:
+		case <-stop:
+			waiting = false
+		}
+		b.mu.Lock()
+	}
+	b.used += int64(n)
+	b.gauge.Set(float64(b.used))
+}
+
+// release accounts for a response of n bytes that was written or dropped.
+func (b *bufferedResponses) release(n int) {
+	if n == 0 {
+		return
+	}
+	b.mu.Lock()
+	b.used -= int64(n)
+	b.gauge.Set(float64(b.used))
+	close(b.changed)
+	b.changed = make(chan struct{})
+	b.mu.Unlock()
+}
+
+// discardResponse waits for the response to req, whose client went away,
+// and releases it.
+func (p *MCPProxy) discardResponse(req *request) {
+	if response, ok := <-req.response; ok {
+		p.buffered.release(len(response))
+	}
+}
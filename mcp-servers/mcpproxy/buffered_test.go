@@ -0,0 +1,84 @@
+package mcpproxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// enqueueBig queues a request for a "big" backend response of about size
+// bytes without waiting for it.
+func enqueueBig(t *testing.T, proxy *MCPProxy, id, size int) *request {
+	t.Helper()
+	req := &request{
+		msg:       json.RawMessage(fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":"big","params":{"size":%d}}`, id, size)),
+		method:    "big",
+		isRequest: true,
+		response:  make(chan json.RawMessage, 1),
+	}
+	if proxy.enqueue(req) != nil {
+		t.Fatal("enqueue failed")
+	}
+	return req
+}
+
+func receive(t *testing.T, req *request) json.RawMessage {
+	t.Helper()
+	select {
+	case response := <-req.response:
+		return response
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the response")
+		return nil
+	}
+}
+
+func TestMaxBufferedBytes(t *testing.T) {
+	proxy := newFakeProxy(t, "big", Config{MaxBufferedBytes: 1500})
+	gauge := func() float64 { return proxy.metrics.buffered.Value() }
+
+	first := receive(t, enqueueBig(t, proxy, 1, 1000))
+	if gauge() != float64(len(first)) {
+		t.Fatalf("buffered = %v, want %d", gauge(), len(first))
+	}
+
+	// The second response does not fit until the first is released.
+	second := enqueueBig(t, proxy, 2, 1000)
+	select {
+	case <-second.response:
+		t.Fatal("second response delivered past the limit")
+	case <-time.After(200 * time.Millisecond):
+	}
+	if gauge() != float64(len(first)) {
+		t.Errorf("buffered while waiting = %v, want %d", gauge(), len(first))
+	}
+
+	proxy.buffered.release(len(first))
+	response := receive(t, second)
+	if gauge() != float64(len(response)) {
+		t.Errorf("buffered = %v, want %d", gauge(), len(response))
+	}
+	proxy.buffered.release(len(response))
+
+	// A response larger than the limit is let through on its own.
+	response = receive(t, enqueueBig(t, proxy, 3, 5000))
+	proxy.buffered.release(len(response))
+	if gauge() != 0 {
+		t.Errorf("buffered after release = %v, want 0", gauge())
+	}
+}
+
+func TestBufferedReleasedAfterWrite(t *testing.T) {
+	proxy := newFakeProxy(t, "big", Config{MaxBufferedBytes: 1500})
+
+	for i := 0; i < 5; i++ {
+		w := postJSON(proxy, fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":"big","params":{"size":1000}}`, i))
+		if w.Code != 200 {
+			t.Fatalf("request %d: status %d", i, w.Code)
+		}
+	}
+	if v := proxy.metrics.buffered.Value(); v != 0 {
+		t.Errorf("buffered = %v, want 0", v)
+	}
+}
@@ -0,0 +1,60 @@
+package mcpproxy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// setCacheHeaders adds the Cache-Control header configured for method in
+// Config.ResponseCacheHeaders to a successful response, along with a weak
+// ETag. It reports whether the client's If-None-Match already matches, in
+// which case it has answered 304 Not Modified and nothing more must be
+// written.
+func (p *MCPProxy) setCacheHeaders(w http.ResponseWriter, r *http.Request, method string, response json.RawMessage) bool {
+	cacheControl, ok := p.config.ResponseCacheHeaders[method]
+	if !ok {
+		return false
+	}
+	etag, ok := responseETag(response)
+	if !ok {
+		return false
+	}
+
+	w.Header().Set("Cache-Control", cacheControl)
+	w.Header().Set("ETag", etag)
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		p.log.Debug("Response not modified", "method", method, "etag", etag)
+		w.WriteHeader(http.StatusNotModified)
+		return true
+	}
+	return false
+}
+
+// responseETag returns a weak ETag for the result of response. The id is
+// left out so that the tag does not change from one request to the next.
+// Error responses have no ETag.
+func responseETag(response json.RawMessage) (string, bool) {
+	var msg struct {
+		Result json.RawMessage `json:"result"`
+	}
+	if json.Unmarshal(response, &msg) != nil || msg.Result == nil {
+		return "", false
+	}
+	sum := sha256.Sum256(msg.Result)
+	return `W/"` + hex.EncodeToString(sum[:16]) + `"`, true
+}
+
+// etagMatches reports whether an If-None-Match header value matches etag,
+// using the weak comparison.
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,67 @@
+package mcpproxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestResponseCacheHeaders(t *testing.T) {
+	proxy := newFakeProxy(t, "mcp", Config{
+		ResponseCacheHeaders: map[string]string{"tools/list": "max-age=60"},
+	})
+
+	w := postJSON(proxy, `{"jsonrpc":"2.0","id":1,"method":"tools/list"}`)
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || w.Header().Get("Cache-Control") != "max-age=60" || !strings.HasPrefix(etag, `W/"`) {
+		t.Fatalf("Expected cache headers, got %d %v", w.Code, w.Header())
+	}
+
+	// The ETag does not depend on the request id
+	req := httptest.NewRequest("POST", "/", strings.NewReader(`{"jsonrpc":"2.0","id":2,"method":"tools/list"}`))
+	req.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	proxy.Handle(w, req)
+	if w.Code != http.StatusNotModified || w.Body.Len() != 0 || w.Header().Get("ETag") != etag {
+		t.Errorf("Expected 304 with the same ETag, got %d %v %q", w.Code, w.Header(), w.Body.String())
+	}
+
+	req = httptest.NewRequest("POST", "/", strings.NewReader(`{"jsonrpc":"2.0","id":3,"method":"tools/list"}`))
+	req.Header.Set("If-None-Match", `W/"stale"`)
+	w = httptest.NewRecorder()
+	proxy.Handle(w, req)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"id":3`) {
+		t.Errorf("Expected the full response for a stale ETag, got %d %q", w.Code, w.Body.String())
+	}
+
+	// Other methods and errors are not cacheable
+	w = postJSON(proxy, `{"jsonrpc":"2.0","id":4,"method":"tools/call","params":{"name":"echo"}}`)
+	if w.Header().Get("Cache-Control") != "" || w.Header().Get("ETag") != "" {
+		t.Errorf("Expected no cache headers for tools/call, got %v", w.Header())
+	}
+	proxy = newFakeProxy(t, "mcp", Config{ResponseCacheHeaders: map[string]string{"unknown": "max-age=60"}})
+	w = postJSON(proxy, `{"jsonrpc":"2.0","id":5,"method":"unknown"}`)
+	if w.Header().Get("ETag") != "" {
+		t.Errorf("Expected no ETag on an error response, got %v", w.Header())
+	}
+}
+
+func TestETagMatches(t *testing.T) {
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{`W/"abc"`, true},
+		{`"abc"`, true},
+		{`W/"x", W/"abc"`, true},
+		{`*`, true},
+		{`W/"x"`, false},
+		{``, false},
+	}
+	for _, tt := range tests {
+		if got := etagMatches(tt.header, `W/"abc"`); got != tt.want {
+			t.Errorf("etagMatches(%q) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package mcpproxy
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// Commands replaces what Main runs, for binaries that serve more than a
+// single proxy from cfg, such as several behind one router. Nil members
+// keep the default.
+type Commands struct {
+	// Run serves cfg instead of Run.
+	Run func(cfg Config) error
+	// SelfTest runs -selftest instead of SelfTest.
+	SelfTest func(cfg Config, opts SelfTestOptions, w io.Writer) error
+}
+
+// Main is a ready-made main function for proxy binaries. It parses the
+// command line flags shared by all proxies and then serves cfg with Run,
+// or prints the version (-version), runs SelfTest (-selftest) or checks a
+// running proxy (-healthcheck, also accepted as a "healthcheck" subcommand)
+// and exits with a matching status.
+func Main(cfg Config) {
+	MainWith(cfg, Commands{})
+}
+
+// MainWith is Main running cmds in place of the defaults.
+func MainWith(cfg Config, cmds Commands) {
+	if cmds.Run == nil {
+		cmds.Run = Run
+	}
+	if cmds.SelfTest == nil {
+		cmds.SelfTest = SelfTest
+	}
+
+	args := os.Args[1:]
+	if len(args) > 0 && args[0] == "healthcheck" {
+		args[0] = "-healthcheck"
+	}
+
+	fs := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	showVersion := fs.Bool("version", false, "Print version information and exit")
+	selfTest := fs.Bool("selftest", false, "Check that the MCP server answers initialize and tools/list, then exit; does not listen on any port")
+	selfTestTool := fs.String("selftest-tool", "", "Harmless tool to call during -selftest (optional)")
+	selfTestArgs := fs.String("selftest-args", "{}", "JSON arguments for -selftest-tool")
+	selfTestTimeout := fs.Duration("selftest-timeout", 60*time.Second, "Time limit for -selftest")
+	healthCheck := fs.Bool("healthcheck", false, "Check the health of the proxy running on this host and exit")
+	ready := fs.Bool("ready", false, "With -healthcheck, check readiness (/readyz) instead of liveness (/healthz)")
+	fs.Parse(args)
+
+	switch {
+	case *showVersion:
+		PrintVersion(os.Stdout, cfg)
+
+	case *healthCheck:
+		path := "/healthz"
+		if *ready {
+			path = "/readyz"
+		}
+		if err := HealthCheck(cfg, path); err != nil {
+			fmt.Fprintf(os.Stderr, "unhealthy: %v\n", err)
+			os.Exit(1)
+		}
+
+	case *selfTest:
+		if !json.Valid([]byte(*selfTestArgs)) {
+			fmt.Fprintf(os.Stderr, "Invalid -selftest-args: %s\n", *selfTestArgs)
+			os.Exit(2)
+		}
+		err := cmds.SelfTest(cfg, SelfTestOptions{
+			Timeout:   *selfTestTimeout,
+			Tool:      *selfTestTool,
+			Arguments: json.RawMessage(*selfTestArgs),
+		}, os.Stdout)
+		if err != nil {
+			os.Exit(1)
+		}
+
+	default:
+		if err := cmds.Run(cfg); err != nil {
+			newLogger(cfg).Error("Failed to run proxy", "error", err)
+			os.Exit(1)
+		}
+	}
+}
@@ -0,0 +1,281 @@
+// Package client talks to MCP servers exposed over HTTP by mcpproxy.
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rh-ai-kickstart/ai-architecture-charts/mcp-servers/mcpproxy"
+)
+
+// SessionHeader carries the MCP session id. A Client remembers the last
+// session id a server sent and returns it on every following request.
+const SessionHeader = "Mcp-Session-Id"
+
+// defaultReconnectDelay is the wait before reopening the notification
+// stream when the server did not send a retry interval.
+const defaultReconnectDelay = time.Second
+
+// Client sends JSON-RPC messages to an mcpproxy server. It is safe for
+// concurrent use.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	authToken  string
+	nextID     atomic.Int64
+
+	mu        sync.Mutex
+	sessionID string
+
+	reconnectDelay time.Duration
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithAuthToken sends token as a bearer token on every request.
+func WithAuthToken(token string) Option {
+	return func(c *Client) { c.authToken = token }
+}
+
+// WithTLSConfig sets the TLS configuration used for https URLs.
+func WithTLSConfig(cfg *tls.Config) Option {
+	return func(c *Client) {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = cfg
+		c.httpClient.Transport = transport
+	}
+}
+
+// WithTimeout limits how long Call and Notify wait for the server. It does
+// not apply to the notification stream, which stays open until its context
+// is done.
+func WithTimeout(d time.Duration) Option {
+	return func(c *Client) { c.httpClient.Timeout = d }
+}
+
+// WithHTTPClient sends requests with hc instead of a client of its own.
+// WithTLSConfig and WithTimeout modify hc if given after it.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) { c.httpClient = hc }
+}
+
+// WithReconnectDelay sets the wait before reopening a dropped notification
+// stream, unless the server asks for a different one.
+func WithReconnectDelay(d time.Duration) Option {
+	return func(c *Client) { c.reconnectDelay = d }
+}
+
+// New returns a Client for the proxy at baseURL, such as
+// "http://localhost:8080".
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:        strings.TrimSuffix(baseURL, "/") + "/",
+		httpClient:     &http.Client{},
+		reconnectDelay: defaultReconnectDelay,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// SessionID returns the session id last sent by the server, if any.
+func (c *Client) SessionID() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.sessionID
+}
+
+// HTTPError is returned when the proxy answers with an unexpected HTTP
+// status, for instance 401 for a missing token or 503 while the MCP server
+// is not running.
+type HTTPError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("HTTP %d: %s", e.StatusCode, e.Body)
+}
+
+// rpcRequest is an outgoing JSON-RPC request or notification.
+type rpcRequest struct {
+	JSONRPC string      `json:"jsonrpc"`
+	ID      *int64      `json:"id,omitempty"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params,omitempty"`
+}
+
+// rpcResponse is an incoming JSON-RPC message. Method is set for
+// notifications and server requests.
+type rpcResponse struct {
+	ID     json.RawMessage    `json:"id"`
+	Method string             `json:"method"`
+	Params json.RawMessage    `json:"params"`
+	Result json.RawMessage    `json:"result"`
+	Error  *mcpproxy.RPCError `json:"error"`
+}
+
+// Call sends a request and returns its result. A JSON-RPC error from the
+// MCP server is returned as a *mcpproxy.RPCError.
+func (c *Client) Call(ctx context.Context, method string, params interface{}) (json.RawMessage, error) {
+	id := c.nextID.Add(1)
+	resp, err := c.post(ctx, rpcRequest{JSONRPC: "2.0", ID: &id, Method: method, Params: params})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		// The proxy may send JSON-RPC errors with a non-200 status; see
+		// mcpproxy.Config.ErrorCodeToStatus.
+		return nil, readError(resp)
+	}
+
+	want := fmt.Sprint(id)
+	var msg rpcResponse
+	if isEventStream(resp.Header) {
+		// The server may send notifications before the response.
+		events := newEventReader(resp.Body)
+		for string(msg.ID) != want || msg.Method != "" {
+			msg = rpcResponse{}
+			ev, err := events.next()
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			if err != nil {
+				return nil, fmt.Errorf("reading response to %s: %w", method, err)
+			}
+			json.Unmarshal(ev.data, &msg)
+		}
+	} else if err := json.NewDecoder(resp.Body).Decode(&msg); err != nil {
+		return nil, fmt.Errorf("decoding response to %s: %w", method, err)
+	}
+
+	if string(msg.ID) != want {
+		return nil, fmt.Errorf("response to %s has id %s, want %s", method, msg.ID, want)
+	}
+	if msg.Error != nil {
+		return nil, msg.Error
+	}
+	return msg.Result, nil
+}
+
+// Notify sends a notification, which has no response.
+func (c *Client) Notify(ctx context.Context, method string, params interface{}) error {
+	resp, err := c.post(ctx, rpcRequest{JSONRPC: "2.0", Method: method, Params: params})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted && resp.StatusCode != http.StatusOK {
+		return readHTTPError(resp)
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+// Content is an item of a tool result.
+type Content struct {
+	Type     string `json:"type"`
+	Text     string `json:"text,omitempty"`
+	Data     string `json:"data,omitempty"`
+	MimeType string `json:"mimeType,omitempty"`
+}
+
+// ToolResult is the result of a tools/call request.
+type ToolResult struct {
+	Content           []Content       `json:"content"`
+	StructuredContent json.RawMessage `json:"structuredContent,omitempty"`
+	IsError           bool            `json:"isError,omitempty"`
+}
+
+// CallTool calls the named tool. A tool that fails reports it through
+// ToolResult.IsError rather than an error.
+func (c *Client) CallTool(ctx context.Context, name string, args interface{}) (*ToolResult, error) {
+	params := map[string]interface{}{"name": name}
+	if args != nil {
+		params["arguments"] = args
+	}
+	raw, err := c.Call(ctx, "tools/call", params)
+	if err != nil {
+		return nil, err
+	}
+	var result ToolResult
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return nil, fmt.Errorf("decoding result of tool %s: %w", name, err)
+	}
+	return &result, nil
+}
+
+// post sends msg and records the session id of the response.
+func (c *Client) post(ctx context.Context, msg rpcRequest) (*http.Response, error) {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return nil, fmt.Errorf("encoding %s: %w", msg.Method, err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	return c.do(c.httpClient, req)
+}
+
+// do adds the token and session headers to req and sends it with hc.
+func (c *Client) do(hc *http.Client, req *http.Request) (*http.Response, error) {
+	if c.authToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.authToken)
+	}
+	if id := c.SessionID(); id != "" {
+		req.Header.Set(SessionHeader, id)
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if id := resp.Header.Get(SessionHeader); id != "" {
+		c.mu.Lock()
+		c.sessionID = id
+		c.mu.Unlock()
+	}
+	return resp, nil
+}
+
+// readError returns the JSON-RPC error in resp, or an HTTPError if there is
+// none.
+func readError(resp *http.Response) error {
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "application/json" {
+		return readHTTPError(resp)
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	var msg rpcResponse
+	if json.Unmarshal(body, &msg) == nil && msg.Error != nil {
+		return msg.Error
+	}
+	return &HTTPError{StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(body))}
+}
+
+// readHTTPError returns an HTTPError for resp, with its body truncated.
+func readHTTPError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	return &HTTPError{StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(body))}
+}
+
+func isEventStream(h http.Header) bool {
+	mediaType, _, _ := mime.ParseMediaType(h.Get("Content-Type"))
+	return mediaType == "text/event-stream"
+}
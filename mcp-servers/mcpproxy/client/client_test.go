@@ -0,0 +1,232 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rh-ai-kickstart/ai-architecture-charts/mcp-servers/mcpproxy"
+	"github.com/rh-ai-kickstart/ai-architecture-charts/mcp-servers/mcpproxy/internal/fakebackend"
+)
+
+func TestMain(m *testing.M) {
+	fakebackend.RunIfRequested()
+	os.Exit(m.Run())
+}
+
+// newProxyServer serves a proxy backed by the named fake backend over HTTP
+// and shuts both down when the test ends.
+func newProxyServer(t *testing.T, mode string, cfg mcpproxy.Config) *httptest.Server {
+	t.Helper()
+	cfg.ServerName = "test"
+	cfg.CommandPath, cfg.CommandArgs = fakebackend.Command(mode)
+	proxy, err := mcpproxy.NewMCPProxy(cfg)
+	if err != nil {
+		t.Fatalf("NewMCPProxy failed: %v", err)
+	}
+	srv := httptest.NewServer(proxy.Handler())
+	t.Cleanup(func() {
+		srv.Close()
+		proxy.Close()
+	})
+	return srv
+}
+
+func TestCall(t *testing.T) {
+	srv := newProxyServer(t, "mcp", mcpproxy.Config{})
+	c := New(srv.URL, WithTimeout(5*time.Second))
+
+	result, err := c.Call(context.Background(), "initialize", map[string]interface{}{"protocolVersion": "2025-03-26"})
+	if err != nil {
+		t.Fatalf("Call failed: %v", err)
+	}
+	var init struct {
+		ServerInfo struct {
+			Name string `json:"name"`
+		} `json:"serverInfo"`
+	}
+	if err := json.Unmarshal(result, &init); err != nil || init.ServerInfo.Name != "fake" {
+		t.Errorf("result = %s, want serverInfo.name fake", result)
+	}
+
+	_, err = c.Call(context.Background(), "no/such/method", nil)
+	var rpcErr *mcpproxy.RPCError
+	if !errors.As(err, &rpcErr) || rpcErr.Code != -32601 {
+		t.Errorf("err = %v, want RPCError -32601", err)
+	}
+}
+
+func TestCallErrorStatus(t *testing.T) {
+	srv := newProxyServer(t, "mcp", mcpproxy.Config{ErrorCodeToStatus: mcpproxy.DefaultErrorCodeToStatus})
+
+	_, err := New(srv.URL).Call(context.Background(), "no/such/method", nil)
+	var rpcErr *mcpproxy.RPCError
+	if !errors.As(err, &rpcErr) || rpcErr.Code != -32601 {
+		t.Errorf("err = %v, want RPCError -32601", err)
+	}
+}
+
+func TestCallTool(t *testing.T) {
+	srv := newProxyServer(t, "mcp", mcpproxy.Config{})
+	c := New(srv.URL)
+
+	result, err := c.CallTool(context.Background(), "echo", map[string]string{"msg": "hi"})
+	if err != nil {
+		t.Fatalf("CallTool failed: %v", err)
+	}
+	if result.IsError || len(result.Content) != 1 || result.Content[0].Text != `{"msg":"hi"}` {
+		t.Errorf("echo result = %+v", result)
+	}
+
+	result, err = c.CallTool(context.Background(), "fail", nil)
+	if err != nil {
+		t.Fatalf("CallTool failed: %v", err)
+	}
+	if !result.IsError {
+		t.Errorf("fail result = %+v, want IsError", result)
+	}
+}
+
+func TestNotify(t *testing.T) {
+	srv := newProxyServer(t, "mcp", mcpproxy.Config{})
+	c := New(srv.URL)
+
+	if err := c.Notify(context.Background(), "notifications/initialized", nil); err != nil {
+		t.Errorf("Notify failed: %v", err)
+	}
+}
+
+func TestAuthToken(t *testing.T) {
+	srv := newProxyServer(t, "mcp", mcpproxy.Config{AuthToken: "secret"})
+
+	_, err := New(srv.URL).Call(context.Background(), "tools/list", nil)
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusUnauthorized {
+		t.Errorf("without token: err = %v, want HTTP 401", err)
+	}
+
+	if _, err := New(srv.URL, WithAuthToken("secret")).Call(context.Background(), "tools/list", nil); err != nil {
+		t.Errorf("with token: %v", err)
+	}
+}
+
+func TestSessionHeader(t *testing.T) {
+	var got []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = append(got, r.Header.Get(SessionHeader))
+		w.Header().Set(SessionHeader, "s1")
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL)
+	for i := 0; i < 2; i++ {
+		if err := c.Notify(context.Background(), "notifications/initialized", nil); err != nil {
+			t.Fatalf("Notify failed: %v", err)
+		}
+	}
+	if got[0] != "" || got[1] != "s1" || c.SessionID() != "s1" {
+		t.Errorf("sent session ids %q, SessionID() = %q", got, c.SessionID())
+	}
+}
+
+func TestCallEventStreamResponse(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ID int `json:"id"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, ": comment\n\n")
+		fmt.Fprint(w, "data: {\"jsonrpc\":\"2.0\",\"method\":\"notifications/progress\"}\n\n")
+		fmt.Fprintf(w, "id: 7\ndata: {\"jsonrpc\":\"2.0\",\ndata: \"id\":%d,\"result\":{\"ok\":true}}\n\n", req.ID)
+	}))
+	defer srv.Close()
+
+	result, err := New(srv.URL).Call(context.Background(), "ping", nil)
+	if err != nil {
+		t.Fatalf("Call failed: %v", err)
+	}
+	if string(result) != `{"ok":true}` {
+		t.Errorf("result = %s", result)
+	}
+}
+
+func TestNotificationsReconnect(t *testing.T) {
+	lastIDs := make(chan string, 2)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lastIDs <- r.Header.Get("Last-Event-ID")
+		w.Header().Set("Content-Type", "text/event-stream")
+		if r.Header.Get("Last-Event-ID") == "" {
+			// The first stream drops after one event.
+			fmt.Fprint(w, "retry: 10\nid: 1\ndata: {\"jsonrpc\":\"2.0\",\"method\":\"first\"}\n\n")
+			return
+		}
+		fmt.Fprint(w, "data: {\"jsonrpc\":\"2.0\",\"method\":\"second\"}\n\n")
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := New(srv.URL, WithReconnectDelay(time.Hour)).Notifications(ctx)
+
+	var methods []string
+	for len(methods) < 2 {
+		select {
+		case n := <-ch:
+			methods = append(methods, n.Method)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out after %v", methods)
+		}
+	}
+	if strings.Join(methods, ",") != "first,second" {
+		t.Errorf("notifications = %v", methods)
+	}
+	if first, second := <-lastIDs, <-lastIDs; first != "" || second != "1" {
+		t.Errorf("Last-Event-ID = %q then %q, want none then 1", first, second)
+	}
+
+	cancel()
+	for range ch {
+	}
+}
+
+func TestNotificationsNotOffered(t *testing.T) {
+	srv := newProxyServer(t, "mcp", mcpproxy.Config{})
+
+	select {
+	case _, ok := <-New(srv.URL).Notifications(context.Background()):
+		if ok {
+			t.Error("got a notification, want the channel closed")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("channel not closed")
+	}
+}
+
+func TestEventReader(t *testing.T) {
+	events := newEventReader(strings.NewReader("retry: 250\r\n:ping\r\n\r\nid: a\r\ndata:x\r\ndata: y\r\n\r\nid\r\ndata: z\r\n\r\ndata: partial"))
+
+	ev, err := events.next()
+	if err != nil || ev.id != "a" || string(ev.data) != "x\ny" {
+		t.Errorf("first event = %+v, %v", ev, err)
+	}
+	ev, err = events.next()
+	if err != nil || ev.id != "" || string(ev.data) != "z" {
+		t.Errorf("second event = %+v, %v", ev, err)
+	}
+	if events.retry != 250*time.Millisecond {
+		t.Errorf("retry = %v", events.retry)
+	}
+	if _, err := events.next(); err == nil {
+		t.Error("unterminated event was returned")
+	}
+}
@@ -0,0 +1,73 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// event is a server-sent event.
+type event struct {
+	id   string
+	data []byte
+}
+
+// eventReader decodes a text/event-stream body. It keeps the last event id
+// and retry interval the server sent, which outlive the events they came
+// with.
+type eventReader struct {
+	r      *bufio.Reader
+	lastID string
+	retry  time.Duration
+}
+
+func newEventReader(r io.Reader) *eventReader {
+	return &eventReader{r: bufio.NewReader(r)}
+}
+
+// next returns the next event with data, skipping comments and events that
+// only set the id or retry interval.
+func (er *eventReader) next() (event, error) {
+	var data bytes.Buffer
+	hasData := false
+	for {
+		line, err := er.r.ReadString('\n')
+		if err != nil {
+			// An event not terminated by a blank line is discarded.
+			return event{}, err
+		}
+		line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+
+		if line == "" {
+			if hasData {
+				return event{id: er.lastID, data: data.Bytes()}, nil
+			}
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "data":
+			if hasData {
+				data.WriteByte('\n')
+			}
+			data.WriteString(value)
+			hasData = true
+		case "id":
+			if !strings.ContainsRune(value, 0) {
+				er.lastID = value
+			}
+		case "retry":
+			if ms, err := strconv.Atoi(value); err == nil && ms >= 0 {
+				er.retry = time.Duration(ms) * time.Millisecond
+			}
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package client_test
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/rh-ai-kickstart/ai-architecture-charts/mcp-servers/mcpproxy/client"
+)
+
+func Example() {
+	c := client.New("http://localhost:8080",
+		client.WithAuthToken("my-token"),
+		client.WithTimeout(30*time.Second),
+	)
+	ctx := context.Background()
+
+	if _, err := c.Call(ctx, "initialize", map[string]interface{}{
+		"protocolVersion": "2025-03-26",
+		"capabilities":    map[string]interface{}{},
+		"clientInfo":      map[string]string{"name": "example", "version": "1.0"},
+	}); err != nil {
+		log.Fatal(err)
+	}
+	if err := c.Notify(ctx, "notifications/initialized", nil); err != nil {
+		log.Fatal(err)
+	}
+
+	tools, err := c.Call(ctx, "tools/list", nil)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(string(tools))
+}
+
+func ExampleClient_CallTool() {
+	c := client.New("http://localhost:8080")
+
+	result, err := c.CallTool(context.Background(), "get_forecast", map[string]interface{}{
+		"latitude":  40.7,
+		"longitude": -74.0,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, content := range result.Content {
+		fmt.Println(content.Text)
+	}
+}
+
+func ExampleClient_Notifications() {
+	c := client.New("http://localhost:8080")
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	for n := range c.Notifications(ctx) {
+		fmt.Println(n.Method, string(n.Params))
+	}
+}
@@ -0,0 +1,96 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// Notification is a JSON-RPC notification sent by the MCP server.
+type Notification struct {
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params,omitempty"`
+}
+
+// Notifications opens the server's event stream and returns a channel of
+// the notifications it carries. When the stream drops, it is reopened after
+// the reconnect delay with the Last-Event-ID of the last event received, so
+// a server that keeps history can replay what was missed.
+//
+// The channel is closed when ctx is done, or when the server answers with a
+// client error such as 401 or 405, which reconnecting would not fix.
+func (c *Client) Notifications(ctx context.Context) <-chan Notification {
+	ch := make(chan Notification)
+	go func() {
+		defer close(ch)
+		// The stream is long-lived, so the request timeout does not apply.
+		hc := *c.httpClient
+		hc.Timeout = 0
+
+		var lastID string
+		delay := c.reconnectDelay
+		for {
+			resp, retry := c.openStream(ctx, &hc, lastID)
+			if resp != nil {
+				events := newEventReader(resp.Body)
+				events.lastID = lastID
+				for {
+					ev, err := events.next()
+					if err != nil {
+						break
+					}
+					lastID = events.lastID
+					var n Notification
+					if json.Unmarshal(ev.data, &n) != nil || n.Method == "" {
+						continue
+					}
+					select {
+					case ch <- n:
+					case <-ctx.Done():
+						resp.Body.Close()
+						return
+					}
+				}
+				resp.Body.Close()
+				if events.retry > 0 {
+					delay = events.retry
+				}
+			} else if !retry {
+				return
+			}
+
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch
+}
+
+// openStream starts a GET request for the event stream, resuming after
+// lastID if set. If the stream could not be opened, it returns nil and
+// whether to try again. Reading the stream fails once ctx is done.
+func (c *Client) openStream(ctx context.Context, hc *http.Client, lastID string) (*http.Response, bool) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL, nil)
+	if err != nil {
+		return nil, false
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	if lastID != "" {
+		req.Header.Set("Last-Event-ID", lastID)
+	}
+
+	resp, err := c.do(hc, req)
+	if err != nil {
+		return nil, ctx.Err() == nil
+	}
+	if resp.StatusCode != http.StatusOK || !isEventStream(resp.Header) {
+		resp.Body.Close()
+		retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode == http.StatusTooManyRequests
+		return nil, retry
+	}
+	return resp, true
+}
@@ -0,0 +1,223 @@
+package mcpproxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// flight is a call to the MCP server shared by identical requests.
+type flight struct {
+	req  *request      // the call, sent with the settings of the first request
+	done chan struct{} // closed once response or err is set
+
+	response json.RawMessage
+	seq      uint64 // see Config.EnableNotificationStream
+	err      error
+}
+
+// coalesces reports whether msg is a request eligible for coalescing.
+func (d *dynamicConfig) coalesces(id interface{}, msg json.RawMessage) bool {
+	if id == nil || (len(d.CoalesceMethods) == 0 && len(d.CoalesceTools) == 0) {
+		return false
+	}
+	_, ok := d.coalesceKey(msg)
+	return ok
+}
+
+// coalesceKey returns the key identifying requests equivalent to msg, or
+// ok=false if msg's method or tool is not configured for coalescing.
+func (d *dynamicConfig) coalesceKey(msg json.RawMessage) (key string, ok bool) {
+	var req struct {
+		Method string          `json:"method"`
+		Params json.RawMessage `json:"params"`
+	}
+	if json.Unmarshal(msg, &req) != nil {
+		return "", false
+	}
+
+	if req.Method == "tools/call" {
+		var call struct {
+			Name string `json:"name"`
+		}
+		json.Unmarshal(req.Params, &call)
+		if !contains(d.CoalesceTools, call.Name) {
+			return "", false
+		}
+	} else if !contains(d.CoalesceMethods, req.Method) {
+		return "", false
+	}
+
+	params, err := canonicalJSON(req.Params)
+	if err != nil {
+		return "", false
+	}
+	return req.Method + "\x00" + string(params), true
+}
+
+// canonicalJSON re-encodes data with object keys sorted and insignificant
+// whitespace removed. Numbers are kept verbatim.
+func canonicalJSON(data json.RawMessage) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// forwardCoalesced joins the in-flight call identical to msg, or starts one,
+// and writes its response to w with id substituted. Only requests from the
+// same client identity and session share a call, since the MCP server may
+// answer them differently. The call is sent with the settings of the
+// request that started it, but is not tied to that client, so it completes
+// for the remaining waiters even if the client goes away.
+func (p *MCPProxy) forwardCoalesced(w http.ResponseWriter, r *http.Request, dc *dynamicConfig, msg json.RawMessage, id interface{}) {
+	key, _ := dc.coalesceKey(msg)
+	key = identity(r) + "\x00" + r.Header.Get(sessionHeader) + "\x00" + key
+	var mcpMsg MCPMessage
+	json.Unmarshal(msg, &mcpMsg)
+
+	p.flightsMu.Lock()
+	f, joined := p.flights[key]
+	if !joined {
+		f = &flight{
+			done: make(chan struct{}),
+			req: &request{
+				msg:       msg,
+				method:    mcpMsg.Method,
+				isRequest: true,
+				response:  make(chan json.RawMessage, 1),
+			},
+		}
+		p.flights[key] = f
+		go p.runFlight(key, f, p.prepare(r, f.req))
+	}
+	p.flightsMu.Unlock()
+
+	if joined {
+		p.logFor(r).Debug("Coalescing request with an identical in-flight call", "id", id, "method", mcpMsg.Method)
+		p.metrics.coalesced.Inc(mcpMsg.Method)
+	}
+
+	select {
+	case <-f.done:
+	case <-r.Context().Done():
+		p.logFor(r).Info("Client went away before the response", "error", r.Context().Err())
+		return
+	}
+
+	p.recordQueueWait(r, f.req)
+	w.Header().Set("Server-Timing", serverTiming(f.req, time.Now()))
+	if f.response == nil {
+		p.failRequest(w, r, id, f.err)
+		return
+	}
+	if p.config.EnableNotificationStream {
+		setSequenceHeader(w, f.seq)
+	}
+	p.writeResponse(w, r, mcpMsg.Method, withID(f.response, id), wantsRawContent(r) && dc.UnwrapSingleContent)
+}
+
+// runFlight performs the shared call, set up by prepare, and publishes its
+// outcome; done is what prepare returned. The flight is removed before
+// waiters are released, so requests arriving afterwards, including after
+// an error, start a new call.
+func (p *MCPProxy) runFlight(key string, f *flight, done func()) {
+	req := f.req
+	if f.err = p.admitRequest(req.method); f.err == nil {
+		if f.err = p.enqueue(req); errors.Is(f.err, ErrQueueFull) {
+			p.expireInQueue(req)
+		}
+	}
+	var response json.RawMessage
+	if f.err == nil {
+		response, f.err = p.awaitFlight(req)
+	}
+	if f.err == nil {
+		ctx, cancel := flightContext(req)
+		f.response = p.summarizeResult(ctx, req, response)
+		cancel()
+		f.seq = req.seq
+	}
+	done()
+
+	p.flightsMu.Lock()
+	delete(p.flights, key)
+	p.flightsMu.Unlock()
+	close(f.done)
+
+	// The waiters share f.response; it stops counting as buffered once they
+	// have been released.
+	p.buffered.release(len(response))
+}
+
+// awaitFlight waits for the response to req, the queued request of a
+// flight, or for it to expire in the queue.
+func (p *MCPProxy) awaitFlight(req *request) (json.RawMessage, error) {
+	queueExpired := req.queueExpired
+	for {
+		select {
+		case response, ok := <-req.response:
+			if !ok && req.err == nil {
+				// The waiters must not be failed with a nil error
+				if p.isClosed() {
+					return nil, ErrProxyClosed
+				}
+				return nil, &BackendError{State: p.Status().State}
+			}
+			return response, req.err
+		case <-queueExpired:
+			if p.expireInQueue(req) {
+				return nil, &TimeoutError{Stage: "queue", Timeout: req.queueTimeout}
+			}
+			// It was sent to the MCP server just in time
+			queueExpired = nil
+		}
+	}
+}
+
+// flightContext returns the context to finish a flight's response in. The
+// flight outlives the request that started it, so it is bounded by that
+// request's deadline rather than ended with it.
+func flightContext(req *request) (context.Context, context.CancelFunc) {
+	if req.deadline.IsZero() {
+		return context.WithCancel(context.Background())
+	}
+	return context.WithDeadline(context.Background(), req.deadline)
+}
+
+// withID returns response with its id member replaced by id. The response is
+// returned unchanged if it already carries that id or cannot be parsed.
+func withID(response json.RawMessage, id interface{}) json.RawMessage {
+	var msg map[string]json.RawMessage
+	if json.Unmarshal(response, &msg) != nil {
+		return response
+	}
+	newID, err := json.Marshal(id)
+	if err != nil || bytes.Equal(msg["id"], newID) {
+		return response
+	}
+	msg["id"] = newID
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return response
+	}
+	return data
+}
@@ -0,0 +1,312 @@
+package mcpproxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCanonicalJSON(t *testing.T) {
+	a, _ := canonicalJSON(json.RawMessage(`{"b": 1, "a": {"y": [1, 2], "x": 12345678901234567890}}`))
+	b, _ := canonicalJSON(json.RawMessage(`{"a":{"x":12345678901234567890,"y":[1,2]},"b":1}`))
+	if string(a) != string(b) {
+		t.Errorf("Expected equal canonical forms, got %s and %s", a, b)
+	}
+	if !strings.Contains(string(a), "12345678901234567890") {
+		t.Errorf("Expected large numbers to be kept verbatim, got %s", a)
+	}
+}
+
+func TestWithID(t *testing.T) {
+	response := json.RawMessage(`{"jsonrpc":"2.0","id":1,"result":{"ok":true}}`)
+
+	if got := withID(response, float64(1)); string(got) != string(response) {
+		t.Errorf("Expected response unchanged for the same id, got %s", got)
+	}
+
+	var msg map[string]interface{}
+	json.Unmarshal(withID(response, "abc"), &msg)
+	if msg["id"] != "abc" || msg["result"].(map[string]interface{})["ok"] != true {
+		t.Errorf("Expected id substituted and result kept, got %v", msg)
+	}
+}
+
+func TestCoalesceKey(t *testing.T) {
+	dc := newDynamicConfig(Config{
+		CoalesceMethods: []string{"tools/list"},
+		CoalesceTools:   []string{"get_file"},
+	})
+
+	tests := []struct {
+		msg string
+		ok  bool
+	}{
+		{`{"id":1,"method":"tools/list"}`, true},
+		{`{"id":1,"method":"tools/call","params":{"name":"get_file","arguments":{"path":"a"}}}`, true},
+		{`{"id":1,"method":"tools/call","params":{"name":"delete_file","arguments":{"path":"a"}}}`, false},
+		{`{"id":1,"method":"prompts/list"}`, false},
+	}
+	for _, tt := range tests {
+		if _, ok := dc.coalesceKey(json.RawMessage(tt.msg)); ok != tt.ok {
+			t.Errorf("coalesceKey(%s) ok = %v, want %v", tt.msg, ok, tt.ok)
+		}
+	}
+
+	k1, _ := dc.coalesceKey(json.RawMessage(`{"id":1,"method":"tools/call","params":{"name":"get_file","arguments":{"path":"a","ref":"x"}}}`))
+	k2, _ := dc.coalesceKey(json.RawMessage(`{"method":"tools/call","id":2,"params":{"arguments":{"ref":"x","path":"a"},"name":"get_file"}}`))
+	if k1 != k2 {
+		t.Errorf("Expected equivalent calls to share a key, got %q and %q", k1, k2)
+	}
+}
+
+type coalesceResult struct {
+	ID     interface{} `json:"id"`
+	Result struct {
+		Calls int `json:"calls"`
+	} `json:"result"`
+	Error *struct {
+		Code int `json:"code"`
+	} `json:"error"`
+}
+
+// postCoalesced sends a request with the given id and params and decodes the
+// response. An empty body yields a zero result.
+func postCoalesced(ctx context.Context, proxy *MCPProxy, id int, params string) coalesceResult {
+	return postCoalescedAs(ctx, proxy, id, params, "", "")
+}
+
+// postCoalescedAs is postCoalesced from the client at remoteAddr, if set,
+// in the given session, if any.
+func postCoalescedAs(ctx context.Context, proxy *MCPProxy, id int, params, remoteAddr, session string) coalesceResult {
+	body := fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":"tools/list","params":%s}`, id, params)
+	req := httptest.NewRequest("POST", "/", strings.NewReader(body)).WithContext(ctx)
+	if remoteAddr != "" {
+		req.RemoteAddr = remoteAddr
+	}
+	if session != "" {
+		req.Header.Set(sessionHeader, session)
+	}
+	w := httptest.NewRecorder()
+	proxy.Handle(w, req)
+
+	var result coalesceResult
+	json.Unmarshal(w.Body.Bytes(), &result)
+	return result
+}
+
+// waitForFlight blocks until a coalesced call is in flight.
+func waitForFlight(t *testing.T, proxy *MCPProxy) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		proxy.flightsMu.Lock()
+		n := len(proxy.flights)
+		proxy.flightsMu.Unlock()
+		if n > 0 {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("Timed out waiting for an in-flight call")
+}
+
+func TestCoalesceSharesCall(t *testing.T) {
+	proxy := newFakeProxy(t, "slow", Config{CoalesceMethods: []string{"tools/list"}})
+
+	results := make([]coalesceResult, 5)
+	var wg sync.WaitGroup
+	for i := range results {
+		if i == 1 {
+			waitForFlight(t, proxy)
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// Same params, differently ordered
+			params := `{"delayMs":300,"cursor":"a"}`
+			if i%2 == 1 {
+				params = `{"cursor":"a","delayMs":300}`
+			}
+			results[i] = postCoalesced(context.Background(), proxy, 100+i, params)
+		}(i)
+	}
+	wg.Wait()
+
+	for i, result := range results {
+		if result.ID != float64(100+i) {
+			t.Errorf("Caller %d got id %v, want its own id %d", i, result.ID, 100+i)
+		}
+		if result.Result.Calls != 1 {
+			t.Errorf("Caller %d got calls=%d, expected the shared first call", i, result.Result.Calls)
+		}
+	}
+	if n := proxy.metrics.coalesced.Value("tools/list"); n != 4 {
+		t.Errorf("Expected 4 coalesced requests in metrics, got %v", n)
+	}
+
+	// Once the call completes, nothing is cached
+	if result := postCoalesced(context.Background(), proxy, 200, `{"delayMs":0,"cursor":"a"}`); result.Result.Calls != 2 {
+		t.Errorf("Expected a new call after completion, got calls=%d", result.Result.Calls)
+	}
+}
+
+func TestCoalesceSeparatesClients(t *testing.T) {
+	proxy := newFakeProxy(t, "slow", Config{CoalesceMethods: []string{"tools/list"}, EnableMetrics: true})
+	const params = `{"delayMs":300}`
+
+	var same, otherSession, otherClient coalesceResult
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		postCoalescedAs(context.Background(), proxy, 1, params, "192.0.2.1:1000", "a")
+	}()
+	waitForFlight(t, proxy)
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		same = postCoalescedAs(context.Background(), proxy, 2, params, "192.0.2.1:2000", "a")
+	}()
+	go func() {
+		defer wg.Done()
+		otherSession = postCoalescedAs(context.Background(), proxy, 3, params, "192.0.2.1:3000", "b")
+	}()
+	go func() {
+		defer wg.Done()
+		otherClient = postCoalescedAs(context.Background(), proxy, 4, params, "192.0.2.2:1000", "a")
+	}()
+	wg.Wait()
+
+	if same.Result.Calls != 1 {
+		t.Errorf("Expected the same client and session to share the call, got %+v", same)
+	}
+	if otherSession.Result.Calls < 2 || otherClient.Result.Calls < 2 {
+		t.Errorf("Expected other sessions and clients to make calls of their own, got %+v and %+v", otherSession, otherClient)
+	}
+}
+
+func TestCoalescedCallSettings(t *testing.T) {
+	proxy := newFakeProxy(t, "hang", Config{CoalesceMethods: []string{"tools/list"}, QueueTimeout: 100 * time.Millisecond})
+
+	// The first request stalls the MCP server, so that the shared call
+	// waits in the queue until its QueueTimeout
+	go postJSON(proxy, `{"jsonrpc":"2.0","id":0,"method":"x"}`)
+	time.Sleep(50 * time.Millisecond)
+
+	var wg sync.WaitGroup
+	results := make([]coalesceResult, 2)
+	wg.Add(1)
+	go func() { defer wg.Done(); results[0] = postCoalesced(context.Background(), proxy, 1, `{}`) }()
+	waitForFlight(t, proxy)
+	if queued, sent := proxy.inflight.snapshot(); len(queued) != 1 || len(sent) != 1 {
+		t.Errorf("Expected the shared call queued at /debug/inflight, got %+v and %+v", queued, sent)
+	}
+	wg.Add(1)
+	go func() { defer wg.Done(); results[1] = postCoalesced(context.Background(), proxy, 2, `{}`) }()
+	wg.Wait()
+
+	for i, result := range results {
+		if result.ID != float64(i+1) || result.Error == nil || result.Error.Code != -32001 {
+			t.Errorf("Expected caller %d to get the queue timeout, got %+v", i+1, result)
+		}
+	}
+}
+
+func TestCoalesceWaitersTimeOut(t *testing.T) {
+	proxy := newFakeProxy(t, "slow", Config{CoalesceMethods: []string{"tools/list"}})
+	params := `{"delayMs":400}`
+
+	leaderCtx, cancelLeader := context.WithCancel(context.Background())
+	earlyCtx, cancelEarly := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancelEarly()
+	lateCtx, cancelLate := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancelLate()
+
+	var leader, early, late, patient coalesceResult
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() { defer wg.Done(); leader = postCoalesced(leaderCtx, proxy, 1, params) }()
+	waitForFlight(t, proxy)
+
+	wg.Add(3)
+	go func() { defer wg.Done(); early = postCoalesced(earlyCtx, proxy, 2, params) }()
+	go func() { defer wg.Done(); late = postCoalesced(lateCtx, proxy, 3, params) }()
+	go func() { defer wg.Done(); patient = postCoalesced(context.Background(), proxy, 4, params) }()
+
+	// The client that started the call goes away first
+	time.Sleep(50 * time.Millisecond)
+	cancelLeader()
+	wg.Wait()
+
+	if leader.ID != nil || early.ID != nil || late.ID != nil {
+		t.Errorf("Expected cancelled and timed out waiters to get no response, got %v %v %v", leader.ID, early.ID, late.ID)
+	}
+	if patient.ID != float64(4) || patient.Result.Calls != 1 {
+		t.Errorf("Expected remaining waiter to get the shared response, got %+v", patient)
+	}
+}
+
+func TestCoalesceErrorsNotShared(t *testing.T) {
+	proxy := newFakeProxy(t, "slow", Config{CoalesceMethods: []string{"tools/list"}})
+	params := `{"delayMs":200,"fail":true}`
+
+	var first, second coalesceResult
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() { defer wg.Done(); first = postCoalesced(context.Background(), proxy, 1, params) }()
+	waitForFlight(t, proxy)
+	wg.Add(1)
+	go func() { defer wg.Done(); second = postCoalesced(context.Background(), proxy, 2, params) }()
+	wg.Wait()
+
+	if first.Error == nil || second.Error == nil || second.ID != float64(2) {
+		t.Fatalf("Expected both waiting callers to get the error with their own id, got %+v %+v", first, second)
+	}
+
+	// A caller arriving after the error starts a fresh call
+	third := postCoalesced(context.Background(), proxy, 3, `{"delayMs":0}`)
+	if third.Error != nil || third.Result.Calls != 2 {
+		t.Errorf("Expected a fresh call after the error, got %+v", third)
+	}
+}
+
+func TestAwaitFlightWithoutResponse(t *testing.T) {
+	proxy := newFakeProxy(t, "reflect", Config{})
+
+	// A response channel closed without an error still fails the waiters
+	req := &request{response: make(chan json.RawMessage)}
+	close(req.response)
+	if _, err := proxy.awaitFlight(req); !errors.Is(err, ErrBackendUnavailable) {
+		t.Errorf("Expected the MCP server to be reported unavailable, got %v", err)
+	}
+	proxy.Close()
+	if _, err := proxy.awaitFlight(req); !errors.Is(err, ErrProxyClosed) {
+		t.Errorf("Expected ErrProxyClosed once closed, got %v", err)
+	}
+}
+
+func TestCoalesceOnlyConfiguredMethods(t *testing.T) {
+	proxy := newFakeProxy(t, "slow", Config{CoalesceMethods: []string{"resources/list"}})
+	params := `{"delayMs":100}`
+
+	results := make([]coalesceResult, 2)
+	var wg sync.WaitGroup
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = postCoalesced(context.Background(), proxy, i, params)
+		}(i)
+	}
+	wg.Wait()
+
+	if results[0].Result.Calls+results[1].Result.Calls != 3 {
+		t.Errorf("Expected two separate calls, got %+v", results)
+	}
+}
@@ -0,0 +1,702 @@
+package mcpproxy
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// dynamicConfig is the part of Config that can be changed at runtime by
+// Reload. It is swapped as a whole, so a request that loads it once sees
+// either the old or the new settings, never a mix.
+type dynamicConfig struct {
+	EnableCORS          bool
+	SkipNotifications   bool
+	MaxRequestBytes     int64
+	StreamThreshold     int64
+	UnwrapSingleContent bool
+	CoalesceMethods     []string
+	CoalesceTools       []string
+	QueueTimeout        time.Duration
+	ToolCallTimeout     time.Duration
+	ToolTimeouts        map[string]time.Duration
+	MethodLogLevels     map[string]LogLevel
+	RedactPatterns      []string
+	RedactValues        []string
+}
+
+func newDynamicConfig(cfg Config) *dynamicConfig {
+	return &dynamicConfig{
+		EnableCORS:          cfg.EnableCORS,
+		SkipNotifications:   cfg.SkipNotifications,
+		MaxRequestBytes:     cfg.MaxRequestBytes,
+		StreamThreshold:     cfg.StreamThreshold,
+		UnwrapSingleContent: cfg.UnwrapSingleContent,
+		CoalesceMethods:     cfg.CoalesceMethods,
+		CoalesceTools:       cfg.CoalesceTools,
+		QueueTimeout:        cfg.QueueTimeout,
+		ToolCallTimeout:     cfg.ToolCallTimeout,
+		ToolTimeouts:        cfg.ToolTimeouts,
+		MethodLogLevels:     cfg.MethodLogLevels,
+		RedactPatterns:      cfg.RedactPatterns,
+		RedactValues:        cfg.RedactValues,
+	}
+}
+
+func (d *dynamicConfig) applyTo(cfg *Config) {
+	cfg.EnableCORS = d.EnableCORS
+	cfg.SkipNotifications = d.SkipNotifications
+	cfg.MaxRequestBytes = d.MaxRequestBytes
+	cfg.StreamThreshold = d.StreamThreshold
+	cfg.UnwrapSingleContent = d.UnwrapSingleContent
+	cfg.CoalesceMethods = d.CoalesceMethods
+	cfg.CoalesceTools = d.CoalesceTools
+	cfg.QueueTimeout = d.QueueTimeout
+	cfg.ToolCallTimeout = d.ToolCallTimeout
+	cfg.ToolTimeouts = d.ToolTimeouts
+	cfg.MethodLogLevels = d.MethodLogLevels
+	cfg.RedactPatterns = d.RedactPatterns
+	cfg.RedactValues = d.RedactValues
+}
+
+// isReloadable reports whether the Config field name can be changed by
+// Reload.
+func isReloadable(name string) bool {
+	_, ok := reflect.TypeOf(dynamicConfig{}).FieldByName(name)
+	return ok
+}
+
+// configFileFields maps the config file names of the fields of Config,
+// given by their json tags, to their indexes. Fields tagged "-", and hooks,
+// which have no tag, can only be set in code.
+var configFileFields = func() map[string]int {
+	fields := make(map[string]int)
+	t := reflect.TypeOf(Config{})
+	for i := 0; i < t.NumField(); i++ {
+		if name := t.Field(i).Tag.Get("json"); name != "" && name != "-" {
+			fields[name] = i
+		}
+	}
+	return fields
+}()
+
+// loadConfigFile returns base with the settings from its ConfigFile applied.
+// Fields left out of the file keep the value given in base.
+func loadConfigFile(base Config) (Config, error) {
+	path, err := ExpandPath(base.ConfigFile)
+	if err != nil {
+		return base, fmt.Errorf("invalid config file: %w", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return base, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return base, fmt.Errorf("failed to parse config file %s: %w", base.ConfigFile, err)
+	}
+	cfg := base
+	v := reflect.ValueOf(&cfg).Elem()
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		i, ok := configFileFields[name]
+		if !ok {
+			return base, fmt.Errorf("failed to parse config file %s: unknown field %q", base.ConfigFile, name)
+		}
+		if err := decodeConfigField(fields[name], v.Field(i).Addr().Interface()); err != nil {
+			return base, fmt.Errorf("failed to parse config file %s: %s: %w", base.ConfigFile, name, err)
+		}
+	}
+	return cfg, nil
+}
+
+// decodeConfigField decodes the value of a field of Config from the config
+// file into dst, a pointer to it. Durations are written as strings such as
+// "30s". A null value leaves the field alone.
+func decodeConfigField(data json.RawMessage, dst interface{}) error {
+	if string(data) == "null" {
+		return nil
+	}
+	switch dst := dst.(type) {
+	case *time.Duration:
+		return json.Unmarshal(data, (*duration)(dst))
+	case *map[string]time.Duration:
+		var m map[string]duration
+		if err := json.Unmarshal(data, &m); err != nil {
+			return err
+		}
+		*dst = make(map[string]time.Duration, len(m))
+		for k, d := range m {
+			(*dst)[k] = time.Duration(d)
+		}
+		return nil
+	case **Summarizer:
+		var s summarizerFile
+		if err := decodeStrict(data, &s); err != nil {
+			return err
+		}
+		*dst = &Summarizer{URL: s.URL, Threshold: s.Threshold, Timeout: time.Duration(s.Timeout), Tools: s.Tools}
+		return nil
+	}
+	return decodeStrict(data, dst)
+}
+
+// decodeStrict decodes data into dst, refusing unknown object members.
+func decodeStrict(data []byte, dst interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	return dec.Decode(dst)
+}
+
+// duration is a time.Duration written as a string such as "30s" in the
+// config file.
+type duration time.Duration
+
+func (d *duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"30s\": %w", err)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = duration(v)
+	return nil
+}
+
+// ReloadResult describes the outcome of Reload.
+type ReloadResult struct {
+	// Changed lists the settings that were applied, as "Field: old -> new".
+	Changed []string `json:"changed"`
+
+	// Ignored lists fields that differ from the running configuration but
+	// cannot change without a restart.
+	Ignored []string `json:"ignored"`
+}
+
+// Reload re-reads Config.ConfigFile and applies its reloadable settings
+// (CORS, notification handling, request size and streaming limits, raw
+// content unwrapping, coalescing, queue and tool call timeouts, method log
+// levels and redaction). Changes to any other field, such as the command
+// or port, are reported in the result and otherwise ignored. The level
+// of other messages is up to Config.Logger and does not change. A file that
+// NewMCPProxy would refuse is refused, and nothing is changed. Requests
+// already in progress finish with the settings they started with.
+func (p *MCPProxy) Reload() (*ReloadResult, error) {
+	if p.config.ConfigFile == "" {
+		return nil, fmt.Errorf("no config file configured")
+	}
+
+	p.reloadMu.Lock()
+	defer p.reloadMu.Unlock()
+
+	next, err := loadConfigFile(p.baseConfig)
+	if err != nil {
+		p.log.Error("Config reload failed", "error", err)
+		return nil, err
+	}
+	applyDefaults(&next)
+	if err := validateConfig(next); err != nil {
+		p.log.Error("Config reload failed", "error", err)
+		return nil, err
+	}
+
+	current := p.effectiveConfig()
+
+	result := &ReloadResult{Changed: []string{}, Ignored: []string{}}
+	cur, nxt := reflect.ValueOf(current), reflect.ValueOf(next)
+	for i := 0; i < cur.NumField(); i++ {
+		field := cur.Type().Field(i)
+		// Hooks and routes can only be set in code
+		if codeOnly(field.Type) {
+			continue
+		}
+		a, b := cur.Field(i).Interface(), nxt.Field(i).Interface()
+		if reflect.DeepEqual(a, b) {
+			continue
+		}
+		if isReloadable(field.Name) {
+			result.Changed = append(result.Changed, fmt.Sprintf("%s: %v -> %v", field.Name, a, b))
+		} else {
+			result.Ignored = append(result.Ignored, field.Name)
+		}
+	}
+
+	p.dynamic.Store(newDynamicConfig(next))
+	p.redactor.reconfigure(next)
+
+	if len(result.Changed) > 0 {
+		p.log.Info("Reloaded configuration", "changed", strings.Join(result.Changed, ", "))
+	} else {
+		p.log.Info("Reloaded configuration, no changes")
+	}
+	if len(result.Ignored) > 0 {
+		p.log.Warn("Ignored changes to fields that require a restart", "fields", strings.Join(result.Ignored, ", "))
+	}
+	return result, nil
+}
+
+// codeOnly reports whether values of type t hold functions or interfaces,
+// which cannot come from the config file or be compared.
+func codeOnly(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Func, reflect.Interface:
+		return true
+	case reflect.Map, reflect.Slice:
+		return codeOnly(t.Elem())
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if codeOnly(t.Field(i).Type) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// handleReload serves POST /admin/reload.
+func (p *MCPProxy) handleReload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	result, err := p.Reload()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Reload failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// configViewVersion is bumped whenever configView changes incompatibly.
+const configViewVersion = 1
+
+// configView is the effective configuration served at /config. Fields use
+// the config file names and a fixed order so the output can be diffed
+// across deployments. Secrets are replaced by fingerprints, and hooks by
+// whether they are set.
+type configView struct {
+	Version int `json:"version"`
+
+	ServerName           string         `json:"serverName"`
+	CommandPath          string         `json:"commandPath"`
+	CommandArgs          []string       `json:"commandArgs"`
+	PathEnvVar           string         `json:"pathEnvVar"`
+	AllowUnsetArgVars    bool           `json:"allowUnsetArgVars"`
+	UseShell             bool           `json:"useShell"`
+	ShellCommand         []string       `json:"shellCommand"`
+	WrapperCommand       []string       `json:"wrapperCommand"`
+	BackendVersionArgs   []string       `json:"backendVersionArgs"`
+	Nice                 int            `json:"nice"`
+	ResourceLimits       ResourceLimits `json:"resourceLimits"`
+	CPUAffinity          []int          `json:"cpuAffinity"`
+	ScratchRoot          string         `json:"scratchRoot"`
+	ScratchEnvVar        string         `json:"scratchEnvVar"`
+	ScratchQuotaBytes    int64          `json:"scratchQuotaBytes"`
+	LazyStart            bool           `json:"lazyStart"`
+	MaxRestarts          int            `json:"maxRestarts"`
+	CoalesceRestarts     bool           `json:"coalesceRestarts"`
+	MaxQueueAge          string         `json:"maxQueueAge"`
+	QueueTimeout         string         `json:"queueTimeout"`
+	CleanExitCodes       []int          `json:"cleanExitCodes"`
+	ReplayInitialize     bool           `json:"replayInitialize"`
+	Port                 string         `json:"port"`
+	ConfigFile           string         `json:"configFile"`
+	AuthToken            string         `json:"authToken"`
+	AdminToken           string         `json:"adminToken"`
+	DisableBodyLogging   bool           `json:"disableBodyLogging"`
+	MaxResponseBytes     int            `json:"maxResponseBytes"`
+	Delimiter            string         `json:"delimiter"`
+	Framing              string         `json:"framing,omitempty"`
+	MaxBufferedBytes     int64          `json:"maxBufferedBytes"`
+	EnableMetrics        bool           `json:"enableMetrics"`
+	EnableConfigEndpoint bool           `json:"enableConfigEndpoint"`
+	EnableDebugEndpoints bool           `json:"enableDebugEndpoints"`
+	DebugLogLines        int            `json:"debugLogLines"`
+	DebugLogStdout       bool           `json:"debugLogStdout"`
+	StrictSlash          bool           `json:"strictSlash"`
+	BasePath             string         `json:"basePath,omitempty"`
+	StrictParams         bool           `json:"strictParams"`
+	LegacySSECompat      bool           `json:"legacySSECompat"`
+	DeprecateSSE         bool           `json:"deprecateSSE"`
+	SSEInitialEvent      string         `json:"sseInitialEvent"`
+	ExtraRoutes          []string       `json:"extraRoutes"`
+	Routes               []routeView    `json:"routes"`
+	ErrorCodeToStatus    map[int]int    `json:"errorCodeToStatus"`
+
+	MapJSONRPCErrorsToHTTP bool `json:"mapJSONRPCErrorsToHTTP"`
+
+	ResponseCacheHeaders map[string]string `json:"responseCacheHeaders"`
+	ResourceURIRewrite   map[string]string `json:"resourceURIRewrite"`
+	MetaHeaders          map[string]string `json:"metaHeaders"`
+
+	EnvironmentLabel string `json:"environmentLabel"`
+
+	EnableNotificationStream bool `json:"enableNotificationStream"`
+	ShareSubscriptions       bool `json:"shareSubscriptions"`
+
+	EnableOpenAPI bool `json:"enableOpenAPI"`
+
+	StrictMiddleware bool `json:"strictMiddleware"`
+
+	MethodLogLevels map[string]LogLevel `json:"methodLogLevels"`
+
+	StaticPrompts   string `json:"staticPrompts"`
+	StaticResources string `json:"staticResources"`
+
+	EnableCORS          bool     `json:"enableCORS"`
+	SkipNotifications   bool     `json:"skipNotifications"`
+	MaxRequestBytes     int64    `json:"maxRequestBytes"`
+	StreamThreshold     int64    `json:"streamThreshold"`
+	UnwrapSingleContent bool     `json:"unwrapSingleContent"`
+	BatchFailFast       bool     `json:"batchFailFast"`
+	CoalesceMethods     []string `json:"coalesceMethods"`
+	CoalesceTools       []string `json:"coalesceTools"`
+
+	ResponseCacheSize int `json:"responseCacheSize"`
+
+	DisableUnwrapStringBodies bool `json:"disableUnwrapStringBodies"`
+
+	SizeWarnBytes int64 `json:"sizeWarnBytes"`
+
+	SupportedProtocolVersions []string `json:"supportedProtocolVersions"`
+	NormalizeIDType           string   `json:"normalizeIDType"`
+
+	RedactPatterns []string `json:"redactPatterns"`
+	RedactValues   []string `json:"redactValues"`
+
+	ToolCallTimeout   string            `json:"toolCallTimeout"`
+	ToolTimeouts      map[string]string `json:"toolTimeouts"`
+	CancelGracePeriod string            `json:"cancelGracePeriod"`
+
+	PropagateDeadlines bool `json:"propagateDeadlines"`
+
+	AutoInitializedNotification bool   `json:"autoInitializedNotification"`
+	InitializedGracePeriod      string `json:"initializedGracePeriod"`
+
+	CircuitBreakerFailures int    `json:"circuitBreakerFailures"`
+	CircuitBreakerCooldown string `json:"circuitBreakerCooldown"`
+
+	TokenEnvVar        string `json:"tokenEnvVar"`
+	TokenRefreshMargin string `json:"tokenRefreshMargin"`
+
+	OOMRestartDelay string `json:"oomRestartDelay"`
+	WarmStandby     bool   `json:"warmStandby"`
+
+	MaxSubprocessLifetime string `json:"maxSubprocessLifetime"`
+
+	SSEInactivityTimeout string `json:"sseInactivityTimeout"`
+
+	WaitFor        []string `json:"waitFor"`
+	WaitForTimeout string   `json:"waitForTimeout"`
+
+	ToolResultProcessors      []string `json:"toolResultProcessors"`
+	ToolResultProcessorErrors string   `json:"toolResultProcessorErrors"`
+
+	Summarizer *summarizerView `json:"summarizer"`
+
+	RecordFile     string `json:"recordFile"`
+	RecordMaxSize  int64  `json:"recordMaxSize"`
+	RecordMaxFiles int    `json:"recordMaxFiles"`
+
+	MaxJunkLines       int    `json:"maxJunkLines"`
+	StartupGracePeriod string `json:"startupGracePeriod"`
+	StartupGraceLines  int    `json:"startupGraceLines"`
+
+	MaxDesyncedResponses int `json:"maxDesyncedResponses"`
+
+	PriorityLanes      bool              `json:"priorityLanes"`
+	PriorityByIdentity map[string]string `json:"priorityByIdentity"`
+	PriorityMinShare   float64           `json:"priorityMinShare"`
+
+	RequestMiddleware              bool `json:"requestMiddleware"`
+	RequestMiddlewareStreamingSafe bool `json:"requestMiddlewareStreamingSafe"`
+	ResponseMiddleware             bool `json:"responseMiddleware"`
+	ErrorMiddleware                bool `json:"errorMiddleware"`
+	Authenticator                  bool `json:"authenticator"`
+	Launcher                       bool `json:"launcher"`
+	Logger                         bool `json:"logger"`
+	OnRequest                      bool `json:"onRequest"`
+	OnResponse                     bool `json:"onResponse"`
+	OnBackendStateChange           bool `json:"onBackendStateChange"`
+	ReadinessCheck                 bool `json:"readinessCheck"`
+	RequestFilter                  bool `json:"requestFilter"`
+	Notifier                       bool `json:"notifier"`
+	ResponseCacheKey               bool `json:"responseCacheKey"`
+	TokenRefresher                 bool `json:"tokenRefresher"`
+}
+
+// routeView describes a Route in configView.
+type routeView struct {
+	Pattern string `json:"pattern"`
+	Auth    bool   `json:"auth"`
+	CORS    bool   `json:"cors"`
+}
+
+// effectiveConfig returns the running configuration, including settings
+// changed by Reload.
+func (p *MCPProxy) effectiveConfig() Config {
+	cfg := p.config
+	p.dynamic.Load().applyTo(&cfg)
+	return cfg
+}
+
+func newConfigView(cfg Config) configView {
+	routes := make([]string, 0, len(cfg.ExtraRoutes))
+	for path := range cfg.ExtraRoutes {
+		routes = append(routes, path)
+	}
+	sort.Strings(routes)
+
+	processors := make([]string, 0, len(cfg.ToolResultProcessors))
+	for tool := range cfg.ToolResultProcessors {
+		processors = append(processors, tool)
+	}
+	sort.Strings(processors)
+
+	routeViews := make([]routeView, 0, len(cfg.Routes))
+	for _, route := range cfg.Routes {
+		routeViews = append(routeViews, routeView{Pattern: route.Pattern, Auth: route.Auth, CORS: route.CORS})
+	}
+
+	errorStatuses := make(map[int]int, len(cfg.ErrorCodeToStatus))
+	for code, status := range cfg.ErrorCodeToStatus {
+		errorStatuses[code] = status
+	}
+
+	cacheHeaders := make(map[string]string, len(cfg.ResponseCacheHeaders))
+	for method, value := range cfg.ResponseCacheHeaders {
+		cacheHeaders[method] = value
+	}
+
+	toolTimeouts := make(map[string]string, len(cfg.ToolTimeouts))
+	for tool, timeout := range cfg.ToolTimeouts {
+		toolTimeouts[tool] = timeout.String()
+	}
+
+	redactValues := make([]string, len(cfg.RedactValues))
+	for i, value := range cfg.RedactValues {
+		redactValues[i] = fingerprint(value)
+	}
+
+	metaHeaders := make(map[string]string, len(cfg.MetaHeaders))
+	for name, key := range cfg.MetaHeaders {
+		metaHeaders[name] = key
+	}
+
+	logLevels := make(map[string]LogLevel, len(cfg.MethodLogLevels))
+	for method, level := range cfg.MethodLogLevels {
+		logLevels[method] = level
+	}
+
+	uriRewrite := make(map[string]string, len(cfg.ResourceURIRewrite))
+	for from, to := range cfg.ResourceURIRewrite {
+		uriRewrite[from] = to
+	}
+
+	priorities := make(map[string]string, len(cfg.PriorityByIdentity))
+	for identity, priority := range cfg.PriorityByIdentity {
+		priorities[identity] = priority
+	}
+
+	return configView{
+		Version:              configViewVersion,
+		ServerName:           cfg.ServerName,
+		CommandPath:          cfg.CommandPath,
+		CommandArgs:          nonNil(cfg.CommandArgs),
+		PathEnvVar:           cfg.PathEnvVar,
+		AllowUnsetArgVars:    cfg.AllowUnsetArgVars,
+		UseShell:             cfg.UseShell,
+		ShellCommand:         nonNil(cfg.ShellCommand),
+		WrapperCommand:       nonNil(cfg.WrapperCommand),
+		BackendVersionArgs:   nonNil(cfg.BackendVersionArgs),
+		Nice:                 cfg.Nice,
+		ResourceLimits:       cfg.ResourceLimits,
+		CPUAffinity:          append([]int{}, cfg.CPUAffinity...),
+		ScratchRoot:          cfg.ScratchRoot,
+		ScratchEnvVar:        cfg.ScratchEnvVar,
+		ScratchQuotaBytes:    cfg.ScratchQuotaBytes,
+		LazyStart:            cfg.LazyStart,
+		MaxRestarts:          cfg.MaxRestarts,
+		CoalesceRestarts:     cfg.CoalesceRestarts,
+		MaxQueueAge:          cfg.MaxQueueAge.String(),
+		QueueTimeout:         cfg.QueueTimeout.String(),
+		CleanExitCodes:       append([]int{}, cfg.CleanExitCodes...),
+		ReplayInitialize:     cfg.ReplayInitialize,
+		Port:                 cfg.Port,
+		ConfigFile:           cfg.ConfigFile,
+		AuthToken:            fingerprint(cfg.AuthToken),
+		AdminToken:           fingerprint(cfg.AdminToken),
+		DisableBodyLogging:   cfg.DisableBodyLogging,
+		MaxResponseBytes:     cfg.MaxResponseBytes,
+		Delimiter:            cfg.Delimiter,
+		Framing:              cfg.Framing,
+		MaxBufferedBytes:     cfg.MaxBufferedBytes,
+		EnableMetrics:        cfg.EnableMetrics,
+		EnableConfigEndpoint: cfg.EnableConfigEndpoint,
+		EnableDebugEndpoints: cfg.EnableDebugEndpoints,
+		DebugLogLines:        cfg.DebugLogLines,
+		DebugLogStdout:       cfg.DebugLogStdout,
+		StrictSlash:          cfg.StrictSlash,
+		BasePath:             cfg.BasePath,
+		StrictParams:         cfg.StrictParams,
+		LegacySSECompat:      cfg.LegacySSECompat,
+		DeprecateSSE:         cfg.DeprecateSSE,
+		SSEInitialEvent:      cfg.SSEInitialEvent,
+		ExtraRoutes:          routes,
+		Routes:               routeViews,
+		ErrorCodeToStatus:    errorStatuses,
+
+		MapJSONRPCErrorsToHTTP: cfg.MapJSONRPCErrorsToHTTP,
+
+		ResponseCacheHeaders: cacheHeaders,
+		ResourceURIRewrite:   uriRewrite,
+		MetaHeaders:          metaHeaders,
+
+		EnvironmentLabel: cfg.EnvironmentLabel,
+
+		EnableNotificationStream: cfg.EnableNotificationStream,
+		ShareSubscriptions:       cfg.ShareSubscriptions,
+
+		EnableOpenAPI: cfg.EnableOpenAPI,
+
+		StrictMiddleware: cfg.StrictMiddleware,
+
+		MethodLogLevels: logLevels,
+
+		StaticPrompts:   cfg.StaticPrompts,
+		StaticResources: cfg.StaticResources,
+
+		EnableCORS:          cfg.EnableCORS,
+		SkipNotifications:   cfg.SkipNotifications,
+		MaxRequestBytes:     cfg.MaxRequestBytes,
+		StreamThreshold:     cfg.StreamThreshold,
+		UnwrapSingleContent: cfg.UnwrapSingleContent,
+		BatchFailFast:       cfg.BatchFailFast,
+		CoalesceMethods:     nonNil(cfg.CoalesceMethods),
+		CoalesceTools:       nonNil(cfg.CoalesceTools),
+
+		ResponseCacheSize: cfg.ResponseCacheSize,
+
+		DisableUnwrapStringBodies: cfg.DisableUnwrapStringBodies,
+
+		SizeWarnBytes: cfg.SizeWarnBytes,
+
+		SupportedProtocolVersions: nonNil(cfg.SupportedProtocolVersions),
+		NormalizeIDType:           cfg.NormalizeIDType,
+
+		RedactPatterns: nonNil(cfg.RedactPatterns),
+		RedactValues:   redactValues,
+
+		ToolCallTimeout:   cfg.ToolCallTimeout.String(),
+		ToolTimeouts:      toolTimeouts,
+		CancelGracePeriod: cfg.CancelGracePeriod.String(),
+
+		PropagateDeadlines: cfg.PropagateDeadlines,
+
+		AutoInitializedNotification: cfg.AutoInitializedNotification,
+		InitializedGracePeriod:      cfg.InitializedGracePeriod.String(),
+
+		CircuitBreakerFailures: cfg.CircuitBreakerFailures,
+		CircuitBreakerCooldown: cfg.CircuitBreakerCooldown.String(),
+
+		TokenEnvVar:        cfg.TokenEnvVar,
+		TokenRefreshMargin: cfg.TokenRefreshMargin.String(),
+
+		OOMRestartDelay: cfg.OOMRestartDelay.String(),
+		WarmStandby:     cfg.WarmStandby,
+
+		MaxSubprocessLifetime: cfg.MaxSubprocessLifetime.String(),
+
+		SSEInactivityTimeout: cfg.SSEInactivityTimeout.String(),
+
+		WaitFor:        nonNil(cfg.WaitFor),
+		WaitForTimeout: cfg.WaitForTimeout.String(),
+
+		ToolResultProcessors:      processors,
+		ToolResultProcessorErrors: cfg.ToolResultProcessorErrors,
+
+		Summarizer: newSummarizerView(cfg.Summarizer),
+
+		RecordFile:     cfg.RecordFile,
+		RecordMaxSize:  cfg.RecordMaxSize,
+		RecordMaxFiles: cfg.RecordMaxFiles,
+
+		MaxJunkLines:       cfg.MaxJunkLines,
+		StartupGracePeriod: cfg.StartupGracePeriod.String(),
+		StartupGraceLines:  cfg.StartupGraceLines,
+
+		MaxDesyncedResponses: cfg.MaxDesyncedResponses,
+
+		PriorityLanes:      cfg.PriorityLanes,
+		PriorityByIdentity: priorities,
+		PriorityMinShare:   cfg.PriorityMinShare,
+
+		RequestMiddleware:              cfg.RequestMiddleware != nil,
+		RequestMiddlewareStreamingSafe: cfg.RequestMiddlewareStreamingSafe,
+		ResponseMiddleware:             cfg.ResponseMiddleware != nil,
+		ErrorMiddleware:                cfg.ErrorMiddleware != nil,
+		Authenticator:                  cfg.Authenticator != nil,
+		Launcher:                       cfg.Launcher != nil,
+		ReadinessCheck:                 cfg.ReadinessCheck != nil,
+		RequestFilter:                  cfg.RequestFilter != nil,
+		Notifier:                       cfg.Notifier != nil,
+		ResponseCacheKey:               cfg.ResponseCacheKey != nil,
+		TokenRefresher:                 cfg.TokenRefresher != nil,
+		Logger:                         cfg.Logger != nil,
+		OnRequest:                      cfg.OnRequest != nil,
+		OnResponse:                     cfg.OnResponse != nil,
+		OnBackendStateChange:           cfg.OnBackendStateChange != nil,
+	}
+}
+
+// fingerprint identifies a secret without revealing it, so two deployments
+// can be checked for using the same value. Empty secrets stay empty.
+func fingerprint(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(secret))
+	return "sha256:" + hex.EncodeToString(sum[:])[:12]
+}
+
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
+
+// handleConfig serves GET /config.
+func (p *MCPProxy) handleConfig(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	data, err := json.MarshalIndent(newConfigView(p.effectiveConfig()), "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
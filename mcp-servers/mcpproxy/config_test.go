@@ -0,0 +1,243 @@
+package mcpproxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfigFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+}
+
+func TestConfigFileApplied(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	writeConfigFile(t, path, `{"port":"9090","maxRequestBytes":16}`)
+
+	proxy := newFakeProxy(t, "reflect", Config{ConfigFile: path})
+	if proxy.config.Port != "9090" {
+		t.Errorf("Expected port from config file, got %q", proxy.config.Port)
+	}
+	w := postJSON(proxy, `{"jsonrpc":"2.0","id":1,"method":"tools/list"}`)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected maxRequestBytes from config file to apply, got %d", w.Code)
+	}
+
+	writeConfigFile(t, path, `{"maxRequestBytes":16,"bogus":true}`)
+	if _, err := NewMCPProxy(Config{ConfigFile: path}); err == nil || !strings.Contains(err.Error(), "bogus") {
+		t.Errorf("Expected unknown field to be rejected, got %v", err)
+	}
+}
+
+func TestReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	writeConfigFile(t, path, `{"maxRequestBytes":16}`)
+	proxy := newFakeProxy(t, "reflect", Config{ConfigFile: path})
+
+	writeConfigFile(t, path, `{"maxRequestBytes":4096,"coalesceTools":["get_file"],"port":"9999","commandPath":"/bin/other"}`)
+	result, err := proxy.Reload()
+	if err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if len(result.Changed) != 2 || !strings.HasPrefix(result.Changed[0], "MaxRequestBytes: 16 -> 4096") {
+		t.Errorf("Unexpected changes: %v", result.Changed)
+	}
+	if strings.Join(result.Ignored, ",") != "CommandPath,Port" {
+		t.Errorf("Expected immutable fields to be ignored, got %v", result.Ignored)
+	}
+	if proxy.config.Port != "8080" {
+		t.Errorf("Port must not change on reload, got %q", proxy.config.Port)
+	}
+
+	w := postJSON(proxy, `{"jsonrpc":"2.0","id":1,"method":"tools/list"}`)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected reloaded limit to apply, got %d", w.Code)
+	}
+
+	// A broken file leaves the running configuration in place
+	writeConfigFile(t, path, `{"maxRequestBytes":`)
+	if _, err := proxy.Reload(); err == nil {
+		t.Error("Expected reload of a malformed file to fail")
+	}
+	if got := proxy.dynamic.Load().MaxRequestBytes; got != 4096 {
+		t.Errorf("Expected configuration to be kept after a failed reload, got %d", got)
+	}
+}
+
+func TestReloadLoggingAndTimeouts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	writeConfigFile(t, path, `{}`)
+	logs := &recordingLogger{}
+	proxy := newFakeProxy(t, "reflect", Config{ConfigFile: path, Logger: logs})
+
+	writeConfigFile(t, path, `{"redactValues":["reloaded-S3cret"],"methodLogLevels":{"ping":"debug"},"queueTimeout":"2s","toolTimeouts":{"slow":"50ms"}}`)
+	result, err := proxy.Reload()
+	if err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if len(result.Changed) != 4 || len(result.Ignored) != 0 {
+		t.Errorf("Expected four reloaded fields, got %v, ignored %v", result.Changed, result.Ignored)
+	}
+	proxy.log.Info("Using reloaded-S3cret")
+	if strings.Contains(logs.String(), "reloaded-S3cret") {
+		t.Errorf("Expected the reloaded secret to be redacted, got:\n%s", logs.String())
+	}
+	dc := proxy.dynamic.Load()
+	if got := dc.toolCallTimeout(&request{method: "tools/call", tool: "slow"}); got != 50*time.Millisecond {
+		t.Errorf("Expected the reloaded tool timeout, got %v", got)
+	}
+	if dc.QueueTimeout != 2*time.Second || dc.MethodLogLevels["ping"] != LogDebug {
+		t.Errorf("Expected the reloaded settings, got %+v", dc)
+	}
+
+	// A file NewMCPProxy would refuse changes nothing, and changes that
+	// need a restart are logged
+	writeConfigFile(t, path, `{"redactPatterns":["("],"queueTimeout":"5s"}`)
+	if _, err := proxy.Reload(); err == nil || !strings.Contains(err.Error(), "invalid redact pattern") {
+		t.Errorf("Expected an invalid file to be refused, got %v", err)
+	}
+	if got := proxy.dynamic.Load().QueueTimeout; got != 2*time.Second {
+		t.Errorf("Expected the configuration to be kept after a refused reload, got %v", got)
+	}
+	writeConfigFile(t, path, `{"commandArgs":["--other"]}`)
+	if _, err := proxy.Reload(); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	waitForLog(t, logs, "WARN Ignored changes to fields that require a restart server=test fields=CommandArgs")
+}
+
+func TestReloadEndpoint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	writeConfigFile(t, path, `{}`)
+	handler := newFakeProxy(t, "reflect", Config{ConfigFile: path}).Handler()
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/admin/reload", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405 for GET, got %d", w.Code)
+	}
+
+	writeConfigFile(t, path, `{"enableCORS":true}`)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("POST", "/admin/reload", nil))
+	var result ReloadResult
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("Expected reload result, got %d: %s", w.Code, w.Body.String())
+	}
+	if len(result.Changed) != 1 || result.Changed[0] != "EnableCORS: false -> true" {
+		t.Errorf("Unexpected changes: %v", result.Changed)
+	}
+
+	// Without a config file the route is not registered
+	w = httptest.NewRecorder()
+	newFakeProxy(t, "reflect", Config{}).Handler().ServeHTTP(w, httptest.NewRequest("POST", "/admin/reload", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected /admin/reload to be unknown, got %d", w.Code)
+	}
+}
+
+func TestConfigEndpoint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	writeConfigFile(t, path, `{"maxRequestBytes":1024}`)
+	proxy := newFakeProxy(t, "reflect", Config{
+		ConfigFile:           path,
+		AuthToken:            "s3cret",
+		EnableConfigEndpoint: true,
+		ResponseMiddleware:   func(b []byte) []byte { return b },
+		ExtraRoutes:          map[string]http.HandlerFunc{"/sse": http.NotFound, "/b": http.NotFound},
+	})
+	handler := proxy.Handler()
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/config", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected /config to require the auth token, got %d", w.Code)
+	}
+
+	get := func() map[string]interface{} {
+		req := httptest.NewRequest("GET", "/config", nil)
+		req.Header.Set("Authorization", "Bearer s3cret")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		var view map[string]interface{}
+		if err := json.Unmarshal(w.Body.Bytes(), &view); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("Expected config JSON, got %d: %s", w.Code, w.Body.String())
+		}
+		return view
+	}
+
+	view := get()
+	if strings.Contains(fmt.Sprint(view), "s3cret") {
+		t.Errorf("Secret leaked in config view: %v", view)
+	}
+	if fp, _ := view["authToken"].(string); !strings.HasPrefix(fp, "sha256:") || len(fp) != len("sha256:")+12 {
+		t.Errorf("Expected a token fingerprint, got %v", view["authToken"])
+	}
+	if view["version"] != float64(configViewVersion) || view["configFile"] != path || view["port"] != "8080" {
+		t.Errorf("Unexpected config view: %v", view)
+	}
+	if view["responseMiddleware"] != true || view["requestMiddleware"] != false {
+		t.Errorf("Expected hooks to be reported as set or unset, got %v", view)
+	}
+	if fmt.Sprint(view["extraRoutes"]) != "[/b /sse]" {
+		t.Errorf("Expected sorted extra routes, got %v", view["extraRoutes"])
+	}
+	if view["maxRequestBytes"] != float64(1024) {
+		t.Errorf("Expected value from config file, got %v", view["maxRequestBytes"])
+	}
+
+	// Reloaded settings are reflected
+	writeConfigFile(t, path, `{"maxRequestBytes":2048}`)
+	if _, err := proxy.Reload(); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if view := get(); view["maxRequestBytes"] != float64(2048) {
+		t.Errorf("Expected reloaded value, got %v", view["maxRequestBytes"])
+	}
+}
+
+func TestConfigFileFields(t *testing.T) {
+	// Every field must be named for the config file, or marked as code-only
+	// with "-", so that new fields are not left out by accident
+	typ := reflect.TypeOf(Config{})
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if _, ok := field.Tag.Lookup("json"); !ok && !codeOnly(field.Type) {
+			t.Errorf("Config.%s has no json tag", field.Name)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	writeConfigFile(t, path, `{"queueTimeout":"2s","toolTimeouts":{"slow":"1m"},"resourceLimits":{"maxOpenFiles":64},
+		"summarizer":{"url":"http://summarizer","threshold":100,"timeout":"5s"},"framing":null}`)
+	cfg, err := loadConfigFile(Config{ConfigFile: path, Framing: "content-length"})
+	if err != nil {
+		t.Fatalf("loadConfigFile failed: %v", err)
+	}
+	if cfg.QueueTimeout != 2*time.Second || cfg.ToolTimeouts["slow"] != time.Minute || cfg.ResourceLimits.MaxOpenFiles != 64 ||
+		cfg.Summarizer == nil || cfg.Summarizer.Timeout != 5*time.Second || cfg.Framing != "content-length" {
+		t.Errorf("Unexpected configuration %+v", cfg)
+	}
+
+	for _, content := range []string{
+		`{"configFile":"other.json"}`,
+		`{"queueTimeout":2}`,
+		`{"resourceLimits":{"maxFiles":64}}`,
+		`{"summarizer":{"url":"http://summarizer","retries":3}}`,
+	} {
+		writeConfigFile(t, path, content)
+		if _, err := loadConfigFile(Config{ConfigFile: path}); err == nil {
+			t.Errorf("Expected %s to be rejected", content)
+		}
+	}
+}
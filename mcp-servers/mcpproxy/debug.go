@@ -0,0 +1,157 @@
+package mcpproxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// defaultDebugLogLines is how many lines of MCP server output /debug/logs
+// keeps if Config.DebugLogLines is unset.
+const defaultDebugLogLines = 500
+
+// maxOutputLineBytes bounds each line kept, so that a stray response
+// printed as text does not pin megabytes.
+const maxOutputLineBytes = 4096
+
+// outputLine is a line the MCP server wrote, as served at /debug/logs.
+type outputLine struct {
+	Time   time.Time `json:"time"`
+	PID    int       `json:"pid"`
+	Stream string    `json:"stream"` // "stderr", or "stdout" for text that is not JSON
+	Line   string    `json:"line"`
+}
+
+// outputBuffer keeps the last lines the MCP server wrote, across restarts,
+// with secrets redacted as in the log. All methods are safe for concurrent
+// use, and do nothing on a nil outputBuffer.
+type outputBuffer struct {
+	redactor *redactor
+
+	mu    sync.Mutex
+	lines []outputLine // a ring, oldest at next once full
+	next  int
+	full  bool
+}
+
+// newOutputBuffer returns the buffer for cfg, redacting with r, or nil if
+// /debug/logs is not served.
+func newOutputBuffer(cfg Config, r *redactor) *outputBuffer {
+	if !cfg.EnableDebugEndpoints || cfg.DebugLogLines < 0 {
+		return nil
+	}
+	size := cfg.DebugLogLines
+	if size == 0 {
+		size = defaultDebugLogLines
+	}
+	return &outputBuffer{redactor: r, lines: make([]outputLine, size)}
+}
+
+// add records line, written by process pid to stream.
+func (o *outputBuffer) add(pid int, stream, line string) {
+	if o == nil {
+		return
+	}
+	if len(line) > maxOutputLineBytes {
+		line = line[:maxOutputLineBytes] + "..."
+	}
+	l := outputLine{Time: time.Now(), PID: pid, Stream: stream, Line: o.redactor.redact(line)}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.lines[o.next] = l
+	o.next++
+	if o.next == len(o.lines) {
+		o.next = 0
+		o.full = true
+	}
+}
+
+// snapshot returns the lines kept, oldest first.
+func (o *outputBuffer) snapshot() []outputLine {
+	if o == nil {
+		return []outputLine{}
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if !o.full {
+		return append([]outputLine{}, o.lines[:o.next]...)
+	}
+	return append(append([]outputLine{}, o.lines[o.next:]...), o.lines[:o.next]...)
+}
+
+// handleDebugLogs serves GET /debug/logs with the last lines the MCP server
+// wrote to stderr, and with Config.DebugLogStdout the text it wrote to
+// stdout that was not JSON, oldest first.
+func (p *MCPProxy) handleDebugLogs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string][]outputLine{"lines": p.output.snapshot()})
+}
+
+// handleDebugRaw serves POST /debug/raw. The body is sent to the MCP server
+// as a single message, bypassing coalescing and all middleware, and the
+// response is returned byte for byte as the server sent it. Timing is
+// reported in a Server-Timing header: time spent queued behind other
+// requests and time spent waiting for the MCP server.
+func (p *MCPProxy) handleDebugRaw(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var body io.Reader = r.Body
+	if limit := p.dynamic.Load().MaxRequestBytes; limit > 0 {
+		body = http.MaxBytesReader(w, r.Body, limit)
+	}
+	msg, err := io.ReadAll(body)
+	if err != nil {
+		p.rejectBody(w, err)
+		return
+	}
+	if !json.Valid(msg) {
+		http.Error(w, "Body is not valid JSON", http.StatusBadRequest)
+		return
+	}
+
+	var mcpMsg MCPMessage
+	json.Unmarshal(msg, &mcpMsg)
+	p.log.Info("Debug: sending raw message", "id", mcpMsg.ID, "method", mcpMsg.Method, "identity", identity(r))
+
+	// Sent as a stream so that raw newlines in the body do not break
+	// framing; no middleware applies to streamed requests.
+	req := &request{
+		body:      bytes.NewReader(msg),
+		id:        mcpMsg.ID,
+		method:    mcpMsg.Method,
+		isRequest: mcpMsg.HasID,
+		response:  make(chan json.RawMessage, 1),
+		raw:       true,
+		gone:      r.Context().Done(),
+	}
+	if err := p.enqueue(req); err != nil {
+		p.failRequest(w, r, mcpMsg.ID, err)
+		return
+	}
+	response, ok := <-req.response
+	w.Header().Set("Server-Timing", serverTiming(req, time.Now()))
+	if req.err != nil || (!ok && req.isRequest) {
+		p.failRequest(w, r, mcpMsg.ID, req.err)
+		return
+	}
+	if !req.isRequest {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(response)
+	p.buffered.release(len(response))
+}
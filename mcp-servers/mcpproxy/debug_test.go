@@ -0,0 +1,125 @@
+package mcpproxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rh-ai-kickstart/ai-architecture-charts/mcp-servers/mcpproxy/internal/fakebackend"
+)
+
+func TestDebugRaw(t *testing.T) {
+	proxy := newFakeProxy(t, "reflect", Config{
+		EnableDebugEndpoints: true,
+		ResponseMiddleware:   func(b []byte) []byte { return []byte(`{"mangled":true}`) },
+		ErrorMiddleware:      func(string, *RPCError) *RPCError { return &RPCError{Code: 1, Message: "mangled"} },
+	})
+	handler := proxy.Handler()
+
+	post := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("POST", "/debug/raw", strings.NewReader(body)))
+		return w
+	}
+
+	// Raw newlines in the body must not break framing
+	w := post("{\n  \"jsonrpc\": \"2.0\", \"id\": 7, \"method\": \"x\",\n  \"params\": {\"result\": {\"b\": 1, \"a\": 2}}\n}")
+	if w.Code != http.StatusOK || w.Body.String() != `{"id":7,"jsonrpc":"2.0","result":{"b":1,"a":2}}` {
+		t.Errorf("Expected the unmodified backend response, got %d: %s", w.Code, w.Body.String())
+	}
+	if timing := w.Header().Get("Server-Timing"); !strings.Contains(timing, "queue;dur=") || !strings.Contains(timing, "backend;dur=") {
+		t.Errorf("Expected timing information, got %q", timing)
+	}
+
+	w = post(`{"jsonrpc":"2.0","id":8,"method":"x","params":{"error":{"code":-32000,"message":"raw"}}}`)
+	if !strings.Contains(w.Body.String(), `"message":"raw"`) {
+		t.Errorf("Expected ErrorMiddleware to be bypassed, got %s", w.Body.String())
+	}
+
+	// The normal endpoint still applies middleware, restoring the id it drops
+	if w := postJSON(proxy, `{"jsonrpc":"2.0","id":9,"method":"x"}`); w.Body.String() != `{"id":9,"jsonrpc":"2.0","mangled":true}` {
+		t.Errorf("Expected middleware on the normal path, got %s", w.Body.String())
+	}
+
+	if w := post(`{"jsonrpc":"2.0","method":"notifications/x"}`); w.Code != http.StatusAccepted {
+		t.Errorf("Expected 202 for a notification, got %d", w.Code)
+	}
+	if w := post(`{not json`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for invalid JSON, got %d", w.Code)
+	}
+
+	// Disabled by default, leaving the path unknown
+	w = httptest.NewRecorder()
+	newFakeProxy(t, "reflect", Config{
+		ResponseMiddleware: func(b []byte) []byte { return []byte(`{"mangled":true}`) },
+	}).Handler().ServeHTTP(w, httptest.NewRequest("POST", "/debug/raw", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"x"}`)))
+	if w.Code != http.StatusNotFound || strings.Contains(w.Body.String(), `"mangled":true`) {
+		t.Error("Expected /debug/raw to be disabled by default")
+	}
+}
+
+func TestDebugLogs(t *testing.T) {
+	path, args := fakebackend.Command("ack")
+	proxy, err := NewMCPProxy(Config{
+		ServerName: "test",
+		CommandPath: `for i in 1 2 3; do echo "ORA-12541: TNS:no listener $i" >&2; done; echo "SQLcl banner"; exec ` +
+			path + " " + strings.Join(args, " "),
+		UseShell:             true,
+		EnableDebugEndpoints: true,
+		DebugLogLines:        3,
+		DebugLogStdout:       true,
+		AdminToken:           "admin",
+	})
+	if err != nil {
+		t.Fatalf("NewMCPProxy failed: %v", err)
+	}
+	defer proxy.Close()
+
+	getLogs := func() []outputLine {
+		t.Helper()
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/debug/logs", nil)
+		r.Header.Set("X-Admin-Token", "admin")
+		proxy.Handler().ServeHTTP(w, r)
+		var body struct {
+			Lines []outputLine `json:"lines"`
+		}
+		if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &body) != nil {
+			t.Fatalf("Unexpected response %d: %s", w.Code, w.Body.String())
+		}
+		return body.Lines
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(getLogs()) < 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the stderr lines, got %+v", getLogs())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// The banner is read from stdout with the first request, and pushes
+	// out the oldest line
+	postJSON(proxy, `{"jsonrpc":"2.0","id":1,"method":"ping"}`)
+	lines := getLogs()
+	var got []string
+	for _, l := range lines {
+		got = append(got, l.Stream+": "+l.Line)
+		if l.Time.IsZero() || l.PID != proxy.Status().PID {
+			t.Errorf("Expected the time and pid of each line, got %+v", l)
+		}
+	}
+	want := []string{"stderr: ORA-12541: TNS:no listener 2", "stderr: ORA-12541: TNS:no listener 3", "stdout: SQLcl banner"}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Unexpected lines:\n%s", strings.Join(got, "\n"))
+	}
+
+	w := httptest.NewRecorder()
+	proxy.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/debug/logs", nil))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected /debug/logs to require the admin token, got %d", w.Code)
+	}
+}
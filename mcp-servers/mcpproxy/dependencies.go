@@ -0,0 +1,155 @@
+package mcpproxy
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// defaultWaitForTimeout is the default Config.WaitForTimeout.
+const defaultWaitForTimeout = 5 * time.Minute
+
+var (
+	// waitForInterval is the pause between rounds of probing the targets
+	// of Config.WaitFor that are not reachable yet.
+	waitForInterval = 2 * time.Second
+
+	// waitForProbeTimeout bounds a single probe of a target.
+	waitForProbeTimeout = 5 * time.Second
+)
+
+// dependencies are the targets of Config.WaitFor the proxy waits for before
+// starting the MCP server.
+type dependencies struct {
+	mu      sync.Mutex
+	pending []string // targets not reachable yet, in the order configured
+}
+
+func newDependencies(targets []string) *dependencies {
+	return &dependencies{pending: append([]string(nil), targets...)}
+}
+
+// unreachable returns the targets not reachable yet.
+func (d *dependencies) unreachable() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string(nil), d.pending...)
+}
+
+// wait probes the unreachable targets every waitForInterval until all have
+// been reached once, logging each failed attempt. It gives up after
+// timeout, returning an error listing the targets never reached.
+func (d *dependencies) wait(timeout time.Duration, log Logger) error {
+	deadline := time.Now().Add(timeout)
+	for attempt := 1; ; attempt++ {
+		for _, target := range d.unreachable() {
+			err := probeDependency(target)
+			if err != nil {
+				log.Info("Waiting for dependency", "target", target, "attempt", attempt, "error", err)
+				continue
+			}
+			log.Info("Dependency is reachable", "target", target, "attempt", attempt)
+			d.mu.Lock()
+			d.pending = removeString(d.pending, target)
+			d.mu.Unlock()
+		}
+
+		pending := d.unreachable()
+		if len(pending) == 0 {
+			return nil
+		}
+		if time.Now().Add(waitForInterval).After(deadline) {
+			return fmt.Errorf("dependencies still unreachable after %v: %s", timeout, strings.Join(pending, ", "))
+		}
+		time.Sleep(waitForInterval)
+	}
+}
+
+// ServeHTTP answers requests while the proxy waits for its dependencies:
+// /healthz succeeds, so that the wait does not get the proxy restarted, and
+// everything else, /readyz included, fails naming the targets waited for.
+func (d *dependencies) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/healthz" {
+		fmt.Fprintln(w, "ok")
+		return
+	}
+	http.Error(w, "waiting for dependencies: "+strings.Join(d.unreachable(), ", "), http.StatusServiceUnavailable)
+}
+
+// probeDependency checks that target is reachable: a URL must answer GET
+// with 200 OK, and a host:port must accept a TCP connection.
+func probeDependency(target string) error {
+	if !isURLTarget(target) {
+		conn, err := net.DialTimeout("tcp", target, waitForProbeTimeout)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), waitForProbeTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// isURLTarget reports whether a Config.WaitFor target is a URL rather than
+// a host:port.
+func isURLTarget(target string) bool {
+	return strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://")
+}
+
+// validateWaitFor checks that the targets of cfg.WaitFor are http or https
+// URLs or host:port pairs.
+func validateWaitFor(cfg Config) error {
+	for _, target := range cfg.WaitFor {
+		if isURLTarget(target) {
+			if u, err := url.Parse(target); err != nil || u.Host == "" {
+				return fmt.Errorf("WaitFor holds invalid URL %q", target)
+			}
+			continue
+		}
+		if host, port, err := net.SplitHostPort(target); err != nil || host == "" || port == "" {
+			return fmt.Errorf("WaitFor holds %q, expected host:port or an http or https URL", target)
+		}
+	}
+	return nil
+}
+
+func removeString(list []string, s string) []string {
+	for i, item := range list {
+		if item == s {
+			return append(list[:i:i], list[i+1:]...)
+		}
+	}
+	return list
+}
+
+// switchHandler serves HTTP requests with the handler last set, so that the
+// proxy can listen while it waits for its dependencies.
+type switchHandler struct {
+	handler atomic.Pointer[http.Handler]
+}
+
+func (s *switchHandler) set(h http.Handler) { s.handler.Store(&h) }
+
+func (s *switchHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	(*s.handler.Load()).ServeHTTP(w, r)
+}
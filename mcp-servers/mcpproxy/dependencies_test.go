@@ -0,0 +1,144 @@
+package mcpproxy
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func fastDependencyChecks(t *testing.T) {
+	t.Helper()
+	saved := waitForInterval
+	waitForInterval = 10 * time.Millisecond
+	t.Cleanup(func() { waitForInterval = saved })
+}
+
+// freeAddr returns a local address nothing listens on.
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	return addr
+}
+
+func TestWaitForDependencies(t *testing.T) {
+	fastDependencyChecks(t)
+	logs := &recordingLogger{}
+	addr := freeAddr(t)
+	var ready atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !ready.Load() {
+			http.Error(w, "starting", http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	deps := newDependencies([]string{addr, server.URL})
+	done := make(chan error, 1)
+	go func() { done <- deps.wait(5*time.Second, logs) }()
+	waitForLog(t, logs, "target="+server.URL+" attempt=2 error=unexpected status 503")
+
+	// Until then readiness fails naming what is missing, and liveness does
+	// not
+	w := httptest.NewRecorder()
+	deps.ServeHTTP(w, httptest.NewRequest("GET", "/readyz", nil))
+	if w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), "waiting for dependencies: "+addr+", "+server.URL) {
+		t.Errorf("Unexpected /readyz response %d %s", w.Code, w.Body.String())
+	}
+	w = httptest.NewRecorder()
+	deps.ServeHTTP(w, httptest.NewRequest("GET", "/healthz", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected /healthz to succeed, got %d %s", w.Code, w.Body.String())
+	}
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	waitForLog(t, logs, "Dependency is reachable target="+addr)
+	ready.Store(true)
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Expected the wait to succeed, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Wait did not return")
+	}
+	if got := deps.unreachable(); len(got) != 0 {
+		t.Errorf("Expected no unreachable dependencies, got %v", got)
+	}
+}
+
+func TestWaitForTimeout(t *testing.T) {
+	fastDependencyChecks(t)
+	addr := freeAddr(t)
+	err := Run(Config{
+		CommandPath:    "cat",
+		Port:           "0",
+		WaitFor:        []string{addr},
+		WaitForTimeout: 50 * time.Millisecond,
+		Logger:         &recordingLogger{},
+	})
+	if err == nil || !strings.Contains(err.Error(), "dependencies still unreachable after 50ms: "+addr) {
+		t.Errorf("Expected Run to fail naming %s, got %v", addr, err)
+	}
+}
+
+func TestRunFailureStopsListening(t *testing.T) {
+	fastDependencyChecks(t)
+	dep, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dep.Close()
+
+	// The proxy listens while it waits, and stops once it fails to start
+	err = Run(Config{
+		CommandPath: "/nonexistent/mcp-server",
+		Port:        "0",
+		WaitFor:     []string{dep.Addr().String()},
+		Logger:      &recordingLogger{},
+	})
+	if err == nil || !strings.Contains(err.Error(), "failed to create proxy") {
+		t.Fatalf("Expected Run to fail to create the proxy, got %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for serving() != "" {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the listener to be closed, still serving:\n%s", serving())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// serving returns the stack of a goroutine serving HTTP, if there is one.
+func serving() string {
+	for _, stack := range runningGoroutines() {
+		if strings.Contains(stack, "net/http.(*Server).Serve(") {
+			return stack
+		}
+	}
+	return ""
+}
+
+func TestValidateWaitFor(t *testing.T) {
+	for _, target := range []string{"db", ":1521", "http://", "https://%zz"} {
+		if err := validateWaitFor(Config{WaitFor: []string{target}}); err == nil {
+			t.Errorf("Expected %q to be rejected", target)
+		}
+	}
+	if err := validateWaitFor(Config{WaitFor: []string{"db:1521", "http://auth:8080/health"}}); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
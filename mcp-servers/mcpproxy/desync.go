@@ -0,0 +1,32 @@
+package mcpproxy
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// desyncedResponse handles a response with the given id, which matches no
+// request sent to b, while the proxy waits for the response to requestID.
+// Once Config.MaxDesyncedResponses such responses came in a row, it kills
+// the MCP server for supervise to restart it and returns the error
+// response that ends the wait. It returns nil until then.
+func (p *MCPProxy) desyncedResponse(b *backend, log Logger, id, requestID interface{}) json.RawMessage {
+	max := p.config.MaxDesyncedResponses
+	if max <= 0 {
+		return nil
+	}
+
+	b.desyncs++
+	if b.desyncs < max {
+		log.Warn("MCP server sent a response that matches no request", "id", id, "expected", requestID, "count", b.desyncs)
+		return nil
+	}
+	log.Error("MCP server's responses keep matching no request, its stdout is likely desynced, restarting it",
+		"id", id, "expected", requestID, "count", b.desyncs, "pid", b.cmd.Process.Pid)
+	b.desyncs = 0
+	b.desynced.Store(true)
+	b.stopped.Store(true)
+	b.cmd.Process.Kill()
+	return jsonRPCError(requestID, -32603,
+		fmt.Sprintf("MCP server sent %d responses in a row that match no request, so it was restarted", max))
+}
@@ -0,0 +1,60 @@
+package mcpproxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// desyncCall sends a request to a "desync" proxy and returns the response.
+func desyncCall(t *testing.T, proxy *MCPProxy, id int, desync bool) (pid int, respID interface{}, rpcErr *RPCError) {
+	t.Helper()
+	w := postJSON(proxy, fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":"tools/call","params":{"desync":%t}}`, id, desync))
+	var resp struct {
+		ID     interface{} `json:"id"`
+		Result struct {
+			PID int `json:"pid"`
+		} `json:"result"`
+		Error *RPCError `json:"error"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Unexpected response %d %s", w.Code, w.Body.String())
+	}
+	return resp.Result.PID, resp.ID, resp.Error
+}
+
+func TestMaxDesyncedResponses(t *testing.T) {
+	fastRestarts(t)
+	logs := &recordingLogger{}
+	proxy := newFakeProxy(t, "desync", Config{MaxDesyncedResponses: 3, Logger: logs})
+
+	first, _, rpcErr := desyncCall(t, proxy, 1, false)
+	if rpcErr != nil || first == 0 {
+		t.Fatalf("Expected the pid, got %+v", rpcErr)
+	}
+
+	// Responses that match no request are returned up to the limit, which
+	// only counts those in a row
+	for id := 2; id <= 6; id++ {
+		if id == 4 {
+			desyncCall(t, proxy, id, false)
+			continue
+		}
+		if _, respID, rpcErr := desyncCall(t, proxy, id, true); rpcErr != nil || respID != fmt.Sprintf("lost-%d", id) {
+			t.Fatalf("Expected the unmatched response, got %v %+v", respID, rpcErr)
+		}
+	}
+	_, respID, rpcErr := desyncCall(t, proxy, 7, true)
+	if rpcErr == nil || rpcErr.Code != -32603 || !strings.Contains(rpcErr.Message, "restarted") || respID != float64(7) {
+		t.Fatalf("Expected the request to fail once the limit is reached, got %v %+v", respID, rpcErr)
+	}
+	waitForLog(t, logs, "MCP server was killed to resynchronize its stdout")
+
+	// The restarted MCP server answers in sync again
+	waitForRestarts(t, proxy, 1)
+	pid, respID, rpcErr := desyncCall(t, proxy, 8, false)
+	if rpcErr != nil || respID != float64(8) || pid == first {
+		t.Errorf("Expected a new MCP server to answer, got %d %v %+v", pid, respID, rpcErr)
+	}
+}
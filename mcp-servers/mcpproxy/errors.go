@@ -0,0 +1,167 @@
+package mcpproxy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Errors the proxy fails requests with. Match them with errors.Is; the
+// error types below carry the details. ErrorClasses maps each to what
+// clients receive.
+var (
+	// ErrProxyClosed is returned for requests made after Close.
+	ErrProxyClosed = errors.New("proxy is closed")
+
+	// ErrBackendUnavailable is matched by a *BackendError: the MCP server
+	// could not be started, is not running, or exited while answering.
+	ErrBackendUnavailable = errors.New("MCP server is not running")
+
+	// ErrTimeout is matched by a *TimeoutError.
+	ErrTimeout = errors.New("request timed out")
+
+	// ErrQueueFull is matched by a *QueueFullError.
+	ErrQueueFull = errors.New("request queue is full")
+
+	// ErrRejectedByMiddleware is matched by a *MiddlewareError.
+	ErrRejectedByMiddleware = errors.New("rejected by middleware")
+
+	// ErrCircuitOpen is matched by a *CircuitOpenError.
+	ErrCircuitOpen = errors.New("circuit breaker is open")
+
+	// ErrDispatcherStopped fails requests once the request dispatcher has
+	// panicked, until the proxy is restarted.
+	ErrDispatcherStopped = errors.New("request dispatcher stopped")
+)
+
+// BackendError reports that a request could not be answered by the MCP
+// server, or that it could not be started.
+type BackendError struct {
+	// State is the state of the MCP server, as in BackendStatus, if known.
+	State string
+	// Err is the cause, if any, such as the failure to start it.
+	Err error
+	// Exit describes how the MCP server exited, if the request failed
+	// because it did.
+	Exit *ExitInfo
+}
+
+func (e *BackendError) Error() string {
+	msg := ErrBackendUnavailable.Error()
+	if e.State != "" {
+		msg += " (" + e.State + ")"
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	if e.Exit != nil {
+		msg += " (MCP server " + e.Exit.Description + ")"
+	}
+	return msg
+}
+
+func (e *BackendError) Is(target error) bool { return target == ErrBackendUnavailable }
+func (e *BackendError) Unwrap() error        { return e.Err }
+
+// errorData returns the data member of the JSON-RPC error reporting err:
+// how the MCP server exited, as {"exit": ExitInfo}, for a *BackendError
+// caused by its exit, and nil otherwise.
+func errorData(err error) json.RawMessage {
+	var backendErr *BackendError
+	if !errors.As(err, &backendErr) || backendErr.Exit == nil {
+		return nil
+	}
+	data, _ := json.Marshal(map[string]*ExitInfo{"exit": backendErr.Exit})
+	return data
+}
+
+// TimeoutError reports a request that waited longer than Timeout in Stage,
+// such as "queue" for Config.QueueTimeout.
+type TimeoutError struct {
+	Stage   string
+	Timeout time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("request timed out in %s after %v", e.Stage, e.Timeout)
+}
+
+func (e *TimeoutError) Is(target error) bool { return target == ErrTimeout }
+
+// QueueFullError reports a request that found the queue, which holds
+// Capacity requests, full for as long as Config.QueueTimeout let it wait.
+type QueueFullError struct {
+	Capacity int
+	Waited   time.Duration
+}
+
+func (e *QueueFullError) Error() string {
+	return fmt.Sprintf("request queue of %d was full for %v", e.Capacity, e.Waited)
+}
+
+func (e *QueueFullError) Is(target error) bool { return target == ErrQueueFull }
+
+// CircuitOpenError reports a request that was not sent because the
+// circuit breaker was in State, see Config.CircuitBreakerFailures.
+type CircuitOpenError struct {
+	State string
+}
+
+func (e *CircuitOpenError) Error() string {
+	if e.State == BreakerHalfOpen {
+		return "circuit breaker is half-open, waiting for a probe request to the MCP server"
+	}
+	return ErrCircuitOpen.Error()
+}
+
+func (e *CircuitOpenError) Is(target error) bool { return target == ErrCircuitOpen }
+
+// MiddlewareError reports a request that was not sent because Middleware
+// panicked. Clients are given CorrelationID, under which the panic was
+// logged.
+type MiddlewareError struct {
+	Middleware    string
+	CorrelationID string
+}
+
+func (e *MiddlewareError) Error() string {
+	return middlewarePanicMessage(e.CorrelationID)
+}
+
+func (e *MiddlewareError) Is(target error) bool { return target == ErrRejectedByMiddleware }
+
+// ErrorClass is how requests failed with an error matching Err are
+// answered: with a JSON-RPC error with Code, sent with HTTP Status.
+type ErrorClass struct {
+	Err    error
+	Code   int
+	Status int
+}
+
+// ErrorClasses maps the errors requests fail with to JSON-RPC error codes
+// and HTTP statuses. Tool calls that run over Config.ToolCallTimeout are
+// answered with the code of ErrTimeout too. Transports built on the proxy
+// should report errors through ClassifyError so that clients see the same
+// codes from all of them.
+var ErrorClasses = []ErrorClass{
+	{Err: ErrTimeout, Code: errToolCallTimeoutCode, Status: http.StatusServiceUnavailable},
+	{Err: ErrBackendUnavailable, Code: -32002, Status: http.StatusServiceUnavailable},
+	{Err: ErrQueueFull, Code: -32003, Status: http.StatusServiceUnavailable},
+	{Err: ErrProxyClosed, Code: -32004, Status: http.StatusServiceUnavailable},
+	{Err: ErrDispatcherStopped, Code: -32005, Status: http.StatusServiceUnavailable},
+	{Err: ErrCircuitOpen, Code: -32007, Status: http.StatusServiceUnavailable},
+	{Err: ErrRejectedByMiddleware, Code: -32603, Status: http.StatusInternalServerError},
+}
+
+// ClassifyError returns the entry of ErrorClasses that err matches, or an
+// internal error (-32603, 500) with a nil Err if it matches none.
+func ClassifyError(err error) ErrorClass {
+	for _, class := range ErrorClasses {
+		if errors.Is(err, class.Err) {
+			return class
+		}
+	}
+	return ErrorClass{Code: -32603, Status: http.StatusInternalServerError}
+}
@@ -0,0 +1,81 @@
+package mcpproxy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestClassifyError(t *testing.T) {
+	for _, tc := range []struct {
+		err    error
+		class  error
+		code   int
+		status int
+	}{
+		{&BackendError{State: StateFailed}, ErrBackendUnavailable, -32002, http.StatusServiceUnavailable},
+		{&TimeoutError{Stage: "queue", Timeout: time.Second}, ErrTimeout, -32001, http.StatusServiceUnavailable},
+		{&QueueFullError{Capacity: 100}, ErrQueueFull, -32003, http.StatusServiceUnavailable},
+		{ErrProxyClosed, ErrProxyClosed, -32004, http.StatusServiceUnavailable},
+		{ErrDispatcherStopped, ErrDispatcherStopped, -32005, http.StatusServiceUnavailable},
+		{&CircuitOpenError{State: BreakerHalfOpen}, ErrCircuitOpen, -32007, http.StatusServiceUnavailable},
+		{&MiddlewareError{Middleware: "RequestMiddleware", CorrelationID: "abc"}, ErrRejectedByMiddleware, -32603, http.StatusInternalServerError},
+		{fmt.Errorf("wrapped: %w", &TimeoutError{}), ErrTimeout, -32001, http.StatusServiceUnavailable},
+		{errors.New("something else"), nil, -32603, http.StatusInternalServerError},
+		{nil, nil, -32603, http.StatusInternalServerError},
+	} {
+		class := ClassifyError(tc.err)
+		if class.Err != tc.class || class.Code != tc.code || class.Status != tc.status {
+			t.Errorf("Expected %v to be classified as %v %d %d, got %+v", tc.err, tc.class, tc.code, tc.status, class)
+		}
+	}
+}
+
+// rpcErrorOf returns the JSON-RPC error code of the response in w.
+func rpcErrorOf(t *testing.T, w *httptest.ResponseRecorder) int {
+	t.Helper()
+	var resp struct {
+		Error *RPCError `json:"error"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Error == nil {
+		t.Fatalf("Expected a JSON-RPC error, got %d %s", w.Code, w.Body.String())
+	}
+	return resp.Error.Code
+}
+
+func TestErrorResponses(t *testing.T) {
+	// The MCP server has exited and is not restarted
+	proxy := newFakeProxy(t, "exit", Config{})
+	exitBackend(t, proxy, 0)
+	w := postJSON(proxy, `{"jsonrpc":"2.0","id":2,"method":"ping"}`)
+	if w.Code != http.StatusServiceUnavailable || rpcErrorOf(t, w) != -32002 {
+		t.Errorf("Expected 503 with -32002 from a stopped MCP server, got %d %s", w.Code, w.Body.String())
+	}
+
+	// The proxy is closed
+	proxy.Close()
+	w = postJSON(proxy, `{"jsonrpc":"2.0","id":3,"method":"ping"}`)
+	if w.Code != http.StatusServiceUnavailable || rpcErrorOf(t, w) != -32004 {
+		t.Errorf("Expected 503 with -32004 from a closed proxy, got %d %s", w.Code, w.Body.String())
+	}
+
+	// A request times out behind one the MCP server never answers
+	proxy = newFakeProxy(t, "hang", Config{QueueTimeout: 100 * time.Millisecond})
+	go postJSON(proxy, `{"jsonrpc":"2.0","id":1,"method":"x"}`)
+	time.Sleep(50 * time.Millisecond)
+	w = postJSON(proxy, `{"jsonrpc":"2.0","id":2,"method":"x"}`)
+	if w.Code != http.StatusServiceUnavailable || rpcErrorOf(t, w) != -32001 {
+		t.Errorf("Expected 503 with -32001 from a queue timeout, got %d %s", w.Code, w.Body.String())
+	}
+
+	// Start failures are typed too
+	_, err := NewMCPProxy(Config{ServerName: "test", CommandPath: "/nonexistent/mcp-server"})
+	var backendErr *BackendError
+	if !errors.Is(err, ErrBackendUnavailable) || !errors.As(err, &backendErr) || backendErr.Err == nil {
+		t.Errorf("Expected a BackendError from a failed start, got %v", err)
+	}
+}
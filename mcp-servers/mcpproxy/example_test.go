@@ -0,0 +1,39 @@
+package mcpproxy_test
+
+import (
+	"expvar"
+	"log"
+
+	"github.com/rh-ai-kickstart/ai-architecture-charts/mcp-servers/mcpproxy"
+)
+
+// The observation hooks can feed an embedder's own metrics, here an expvar
+// map served at /debug/vars by the default mux.
+func ExampleConfig_hooks() {
+	stats := expvar.NewMap("mcp")
+
+	cfg := mcpproxy.Config{
+		ServerName:  "github-mcp",
+		CommandPath: "/usr/local/bin/github-mcp-server",
+		CommandArgs: []string{"stdio"},
+		OnRequest: func(info mcpproxy.RequestInfo) {
+			stats.Add("requests."+info.Method, 1)
+			if info.Tool != "" {
+				stats.Add("tools."+info.Tool, 1)
+			}
+		},
+		OnResponse: func(info mcpproxy.ResponseInfo) {
+			if info.Error {
+				stats.Add("errors."+info.Request.Method, 1)
+			}
+			stats.Add("responseBytes", info.Size)
+		},
+		OnBackendStateChange: func(old, new string) {
+			stats.Add("state."+new, 1)
+		},
+	}
+
+	if err := mcpproxy.Run(cfg); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,61 @@
+package mcpproxy
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// Exit reasons reported in ExitInfo.Reason and counted in
+// mcp_subprocess_exits_total.
+const (
+	ExitReasonClean    = "clean"     // exit code 0 or one of CleanExitCodes
+	ExitReasonError    = "error"     // any other exit code
+	ExitReasonSignal   = "signal"    // killed by a signal from outside the proxy
+	ExitReasonCoreDump = "core_dump" // killed by a signal and dumped core
+	ExitReasonOOM      = "oom"       // SIGKILL from outside the proxy, see classifyExit
+	ExitReasonStopped  = "stopped"   // stopped or killed by the proxy
+)
+
+// classifyExit fills in the reason, signal and description of exit from
+// state, the state of a process that has exited, or nil if it could not be
+// waited for. stopped is set if the proxy stopped or killed the process
+// itself.
+//
+// The kernel does not tell who sent a signal, so a SIGKILL that the proxy
+// did not send is taken for the out-of-memory killer, by far its most
+// likely sender for a subprocess, e.g. when a container reaches its memory
+// limit.
+func classifyExit(exit *ExitInfo, state *os.ProcessState, stopped bool) {
+	var status syscall.WaitStatus
+	if state != nil {
+		status, _ = state.Sys().(syscall.WaitStatus)
+	}
+	switch {
+	case stopped:
+		exit.Reason = ExitReasonStopped
+		exit.Description = "stopped by the proxy"
+	case status.Signaled():
+		exit.Signal = int(status.Signal())
+		switch {
+		case status.CoreDump():
+			exit.Reason = ExitReasonCoreDump
+			exit.Description = fmt.Sprintf("killed by signal %d (%v), core dumped", exit.Signal, status.Signal())
+		case status.Signal() == syscall.SIGKILL:
+			exit.Reason = ExitReasonOOM
+			exit.Description = fmt.Sprintf("killed by signal %d (%v), likely by the out-of-memory killer", exit.Signal, status.Signal())
+		default:
+			exit.Reason = ExitReasonSignal
+			exit.Description = fmt.Sprintf("killed by signal %d (%v)", exit.Signal, status.Signal())
+		}
+	case exit.Clean:
+		exit.Reason = ExitReasonClean
+		exit.Description = fmt.Sprintf("exited with code %d", exit.Code)
+	case state == nil:
+		exit.Reason = ExitReasonError
+		exit.Description = exit.Error
+	default:
+		exit.Reason = ExitReasonError
+		exit.Description = fmt.Sprintf("exited with code %d", exit.Code)
+	}
+}
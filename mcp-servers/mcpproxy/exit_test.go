@@ -0,0 +1,119 @@
+package mcpproxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// signalBackend makes the fake backend kill itself with sig, and returns
+// the response to the request that did it once the proxy has handled the
+// exit.
+func signalBackend(t *testing.T, proxy *MCPProxy, sig syscall.Signal) (*httptest.ResponseRecorder, BackendStatus) {
+	t.Helper()
+	before := proxy.Status()
+	w := postJSON(proxy, fmt.Sprintf(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"signal":%d}}`, sig))
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		status := proxy.Status()
+		if status.Restarts > before.Restarts || (status.State != StateRunning && status.State != StateRestarting) {
+			return w, status
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("MCP server exit was not handled, status: %+v", proxy.Status())
+	return nil, BackendStatus{}
+}
+
+func TestExitReasons(t *testing.T) {
+	fastRestarts(t)
+	logs := &recordingLogger{}
+	proxy := newFakeProxy(t, "exit", Config{MaxRestarts: 10, Logger: logs})
+
+	status := exitBackend(t, proxy, 2)
+	if exit := status.LastExit; exit.Reason != ExitReasonError || exit.Description != "exited with code 2" {
+		t.Errorf("Expected an error exit, got %+v", exit)
+	}
+
+	_, status = signalBackend(t, proxy, syscall.SIGTERM)
+	if exit := status.LastExit; exit.Reason != ExitReasonSignal || exit.Signal != int(syscall.SIGTERM) || exit.Clean {
+		t.Errorf("Expected a death by SIGTERM, got %+v", exit)
+	}
+
+	// A SIGKILL the proxy did not send is blamed on the OOM killer, also in
+	// the error of the request that was cut short
+	w, status := signalBackend(t, proxy, syscall.SIGKILL)
+	if exit := status.LastExit; exit.Reason != ExitReasonOOM || exit.Signal != int(syscall.SIGKILL) {
+		t.Errorf("Expected a death by the OOM killer, got %+v", exit)
+	}
+	if !strings.Contains(w.Body.String(), "likely by the out-of-memory killer") {
+		t.Errorf("Expected the request to fail with the exit reason, got %d %s", w.Code, w.Body.String())
+	}
+	waitForLog(t, logs, "reason=oom description=killed by signal 9")
+
+	// Exits the proxy causes are not blamed on the MCP server
+	if err := proxy.Restart("test"); err != nil {
+		t.Fatalf("Restart failed: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for proxy.Status().LastExit.Reason != ExitReasonStopped && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if exit := proxy.Status().LastExit; exit.Reason != ExitReasonStopped || !exit.Clean {
+		t.Errorf("Expected a restart to stop the MCP server, got %+v", exit)
+	}
+
+	w = httptest.NewRecorder()
+	proxy.metrics.handle(w, httptest.NewRequest("GET", "/metrics", nil))
+	for _, reason := range []string{ExitReasonError, ExitReasonSignal, ExitReasonOOM, ExitReasonStopped} {
+		if want := `mcp_subprocess_exits_total{server="test",reason="` + reason + `"} 1`; !strings.Contains(w.Body.String(), want) {
+			t.Errorf("Expected %s, got:\n%s", want, w.Body.String())
+		}
+	}
+}
+
+func TestExitReasonForWaitingClients(t *testing.T) {
+	proxy := newFakeProxy(t, "exit", Config{})
+
+	// The request the MCP server exited on, and those after it, are told
+	// how it exited
+	for i, body := range []string{
+		`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"exitCode":3}}`,
+		`{"jsonrpc":"2.0","id":2,"method":"tools/call"}`,
+	} {
+		w := postJSON(proxy, body)
+		var resp struct {
+			Error struct {
+				Code    int    `json:"code"`
+				Message string `json:"message"`
+				Data    struct {
+					Exit *ExitInfo `json:"exit"`
+				} `json:"data"`
+			} `json:"error"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		if resp.Error.Code != -32002 || !strings.Contains(resp.Error.Message, "MCP server exited with code 3") {
+			t.Errorf("Expected request %d to fail with the exit code, got %s", i+1, w.Body.String())
+		}
+		if exit := resp.Error.Data.Exit; exit == nil || exit.Code != 3 || exit.Reason != ExitReasonError {
+			t.Errorf("Expected request %d to carry the exit, got %s", i+1, w.Body.String())
+		}
+	}
+}
+
+func TestOOMRestartDelay(t *testing.T) {
+	fastRestarts(t)
+	logs := &recordingLogger{}
+	proxy := newFakeProxy(t, "exit", Config{MaxRestarts: 10, OOMRestartDelay: 200 * time.Millisecond, Logger: logs})
+
+	exitBackend(t, proxy, 2)
+	waitForLog(t, logs, "delay=10ms")
+
+	signalBackend(t, proxy, syscall.SIGKILL)
+	waitForLog(t, logs, "delay=200ms")
+}
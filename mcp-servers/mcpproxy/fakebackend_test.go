@@ -0,0 +1,49 @@
+package mcpproxy
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/rh-ai-kickstart/ai-architecture-charts/mcp-servers/mcpproxy/internal/fakebackend"
+)
+
+func TestMain(m *testing.M) {
+	fakebackend.RunIfRequested()
+	code := m.Run()
+	if code == 0 {
+		if leaked := leakedGoroutines(); len(leaked) > 0 {
+			fmt.Fprintf(os.Stderr, "%d goroutines leaked:\n\n%s\n", len(leaked), strings.Join(leaked, "\n\n"))
+			code = 1
+		}
+	}
+	os.Exit(code)
+}
+
+// fakeConfig returns a Config running the named fake backend.
+func fakeConfig(mode string) Config {
+	path, args := fakebackend.Command(mode)
+	return Config{
+		ServerName:  "test",
+		CommandPath: path,
+		CommandArgs: args,
+	}
+}
+
+// newFakeProxy starts a proxy backed by the named fake backend and closes it
+// when the test ends, failing it if the proxy leaves goroutines behind.
+// ServerName, CommandPath and CommandArgs are overridden.
+func newFakeProxy(t testing.TB, mode string, cfg Config) *MCPProxy {
+	t.Helper()
+	checkGoroutines(t)
+	cfg.ServerName = "test"
+	cfg.CommandPath, cfg.CommandArgs = fakebackend.Command(mode)
+
+	proxy, err := NewMCPProxy(cfg)
+	if err != nil {
+		t.Fatalf("NewMCPProxy failed: %v", err)
+	}
+	t.Cleanup(func() { proxy.Close() })
+	return proxy
+}
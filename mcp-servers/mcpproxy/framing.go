@@ -0,0 +1,452 @@
+package mcpproxy
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// errFrameTooLarge is matched by the error frameReader returns when a message
+// exceeds its size limit.
+var errFrameTooLarge = errors.New("message exceeds size limit")
+
+// maxFrameHead is how much of an oversized message frameTooLargeError keeps.
+const maxFrameHead = 4096
+
+// frameTooLargeError reports a message that exceeded the reader's limit and
+// was discarded. Head holds the start of the message so the caller can still
+// tell which request it answered.
+type frameTooLargeError struct {
+	Limit int
+	Head  []byte
+}
+
+func (e *frameTooLargeError) Error() string {
+	return fmt.Sprintf("%v of %d bytes", errFrameTooLarge, e.Limit)
+}
+
+func (e *frameTooLargeError) Is(target error) bool {
+	return target == errFrameTooLarge
+}
+
+// errMalformedFrame is matched by the errors frameReader returns for
+// Content-Length frames it could not make sense of. The reader skips ahead
+// to the next Content-Length header, so reading may go on.
+var errMalformedFrame = errors.New("malformed message frame")
+
+func malformedFrame(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", errMalformedFrame, fmt.Sprintf(format, args...))
+}
+
+// The values of Config.Framing.
+const (
+	framingDelimited     = "delimited"
+	framingContentLength = "content-length"
+)
+
+// contentLengthHeader starts the header of every Content-Length frame.
+var contentLengthHeader = []byte("content-length:")
+
+const (
+	// maxPooledFrameSize bounds the capacity of buffers returned to framePool
+	// so that one very large message does not pin memory for the lifetime of
+	// the process. Larger messages are written without composing a frame.
+	maxPooledFrameSize = 1 << 20
+
+	// maxRetainedLineSize bounds the capacity of the persistent read buffer
+	// kept between reads for the same reason.
+	maxRetainedLineSize = 8 << 20
+)
+
+// framePool holds buffers used to compose delimited frames for the MCP
+// server's stdin, so each write does not allocate a fresh copy of the
+// message.
+var framePool = sync.Pool{
+	New: func() any { return new(bytes.Buffer) },
+}
+
+// defaultDelimiter terminates messages unless Config.Delimiter is set.
+const defaultDelimiter = "\n"
+
+// frameWriter writes delimited JSON messages to the MCP server, by default
+// one per line, or with Content-Length headers.
+type frameWriter struct {
+	w             io.Writer
+	delim         []byte
+	contentLength bool
+}
+
+func newFrameWriter(w io.Writer, delim byte) *frameWriter {
+	return &frameWriter{w: w, delim: []byte{delim}}
+}
+
+// newContentLengthWriter returns a frameWriter that precedes each message
+// with a Content-Length header, as the Language Server Protocol does.
+func newContentLengthWriter(w io.Writer) *frameWriter {
+	return &frameWriter{w: w, contentLength: true}
+}
+
+// WriteFrame writes msg followed by the delimiter. Small messages are
+// composed into a pooled buffer and written in a single call; large ones are
+// written as-is followed by the delimiter to avoid copying them. msg is not
+// retained.
+func (fw *frameWriter) WriteFrame(msg []byte) error {
+	if fw.contentLength {
+		return fw.writeContentLength(msg)
+	}
+	if len(msg) >= maxPooledFrameSize {
+		if _, err := fw.w.Write(msg); err != nil {
+			return err
+		}
+		_, err := fw.w.Write(fw.delim)
+		return err
+	}
+
+	buf := framePool.Get().(*bytes.Buffer)
+	buf.Reset()
+	buf.Write(msg)
+	buf.Write(fw.delim)
+	_, err := fw.w.Write(buf.Bytes())
+	if buf.Cap() <= maxPooledFrameSize {
+		framePool.Put(buf)
+	}
+	return err
+}
+
+// writeContentLength writes msg preceded by its header, like WriteFrame.
+func (fw *frameWriter) writeContentLength(msg []byte) error {
+	header := "Content-Length: " + strconv.Itoa(len(msg)) + "\r\n\r\n"
+	if len(msg) >= maxPooledFrameSize {
+		if _, err := io.WriteString(fw.w, header); err != nil {
+			return err
+		}
+		_, err := fw.w.Write(msg)
+		return err
+	}
+
+	buf := framePool.Get().(*bytes.Buffer)
+	buf.Reset()
+	buf.WriteString(header)
+	buf.Write(msg)
+	_, err := fw.w.Write(buf.Bytes())
+	if buf.Cap() <= maxPooledFrameSize {
+		framePool.Put(buf)
+	}
+	return err
+}
+
+// WriteStream copies r to the MCP server as a single delimited frame; the
+// length of a Content-Length frame must be known up front. Raw newlines,
+// which can only occur as insignificant whitespace in valid JSON, are
+// replaced with spaces to preserve framing, and so is the delimiter. If the
+// copy fails part way, the partial frame is still terminated so the next
+// message starts on a fresh line.
+func (fw *frameWriter) WriteStream(r io.Reader) (int64, error) {
+	if fw.contentLength {
+		return 0, errors.New("messages cannot be streamed with Content-Length framing")
+	}
+	n, err := io.Copy(fw.w, &newlineStripper{r: r, delim: fw.delim[0]})
+	if _, werr := fw.w.Write(fw.delim); err == nil {
+		err = werr
+	}
+	return n, err
+}
+
+// newlineStripper replaces CR, LF and delim bytes with spaces.
+type newlineStripper struct {
+	r     io.Reader
+	delim byte
+}
+
+func (s *newlineStripper) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	for i, c := range p[:n] {
+		if c == '\n' || c == '\r' || c == s.delim {
+			p[i] = ' '
+		}
+	}
+	return n, err
+}
+
+// frameReader reads delimited JSON messages from the MCP server, reusing a
+// persistent buffer for lines that do not fit in the underlying
+// bufio.Reader. With Content-Length framing, src is set so that input can
+// be pushed back when resynchronizing.
+type frameReader struct {
+	r     *bufio.Reader
+	buf   []byte
+	limit int // maximum message size, 0 for no limit
+	delim byte
+
+	src    *pushbackReader
+	resync bool // skip to the next Content-Length header before reading
+}
+
+func newFrameReader(r io.Reader, limit int, delim byte) *frameReader {
+	return &frameReader{r: bufio.NewReader(r), limit: limit, delim: delim}
+}
+
+// newContentLengthReader returns a frameReader for messages preceded by a
+// Content-Length header, as written by newContentLengthWriter.
+func newContentLengthReader(r io.Reader, limit int) *frameReader {
+	src := &pushbackReader{r: r}
+	return &frameReader{r: bufio.NewReader(src), limit: limit, src: src}
+}
+
+// newFraming returns the writer and reader for messages exchanged with the
+// MCP server as set by cfg.
+func newFraming(cfg Config, w io.Writer, r io.Reader) (*frameWriter, *frameReader) {
+	if cfg.Framing == framingContentLength {
+		return newContentLengthWriter(w), newContentLengthReader(r, cfg.MaxResponseBytes)
+	}
+	delim := frameDelimiter(cfg)
+	return newFrameWriter(w, delim), newFrameReader(r, cfg.MaxResponseBytes, delim)
+}
+
+// ReadFrame returns the next message without its trailing delimiter.
+// The returned slice aliases internal buffers and is only valid until the
+// next call to ReadFrame; callers that hand the message to another goroutine
+// must copy it first.
+//
+// If the message exceeds the reader's limit, ReadFrame stops buffering it,
+// discards the remainder up to the next delimiter so the following message
+// is read intact, and returns a *frameTooLargeError. At most limit plus one
+// bufio buffer's worth of bytes is held.
+func (fr *frameReader) ReadFrame() ([]byte, error) {
+	if cap(fr.buf) > maxRetainedLineSize {
+		fr.buf = nil
+	}
+	fr.buf = fr.buf[:0]
+	if fr.src != nil {
+		return fr.readContentLength()
+	}
+	for {
+		chunk, err := fr.r.ReadSlice(fr.delim)
+		switch err {
+		case nil:
+			chunk = chunk[:len(chunk)-1]
+			if fr.limit > 0 && len(fr.buf)+len(chunk) > fr.limit {
+				return nil, fr.tooLarge(chunk, false)
+			}
+			if len(fr.buf) == 0 {
+				// Common case: the whole line fit in the bufio buffer.
+				return chunk, nil
+			}
+			fr.buf = append(fr.buf, chunk...)
+			return fr.buf, nil
+		case bufio.ErrBufferFull:
+			if fr.limit > 0 && len(fr.buf)+len(chunk) > fr.limit {
+				return nil, fr.tooLarge(chunk, true)
+			}
+			fr.buf = append(fr.buf, chunk...)
+		default:
+			return nil, err
+		}
+	}
+}
+
+// tooLarge builds the error for an oversized message whose latest chunk has
+// just been read, discarding the rest of the message if more remains.
+func (fr *frameReader) tooLarge(chunk []byte, more bool) error {
+	head := make([]byte, 0, maxFrameHead)
+	head = append(head, fr.buf[:min(len(fr.buf), maxFrameHead)]...)
+	head = append(head, chunk[:min(len(chunk), maxFrameHead-len(head))]...)
+	err := &frameTooLargeError{Limit: fr.limit, Head: head}
+	fr.buf = fr.buf[:0]
+
+	if more {
+		if discardErr := fr.discardFrame(); discardErr != nil {
+			return discardErr
+		}
+	}
+	return err
+}
+
+// discardFrame skips input up to and including the next delimiter without
+// buffering it.
+func (fr *frameReader) discardFrame() error {
+	for {
+		_, err := fr.r.ReadSlice(fr.delim)
+		if err != bufio.ErrBufferFull {
+			return err
+		}
+	}
+}
+
+// readContentLength is ReadFrame for Content-Length frames. An oversized
+// message is discarded by its declared length. A frame with a bad header,
+// or whose body turns out to hold the header of the next frame because it
+// was cut short, is reported with an error matching errMalformedFrame, and
+// the next read starts at the next Content-Length header.
+func (fr *frameReader) readContentLength() ([]byte, error) {
+	if fr.resync {
+		if err := fr.skipToHeader(); err != nil {
+			return nil, err
+		}
+		fr.resync = false
+	}
+
+	length, err := fr.readHeader()
+	if err != nil {
+		if errors.Is(err, errMalformedFrame) {
+			fr.resync = true
+		}
+		return nil, err
+	}
+
+	if fr.limit > 0 && length > fr.limit {
+		head := make([]byte, min(length, maxFrameHead))
+		if _, err := io.ReadFull(fr.r, head); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		if _, err := fr.r.Discard(length - len(head)); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		return nil, &frameTooLargeError{Limit: fr.limit, Head: head}
+	}
+
+	if cap(fr.buf) < length {
+		fr.buf = make([]byte, length)
+	}
+	body := fr.buf[:length]
+	if _, err := io.ReadFull(fr.r, body); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	// Only a body holding a header needs the costlier check that it is JSON.
+	if i := indexHeader(body); i >= 0 && !json.Valid(body) {
+		fr.pushBack(body[i:])
+		return nil, malformedFrame("message of %d bytes cut short by the next frame", i)
+	}
+	return body, nil
+}
+
+// readHeader reads the header of a frame, skipping blank lines before it,
+// and returns its Content-Length.
+func (fr *frameReader) readHeader() (int, error) {
+	length, lines := -1, 0
+	for {
+		line, err := fr.r.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			return 0, malformedFrame("header line too long")
+		} else if err != nil {
+			if lines > 0 || len(line) > 0 {
+				err = unexpectedEOF(err)
+			}
+			return 0, err
+		}
+		line = bytes.TrimRight(line, "\r\n")
+		if len(line) == 0 {
+			if lines == 0 {
+				continue
+			}
+			if length < 0 {
+				return 0, malformedFrame("missing Content-Length header")
+			}
+			return length, nil
+		}
+		lines++
+		name, value, ok := bytes.Cut(line, []byte(":"))
+		if !ok {
+			return 0, malformedFrame("invalid header %q", truncateUTF8(string(line), 64))
+		}
+		if strings.EqualFold(string(bytes.TrimSpace(name)), "Content-Length") {
+			n, err := strconv.Atoi(string(bytes.TrimSpace(value)))
+			if err != nil || n < 0 {
+				return 0, malformedFrame("invalid Content-Length %q", truncateUTF8(string(value), 64))
+			}
+			length = n
+		}
+	}
+}
+
+// skipToHeader discards input up to the next Content-Length header.
+func (fr *frameReader) skipToHeader() error {
+	for {
+		line, err := fr.r.ReadSlice('\n')
+		if i := indexHeader(line); i >= 0 {
+			fr.pushBack(line[i:])
+			return nil
+		}
+		if err != nil && err != bufio.ErrBufferFull {
+			return err
+		}
+	}
+}
+
+// pushBack arranges for b to be read again, ahead of what is buffered.
+func (fr *frameReader) pushBack(b []byte) {
+	buffered, _ := fr.r.Peek(fr.r.Buffered())
+	pending := make([]byte, 0, len(b)+len(buffered)+len(fr.src.pending))
+	pending = append(pending, b...)
+	pending = append(pending, buffered...)
+	fr.src.pending = append(pending, fr.src.pending...)
+	fr.r.Reset(fr.src)
+}
+
+// indexHeader returns the index of the first Content-Length header in b, or
+// -1 if there is none.
+func indexHeader(b []byte) int {
+	for i := 0; i+len(contentLengthHeader) <= len(b); i++ {
+		if (b[i] == 'C' || b[i] == 'c') && bytes.EqualFold(b[i:i+len(contentLengthHeader)], contentLengthHeader) {
+			return i
+		}
+	}
+	return -1
+}
+
+// unexpectedEOF reports io.EOF in the middle of a frame as
+// io.ErrUnexpectedEOF.
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// pushbackReader reads pending before r.
+type pushbackReader struct {
+	r       io.Reader
+	pending []byte
+}
+
+func (p *pushbackReader) Read(b []byte) (int, error) {
+	if len(p.pending) > 0 {
+		n := copy(b, p.pending)
+		p.pending = p.pending[n:]
+		return n, nil
+	}
+	return p.r.Read(b)
+}
+
+// frameDelimiter returns the byte that terminates messages for cfg.
+func frameDelimiter(cfg Config) byte {
+	if cfg.Delimiter == "" {
+		return defaultDelimiter[0]
+	}
+	return cfg.Delimiter[0]
+}
+
+// validateFraming checks cfg.Framing.
+func validateFraming(cfg Config) error {
+	switch cfg.Framing {
+	case "", framingDelimited, framingContentLength:
+		return nil
+	}
+	return fmt.Errorf("invalid Framing %q: expected %q or %q", cfg.Framing, framingDelimited, framingContentLength)
+}
+
+// validateDelimiter checks that cfg.Delimiter is a single control character
+// that cannot be mistaken for part of a JSON message.
+func validateDelimiter(cfg Config) error {
+	d := cfg.Delimiter
+	if len(d) != 1 || d[0] >= 0x20 || d[0] == '\t' || d[0] == '\r' {
+		return fmt.Errorf("invalid Delimiter %q: expected a single control character such as \"\\n\" or \"\\x00\"", d)
+	}
+	return nil
+}
@@ -0,0 +1,361 @@
+package mcpproxy
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestFrameWriter(t *testing.T) {
+	var out bytes.Buffer
+	fw := newFrameWriter(&out, '\n')
+
+	if err := fw.WriteFrame([]byte(`{"id":1}`)); err != nil {
+		t.Fatalf("WriteFrame failed: %v", err)
+	}
+	if err := fw.WriteFrame([]byte(`{"id":2}`)); err != nil {
+		t.Fatalf("WriteFrame failed: %v", err)
+	}
+
+	if out.String() != "{\"id\":1}\n{\"id\":2}\n" {
+		t.Errorf("Unexpected frames: %q", out.String())
+	}
+}
+
+func TestFrameReader(t *testing.T) {
+	long := `{"data":"` + strings.Repeat("x", 3*4096) + `"}`
+	input := "{\"id\":1}\n" + long + "\n{\"id\":2}\n"
+	fr := newFrameReader(strings.NewReader(input), 0, '\n')
+
+	for _, want := range []string{`{"id":1}`, long, `{"id":2}`} {
+		got, err := fr.ReadFrame()
+		if err != nil {
+			t.Fatalf("ReadFrame failed: %v", err)
+		}
+		if string(got) != want {
+			t.Errorf("ReadFrame returned %d bytes, want %d", len(got), len(want))
+		}
+	}
+
+	if _, err := fr.ReadFrame(); err != io.EOF {
+		t.Errorf("Expected io.EOF at end of stream, got %v", err)
+	}
+}
+
+func TestNULFraming(t *testing.T) {
+	var out bytes.Buffer
+	fw := newFrameWriter(&out, 0)
+	fw.WriteFrame([]byte(`{"id":1}`))
+	fw.WriteStream(strings.NewReader("{\"id\":2,\n\"x\":\"\x00\"}"))
+	if want := "{\"id\":1}\x00{\"id\":2, \"x\":\" \"}\x00"; out.String() != want {
+		t.Errorf("Expected frames %q, got %q", want, out.String())
+	}
+
+	// Newlines within a frame are kept
+	fr := newFrameReader(strings.NewReader("{\"id\":1}\x00{\n\"id\":2}\n\x00"), 0, 0)
+	for _, want := range []string{`{"id":1}`, "{\n\"id\":2}\n"} {
+		got, err := fr.ReadFrame()
+		if err != nil || string(got) != want {
+			t.Errorf("Expected frame %q, got %q %v", want, got, err)
+		}
+	}
+
+	// End to end with a server that frames with NUL
+	proxy := newFakeProxy(t, "nul", Config{Delimiter: "\x00"})
+	w := postJSON(proxy, `{"jsonrpc":"2.0","id":7,"method":"tools/list"}`)
+	if !strings.Contains(w.Body.String(), `"id":7`) || !strings.Contains(w.Body.String(), `"size":`) {
+		t.Errorf("Unexpected response %d %s", w.Code, w.Body.String())
+	}
+
+	for _, delim := range []string{"ab", " ", "\t", "{"} {
+		if _, err := NewMCPProxy(Config{ServerName: "test", CommandPath: "cat", Delimiter: delim}); err == nil {
+			t.Errorf("Expected Delimiter %q to be rejected", delim)
+		}
+	}
+}
+
+func TestFrameReaderPartialLine(t *testing.T) {
+	fr := newFrameReader(strings.NewReader(`{"id":1}`), 0, '\n')
+	if _, err := fr.ReadFrame(); err == nil {
+		t.Error("Expected error for unterminated frame")
+	}
+}
+
+func TestFrameReaderLimitResynchronizes(t *testing.T) {
+	long := `{"jsonrpc":"2.0","id":2,"result":{"data":"` + strings.Repeat("x", 10000) + `"}}`
+	input := "{\"id\":1}\n" + long + "\n{\"id\":3}\n"
+	fr := newFrameReader(strings.NewReader(input), 5000, '\n')
+
+	if got, err := fr.ReadFrame(); err != nil || string(got) != `{"id":1}` {
+		t.Fatalf("Expected first frame within limit, got %q, %v", got, err)
+	}
+
+	_, err := fr.ReadFrame()
+	var tooLarge *frameTooLargeError
+	if !errors.As(err, &tooLarge) || !errors.Is(err, errFrameTooLarge) {
+		t.Fatalf("Expected frameTooLargeError, got %v", err)
+	}
+	if !strings.HasPrefix(long, string(tooLarge.Head)) || len(tooLarge.Head) > maxFrameHead {
+		t.Errorf("Expected head to be a bounded prefix of the message, got %d bytes", len(tooLarge.Head))
+	}
+	if len(fr.buf) != 0 || cap(fr.buf) > 5000+4096 {
+		t.Errorf("Expected buffered data to stay bounded, cap is %d", cap(fr.buf))
+	}
+
+	// The remainder of the oversized message is skipped
+	if got, err := fr.ReadFrame(); err != nil || string(got) != `{"id":3}` {
+		t.Errorf("Expected to resynchronize on the next frame, got %q, %v", got, err)
+	}
+}
+
+func TestFrameReaderLimitAtDelimiter(t *testing.T) {
+	// A message that fits in the bufio buffer but exceeds the limit
+	input := strings.Repeat("x", 100) + "\n{\"id\":2}\n"
+	fr := newFrameReader(strings.NewReader(input), 50, '\n')
+
+	if _, err := fr.ReadFrame(); !errors.Is(err, errFrameTooLarge) {
+		t.Fatalf("Expected errFrameTooLarge, got %v", err)
+	}
+	if got, err := fr.ReadFrame(); err != nil || string(got) != `{"id":2}` {
+		t.Errorf("Expected next frame intact, got %q, %v", got, err)
+	}
+}
+
+func TestFrameReaderLimitTruncatedStream(t *testing.T) {
+	fr := newFrameReader(strings.NewReader(strings.Repeat("x", 10000)), 5000, '\n')
+	if _, err := fr.ReadFrame(); err != io.EOF {
+		t.Errorf("Expected io.EOF for oversized unterminated frame, got %v", err)
+	}
+}
+
+func TestCopyMessageDoesNotAlias(t *testing.T) {
+	fr := newFrameReader(strings.NewReader("{\"id\":1}\n{\"id\":2}\n"), 0, '\n')
+	first, _ := fr.ReadFrame()
+	kept := copyMessage(first)
+	fr.ReadFrame()
+
+	if string(kept) != `{"id":1}` {
+		t.Errorf("Copied message changed after next read: %q", kept)
+	}
+}
+
+// benchmarkSizes are the message sizes used by the framing benchmarks.
+var benchmarkSizes = []int{1 << 10, 64 << 10, 1 << 20}
+
+func benchmarkMessage(size int) []byte {
+	prefix := `{"jsonrpc":"2.0","id":1,"result":{"data":"`
+	suffix := `"}}`
+	return []byte(prefix + strings.Repeat("x", size-len(prefix)-len(suffix)) + suffix)
+}
+
+// BenchmarkWriteFrame compares the previous append-based write path
+// ("append") with the pooled frameWriter ("pooled").
+func BenchmarkWriteFrame(b *testing.B) {
+	for _, size := range benchmarkSizes {
+		msg := benchmarkMessage(size)
+
+		b.Run(fmt.Sprintf("append/%d", size), func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(size))
+			for i := 0; i < b.N; i++ {
+				// Clip so append always copies, as it did for decoded bodies.
+				io.Discard.Write(append(msg[:len(msg):len(msg)], '\n'))
+			}
+		})
+
+		b.Run(fmt.Sprintf("pooled/%d", size), func(b *testing.B) {
+			fw := newFrameWriter(io.Discard, '\n')
+			b.ReportAllocs()
+			b.SetBytes(int64(size))
+			for i := 0; i < b.N; i++ {
+				fw.WriteFrame(msg)
+			}
+		})
+	}
+}
+
+// BenchmarkReadFrame compares the previous ReadBytes-based read path
+// ("readbytes"), which handed its result on without a further copy, with
+// bufio.Reader.ReadSlice followed by that copy ("readslice") and the
+// frameReader built on it ("reused").
+func BenchmarkReadFrame(b *testing.B) {
+	for _, size := range benchmarkSizes {
+		frame := append(benchmarkMessage(size), '\n')
+		const framesPerStream = 16
+		stream := bytes.Repeat(frame, framesPerStream)
+
+		b.Run(fmt.Sprintf("readbytes/%d", size), func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(size))
+			r := bufio.NewReader(bytes.NewReader(stream))
+			for i := 0; i < b.N; i++ {
+				if i%framesPerStream == 0 {
+					r.Reset(bytes.NewReader(stream))
+				}
+				r.ReadBytes('\n')
+			}
+		})
+
+		b.Run(fmt.Sprintf("readslice/%d", size), func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(size))
+			r := bufio.NewReaderSize(bytes.NewReader(stream), len(frame))
+			for i := 0; i < b.N; i++ {
+				if i%framesPerStream == 0 {
+					r.Reset(bytes.NewReader(stream))
+				}
+				line, _ := r.ReadSlice('\n')
+				_ = copyMessage(line[:len(line)-1])
+			}
+		})
+
+		b.Run(fmt.Sprintf("reused/%d", size), func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(size))
+			fr := newFrameReader(bytes.NewReader(stream), 0, '\n')
+			for i := 0; i < b.N; i++ {
+				if i%framesPerStream == 0 {
+					fr.r.Reset(bytes.NewReader(stream))
+				}
+				line, _ := fr.ReadFrame()
+				_ = copyMessage(line)
+			}
+		})
+	}
+}
+
+// BenchmarkRoundTrip measures a full HTTP round trip through the proxy with
+// cat as the MCP server, which echoes each request back as its response.
+func BenchmarkRoundTrip(b *testing.B) {
+	// Sizes stay below the pipe buffer: cat echoes while the proxy is still
+	// writing, which a real MCP server would not do.
+	for _, size := range []int{1 << 10, 16 << 10} {
+		b.Run(fmt.Sprintf("%d", size), func(b *testing.B) {
+			proxy, err := NewMCPProxy(Config{ServerName: "bench", CommandPath: "cat"})
+			if err != nil {
+				b.Fatalf("NewMCPProxy failed: %v", err)
+			}
+			defer proxy.Close()
+
+			body := benchmarkMessage(size)
+			b.ReportAllocs()
+			b.SetBytes(int64(size))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				req := httptest.NewRequest("POST", "/", bytes.NewReader(body))
+				w := httptest.NewRecorder()
+				proxy.Handle(w, req)
+				if w.Code != http.StatusOK {
+					b.Fatalf("Unexpected status %d", w.Code)
+				}
+			}
+		})
+	}
+}
+
+// contentLengthFrame returns body framed with a Content-Length header.
+func contentLengthFrame(body string) string {
+	return fmt.Sprintf("Content-Length: %d\r\n\r\n%s", len(body), body)
+}
+
+func TestContentLengthRoundTrip(t *testing.T) {
+	var out bytes.Buffer
+	fw := newContentLengthWriter(&out)
+	large := `{"data":"` + strings.Repeat("x", maxPooledFrameSize) + `"}`
+	for _, msg := range []string{`{"id":1}`, large} {
+		if err := fw.WriteFrame([]byte(msg)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want := contentLengthFrame(`{"id":1}`); !strings.HasPrefix(out.String(), want) {
+		t.Errorf("Expected %q first, got %.40q", want, out.String())
+	}
+
+	// Other headers, lowercase names and blank lines between frames are
+	// accepted
+	input := "content-length: 8\r\nContent-Type: application/json\r\n\r\n{\"id\":0}\r\n" + out.String()
+	fr := newContentLengthReader(strings.NewReader(input), 0)
+	for _, want := range []string{`{"id":0}`, `{"id":1}`, large} {
+		if got, err := fr.ReadFrame(); err != nil || string(got) != want {
+			t.Errorf("Expected frame %.40q, got %.40q, %v", want, got, err)
+		}
+	}
+	if _, err := fr.ReadFrame(); err != io.EOF {
+		t.Errorf("Expected io.EOF at the end, got %v", err)
+	}
+
+	if _, err := fw.WriteStream(strings.NewReader(`{}`)); err == nil {
+		t.Error("Expected WriteStream to fail with Content-Length framing")
+	}
+}
+
+func TestContentLengthResynchronizes(t *testing.T) {
+	valid := `{"jsonrpc":"2.0","id":9,"result":{}}`
+	long := `{"jsonrpc":"2.0","id":2,"result":{"data":"` + strings.Repeat("x", 10000) + `"}}`
+	for _, tt := range []struct {
+		name    string
+		garbage string
+		want    error
+	}{
+		{"bad length", "Content-Length: many\r\n\r\n{\"id\":1}", errMalformedFrame},
+		{"negative length", "Content-Length: -3\r\n\r\n{}", errMalformedFrame},
+		{"no colon", "Content-Length 8\r\n\r\n{\"id\":1}\n", errMalformedFrame},
+		{"missing length", "Content-Type: application/json\r\n\r\n{\"id\":1}", errMalformedFrame},
+		{"header too long", "X-Padding: " + strings.Repeat("x", 5000) + "\r\n", errMalformedFrame},
+		{"truncated body", "Content-Length: 60\r\n\r\n{\"jsonrpc\":\"2.0\",\"id\":1,\"res", errMalformedFrame},
+		{"oversized", contentLengthFrame(long), errFrameTooLarge},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			input := tt.garbage + contentLengthFrame(valid) + contentLengthFrame(`{"id":10}`)
+			fr := newContentLengthReader(strings.NewReader(input), 5000)
+
+			if _, err := fr.ReadFrame(); !errors.Is(err, tt.want) {
+				t.Fatalf("Expected %v, got %v", tt.want, err)
+			}
+			for _, want := range []string{valid, `{"id":10}`} {
+				if got, err := fr.ReadFrame(); err != nil || string(got) != want {
+					t.Errorf("Expected to resynchronize on %q, got %q, %v", want, got, err)
+				}
+			}
+		})
+	}
+
+	// The head of an oversized message is kept, and only its declared length
+	// is skipped
+	fr := newContentLengthReader(strings.NewReader(contentLengthFrame(long)+contentLengthFrame(valid)), 5000)
+	_, err := fr.ReadFrame()
+	var tooLarge *frameTooLargeError
+	if !errors.As(err, &tooLarge) || !strings.HasPrefix(long, string(tooLarge.Head)) || len(tooLarge.Head) != maxFrameHead {
+		t.Fatalf("Expected frameTooLargeError with a bounded head, got %v", err)
+	}
+
+	// A body cut short by the end of input is not malformed
+	fr = newContentLengthReader(strings.NewReader("Content-Length: 60\r\n\r\n{\"id\":"), 0)
+	if _, err := fr.ReadFrame(); err != io.ErrUnexpectedEOF {
+		t.Errorf("Expected io.ErrUnexpectedEOF, got %v", err)
+	}
+}
+
+func TestContentLengthFraming(t *testing.T) {
+	proxy := newFakeProxy(t, "content-length", Config{Framing: "content-length", StreamThreshold: 1})
+	if proxy.canStream(proxy.dynamic.Load()) {
+		t.Error("Expected streaming to be disabled with Content-Length framing")
+	}
+	// Every response is preceded by a malformed frame, which is skipped
+	for id := 1; id <= 2; id++ {
+		w := postJSON(proxy, fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":"tools/list"}`, id))
+		if !strings.Contains(w.Body.String(), fmt.Sprintf(`"id":%d`, id)) || !strings.Contains(w.Body.String(), `"size":`) {
+			t.Errorf("Unexpected response %d %s", w.Code, w.Body.String())
+		}
+	}
+
+	if _, err := NewMCPProxy(Config{ServerName: "test", CommandPath: "cat", Framing: "lsp"}); err == nil {
+		t.Error("Expected Framing \"lsp\" to be rejected")
+	}
+}
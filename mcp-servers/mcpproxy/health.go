@@ -0,0 +1,83 @@
+package mcpproxy
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// healthCheckTimeout bounds a HealthCheck request.
+const healthCheckTimeout = 3 * time.Second
+
+// handleHealthz serves GET /healthz, a liveness check: it fails only once
+// the MCP server is down for good, or the proxy can no longer dispatch
+// requests to it, since restarting the proxy is then the only way to
+// recover.
+func (p *MCPProxy) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	if p.dispatcherStopped.Load() {
+		http.Error(w, "Request dispatcher stopped", http.StatusServiceUnavailable)
+		return
+	}
+	switch state := p.Status().State; state {
+	case StateExited, StateFailed, StateStopped:
+		http.Error(w, "MCP server is "+state, http.StatusServiceUnavailable)
+	default:
+		fmt.Fprintln(w, "ok")
+	}
+}
+
+// handleReadyz serves GET /readyz, a readiness check: it succeeds only
+// while the MCP server is running, or with LazyStart, until it first starts,
+// and Config.ReadinessCheck passes.
+func (p *MCPProxy) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	if p.dispatcherStopped.Load() {
+		http.Error(w, "Request dispatcher stopped", http.StatusServiceUnavailable)
+		return
+	}
+	state := p.Status().State
+	if state != StateRunning && state != StateIdle && state != StateStarting {
+		http.Error(w, "MCP server is "+state, http.StatusServiceUnavailable)
+		return
+	}
+	if check := p.config.ReadinessCheck; check != nil {
+		if err := check(); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+	}
+	fmt.Fprintln(w, "ready")
+}
+
+// HealthCheck queries path ("/healthz" or "/readyz") on the proxy that cfg
+// describes, listening on localhost, and returns an error describing why it
+// is unhealthy. It is meant for container HEALTHCHECK commands, which cannot
+// rely on curl being installed.
+func HealthCheck(cfg Config, path string) error {
+	cfg, err := resolveConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodGet, "http://127.0.0.1:"+cfg.Port+path, nil)
+	if err != nil {
+		return err
+	}
+	if cfg.AuthToken != "" {
+		req.Header.Set("Authorization", "Bearer "+cfg.AuthToken)
+	}
+
+	client := &http.Client{Timeout: healthCheckTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s returned %s: %s", path, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
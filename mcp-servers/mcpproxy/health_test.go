@@ -0,0 +1,78 @@
+package mcpproxy
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestHealthCheck(t *testing.T) {
+	proxy := newFakeProxy(t, "exit", Config{AuthToken: "s3cret"})
+	server := httptest.NewServer(proxy.Handler())
+	defer server.Close()
+
+	u, _ := url.Parse(server.URL)
+	cfg := Config{Port: u.Port(), AuthToken: "s3cret"}
+
+	for _, path := range []string{"/healthz", "/readyz"} {
+		if err := HealthCheck(cfg, path); err != nil {
+			t.Errorf("Expected %s to pass, got %v", path, err)
+		}
+	}
+
+	// Without restarts the exited server makes both checks fail
+	exitBackend(t, proxy, 1)
+	for _, path := range []string{"/healthz", "/readyz"} {
+		err := HealthCheck(cfg, path)
+		if err == nil || !strings.Contains(err.Error(), "503 Service Unavailable: MCP server is exited") {
+			t.Errorf("Expected %s to report the exited server, got %v", path, err)
+		}
+	}
+
+	server.Close()
+	if err := HealthCheck(cfg, "/healthz"); err == nil {
+		t.Error("Expected an error with no proxy listening")
+	}
+}
+
+func TestReadinessCheck(t *testing.T) {
+	var err error
+	proxy := newFakeProxy(t, "exit", Config{ReadinessCheck: func() error { return err }})
+
+	w := httptest.NewRecorder()
+	proxy.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/readyz", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected /readyz to pass, got %d", w.Code)
+	}
+
+	err = errors.New("wallet directory /wallet does not exist")
+	w = httptest.NewRecorder()
+	proxy.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/readyz", nil))
+	if w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), "wallet directory /wallet does not exist") {
+		t.Errorf("Expected /readyz to fail with the check's reason, got %d %s", w.Code, w.Body.String())
+	}
+	w = httptest.NewRecorder()
+	proxy.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/healthz", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected /healthz to ignore the readiness check, got %d", w.Code)
+	}
+}
+
+func TestReadyzWhileRestarting(t *testing.T) {
+	proxy := newFakeProxy(t, "exit", Config{})
+	proxy.setState(StateRestarting)
+
+	w := httptest.NewRecorder()
+	proxy.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/readyz", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected /readyz to fail while restarting, got %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	proxy.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/healthz", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected /healthz to pass while restarting, got %d", w.Code)
+	}
+}
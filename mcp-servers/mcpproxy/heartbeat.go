@@ -0,0 +1,57 @@
+package mcpproxy
+
+import (
+	"io"
+	"net/http"
+	"time"
+)
+
+// idleTimer fires on c once an event stream has been silent for
+// Config.SSEInactivityTimeout. c is nil, and never fires, without one.
+type idleTimer struct {
+	c       <-chan time.Time
+	ticker  *time.Ticker
+	timeout time.Duration
+}
+
+func (p *MCPProxy) newIdleTimer() *idleTimer {
+	t := &idleTimer{timeout: p.config.SSEInactivityTimeout}
+	if t.timeout > 0 {
+		t.ticker = time.NewTicker(t.timeout)
+		t.c = t.ticker.C
+	}
+	return t
+}
+
+// wrote notes that something was written to the stream, which is then not
+// silent for another timeout.
+func (t *idleTimer) wrote() {
+	if t.ticker != nil {
+		t.ticker.Reset(t.timeout)
+	}
+}
+
+func (t *idleTimer) stop() {
+	if t.ticker != nil {
+		t.ticker.Stop()
+	}
+}
+
+// heartbeat writes an SSE comment to the event stream w of r, which has
+// been silent for Config.SSEInactivityTimeout, and reports whether the
+// client is still there: the write must succeed within the timeout.
+func (p *MCPProxy) heartbeat(w http.ResponseWriter, r *http.Request) bool {
+	rc := http.NewResponseController(w)
+	rc.SetWriteDeadline(time.Now().Add(p.config.SSEInactivityTimeout))
+	defer rc.SetWriteDeadline(time.Time{})
+
+	_, err := io.WriteString(w, ": heartbeat\n\n")
+	if err == nil {
+		err = rc.Flush()
+	}
+	if err != nil {
+		p.logFor(r).Info("Closing event stream, the client is gone", "remote", r.RemoteAddr, "identity", identity(r), "error", err)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,87 @@
+package mcpproxy
+
+import (
+	"bufio"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSSEHeartbeat(t *testing.T) {
+	proxy := newFakeProxy(t, "reflect", Config{EnableNotificationStream: true, LegacySSECompat: true, SSEInactivityTimeout: 20 * time.Millisecond})
+	server := httptest.NewServer(proxy.Handler())
+	defer server.Close()
+
+	for _, path := range []string{"/", "/sse"} {
+		req, _ := http.NewRequest("GET", server.URL+path, nil)
+		req.Header.Set("Accept", "text/event-stream")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		line, err := bufio.NewReader(resp.Body).ReadString('\n')
+		resp.Body.Close()
+		if err != nil || line != ": heartbeat\n" {
+			t.Errorf("Expected a heartbeat on %s, got %q %v", path, line, err)
+		}
+	}
+}
+
+// deadPeerWriter is the ResponseWriter of a stream whose client went away
+// without closing the connection: writes succeed until dead is set, and
+// fail after that.
+type deadPeerWriter struct {
+	header http.Header
+	dead   atomic.Bool
+	writes atomic.Int64
+}
+
+func (w *deadPeerWriter) Header() http.Header { return w.header }
+func (w *deadPeerWriter) WriteHeader(int)     {}
+func (w *deadPeerWriter) Flush()              {}
+
+func (w *deadPeerWriter) Write(b []byte) (int, error) {
+	if w.dead.Load() {
+		return 0, errors.New("connection timed out")
+	}
+	w.writes.Add(1)
+	return len(b), nil
+}
+
+func TestSSEHeartbeatClosesDeadStream(t *testing.T) {
+	logs := &recordingLogger{}
+	proxy := newFakeProxy(t, "reflect", Config{EnableNotificationStream: true, SSEInactivityTimeout: 20 * time.Millisecond, Logger: logs})
+
+	// The request's context is never done, as the connection looks open
+	w := &deadPeerWriter{header: make(http.Header)}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		proxy.handleNotificationStream(w, httptest.NewRequest("GET", "/", nil))
+	}()
+
+	// Heartbeats keep a live stream open
+	deadline := time.Now().Add(5 * time.Second)
+	for w.writes.Load() < 3 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	select {
+	case <-done:
+		t.Fatal("Expected the stream to stay open while the client is there")
+	default:
+	}
+
+	w.dead.Store(true)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the stream to be closed once the client is gone")
+	}
+	waitForLog(t, logs, "Closing event stream, the client is gone")
+	if proxy.notifications.active() {
+		t.Error("Expected no notification stream left")
+	}
+}
@@ -0,0 +1,133 @@
+package mcpproxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// RequestInfo describes a JSON-RPC message received from a client, as
+// passed to Config.OnRequest. It carries no payload.
+type RequestInfo struct {
+	Method   string
+	Tool     string // the tool name of tools/call requests
+	ID       string // the JSON-encoded id, "" for notifications
+	Identity string // see IdentityFromContext
+	Size     int64  // body size in bytes, -1 if streamed with unknown length
+	Streamed bool   // the body was streamed to the MCP server
+}
+
+// ResponseInfo describes the outcome of a client message, as passed to
+// Config.OnResponse.
+type ResponseInfo struct {
+	Request  RequestInfo
+	Status   int           // HTTP status
+	Size     int64         // response body size in bytes
+	Duration time.Duration // from receiving the message to the response
+	Error    bool          // a JSON-RPC error or an HTTP error status
+}
+
+// observedWriter records what is written for ResponseInfo.
+type observedWriter struct {
+	statusRecorder
+	size     int64
+	rpcError bool
+}
+
+func (o *observedWriter) Write(b []byte) (int, error) {
+	n, err := o.statusRecorder.Write(b)
+	o.size += int64(n)
+	return n, err
+}
+
+// markRPCError notes that w carries a JSON-RPC error response, if w is
+// observed.
+func markRPCError(w http.ResponseWriter, response json.RawMessage) {
+	if o, ok := w.(*observedWriter); ok {
+		_, o.rpcError = rpcErrorCode(response)
+	}
+}
+
+// observe calls Config.OnRequest with the RequestInfo returned by describe,
+// and returns the writer to send the response through and a function to
+// call once it has been sent, which calls Config.OnResponse. Both calls
+// also record the message sizes, see observeSize.
+func (p *MCPProxy) observe(w http.ResponseWriter, describe func() RequestInfo) (http.ResponseWriter, func()) {
+	start := time.Now()
+	info := describe()
+	p.observeSize("request", p.metrics.requestSize, info, info.Size)
+	if p.config.OnRequest != nil {
+		p.runHook("OnRequest", func() { p.config.OnRequest(info) })
+	}
+
+	o := &observedWriter{statusRecorder: statusRecorder{ResponseWriter: w}}
+	return o, func() {
+		p.observeSize("response", p.metrics.responseSize, info, o.size)
+		if p.config.OnResponse == nil {
+			return
+		}
+		status := o.statusCode()
+		resp := ResponseInfo{
+			Request:  info,
+			Status:   status,
+			Size:     o.size,
+			Duration: time.Since(start),
+			Error:    o.rpcError || status >= http.StatusBadRequest,
+		}
+		p.runHook("OnResponse", func() { p.config.OnResponse(resp) })
+	}
+}
+
+// observeSize records the size of a message, the request or the response
+// described by info, in histogram, and warns of one over
+// Config.SizeWarnBytes. Streamed requests of unknown length are skipped.
+// Sizes are only measured by observe, so that each message counts once.
+func (p *MCPProxy) observeSize(kind string, histogram *metricFamily, info RequestInfo, size int64) {
+	if size < 0 || (kind == "response" && size == 0) {
+		return
+	}
+	histogram.Observe(float64(size), info.Method, info.Tool)
+	if limit := p.config.SizeWarnBytes; limit > 0 && size > limit {
+		p.log.Warn("Message exceeds SizeWarnBytes", "message", kind, "method", info.Method, "tool", info.Tool,
+			"identity", info.Identity, "bytes", size, "limit", limit)
+	}
+}
+
+// stateChanged updates the metrics of the MCP server and calls
+// Config.OnBackendStateChange. It must not be called with backendMu held.
+func (p *MCPProxy) stateChanged(old, new string) {
+	p.observeBackend()
+	if p.config.OnBackendStateChange != nil && old != new {
+		p.runHook("OnBackendStateChange", func() { p.config.OnBackendStateChange(old, new) })
+	}
+}
+
+// runHook calls a Config hook, logging instead of crashing if it panics.
+func (p *MCPProxy) runHook(name string, hook func()) {
+	defer func() {
+		if v := recover(); v != nil {
+			p.log.Error("Hook panicked", "hook", name, "panic", v)
+		}
+	}()
+	hook()
+}
+
+// requestInfo describes a buffered client message for the hooks.
+func requestInfo(r *http.Request, msg json.RawMessage, mcpMsg MCPMessage) RequestInfo {
+	info := RequestInfo{
+		Method:   mcpMsg.Method,
+		ID:       formatID(mcpMsg.ID),
+		Identity: identity(r),
+		Size:     int64(len(msg)),
+	}
+	if mcpMsg.Method == "tools/call" {
+		var call struct {
+			Params struct {
+				Name string `json:"name"`
+			} `json:"params"`
+		}
+		json.Unmarshal(msg, &call)
+		info.Tool = call.Params.Name
+	}
+	return info
+}
@@ -0,0 +1,102 @@
+package mcpproxy
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRequestHooks(t *testing.T) {
+	var mu sync.Mutex
+	var requests []RequestInfo
+	var responses []ResponseInfo
+	proxy := newFakeProxy(t, "mcp", Config{
+		OnRequest: func(info RequestInfo) {
+			mu.Lock()
+			requests = append(requests, info)
+			mu.Unlock()
+		},
+		OnResponse: func(info ResponseInfo) {
+			mu.Lock()
+			responses = append(responses, info)
+			mu.Unlock()
+		},
+	})
+
+	bodies := []string{
+		`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"echo","arguments":{}}}`,
+		`{"jsonrpc":"2.0","id":"b","method":"no/such/method"}`,
+		`{"jsonrpc":"2.0","method":"notifications/initialized"}`,
+	}
+	for _, body := range bodies {
+		postJSON(proxy, body)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(requests) != len(bodies) || len(responses) != len(bodies) {
+		t.Fatalf("Expected %d calls of each hook, got %d OnRequest and %d OnResponse", len(bodies), len(requests), len(responses))
+	}
+
+	want := RequestInfo{Method: "tools/call", Tool: "echo", ID: "1", Identity: "192.0.2.1", Size: int64(len(bodies[0]))}
+	if !reflect.DeepEqual(requests[0], want) {
+		t.Errorf("OnRequest got %+v, want %+v", requests[0], want)
+	}
+	if r := responses[0]; r.Request != want || r.Status != http.StatusOK || r.Error || r.Size == 0 || r.Duration <= 0 {
+		t.Errorf("Unexpected tool call response info: %+v", r)
+	}
+	if r := responses[1]; r.Request.ID != `"b"` || !r.Error || r.Status != http.StatusOK {
+		t.Errorf("Expected a JSON-RPC error response, got %+v", r)
+	}
+	if r := responses[2]; r.Request.ID != "" || r.Status != http.StatusAccepted || r.Error {
+		t.Errorf("Expected an accepted notification, got %+v", r)
+	}
+}
+
+func TestHookPanicsAreRecovered(t *testing.T) {
+	logs := &recordingLogger{}
+	proxy := newFakeProxy(t, "mcp", Config{
+		Logger:     logs,
+		OnRequest:  func(RequestInfo) { panic("boom") },
+		OnResponse: func(ResponseInfo) { panic("bang") },
+	})
+
+	w := postJSON(proxy, `{"jsonrpc":"2.0","id":1,"method":"tools/list"}`)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"echo"`) {
+		t.Errorf("Expected the request to succeed, got %d %s", w.Code, w.Body.String())
+	}
+	for _, want := range []string{"Hook panicked server=test hook=OnRequest panic=boom", "Hook panicked server=test hook=OnResponse panic=bang"} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("Expected %q in the log", want)
+		}
+	}
+}
+
+func TestOnBackendStateChange(t *testing.T) {
+	fastRestarts(t)
+	changes := make(chan string, 10)
+	proxy := newFakeProxy(t, "exit", Config{
+		MaxRestarts: 1,
+		OnBackendStateChange: func(old, new string) {
+			changes <- old + "->" + new
+		},
+	})
+
+	exitBackend(t, proxy, 1)
+	exitBackend(t, proxy, 1)
+
+	want := []string{"running->restarting", "restarting->running", "running->failed"}
+	for _, w := range want {
+		select {
+		case got := <-changes:
+			if got != w {
+				t.Errorf("Expected state change %s, got %s", w, got)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timed out waiting for state change %s", w)
+		}
+	}
+}
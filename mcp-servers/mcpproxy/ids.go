@@ -0,0 +1,76 @@
+package mcpproxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+)
+
+// The values of Config.NormalizeIDType.
+const (
+	idTypeNone   = "none"
+	idTypeString = "string"
+	idTypeNumber = "number"
+)
+
+// integerID matches string ids that convert to a number as they are.
+var integerID = regexp.MustCompile(`^-?(?:0|[1-9][0-9]{0,17})$`)
+
+// validateIDType checks cfg.NormalizeIDType.
+func validateIDType(cfg Config) error {
+	switch cfg.NormalizeIDType {
+	case "", idTypeNone, idTypeString, idTypeNumber:
+		return nil
+	}
+	return fmt.Errorf("invalid NormalizeIDType %q: expected %q, %q or %q",
+		cfg.NormalizeIDType, idTypeString, idTypeNumber, idTypeNone)
+}
+
+// normalizeID returns the message of req with its id converted to
+// Config.NormalizeIDType. Ids already of that type are left alone. Strings
+// holding an integer become that number and other strings a number of the
+// proxy's; numbers become their decimal text. The client's id is recorded
+// in req for deliverResponse to restore.
+func (p *MCPProxy) normalizeID(msg json.RawMessage, req *request) json.RawMessage {
+	var m map[string]json.RawMessage
+	if json.Unmarshal(msg, &m) != nil || len(m["id"]) == 0 {
+		return msg
+	}
+	id := bytes.TrimSpace(m["id"])
+
+	var newID interface{}
+	switch {
+	case p.config.NormalizeIDType == idTypeNumber && id[0] == '"':
+		var s string
+		json.Unmarshal(id, &s)
+		if integerID.MatchString(s) {
+			newID = json.Number(s)
+		} else {
+			p.lastID++
+			newID = p.lastID
+		}
+	case p.config.NormalizeIDType == idTypeString && id[0] != '"' && id[0] != 'n':
+		newID = string(id)
+	default:
+		return msg
+	}
+
+	data, err := json.Marshal(newID)
+	if err != nil {
+		return msg
+	}
+	m["id"] = data
+	normalized, err := json.Marshal(m)
+	if err != nil {
+		return msg
+	}
+	var clientID interface{}
+	dec := json.NewDecoder(bytes.NewReader(id))
+	dec.UseNumber()
+	dec.Decode(&clientID)
+	req.clientID = clientID
+	req.normalizedID = true
+	req.log.Debug("Normalized request id", "id", string(id), "sent", string(data))
+	return normalized
+}
@@ -0,0 +1,39 @@
+package mcpproxy
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalizeIDType(t *testing.T) {
+	for _, tc := range []struct {
+		mode, idType string
+		id, sent     string
+	}{
+		{"intids", "number", `"7"`, `7`},
+		{"intids", "number", `"req-abc"`, `1`},
+		{"intids", "number", `42`, `42`},
+		{"stringids", "string", `7`, `"7"`},
+		{"stringids", "string", `-1.5`, `"-1.5"`},
+		{"stringids", "string", `"abc"`, `"abc"`},
+	} {
+		proxy := newFakeProxy(t, tc.mode, Config{NormalizeIDType: tc.idType})
+		body := postJSON(proxy, `{"jsonrpc":"2.0","id":`+tc.id+`,"method":"tools/list"}`).Body.String()
+		if !strings.Contains(body, `"echo":`+tc.sent) {
+			t.Errorf("%s id %s: expected the MCP server to be sent %s, got %s", tc.idType, tc.id, tc.sent, body)
+		}
+		if !strings.Contains(body, `"id":`+tc.id) {
+			t.Errorf("%s id %s: expected the client's id in the response, got %s", tc.idType, tc.id, body)
+		}
+	}
+
+	// Without normalization the strict server rejects the id
+	proxy := newFakeProxy(t, "intids", Config{})
+	if body := postJSON(proxy, `{"jsonrpc":"2.0","id":"7","method":"tools/list"}`).Body.String(); !strings.Contains(body, "invalid id type") {
+		t.Errorf("Expected the string id to be rejected, got %s", body)
+	}
+
+	if _, err := resolveConfig(Config{NormalizeIDType: "integer"}); err == nil {
+		t.Error("Expected an invalid NormalizeIDType to be rejected")
+	}
+}
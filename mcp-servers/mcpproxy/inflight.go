@@ -0,0 +1,138 @@
+package mcpproxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// inflight describes a client request from the time it is queued until
+// its client has been answered, for /admin/inflight. Only sent and
+// cancelled change once it is registered, so snapshots need no lock.
+type inflight struct {
+	id       string
+	method   string
+	tool     string
+	identity string
+	session  string
+	enqueued time.Time
+
+	// sent is when processRequests sent the request to the MCP server, in
+	// Unix nanoseconds, or 0 while it is queued. cancelled is set once the
+	// MCP server was sent notifications/cancelled for it.
+	sent      atomic.Int64
+	cancelled atomic.Bool
+}
+
+// inflightRegistry holds the requests being served. It is a sync.Map since
+// requests come and go far more often than it is read.
+type inflightRegistry struct {
+	requests sync.Map // *inflight -> struct{}
+}
+
+// track registers req, received in r, and returns the function that
+// removes it again.
+func (reg *inflightRegistry) track(r *http.Request, req *request) func() {
+	info := &inflight{
+		id:       formatID(req.requestID()),
+		method:   req.method,
+		identity: identity(r),
+		session:  r.Header.Get(sessionHeader),
+		enqueued: time.Now(),
+	}
+	if req.method == "tools/call" && req.body == nil {
+		info.tool = toolName(req.msg)
+	}
+	req.inflight = info
+	reg.requests.Store(info, struct{}{})
+	return func() { reg.requests.Delete(info) }
+}
+
+// empty reports whether no request is being served.
+func (reg *inflightRegistry) empty() bool {
+	empty := true
+	reg.requests.Range(func(any, any) bool {
+		empty = false
+		return false
+	})
+	return empty
+}
+
+// inflightView is a request as served at /admin/inflight. Payloads are left
+// out, as they may hold secrets.
+type inflightView struct {
+	ID        string     `json:"id,omitempty"`
+	Method    string     `json:"method"`
+	Tool      string     `json:"tool,omitempty"`
+	Identity  string     `json:"identity"`
+	Session   string     `json:"session,omitempty"`
+	Enqueued  time.Time  `json:"enqueued"`
+	Waiting   string     `json:"waiting"`
+	Sent      *time.Time `json:"sent,omitempty"`
+	InBackend string     `json:"inBackend,omitempty"`
+	Cancelled bool       `json:"cancelled"`
+}
+
+// snapshot returns the requests waiting in the queue and those sent to the
+// MCP server, oldest first.
+func (reg *inflightRegistry) snapshot() (queued, sent []inflightView) {
+	now := time.Now()
+	queued, sent = []inflightView{}, []inflightView{}
+	reg.requests.Range(func(key, _ interface{}) bool {
+		info := key.(*inflight)
+		view := inflightView{
+			ID:        info.id,
+			Method:    info.method,
+			Tool:      info.tool,
+			Identity:  info.identity,
+			Session:   info.session,
+			Enqueued:  info.enqueued,
+			Waiting:   now.Sub(info.enqueued).Round(time.Millisecond).String(),
+			Cancelled: info.cancelled.Load(),
+		}
+		if ns := info.sent.Load(); ns != 0 {
+			sentAt := time.Unix(0, ns)
+			view.Sent = &sentAt
+			view.InBackend = now.Sub(sentAt).Round(time.Millisecond).String()
+			sent = append(sent, view)
+		} else {
+			queued = append(queued, view)
+		}
+		return true
+	})
+	for _, views := range [][]inflightView{queued, sent} {
+		sort.Slice(views, func(i, j int) bool { return views[i].Enqueued.Before(views[j].Enqueued) })
+	}
+	return queued, sent
+}
+
+// markSent records that r is being sent to the MCP server.
+func (r *request) markSent() {
+	if r.inflight != nil {
+		r.inflight.sent.Store(time.Now().UnixNano())
+	}
+}
+
+// markCancelled records that the MCP server was asked to cancel r.
+func (r *request) markCancelled() {
+	if r.inflight != nil {
+		r.inflight.cancelled.Store(true)
+	}
+}
+
+// handleInflight serves GET /admin/inflight with the requests the proxy is
+// serving: those queued, and those sent to the MCP server and waiting for
+// its response, so that a stalled queue can be told from a stalled server.
+func (p *MCPProxy) handleInflight(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	queued, sent := p.inflight.snapshot()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string][]inflightView{"queued": queued, "sent": sent})
+}
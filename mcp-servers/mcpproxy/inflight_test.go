@@ -0,0 +1,65 @@
+package mcpproxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// getInflight returns the requests listed by /admin/inflight.
+func getInflight(t *testing.T, proxy *MCPProxy) (queued, sent []inflightView) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	proxy.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/admin/inflight", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d %s", w.Code, w.Body.String())
+	}
+	if strings.Contains(w.Body.String(), "secret") {
+		t.Errorf("Expected payloads to be left out, got %s", w.Body.String())
+	}
+	var resp map[string][]inflightView
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Unexpected response %s", w.Body.String())
+	}
+	return resp["queued"], resp["sent"]
+}
+
+func TestInflight(t *testing.T) {
+	proxy := newFakeProxy(t, "slow", Config{ToolCallTimeout: 250 * time.Millisecond, CancelGracePeriod: time.Minute})
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		postJSON(proxy, `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"search","delayMs":600,"query":"secret"}}`)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	go func() {
+		defer wg.Done()
+		postJSON(proxy, `{"jsonrpc":"2.0","id":"two","method":"tools/list"}`)
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	queued, sent := getInflight(t, proxy)
+	if len(queued) != 1 || queued[0].ID != `"two"` || queued[0].Method != "tools/list" || queued[0].Sent != nil {
+		t.Errorf("Expected tools/list to be queued, got %+v", queued)
+	}
+	if len(sent) != 1 || sent[0].ID != "1" || sent[0].Tool != "search" || sent[0].Identity == "" || sent[0].Cancelled {
+		t.Fatalf("Expected the tool call to be with the MCP server, got %+v", sent)
+	}
+
+	// Calls that ran over their timeout are marked once cancelled
+	time.Sleep(250 * time.Millisecond)
+	if _, sent := getInflight(t, proxy); len(sent) != 1 || !sent[0].Cancelled {
+		t.Errorf("Expected the tool call to be cancelled, got %+v", sent)
+	}
+
+	wg.Wait()
+	if queued, sent := getInflight(t, proxy); len(queued) != 0 || len(sent) != 0 {
+		t.Errorf("Expected no requests once answered, got %+v %+v", queued, sent)
+	}
+}
@@ -0,0 +1,62 @@
+package mcpproxy
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// defaultInitializedGracePeriod is the default Config.InitializedGracePeriod.
+const defaultInitializedGracePeriod = time.Second
+
+// awaitInitialized starts waiting for the client to follow up the response
+// to its initialize request, sent to b, with notifications/initialized,
+// see Config.AutoInitializedNotification. Once the grace period passes,
+// the notification is queued for sendInitialized.
+func (p *MCPProxy) awaitInitialized(b *backend, log Logger, response json.RawMessage) {
+	if response == nil {
+		return
+	}
+	if _, failed := rpcErrorCode(response); failed {
+		return
+	}
+	if b.initializedTimer != nil {
+		b.initializedTimer.Stop()
+	}
+	b.awaitingInitialized = true
+	b.initializedTimer = time.AfterFunc(p.config.InitializedGracePeriod, func() {
+		p.enqueue(&request{
+			method:         "notifications/initialized",
+			initializedFor: b,
+			response:       make(chan json.RawMessage, 1),
+			log:            log,
+		})
+	})
+}
+
+// initializedSent notes that b was sent notifications/initialized.
+func (b *backend) initializedSent() {
+	b.awaitingInitialized = false
+	if b.initializedTimer != nil {
+		b.initializedTimer.Stop()
+	}
+}
+
+// sendInitialized sends notifications/initialized to b, unless a client
+// sent it in the meantime or b is no longer the running MCP server.
+func (p *MCPProxy) sendInitialized(b *backend, log Logger) {
+	if !b.awaitingInitialized || b != p.liveBackend() {
+		return
+	}
+	b.initializedSent()
+	log.Warn("Client did not send notifications/initialized, sending it in its place", "grace", p.config.InitializedGracePeriod)
+	msg, _ := json.Marshal(map[string]interface{}{"jsonrpc": "2.0", "method": "notifications/initialized"})
+	p.logBody(log, "Sending", msg)
+	if err := b.writer.WriteFrame(msg); err != nil {
+		log.Error("Error writing to stdin", "error", err)
+		return
+	}
+	p.recorder.record(b.cmd.Process.Pid, "sent", msg)
+	if p.config.ReplayInitialize {
+		p.handshake.record("notifications/initialized", msg, nil)
+	}
+}
@@ -0,0 +1,56 @@
+package mcpproxy
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const statefulInitialize = `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-03-26","clientInfo":{"name":"inspector"}}}`
+
+func TestAutoInitializedNotification(t *testing.T) {
+	logs := &recordingLogger{}
+	proxy := newFakeProxy(t, "stateful", Config{
+		AutoInitializedNotification: true,
+		InitializedGracePeriod:      50 * time.Millisecond,
+		Logger:                      logs,
+	})
+
+	// The client never sends notifications/initialized
+	postJSON(proxy, statefulInitialize)
+	waitForLog(t, logs, "WARN Client did not send notifications/initialized, sending it in its place")
+	w := postJSON(proxy, `{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"query"}}`)
+	if !strings.Contains(w.Body.String(), `"client":"inspector"`) {
+		t.Errorf("Expected the MCP server to be initialized, got %s", w.Body.String())
+	}
+}
+
+func TestAutoInitializedNotificationNotNeeded(t *testing.T) {
+	logs := &recordingLogger{}
+	proxy := newFakeProxy(t, "stateful", Config{
+		AutoInitializedNotification: true,
+		InitializedGracePeriod:      50 * time.Millisecond,
+		Logger:                      logs,
+	})
+
+	// A client that sends it in time is left alone
+	postJSON(proxy, statefulInitialize)
+	postJSON(proxy, `{"jsonrpc":"2.0","method":"notifications/initialized"}`)
+	time.Sleep(150 * time.Millisecond)
+	w := postJSON(proxy, `{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"query"}}`)
+	if !strings.Contains(w.Body.String(), `"client":"inspector"`) {
+		t.Errorf("Expected the MCP server to be initialized, got %s", w.Body.String())
+	}
+	if strings.Contains(logs.String(), "notifications/initialized, sending it") {
+		t.Errorf("Expected no notification to be sent for the client, got:\n%s", logs.String())
+	}
+
+	// And by default nothing is sent for a client that forgets it
+	proxy = newFakeProxy(t, "stateful", Config{InitializedGracePeriod: 50 * time.Millisecond})
+	postJSON(proxy, statefulInitialize)
+	time.Sleep(150 * time.Millisecond)
+	w = postJSON(proxy, `{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"query"}}`)
+	if !strings.Contains(w.Body.String(), "Server not initialized") {
+		t.Errorf("Expected the MCP server to be uninitialized, got %s", w.Body.String())
+	}
+}
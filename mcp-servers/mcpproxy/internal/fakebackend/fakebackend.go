@@ -0,0 +1,521 @@
+// Package fakebackend provides scripted MCP servers for tests. A test binary
+// calls RunIfRequested from TestMain and then starts itself as an MCP server
+// with the command returned by Command.
+package fakebackend
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Arg makes a test binary act as a scripted MCP server instead of running
+// tests when passed as its first argument, followed by a mode name. The
+// mode "version" prints a version banner and exits.
+const Arg = "fake-mcp-backend"
+
+// message holds the members of a JSON-RPC message the fake servers use.
+type message struct {
+	ID     interface{} `json:"id,omitempty"`
+	Method string      `json:"method,omitempty"`
+}
+
+// backends maps mode names to scripted MCP server behaviors. Each one
+// reads newline-delimited messages from stdin and writes to stdout.
+var backends = map[string]func(in *bufio.Reader, out *bufio.Writer){
+	// ack replies to every request with the size of the message it received.
+	"ack": func(in *bufio.Reader, out *bufio.Writer) {
+		forEachMessage(in, func(line []byte, msg message) {
+			if msg.ID != nil {
+				writeMessage(out, map[string]interface{}{
+					"jsonrpc": "2.0",
+					"id":      msg.ID,
+					"result":  map[string]interface{}{"size": len(line)},
+				})
+			}
+		})
+	},
+	// nul is ack for a server that frames messages with a NUL byte instead
+	// of a newline.
+	"nul": func(in *bufio.Reader, out *bufio.Writer) {
+		for {
+			frame, err := in.ReadBytes(0)
+			if err != nil {
+				return
+			}
+			var msg message
+			json.Unmarshal(frame[:len(frame)-1], &msg)
+			if msg.ID != nil {
+				data, _ := json.Marshal(map[string]interface{}{
+					"jsonrpc": "2.0",
+					"id":      msg.ID,
+					"result":  map[string]interface{}{"size": len(frame) - 1},
+				})
+				out.Write(append(data, 0))
+				out.Flush()
+			}
+		}
+	},
+	// content-length is ack for a server that frames messages with
+	// Content-Length headers, and that precedes every response with a frame
+	// whose header is garbled.
+	"content-length": func(in *bufio.Reader, out *bufio.Writer) {
+		for {
+			var length int
+			if _, err := fmt.Fscanf(in, "Content-Length: %d\r\n\r\n", &length); err != nil {
+				return
+			}
+			body := make([]byte, length)
+			if _, err := io.ReadFull(in, body); err != nil {
+				return
+			}
+			var msg message
+			json.Unmarshal(body, &msg)
+			if msg.ID != nil {
+				data, _ := json.Marshal(map[string]interface{}{
+					"jsonrpc": "2.0",
+					"id":      msg.ID,
+					"result":  map[string]interface{}{"size": length},
+				})
+				fmt.Fprintf(out, "Content-Length: many\r\n\r\n{}")
+				fmt.Fprintf(out, "Content-Length: %d\r\n\r\n%s", len(data), data)
+				out.Flush()
+			}
+		}
+	},
+	// reflect replies to every request with the "result" or "error" member
+	// of its params, letting tests choose the backend's answer per request,
+	// under the id in params.id if there is one.
+	"reflect": func(in *bufio.Reader, out *bufio.Writer) {
+		forEachMessage(in, func(line []byte, _ message) {
+			var req struct {
+				ID     json.RawMessage `json:"id"`
+				Params struct {
+					ID     json.RawMessage `json:"id"`
+					Result json.RawMessage `json:"result"`
+					Error  json.RawMessage `json:"error"`
+				} `json:"params"`
+			}
+			json.Unmarshal(line, &req)
+			if req.ID == nil {
+				return
+			}
+			resp := map[string]interface{}{"jsonrpc": "2.0", "id": req.ID}
+			if req.Params.ID != nil {
+				resp["id"] = req.Params.ID
+			}
+			if req.Params.Error != nil {
+				resp["error"] = req.Params.Error
+			} else if req.Params.Result != nil {
+				resp["result"] = req.Params.Result
+			} else {
+				resp["result"] = map[string]interface{}{}
+			}
+			writeMessage(out, resp)
+		})
+	},
+	// big replies with a result padded to params.size bytes of data,
+	// preceded by a notification of params.notifySize bytes if set.
+	"big": func(in *bufio.Reader, out *bufio.Writer) {
+		forEachMessage(in, func(line []byte, msg message) {
+			if msg.ID == nil {
+				return
+			}
+			var req struct {
+				Params struct {
+					Size       int `json:"size"`
+					NotifySize int `json:"notifySize"`
+				} `json:"params"`
+			}
+			json.Unmarshal(line, &req)
+			if req.Params.NotifySize > 0 {
+				writeMessage(out, map[string]interface{}{
+					"jsonrpc": "2.0",
+					"method":  "notifications/message",
+					"params":  map[string]interface{}{"data": strings.Repeat("n", req.Params.NotifySize)},
+				})
+			}
+			writeMessage(out, map[string]interface{}{
+				"jsonrpc": "2.0",
+				"id":      msg.ID,
+				"result":  map[string]interface{}{"data": strings.Repeat("x", req.Params.Size)},
+			})
+		})
+	},
+	// slow counts the requests it receives and replies after params.delayMs
+	// with the count, or with an error if params.fail is set.
+	"slow": func(in *bufio.Reader, out *bufio.Writer) {
+		calls := 0
+		forEachMessage(in, func(line []byte, msg message) {
+			if msg.ID == nil {
+				return
+			}
+			calls++
+			var req struct {
+				Params struct {
+					DelayMs int  `json:"delayMs"`
+					Fail    bool `json:"fail"`
+				} `json:"params"`
+			}
+			json.Unmarshal(line, &req)
+			time.Sleep(time.Duration(req.Params.DelayMs) * time.Millisecond)
+
+			resp := map[string]interface{}{"jsonrpc": "2.0", "id": msg.ID}
+			if req.Params.Fail {
+				resp["error"] = map[string]interface{}{"code": -32000, "message": "failed", "data": calls}
+			} else {
+				resp["result"] = map[string]interface{}{"calls": calls}
+			}
+			writeMessage(out, resp)
+		})
+	},
+	// exit replies with its pid, or exits with params.exitCode if set, or
+	// kills itself with the signal numbered params.signal.
+	"exit": func(in *bufio.Reader, out *bufio.Writer) {
+		forEachMessage(in, func(line []byte, msg message) {
+			var req struct {
+				Params struct {
+					ExitCode *int `json:"exitCode"`
+					Signal   *int `json:"signal"`
+				} `json:"params"`
+			}
+			json.Unmarshal(line, &req)
+			if req.Params.ExitCode != nil {
+				os.Exit(*req.Params.ExitCode)
+			}
+			if req.Params.Signal != nil {
+				self, _ := os.FindProcess(os.Getpid())
+				self.Signal(syscall.Signal(*req.Params.Signal))
+				select {}
+			}
+			if msg.ID != nil {
+				writeMessage(out, map[string]interface{}{"jsonrpc": "2.0", "id": msg.ID, "result": map[string]interface{}{"pid": os.Getpid()}})
+			}
+		})
+	},
+	// banner prints a banner before its first message, like SQLcl, and
+	// replies with its pid after writing params.junk lines that are not
+	// JSON. It exits with params.exitCode if set.
+	"banner": func(in *bufio.Reader, out *bufio.Writer) {
+		fmt.Fprintln(out, "Fake MCP Server 1.0")
+		fmt.Fprintln(out, "Copyright (c) nobody")
+		fmt.Fprintln(out, "Connected.")
+		out.Flush()
+		forEachMessage(in, func(line []byte, msg message) {
+			var req struct {
+				Params struct {
+					Junk     int  `json:"junk"`
+					ExitCode *int `json:"exitCode"`
+				} `json:"params"`
+			}
+			json.Unmarshal(line, &req)
+			if req.Params.ExitCode != nil {
+				os.Exit(*req.Params.ExitCode)
+			}
+			for i := 0; i < req.Params.Junk; i++ {
+				fmt.Fprintf(out, "debug: line %d\n", i)
+			}
+			if msg.ID != nil {
+				writeMessage(out, map[string]interface{}{"jsonrpc": "2.0", "id": msg.ID, "result": map[string]interface{}{"pid": os.Getpid()}})
+			}
+		})
+	},
+	// desync replies with its pid, under an id that was never sent if
+	// params.desync is set.
+	"desync": func(in *bufio.Reader, out *bufio.Writer) {
+		forEachMessage(in, func(line []byte, msg message) {
+			if msg.ID == nil {
+				return
+			}
+			var req struct {
+				Params struct {
+					Desync bool `json:"desync"`
+				} `json:"params"`
+			}
+			json.Unmarshal(line, &req)
+			id := msg.ID
+			if req.Params.Desync {
+				id = fmt.Sprintf("lost-%v", msg.ID)
+			}
+			writeMessage(out, map[string]interface{}{"jsonrpc": "2.0", "id": id, "result": map[string]interface{}{"pid": os.Getpid()}})
+		})
+	},
+	// env replies with the value of the environment variable named by
+	// params.name.
+	"env": func(in *bufio.Reader, out *bufio.Writer) {
+		forEachMessage(in, func(line []byte, msg message) {
+			var req struct {
+				Params struct {
+					Name string `json:"name"`
+				} `json:"params"`
+			}
+			json.Unmarshal(line, &req)
+			if msg.ID != nil {
+				writeMessage(out, map[string]interface{}{"jsonrpc": "2.0", "id": msg.ID, "result": map[string]interface{}{"value": os.Getenv(req.Params.Name)}})
+			}
+		})
+	},
+	// mcp behaves like a minimal MCP server with an "echo" tool and a
+	// "fail" tool that always returns an error result.
+	"mcp": func(in *bufio.Reader, out *bufio.Writer) {
+		forEachMessage(in, func(line []byte, msg message) {
+			if msg.ID == nil {
+				return
+			}
+			var req struct {
+				Params struct {
+					Name      string          `json:"name"`
+					Arguments json.RawMessage `json:"arguments"`
+				} `json:"params"`
+			}
+			json.Unmarshal(line, &req)
+
+			resp := map[string]interface{}{"jsonrpc": "2.0", "id": msg.ID}
+			switch {
+			case msg.Method == "initialize":
+				resp["result"] = map[string]interface{}{
+					"protocolVersion": "2025-03-26",
+					"capabilities":    map[string]interface{}{"tools": map[string]interface{}{}},
+					"serverInfo":      map[string]interface{}{"name": "fake", "version": "1.0"},
+				}
+			case msg.Method == "tools/list":
+				resp["result"] = map[string]interface{}{"tools": []interface{}{
+					map[string]interface{}{"name": "echo"},
+					map[string]interface{}{"name": "fail"},
+				}}
+			case msg.Method == "tools/call" && req.Params.Name == "echo":
+				resp["result"] = map[string]interface{}{"content": []interface{}{
+					map[string]interface{}{"type": "text", "text": string(req.Params.Arguments)},
+				}}
+			case msg.Method == "tools/call" && req.Params.Name == "fail":
+				resp["result"] = map[string]interface{}{"isError": true, "content": []interface{}{
+					map[string]interface{}{"type": "text", "text": "failed"},
+				}}
+			default:
+				resp["error"] = map[string]interface{}{"code": -32601, "message": "Method not found"}
+			}
+			writeMessage(out, resp)
+		})
+	},
+	// resources keeps a single set of resource subscriptions, like a server
+	// tracking one subscriber. touch sends notifications/resources/updated
+	// for params.uri if it is subscribed, and replies with the number of
+	// resources/subscribe requests received and the subscribed URIs.
+	"resources": func(in *bufio.Reader, out *bufio.Writer) {
+		subscribes := 0
+		subscribed := make(map[string]bool)
+		forEachMessage(in, func(line []byte, msg message) {
+			if msg.ID == nil {
+				return
+			}
+			var req struct {
+				Params struct {
+					URI string `json:"uri"`
+				} `json:"params"`
+			}
+			json.Unmarshal(line, &req)
+
+			resp := map[string]interface{}{"jsonrpc": "2.0", "id": msg.ID, "result": map[string]interface{}{}}
+			switch msg.Method {
+			case "resources/subscribe":
+				subscribes++
+				subscribed[req.Params.URI] = true
+			case "resources/unsubscribe":
+				delete(subscribed, req.Params.URI)
+			case "touch":
+				if subscribed[req.Params.URI] {
+					writeMessage(out, map[string]interface{}{"jsonrpc": "2.0", "method": "notifications/resources/updated", "params": map[string]interface{}{"uri": req.Params.URI}})
+				}
+				uris := []string{}
+				for uri := range subscribed {
+					uris = append(uris, uri)
+				}
+				sort.Strings(uris)
+				resp["result"] = map[string]interface{}{"subscribes": subscribes, "subscribed": uris}
+			}
+			writeMessage(out, resp)
+		})
+	},
+	// progress sends params.steps notifications/progress for every request
+	// before its result, using the request id as progress token.
+	"progress": func(in *bufio.Reader, out *bufio.Writer) {
+		forEachMessage(in, func(line []byte, msg message) {
+			if msg.ID == nil {
+				return
+			}
+			var req struct {
+				Params struct {
+					Steps int `json:"steps"`
+				} `json:"params"`
+			}
+			json.Unmarshal(line, &req)
+			for i := 1; i <= req.Params.Steps; i++ {
+				writeMessage(out, map[string]interface{}{"jsonrpc": "2.0", "method": "notifications/progress", "params": map[string]interface{}{
+					"progressToken": msg.ID, "progress": i, "total": req.Params.Steps,
+				}})
+			}
+			writeMessage(out, map[string]interface{}{"jsonrpc": "2.0", "id": msg.ID, "result": map[string]interface{}{"steps": req.Params.Steps}})
+		})
+	},
+	// hang reads requests but never answers them.
+	"hang": func(in *bufio.Reader, out *bufio.Writer) {
+		forEachMessage(in, func(line []byte, msg message) {})
+	},
+	// stuck never answers tools/call, like a server stuck in a query, but
+	// answers every other request with the ids of the requests it was
+	// sent notifications/cancelled for.
+	"stuck": func(in *bufio.Reader, out *bufio.Writer) {
+		cancelled := []interface{}{}
+		forEachMessage(in, func(line []byte, msg message) {
+			if msg.Method == "notifications/cancelled" {
+				var req struct {
+					Params struct {
+						RequestID interface{} `json:"requestId"`
+					} `json:"params"`
+				}
+				json.Unmarshal(line, &req)
+				cancelled = append(cancelled, req.Params.RequestID)
+			}
+			if msg.ID == nil || msg.Method == "tools/call" {
+				return
+			}
+			writeMessage(out, map[string]interface{}{"jsonrpc": "2.0", "id": msg.ID, "result": map[string]interface{}{"cancelled": cancelled}})
+		})
+	},
+	// stateful rejects tools/call until it has been sent initialize and
+	// notifications/initialized, then answers with the clientInfo name it
+	// was initialized with. It exits on a tools/call of the "exit" tool.
+	"stateful": func(in *bufio.Reader, out *bufio.Writer) {
+		client, ready := "", false
+		forEachMessage(in, func(line []byte, msg message) {
+			var req struct {
+				Params struct {
+					Name       string `json:"name"`
+					ClientInfo struct {
+						Name string `json:"name"`
+					} `json:"clientInfo"`
+				} `json:"params"`
+			}
+			json.Unmarshal(line, &req)
+			resp := map[string]interface{}{"jsonrpc": "2.0", "id": msg.ID}
+			switch {
+			case msg.Method == "initialize":
+				client = req.Params.ClientInfo.Name
+				resp["result"] = map[string]interface{}{"protocolVersion": "2025-03-26", "capabilities": map[string]interface{}{}}
+			case msg.Method == "notifications/initialized":
+				ready = client != ""
+				return
+			case msg.Method == "tools/call" && req.Params.Name == "exit":
+				os.Exit(1)
+			case !ready:
+				resp["error"] = map[string]interface{}{"code": -32002, "message": "Server not initialized"}
+			default:
+				resp["result"] = map[string]interface{}{"client": client}
+			}
+			writeMessage(out, resp)
+		})
+	},
+	// meta replies to every request with the params._meta it received,
+	// after params.delayMs.
+	"meta": func(in *bufio.Reader, out *bufio.Writer) {
+		forEachMessage(in, func(line []byte, msg message) {
+			if msg.ID == nil {
+				return
+			}
+			var req struct {
+				Params struct {
+					DelayMs int             `json:"delayMs"`
+					Meta    json.RawMessage `json:"_meta"`
+				} `json:"params"`
+			}
+			json.Unmarshal(line, &req)
+			time.Sleep(time.Duration(req.Params.DelayMs) * time.Millisecond)
+			writeMessage(out, map[string]interface{}{"jsonrpc": "2.0", "id": msg.ID, "result": map[string]interface{}{"meta": req.Params.Meta}})
+		})
+	},
+	// dup answers every request twice, echoing its id in the result.
+	"dup": func(in *bufio.Reader, out *bufio.Writer) {
+		forEachMessage(in, func(line []byte, msg message) {
+			if msg.ID == nil {
+				return
+			}
+			resp := map[string]interface{}{"jsonrpc": "2.0", "id": msg.ID, "result": map[string]interface{}{"echo": msg.ID}}
+			writeMessage(out, resp)
+			writeMessage(out, resp)
+		})
+	},
+	// intids and stringids accept only number or only string ids, echoing
+	// the id in the result, and reject others like strict servers do.
+	"intids":    strictIDs(false),
+	"stringids": strictIDs(true),
+}
+
+func strictIDs(wantString bool) func(in *bufio.Reader, out *bufio.Writer) {
+	return func(in *bufio.Reader, out *bufio.Writer) {
+		forEachMessage(in, func(line []byte, msg message) {
+			if msg.ID == nil {
+				return
+			}
+			if _, isString := msg.ID.(string); isString != wantString {
+				writeMessage(out, map[string]interface{}{"jsonrpc": "2.0", "id": msg.ID,
+					"error": map[string]interface{}{"code": -32600, "message": "invalid id type"}})
+				return
+			}
+			writeMessage(out, map[string]interface{}{"jsonrpc": "2.0", "id": msg.ID, "result": map[string]interface{}{"echo": msg.ID}})
+		})
+	}
+}
+
+// RunIfRequested runs the fake MCP server named by the command line and
+// exits if the process was started with Arg. Otherwise it returns.
+func RunIfRequested() {
+	if len(os.Args) < 3 || os.Args[1] != Arg {
+		return
+	}
+	if os.Args[2] == "version" {
+		fmt.Println("\nfake-mcp-backend 1.0\ncommit abc")
+		os.Exit(0)
+	}
+	backend, ok := backends[os.Args[2]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown fake backend %q\n", os.Args[2])
+		os.Exit(2)
+	}
+	out := bufio.NewWriter(os.Stdout)
+	backend(bufio.NewReader(os.Stdin), out)
+	out.Flush()
+	os.Exit(0)
+}
+
+// Command returns the command path and arguments that run the named mode
+// in the current test binary.
+func Command(mode string) (string, []string) {
+	return os.Args[0], []string{Arg, mode}
+}
+
+// forEachMessage calls fn for every line read from in until EOF.
+func forEachMessage(in *bufio.Reader, fn func(line []byte, msg message)) {
+	for {
+		line, err := in.ReadBytes('\n')
+		if err != nil {
+			return
+		}
+		var msg message
+		json.Unmarshal(line, &msg)
+		fn(line[:len(line)-1], msg)
+	}
+}
+
+// writeMessage writes v as a single newline-terminated JSON message.
+func writeMessage(out *bufio.Writer, v interface{}) {
+	data, _ := json.Marshal(v)
+	out.Write(data)
+	out.WriteByte('\n')
+	out.Flush()
+}
@@ -0,0 +1,341 @@
+package mcpproxy
+
+import (
+	"fmt"
+	"io"
+)
+
+// maxJSONDepth bounds the nesting of arrays and objects jsonScanner accepts,
+// as encoding/json does, so that a body of brackets cannot grow its stack
+// without limit.
+const maxJSONDepth = 10000
+
+// jsonSyntaxError reports a body that is not a single JSON value, at Offset
+// bytes into it.
+type jsonSyntaxError struct {
+	msg    string
+	Offset int64
+}
+
+func (e *jsonSyntaxError) Error() string {
+	return fmt.Sprintf("%s at offset %d", e.msg, e.Offset)
+}
+
+// jsonValidator passes r through, checking as it goes that it starts with a
+// JSON value, so that streamed bodies are validated like buffered ones
+// without holding them in memory. The first invalid byte and everything
+// after it are withheld, and reading fails with a *jsonSyntaxError. Like
+// json.Decoder, it ends at the end of the value, ignoring what follows.
+type jsonValidator struct {
+	r   io.Reader
+	s   jsonScanner
+	err error
+}
+
+func newJSONValidator(r io.Reader) *jsonValidator {
+	return &jsonValidator{r: r}
+}
+
+func (v *jsonValidator) Read(p []byte) (int, error) {
+	if v.err != nil {
+		return 0, v.err
+	}
+	n, err := v.r.Read(p)
+	if valid, serr := v.s.feed(p[:n]); serr != nil {
+		if v.s.complete() {
+			serr = io.EOF
+		}
+		v.err = serr
+		return valid, serr
+	}
+	if err == io.EOF {
+		if serr := v.s.end(); serr != nil {
+			v.err = serr
+			return n, serr
+		}
+	}
+	return n, err
+}
+
+// The states of jsonScanner, named for what it expects next.
+const (
+	scanValue        = iota // a value
+	scanValueOrClose        // a value or ']', after '['
+	scanKey                 // a key, after ','
+	scanKeyOrClose          // a key or '}', after '{'
+	scanColon               // ':' after a key
+	scanAfterValue          // ',' or a closing bracket, or the end
+	scanString              // the rest of a string
+	scanEscape              // the character after '\'
+	scanHex                 // the hex digits of \u
+	scanMinus               // the first digit after '-'
+	scanZero                // '.', 'e' or the end of a number, after a leading 0
+	scanInt                 // more digits of the integer part
+	scanFracStart           // the first digit after '.'
+	scanFrac                // more digits of the fraction
+	scanExpStart            // a sign or digit after 'e'
+	scanExpSign             // the first digit after the sign of the exponent
+	scanExp                 // more digits of the exponent
+	scanLiteral             // the rest of true, false or null
+)
+
+// jsonScanner checks the syntax of a JSON text fed to it in pieces, keeping
+// only the nesting of the arrays and objects it is in.
+type jsonScanner struct {
+	state   int
+	stack   []byte // '[' or '{' per open array or object
+	key     bool   // the string being scanned is an object key
+	hex     int    // hex digits of \u left
+	literal string // rest of the literal being scanned
+	offset  int64
+	started bool
+}
+
+// The outcomes of jsonScanner.step.
+const (
+	stepOK    = iota
+	stepAgain // c ended a number and must be scanned again
+	stepError
+)
+
+// feed scans b. It returns how many bytes of b are valid, and an error if
+// not all are.
+func (s *jsonScanner) feed(b []byte) (int, error) {
+	for i := 0; i < len(b); {
+		switch s.step(b[i]) {
+		case stepAgain:
+			continue
+		case stepError:
+			return i, s.errorf("invalid character %q", b[i])
+		}
+		i++
+		s.offset++
+	}
+	return len(b), nil
+}
+
+// step scans the byte c.
+func (s *jsonScanner) step(c byte) int {
+	isSpace := c == ' ' || c == '\t' || c == '\n' || c == '\r'
+	isDigit := '0' <= c && c <= '9'
+	switch s.state {
+	case scanValue, scanValueOrClose:
+		if isSpace {
+			return stepOK
+		}
+		if c == ']' && s.state == scanValueOrClose {
+			return s.close(c)
+		}
+		return s.beginValue(c)
+
+	case scanKey, scanKeyOrClose:
+		switch {
+		case isSpace:
+		case c == '"':
+			s.state, s.key = scanString, true
+		case c == '}' && s.state == scanKeyOrClose:
+			return s.close(c)
+		default:
+			return stepError
+		}
+
+	case scanColon:
+		switch {
+		case isSpace:
+		case c == ':':
+			s.state = scanValue
+		default:
+			return stepError
+		}
+
+	case scanAfterValue:
+		switch {
+		case isSpace:
+		case len(s.stack) == 0:
+			return stepError
+		case c == ',' && s.stack[len(s.stack)-1] == '{':
+			s.state = scanKey
+		case c == ',':
+			s.state = scanValue
+		case c == '}' || c == ']':
+			return s.close(c)
+		default:
+			return stepError
+		}
+
+	case scanString:
+		switch {
+		case c == '"':
+			if s.key {
+				s.state, s.key = scanColon, false
+			} else {
+				s.state = scanAfterValue
+			}
+		case c == '\\':
+			s.state = scanEscape
+		case c < 0x20:
+			return stepError
+		}
+
+	case scanEscape:
+		switch c {
+		case '"', '\\', '/', 'b', 'f', 'n', 'r', 't':
+			s.state = scanString
+		case 'u':
+			s.state, s.hex = scanHex, 4
+		default:
+			return stepError
+		}
+
+	case scanHex:
+		if !isDigit && !('a' <= c && c <= 'f') && !('A' <= c && c <= 'F') {
+			return stepError
+		}
+		if s.hex--; s.hex == 0 {
+			s.state = scanString
+		}
+
+	case scanMinus:
+		switch {
+		case c == '0':
+			s.state = scanZero
+		case isDigit:
+			s.state = scanInt
+		default:
+			return stepError
+		}
+
+	case scanZero, scanInt:
+		switch {
+		case isDigit && s.state == scanInt:
+		case c == '.':
+			s.state = scanFracStart
+		case c == 'e' || c == 'E':
+			s.state = scanExpStart
+		default:
+			return s.endNumber()
+		}
+
+	case scanFracStart:
+		if !isDigit {
+			return stepError
+		}
+		s.state = scanFrac
+
+	case scanFrac:
+		switch {
+		case isDigit:
+		case c == 'e' || c == 'E':
+			s.state = scanExpStart
+		default:
+			return s.endNumber()
+		}
+
+	case scanExpStart:
+		switch {
+		case c == '+' || c == '-':
+			s.state = scanExpSign
+		case isDigit:
+			s.state = scanExp
+		default:
+			return stepError
+		}
+
+	case scanExpSign:
+		if !isDigit {
+			return stepError
+		}
+		s.state = scanExp
+
+	case scanExp:
+		if !isDigit {
+			return s.endNumber()
+		}
+
+	case scanLiteral:
+		if c != s.literal[0] {
+			return stepError
+		}
+		if s.literal = s.literal[1:]; s.literal == "" {
+			s.state = scanAfterValue
+		}
+	}
+	return stepOK
+}
+
+// beginValue scans c, the first byte of a value.
+func (s *jsonScanner) beginValue(c byte) int {
+	s.started = true
+	switch {
+	case c == '{' || c == '[':
+		if len(s.stack) == maxJSONDepth {
+			return stepError
+		}
+		s.stack = append(s.stack, c)
+		s.state = scanKeyOrClose
+		if c == '[' {
+			s.state = scanValueOrClose
+		}
+	case c == '"':
+		s.state = scanString
+	case c == '-':
+		s.state = scanMinus
+	case c == '0':
+		s.state = scanZero
+	case '1' <= c && c <= '9':
+		s.state = scanInt
+	case c == 't':
+		s.state, s.literal = scanLiteral, "rue"
+	case c == 'f':
+		s.state, s.literal = scanLiteral, "alse"
+	case c == 'n':
+		s.state, s.literal = scanLiteral, "ull"
+	default:
+		return stepError
+	}
+	return stepOK
+}
+
+// close scans c, which closes the innermost array or object if it matches.
+func (s *jsonScanner) close(c byte) int {
+	open := byte('[')
+	if c == '}' {
+		open = '{'
+	}
+	if len(s.stack) == 0 || s.stack[len(s.stack)-1] != open {
+		return stepError
+	}
+	s.stack = s.stack[:len(s.stack)-1]
+	s.state = scanAfterValue
+	return stepOK
+}
+
+// endNumber ends the number being scanned at a byte that is not part of it.
+func (s *jsonScanner) endNumber() int {
+	s.state = scanAfterValue
+	return stepAgain
+}
+
+// complete reports whether a whole value has been scanned, so that anything
+// but whitespace is out of place.
+func (s *jsonScanner) complete() bool {
+	return s.started && len(s.stack) == 0 && s.state == scanAfterValue
+}
+
+// end checks that the text fed so far is one complete value.
+func (s *jsonScanner) end() error {
+	if !s.started {
+		return s.errorf("empty body")
+	}
+	if len(s.stack) == 0 {
+		switch s.state {
+		case scanAfterValue, scanZero, scanInt, scanFrac, scanExp:
+			return nil
+		}
+	}
+	return s.errorf("unexpected end of JSON input")
+}
+
+func (s *jsonScanner) errorf(format string, args ...any) error {
+	return &jsonSyntaxError{msg: fmt.Sprintf(format, args...), Offset: s.offset}
+}
@@ -0,0 +1,80 @@
+package mcpproxy
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+var jsonScanCases = []string{
+	`{}`, `[]`, `""`, `0`, `-0`, `12`, `-1.5e+10`, `0.5E-3`, `1e5`, `true`, `false`, `null`,
+	` {"a" : [1, 2.0, {"b": null}], "c": "x\"y\\u00e9\n"} `,
+	`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"t","arguments":{"data":"abc"}}}`,
+	`[[[]],[{}]]`, `"😀"`, "\t[1]\r\n",
+
+	``, ` `, `{`, `}`, `[}`, `{]`, `{"a"}`, `{"a":}`, `{"a":1,}`, `[1,]`, `[,1]`, `{,}`,
+	`01`, `-`, `1.`, `.5`, `1e`, `1e+`, `+1`, `0x10`, `tru`, `nul`, `True`, `nulls`,
+	`"abc`, "\"a\nb\"", `"\x"`, `"\u12"`, `"\u12G4"`, `{} {}`, `1 2`, `[1] x`, `{"a":1}}`,
+	`{1:2}`, `{'a':1}`, `[1 2]`, `{"a" 1}`,
+}
+
+// scanAll feeds text to a jsonScanner in chunks of size bytes.
+func scanAll(text string, size int) error {
+	var s jsonScanner
+	for len(text) > 0 {
+		n := min(size, len(text))
+		if _, err := s.feed([]byte(text[:n])); err != nil {
+			return err
+		}
+		text = text[n:]
+	}
+	return s.end()
+}
+
+func TestJSONScannerMatchesValid(t *testing.T) {
+	for _, text := range jsonScanCases {
+		want := json.Valid([]byte(text))
+		// Splitting the text anywhere must not change the outcome
+		for _, size := range []int{1, 2, 3, 7, len(text) + 1} {
+			if err := scanAll(text, size); (err == nil) != want {
+				t.Errorf("Scanning %q in chunks of %d: got %v, expected valid %v", text, size, err, want)
+			}
+		}
+	}
+
+	deep := strings.Repeat("[", maxJSONDepth+1)
+	if err := scanAll(deep, 4096); err == nil {
+		t.Error("Expected nesting beyond maxJSONDepth to be rejected")
+	}
+}
+
+func TestJSONValidator(t *testing.T) {
+	v := newJSONValidator(strings.NewReader(`{"id":1,"params":{"x":[1,2}}`))
+	data, err := io.ReadAll(v)
+	var syntaxErr *jsonSyntaxError
+	if !errors.As(err, &syntaxErr) || syntaxErr.Offset != 26 {
+		t.Fatalf("Expected a syntax error at offset 26, got %v", err)
+	}
+	// Nothing from the first invalid byte on is passed through
+	if string(data) != `{"id":1,"params":{"x":[1,2` {
+		t.Errorf("Expected only the valid prefix, got %q", data)
+	}
+
+	v = newJSONValidator(strings.NewReader(`{"id":1,"params":{`))
+	if _, err := io.ReadAll(v); !errors.As(err, &syntaxErr) || !strings.Contains(err.Error(), "unexpected end") {
+		t.Errorf("Expected an unexpected end, got %v", err)
+	}
+
+	v = newJSONValidator(strings.NewReader(`{"id":1} `))
+	if data, err := io.ReadAll(v); err != nil || string(data) != `{"id":1} ` {
+		t.Errorf("Expected a valid body to pass through, got %q, %v", data, err)
+	}
+
+	// What follows the value is dropped, as json.Decoder ignores it
+	v = newJSONValidator(strings.NewReader(`{"id":1} {"id":2}`))
+	if data, err := io.ReadAll(v); err != nil || string(data) != `{"id":1} ` {
+		t.Errorf("Expected the body to end after the value, got %q, %v", data, err)
+	}
+}
@@ -0,0 +1,53 @@
+package mcpproxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// junkLine handles a line the MCP server wrote to stdout that is not JSON
+// while the proxy waits for the response to requestID. It returns the
+// error response that ends the wait, if any, and whether the line is
+// dropped rather than handled like a notification.
+//
+// Lines written within the startup grace of an instance are expected, such
+// as a banner, and only logged at debug level. Any others count toward
+// Config.MaxJunkLines, if set.
+func (p *MCPProxy) junkLine(b *backend, log Logger, line []byte, requestID interface{}) (json.RawMessage, bool) {
+	if p.startupNoise(b) {
+		b.startupNoise++
+		log.Debug("Skipping MCP server startup output", "line", string(line))
+		return nil, true
+	}
+	max := p.config.MaxJunkLines
+	if max <= 0 {
+		return nil, false
+	}
+
+	b.junk++
+	log.Warn("MCP server wrote a line that is not JSON-RPC", "line", string(line), "count", b.junk)
+	if b.junk <= max {
+		return nil, true
+	}
+	b.junk = 0
+	b.completed.add(formatID(requestID))
+	return jsonRPCError(requestID, -32603,
+		fmt.Sprintf("MCP server wrote more than %d lines that are not JSON-RPC", max)), true
+}
+
+// startupNoise reports whether b is still within its startup grace, see
+// Config.StartupGracePeriod and Config.StartupGraceLines. The grace ends
+// with the first JSON message the instance writes.
+func (p *MCPProxy) startupNoise(b *backend) bool {
+	period, lines := p.config.StartupGracePeriod, p.config.StartupGraceLines
+	switch {
+	case b.spoken || (period <= 0 && lines <= 0):
+		return false
+	case period > 0 && time.Since(b.started) > period:
+		return false
+	case lines > 0 && b.startupNoise >= lines:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,89 @@
+package mcpproxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// bannerCalls numbers the requests of bannerCall, so that a response left
+// behind by a failed request is not taken for a later one's.
+var bannerCalls atomic.Int64
+
+// bannerCall sends a request to a "banner" proxy, answered after junk
+// lines that are not JSON, and returns the pid that answered or the error.
+func bannerCall(t *testing.T, proxy *MCPProxy, junk int) (int, *RPCError) {
+	t.Helper()
+	w := postJSON(proxy, fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":"tools/call","params":{"junk":%d}}`, bannerCalls.Add(1), junk))
+	var resp struct {
+		Result struct {
+			PID int `json:"pid"`
+		} `json:"result"`
+		Error *RPCError `json:"error"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Unexpected response %d %s", w.Code, w.Body.String())
+	}
+	return resp.Result.PID, resp.Error
+}
+
+func TestMaxJunkLines(t *testing.T) {
+	// Without a startup grace the banner counts as junk
+	proxy := newFakeProxy(t, "banner", Config{MaxJunkLines: 2})
+	if _, rpcErr := bannerCall(t, proxy, 0); rpcErr == nil || rpcErr.Code != -32603 {
+		t.Fatalf("Expected the banner to exceed MaxJunkLines, got %+v", rpcErr)
+	}
+	// The late response is discarded
+	if pid, rpcErr := bannerCall(t, proxy, 0); rpcErr != nil || pid == 0 {
+		t.Fatalf("Expected the next request to succeed, got %d %+v", pid, rpcErr)
+	}
+
+	// Junk lines in a row up to the cap are dropped
+	if _, rpcErr := bannerCall(t, proxy, 2); rpcErr != nil {
+		t.Errorf("Expected 2 junk lines to be tolerated, got %+v", rpcErr)
+	}
+	if _, rpcErr := bannerCall(t, proxy, 3); rpcErr == nil {
+		t.Error("Expected 3 junk lines to fail the request")
+	}
+}
+
+func TestStartupGrace(t *testing.T) {
+	fastRestarts(t)
+	for name, cfg := range map[string]Config{
+		"lines":  {MaxJunkLines: 1, MaxRestarts: 3, StartupGraceLines: 5},
+		"period": {MaxJunkLines: 1, MaxRestarts: 3, StartupGracePeriod: time.Minute},
+	} {
+		t.Run(name, func(t *testing.T) {
+			proxy := newFakeProxy(t, "banner", cfg)
+			first, rpcErr := bannerCall(t, proxy, 0)
+			if rpcErr != nil {
+				t.Fatalf("Expected the banner to be skipped, got %+v", rpcErr)
+			}
+
+			// The grace ends with the first message
+			if _, rpcErr := bannerCall(t, proxy, 2); rpcErr == nil {
+				t.Error("Expected junk after the first message to count")
+			}
+
+			// A restart in the middle of traffic starts a new grace, so the
+			// first request to the new instance succeeds
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				for i := 0; i < 20; i++ {
+					postJSON(proxy, `{"jsonrpc":"2.0","id":2,"method":"ping"}`)
+				}
+			}()
+			if status := exitBackend(t, proxy, 1); status.State != StateRunning {
+				t.Fatalf("Expected the MCP server to be restarted, got %+v", status)
+			}
+			<-done
+			pid, rpcErr := bannerCall(t, proxy, 0)
+			if rpcErr != nil || pid == first {
+				t.Fatalf("Expected the new instance to answer despite its banner, got %d %+v", pid, rpcErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,256 @@
+package mcpproxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Placeholders in Config.WrapperCommand.
+const (
+	wrapperCommand = "{command}" // the MCP server binary
+	wrapperArgs    = "{args}"    // CommandArgs, as separate arguments
+)
+
+// Launcher creates the commands that run the MCP server, for instance to run
+// it in another container. The proxy talks to the command over its stdin
+// and stdout and supervises the local process: it is restarted when it
+// exits, and killed when it closes its stdout but keeps running.
+type Launcher interface {
+	// Command returns an unstarted command running the MCP server binary at
+	// path with args. It should be killed once ctx is done, as with
+	// exec.CommandContext.
+	Command(ctx context.Context, path string, args []string) *exec.Cmd
+}
+
+// LauncherFunc adapts a function to the Launcher interface.
+type LauncherFunc func(ctx context.Context, path string, args []string) *exec.Cmd
+
+// Command calls f(ctx, path, args).
+func (f LauncherFunc) Command(ctx context.Context, path string, args []string) *exec.Cmd {
+	return f(ctx, path, args)
+}
+
+// execLauncher runs the MCP server directly, with the proxy's environment.
+type execLauncher struct{}
+
+func (execLauncher) Command(ctx context.Context, path string, args []string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, path, args...)
+	cmd.Env = os.Environ()
+	return cmd
+}
+
+// wrapperLauncher runs the MCP server through Config.WrapperCommand.
+type wrapperLauncher struct {
+	template []string
+}
+
+func (l wrapperLauncher) Command(ctx context.Context, path string, args []string) *exec.Cmd {
+	argv := expandWrapper(l.template, path, args)
+	return execLauncher{}.Command(ctx, argv[0], argv[1:])
+}
+
+// expandWrapper fills in the placeholders of a WrapperCommand.
+func expandWrapper(template []string, path string, args []string) []string {
+	argv := make([]string, 0, len(template)+len(args))
+	for _, arg := range template {
+		if arg == wrapperArgs {
+			argv = append(argv, args...)
+			continue
+		}
+		argv = append(argv, strings.ReplaceAll(arg, wrapperCommand, path))
+	}
+	return argv
+}
+
+// defaultShellCommand runs the command line when Config.UseShell is set and
+// ShellCommand is not.
+var defaultShellCommand = []string{"/bin/sh", "-c"}
+
+// shellLauncher runs the command line as a script with Config.ShellCommand,
+// through another launcher.
+type shellLauncher struct {
+	shell []string
+	next  Launcher
+}
+
+func (l shellLauncher) Command(ctx context.Context, path string, args []string) *exec.Cmd {
+	script := strings.Join(append([]string{path}, args...), " ")
+	return l.next.Command(ctx, l.shell[0], append(l.shell[1:len(l.shell):len(l.shell)], script))
+}
+
+// launcher returns the Launcher configured by cfg.
+func launcher(cfg Config) Launcher {
+	var l Launcher = execLauncher{}
+	switch {
+	case cfg.Launcher != nil:
+		l = cfg.Launcher
+	case len(cfg.WrapperCommand) > 0:
+		l = wrapperLauncher{template: cfg.WrapperCommand}
+	}
+	if cfg.UseShell {
+		shell := cfg.ShellCommand
+		if len(shell) == 0 {
+			shell = defaultShellCommand
+		}
+		l = shellLauncher{shell: shell, next: l}
+	}
+	return l
+}
+
+// backendCommand returns the command that runs the MCP server binary with
+// args, which are expanded, like its path, unless the shell does it. The
+// command line only ever comes from cfg and the proxy's environment, never
+// from requests.
+func backendCommand(ctx context.Context, cfg Config, args []string) (*exec.Cmd, error) {
+	if !cfg.UseShell {
+		var err error
+		if args, err = expandArgs(args, cfg.AllowUnsetArgVars); err != nil {
+			return nil, err
+		}
+	}
+	path, err := resolveCommandPath(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return launcher(cfg).Command(ctx, path, args), nil
+}
+
+// expandArgs replaces ${VAR} in args with the value of the environment
+// variable VAR and $$ with $. Any other $ is kept. Each argument stays one
+// argument whatever the values contain. Unset variables are an error unless
+// allowUnset is set, in which case they expand to "".
+func expandArgs(args []string, allowUnset bool) ([]string, error) {
+	expanded := make([]string, len(args))
+	for i, arg := range args {
+		var err error
+		if expanded[i], err = expandVars(arg, false, allowUnset); err != nil {
+			return nil, fmt.Errorf("argument %q: %w", arg, err)
+		}
+	}
+	return expanded, nil
+}
+
+// ExpandPath resolves a path from the configuration the way the proxy does
+// for CommandPath, ScratchRoot and ConfigFile: ${VAR} and $VAR are replaced
+// by the value of the environment variable VAR, $$ by $, and a leading ~ by
+// the home directory of the user running the proxy. Values are not expanded
+// again. Unset variables are an error rather than an empty string, which
+// would silently change the path.
+func ExpandPath(path string) (string, error) {
+	expanded, err := expandVars(path, true, false)
+	if err != nil {
+		return "", fmt.Errorf("path %q: %w", path, err)
+	}
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("path %q: %w", path, err)
+		}
+		expanded = home + expanded[1:]
+	}
+	return expanded, nil
+}
+
+// expandVars replaces ${VAR} in s with the value of the environment
+// variable VAR, and $VAR too if bare is set, and $$ with $. Any other $ is
+// kept. Unset variables are an error unless allowUnset is set, in which case
+// they expand to "".
+func expandVars(s string, bare, allowUnset bool) (string, error) {
+	var b strings.Builder
+	for rest := s; rest != ""; {
+		j := strings.IndexByte(rest, '$')
+		if j < 0 || j == len(rest)-1 {
+			b.WriteString(rest)
+			break
+		}
+		b.WriteString(rest[:j])
+		rest = rest[j:]
+
+		var name string
+		switch {
+		case rest[1] == '$':
+			b.WriteByte('$')
+			rest = rest[2:]
+			continue
+		case rest[1] == '{':
+			end := strings.IndexByte(rest, '}')
+			if end < 0 || !isEnvName(rest[2:end]) {
+				return "", errors.New("invalid variable reference")
+			}
+			name, rest = rest[2:end], rest[end+1:]
+		case bare && isEnvChar(rest[1], true):
+			end := 2
+			for end < len(rest) && isEnvChar(rest[end], false) {
+				end++
+			}
+			name, rest = rest[1:end], rest[end:]
+		default:
+			b.WriteByte('$')
+			rest = rest[1:]
+			continue
+		}
+		value, ok := os.LookupEnv(name)
+		if !ok && !allowUnset {
+			return "", fmt.Errorf("references unset environment variable %s", name)
+		}
+		b.WriteString(value)
+	}
+	return b.String(), nil
+}
+
+// isEnvName reports whether name is a valid environment variable name.
+func isEnvName(name string) bool {
+	for i := 0; i < len(name); i++ {
+		if !isEnvChar(name[i], i == 0) {
+			return false
+		}
+	}
+	return name != ""
+}
+
+// isEnvChar reports whether c may appear in an environment variable name,
+// as its first character if first is set.
+func isEnvChar(c byte, first bool) bool {
+	switch {
+	case c == '_', c >= 'A' && c <= 'Z', c >= 'a' && c <= 'z':
+		return true
+	case c >= '0' && c <= '9':
+		return !first
+	}
+	return false
+}
+
+// validatePaths checks that the paths in cfg can be expanded, see
+// ExpandPath. CommandPath is left to the shell with UseShell.
+func validatePaths(cfg Config) error {
+	paths := map[string]string{"ScratchRoot": cfg.ScratchRoot}
+	if !cfg.UseShell {
+		paths["CommandPath"] = cfg.CommandPath
+	}
+	for name, path := range paths {
+		if _, err := ExpandPath(path); err != nil {
+			return fmt.Errorf("invalid %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// validateWrapper checks that cfg.WrapperCommand can run the MCP server.
+func validateWrapper(cfg Config) error {
+	if len(cfg.WrapperCommand) == 0 {
+		return nil
+	}
+	if cfg.Launcher != nil {
+		return errors.New("WrapperCommand and Launcher cannot both be set")
+	}
+	for _, arg := range cfg.WrapperCommand {
+		if strings.Contains(arg, wrapperCommand) {
+			return nil
+		}
+	}
+	return errors.New("WrapperCommand must contain " + wrapperCommand)
+}
@@ -0,0 +1,202 @@
+package mcpproxy
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rh-ai-kickstart/ai-architecture-charts/mcp-servers/mcpproxy/internal/fakebackend"
+)
+
+func TestExpandWrapper(t *testing.T) {
+	got := expandWrapper([]string{"oc", "exec", "-i", "pod", "--", "{command}", "{args}", "--trace={command}.log"},
+		"/opt/sql", []string{"-mcp", "-S"})
+	want := []string{"oc", "exec", "-i", "pod", "--", "/opt/sql", "-mcp", "-S", "--trace=/opt/sql.log"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expandWrapper = %q, want %q", got, want)
+	}
+}
+
+func TestWrapperCommandValidation(t *testing.T) {
+	cfg := fakeConfig("mcp")
+	cfg.WrapperCommand = []string{"env", "{args}"}
+	if _, err := NewMCPProxy(cfg); err == nil || !strings.Contains(err.Error(), "{command}") {
+		t.Errorf("Expected an error about the missing placeholder, got %v", err)
+	}
+}
+
+func TestWrapperCommand(t *testing.T) {
+	proxy := newFakeProxy(t, "mcp", Config{
+		WrapperCommand: []string{"env", "MCP_WRAPPED=1", "{command}", "{args}"},
+	})
+
+	w := postJSON(proxy, `{"jsonrpc":"2.0","id":1,"method":"tools/list"}`)
+	if w.Code != 200 || !strings.Contains(w.Body.String(), `"echo"`) {
+		t.Errorf("Expected tools through the wrapper, got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestLauncher(t *testing.T) {
+	var launches atomic.Int32
+	cfg := Config{
+		BackendVersionArgs: []string{fakebackend.Arg, "version"},
+		Launcher: LauncherFunc(func(ctx context.Context, path string, args []string) *exec.Cmd {
+			launches.Add(1)
+			return execLauncher{}.Command(ctx, path, args)
+		}),
+	}
+	proxy := newFakeProxy(t, "mcp", cfg)
+	if proxy.backendVersion != "fake-mcp-backend 1.0" {
+		t.Errorf("Expected the version through the launcher, got %q", proxy.backendVersion)
+	}
+	if n := launches.Load(); n != 2 {
+		t.Errorf("Expected 2 launches, got %d", n)
+	}
+}
+
+func TestLingeringWrapperIsKilled(t *testing.T) {
+	fastRestarts(t)
+	saved := lingerGrace
+	lingerGrace = 50 * time.Millisecond
+	t.Cleanup(func() { lingerGrace = saved })
+
+	// The wrapper outlives a failed MCP server, with its output detached.
+	proxy := newFakeProxy(t, "exit", Config{
+		MaxRestarts:    1,
+		WrapperCommand: []string{"sh", "-c", `"$0" "$@" || exec sleep 60 >/dev/null 2>&1`, "{command}", "{args}"},
+	})
+	pid := proxy.Status().PID
+
+	status := exitBackend(t, proxy, 3)
+	if status.State != StateRunning || status.Restarts != 1 || status.PID == pid {
+		t.Fatalf("Expected the lingering wrapper to be replaced, got %+v", status)
+	}
+	if status.LastExit == nil || status.LastExit.Code != -1 {
+		t.Errorf("Expected the wrapper to have been killed, got %+v", status.LastExit)
+	}
+	if w := postJSON(proxy, `{"jsonrpc":"2.0","id":2,"method":"ping"}`); w.Code != 200 {
+		t.Errorf("Expected the restarted server to answer, got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestExpandArgs(t *testing.T) {
+	t.Setenv("MCP_TEST_USER", "scott")
+	t.Setenv("MCP_TEST_META", `a b; rm -rf / $(id) "q"`)
+	os.Unsetenv("MCP_TEST_UNSET")
+
+	got, err := expandArgs([]string{"-u", "${MCP_TEST_USER}/tiger", "$${MCP_TEST_USER}", "cost: $5$", "${MCP_TEST_META}"}, false)
+	want := []string{"-u", "scott/tiger", "${MCP_TEST_USER}", "cost: $5$", `a b; rm -rf / $(id) "q"`}
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("expandArgs = %q, %v; want %q", got, err, want)
+	}
+
+	if _, err := expandArgs([]string{"${MCP_TEST_UNSET}"}, false); err == nil || !strings.Contains(err.Error(), "MCP_TEST_UNSET") {
+		t.Errorf("Expected an error for an unset variable, got %v", err)
+	}
+	if got, err := expandArgs([]string{"x${MCP_TEST_UNSET}y"}, true); err != nil || got[0] != "xy" {
+		t.Errorf("Expected unset variables to expand to nothing, got %q, %v", got, err)
+	}
+	for _, arg := range []string{"${MCP_TEST_USER", "${1X}", "${}"} {
+		if _, err := expandArgs([]string{arg}, true); err == nil {
+			t.Errorf("Expected %q to be rejected", arg)
+		}
+	}
+}
+
+func TestExpandPath(t *testing.T) {
+	t.Setenv("MCP_TEST_HOME", "/opt/sqlcl")
+	t.Setenv("MCP_TEST_SUB", "bin")
+	t.Setenv("MCP_TEST_DOLLAR", "$MCP_TEST_HOME")
+	os.Unsetenv("MCP_TEST_UNSET")
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Skip("No home directory")
+	}
+
+	for path, want := range map[string]string{
+		"$MCP_TEST_HOME/bin/sql":               "/opt/sqlcl/bin/sql",
+		"${MCP_TEST_HOME}/${MCP_TEST_SUB}/sql": "/opt/sqlcl/bin/sql",
+		"$MCP_TEST_HOME$MCP_TEST_SUB":          "/opt/sqlclbin",
+		"${MCP_TEST_HOME}_x":                   "/opt/sqlcl_x",
+		"/srv/$MCP_TEST_DOLLAR":                "/srv/$MCP_TEST_HOME",
+		"/srv/$$MCP_TEST_HOME":                 "/srv/$MCP_TEST_HOME",
+		"/srv/$$$MCP_TEST_SUB":                 "/srv/$bin",
+		"/srv/cost$":                           "/srv/cost$",
+		"/srv/$1":                              "/srv/$1",
+		"~":                                    home,
+		"~/bin/server":                         home + "/bin/server",
+		"/srv/~/x":                             "/srv/~/x",
+		"~other/x":                             "~other/x",
+		"":                                     "",
+	} {
+		if got, err := ExpandPath(path); err != nil || got != want {
+			t.Errorf("ExpandPath(%q) = %q, %v; want %q", path, got, err, want)
+		}
+	}
+
+	for _, path := range []string{"$MCP_TEST_UNSET/bin", "${MCP_TEST_UNSET}", "${MCP_TEST_HOME"} {
+		if _, err := ExpandPath(path); err == nil {
+			t.Errorf("Expected %q to be rejected", path)
+		}
+	}
+
+	// Unset variables fail the proxy at startup
+	cfg := fakeConfig("ack")
+	cfg.CommandPath = "$MCP_TEST_UNSET/server"
+	if _, err := NewMCPProxy(cfg); err == nil || !strings.Contains(err.Error(), "MCP_TEST_UNSET") {
+		t.Errorf("Expected an unset variable in CommandPath to be rejected, got %v", err)
+	}
+
+	// The MCP server is found through a variable
+	cfg = fakeConfig("ack")
+	t.Setenv("MCP_TEST_BIN", filepath.Dir(cfg.CommandPath))
+	cfg.CommandPath = "${MCP_TEST_BIN}/" + filepath.Base(cfg.CommandPath)
+	proxy, err := NewMCPProxy(cfg)
+	if err != nil {
+		t.Fatalf("NewMCPProxy failed: %v", err)
+	}
+	defer proxy.Close()
+	if w := postJSON(proxy, `{"jsonrpc":"2.0","id":1,"method":"x"}`); w.Code != 200 {
+		t.Errorf("Expected the expanded CommandPath to run, got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestCommandArgsExpansion(t *testing.T) {
+	t.Setenv("MCP_TEST_MODE", "mcp")
+	cfg := fakeConfig("mcp")
+	cfg.CommandArgs = []string{fakebackend.Arg, "${MCP_TEST_MODE}"}
+	proxy, err := NewMCPProxy(cfg)
+	if err != nil {
+		t.Fatalf("NewMCPProxy failed: %v", err)
+	}
+	defer proxy.Close()
+	if w := postJSON(proxy, `{"jsonrpc":"2.0","id":1,"method":"tools/list"}`); !strings.Contains(w.Body.String(), `"echo"`) {
+		t.Errorf("Expected the expanded mode to run, got %s", w.Body.String())
+	}
+
+	os.Unsetenv("MCP_TEST_MODE")
+	if _, err := NewMCPProxy(cfg); err == nil || !strings.Contains(err.Error(), "MCP_TEST_MODE") {
+		t.Errorf("Expected an unset variable to fail the start, got %v", err)
+	}
+}
+
+func TestUseShell(t *testing.T) {
+	t.Setenv("MCP_TEST_MODE", "mcp")
+	// The shell, not the proxy, expands the variable and runs the command.
+	proxy := newFakeProxy(t, "${MCP_TEST_MODE}", Config{UseShell: true})
+
+	if w := postJSON(proxy, `{"jsonrpc":"2.0","id":1,"method":"tools/list"}`); !strings.Contains(w.Body.String(), `"echo"`) {
+		t.Errorf("Expected the server to run through the shell, got %s", w.Body.String())
+	}
+
+	cmd := shellLauncher{shell: []string{"bash", "-e", "-c"}, next: execLauncher{}}.Command(context.Background(), "exec /bin/x", []string{"-a", "$B"})
+	if want := []string{"bash", "-e", "-c", "exec /bin/x -a $B"}; !reflect.DeepEqual(cmd.Args, want) {
+		t.Errorf("Shell command = %q, want %q", cmd.Args, want)
+	}
+}
@@ -0,0 +1,171 @@
+package mcpproxy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// leakGrace is how long goroutines get to finish after the tests, longer
+// than lingerGrace so that lingering MCP servers are killed first.
+var leakGrace = 10 * time.Second
+
+// ignoredGoroutines are functions whose goroutines run for the life of
+// the test binary.
+var ignoredGoroutines = []string{
+	"os/signal.signal_recv",
+	"os/signal.loop",
+	"runtime.ensureSigM",
+	"testing.(*M).startAlarm",
+	"testing.(*M).Run",
+}
+
+// leakedGoroutines returns the stacks of the goroutines other than the
+// caller's that are still running after leakGrace, like goleak does.
+func leakedGoroutines() []string {
+	deadline := time.Now().Add(leakGrace)
+	for {
+		leaked := runningGoroutines()
+		if len(leaked) == 0 || time.Now().After(deadline) {
+			return leaked
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// runningGoroutines returns the stacks of the goroutines other than the
+// caller's and ignoredGoroutines.
+func runningGoroutines() []string {
+	buf := make([]byte, 1<<20)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+	var running []string
+	// The caller's goroutine comes first
+	for _, stack := range strings.Split(string(buf), "\n\n")[1:] {
+		ignored := false
+		for _, fn := range ignoredGoroutines {
+			if strings.Contains(stack, "\n"+fn+"(") {
+				ignored = true
+				break
+			}
+		}
+		if !ignored {
+			running = append(running, stack)
+		}
+	}
+	return running
+}
+
+func TestRestartSoakLeaksNoGoroutines(t *testing.T) {
+	fastRestarts(t)
+	proxy := newFakeProxy(t, "reflect", Config{EnableNotificationStream: true, SSEInactivityTimeout: 10 * time.Millisecond})
+
+	// Each round opens and drops a notification stream, answers a request
+	// and restarts the MCP server
+	round := func(i int) {
+		t.Helper()
+		ctx, cancel := context.WithCancel(context.Background())
+		streamed := make(chan struct{})
+		go func() {
+			defer close(streamed)
+			proxy.handleNotificationStream(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil).WithContext(ctx))
+		}()
+		if w := postJSON(proxy, fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":"ping"}`, i)); w.Code != http.StatusOK {
+			t.Fatalf("Unexpected response %d: %s", w.Code, w.Body.String())
+		}
+		cancel()
+		<-streamed
+		if err := proxy.Restart("soak"); err != nil {
+			t.Fatalf("Restart failed: %v", err)
+		}
+		waitForRestarts(t, proxy, i)
+	}
+
+	round(1)
+	baseline := stableGoroutines()
+	for i := 2; i <= 101; i++ {
+		round(i)
+	}
+	if running := settledGoroutines(baseline); len(running) > baseline {
+		t.Errorf("Expected %d goroutines after 100 restarts, got %d:\n\n%s", baseline, len(running), strings.Join(running, "\n\n"))
+	}
+}
+
+// stableGoroutines returns the number of runningGoroutines once it stops
+// changing.
+func stableGoroutines() int {
+	last := len(runningGoroutines())
+	for i := 0; i < 100; i++ {
+		time.Sleep(50 * time.Millisecond)
+		n := len(runningGoroutines())
+		if n == last {
+			break
+		}
+		last = n
+	}
+	return last
+}
+
+// settledGoroutines returns runningGoroutines once there are no more than
+// want of them, or after a few seconds.
+func settledGoroutines(want int) []string {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		running := runningGoroutines()
+		if len(running) <= want || time.Now().After(deadline) {
+			return running
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// checkGoroutines fails t if goroutines started after the call are still
+// running once the cleanups registered after it, like closing a proxy,
+// have run.
+func checkGoroutines(t testing.TB) {
+	t.Helper()
+	baseline := map[string]bool{}
+	for _, stack := range runningGoroutines() {
+		baseline[goroutineID(stack)] = true
+	}
+	t.Cleanup(func() {
+		var started []string
+		deadline := time.Now().Add(leakGrace)
+		for {
+			started = started[:0]
+			for _, stack := range runningGoroutines() {
+				if !baseline[goroutineID(stack)] {
+					started = append(started, stack)
+				}
+			}
+			if len(started) == 0 || time.Now().After(deadline) {
+				break
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+		if len(started) > 0 {
+			t.Errorf("%d goroutines leaked:\n\n%s", len(started), strings.Join(started, "\n\n"))
+		}
+	})
+}
+
+// goroutineID returns the ID from the header line of stack, e.g. "goroutine
+// 7 [running]:".
+func goroutineID(stack string) string {
+	fields := strings.Fields(stack)
+	if len(fields) < 2 {
+		return ""
+	}
+	return fields[1]
+}
@@ -0,0 +1,161 @@
+package mcpproxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// legacySSEPath is the endpoint served by Config.LegacySSECompat, unless
+// Config.DeprecateSSE takes it over and moves it to movedLegacySSEPath.
+const (
+	legacySSEPath      = "/sse"
+	movedLegacySSEPath = "/legacy/sse"
+)
+
+// legacySSEPaths returns the paths cfg reserves for the legacy /sse
+// endpoint.
+func legacySSEPaths(cfg Config) []string {
+	switch {
+	case cfg.DeprecateSSE && cfg.LegacySSECompat:
+		return []string{legacySSEPath, movedLegacySSEPath}
+	case cfg.DeprecateSSE || cfg.LegacySSECompat:
+		return []string{legacySSEPath}
+	}
+	return nil
+}
+
+// handleDeprecatedSSE answers requests to /sse with 410 Gone when
+// Config.DeprecateSSE is set, telling clients where to go instead.
+func (p *MCPProxy) handleDeprecatedSSE(w http.ResponseWriter, r *http.Request) {
+	p.log.Warn("Removed /sse endpoint used, switch to the MCP endpoint at /",
+		"remote", r.RemoteAddr, "identity", identity(r), "method", r.Method)
+	p.metrics.legacySSE.Inc(r.Method)
+
+	body := map[string]string{
+		"error":    "The /sse endpoint has been removed, send MCP requests to the MCP endpoint instead",
+		"endpoint": "/",
+	}
+	if p.config.LegacySSECompat {
+		body["legacyEndpoint"] = movedLegacySSEPath
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusGone)
+	json.NewEncoder(w).Encode(body)
+}
+
+// handleLegacySSE serves the deprecated /sse endpoint with its original
+// behavior: a POSTed JSON-RPC message is answered with its response as a
+// single "message" event, and GET opens an event stream that carries no
+// events but Config.SSEInitialEvent.
+func (p *MCPProxy) handleLegacySSE(w http.ResponseWriter, r *http.Request) {
+	p.log.Warn("Deprecated "+r.URL.Path+" endpoint used, switch to the MCP endpoint at /",
+		"remote", r.RemoteAddr, "identity", identity(r), "method", r.Method)
+	p.metrics.legacySSE.Inc(r.Method)
+
+	switch r.Method {
+	case http.MethodGet:
+		setSSEHeaders(w)
+		w.WriteHeader(http.StatusOK)
+		if event := p.config.SSEInitialEvent; event != "" {
+			fmt.Fprintf(w, "event: %s\ndata: %s?sessionId=%s\n\n", event, r.URL.Path, newSessionID())
+		}
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+		idle := p.newIdleTimer()
+		defer idle.stop()
+		for {
+			select {
+			case <-idle.c:
+				if !p.heartbeat(w, r) {
+					return
+				}
+				continue
+			case <-r.Context().Done():
+			case <-p.stopping:
+			}
+			return
+		}
+
+	case http.MethodPost, http.MethodOptions:
+		var resp capturedResponse
+		p.Handle(&resp, r)
+
+		// Only JSON-RPC responses become events; notifications and
+		// failures are passed through as is.
+		if resp.status != http.StatusOK || !strings.HasPrefix(resp.header.Get("Content-Type"), "application/json") {
+			resp.writeTo(w)
+			return
+		}
+		for k, v := range resp.header {
+			if k != "Content-Type" {
+				w.Header()[k] = v
+			}
+		}
+		setSSEHeaders(w)
+		if seq := resp.header.Get(sequenceHeader); seq != "" {
+			fmt.Fprintf(w, "id: %s\n", seq)
+		}
+		fmt.Fprintf(w, "event: message\ndata: %s\n\n", bytes.TrimRight(resp.body.Bytes(), "\n"))
+
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// validateSSEInitialEvent checks that cfg.SSEInitialEvent fits on the
+// event line.
+func validateSSEInitialEvent(cfg Config) error {
+	if strings.ContainsAny(cfg.SSEInitialEvent, "\r\n") {
+		return fmt.Errorf("SSEInitialEvent must not contain line breaks, got %q", cfg.SSEInitialEvent)
+	}
+	return nil
+}
+
+func setSSEHeaders(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+}
+
+// capturedResponse is an http.ResponseWriter that keeps the response so it
+// can be rewritten before being sent.
+type capturedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (c *capturedResponse) Header() http.Header {
+	if c.header == nil {
+		c.header = make(http.Header)
+	}
+	return c.header
+}
+
+func (c *capturedResponse) WriteHeader(status int) {
+	if c.status == 0 {
+		c.status = status
+	}
+}
+
+func (c *capturedResponse) Write(b []byte) (int, error) {
+	c.WriteHeader(http.StatusOK)
+	return c.body.Write(b)
+}
+
+// writeTo sends the captured response to w unchanged.
+func (c *capturedResponse) writeTo(w http.ResponseWriter) {
+	for k, v := range c.header {
+		w.Header()[k] = v
+	}
+	if c.status == 0 {
+		c.status = http.StatusOK
+	}
+	w.WriteHeader(c.status)
+	w.Write(c.body.Bytes())
+}
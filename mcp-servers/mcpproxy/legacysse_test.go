@@ -0,0 +1,169 @@
+package mcpproxy
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLegacySSEPost(t *testing.T) {
+	proxy := newFakeProxy(t, "reflect", Config{LegacySSECompat: true, EnableMetrics: true})
+	handler := proxy.Handler()
+
+	req := httptest.NewRequest("POST", "/sse", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"ping"}`))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	// The wire format earlier proxies used, which clients parse
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", w.Code)
+	}
+	for header, want := range map[string]string{
+		"Content-Type":  "text/event-stream",
+		"Cache-Control": "no-cache",
+		"Connection":    "keep-alive",
+	} {
+		if got := w.Header().Get(header); got != want {
+			t.Errorf("Expected %s %q, got %q", header, want, got)
+		}
+	}
+	if want := "event: message\ndata: {\"id\":1,\"jsonrpc\":\"2.0\",\"result\":{}}\n\n"; w.Body.String() != want {
+		t.Errorf("Expected body %q, got %q", want, w.Body.String())
+	}
+
+	// Notifications are accepted without an event
+	req = httptest.NewRequest("POST", "/sse", strings.NewReader(`{"jsonrpc":"2.0","method":"notifications/initialized"}`))
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusAccepted || w.Body.Len() != 0 {
+		t.Errorf("Expected 202 for a notification, got %d %q", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if !strings.Contains(w.Body.String(), `mcp_proxy_legacy_sse_requests_total{server="test",http_method="POST"} 2`) {
+		t.Errorf("Expected legacy requests to be counted, got:\n%s", w.Body.String())
+	}
+}
+
+func TestLegacySSEGet(t *testing.T) {
+	proxy := newFakeProxy(t, "reflect", Config{LegacySSECompat: true})
+	server := httptest.NewServer(proxy.Handler())
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", server.URL+"/sse", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET /sse failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("Expected an event stream, got %s %v", resp.Status, resp.Header)
+	}
+
+	// The stream stays open without events
+	read := make(chan int, 1)
+	go func() {
+		n, _ := resp.Body.Read(make([]byte, 1))
+		read <- n
+	}()
+	select {
+	case n := <-read:
+		t.Errorf("Expected no data on the stream, read %d bytes", n)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestLegacySSEInitialEvent(t *testing.T) {
+	proxy := newFakeProxy(t, "reflect", Config{LegacySSECompat: true, SSEInitialEvent: "endpoint"})
+	server := httptest.NewServer(proxy.Handler())
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", server.URL+"/sse", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET /sse failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	// The event tells the client where to POST
+	reader := bufio.NewReader(resp.Body)
+	event, _ := reader.ReadString('\n')
+	data, _ := reader.ReadString('\n')
+	if event != "event: endpoint\n" || !regexp.MustCompile(`^data: /sse\?sessionId=[0-9a-f]{32}\n$`).MatchString(data) {
+		t.Fatalf("Expected an endpoint event, got %q %q", event, data)
+	}
+	endpoint := strings.TrimSpace(strings.TrimPrefix(data, "data: "))
+	post, err := http.Post(server.URL+endpoint, "application/json", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"ping"}`))
+	if err != nil {
+		t.Fatalf("POST %s failed: %v", endpoint, err)
+	}
+	defer post.Body.Close()
+	if body, _ := io.ReadAll(post.Body); !strings.HasPrefix(string(body), "event: message\n") {
+		t.Errorf("Expected a message event from %s, got %s %q", endpoint, post.Status, body)
+	}
+
+	if _, err := NewMCPProxy(Config{ServerName: "test", CommandPath: "true", SSEInitialEvent: "a\nb"}); err == nil {
+		t.Error("Expected an event name with a line break to be rejected")
+	}
+}
+
+func TestWithoutLegacySSE(t *testing.T) {
+	proxy := newFakeProxy(t, "reflect", Config{})
+
+	req := httptest.NewRequest("POST", "/sse", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"ping"}`))
+	w := httptest.NewRecorder()
+	proxy.Handler().ServeHTTP(w, req)
+	if w.Header().Get("Content-Type") != "application/json" || !strings.HasPrefix(w.Body.String(), "{") {
+		t.Errorf("Expected a plain JSON response, got %v %q", w.Header(), w.Body.String())
+	}
+}
+
+func TestDeprecateSSE(t *testing.T) {
+	for _, legacy := range []bool{false, true} {
+		proxy := newFakeProxy(t, "reflect", Config{DeprecateSSE: true, LegacySSECompat: legacy, AuthToken: "s3cret"})
+		handler := proxy.Handler()
+
+		for _, method := range []string{"GET", "POST"} {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(method, "/sse", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"ping"}`)))
+			if w.Code != http.StatusGone || w.Header().Get("Content-Type") != "application/json" {
+				t.Fatalf("Expected 410 with a JSON body for %s /sse, got %d %s", method, w.Code, w.Header().Get("Content-Type"))
+			}
+			var body map[string]string
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("Expected a JSON body, got %q", w.Body.String())
+			}
+			if !strings.Contains(body["error"], "/sse endpoint has been removed") || body["endpoint"] != "/" {
+				t.Errorf("Expected the body to point to the MCP endpoint, got %v", body)
+			}
+			if _, ok := body["legacyEndpoint"]; ok != legacy {
+				t.Errorf("LegacySSECompat=%v: unexpected legacyEndpoint in %v", legacy, body)
+			}
+		}
+
+		// The old behavior moves to /legacy/sse
+		req := httptest.NewRequest("POST", "/legacy/sse", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"ping"}`))
+		req.Header.Set("Authorization", "Bearer s3cret")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if got := w.Header().Get("Content-Type") == "text/event-stream"; got != legacy {
+			t.Errorf("LegacySSECompat=%v: got %d %s from /legacy/sse", legacy, w.Code, w.Header().Get("Content-Type"))
+		}
+	}
+
+	if _, err := resolveConfig(Config{DeprecateSSE: true, ExtraRoutes: map[string]http.HandlerFunc{"/sse": func(http.ResponseWriter, *http.Request) {}}}); err == nil {
+		t.Error("Expected a /sse route to conflict with DeprecateSSE")
+	}
+}
@@ -0,0 +1,93 @@
+//go:build linux
+
+package mcpproxy
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+// applyProcessLimits sets the scheduling priority and resource limits from
+// cfg on the process with the given pid.
+func applyProcessLimits(pid int, cfg Config) error {
+	if cfg.Nice != 0 {
+		// The kernel takes the absolute niceness; the child inherited ours.
+		current, err := getNice(pid)
+		if err != nil {
+			return fmt.Errorf("failed to read priority: %w", err)
+		}
+		if err := syscall.Setpriority(syscall.PRIO_PROCESS, pid, current+cfg.Nice); err != nil {
+			return fmt.Errorf("failed to set priority: %w", err)
+		}
+	}
+
+	if len(cfg.CPUAffinity) > 0 {
+		if err := setAffinity(pid, cfg.CPUAffinity); err != nil {
+			return fmt.Errorf("failed to pin to CPUs %v: %w", cfg.CPUAffinity, err)
+		}
+	}
+
+	limits := []struct {
+		resource int
+		name     string
+		value    uint64
+	}{
+		{syscall.RLIMIT_AS, "address space", cfg.ResourceLimits.MaxMemoryBytes},
+		{syscall.RLIMIT_CPU, "CPU time", cfg.ResourceLimits.MaxCPUSeconds},
+		{syscall.RLIMIT_NOFILE, "open files", cfg.ResourceLimits.MaxOpenFiles},
+	}
+	for _, l := range limits {
+		if l.value == 0 {
+			continue
+		}
+		if err := prlimit(pid, l.resource, &syscall.Rlimit{Cur: l.value, Max: l.value}); err != nil {
+			return fmt.Errorf("failed to limit %s to %d: %w", l.name, l.value, err)
+		}
+	}
+	return nil
+}
+
+// warnIgnoredLimits does nothing on Linux, where all limits are supported.
+func warnIgnoredLimits(cfg Config, logger Logger) {}
+
+// getNice returns the niceness of pid. getpriority(2) returns 20-nice to
+// avoid negative results, which the raw syscall exposes.
+func getNice(pid int) (int, error) {
+	prio, err := syscall.Getpriority(syscall.PRIO_PROCESS, pid)
+	if err != nil {
+		return 0, err
+	}
+	return 20 - prio, nil
+}
+
+func prlimit(pid, resource int, limit *syscall.Rlimit) error {
+	_, _, errno := syscall.RawSyscall6(syscall.SYS_PRLIMIT64,
+		uintptr(pid), uintptr(resource), uintptr(unsafe.Pointer(limit)), 0, 0, 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// setAffinity restricts pid to the given CPUs with sched_setaffinity(2). The
+// mask is a bitmap of CPUs in words of the native size.
+func setAffinity(pid int, cpus []int) error {
+	const wordBits = int(unsafe.Sizeof(uintptr(0)) * 8)
+	max := 0
+	for _, cpu := range cpus {
+		if cpu > max {
+			max = cpu
+		}
+	}
+	mask := make([]uintptr, max/wordBits+1)
+	for _, cpu := range cpus {
+		mask[cpu/wordBits] |= 1 << uint(cpu%wordBits)
+	}
+	_, _, errno := syscall.RawSyscall(syscall.SYS_SCHED_SETAFFINITY,
+		uintptr(pid), uintptr(len(mask))*unsafe.Sizeof(mask[0]), uintptr(unsafe.Pointer(&mask[0])))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
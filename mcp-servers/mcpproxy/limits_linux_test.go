@@ -0,0 +1,71 @@
+//go:build linux
+
+package mcpproxy
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestProcessLimits(t *testing.T) {
+	proxy := newFakeProxy(t, "reflect", Config{
+		Nice:           5,
+		ResourceLimits: ResourceLimits{MaxOpenFiles: 64, MaxCPUSeconds: 3600},
+	})
+	pid := proxy.currentBackend().cmd.Process.Pid
+
+	own, err := getNice(os.Getpid())
+	if err != nil {
+		t.Fatalf("getNice failed: %v", err)
+	}
+	if nice, err := getNice(pid); err != nil || nice != own+5 {
+		t.Errorf("Expected niceness %d, got %d (%v)", own+5, nice, err)
+	}
+
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/limits", pid))
+	if err != nil {
+		t.Fatalf("Failed to read limits: %v", err)
+	}
+	for _, want := range []string{"Max open files            64                   64", "Max cpu time              3600                 3600"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("Expected %q in limits:\n%s", want, data)
+		}
+	}
+}
+
+func TestCPUAffinity(t *testing.T) {
+	// Pin to the first CPU the tests may run on
+	status, err := os.ReadFile("/proc/self/status")
+	if err != nil {
+		t.Fatalf("Failed to read status: %v", err)
+	}
+	var cpu int
+	for _, line := range strings.Split(string(status), "\n") {
+		if list, ok := strings.CutPrefix(line, "Cpus_allowed_list:"); ok {
+			fmt.Sscanf(strings.TrimSpace(list), "%d", &cpu)
+		}
+	}
+
+	proxy := newFakeProxy(t, "reflect", Config{CPUAffinity: []int{cpu}})
+	pid := proxy.currentBackend().cmd.Process.Pid
+	status, err = os.ReadFile(fmt.Sprintf("/proc/%d/status", pid))
+	if err != nil {
+		t.Fatalf("Failed to read status: %v", err)
+	}
+	if want := fmt.Sprintf("Cpus_allowed_list:\t%d\n", cpu); !strings.Contains(string(status), want) {
+		t.Errorf("Expected %q in status:\n%s", want, status)
+	}
+
+	// A CPU the machine does not have fails the start
+	cfg := fakeConfig("reflect")
+	cfg.CPUAffinity = []int{maxCPU}
+	if _, err := NewMCPProxy(cfg); err == nil {
+		t.Error("Expected pinning to a missing CPU to fail")
+	}
+	cfg.CPUAffinity = []int{-1}
+	if _, err := NewMCPProxy(cfg); err == nil {
+		t.Error("Expected a negative CPU to be rejected")
+	}
+}
@@ -0,0 +1,23 @@
+//go:build !linux
+
+package mcpproxy
+
+import "errors"
+
+// applyProcessLimits fails if cfg asks for a niceness or resource limits,
+// which are only supported on Linux. CPUAffinity is ignored, see
+// warnIgnoredLimits.
+func applyProcessLimits(pid int, cfg Config) error {
+	if cfg.Nice != 0 || cfg.ResourceLimits != (ResourceLimits{}) {
+		return errors.New("Nice and ResourceLimits are only supported on Linux")
+	}
+	return nil
+}
+
+// warnIgnoredLimits warns that CPUAffinity, which is only supported on
+// Linux, is ignored.
+func warnIgnoredLimits(cfg Config, logger Logger) {
+	if len(cfg.CPUAffinity) > 0 {
+		logger.Warn("CPUAffinity is only supported on Linux, ignoring it", "cpus", cfg.CPUAffinity)
+	}
+}
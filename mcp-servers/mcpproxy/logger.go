@@ -0,0 +1,194 @@
+package mcpproxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+)
+
+// Logger receives the proxy's log messages, each with alternating keys and
+// values describing it, e.g. Info("Started MCP server", "pid", 42). Every
+// message carries the "server" key with Config.ServerName, and messages
+// about a request whose params._meta.traceId is set carry it as "traceId".
+// Implementations must be safe for concurrent use.
+type Logger interface {
+	Debug(msg string, keysAndValues ...interface{})
+	Info(msg string, keysAndValues ...interface{})
+	Warn(msg string, keysAndValues ...interface{})
+	Error(msg string, keysAndValues ...interface{})
+}
+
+// SlogLogger adapts l to Logger.
+func SlogLogger(l *slog.Logger) Logger {
+	return slogLogger{l: l}
+}
+
+type slogLogger struct {
+	l *slog.Logger
+}
+
+func (s slogLogger) Debug(msg string, kv ...interface{}) { s.l.Debug(msg, kv...) }
+func (s slogLogger) Info(msg string, kv ...interface{})  { s.l.Info(msg, kv...) }
+func (s slogLogger) Warn(msg string, kv ...interface{})  { s.l.Warn(msg, kv...) }
+func (s slogLogger) Error(msg string, kv ...interface{}) { s.l.Error(msg, kv...) }
+
+// fieldsLogger adds the same keys and values to every message.
+type fieldsLogger struct {
+	next Logger
+	kv   []interface{}
+}
+
+// withFields returns a Logger that adds kv to every message logged with l.
+func withFields(l Logger, kv ...interface{}) Logger {
+	return fieldsLogger{next: l, kv: kv}
+}
+
+func (f fieldsLogger) Debug(msg string, kv ...interface{}) { f.next.Debug(msg, f.with(kv)...) }
+func (f fieldsLogger) Info(msg string, kv ...interface{})  { f.next.Info(msg, f.with(kv)...) }
+func (f fieldsLogger) Warn(msg string, kv ...interface{})  { f.next.Warn(msg, f.with(kv)...) }
+func (f fieldsLogger) Error(msg string, kv ...interface{}) { f.next.Error(msg, f.with(kv)...) }
+
+func (f fieldsLogger) with(kv []interface{}) []interface{} {
+	return append(f.kv[:len(f.kv):len(f.kv)], kv...)
+}
+
+// newLogger returns the Logger for cfg: cfg.Logger, or the default slog
+// logger if unset, tagged with cfg.ServerName and redacting secrets.
+func newLogger(cfg Config) Logger {
+	return newRedactingLogger(cfg, newRedactor(cfg))
+}
+
+// newRedactingLogger returns the Logger for cfg, redacting secrets with r.
+func newRedactingLogger(cfg Config, r *redactor) Logger {
+	l := cfg.Logger
+	if l == nil {
+		l = SlogLogger(slog.Default())
+	}
+	return withFields(redactingLogger{next: l, r: r}, "server", cfg.ServerName)
+}
+
+// backendLogger returns a new Logger for an MCP server started by p,
+// redacting the secrets p does.
+func (p *MCPProxy) backendLogger() Logger {
+	return newRedactingLogger(p.config, p.redactor)
+}
+
+// logBody logs msg about a request or response body at debug level, with
+// the body itself unless Config.DisableBodyLogging is set.
+func (p *MCPProxy) logBody(log Logger, msg string, body []byte) {
+	if p.config.DisableBodyLogging {
+		log.Debug(msg, "bytes", len(body))
+		return
+	}
+	log.Debug(msg, "message", string(body))
+}
+
+// debugLogger logs every message at debug level, for messages that would
+// be noise at their usual level.
+type debugLogger struct {
+	next Logger
+}
+
+func (d debugLogger) Debug(msg string, kv ...interface{}) { d.next.Debug(msg, kv...) }
+func (d debugLogger) Info(msg string, kv ...interface{})  { d.next.Debug(msg, kv...) }
+func (d debugLogger) Warn(msg string, kv ...interface{})  { d.next.Debug(msg, kv...) }
+func (d debugLogger) Error(msg string, kv ...interface{}) { d.next.Debug(msg, kv...) }
+
+// LogLevel is a level of log messages, see Config.MethodLogLevels.
+type LogLevel string
+
+// The log levels.
+const (
+	LogDebug LogLevel = "debug"
+	LogInfo  LogLevel = "info"
+	LogWarn  LogLevel = "warn"
+	LogError LogLevel = "error"
+)
+
+// validateMethodLogLevels checks the levels of cfg.MethodLogLevels.
+func validateMethodLogLevels(cfg Config) error {
+	for method, level := range cfg.MethodLogLevels {
+		switch level {
+		case LogDebug, LogInfo, LogWarn, LogError:
+		default:
+			return fmt.Errorf("MethodLogLevels: invalid level %q for %s, expected debug, info, warn or error", level, method)
+		}
+	}
+	return nil
+}
+
+// levelLogger logs the debug and info messages it gets at one level, for
+// Config.MethodLogLevels. Warnings and errors keep theirs.
+type levelLogger struct {
+	next  Logger
+	level LogLevel
+}
+
+func (l levelLogger) Debug(msg string, kv ...interface{}) { l.log(msg, kv) }
+func (l levelLogger) Info(msg string, kv ...interface{})  { l.log(msg, kv) }
+func (l levelLogger) Warn(msg string, kv ...interface{})  { l.next.Warn(msg, kv...) }
+func (l levelLogger) Error(msg string, kv ...interface{}) { l.next.Error(msg, kv...) }
+
+func (l levelLogger) log(msg string, kv []interface{}) {
+	switch l.level {
+	case LogDebug:
+		l.next.Debug(msg, kv...)
+	case LogInfo:
+		l.next.Info(msg, kv...)
+	case LogWarn:
+		l.next.Warn(msg, kv...)
+	default:
+		l.next.Error(msg, kv...)
+	}
+}
+
+type loggerKey struct{}
+
+// withTraceID returns r with a logger that tags messages about it with the
+// trace id of msg, its JSON-RPC message, if it has one. See logFor.
+func (p *MCPProxy) withTraceID(r *http.Request, msg json.RawMessage) *http.Request {
+	id := traceID(msg)
+	if id == "" {
+		return r
+	}
+	return r.WithContext(context.WithValue(r.Context(), loggerKey{}, withFields(p.log, "traceId", id)))
+}
+
+// withMethodLogLevel returns r with a logger that logs the routine
+// messages about it at the level Config.MethodLogLevels sets for method, if
+// any. See logFor.
+func (p *MCPProxy) withMethodLogLevel(r *http.Request, method string) *http.Request {
+	level, ok := p.dynamic.Load().MethodLogLevels[method]
+	if !ok {
+		return r
+	}
+	return r.WithContext(context.WithValue(r.Context(), loggerKey{}, levelLogger{next: p.logFor(r), level: level}))
+}
+
+// logFor returns the Logger for messages about r.
+func (p *MCPProxy) logFor(r *http.Request) Logger {
+	if l, ok := r.Context().Value(loggerKey{}).(Logger); ok {
+		return l
+	}
+	return p.log
+}
+
+// traceID returns params._meta.traceId of a JSON-RPC message, which clients
+// set to correlate the proxy's logs with their own traces, or "".
+func traceID(msg json.RawMessage) string {
+	if !bytes.Contains(msg, []byte(`"traceId"`)) {
+		return ""
+	}
+	var m struct {
+		Params struct {
+			Meta struct {
+				TraceID string `json:"traceId"`
+			} `json:"_meta"`
+		} `json:"params"`
+	}
+	json.Unmarshal(msg, &m)
+	return m.Params.Meta.TraceID
+}
@@ -0,0 +1,179 @@
+package mcpproxy
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/rh-ai-kickstart/ai-architecture-charts/mcp-servers/mcpproxy/internal/fakebackend"
+)
+
+// recordingLogger is a Logger that records messages as
+// "LEVEL message key=value ...", one per line.
+type recordingLogger struct {
+	mu      sync.Mutex
+	entries []string
+}
+
+func (l *recordingLogger) Debug(msg string, kv ...interface{}) { l.record("DEBUG", msg, kv) }
+func (l *recordingLogger) Info(msg string, kv ...interface{})  { l.record("INFO", msg, kv) }
+func (l *recordingLogger) Warn(msg string, kv ...interface{})  { l.record("WARN", msg, kv) }
+func (l *recordingLogger) Error(msg string, kv ...interface{}) { l.record("ERROR", msg, kv) }
+
+func (l *recordingLogger) record(level, msg string, kv []interface{}) {
+	var b strings.Builder
+	b.WriteString(level + " " + msg)
+	for i := 0; i+1 < len(kv); i += 2 {
+		fmt.Fprintf(&b, " %v=%v", kv[i], kv[i+1])
+	}
+	l.mu.Lock()
+	l.entries = append(l.entries, b.String())
+	l.mu.Unlock()
+}
+
+func (l *recordingLogger) String() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return strings.Join(l.entries, "\n")
+}
+
+func TestCustomLogger(t *testing.T) {
+	var global bytes.Buffer
+	log.SetOutput(&global)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	// The shell writes to stderr before running the fake backend
+	logs := &recordingLogger{}
+	path, args := fakebackend.Command("exit")
+	proxy, err := NewMCPProxy(Config{
+		ServerName:  "test",
+		CommandPath: "echo starting >&2; exec " + path,
+		CommandArgs: args,
+		UseShell:    true,
+		Logger:      logs,
+	})
+	if err != nil {
+		t.Fatalf("NewMCPProxy failed: %v", err)
+	}
+	postJSON(proxy, `{"jsonrpc":"2.0","id":1,"method":"ping"}`)
+	exitBackend(t, proxy, 3)
+	proxy.Close()
+
+	for _, want := range []string{
+		"INFO Started MCP server server=test pid=",
+		"INFO MCP server stderr server=test line=starting",
+		`DEBUG Received HTTP request server=test message={"jsonrpc":"2.0","id":1,"method":"ping"}`,
+		"ERROR MCP server crashed server=test status=exit status 3",
+		"INFO Proxy closed server=test",
+	} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("Expected %q in the log, got:\n%s", want, logs.String())
+		}
+	}
+	if global.Len() != 0 {
+		t.Errorf("Expected nothing in the standard log, got:\n%s", global.String())
+	}
+}
+
+func TestSlogLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := newLogger(Config{
+		ServerName: "test",
+		Logger:     SlogLogger(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))),
+	})
+	logger.Debug("Sending", "message", "{}")
+	logger.Warn("Request body too large", "limit", 10)
+
+	for _, want := range []string{
+		`level=DEBUG msg=Sending server=test message={}`,
+		`level=WARN msg="Request body too large" server=test limit=10`,
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("Expected %q in the log, got:\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestTraceIDInLogs(t *testing.T) {
+	logs := &recordingLogger{}
+	proxy := newFakeProxy(t, "reflect", Config{Logger: logs})
+
+	postJSON(proxy, `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"_meta":{"traceId":"4bf92f35"}}}`)
+	postJSON(proxy, `{"jsonrpc":"2.0","id":2,"method":"ping"}`)
+
+	for _, want := range []string{
+		"DEBUG Received HTTP request server=test traceId=4bf92f35 message=",
+		"DEBUG Sending server=test traceId=4bf92f35 message=",
+		`DEBUG Sending HTTP response server=test traceId=4bf92f35 message={"id":1,`,
+	} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("Expected %q in the log, got:\n%s", want, logs.String())
+		}
+	}
+	for _, line := range strings.Split(logs.String(), "\n") {
+		if strings.Contains(line, `"id":2`) && strings.Contains(line, "traceId=") {
+			t.Errorf("Expected no trace id for a request without one, got %q", line)
+		}
+	}
+}
+
+func TestDisableBodyLogging(t *testing.T) {
+	body := `{"jsonrpc":"2.0","id":1,"method":"x","params":{"result":{"ssn":"123-45-6789"}}}`
+	for _, disabled := range []bool{false, true} {
+		logs := &recordingLogger{}
+		proxy := newFakeProxy(t, "reflect", Config{Logger: logs, DisableBodyLogging: disabled})
+		if w := postJSON(proxy, body); !strings.Contains(w.Body.String(), "123-45-6789") {
+			t.Fatalf("Expected the response to carry the payload, got %s", w.Body.String())
+		}
+
+		out := logs.String()
+		if got := strings.Contains(out, "123-45-6789"); got == disabled {
+			t.Errorf("DisableBodyLogging=%v: payload in log is %v:\n%s", disabled, got, out)
+		}
+		if disabled {
+			for _, want := range []string{"DEBUG Received HTTP request server=test bytes=", "DEBUG Sending server=test bytes=", "DEBUG Received server=test bytes=", "DEBUG Sending HTTP response server=test bytes="} {
+				if !strings.Contains(out, want) {
+					t.Errorf("Expected %q in the log:\n%s", want, out)
+				}
+			}
+		}
+	}
+}
+
+func TestMethodLogLevels(t *testing.T) {
+	logs := &recordingLogger{}
+	proxy := newFakeProxy(t, "mcp", Config{Logger: logs, MethodLogLevels: map[string]LogLevel{"ping": LogDebug, "tools/call": LogInfo}})
+
+	postJSON(proxy, `{"jsonrpc":"2.0","id":"ping","method":"ping"}`)
+	postJSON(proxy, `{"jsonrpc":"2.0","id":"call","method":"tools/call","params":{"name":"echo","arguments":{}}}`)
+
+	// The bodies, debug messages by default, follow the method's level
+	levels := make(map[string]string)
+	for _, entry := range strings.Split(logs.String(), "\n") {
+		level, rest, _ := strings.Cut(entry, " ")
+		for _, id := range []string{"ping", "call"} {
+			if strings.HasPrefix(rest, "Sending HTTP response") && strings.Contains(rest, `"id":"`+id+`"`) {
+				levels[id] = level
+			}
+		}
+	}
+	if levels["ping"] != "DEBUG" || levels["call"] != "INFO" {
+		t.Errorf("Expected the ping at debug and the tool call at info, got %v in:\n%s", levels, logs.String())
+	}
+
+	// Warnings keep their level
+	quiet := &recordingLogger{}
+	levelLogger{next: quiet, level: LogDebug}.Warn("Something is wrong")
+	if quiet.String() != "WARN Something is wrong" {
+		t.Errorf("Expected the warning to keep its level, got %q", quiet.String())
+	}
+
+	if err := validateMethodLogLevels(Config{MethodLogLevels: map[string]LogLevel{"ping": "verbose"}}); err == nil {
+		t.Error("Expected an invalid level to be rejected")
+	}
+}
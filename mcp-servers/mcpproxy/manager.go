@@ -0,0 +1,152 @@
+package mcpproxy
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Manager runs several proxies in one process, each mounted under its own
+// path prefix of a shared HTTP handler, and closes them together.
+type Manager struct {
+	mu      sync.Mutex
+	proxies map[string]*mountedProxy // by name
+	closed  bool
+}
+
+type mountedProxy struct {
+	prefix string
+	proxy  *MCPProxy
+}
+
+// NewManager returns a Manager without any proxies.
+func NewManager() *Manager {
+	return &Manager{proxies: make(map[string]*mountedProxy)}
+}
+
+// Add starts a proxy for cfg and mounts it under prefix, e.g. "/github", so
+// that its MCP endpoint is served at "/github/" and its other routes below
+// it, such as "/github/healthz". cfg.ServerName defaults to name. Each
+// proxy keeps its own configuration; Port is ignored since the Manager's
+// handler is served by the caller.
+func (m *Manager) Add(name, prefix string, cfg Config) (*MCPProxy, error) {
+	prefix = strings.TrimRight(prefix, "/")
+	if name == "" {
+		return nil, errors.New("proxy name must not be empty")
+	}
+	if !strings.HasPrefix(prefix, "/") {
+		return nil, fmt.Errorf("proxy %s: prefix must start with / and not be the root", name)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return nil, ErrProxyClosed
+	}
+	if _, ok := m.proxies[name]; ok {
+		return nil, fmt.Errorf("proxy %s is already registered", name)
+	}
+	for other, mp := range m.proxies {
+		if mp.prefix == prefix {
+			return nil, fmt.Errorf("proxy %s: prefix %s is already used by %s", name, prefix, other)
+		}
+	}
+
+	if cfg.ServerName == "" {
+		cfg.ServerName = name
+	}
+	proxy, err := NewMCPProxy(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("proxy %s: %w", name, err)
+	}
+	m.proxies[name] = &mountedProxy{prefix: prefix, proxy: proxy}
+	return proxy, nil
+}
+
+// Proxy returns the proxy added with the given name, or nil.
+func (m *Manager) Proxy(name string) *MCPProxy {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if mp, ok := m.proxies[name]; ok {
+		return mp.proxy
+	}
+	return nil
+}
+
+// Names returns the names of the proxies, sorted.
+func (m *Manager) Names() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	names := make([]string, 0, len(m.proxies))
+	for name := range m.proxies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Handler returns an http.Handler serving each proxy's Handler under its
+// prefix, with the prefix removed from the request path. Proxies added
+// later are not included.
+func (m *Manager) Handler() http.Handler {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	mux := http.NewServeMux()
+	for _, mp := range m.proxies {
+		mux.Handle(mp.prefix+"/", stripPrefix(mp.prefix, mp.proxy.Handler()))
+		mux.Handle(mp.prefix, stripPrefix(mp.prefix, mp.proxy.Handler()))
+	}
+	return mux
+}
+
+// stripPrefix is http.StripPrefix, except that the prefix itself becomes
+// "/" so that it reaches the MCP endpoint instead of an empty path.
+func stripPrefix(prefix string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r2 := r.Clone(r.Context())
+		r2.URL.Path = strings.TrimPrefix(r.URL.Path, prefix)
+		if r2.URL.Path == "" {
+			r2.URL.Path = "/"
+		}
+		r2.URL.RawPath = ""
+		h.ServeHTTP(w, r2)
+	})
+}
+
+// Close closes all proxies concurrently and returns their errors joined.
+// No proxies can be added afterwards.
+func (m *Manager) Close() error {
+	m.mu.Lock()
+	m.closed = true
+	proxies := make([]*mountedProxy, 0, len(m.proxies))
+	for _, mp := range m.proxies {
+		proxies = append(proxies, mp)
+	}
+	m.mu.Unlock()
+
+	errs := make([]error, len(proxies))
+	var wg sync.WaitGroup
+	for i, mp := range proxies {
+		wg.Add(1)
+		go func(i int, mp *mountedProxy) {
+			defer wg.Done()
+			if err := mp.proxy.Close(); err != nil {
+				errs[i] = fmt.Errorf("proxy %s: %w", mp.proxy.config.ServerName, err)
+			}
+		}(i, mp)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// ListenAndServe serves Handler on addr, e.g. ":8080", until the server
+// fails, and then closes all proxies.
+func (m *Manager) ListenAndServe(addr string) error {
+	err := http.ListenAndServe(addr, m.Handler())
+	m.Close()
+	return err
+}
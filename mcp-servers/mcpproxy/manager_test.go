@@ -0,0 +1,78 @@
+package mcpproxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rh-ai-kickstart/ai-architecture-charts/mcp-servers/mcpproxy/internal/fakebackend"
+)
+
+func TestManager(t *testing.T) {
+	checkGoroutines(t)
+	m := NewManager()
+	t.Cleanup(func() { m.Close() })
+
+	for _, name := range []string{"github", "oracle"} {
+		path, args := fakebackend.Command("exit")
+		if _, err := m.Add(name, "/"+name+"/", Config{CommandPath: path, CommandArgs: args}); err != nil {
+			t.Fatalf("Add %s failed: %v", name, err)
+		}
+	}
+	if _, err := m.Add("other", "/github", Config{}); err == nil {
+		t.Error("Expected a duplicate prefix to be rejected")
+	}
+	if names := m.Names(); len(names) != 2 || names[0] != "github" || names[1] != "oracle" {
+		t.Errorf("Expected both proxies, got %v", names)
+	}
+	handler := m.Handler()
+
+	// Each prefix reaches its own MCP server
+	pids := make(map[int]bool)
+	for _, path := range []string{"/github", "/github/", "/oracle/"} {
+		req := httptest.NewRequest("POST", path, strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"ping"}`))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		var resp struct {
+			Result struct {
+				PID int `json:"pid"`
+			} `json:"result"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Result.PID == 0 {
+			t.Fatalf("POST %s: unexpected response %d %q", path, w.Code, w.Body.String())
+		}
+		pids[resp.Result.PID] = true
+	}
+	if len(pids) != 2 {
+		t.Errorf("Expected two MCP servers, got PIDs %v", pids)
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/oracle/status", nil))
+	var status BackendStatus
+	json.Unmarshal(w.Body.Bytes(), &status)
+	if status.PID != m.Proxy("oracle").Status().PID {
+		t.Errorf("Expected the oracle proxy's status, got %s", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/unknown/", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 outside the prefixes, got %d", w.Code)
+	}
+
+	// Closing the manager closes every proxy
+	if err := m.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	for _, name := range m.Names() {
+		if state := m.Proxy(name).Status().State; state != StateStopped {
+			t.Errorf("Expected %s to be stopped, got %s", name, state)
+		}
+	}
+	if _, err := m.Add("late", "/late", Config{}); err == nil {
+		t.Error("Expected Add to fail after Close")
+	}
+}
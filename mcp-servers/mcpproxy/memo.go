@@ -0,0 +1,149 @@
+package mcpproxy
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// defaultResponseCacheSize is the default of Config.ResponseCacheSize.
+const defaultResponseCacheSize = 1000
+
+// memo holds the tool results cached by Config.ResponseCacheKey.
+type memo struct {
+	mu      sync.Mutex
+	size    int
+	entries map[string]*list.Element // of *memoEntry, by key
+	order   list.List                // oldest first
+}
+
+type memoEntry struct {
+	key      string
+	response json.RawMessage
+	expires  time.Time
+}
+
+// newMemo returns the cache for cfg, or nil if results are not cached.
+func newMemo(cfg Config) *memo {
+	if cfg.ResponseCacheKey == nil {
+		return nil
+	}
+	size := cfg.ResponseCacheSize
+	if size <= 0 {
+		size = defaultResponseCacheSize
+	}
+	return &memo{size: size, entries: make(map[string]*list.Element)}
+}
+
+// get returns the response cached under key, or nil if there is none or it
+// has expired.
+func (m *memo) get(key string, now time.Time) json.RawMessage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.entries[key]
+	if !ok {
+		return nil
+	}
+	entry := e.Value.(*memoEntry)
+	if !now.Before(entry.expires) {
+		m.remove(e)
+		return nil
+	}
+	return entry.response
+}
+
+// put caches response under key until expires, dropping the oldest entries
+// to stay within the size.
+func (m *memo) put(key string, response json.RawMessage, expires time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if e, ok := m.entries[key]; ok {
+		m.remove(e)
+	}
+	for m.order.Len() >= m.size {
+		m.remove(m.order.Front())
+	}
+	m.entries[key] = m.order.PushBack(&memoEntry{key: key, response: response, expires: expires})
+}
+
+// clear drops all cached results. It does nothing if m is nil.
+func (m *memo) clear() {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries = make(map[string]*list.Element)
+	m.order.Init()
+}
+
+func (m *memo) remove(e *list.Element) {
+	delete(m.entries, e.Value.(*memoEntry).key)
+	m.order.Remove(e)
+}
+
+// memoCall is a tools/call request whose result may be cached.
+type memoCall struct {
+	tool string
+	key  string
+	ttl  time.Duration
+}
+
+type memoKey struct{}
+
+// memoized answers the tools/call request msg from the cache if it holds
+// its result, reporting whether it did. Otherwise it returns r carrying the
+// request's cache key, if any, for memoize to store the result under.
+func (p *MCPProxy) memoized(w http.ResponseWriter, r *http.Request, dc *dynamicConfig, msg json.RawMessage, mcpMsg MCPMessage) (*http.Request, bool) {
+	if p.memo == nil || mcpMsg.Method != "tools/call" || !mcpMsg.HasID {
+		return r, false
+	}
+	var req struct {
+		Params struct {
+			Name      string          `json:"name"`
+			Arguments json.RawMessage `json:"arguments"`
+		} `json:"params"`
+	}
+	if json.Unmarshal(msg, &req) != nil {
+		return r, false
+	}
+	tool := req.Params.Name
+	key, ttl := p.config.ResponseCacheKey(tool, req.Params.Arguments)
+	if key == "" || ttl <= 0 {
+		p.metrics.responseCache.Inc(tool, "bypass")
+		return r, false
+	}
+	key = tool + "\x00" + key
+
+	response := p.memo.get(key, time.Now())
+	if response == nil {
+		p.metrics.responseCache.Inc(tool, "miss")
+		return r.WithContext(context.WithValue(r.Context(), memoKey{}, &memoCall{tool: tool, key: key, ttl: ttl})), false
+	}
+	p.metrics.responseCache.Inc(tool, "hit")
+	p.logFor(r).Debug("Answering from the response cache", "tool", tool)
+	p.writeResponse(w, r, mcpMsg.Method, withID(response, mcpMsg.ID), dc.UnwrapSingleContent && wantsRawContent(r))
+	return r, true
+}
+
+// memoize caches the response to a request carrying a memoCall if it is a
+// successful result. Errors and results flagged isError are not cached, so
+// the next call tries again.
+func (p *MCPProxy) memoize(r *http.Request, response json.RawMessage) {
+	call, ok := r.Context().Value(memoKey{}).(*memoCall)
+	if !ok {
+		return
+	}
+	var msg struct {
+		Result *struct {
+			IsError bool `json:"isError"`
+		} `json:"result"`
+	}
+	if json.Unmarshal(response, &msg) != nil || msg.Result == nil || msg.Result.IsError {
+		return
+	}
+	p.memo.put(call.key, response, time.Now().Add(call.ttl))
+}
@@ -0,0 +1,88 @@
+package mcpproxy
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResponseCache(t *testing.T) {
+	proxy := newFakeProxy(t, "slow", Config{
+		ResponseCacheKey: func(tool string, arguments json.RawMessage) (string, time.Duration) {
+			var args struct {
+				Path string `json:"path"`
+			}
+			json.Unmarshal(arguments, &args)
+			if tool != "read" {
+				return "", 0
+			}
+			return args.Path, 200 * time.Millisecond
+		},
+	})
+	call := func(id int, params string) string {
+		t.Helper()
+		w := postJSON(proxy, `{"jsonrpc":"2.0","id":`+strconv.Itoa(id)+`,"method":"tools/call","params":`+params+`}`)
+		return w.Body.String()
+	}
+
+	if body := call(1, `{"name":"read","arguments":{"path":"a"}}`); !strings.Contains(body, `"calls":1`) {
+		t.Fatalf("Expected the first call to reach the MCP server, got %s", body)
+	}
+	if body := call(2, `{"name":"read","arguments":{"path":"a"}}`); !strings.Contains(body, `"calls":1`) || !strings.Contains(body, `"id":2`) {
+		t.Errorf("Expected the cached result with the caller's id, got %s", body)
+	}
+	if body := call(3, `{"name":"read","arguments":{"path":"b"}}`); !strings.Contains(body, `"calls":2`) {
+		t.Errorf("Expected other arguments to miss the cache, got %s", body)
+	}
+	if body := call(4, `{"name":"write","arguments":{"path":"a"}}`); !strings.Contains(body, `"calls":3`) {
+		t.Errorf("Expected the bypassed tool to reach the MCP server, got %s", body)
+	}
+
+	// Errors are not cached
+	call(5, `{"name":"read","fail":true,"arguments":{"path":"c"}}`)
+	if body := call(6, `{"name":"read","fail":true,"arguments":{"path":"c"}}`); !strings.Contains(body, `"data":5`) {
+		t.Errorf("Expected errors to be retried, got %s", body)
+	}
+
+	time.Sleep(250 * time.Millisecond)
+	if body := call(7, `{"name":"read","arguments":{"path":"a"}}`); !strings.Contains(body, `"calls":6`) {
+		t.Errorf("Expected the expired result to be fetched again, got %s", body)
+	}
+
+	for _, tc := range []struct {
+		tool, result string
+		want         float64
+	}{
+		{"read", "hit", 1},
+		{"read", "miss", 5},
+		{"write", "bypass", 1},
+	} {
+		if n := proxy.metrics.responseCache.Value(tc.tool, tc.result); n != tc.want {
+			t.Errorf("Expected %v %s results for %s, got %v", tc.want, tc.result, tc.tool, n)
+		}
+	}
+}
+
+func TestResponseCacheSize(t *testing.T) {
+	m := newMemo(Config{
+		ResponseCacheKey:  func(string, json.RawMessage) (string, time.Duration) { return "", 0 },
+		ResponseCacheSize: 2,
+	})
+	expires := time.Now().Add(time.Minute)
+	m.put("a", json.RawMessage(`1`), expires)
+	m.put("b", json.RawMessage(`2`), expires)
+	m.put("a", json.RawMessage(`3`), expires)
+	m.put("c", json.RawMessage(`4`), expires)
+
+	if got := m.get("b", time.Now()); got != nil {
+		t.Errorf("Expected the oldest entry to be dropped, got %s", got)
+	}
+	if got := m.get("a", time.Now()); string(got) != "3" {
+		t.Errorf("Expected the replaced entry, got %s", got)
+	}
+	if got := m.get("c", expires); got != nil {
+		t.Errorf("Expected the entry to expire, got %s", got)
+	}
+}
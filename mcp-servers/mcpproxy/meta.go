@@ -0,0 +1,89 @@
+package mcpproxy
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// copyMetaHeaders sets params._meta of msg from the request headers listed
+// in headers, see Config.MetaHeaders. msg is returned unchanged if none of
+// them is set or it has no params object to add them to.
+func copyMetaHeaders(msg json.RawMessage, header http.Header, headers map[string]string) json.RawMessage {
+	values := make(map[string]string)
+	for name, key := range headers {
+		if value := header.Get(name); value != "" {
+			values[key] = value
+		}
+	}
+	if len(values) == 0 {
+		return msg
+	}
+
+	return editMeta(msg, func(meta map[string]json.RawMessage) {
+		for key, value := range values {
+			meta[key], _ = json.Marshal(value)
+		}
+	})
+}
+
+// setEnvironment sets params._meta.environment of msg to label, see
+// Config.EnvironmentLabel.
+func setEnvironment(msg json.RawMessage, label string) json.RawMessage {
+	return editMeta(msg, func(meta map[string]json.RawMessage) {
+		meta["environment"], _ = json.Marshal(label)
+	})
+}
+
+// editMeta calls edit with params._meta of msg, created if missing, and
+// returns msg with the edited _meta. msg is returned unchanged if it has
+// no params object or _meta object to edit.
+func editMeta(msg json.RawMessage, edit func(meta map[string]json.RawMessage)) json.RawMessage {
+	var req map[string]json.RawMessage
+	if json.Unmarshal(msg, &req) != nil {
+		return msg
+	}
+	params := make(map[string]json.RawMessage)
+	if req["params"] != nil && json.Unmarshal(req["params"], &params) != nil {
+		return msg
+	}
+	meta := make(map[string]json.RawMessage)
+	if params["_meta"] != nil && json.Unmarshal(params["_meta"], &meta) != nil {
+		return msg
+	}
+
+	edit(meta)
+	var err error
+	if params["_meta"], err = json.Marshal(meta); err != nil {
+		return msg
+	}
+	if req["params"], err = json.Marshal(params); err != nil {
+		return msg
+	}
+	data, err := json.Marshal(req)
+	if err != nil {
+		return msg
+	}
+	return data
+}
+
+// filter applies Config.RequestFilter to a request from a client. It
+// reports whether the request was rejected, in which case the error has
+// been written to w.
+func (p *MCPProxy) filter(w http.ResponseWriter, r *http.Request, msg json.RawMessage, mcpMsg MCPMessage) bool {
+	fn := p.config.RequestFilter
+	if fn == nil || !mcpMsg.HasID {
+		return false
+	}
+	var rpcErr *RPCError
+	if id := callMiddleware(p.logFor(r), "RequestFilter", func() { rpcErr = fn(mcpMsg.Method, msg) }); id != "" {
+		p.writeResponse(w, r, mcpMsg.Method, middlewareError(mcpMsg.ID, id), false)
+		return true
+	}
+	if rpcErr == nil {
+		return false
+	}
+	p.logFor(r).Info("Request rejected by filter", "method", mcpMsg.Method, "code", rpcErr.Code, "error", rpcErr.Message)
+	response, _ := json.Marshal(map[string]interface{}{"jsonrpc": "2.0", "id": mcpMsg.ID, "error": rpcErr})
+	p.writeResponse(w, r, mcpMsg.Method, response, false)
+	return true
+}
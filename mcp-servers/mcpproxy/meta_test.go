@@ -0,0 +1,80 @@
+package mcpproxy
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetaHeaders(t *testing.T) {
+	var sent []byte
+	proxy := newFakeProxy(t, "ack", Config{
+		MetaHeaders:       map[string]string{"X-Tenant": "tenant"},
+		RequestMiddleware: func(msg []byte) []byte { sent = msg; return msg },
+	})
+
+	r := httptest.NewRequest("POST", "/", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"q","_meta":{"tenant":"spoofed","traceId":"t1"}}}`))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("X-Tenant", "acme")
+	proxy.Handle(httptest.NewRecorder(), r)
+
+	var msg struct {
+		Params struct {
+			Name string            `json:"name"`
+			Meta map[string]string `json:"_meta"`
+		} `json:"params"`
+	}
+	if err := json.Unmarshal(sent, &msg); err != nil {
+		t.Fatalf("Invalid message sent: %v", err)
+	}
+	if msg.Params.Name != "q" || msg.Params.Meta["tenant"] != "acme" || msg.Params.Meta["traceId"] != "t1" {
+		t.Errorf("Expected the header in _meta, got %s", sent)
+	}
+
+	// Without the header the message is sent as is
+	postJSON(proxy, `{"jsonrpc":"2.0","id":2,"method":"tools/list"}`)
+	if string(sent) != `{"jsonrpc":"2.0","id":2,"method":"tools/list"}` {
+		t.Errorf("Expected the message to be unchanged, got %s", sent)
+	}
+}
+
+func TestEnvironmentLabel(t *testing.T) {
+	var sent []string
+	proxy := newFakeProxy(t, "ack", Config{
+		EnvironmentLabel:  "staging",
+		RequestMiddleware: func(msg []byte) []byte { sent = append(sent, string(msg)); return msg },
+	})
+
+	postJSON(proxy, `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"q","_meta":{"environment":"prod","traceId":"t1"}}}`)
+	postJSON(proxy, `{"jsonrpc":"2.0","id":2,"method":"tools/list"}`)
+	postJSON(proxy, `{"jsonrpc":"2.0","method":"notifications/initialized"}`)
+
+	want := []string{
+		`{"id":1,"jsonrpc":"2.0","method":"tools/call","params":{"_meta":{"environment":"staging","traceId":"t1"},"name":"q"}}`,
+		`{"id":2,"jsonrpc":"2.0","method":"tools/list","params":{"_meta":{"environment":"staging"}}}`,
+		`{"jsonrpc":"2.0","method":"notifications/initialized","params":{"_meta":{"environment":"staging"}}}`,
+	}
+	if strings.Join(sent, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Expected the label in every message, got:\n%s", strings.Join(sent, "\n"))
+	}
+}
+
+func TestRequestFilter(t *testing.T) {
+	proxy := newFakeProxy(t, "ack", Config{
+		RequestFilter: func(method string, msg []byte) *RPCError {
+			if method == "tools/call" {
+				return &RPCError{Code: -32001, Message: "requires approval", Data: json.RawMessage(`{"reason":"policy"}`)}
+			}
+			return nil
+		},
+	})
+
+	w := postJSON(proxy, `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"q"}}`)
+	if body := w.Body.String(); !strings.Contains(body, `"id":1`) || !strings.Contains(body, `"message":"requires approval"`) || !strings.Contains(body, `"reason":"policy"`) {
+		t.Errorf("Expected the filter's error, got %s", body)
+	}
+	if w := postJSON(proxy, `{"jsonrpc":"2.0","id":2,"method":"tools/list"}`); !strings.Contains(w.Body.String(), `"size"`) {
+		t.Errorf("Expected other requests to reach the MCP server, got %s", w.Body.String())
+	}
+}
@@ -0,0 +1,333 @@
+package mcpproxy
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// metrics is a minimal Prometheus registry, so the package does not need a
+// client library dependency. Every series carries a "server" label with the
+// proxy's ServerName.
+type metrics struct {
+	server string
+
+	requests  *metricFamily
+	coalesced *metricFamily
+	buildInfo *metricFamily
+	buffered  *metricFamily
+	legacySSE *metricFamily
+	shed      *metricFamily
+	rpcErrors *metricFamily
+
+	breakerState    *metricFamily // see Config.CircuitBreakerFailures
+	breakerRejected *metricFamily
+
+	toolTimeouts *metricFamily
+	summarizer   *metricFamily
+	queueWait    *metricFamily
+	dequeued     *metricFamily
+
+	middlewareMisbehaved *metricFamily // see Config.StrictMiddleware
+
+	requestSize  *metricFamily // see MCPProxy.observeSize
+	responseSize *metricFamily
+
+	responseCache  *metricFamily // see Config.ResponseCacheKey
+	tokenRefreshes *metricFamily // see Config.TokenRefresher
+
+	// The MCP server subprocess, see MCPProxy.observeBackend.
+	backendRestarts *metricFamily
+	backendExits    *metricFamily
+	backendUp       *metricFamily
+	backendUptime   *metricFamily
+
+	byIdentity *metricFamily
+	identities map[string]bool // identities with their own series
+
+	mu       sync.Mutex
+	families []*metricFamily
+}
+
+// sizeBuckets are the upper bounds of the buckets of the message size
+// histograms, from 256 bytes to 16 MiB.
+var sizeBuckets = []float64{256, 1 << 10, 4 << 10, 16 << 10, 64 << 10, 256 << 10, 1 << 20, 4 << 20, 16 << 20}
+
+// maxIdentityLabels caps the number of identities with their own series in
+// mcp_proxy_requests_by_identity_total; later ones are counted as "other".
+const maxIdentityLabels = 100
+
+func newMetrics(server string) *metrics {
+	m := &metrics{server: server}
+	m.requests = m.counter("mcp_proxy_requests_total",
+		"JSON-RPC messages received from HTTP clients.", "method")
+	m.coalesced = m.counter("mcp_proxy_requests_coalesced_total",
+		"Requests answered by sharing an identical in-flight call.", "method")
+	m.responseCache = m.counter("mcp_proxy_response_cache_total",
+		"Tool calls by whether their result was answered from the response cache, see ResponseCacheKey.", "tool", "result")
+	m.tokenRefreshes = m.counter("mcp_proxy_token_refreshes_total",
+		"Scheduled refreshes of the MCP server's token by result, see TokenRefresher.", "result")
+	m.backendRestarts = m.counter("mcp_subprocess_restarts_total",
+		"Restarts of the MCP server subprocess, as counted at /status.")
+	m.backendExits = m.counter("mcp_subprocess_exits_total",
+		"Exits of the MCP server subprocess by reason: clean, error, signal, core_dump, oom or stopped, see ExitInfo.", "reason")
+	m.backendUp = m.gauge("mcp_subprocess_up",
+		"Whether the MCP server subprocess is running.")
+	m.backendUptime = m.gauge("mcp_subprocess_uptime_seconds",
+		"Time since the running MCP server subprocess started, 0 if none is running.")
+	m.buildInfo = m.gauge("mcp_proxy_build_info",
+		"Proxy build and MCP server version, always 1.", "version", "revision", "build_date", "goversion", "backend_version")
+	m.buffered = m.gauge("mcp_proxy_buffered_response_bytes",
+		"Bytes of responses read from the MCP server and not yet written to clients.")
+	m.legacySSE = m.counter("mcp_proxy_legacy_sse_requests_total",
+		"Requests to the deprecated /sse endpoint, see LegacySSECompat and DeprecateSSE.", "http_method")
+	m.shed = m.counter("mcp_proxy_requests_shed_total",
+		"Requests skipped because their client went away, they expired or they timed out in the queue.", "method", "reason")
+	m.rpcErrors = m.counter("mcp_proxy_rpc_errors_total",
+		"JSON-RPC error responses sent to clients, by error code.", "code")
+	m.breakerState = m.gauge("mcp_proxy_circuit_breaker_state",
+		"Whether the circuit breaker in front of the MCP server is in each state, see CircuitBreakerFailures.", "state")
+	m.breakerRejected = m.counter("mcp_proxy_circuit_breaker_rejections_total",
+		"Requests failed without being sent because the circuit breaker was open or half-open.", "method", "state")
+	m.queueWait = m.counter("mcp_proxy_queue_wait_seconds_total",
+		"Time requests sent to the MCP server spent waiting in the queue.", "method")
+	m.dequeued = m.counter("mcp_proxy_requests_dequeued_total",
+		"Requests taken from the queue to be sent to the MCP server, see mcp_proxy_queue_wait_seconds_total.", "method")
+	m.toolTimeouts = m.counter("mcp_proxy_tool_call_timeouts_total",
+		"Tool calls that ran over their timeout, by whether they were cancelled or the MCP server was restarted.", "tool", "outcome")
+	m.summarizer = m.counter("mcp_proxy_summarizer_results_total",
+		"Tool results checked by the Summarizer, by whether they were passed through, summarized or truncated.", "tool", "outcome")
+	m.middlewareMisbehaved = m.counter("mcp_proxy_middleware_misbehaviors_total",
+		"Responses a middleware returned with a missing or changed id or jsonrpc member, see StrictMiddleware.", "middleware")
+	m.requestSize = m.histogram("mcp_proxy_request_size_bytes",
+		"Size of the JSON-RPC messages received from clients.", sizeBuckets, "method", "tool")
+	m.responseSize = m.histogram("mcp_proxy_response_size_bytes",
+		"Size of the responses sent to clients.", sizeBuckets, "method", "tool")
+	m.byIdentity = m.counter("mcp_proxy_requests_by_identity_total",
+		"JSON-RPC messages received per client identity, beyond the first 100 identities counted as other.", "identity")
+	m.identities = make(map[string]bool)
+	return m
+}
+
+// countIdentity counts a request from the given client identity.
+func (m *metrics) countIdentity(identity string) {
+	m.mu.Lock()
+	if !m.identities[identity] {
+		if len(m.identities) < maxIdentityLabels {
+			m.identities[identity] = true
+		} else {
+			identity = "other"
+		}
+	}
+	m.mu.Unlock()
+	m.byIdentity.Inc(identity)
+}
+
+// observeBackend updates the metrics of the MCP server subprocess from its
+// status. It is called on every change of state, such as a start or an
+// exit, and before the metrics are served, for the uptime.
+func (p *MCPProxy) observeBackend() {
+	status := p.Status()
+	p.metrics.backendRestarts.Set(float64(status.Restarts))
+	if status.CircuitBreaker != "" {
+		for _, state := range breakerStates {
+			value := 0.0
+			if state == status.CircuitBreaker {
+				value = 1
+			}
+			p.metrics.breakerState.Set(value, state)
+		}
+	}
+	if status.State == StateRunning {
+		p.metrics.backendUp.Set(1)
+		p.metrics.backendUptime.Set(time.Since(status.StartedAt).Seconds())
+	} else {
+		p.metrics.backendUp.Set(0)
+		p.metrics.backendUptime.Set(0)
+	}
+}
+
+// handleMetrics serves the metrics endpoint.
+func (p *MCPProxy) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	p.observeBackend()
+	p.metrics.handle(w, r)
+}
+
+// metricFamily is a named metric with a fixed set of label names.
+type metricFamily struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+
+	buckets []float64 // upper bounds of the buckets of a histogram
+
+	mu     sync.Mutex
+	series map[string]*metricSeries
+}
+
+type metricSeries struct {
+	labelValues []string
+	value       float64 // the sum of the observations of a histogram
+
+	counts []uint64 // observations in each bucket of a histogram
+	count  uint64
+}
+
+func (m *metrics) counter(name, help string, labels ...string) *metricFamily {
+	return m.register(name, help, "counter", labels)
+}
+
+func (m *metrics) gauge(name, help string, labels ...string) *metricFamily {
+	return m.register(name, help, "gauge", labels)
+}
+
+// histogram registers a histogram with the given bucket upper bounds, in
+// increasing order.
+func (m *metrics) histogram(name, help string, buckets []float64, labels ...string) *metricFamily {
+	f := m.register(name, help, "histogram", labels)
+	f.buckets = buckets
+	return f
+}
+
+func (m *metrics) register(name, help, kind string, labels []string) *metricFamily {
+	f := &metricFamily{
+		name:   name,
+		help:   help,
+		kind:   kind,
+		labels: labels,
+		series: make(map[string]*metricSeries),
+	}
+	m.mu.Lock()
+	m.families = append(m.families, f)
+	m.mu.Unlock()
+	return f
+}
+
+// Inc adds one to the series with the given label values.
+func (f *metricFamily) Inc(labelValues ...string) {
+	f.Add(1, labelValues...)
+}
+
+// Add adds v to the series with the given label values.
+func (f *metricFamily) Add(v float64, labelValues ...string) {
+	f.mu.Lock()
+	f.get(labelValues).value += v
+	f.mu.Unlock()
+}
+
+// Set sets the series with the given label values to v.
+func (f *metricFamily) Set(v float64, labelValues ...string) {
+	f.mu.Lock()
+	f.get(labelValues).value = v
+	f.mu.Unlock()
+}
+
+// Observe records v in the histogram series with the given label values.
+func (f *metricFamily) Observe(v float64, labelValues ...string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s := f.get(labelValues)
+	if s.counts == nil {
+		s.counts = make([]uint64, len(f.buckets))
+	}
+	for i, bound := range f.buckets {
+		if v <= bound {
+			s.counts[i]++
+			break
+		}
+	}
+	s.value += v
+	s.count++
+}
+
+// Value returns the current value of the series with the given label values.
+func (f *metricFamily) Value(labelValues ...string) float64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if s, ok := f.series[strings.Join(labelValues, "\xff")]; ok {
+		return s.value
+	}
+	return 0
+}
+
+// get returns the series for labelValues, creating it if needed. f.mu must
+// be held.
+func (f *metricFamily) get(labelValues []string) *metricSeries {
+	key := strings.Join(labelValues, "\xff")
+	s, ok := f.series[key]
+	if !ok {
+		s = &metricSeries{labelValues: append([]string(nil), labelValues...)}
+		f.series[key] = s
+	}
+	return s
+}
+
+// write writes all metrics in the Prometheus text exposition format.
+func (m *metrics) write(w io.Writer) {
+	m.mu.Lock()
+	families := append([]*metricFamily(nil), m.families...)
+	m.mu.Unlock()
+
+	for _, f := range families {
+		f.writeTo(w, m.server)
+	}
+}
+
+func (f *metricFamily) writeTo(w io.Writer, server string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n", f.name, f.help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", f.name, f.kind)
+
+	keys := make([]string, 0, len(f.series))
+	for k := range f.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		s := f.series[k]
+		labels := formatLabels(server, f.labels, s.labelValues)
+		if f.kind != "histogram" {
+			fmt.Fprintf(w, "%s{%s} %s\n", f.name, labels, strconv.FormatFloat(s.value, 'g', -1, 64))
+			continue
+		}
+		var cumulative uint64
+		for i, bound := range f.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket{%s,le=\"%s\"} %d\n", f.name, labels, strconv.FormatFloat(bound, 'g', -1, 64), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket{%s,le=\"+Inf\"} %d\n", f.name, labels, s.count)
+		fmt.Fprintf(w, "%s_sum{%s} %s\n", f.name, labels, strconv.FormatFloat(s.value, 'g', -1, 64))
+		fmt.Fprintf(w, "%s_count{%s} %d\n", f.name, labels, s.count)
+	}
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatLabels(server string, names, values []string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, `server="%s"`, labelEscaper.Replace(server))
+	for i, name := range names {
+		fmt.Fprintf(&b, `,%s="%s"`, name, labelEscaper.Replace(values[i]))
+	}
+	return b.String()
+}
+
+// handle serves the metrics endpoint.
+func (m *metrics) handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.write(w)
+}
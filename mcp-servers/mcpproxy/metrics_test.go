@@ -0,0 +1,156 @@
+package mcpproxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/rh-ai-kickstart/ai-architecture-charts/mcp-servers/mcpproxy/internal/fakebackend"
+)
+
+func TestMetricsExposition(t *testing.T) {
+	m := newMetrics("github-mcp")
+	m.requests.Inc("tools/call")
+	m.requests.Inc("tools/call")
+	m.requests.Inc(`we"ird`)
+
+	w := httptest.NewRecorder()
+	m.handle(w, httptest.NewRequest("GET", "/metrics", nil))
+
+	body := w.Body.String()
+	for _, want := range []string{
+		"# TYPE mcp_proxy_requests_total counter",
+		`mcp_proxy_requests_total{server="github-mcp",method="tools/call"} 2`,
+		`mcp_proxy_requests_total{server="github-mcp",method="we\"ird"} 1`,
+		"# TYPE mcp_proxy_requests_coalesced_total counter",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected metrics to contain %q, got:\n%s", want, body)
+		}
+	}
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	proxy := newFakeProxy(t, "reflect", Config{EnableMetrics: true})
+	handler := proxy.Handler()
+
+	req := httptest.NewRequest("POST", "/", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"ping"}`))
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `method="ping"} 1`) {
+		t.Errorf("Expected ping to be counted, got %d:\n%s", w.Code, w.Body.String())
+	}
+
+	// Without EnableMetrics, /metrics is unknown
+	proxy = newFakeProxy(t, "reflect", Config{})
+	w = httptest.NewRecorder()
+	proxy.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected /metrics to be disabled by default, got %d", w.Code)
+	}
+}
+
+func TestBuildInfo(t *testing.T) {
+	proxy := newFakeProxy(t, "reflect", Config{EnableMetrics: true, BackendVersionArgs: []string{fakebackend.Arg, "version"}})
+	handler := proxy.Handler()
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if got := w.Header().Get("X-MCP-Proxy"); got != "mcpproxy/"+Version {
+		t.Errorf("Expected X-MCP-Proxy header, got %q", got)
+	}
+	want := `mcp_proxy_build_info{server="test",version="dev",revision="unknown",build_date="unknown",goversion="` +
+		runtime.Version() + `",backend_version="fake-mcp-backend 1.0"} 1`
+	if !strings.Contains(w.Body.String(), want) {
+		t.Errorf("Expected %q in metrics, got:\n%s", want, w.Body.String())
+	}
+}
+
+func TestSubprocessMetrics(t *testing.T) {
+	fastRestarts(t)
+	proxy := newFakeProxy(t, "exit", Config{EnableMetrics: true, MaxRestarts: 1})
+	handler := proxy.Handler()
+	scrape := func() string {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+		return w.Body.String()
+	}
+
+	body := scrape()
+	for _, want := range []string{
+		`mcp_subprocess_up{server="test"} 1`,
+		`mcp_subprocess_restarts_total{server="test"} 0`,
+		"# TYPE mcp_subprocess_uptime_seconds gauge",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected %q in metrics, got:\n%s", want, body)
+		}
+	}
+	if strings.Contains(body, `mcp_subprocess_uptime_seconds{server="test"} 0`+"\n") {
+		t.Errorf("Expected the running server to have an uptime, got:\n%s", body)
+	}
+
+	// Restarts are counted, and a server that is not restarted is down
+	exitBackend(t, proxy, 1)
+	if body := scrape(); !strings.Contains(body, `mcp_subprocess_restarts_total{server="test"} 1`) ||
+		!strings.Contains(body, `mcp_subprocess_up{server="test"} 1`) {
+		t.Errorf("Expected one restart and the server up, got:\n%s", body)
+	}
+	exitBackend(t, proxy, 1)
+	if up := proxy.metrics.backendUp.Value(); up != 0 {
+		t.Errorf("Expected the gauge to flip on exit, before any scrape, got %v", up)
+	}
+	if body := scrape(); !strings.Contains(body, `mcp_subprocess_up{server="test"} 0`) ||
+		!strings.Contains(body, `mcp_subprocess_uptime_seconds{server="test"} 0`) {
+		t.Errorf("Expected the failed server to be down, got:\n%s", body)
+	}
+}
+
+func TestMessageSizes(t *testing.T) {
+	logs := &recordingLogger{}
+	proxy := newFakeProxy(t, "reflect", Config{EnableMetrics: true, SizeWarnBytes: 1024, Logger: logs})
+
+	small := `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"echo","result":{}}}`
+	postJSON(proxy, small)
+	if strings.Contains(logs.String(), "SizeWarnBytes") {
+		t.Errorf("Expected no warning for a small message, got:\n%s", logs.String())
+	}
+
+	big := `{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"echo","result":{"text":"` +
+		strings.Repeat("x", 2000) + `"}}}`
+	postJSON(proxy, big)
+	for _, want := range []string{
+		`WARN Message exceeds SizeWarnBytes server=test message=request method=tools/call tool=echo`,
+		`WARN Message exceeds SizeWarnBytes server=test message=response method=tools/call tool=echo`,
+		"limit=1024",
+	} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("Expected %q in the logs, got:\n%s", want, logs.String())
+		}
+	}
+
+	w := httptest.NewRecorder()
+	proxy.metrics.handle(w, httptest.NewRequest("GET", "/metrics", nil))
+	body := w.Body.String()
+	for _, want := range []string{
+		"# TYPE mcp_proxy_request_size_bytes histogram",
+		`mcp_proxy_request_size_bytes_bucket{server="test",method="tools/call",tool="echo",le="256"} 1`,
+		`mcp_proxy_request_size_bytes_bucket{server="test",method="tools/call",tool="echo",le="1024"} 1`,
+		`mcp_proxy_request_size_bytes_bucket{server="test",method="tools/call",tool="echo",le="4096"} 2`,
+		`mcp_proxy_request_size_bytes_bucket{server="test",method="tools/call",tool="echo",le="+Inf"} 2`,
+		`mcp_proxy_request_size_bytes_sum{server="test",method="tools/call",tool="echo"} ` +
+			strconv.Itoa(len(small)+len(big)),
+		`mcp_proxy_request_size_bytes_count{server="test",method="tools/call",tool="echo"} 2`,
+		`mcp_proxy_response_size_bytes_bucket{server="test",method="tools/call",tool="echo",le="4096"} 2`,
+		`mcp_proxy_response_size_bytes_count{server="test",method="tools/call",tool="echo"} 2`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected metrics to contain %q, got:\n%s", want, body)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package mcpproxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// sequenceHeader carries the sequence number of a response, see
+// Config.EnableNotificationStream.
+const sequenceHeader = "X-MCP-Sequence"
+
+// notificationBuffer is how many notifications a stream can fall behind
+// before it is closed.
+const notificationBuffer = 256
+
+// sequencedMessage is a message read from the MCP server with its sequence
+// number.
+type sequencedMessage struct {
+	seq uint64
+	msg json.RawMessage
+}
+
+// notificationHub hands the notifications read from the MCP server to the
+// clients streaming them. publish is only called by processRequests for
+// those, so every stream receives them in the order they were read, and by
+// Notifier for the application's own, which come in between.
+type notificationHub struct {
+	mu      sync.Mutex
+	streams map[chan sequencedMessage]string // to the session ids of the clients
+}
+
+// subscribe returns a channel receiving every notification published from
+// now on for the client with the given session id, "" if it sent none. The
+// channel is closed if the stream falls too far behind.
+func (h *notificationHub) subscribe(session string) chan sequencedMessage {
+	ch := make(chan sequencedMessage, notificationBuffer)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.streams == nil {
+		h.streams = make(map[chan sequencedMessage]string)
+	}
+	h.streams[ch] = session
+	return ch
+}
+
+func (h *notificationHub) unsubscribe(ch chan sequencedMessage) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.streams[ch]; ok {
+		delete(h.streams, ch)
+		close(ch)
+	}
+}
+
+// active reports whether anyone is streaming notifications, so that they
+// need not be copied otherwise.
+func (h *notificationHub) active() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.streams) > 0
+}
+
+// publish hands m to every stream without blocking. A stream that cannot
+// take it is closed rather than skipping it, which would break the order
+// clients rely on.
+func (h *notificationHub) publish(m sequencedMessage, log Logger) {
+	h.publishTo(m, log, nil)
+}
+
+// publishTo is publish for the streams of the sessions to accepts, or all
+// if to is nil.
+func (h *notificationHub) publishTo(m sequencedMessage, log Logger, to func(session string) bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch, session := range h.streams {
+		if to != nil && !to(session) {
+			continue
+		}
+		select {
+		case ch <- m:
+		default:
+			log.Warn("Closing notification stream, the client is too slow", "buffered", notificationBuffer)
+			delete(h.streams, ch)
+			close(ch)
+		}
+	}
+}
+
+// handleNotificationStream serves GET on the MCP endpoint with an event
+// stream of the notifications read from the MCP server from now on, each
+// a "message" event whose id is its sequence number. Sessions of clients
+// that do not take notifications are refused, see acceptsNotifications.
+func (p *MCPProxy) handleNotificationStream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	if !p.acceptsNotifications(r) {
+		p.logFor(r).Info("Refusing notification stream, the client did not advertise any capabilities",
+			"session", r.Header.Get(sessionHeader), "identity", identity(r))
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "This session does not receive notifications", http.StatusMethodNotAllowed)
+		return
+	}
+	session := r.Header.Get(sessionHeader)
+	stream := p.notifications.subscribe(session)
+	defer p.notifications.unsubscribe(stream)
+	if p.config.ShareSubscriptions {
+		p.subscriptions.streamOpened(session)
+		defer p.subscriptions.streamClosed(session)
+	}
+	p.logFor(r).Info("Notification stream opened", "remote", r.RemoteAddr, "identity", identity(r))
+
+	setSSEHeaders(w)
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	idle := p.newIdleTimer()
+	defer idle.stop()
+	for {
+		select {
+		case m, ok := <-stream:
+			if !ok {
+				return
+			}
+			if m.seq != 0 {
+				fmt.Fprintf(w, "id: %d\n", m.seq)
+			}
+			fmt.Fprintf(w, "event: message\ndata: %s\n\n", m.msg)
+			flusher.Flush()
+			idle.wrote()
+		case <-idle.c:
+			if !p.heartbeat(w, r) {
+				return
+			}
+		case <-r.Context().Done():
+			p.logFor(r).Info("Notification stream closed", "remote", r.RemoteAddr)
+			return
+		case <-p.stopping:
+			return
+		}
+	}
+}
+
+// Notifier sends notifications that do not come from the MCP server to the
+// clients streaming notifications from the proxies it is set for, see
+// Config.Notifier. The zero value is ready to use.
+type Notifier struct {
+	mu      sync.Mutex
+	proxies []*MCPProxy
+}
+
+func (n *Notifier) attach(p *MCPProxy) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.proxies = append(n.proxies, p)
+}
+
+func (n *Notifier) detach(p *MCPProxy) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for i, proxy := range n.proxies {
+		if proxy == p {
+			n.proxies = append(n.proxies[:i], n.proxies[i+1:]...)
+			return
+		}
+	}
+}
+
+// Notify sends a JSON-RPC notification with the given method and params,
+// which must marshal to a JSON object, to every client streaming
+// notifications. It does not wait for them to be written, and clients that
+// are not streaming then never see it.
+func (n *Notifier) Notify(method string, params interface{}) error {
+	msg, err := json.Marshal(map[string]interface{}{"jsonrpc": "2.0", "method": method, "params": params})
+	if err != nil {
+		return fmt.Errorf("invalid params for %s: %w", method, err)
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _, p := range n.proxies {
+		if p.notifications.active() {
+			p.log.Debug("Sending notification", "method", method)
+			p.notifications.publish(sequencedMessage{msg: msg}, p.log)
+		}
+	}
+	return nil
+}
+
+// wantsEventStream reports whether r asks for an event stream.
+func wantsEventStream(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+}
+
+// setSequenceHeader reports the sequence number of a response to clients,
+// if it has one.
+func setSequenceHeader(w http.ResponseWriter, seq uint64) {
+	if seq != 0 {
+		w.Header().Set(sequenceHeader, strconv.FormatUint(seq, 10))
+	}
+}
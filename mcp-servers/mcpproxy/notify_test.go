@@ -0,0 +1,318 @@
+package mcpproxy
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// streamEvent is an event read from a notification stream.
+type streamEvent struct {
+	seq    uint64
+	method string
+	token  string
+}
+
+// openNotificationStream opens a notification stream on server and sends
+// its events to the returned channel until the stream ends.
+func openNotificationStream(t *testing.T, server *httptest.Server) <-chan streamEvent {
+	t.Helper()
+	return openSessionStream(t, server, "")
+}
+
+// openSessionStream is openNotificationStream for the client with the
+// given session id.
+func openSessionStream(t *testing.T, server *httptest.Server, session string) <-chan streamEvent {
+	t.Helper()
+	req, _ := http.NewRequest("GET", server.URL+"/", nil)
+	req.Header.Set("Accept", "text/event-stream")
+	if session != "" {
+		req.Header.Set(sessionHeader, session)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("Expected an event stream, got %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	events := make(chan streamEvent, 1000)
+	go func() {
+		defer close(events)
+		var ev streamEvent
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case strings.HasPrefix(line, "id: "):
+				ev.seq, _ = strconv.ParseUint(strings.TrimPrefix(line, "id: "), 10, 64)
+			case strings.HasPrefix(line, "data: "):
+				var msg struct {
+					Method string `json:"method"`
+					Params struct {
+						ProgressToken json.RawMessage `json:"progressToken"`
+					} `json:"params"`
+				}
+				json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &msg)
+				ev.method = msg.Method
+				ev.token = string(msg.Params.ProgressToken)
+			case line == "":
+				events <- ev
+				ev = streamEvent{}
+			}
+		}
+	}()
+	return events
+}
+
+func TestNotificationOrdering(t *testing.T) {
+	proxy := newFakeProxy(t, "progress", Config{EnableNotificationStream: true, SkipNotifications: true})
+	server := httptest.NewServer(proxy.Handler())
+	t.Cleanup(server.Close)
+	events := openNotificationStream(t, server)
+
+	const clients, requests, steps = 8, 10, 3
+	var mu sync.Mutex
+	responseSeq := make(map[string]uint64)
+	var wg sync.WaitGroup
+	for c := 0; c < clients; c++ {
+		wg.Add(1)
+		go func(c int) {
+			defer wg.Done()
+			for i := 0; i < requests; i++ {
+				id := strconv.Itoa(c*requests + i)
+				body := fmt.Sprintf(`{"jsonrpc":"2.0","id":%s,"method":"x","params":{"steps":%d}}`, id, steps)
+				resp, err := http.Post(server.URL+"/", "application/json", strings.NewReader(body))
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				resp.Body.Close()
+				seq, err := strconv.ParseUint(resp.Header.Get("X-MCP-Sequence"), 10, 64)
+				if err != nil {
+					t.Errorf("Expected a sequence number on the response, got %q", resp.Header.Get("X-MCP-Sequence"))
+				}
+				mu.Lock()
+				responseSeq[id] = seq
+				mu.Unlock()
+			}
+		}(c)
+	}
+	wg.Wait()
+
+	var last uint64
+	seen := make(map[string]int)
+	timeout := time.After(5 * time.Second)
+	for n := 0; n < clients*requests*steps; n++ {
+		var ev streamEvent
+		select {
+		case ev = <-events:
+		case <-timeout:
+			t.Fatalf("Timed out after %d of %d notifications", n, clients*requests*steps)
+		}
+		if ev.seq <= last {
+			t.Fatalf("Expected increasing sequence numbers, got %d after %d", ev.seq, last)
+		}
+		last = ev.seq
+		if ev.seq >= responseSeq[ev.token] {
+			t.Errorf("Expected progress %d of request %s before its response %d", ev.seq, ev.token, responseSeq[ev.token])
+		}
+		seen[ev.token]++
+	}
+	for id := range responseSeq {
+		if seen[id] != steps {
+			t.Errorf("Expected %d notifications for request %s, got %d", steps, id, seen[id])
+		}
+	}
+}
+
+func TestNotificationStreamDisabled(t *testing.T) {
+	proxy := newFakeProxy(t, "progress", Config{})
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Accept", "text/event-stream")
+	proxy.Handler().ServeHTTP(w, r)
+	if w.Code == http.StatusOK {
+		t.Errorf("Expected no notification stream by default, got %d", w.Code)
+	}
+
+	// Notifications are skipped and responses carry no sequence number
+	w = postJSON(proxy, `{"jsonrpc":"2.0","id":1,"method":"x","params":{"steps":2}}`)
+	if !strings.Contains(w.Body.String(), `"steps":2`) || w.Header().Get("X-MCP-Sequence") != "" {
+		t.Errorf("Unexpected response %s with headers %v", w.Body.String(), w.Header())
+	}
+}
+
+func TestNotificationStreamWithoutAccept(t *testing.T) {
+	proxy := newFakeProxy(t, "progress", Config{EnableNotificationStream: true})
+	server := httptest.NewServer(proxy.Handler())
+	t.Cleanup(server.Close)
+
+	// A GET without a body opens the stream even without the Accept header
+	resp, err := http.Get(server.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Errorf("Expected an event stream, got %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+}
+
+func TestNotificationStreamSession(t *testing.T) {
+	proxy := newFakeProxy(t, "mcp", Config{EnableNotificationStream: true})
+	server := httptest.NewServer(proxy.Handler())
+	t.Cleanup(server.Close)
+
+	initialize := func(capabilities string) string {
+		t.Helper()
+		w := postJSON(proxy, `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-06-18","capabilities":`+capabilities+`,"clientInfo":{"name":"test","version":"1"}}}`)
+		id := w.Header().Get(sessionHeader)
+		if id == "" {
+			t.Fatalf("Expected a session id in the response to initialize, got headers %v", w.Header())
+		}
+		return id
+	}
+	openStream := func(session string) int {
+		t.Helper()
+		req, _ := http.NewRequest("GET", server.URL+"/", nil)
+		req.Header.Set("Accept", "text/event-stream")
+		if session != "" {
+			req.Header.Set(sessionHeader, session)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// A client that did not advertise any capability gets no stream
+	plain := initialize(`{}`)
+	if status := openStream(plain); status != http.StatusMethodNotAllowed {
+		t.Errorf("Expected a plain request/response client to be refused a stream, got %d", status)
+	}
+
+	full := initialize(`{"roots":{"listChanged":true},"sampling":{}}`)
+	if full == plain {
+		t.Fatal("Expected every session to get its own id")
+	}
+	if status := openStream(full); status != http.StatusOK {
+		t.Errorf("Expected a client with capabilities to get a stream, got %d", status)
+	}
+
+	// Clients without a session, or with an unknown one, are not affected
+	for _, session := range []string{"", "unknown"} {
+		if status := openStream(session); status != http.StatusOK {
+			t.Errorf("Expected a stream for session %q, got %d", session, status)
+		}
+	}
+
+	// Sessions are only assigned for notification streams
+	proxy = newFakeProxy(t, "mcp", Config{})
+	w := postJSON(proxy, `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"capabilities":{}}}`)
+	if id := w.Header().Get(sessionHeader); id != "" {
+		t.Errorf("Expected no session without EnableNotificationStream, got %q", id)
+	}
+}
+
+func TestConcurrentInitialize(t *testing.T) {
+	// Identical initialize requests share one call to the MCP server
+	proxy := newFakeProxy(t, "mcp", Config{
+		EnableNotificationStream: true,
+		ReplayInitialize:         true,
+		CoalesceMethods:          []string{"initialize"},
+	})
+	server := httptest.NewServer(proxy.Handler())
+	t.Cleanup(server.Close)
+
+	const clients = 16
+	sessions := make([]string, clients)
+	var wg sync.WaitGroup
+	for i := 0; i < clients; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			capabilities := `{}`
+			if i%2 == 1 {
+				capabilities = `{"roots":{}}`
+			}
+			w := postJSON(proxy, fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":"initialize","params":{"protocolVersion":"2025-06-18","capabilities":%s,"clientInfo":{"name":"test","version":"1"}}}`, i, capabilities))
+			var resp struct {
+				ID     int             `json:"id"`
+				Result json.RawMessage `json:"result"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.ID != i || resp.Result == nil {
+				t.Errorf("Client %d: unexpected response %s", i, w.Body.String())
+			}
+			sessions[i] = w.Header().Get(sessionHeader)
+		}(i)
+	}
+	wg.Wait()
+
+	seen := make(map[string]bool)
+	for i, id := range sessions {
+		if id == "" || seen[id] {
+			t.Fatalf("Expected every client to get its own session id, got %q for client %d", id, i)
+		}
+		seen[id] = true
+
+		// Each session keeps the capabilities of its own client
+		req, _ := http.NewRequest("GET", server.URL+"/", nil)
+		req.Header.Set("Accept", "text/event-stream")
+		req.Header.Set(sessionHeader, id)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if want := []int{http.StatusMethodNotAllowed, http.StatusOK}[i%2]; resp.StatusCode != want {
+			t.Errorf("Client %d: expected %d for its stream, got %d", i, want, resp.StatusCode)
+		}
+	}
+}
+
+func TestNotifier(t *testing.T) {
+	notifier := &Notifier{}
+	proxy := newFakeProxy(t, "progress", Config{EnableNotificationStream: true, Notifier: notifier})
+	server := httptest.NewServer(proxy.Handler())
+	t.Cleanup(server.Close)
+	events := openNotificationStream(t, server)
+
+	if err := notifier.Notify("notifications/resources/updated", map[string]string{"uri": "repo://a/b"}); err != nil {
+		t.Fatalf("Notify failed: %v", err)
+	}
+	postJSON(proxy, `{"jsonrpc":"2.0","id":1,"method":"x","params":{"steps":1}}`)
+
+	for i, want := range []streamEvent{
+		{method: "notifications/resources/updated"},
+		{seq: 1, method: "notifications/progress", token: "1"},
+	} {
+		select {
+		case ev := <-events:
+			if ev != want {
+				t.Errorf("Event %d: expected %+v, got %+v", i, want, ev)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timed out waiting for event %d", i)
+		}
+	}
+
+	if err := notifier.Notify("x", func() {}); err == nil {
+		t.Error("Expected params that cannot be marshaled to be rejected")
+	}
+	proxy.Close()
+	if len(notifier.proxies) != 0 {
+		t.Errorf("Expected the closed proxy to be detached, got %d proxies", len(notifier.proxies))
+	}
+}
@@ -0,0 +1,174 @@
+package mcpproxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// openAPIPath is where Config.EnableOpenAPI serves the OpenAPI document.
+const openAPIPath = "/openapi.json"
+
+// openAPIDoc is an OpenAPI 3.0 document, built from maps as the proxy only
+// needs a small, fixed part of the schema.
+type openAPIDoc map[string]interface{}
+
+// handleOpenAPI serves the OpenAPI description of the routes this proxy
+// serves, see Config.EnableOpenAPI.
+func (p *MCPProxy) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(p.openAPI())
+}
+
+// openAPI describes the routes served with the current configuration. It is
+// built for each request, since Reload can change EnableCORS.
+func (p *MCPProxy) openAPI() openAPIDoc {
+	cfg := p.config
+	auth := cfg.AuthToken != "" || cfg.Authenticator != nil
+	admin := cfg.AdminToken != ""
+	cors := p.dynamic.Load().EnableCORS
+
+	paths := make(map[string]interface{})
+	add := func(path, method string, op map[string]interface{}) {
+		ops, ok := paths[path].(map[string]interface{})
+		if !ok {
+			ops = make(map[string]interface{})
+			paths[path] = ops
+		}
+		ops[method] = op
+	}
+	// operation describes an operation answered by the given statuses. A
+	// secured operation requires the client credentials if there are
+	// any, an admin one the admin token as well.
+	operation := func(summary, description string, secured, adminOnly bool, responses map[string]string) map[string]interface{} {
+		op := map[string]interface{}{"summary": summary}
+		if description != "" {
+			op["description"] = description
+		}
+		var security []interface{}
+		switch {
+		case secured && auth && adminOnly && admin:
+			security = append(security, map[string]interface{}{"bearer": []string{}, "adminToken": []string{}})
+		case secured && auth:
+			security = append(security, map[string]interface{}{"bearer": []string{}})
+		case adminOnly && admin:
+			security = append(security, map[string]interface{}{"adminToken": []string{}})
+		}
+		if security != nil {
+			op["security"] = security
+			if secured && auth {
+				responses["401"] = "Missing or invalid credentials."
+			}
+			if adminOnly && admin {
+				responses["403"] = "Missing or invalid admin token."
+			}
+		}
+		described := make(map[string]interface{}, len(responses))
+		for status, text := range responses {
+			described[status] = map[string]string{"description": text}
+		}
+		op["responses"] = described
+		return op
+	}
+
+	post := operation("Send a JSON-RPC message to the MCP server",
+		"The body is a JSON-RPC request, notification or batch. Requests are answered with the MCP server's response, notifications with 202 Accepted.",
+		true, false, map[string]string{
+			"200": "The JSON-RPC response.",
+			"202": "The notification was delivered.",
+			"400": "The body is not a valid JSON-RPC message.",
+			"413": "The body exceeds MaxRequestBytes.",
+			"503": "The MCP server is unavailable.",
+		})
+	post["requestBody"] = map[string]interface{}{
+		"required": true,
+		"content":  map[string]interface{}{"application/json": map[string]interface{}{"schema": map[string]string{"type": "object"}}},
+	}
+	add("/", "post", post)
+	if cfg.EnableNotificationStream {
+		add("/", "get", operation("Stream notifications from the MCP server",
+			"A server-sent event stream of the notifications the MCP server sends.",
+			true, false, map[string]string{"200": "The event stream."}))
+	}
+	if cors {
+		add("/", "options", operation("CORS preflight", "", false, false, map[string]string{"200": "The CORS headers."}))
+	}
+
+	if cfg.DeprecateSSE {
+		add(legacySSEPath, "get", operation("Removed SSE endpoint", "Answers 410 Gone, pointing at the MCP endpoint.",
+			false, false, map[string]string{"410": "The endpoint was removed."}))
+	}
+	if cfg.LegacySSECompat {
+		path := legacySSEPath
+		if cfg.DeprecateSSE {
+			path = movedLegacySSEPath
+		}
+		add(path, "get", operation("Open a legacy SSE stream", "The HTTP+SSE transport of MCP protocol version 2024-11-05.",
+			true, false, map[string]string{"200": "The event stream."}))
+		add(path, "post", operation("Send a JSON-RPC message over the legacy SSE transport", "",
+			true, false, map[string]string{"200": "The JSON-RPC response."}))
+	}
+
+	add("/healthz", "get", operation("Liveness check", "", false, false, map[string]string{"200": "The proxy is alive."}))
+	add("/readyz", "get", operation("Readiness check", "", false, false, map[string]string{
+		"200": "The MCP server is ready.",
+		"503": "The MCP server is not ready.",
+	}))
+	add("/status", "get", operation("Status of the MCP server subprocess", "", true, false, map[string]string{"200": "The status."}))
+	add("/admin/inflight", "get", operation("Requests being served", "", true, true, map[string]string{"200": "The requests, without payloads."}))
+	if cfg.ConfigFile != "" {
+		add("/admin/reload", "post", operation("Reload the config file", "", true, true, map[string]string{
+			"200": "The config was reloaded.",
+			"400": "The config is invalid.",
+		}))
+	}
+	if cfg.EnableMetrics {
+		add("/metrics", "get", operation("Prometheus metrics", "", false, false, map[string]string{"200": "The metrics."}))
+	}
+	if cfg.EnableConfigEndpoint {
+		add("/config", "get", operation("Effective configuration", "Secrets are replaced by fingerprints.",
+			true, false, map[string]string{"200": "The configuration."}))
+	}
+	if cfg.EnableDebugEndpoints {
+		add("/debug/raw", "post", operation("Send a JSON-RPC message bypassing all middleware", "",
+			true, true, map[string]string{"200": "The MCP server's response as is."}))
+		add("/debug/logs", "get", operation("Recent output of the MCP server", "",
+			true, true, map[string]string{"200": "The last lines the MCP server wrote."}))
+	}
+	add(openAPIPath, "get", operation("This document", "", true, false, map[string]string{"200": "The OpenAPI document."}))
+
+	for _, route := range extraRoutes(cfg) {
+		method, path := splitPattern(route.Pattern)
+		methods := []string{strings.ToLower(method)}
+		if method == "" {
+			methods = []string{"get", "post"}
+		}
+		for _, m := range methods {
+			add(path, m, operation("Route added by the embedding program", "", route.Auth, false,
+				map[string]string{"default": "Defined by the route."}))
+		}
+	}
+
+	doc := openAPIDoc{
+		"openapi": "3.0.3",
+		"info": map[string]string{
+			"title":   "MCP proxy for " + cfg.ServerName,
+			"version": Version,
+		},
+		"paths": paths,
+	}
+	if cfg.BasePath != "" {
+		doc["servers"] = []map[string]string{{"url": cfg.BasePath}}
+	}
+	schemes := make(map[string]interface{})
+	if auth {
+		schemes["bearer"] = map[string]string{"type": "http", "scheme": "bearer"}
+	}
+	if admin {
+		schemes["adminToken"] = map[string]string{"type": "apiKey", "in": "header", "name": adminTokenHeader}
+	}
+	if len(schemes) > 0 {
+		doc["components"] = map[string]interface{}{"securitySchemes": schemes}
+	}
+	return doc
+}
@@ -0,0 +1,108 @@
+package mcpproxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// fetchOpenAPI gets the OpenAPI document served by proxy.
+func fetchOpenAPI(t *testing.T, proxy *MCPProxy, token string) (paths map[string]map[string]json.RawMessage, schemes map[string]json.RawMessage) {
+	t.Helper()
+	req := httptest.NewRequest("GET", "/openapi.json", nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	proxy.Handler().ServeHTTP(w, req)
+	var doc struct {
+		OpenAPI    string                                `json:"openapi"`
+		Paths      map[string]map[string]json.RawMessage `json:"paths"`
+		Components struct {
+			SecuritySchemes map[string]json.RawMessage `json:"securitySchemes"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil || w.Code != http.StatusOK || doc.OpenAPI != "3.0.3" {
+		t.Fatalf("Unexpected response %d %s", w.Code, w.Body.String())
+	}
+	return doc.Paths, doc.Components.SecuritySchemes
+}
+
+func TestOpenAPI(t *testing.T) {
+	proxy := newFakeProxy(t, "reflect", Config{EnableOpenAPI: true})
+	paths, schemes := fetchOpenAPI(t, proxy, "")
+	for _, path := range []string{"/", "/healthz", "/readyz", "/status", "/admin/inflight", "/openapi.json"} {
+		if paths[path] == nil {
+			t.Errorf("Expected %s to be described, got %v", path, paths)
+		}
+	}
+	for _, path := range []string{"/sse", "/metrics", "/config", "/debug/raw", "/admin/reload"} {
+		if paths[path] != nil {
+			t.Errorf("Expected %s not to be described", path)
+		}
+	}
+	if _, ok := paths["/"]["options"]; ok {
+		t.Error("Expected no CORS preflight without EnableCORS")
+	}
+	if len(schemes) != 0 {
+		t.Errorf("Expected no security schemes, got %v", schemes)
+	}
+
+	w := httptest.NewRecorder()
+	newFakeProxy(t, "reflect", Config{}).Handler().ServeHTTP(w, httptest.NewRequest("GET", "/openapi.json", nil))
+	if w.Code == http.StatusOK {
+		t.Errorf("Expected no OpenAPI document without EnableOpenAPI, got %s", w.Body.String())
+	}
+}
+
+func TestOpenAPIFeatures(t *testing.T) {
+	proxy := newFakeProxy(t, "reflect", Config{
+		EnableOpenAPI:        true,
+		EnableCORS:           true,
+		LegacySSECompat:      true,
+		DeprecateSSE:         true,
+		EnableMetrics:        true,
+		EnableDebugEndpoints: true,
+		AuthToken:            "secret",
+		AdminToken:           "admin",
+		Routes:               []Route{{Pattern: "POST /hooks", Handler: func(w http.ResponseWriter, r *http.Request) {}, Auth: true}},
+	})
+
+	// The document requires the same authentication as the MCP endpoint
+	w := httptest.NewRecorder()
+	proxy.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/openapi.json", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without a token, got %d", w.Code)
+	}
+
+	paths, schemes := fetchOpenAPI(t, proxy, "secret")
+	for path, method := range map[string]string{
+		"/":           "options",
+		"/sse":        "get",
+		"/legacy/sse": "post",
+		"/metrics":    "get",
+		"/debug/raw":  "post",
+		"/hooks":      "post",
+	} {
+		if _, ok := paths[path][method]; !ok {
+			t.Errorf("Expected %s %s to be described, got %v", method, path, paths[path])
+		}
+	}
+	if schemes["bearer"] == nil || schemes["adminToken"] == nil {
+		t.Errorf("Expected the bearer and admin token schemes, got %v", schemes)
+	}
+
+	var op struct {
+		Security []map[string][]string `json:"security"`
+	}
+	json.Unmarshal(paths["/admin/inflight"]["get"], &op)
+	if len(op.Security) != 1 || op.Security[0]["bearer"] == nil || op.Security[0]["adminToken"] == nil {
+		t.Errorf("Expected /admin/inflight to require both tokens, got %+v", op.Security)
+	}
+	op.Security = nil
+	json.Unmarshal(paths["/healthz"]["get"], &op)
+	if op.Security != nil {
+		t.Errorf("Expected /healthz to be open, got %+v", op.Security)
+	}
+}
@@ -0,0 +1,166 @@
+package mcpproxy
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+)
+
+// priorityHeader selects the lane of a request, see Config.PriorityLanes.
+const priorityHeader = "X-MCP-Priority"
+
+// defaultPriorityMinShare is the default of Config.PriorityMinShare.
+const defaultPriorityMinShare = 0.1
+
+// The priority lanes. The zero value is laneNormal, so that requests the
+// proxy makes itself need not pick one.
+const (
+	laneNormal = iota
+	laneHigh
+	laneLow
+	laneCount
+)
+
+var laneNames = [laneCount]string{"normal", "high", "low"}
+
+// laneOrder lists the lanes from the first served to the last.
+var laneOrder = [laneCount]int{laneHigh, laneNormal, laneLow}
+
+// parsePriority returns the lane named by priority, case-insensitively.
+func parsePriority(priority string) (int, bool) {
+	for lane, name := range laneNames {
+		if strings.EqualFold(priority, name) {
+			return lane, true
+		}
+	}
+	return laneNormal, false
+}
+
+// validatePriorities checks cfg.PriorityByIdentity and
+// cfg.PriorityMinShare.
+func validatePriorities(cfg Config) error {
+	for identity, priority := range cfg.PriorityByIdentity {
+		if _, ok := parsePriority(priority); !ok {
+			return fmt.Errorf("invalid priority %q for %s: expected high, normal or low", priority, identity)
+		}
+	}
+	if cfg.PriorityMinShare < 0 || cfg.PriorityMinShare > 0.5 {
+		return fmt.Errorf("invalid PriorityMinShare %v: expected at most 0.5", cfg.PriorityMinShare)
+	}
+	return nil
+}
+
+// priorityLanes hold the requests processRequests has taken from the queue
+// but not sent yet, by priority. They are only used by processRequests.
+type priorityLanes struct {
+	queues [laneCount][]*request
+
+	// every is how many dispatches a lane with requests waiting may go
+	// without being served, see Config.PriorityMinShare, and skipped how
+	// many it has gone.
+	every   int
+	skipped [laneCount]int
+}
+
+// newPriorityLanes returns the lanes configured by cfg, or nil if
+// PriorityLanes is not set.
+func newPriorityLanes(cfg Config) *priorityLanes {
+	if !cfg.PriorityLanes {
+		return nil
+	}
+	share := cfg.PriorityMinShare
+	if share <= 0 {
+		share = defaultPriorityMinShare
+	}
+	return &priorityLanes{every: int(math.Round(1 / share))}
+}
+
+func (l *priorityLanes) len() int {
+	n := 0
+	for _, q := range l.queues {
+		n += len(q)
+	}
+	return n
+}
+
+func (l *priorityLanes) push(req *request) {
+	l.queues[req.lane] = append(l.queues[req.lane], req)
+}
+
+// pop removes and returns the next request to send: the oldest of the
+// highest lane with requests waiting, unless a lower lane has waited for
+// its share. l must not be empty.
+func (l *priorityLanes) pop() *request {
+	lane := -1
+	for i := laneCount - 1; i > 0 && lane < 0; i-- {
+		if q := laneOrder[i]; len(l.queues[q]) > 0 && l.skipped[q] >= l.every-1 {
+			lane = q
+		}
+	}
+	for i := 0; lane < 0; i++ {
+		if q := laneOrder[i]; len(l.queues[q]) > 0 {
+			lane = q
+		}
+	}
+	for i := range l.queues {
+		if i == lane || len(l.queues[i]) == 0 {
+			l.skipped[i] = 0
+		} else {
+			l.skipped[i]++
+		}
+	}
+
+	req := l.queues[lane][0]
+	l.queues[lane][0] = nil
+	l.queues[lane] = l.queues[lane][1:]
+	return req
+}
+
+// nextRequest returns the next request for processRequests to send to the
+// MCP server, or false once the proxy is closed and every request has been
+// taken. Without PriorityLanes, requests are taken in the order they were
+// queued. With them, the requests waiting in the queue are first moved to
+// their lanes, up to as many as the queue holds, and the next one is
+// chosen among them.
+func (p *MCPProxy) nextRequest() (*request, bool) {
+	if p.lanes == nil {
+		req, ok := <-p.requests
+		return req, ok
+	}
+	if p.lanes.len() == 0 {
+		req, ok := <-p.requests
+		if !ok {
+			return nil, false
+		}
+		p.lanes.push(req)
+	}
+fill:
+	for p.lanes.len() < cap(p.requests) {
+		select {
+		case req, ok := <-p.requests:
+			if !ok {
+				break fill
+			}
+			p.lanes.push(req)
+		default:
+			break fill
+		}
+	}
+	return p.lanes.pop(), true
+}
+
+// priority returns the lane of a request from r: the one its priorityHeader
+// names, or the one configured for its client's identity. Unknown
+// priorities are normal.
+func (p *MCPProxy) priority(r *http.Request) int {
+	if p.lanes == nil {
+		return laneNormal
+	}
+	priority := r.Header.Get(priorityHeader)
+	if priority == "" {
+		priority = p.config.PriorityByIdentity[identity(r)]
+	}
+	lane, _ := parsePriority(priority)
+	return lane
+}
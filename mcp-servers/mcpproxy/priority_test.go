@@ -0,0 +1,122 @@
+package mcpproxy
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPriorityLanesOrder(t *testing.T) {
+	lanes := newPriorityLanes(Config{PriorityLanes: true, PriorityMinShare: 0.25})
+	for i := 0; i < 8; i++ {
+		lanes.push(&request{lane: laneLow})
+		lanes.push(&request{lane: laneHigh})
+	}
+	lanes.push(&request{lane: laneNormal})
+	lanes.push(&request{lane: laneNormal})
+
+	// Lower lanes with requests waiting get every fourth dispatch
+	var order strings.Builder
+	for lanes.len() > 0 {
+		order.WriteString(laneNames[lanes.pop().lane][:1])
+	}
+	if want := "hhhlnhhlnhhlhlllll"; order.String() != want {
+		t.Errorf("Expected requests to be sent in lanes %s, got %s", want, order.String())
+	}
+}
+
+func TestPriorityLatency(t *testing.T) {
+	logs := &recordingLogger{}
+	proxy := newFakeProxy(t, "slow", Config{PriorityLanes: true, Logger: logs})
+	handler := proxy.Handler()
+	post := func(id int, priority string, delay int) time.Time {
+		r := httptest.NewRequest("POST", "/", strings.NewReader(
+			fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":"x","params":{"delayMs":%d}}`, id, delay)))
+		r.Header.Set("Content-Type", "application/json")
+		r.Header.Set(priorityHeader, priority)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if !strings.Contains(w.Body.String(), fmt.Sprintf(`"id":%d`, id)) {
+			t.Errorf("Unexpected response to %d: %s", id, w.Body.String())
+		}
+		return time.Now()
+	}
+	waitQueued := func(n int) {
+		deadline := time.Now().Add(5 * time.Second)
+		for len(proxy.requests) < n {
+			if time.Now().After(deadline) {
+				t.Fatalf("Expected %d queued requests, got %d", n, len(proxy.requests))
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	// Background traffic queues up behind a slow call, then interactive
+	// requests arrive
+	const lows, highs = 20, 4
+	finished := make([]time.Time, lows+highs)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() { defer wg.Done(); post(100, "normal", 300) }()
+	time.Sleep(50 * time.Millisecond)
+	for i := 0; i < lows; i++ {
+		wg.Add(1)
+		go func(i int) { defer wg.Done(); finished[i] = post(i, "low", 10) }(i)
+	}
+	waitQueued(lows)
+	for i := lows; i < lows+highs; i++ {
+		wg.Add(1)
+		go func(i int) { defer wg.Done(); finished[i] = post(i, "HIGH", 10) }(i)
+	}
+	waitQueued(lows + highs)
+	wg.Wait()
+
+	// Each high priority request overtakes all but the first few lows
+	for i := lows; i < lows+highs; i++ {
+		overtaken := 0
+		for _, low := range finished[:lows] {
+			if low.After(finished[i]) {
+				overtaken++
+			}
+		}
+		if overtaken < lows-highs {
+			t.Errorf("Expected high priority request %d to overtake the low ones, overtook %d of %d", i, overtaken, lows)
+		}
+	}
+	waitForLog(t, logs, "priority=high")
+	waitForLog(t, logs, "priority=low")
+}
+
+func TestPriorityByIdentity(t *testing.T) {
+	proxy := newFakeProxy(t, "ack", Config{
+		PriorityLanes:      true,
+		PriorityByIdentity: map[string]string{"batch": "low"},
+	})
+	r := httptest.NewRequest("POST", "/", nil)
+	r, id := withIdentity(r)
+	id.name = "batch"
+	if lane := proxy.priority(r); lane != laneLow {
+		t.Errorf("Expected the identity's priority, got %s", laneNames[lane])
+	}
+	r.Header.Set(priorityHeader, "high")
+	if lane := proxy.priority(r); lane != laneHigh {
+		t.Errorf("Expected the header to take precedence, got %s", laneNames[lane])
+	}
+	r.Header.Set(priorityHeader, "urgent")
+	if lane := proxy.priority(r); lane != laneNormal {
+		t.Errorf("Expected an unknown priority to be normal, got %s", laneNames[lane])
+	}
+
+	for _, cfg := range []Config{
+		{PriorityByIdentity: map[string]string{"batch": "urgent"}},
+		{PriorityMinShare: 0.75},
+	} {
+		cfg.ServerName, cfg.CommandPath = "test", "cat"
+		if _, err := NewMCPProxy(cfg); err == nil {
+			t.Errorf("Expected %+v to be rejected", cfg)
+		}
+	}
+}
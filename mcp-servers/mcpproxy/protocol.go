@@ -0,0 +1,76 @@
+package mcpproxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// protocolVersionHeader carries the MCP protocol version clients negotiated
+// in initialize on every later request, as of the 2025-06-18 revision of the
+// Streamable HTTP transport.
+const protocolVersionHeader = "MCP-Protocol-Version"
+
+// checkProtocolVersion validates the protocol version header of r against
+// Config.SupportedProtocolVersions and echoes it on the response. It
+// reports whether the request may proceed; if not, it has answered 400 Bad
+// Request.
+func (p *MCPProxy) checkProtocolVersion(w http.ResponseWriter, r *http.Request) bool {
+	version := r.Header.Get(protocolVersionHeader)
+	if version == "" {
+		return true
+	}
+	if supported := p.config.SupportedProtocolVersions; len(supported) > 0 && !contains(supported, version) {
+		p.logFor(r).Warn("Rejecting request with an unsupported protocol version", "version", version, "supported", supported)
+		http.Error(w, fmt.Sprintf("Unsupported %s %q, supported versions: %s",
+			protocolVersionHeader, version, strings.Join(supported, ", ")), http.StatusBadRequest)
+		return false
+	}
+	w.Header().Set(protocolVersionHeader, version)
+	return true
+}
+
+// checkParams rejects a message whose params member is present but neither
+// an object nor an array, when Config.StrictParams is set. It reports
+// whether the message may proceed; if not, it has answered with a -32602
+// error, 400 Bad Request for a notification.
+func (p *MCPProxy) checkParams(w http.ResponseWriter, r *http.Request, msg json.RawMessage, mcpMsg MCPMessage) bool {
+	if !p.config.StrictParams {
+		return true
+	}
+	var req struct {
+		Params json.RawMessage `json:"params"`
+	}
+	json.Unmarshal(msg, &req)
+	if req.Params == nil || req.Params[0] == '{' || req.Params[0] == '[' {
+		return true
+	}
+
+	p.logFor(r).Warn("Rejecting message with params that are not structured", "method", mcpMsg.Method, "params", truncateUTF8(string(req.Params), 100))
+	response := jsonRPCError(mcpMsg.ID, -32602, "Invalid params: params must be an object or an array")
+	if !mcpMsg.HasID {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(response)
+		return false
+	}
+	p.writeResponse(w, r, mcpMsg.Method, response, false)
+	return false
+}
+
+// setNegotiatedVersion sets the protocol version header of the response to
+// an initialize request to the version the MCP server agreed to.
+func setNegotiatedVersion(w http.ResponseWriter, method string, response json.RawMessage) {
+	if method != "initialize" {
+		return
+	}
+	var msg struct {
+		Result struct {
+			ProtocolVersion string `json:"protocolVersion"`
+		} `json:"result"`
+	}
+	if json.Unmarshal(response, &msg) == nil && msg.Result.ProtocolVersion != "" {
+		w.Header().Set(protocolVersionHeader, msg.Result.ProtocolVersion)
+	}
+}
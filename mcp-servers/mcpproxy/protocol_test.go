@@ -0,0 +1,89 @@
+package mcpproxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestProtocolVersionHeader(t *testing.T) {
+	proxy := newFakeProxy(t, "mcp", Config{SupportedProtocolVersions: []string{"2025-03-26", "2025-06-18"}})
+
+	post := func(version, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if version != "" {
+			req.Header.Set("MCP-Protocol-Version", version)
+		}
+		w := httptest.NewRecorder()
+		proxy.Handler().ServeHTTP(w, req)
+		return w
+	}
+	toolsList := `{"jsonrpc":"2.0","id":1,"method":"tools/list"}`
+
+	for _, version := range []string{"2025-03-26", "2025-06-18"} {
+		w := post(version, toolsList)
+		if w.Code != http.StatusOK || w.Header().Get("MCP-Protocol-Version") != version {
+			t.Errorf("Expected %s to be accepted and echoed, got %d %q", version, w.Code, w.Header().Get("MCP-Protocol-Version"))
+		}
+	}
+
+	w := post("2024-11-05", toolsList)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), `Unsupported MCP-Protocol-Version "2024-11-05", supported versions: 2025-03-26, 2025-06-18`) {
+		t.Errorf("Expected 400 for an unsupported version, got %d %s", w.Code, w.Body.String())
+	}
+
+	// Clients that do not send the header are let through
+	if w := post("", toolsList); w.Code != http.StatusOK || w.Header().Get("MCP-Protocol-Version") != "" {
+		t.Errorf("Expected a request without the header to pass, got %d %q", w.Code, w.Header().Get("MCP-Protocol-Version"))
+	}
+
+	// initialize reports the version the MCP server negotiated
+	w = post("", `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-06-18"}}`)
+	if got := w.Header().Get("MCP-Protocol-Version"); got != "2025-03-26" {
+		t.Errorf("Expected the negotiated version on the initialize response, got %q", got)
+	}
+}
+
+func TestProtocolVersionUnrestricted(t *testing.T) {
+	proxy := newFakeProxy(t, "mcp", Config{})
+	req := httptest.NewRequest("POST", "/", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"tools/list"}`))
+	req.Header.Set("MCP-Protocol-Version", "2099-01-01")
+	w := httptest.NewRecorder()
+	proxy.Handler().ServeHTTP(w, req)
+	if w.Code != http.StatusOK || w.Header().Get("MCP-Protocol-Version") != "2099-01-01" {
+		t.Errorf("Expected any version to pass without SupportedProtocolVersions, got %d %q", w.Code, w.Header().Get("MCP-Protocol-Version"))
+	}
+}
+
+func TestStrictParams(t *testing.T) {
+	strict := newFakeProxy(t, "ack", Config{StrictParams: true})
+	lenient := newFakeProxy(t, "ack", Config{})
+
+	for _, params := range []string{`"foo"`, `42`, `null`} {
+		body := `{"jsonrpc":"2.0","id":1,"method":"tools/list","params":` + params + `}`
+		if w := postJSON(strict, body); rpcErrorOf(t, w) != -32602 {
+			t.Errorf("Expected params %s to be rejected, got %s", params, w.Body.String())
+		}
+		if w := postJSON(lenient, body); !strings.Contains(w.Body.String(), `"size"`) {
+			t.Errorf("Expected params %s to be forwarded without StrictParams, got %s", params, w.Body.String())
+		}
+	}
+
+	for _, body := range []string{
+		`{"jsonrpc":"2.0","id":1,"method":"tools/list"}`,
+		`{"jsonrpc":"2.0","id":1,"method":"tools/list","params":{}}`,
+		`{"jsonrpc":"2.0","id":1,"method":"tools/list","params":[1,2]}`,
+	} {
+		if w := postJSON(strict, body); !strings.Contains(w.Body.String(), `"size"`) {
+			t.Errorf("Expected %s to be forwarded, got %s", body, w.Body.String())
+		}
+	}
+
+	// Notifications cannot be answered with an error, so get a 400
+	w := postJSON(strict, `{"jsonrpc":"2.0","method":"notifications/initialized","params":"x"}`)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "-32602") {
+		t.Errorf("Expected 400 for the notification, got %d %s", w.Code, w.Body.String())
+	}
+}
@@ -3,217 +3,1477 @@
 package mcpproxy
 
 import (
-	"bufio"
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"net"
 	"net/http"
 	"os"
-	"os/exec"
+	"os/signal"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 )
 
-// Config defines the configuration for an MCP proxy server.
+// closeGracePeriod is how long Close waits for the MCP server to exit after
+// its stdin is closed before killing it.
+const closeGracePeriod = 5 * time.Second
+
+// Config defines the configuration for an MCP proxy server. Fields with a
+// json tag can also be set in ConfigFile, under that name.
 type Config struct {
 	// ServerName is used for logging (e.g., "github-mcp", "sqlcl")
-	ServerName string
+	ServerName string `json:"serverName"`
 
-	// CommandPath is the default path to the MCP server binary
-	CommandPath string
+	// CommandPath is the default path to the MCP server binary. It is
+	// expanded with ExpandPath.
+	CommandPath string `json:"commandPath"`
 
 	// CommandArgs are the arguments to pass to the MCP server (e.g., "stdio", "-mcp")
-	CommandArgs []string
+	CommandArgs []string `json:"commandArgs"`
 
 	// PathEnvVar is the environment variable name to override CommandPath (optional)
-	PathEnvVar string
+	PathEnvVar string `json:"pathEnvVar"`
+
+	// AllowUnsetArgVars expands ${VAR} references to unset variables in
+	// CommandArgs and BackendVersionArgs to "" instead of failing.
+	AllowUnsetArgVars bool `json:"allowUnsetArgVars"`
+
+	// UseShell runs CommandPath and CommandArgs, joined with spaces, as a
+	// script with ShellCommand, which then does all expansion (optional).
+	UseShell bool `json:"useShell"`
+
+	// ShellCommand is the shell UseShell runs the script with, passed as its
+	// last argument (default: /bin/sh -c).
+	ShellCommand []string `json:"shellCommand"`
+
+	// WrapperCommand runs the MCP server through another stdio command, such
+	// as "oc exec -i", replacing "{command}" and "{args}" (optional).
+	WrapperCommand []string `json:"wrapperCommand"`
+
+	// Launcher creates the MCP server command in place of WrapperCommand or
+	// running CommandPath directly (optional).
+	Launcher Launcher
+
+	// TokenRefresher obtains the credential the MCP server is started with
+	// in TokenEnvVar and when it expires (optional). The MCP server is
+	// restarted when the token changes.
+	TokenRefresher func(ctx context.Context) (token string, expiresAt time.Time, err error)
+
+	// TokenEnvVar is the environment variable holding the token of
+	// TokenRefresher. Required with TokenRefresher.
+	TokenEnvVar string `json:"-"`
+
+	// TokenRefreshMargin is how long before it expires the token of
+	// TokenRefresher is refreshed (default: 5m).
+	TokenRefreshMargin time.Duration `json:"tokenRefreshMargin"`
+
+	// BackendVersionArgs are the arguments that make the MCP server print
+	// its version, logged at startup (optional, e.g. "--version").
+	BackendVersionArgs []string `json:"-"`
+
+	// Nice is added to the MCP server's niceness (optional, Linux only).
+	Nice int `json:"nice"`
+
+	// ResourceLimits caps the MCP server's resources (optional, Linux only).
+	ResourceLimits ResourceLimits `json:"resourceLimits"`
+
+	// CPUAffinity pins the MCP server to the given CPUs, numbered from 0
+	// (optional, Linux only).
+	CPUAffinity []int `json:"cpuAffinity"`
+
+	// ScratchRoot gives each MCP server process a scratch directory of its
+	// own under it, removed when the process exits (optional).
+	ScratchRoot string `json:"scratchRoot"`
+
+	// ScratchEnvVar is the environment variable holding the path of the
+	// scratch directory (default: MCP_SCRATCH_DIR).
+	ScratchEnvVar string `json:"scratchEnvVar"`
 
-	// Port is the HTTP port to listen on (default: "8080")
-	Port string
+	// ScratchQuotaBytes logs a warning when the scratch directory grows over
+	// it (optional).
+	ScratchQuotaBytes int64 `json:"scratchQuotaBytes"`
+
+	// LazyStart delays starting the MCP server until the first request
+	// needs it (optional).
+	LazyStart bool `json:"lazyStart"`
+
+	// MaxRestarts is how many consecutive crashes of the MCP server are
+	// restarted before giving up (optional, 0 disables restarts).
+	MaxRestarts int `json:"maxRestarts"`
+
+	// CoalesceRestarts shares one backoff and one log message among the
+	// restarts of an MCP server that keeps exiting right after starting.
+	CoalesceRestarts bool `json:"coalesceRestarts"`
+
+	// CleanExitCodes lists nonzero exit codes that do not count as crashes
+	// (optional). Exit code 0 is always clean.
+	CleanExitCodes []int `json:"cleanExitCodes"`
+
+	// OOMRestartDelay is the least delay before restarting an MCP server
+	// that was likely killed for running out of memory (optional).
+	OOMRestartDelay time.Duration `json:"oomRestartDelay"`
+
+	// WarmStandby keeps a second MCP server running idle for restarts to
+	// switch to at once (optional).
+	WarmStandby bool `json:"warmStandby"`
+
+	// MaxSubprocessLifetime replaces the MCP server once it has run this
+	// long, at a moment no request is in flight (optional).
+	MaxSubprocessLifetime time.Duration `json:"maxSubprocessLifetime"`
+
+	// WaitFor lists host:port pairs or URLs Run waits for before starting
+	// the MCP server, for at most WaitForTimeout (default: 5m).
+	WaitFor        []string      `json:"waitFor"`
+	WaitForTimeout time.Duration `json:"waitForTimeout"`
+
+	// ReplayInitialize replays the last initialize handshake to a restarted
+	// MCP server before any other request (optional).
+	ReplayInitialize bool `json:"replayInitialize"`
+
+	// AutoInitializedNotification sends notifications/initialized for a
+	// client that does not send it within InitializedGracePeriod (default: 1s).
+	AutoInitializedNotification bool          `json:"autoInitializedNotification"`
+	InitializedGracePeriod      time.Duration `json:"initializedGracePeriod"`
+
+	// Port is the HTTP port to listen on (default: $PORT, or "8080")
+	Port string `json:"port"`
+
+	// SupportedProtocolVersions lists the MCP-Protocol-Version header values
+	// clients may send (optional, default: any).
+	SupportedProtocolVersions []string `json:"supportedProtocolVersions"`
 
 	// EnableCORS adds CORS headers to responses
-	EnableCORS bool
+	EnableCORS bool `json:"enableCORS"`
 
 	// SkipNotifications enables strict response ID matching when waiting for a response.
 	// When true: waits for a response with an ID matching the request ID (skipping mismatches)
 	// When false: returns the first response with any ID (suitable for sequential request/response)
 	// Note: Notifications (messages without ID) are always skipped regardless of this setting.
-	SkipNotifications bool
+	SkipNotifications bool `json:"skipNotifications"`
 
 	// ResponseMiddleware is called on each response before sending to client (optional)
 	// Use this for server-specific response processing (e.g., error detection)
 	ResponseMiddleware func([]byte) []byte
 
+	// StrictMiddleware fails requests whose response lost its id or jsonrpc
+	// member in ErrorMiddleware or ResponseMiddleware, instead of repairing it.
+	StrictMiddleware bool `json:"strictMiddleware"`
+
 	// RequestMiddleware is called on each request before sending to MCP server (optional)
 	RequestMiddleware func([]byte) []byte
 
+	// ToolResultProcessors rewrite the results of tools/call by tool name
+	// (optional). ToolResultProcessorErrors is "passthrough" (default) or
+	// "fail".
+	ToolResultProcessors      map[string]func(result []byte) ([]byte, error)
+	ToolResultProcessorErrors string `json:"toolResultProcessorErrors"`
+
+	// Summarizer summarizes text results of tools/call larger than its
+	// threshold (optional).
+	Summarizer *Summarizer `json:"summarizer"`
+
+	// RequestFilter is called with every request before it is queued, and
+	// answers it with the error it returns (optional).
+	RequestFilter func(method string, msg []byte) *RPCError
+
+	// MetaHeaders copies HTTP request headers into params._meta, mapping
+	// header names to keys (optional).
+	MetaHeaders map[string]string `json:"metaHeaders"`
+
+	// EnvironmentLabel is set as params._meta.environment of every message
+	// sent to the MCP server (optional).
+	EnvironmentLabel string `json:"environmentLabel"`
+
+	// NormalizeIDType converts request ids to "string" or "number" for the
+	// MCP server (optional).
+	NormalizeIDType string `json:"normalizeIDType"`
+
+	// ResponseCacheKey returns the key and lifetime to cache the result of a
+	// tool call under (optional). An empty key bypasses the cache.
+	ResponseCacheKey func(tool string, arguments json.RawMessage) (key string, ttl time.Duration)
+
+	// ResponseCacheSize bounds the number of results cached by
+	// ResponseCacheKey (default: 1000).
+	ResponseCacheSize int `json:"responseCacheSize"`
+
+	// ErrorMiddleware is called with every JSON-RPC error from the MCP
+	// server before ResponseMiddleware, and can replace it (optional).
+	ErrorMiddleware func(method string, rpcErr *RPCError) *RPCError
+
+	// ErrorCodeToStatus maps JSON-RPC error codes to the HTTP status of error
+	// responses (optional, default: 200).
+	ErrorCodeToStatus map[int]int `json:"-"`
+
+	// MapJSONRPCErrorsToHTTP sets ErrorCodeToStatus, if unset, to
+	// DefaultErrorCodeToStatus with internal errors as 502.
+	MapJSONRPCErrorsToHTTP bool `json:"mapJSONRPCErrorsToHTTP"`
+
+	// OnRequest, OnResponse and OnBackendStateChange are observation hooks
+	// (optional). They must not block for long.
+	OnRequest            func(info RequestInfo)
+	OnResponse           func(info ResponseInfo)
+	OnBackendStateChange func(old, new string)
+
+	// ResponseCacheHeaders maps methods to the Cache-Control header of their
+	// successful responses, which also get an ETag (optional).
+	ResponseCacheHeaders map[string]string `json:"responseCacheHeaders"`
+
+	// ResourceURIRewrite maps hosts in the resource URIs of the MCP server to
+	// the host clients reach them at, and back (optional).
+	ResourceURIRewrite map[string]string `json:"resourceURIRewrite"`
+
+	// MaxRequestBytes limits the size of HTTP request bodies (optional).
+	// Larger requests are rejected with 413 Request Entity Too Large.
+	MaxRequestBytes int64 `json:"maxRequestBytes"`
+
+	// DisableUnwrapStringBodies rejects request bodies that are a JSON string
+	// holding a message instead of unwrapping them.
+	DisableUnwrapStringBodies bool `json:"disableUnwrapStringBodies"`
+
+	// SizeWarnBytes logs a warning for each request or response larger than
+	// this (optional).
+	SizeWarnBytes int64 `json:"sizeWarnBytes"`
+
+	// StreamThreshold streams request bodies larger than this to the MCP
+	// server instead of buffering them (optional, 0 disables streaming).
+	StreamThreshold int64 `json:"streamThreshold"`
+
+	// RequestMiddlewareStreamingSafe skips RequestMiddleware for streamed
+	// requests rather than buffering them.
+	RequestMiddlewareStreamingSafe bool `json:"-"`
+
+	// UnwrapSingleContent lets clients ask for the raw content of a tool
+	// result with "X-MCP-Raw: true" or "raw=true".
+	UnwrapSingleContent bool `json:"unwrapSingleContent"`
+
+	// BatchFailFast stops a JSON-RPC batch at its first failed request.
+	BatchFailFast bool `json:"batchFailFast"`
+
+	// MaxResponseBytes limits the size of a single message read from the MCP
+	// server (optional). Larger responses fail with an internal error.
+	MaxResponseBytes int `json:"maxResponseBytes"`
+
+	// Delimiter terminates each message exchanged with the MCP server
+	// (default: "\n").
+	Delimiter string `json:"delimiter"`
+
+	// Framing is "content-length" for MCP servers that precede each message
+	// with a Content-Length header instead of delimiting it (default:
+	// "delimited"). Request bodies are then never streamed.
+	Framing string `json:"framing"`
+
+	// MaxBufferedBytes caps the total size of responses not yet written to
+	// their clients (optional).
+	MaxBufferedBytes int64 `json:"maxBufferedBytes"`
+
+	// CoalesceMethods lists idempotent methods (e.g. "tools/list") whose
+	// identical concurrent requests share a call to the MCP server (optional).
+	CoalesceMethods []string `json:"coalesceMethods"`
+
+	// CoalesceTools lists read-only tools whose identical tools/call requests
+	// are coalesced the same way (optional).
+	CoalesceTools []string `json:"coalesceTools"`
+
+	// MaxQueueAge skips requests that waited longer than this to be sent to
+	// the MCP server when they reach it (optional).
+	MaxQueueAge time.Duration `json:"maxQueueAge"`
+
+	// QueueTimeout fails requests that wait longer than this to be sent to
+	// the MCP server with 503 (optional).
+	QueueTimeout time.Duration `json:"queueTimeout"`
+
+	// PriorityLanes sends queued requests by their priority, high, normal or
+	// low, rather than in arrival order (optional).
+	PriorityLanes      bool              `json:"priorityLanes"`
+	PriorityByIdentity map[string]string `json:"priorityByIdentity"`
+	PriorityMinShare   float64           `json:"priorityMinShare"`
+
+	// ToolCallTimeout limits how long a tools/call may take, and
+	// ToolTimeouts overrides it per tool (optional). A stuck MCP server is
+	// killed CancelGracePeriod (default: 5s) after the cancellation.
+	ToolCallTimeout   time.Duration            `json:"toolCallTimeout"`
+	ToolTimeouts      map[string]time.Duration `json:"toolTimeouts"`
+	CancelGracePeriod time.Duration            `json:"cancelGracePeriod"`
+
+	// PropagateDeadlines sends the deadline of each request to the MCP server
+	// in params._meta.
+	PropagateDeadlines bool `json:"propagateDeadlines"`
+
+	// CircuitBreakerFailures fails requests at once after this many failed in
+	// a row, for CircuitBreakerCooldown (default: 30s) (optional).
+	CircuitBreakerFailures int           `json:"circuitBreakerFailures"`
+	CircuitBreakerCooldown time.Duration `json:"circuitBreakerCooldown"`
+
+	// EnableNotificationStream streams the MCP server's notifications to
+	// clients that send GET to the MCP endpoint.
+	EnableNotificationStream bool `json:"enableNotificationStream"`
+
+	// ShareSubscriptions makes the proxy own the resource subscriptions of
+	// clients. Requires EnableNotificationStream.
+	ShareSubscriptions bool `json:"shareSubscriptions"`
+
+	// Notifier sends notifications of the application's own to the clients
+	// streaming notifications (optional).
+	Notifier *Notifier `json:"-"`
+
+	// ReadinessCheck is an additional readiness check for /readyz
+	// (optional). It must be quick.
+	ReadinessCheck func() error
+
+	// EnableMetrics serves Prometheus metrics at GET /metrics.
+	EnableMetrics bool `json:"enableMetrics"`
+
 	// ExtraRoutes are additional HTTP routes to register (optional)
-	// Use this for things like deprecation notices on old endpoints
+	// Use this for things like deprecation notices on old endpoints. Keys
+	// are Route patterns; the routes get no authentication or CORS headers.
 	ExtraRoutes map[string]http.HandlerFunc
+
+	// Routes are additional HTTP routes like ExtraRoutes, each of which can
+	// opt into the authentication and CORS handling of the MCP endpoint
+	// (optional).
+	Routes []Route
+
+	// LegacySSECompat serves the deprecated /sse endpoint the way earlier
+	// proxies did.
+	LegacySSECompat bool `json:"legacySSECompat"`
+
+	// SSEInitialEvent names an event sent first on legacy /sse streams, e.g.
+	// "endpoint" (optional).
+	SSEInitialEvent string `json:"sseInitialEvent"`
+
+	// SSEInactivityTimeout is how long an event stream may stay silent before
+	// a heartbeat is written to it (optional, 0 disables heartbeats).
+	SSEInactivityTimeout time.Duration `json:"sseInactivityTimeout"`
+
+	// DeprecateSSE answers requests to /sse with 410 Gone.
+	DeprecateSSE bool `json:"deprecateSSE"`
+
+	// StrictSlash disables trailing-slash-insensitive matching of
+	// ExtraRoutes.
+	StrictSlash bool `json:"strictSlash"`
+
+	// BasePath is a path prefix, e.g. "/mcp", stripped from request paths
+	// before routing (optional).
+	BasePath string `json:"basePath"`
+
+	// StrictParams rejects JSON-RPC messages whose params member is not an
+	// object or an array.
+	StrictParams bool `json:"strictParams"`
+
+	// ConfigFile is a JSON file whose settings override the ones above
+	// (optional). See Reload.
+	ConfigFile string `json:"-"`
+
+	// AuthToken requires clients to send "Authorization: Bearer <token>"
+	// (optional, default: $MCP_PROXY_AUTH_TOKEN).
+	AuthToken string `json:"authToken"`
+
+	// Authenticator authenticates requests in place of AuthToken and
+	// returns the client's identity (optional).
+	Authenticator func(r *http.Request) (identity string, err error)
+
+	// AdminToken is required in the X-Admin-Token header by /admin/* and
+	// /debug/* (optional, default: $MCP_PROXY_ADMIN_TOKEN).
+	AdminToken string `json:"adminToken"`
+
+	// EnableDebugEndpoints serves /debug/raw and /debug/logs. Leave it off in
+	// production.
+	EnableDebugEndpoints bool `json:"-"`
+
+	// DebugLogLines is how many stderr lines /debug/logs keeps (default: 500),
+	// and DebugLogStdout adds stdout lines that are not JSON.
+	DebugLogLines  int  `json:"-"`
+	DebugLogStdout bool `json:"-"`
+
+	// MaxJunkLines is how many lines that are not JSON the MCP server may
+	// write in a row while a request waits (optional).
+	MaxJunkLines int `json:"maxJunkLines"`
+
+	// MaxDesyncedResponses is how many responses with unknown ids in a row
+	// restart the MCP server (optional).
+	MaxDesyncedResponses int `json:"maxDesyncedResponses"`
+
+	// StartupGracePeriod and StartupGraceLines bound the banner an MCP server
+	// may print before its first message (optional).
+	StartupGracePeriod time.Duration `json:"startupGracePeriod"`
+	StartupGraceLines  int           `json:"startupGraceLines"`
+
+	// Logger receives the proxy's log messages (optional, default:
+	// slog.Default()).
+	Logger Logger
+
+	// DisableBodyLogging keeps request and response bodies out of the log,
+	// even at debug level.
+	DisableBodyLogging bool `json:"disableBodyLogging"`
+
+	// MethodLogLevels sets the level of the routine messages about the
+	// requests of a method, e.g. {"ping": "debug"} (optional).
+	MethodLogLevels map[string]LogLevel `json:"methodLogLevels"`
+
+	// RedactPatterns are regular expressions matching secrets to redact from
+	// the log (optional). A first group is kept.
+	RedactPatterns []string `json:"redactPatterns"`
+
+	// RedactValues are secrets to redact from the log (optional). The tokens
+	// of TokenRefresher are redacted too.
+	RedactValues []string `json:"redactValues"`
+
+	// RecordFile is a file every message exchanged with the MCP server is
+	// appended to (optional), rotated at RecordMaxSize (default: 100 MiB)
+	// keeping RecordMaxFiles (default: 5).
+	RecordFile     string `json:"recordFile"`
+	RecordMaxSize  int64  `json:"recordMaxSize"`
+	RecordMaxFiles int    `json:"recordMaxFiles"`
+
+	// EnableConfigEndpoint serves the effective configuration at GET
+	// /config, with secrets replaced by fingerprints.
+	EnableConfigEndpoint bool `json:"-"`
+
+	// StaticPrompts and StaticResources are files or directories of prompts
+	// and resources served by the proxy itself (optional).
+	StaticPrompts   string `json:"staticPrompts"`
+	StaticResources string `json:"staticResources"`
+
+	// EnableOpenAPI serves an OpenAPI 3.0 description of the routes at GET
+	// /openapi.json.
+	EnableOpenAPI bool `json:"enableOpenAPI"`
+}
+
+// ResourceLimits are rlimits applied to the MCP server process. Zero fields
+// are left unlimited. They are set right after the process starts, so they
+// do not cover processes it has already spawned by then; a wrapper script
+// should exec the real server. On other platforms than Linux, setting any
+// limit or Nice makes NewMCPProxy fail.
+type ResourceLimits struct {
+	// MaxMemoryBytes limits the address space (RLIMIT_AS). JVM-based
+	// servers reserve far more address space than they use, so leave
+	// generous headroom above the heap size.
+	MaxMemoryBytes uint64 `json:"maxMemoryBytes,omitempty"`
+
+	// MaxCPUSeconds limits total CPU time (RLIMIT_CPU); the process is
+	// killed once it is exceeded.
+	MaxCPUSeconds uint64 `json:"maxCPUSeconds,omitempty"`
+
+	// MaxOpenFiles limits open file descriptors (RLIMIT_NOFILE).
+	MaxOpenFiles uint64 `json:"maxOpenFiles,omitempty"`
+}
+
+// maxCPU is the highest CPU number CPUAffinity accepts.
+const maxCPU = 4095
+
+// validateCPUAffinity checks that cfg.CPUAffinity holds valid CPU numbers.
+func validateCPUAffinity(cfg Config) error {
+	for _, cpu := range cfg.CPUAffinity {
+		if cpu < 0 || cpu > maxCPU {
+			return fmt.Errorf("CPUAffinity holds invalid CPU %d, expected 0 to %d", cpu, maxCPU)
+		}
+	}
+	return nil
 }
 
 // MCPProxy handles the communication between HTTP clients and stdio-based MCP servers.
 type MCPProxy struct {
 	config   Config
-	cmd      *exec.Cmd
-	stdin    io.WriteCloser
-	stdout   *bufio.Reader
+	log      Logger
 	requests chan *request
+
+	// lanes hold the requests taken off requests by processRequests, if
+	// Config.PriorityLanes is set.
+	lanes *priorityLanes
+
+	// inflight holds the client requests being served, see /admin/inflight.
+	inflight inflightRegistry
+
+	// dynamic holds the settings that Reload can change; request handling
+	// must read them from here rather than from config. baseConfig is the
+	// Config given to NewMCPProxy, before ConfigFile was applied.
+	dynamic    atomic.Pointer[dynamicConfig]
+	baseConfig Config
+	reloadMu   sync.Mutex
+
+	// backend is replaced by supervise when the MCP server restarts.
+	// backendMu guards the pointer and status, while the backend's pipes
+	// are only used by processRequests. backendCond is broadcast whenever
+	// either changes.
+	backendMu   sync.Mutex
+	backendCond *sync.Cond
+	backend     *backend
+	status      BackendStatus
+
+	started    chan struct{} // closed once the first MCP server has started
+	stopping   chan struct{} // closed by Close to stop supervision
+	supervised chan struct{} // closed once supervise returns
+
+	// mu guards closed, and senders counts the enqueue calls past the
+	// check of closed, so that Close can close requests once they are all
+	// done. It is never held while waiting for room in the queue.
+	mu        sync.RWMutex
+	closed    bool
+	senders   sync.WaitGroup
+	closeOnce sync.Once
+
+	done chan struct{} // closed once processRequests returns
+
+	// dispatcherStopped is set if processRequests panicked, see
+	// recoverDispatcher.
+	dispatcherStopped atomic.Bool
+
+	metrics  *metrics
+	buffered *bufferedResponses // see Config.MaxBufferedBytes
+	redactor *redactor          // shared by every logger, see Config.RedactValues
+	output   *outputBuffer      // see Config.DebugLogLines
+	recorder *recorder          // see Config.RecordFile
+	memo     *memo              // see Config.ResponseCacheKey
+	static   *staticContent     // see Config.StaticPrompts
+	tokens   *tokenSource       // see Config.TokenRefresher
+	breaker  *breaker           // see Config.CircuitBreakerFailures
+	standby  *standby           // see Config.WarmStandby
+
+	refreshed chan struct{} // closed once refreshTokens returns, if it runs
+	recycled  chan struct{} // closed once recycleBackends returns, if it runs
+
+	backendVersion string // see Config.BackendVersionArgs
+
+	flightsMu sync.Mutex
+	flights   map[string]*flight // in-flight coalesced calls by key
+
+	// seq is the sequence number of the last message read from the MCP
+	// server, only used by processRequests. See EnableNotificationStream.
+	seq           uint64
+	notifications notificationHub
+	sessions      sessionRegistry
+	subscriptions subscriptionRegistry // see Config.ShareSubscriptions
+
+	// lastID is the last id assigned by normalizeID, only used by
+	// processRequests. See NormalizeIDType.
+	lastID int64
+
+	// burst is the current run of coalesced restarts, only used by
+	// supervise. See CoalesceRestarts.
+	burst restartBurst
+
+	// handshake is the initialization replayed to restarted MCP servers,
+	// only used by processRequests. See ReplayInitialize.
+	handshake handshake
 }
 
 type request struct {
 	msg       json.RawMessage
+	method    string
 	isRequest bool
 	response  chan json.RawMessage
+
+	// body and id are set instead of msg for requests streamed to the MCP
+	// server without buffering.
+	body io.Reader
+	id   interface{}
+
+	// err records why the request failed; it is set before response is
+	// closed.
+	err error
+
+	// seq is the sequence number of the response, see
+	// Config.EnableNotificationStream.
+	seq uint64
+
+	// lane is the priority lane of the request, see Config.PriorityLanes.
+	lane int
+
+	// inflight describes the request at /admin/inflight while it is served,
+	// if it came from a client.
+	inflight *inflight
+
+	// restart asks processRequests to replace the MCP server, for this
+	// reason, instead of sending anything. See Restart.
+	restart string
+
+	// clientID is the id the client sent if normalizedID is set, which
+	// means the MCP server was sent another, see Config.NormalizeIDType.
+	clientID     interface{}
+	normalizedID bool
+
+	// finished closes response exactly once, see finish.
+	finished sync.Once
+
+	// unwrap asks for the response to be returned as raw content
+	// (see Config.UnwrapSingleContent).
+	unwrap bool
+
+	// raw skips ErrorMiddleware and ResponseMiddleware, so the response is
+	// returned exactly as the MCP server sent it (see /debug/raw).
+	raw bool
+
+	// tool is the name of the tool a buffered tools/call calls, as the
+	// client sent it, see Config.ToolResultProcessors.
+	tool string
+
+	// callTimeout bounds the wait for the response to a tools/call, see
+	// Config.ToolCallTimeout, and queueTimeout the wait for room in the
+	// queue and in it, see Config.QueueTimeout; 0 if unbounded. Both are
+	// settled before the request is queued, so Reload does not change them.
+	callTimeout  time.Duration
+	queueTimeout time.Duration
+
+	// enqueued is when the request was queued, and started when
+	// processRequests was ready to send it to the MCP server.
+	enqueued time.Time
+	started  time.Time
+
+	// initializedFor is the MCP server to send notifications/initialized
+	// to instead of a message from a client, see
+	// Config.AutoInitializedNotification.
+	initializedFor *backend
+
+	// deadline is when the client stops waiting for the response, if its
+	// request context has a deadline, see Config.PropagateDeadlines.
+	deadline time.Time
+
+	// abandoned is set once the client has gone away, so that the request
+	// is skipped if it has not been sent yet.
+	abandoned atomic.Bool
+
+	// claimed is set by whoever gets to the request first: processRequests
+	// to send it, or the client's handler when QueueTimeout passes, which
+	// closes queueExpired.
+	claimed      atomic.Bool
+	queueExpired chan struct{}
+
+	// gone is closed once the client stops waiting for the response, so
+	// that enqueue does not wait for room in the queue for nobody.
+	gone <-chan struct{}
+
+	// log is the Logger for messages about the request, p.log if unset.
+	log Logger
+}
+
+// finish closes the response channel of r, once processRequests is done
+// with it.
+func (r *request) finish() {
+	r.finished.Do(func() { close(r.response) })
+}
+
+// fail finishes r with err, unless it was already finished.
+func (r *request) fail(err error) {
+	r.finished.Do(func() {
+		r.err = err
+		close(r.response)
+	})
+}
+
+// requestID returns the JSON-RPC id of r.
+func (r *request) requestID() interface{} {
+	if r.body != nil {
+		return r.id
+	}
+	var msg MCPMessage
+	json.Unmarshal(r.msg, &msg)
+	return msg.ID
 }
 
-// MCPMessage is used to extract the ID from MCP messages.
+// MCPMessage is used to extract the ID and method from MCP messages.
 type MCPMessage struct {
-	ID interface{} `json:"id,omitempty"`
+	ID     interface{} `json:"id,omitempty"`
+	Method string      `json:"method,omitempty"`
+
+	// HasID is set when the message has an id member, even a null one. A
+	// request with "id": null is still a request and is answered, unlike a
+	// notification, which has no id at all.
+	HasID bool `json:"-"`
 }
 
-// NewMCPProxy creates a new MCP proxy with the given configuration.
+// UnmarshalJSON decodes the id and method of a message, recording whether
+// the id is present.
+func (m *MCPMessage) UnmarshalJSON(data []byte) error {
+	var msg struct {
+		ID     json.RawMessage `json:"id"`
+		Method string          `json:"method"`
+	}
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return err
+	}
+	*m = MCPMessage{Method: msg.Method, HasID: msg.ID != nil}
+	if msg.ID != nil {
+		return json.Unmarshal(msg.ID, &m.ID)
+	}
+	return nil
+}
+
+// NewMCPProxy creates a new MCP proxy with the given configuration. The
+// caller owns the proxy and must Close it once done, whether or not Run was
+// called, to stop the MCP server and the proxy's goroutines. If NewMCPProxy
+// fails, nothing it started is left behind, so it may be retried in a loop
+// without leaking processes, goroutines or file descriptors.
 func NewMCPProxy(cfg Config) (*MCPProxy, error) {
-	// Apply defaults
-	if cfg.Port == "" {
-		cfg.Port = "8080"
+	base := cfg
+	cfg, err := resolveConfig(cfg)
+	if err != nil {
+		return nil, err
 	}
+	redactor := newRedactor(cfg)
+	logger := newRedactingLogger(cfg, redactor)
+	startReaper(logger)
+	warnIgnoredLimits(cfg, logger)
 
-	// Check for path override from environment
-	cmdPath := cfg.CommandPath
-	if cfg.PathEnvVar != "" {
-		if envPath := os.Getenv(cfg.PathEnvVar); envPath != "" {
-			cmdPath = envPath
+	// With LazyStart, not even the version command runs before the first
+	// request.
+	var backendVersion string
+	if !cfg.LazyStart {
+		backendVersion = BackendVersion(cfg)
+	}
+	if backendVersion != "" {
+		logger.Info("MCP server version", "version", backendVersion)
+	}
+
+	tokens := newTokenSource(cfg, redactor)
+	if tokens != nil {
+		if _, err := tokens.refresh(context.Background()); err != nil {
+			return nil, fmt.Errorf("failed to obtain token: %w", err)
 		}
 	}
 
-	log.Printf("[%s] Starting MCP server at: %s", cfg.ServerName, cmdPath)
+	static, err := loadStatic(cfg)
+	if err != nil {
+		return nil, err
+	}
+	output := newOutputBuffer(cfg, redactor)
+	recorder, err := newRecorder(cfg, logger, redactor)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open record file: %w", err)
+	}
+	var b *backend
+	status := BackendStatus{State: StateIdle}
+	if !cfg.LazyStart {
+		if b, err = startBackend(cfg, logger, output, tokens.env()); err != nil {
+			recorder.close()
+			return nil, &BackendError{Err: err}
+		}
+		status = BackendStatus{State: StateRunning, PID: b.cmd.Process.Pid, StartedAt: time.Now()}
+	}
 
-	cmd := exec.Command(cmdPath, cfg.CommandArgs...)
-	cmd.Env = append(os.Environ())
+	proxy := &MCPProxy{
+		config:     cfg,
+		log:        logger,
+		redactor:   redactor,
+		baseConfig: base,
+		backend:    b,
+		status:     status,
+		started:    make(chan struct{}),
+		stopping:   make(chan struct{}),
+		supervised: make(chan struct{}),
+		requests:   make(chan *request, 100),
+		lanes:      newPriorityLanes(cfg),
+		done:       make(chan struct{}),
+		metrics:    newMetrics(cfg.ServerName),
+		flights:    make(map[string]*flight),
+		output:     output,
+		recorder:   recorder,
+		memo:       newMemo(cfg),
+		static:     static,
+		tokens:     tokens,
+		breaker:    newBreaker(cfg, logger),
+		standby:    newStandby(cfg),
 
-	stdin, err := cmd.StdinPipe()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get stdin pipe: %w", err)
+		backendVersion: backendVersion,
+	}
+	proxy.metrics.buildInfo.Set(1, Version, Commit, BuildDate, runtime.Version(), backendVersion)
+	proxy.buffered = newBufferedResponses(cfg.MaxBufferedBytes, proxy.metrics.buffered)
+	proxy.dynamic.Store(newDynamicConfig(cfg))
+	proxy.subscriptions.expire = proxy.expireSubscriptions
+	proxy.backendCond = sync.NewCond(&proxy.backendMu)
+	if b != nil {
+		close(proxy.started)
 	}
+	if cfg.Notifier != nil {
+		cfg.Notifier.attach(proxy)
+	}
+	proxy.observeBackend()
 
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get stdout pipe: %w", err)
+	go proxy.supervise()
+	go proxy.processRequests()
+	if proxy.standby != nil {
+		go proxy.keepStandby()
+	}
+	if tokens != nil {
+		proxy.refreshed = make(chan struct{})
+		go proxy.refreshTokens()
 	}
+	if cfg.MaxSubprocessLifetime > 0 {
+		proxy.recycled = make(chan struct{})
+		go proxy.recycleBackends()
+	}
+	return proxy, nil
+}
 
-	stderr, err := cmd.StderrPipe()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get stderr pipe: %w", err)
+// applyDefaults fills in unset Config fields.
+func applyDefaults(cfg *Config) {
+	if cfg.Port == "" {
+		cfg.Port = os.Getenv("PORT")
+	}
+	if cfg.Port == "" {
+		cfg.Port = "8080"
+	}
+	if cfg.AuthToken == "" {
+		cfg.AuthToken = os.Getenv(authTokenEnvVar)
+	}
+	if cfg.ScratchRoot != "" && cfg.ScratchEnvVar == "" {
+		cfg.ScratchEnvVar = defaultScratchEnvVar
+	}
+	if cfg.MapJSONRPCErrorsToHTTP && cfg.ErrorCodeToStatus == nil {
+		cfg.ErrorCodeToStatus = make(map[int]int, len(DefaultErrorCodeToStatus))
+		for code, status := range DefaultErrorCodeToStatus {
+			cfg.ErrorCodeToStatus[code] = status
+		}
+		cfg.ErrorCodeToStatus[-32603] = http.StatusBadGateway
+	}
+	if cfg.AdminToken == "" {
+		cfg.AdminToken = os.Getenv(adminTokenEnvVar)
+	}
+	if cfg.CancelGracePeriod <= 0 {
+		cfg.CancelGracePeriod = defaultCancelGracePeriod
+	}
+	if cfg.InitializedGracePeriod <= 0 {
+		cfg.InitializedGracePeriod = defaultInitializedGracePeriod
+	}
+	if s := cfg.Summarizer; s != nil && s.Timeout <= 0 {
+		withDefault := *s
+		withDefault.Timeout = defaultSummarizerTimeout
+		cfg.Summarizer = &withDefault
+	}
+	if cfg.RecordMaxSize <= 0 {
+		cfg.RecordMaxSize = defaultRecordMaxSize
+	}
+	if cfg.RecordMaxFiles <= 0 {
+		cfg.RecordMaxFiles = defaultRecordMaxFiles
 	}
+	if cfg.WaitForTimeout <= 0 {
+		cfg.WaitForTimeout = defaultWaitForTimeout
+	}
+	if cfg.CircuitBreakerCooldown <= 0 {
+		cfg.CircuitBreakerCooldown = defaultBreakerCooldown
+	}
+	if cfg.Delimiter == "" {
+		cfg.Delimiter = defaultDelimiter
+	}
+}
 
-	// Log stderr from the MCP server
-	go func() {
-		scanner := bufio.NewScanner(stderr)
-		for scanner.Scan() {
-			log.Printf("[%s stderr] %s", cfg.ServerName, scanner.Text())
+// resolveConfig returns cfg with its ConfigFile and defaults applied.
+func resolveConfig(cfg Config) (Config, error) {
+	if cfg.ConfigFile != "" {
+		var err error
+		if cfg, err = loadConfigFile(cfg); err != nil {
+			return cfg, err
 		}
-	}()
+	}
+	applyDefaults(&cfg)
+	return cfg, validateConfig(cfg)
+}
 
-	if err := cmd.Start(); err != nil {
-		return nil, fmt.Errorf("failed to start MCP server: %w", err)
+// validateConfig checks cfg, with its defaults applied.
+func validateConfig(cfg Config) error {
+	if err := validatePaths(cfg); err != nil {
+		return err
+	}
+	if err := validateWrapper(cfg); err != nil {
+		return err
+	}
+	if err := validateErrorStatuses(cfg); err != nil {
+		return err
+	}
+	if err := validateRoutes(cfg); err != nil {
+		return err
+	}
+	if err := validateBasePath(cfg); err != nil {
+		return err
+	}
+	if err := validateResourceURIRewrite(cfg); err != nil {
+		return err
+	}
+	if err := validateRedactPatterns(cfg); err != nil {
+		return err
+	}
+	if err := validateIDType(cfg); err != nil {
+		return err
+	}
+	if err := validateTokenRefresher(cfg); err != nil {
+		return err
 	}
+	if err := validatePriorities(cfg); err != nil {
+		return err
+	}
+	if err := validateDelimiter(cfg); err != nil {
+		return err
+	}
+	if err := validateFraming(cfg); err != nil {
+		return err
+	}
+	if err := validateCPUAffinity(cfg); err != nil {
+		return err
+	}
+	if err := validateScratch(cfg); err != nil {
+		return err
+	}
+	if err := validateSSEInitialEvent(cfg); err != nil {
+		return err
+	}
+	if err := validateToolResultProcessorErrors(cfg); err != nil {
+		return err
+	}
+	if err := validateMethodLogLevels(cfg); err != nil {
+		return err
+	}
+	if err := validateShareSubscriptions(cfg); err != nil {
+		return err
+	}
+	if err := validateSummarizer(cfg); err != nil {
+		return err
+	}
+	if err := validateWaitFor(cfg); err != nil {
+		return err
+	}
+	return nil
+}
 
-	log.Printf("[%s] Started MCP server (PID: %d)", cfg.ServerName, cmd.Process.Pid)
+// Close shuts down the proxy: it stops accepting requests, closes the MCP
+// server's stdin to signal EOF, waits briefly for it to exit (killing it if
+// it does not), and waits for the background goroutines to finish.
+// Requests still queued are failed. Close is idempotent and safe to call
+// concurrently with Handle; later calls wait for the first one to finish
+// and return nil.
+func (p *MCPProxy) Close() error {
+	var err error
+	p.closeOnce.Do(func() {
+		// Closing stopping first releases the enqueue calls waiting for
+		// room in the queue, which the queue is closed behind.
+		close(p.stopping)
+		p.mu.Lock()
+		p.closed = true
+		p.mu.Unlock()
+		p.senders.Wait()
+		close(p.requests)
+		if p.config.Notifier != nil {
+			p.config.Notifier.detach(p)
+		}
 
-	proxy := &MCPProxy{
-		config:   cfg,
-		cmd:      cmd,
-		stdin:    stdin,
-		stdout:   bufio.NewReader(stdout),
-		requests: make(chan *request, 100),
+		// Closing stdin makes a pending read fail, so processRequests can
+		// drain the queue and return. There is no MCP server yet if
+		// LazyStart is set and no request came in.
+		if b := p.currentBackend(); b != nil {
+			b.stdin.Close()
+		}
+		<-p.done
+
+		if b := p.currentBackend(); b != nil {
+			err = b.stop(closeGracePeriod)
+		}
+		<-p.supervised
+		if p.standby != nil {
+			<-p.standby.done
+		}
+		if p.refreshed != nil {
+			<-p.refreshed
+		}
+		if p.recycled != nil {
+			<-p.recycled
+		}
+		p.recorder.close()
+		p.log.Info("Proxy closed")
+	})
+	return err
+}
+
+// isClosed reports whether Close has been called.
+func (p *MCPProxy) isClosed() bool {
+	select {
+	case <-p.stopping:
+		return true
+	default:
+		return false
 	}
+}
 
-	go proxy.processRequests()
-	return proxy, nil
+// currentBackend returns the running MCP server instance, or nil if it has
+// not been started yet (see Config.LazyStart).
+func (p *MCPProxy) currentBackend() *backend {
+	p.backendMu.Lock()
+	defer p.backendMu.Unlock()
+	return p.backend
+}
+
+// enqueue hands a request to processRequests. It fails with ErrProxyClosed
+// if the proxy is closed before there is room in the queue, with a
+// *QueueFullError if the queue stayed full until req's QueueTimeout, or
+// with context.Canceled if its client went away meanwhile.
+func (p *MCPProxy) enqueue(req *request) error {
+	p.mu.RLock()
+	if p.closed {
+		p.mu.RUnlock()
+		return ErrProxyClosed
+	}
+	p.senders.Add(1)
+	p.mu.RUnlock()
+	defer p.senders.Done()
+
+	req.enqueued = time.Now()
+	if req.method == "tools/call" && req.body == nil {
+		req.tool = toolName(req.msg)
+	}
+	req.callTimeout = p.dynamic.Load().toolCallTimeout(req)
+	select {
+	case p.requests <- req:
+		return nil
+	case <-p.stopping:
+		return ErrProxyClosed
+	case <-req.queueExpired:
+		return &QueueFullError{Capacity: cap(p.requests), Waited: time.Since(req.enqueued)}
+	case <-req.gone:
+		return context.Canceled
+	}
 }
 
 func (p *MCPProxy) processRequests() {
-	for req := range p.requests {
+	defer close(p.done)
+	var current *request
+	defer p.recoverDispatcher(&current)
+	for {
+		req, ok := p.nextRequest()
+		if !ok {
+			return
+		}
+		current = req
+		if req.log == nil {
+			req.log = p.log
+		}
+		if req.restart != "" {
+			p.replaceBackend(req.restart)
+			req.finish()
+			continue
+		}
+		if req.initializedFor != nil {
+			p.sendInitialized(req.initializedFor, req.log)
+			req.finish()
+			continue
+		}
+		b := p.liveBackend()
+		req.started = time.Now()
+		if !p.dequeue(req) {
+			continue
+		}
+		if b == nil {
+			status := p.Status()
+			req.err = &BackendError{State: status.State, Exit: status.LastExit}
+			p.breaker.record(true)
+			req.finish()
+			continue
+		}
+		if req.isRequest && p.shed(req) {
+			continue
+		}
+		req.markSent()
+		if p.config.ReplayInitialize {
+			p.replayInitialize(b, req)
+		}
+		if req.body != nil {
+			p.processStream(b, req)
+			continue
+		}
+
 		msg := req.msg
 
 		// Apply request middleware if configured
-		if p.config.RequestMiddleware != nil {
-			msg = p.config.RequestMiddleware(msg)
+		if mw := p.config.RequestMiddleware; mw != nil {
+			if id := callMiddleware(req.log, "RequestMiddleware", func() { msg = mw(msg) }); id != "" {
+				p.failMiddleware(req, id)
+				continue
+			}
 		}
 
-		log.Printf("[%s] Sending: %s", p.config.ServerName, string(msg))
+		if req.isRequest && p.config.NormalizeIDType != "" && p.config.NormalizeIDType != idTypeNone {
+			msg = p.normalizeID(msg, req)
+		}
+
+		if req.isRequest && p.config.PropagateDeadlines {
+			msg = p.propagateDeadline(msg, req)
+		}
+
+		p.logBody(req.log, "Sending", msg)
 
 		// Write to stdio (newline-delimited JSON)
-		if _, err := p.stdin.Write(append(msg, '\n')); err != nil {
-			log.Printf("[%s] Error writing to stdin: %v", p.config.ServerName, err)
-			close(req.response)
+		if err := b.writer.WriteFrame(msg); err != nil {
+			req.log.Error("Error writing to stdin", "error", err)
+			req.err = p.writeError(b, err)
+			req.finish()
 			continue
 		}
+		p.recorder.record(b.cmd.Process.Pid, "sent", msg)
 
 		// Only read response if this is a request (has ID), not a notification
 		if req.isRequest {
 			// Use the potentially middleware-modified msg for ID matching
-			response, err := p.readResponse(msg)
-			if err != nil {
-				log.Printf("[%s] Error reading response: %v", p.config.ServerName, err)
-				close(req.response)
-				continue
+			var reqMsg MCPMessage
+			json.Unmarshal(msg, &reqMsg)
+			response := p.deliverResponse(b, req, reqMsg.ID)
+			p.breaker.record(breakerFailure(response, req.err))
+			if p.config.ReplayInitialize {
+				p.handshake.record(req.method, msg, response)
 			}
-
-			// Apply response middleware if configured
-			if p.config.ResponseMiddleware != nil {
-				response = p.config.ResponseMiddleware(response)
+			if req.method == "initialize" && p.config.AutoInitializedNotification {
+				p.awaitInitialized(b, req.log, response)
+			}
+		} else {
+			if p.config.ReplayInitialize {
+				p.handshake.record(req.method, msg, nil)
+			}
+			if req.method == "notifications/initialized" {
+				b.initializedSent()
 			}
-
-			req.response <- response
 		}
-		close(req.response)
+		req.finish()
+	}
+}
+
+// processStream copies a streamed request body to the MCP server and reads
+// its response.
+func (p *MCPProxy) processStream(b *backend, req *request) {
+	req.log.Debug("Streaming request body", "id", req.id)
+
+	n, err := b.writer.WriteStream(req.body)
+	if isBodyError(err) {
+		// The frame was ended before the first invalid byte, so the MCP
+		// server gets a message cut short, which it cannot parse either.
+		req.log.Warn("Invalid streamed request body", "bytes", n, "error", err)
+		req.err = err
+		req.finish()
+		return
+	}
+	if err != nil {
+		req.log.Error("Error streaming request body", "bytes", n, "error", err)
+		req.err = p.writeError(b, err)
+		req.finish()
+		return
+	}
+	req.log.Debug("Streamed request body", "bytes", n)
+
+	if req.isRequest {
+		response := p.deliverResponse(b, req, req.id)
+		p.breaker.record(breakerFailure(response, req.err))
 	}
+	req.finish()
 }
 
-func (p *MCPProxy) readResponse(originalRequest json.RawMessage) (json.RawMessage, error) {
-	// Parse the request to get its ID for matching
-	var reqMsg MCPMessage
-	json.Unmarshal(originalRequest, &reqMsg)
-	requestID := reqMsg.ID
+// writeError returns the error of a request that could not be written to
+// b because of err. Writes fail when the MCP server has exited, in which
+// case the error says how.
+func (p *MCPProxy) writeError(b *backend, err error) error {
+	if exit := p.awaitExitInfo(b); exit != nil {
+		return &BackendError{Err: fmt.Errorf("error writing to MCP server: %w", err), Exit: exit}
+	}
+	return err
+}
+
+// deliverResponse reads the response to the request with the given ID and
+// sends it on req.response. Whoever receives the response must release it
+// from p.buffered once it has been written. It returns the response as the
+// MCP server sent it, or nil if none was read.
+func (p *MCPProxy) deliverResponse(b *backend, req *request, requestID interface{}) json.RawMessage {
+	var deadline *callDeadline
+	if timeout := req.callTimeout; timeout > 0 {
+		deadline = p.startDeadline(b, req, requestID, timeout)
+	}
+	response, seq, err := p.readResponse(b, req.log, requestID)
+	if deadline != nil {
+		response, err = p.settleDeadline(b, req, requestID, deadline, response, err)
+	}
+	if err != nil {
+		req.log.Error("Error reading response", "error", err)
+		req.err = err
+		return nil
+	}
+	req.seq = seq
+	original := response
+
+	// Answer with the id the client sent
+	if req.normalizedID {
+		response = withID(response, req.clientID)
+		requestID = req.clientID
+	}
+
+	if req.raw {
+		p.buffered.acquire(len(response), p.stopping)
+		req.response <- response
+		return original
+	}
+
+	if len(p.config.ToolResultProcessors) > 0 {
+		response = p.processToolResult(req, requestID, response)
+	}
+
+	// Let the error middleware rewrite JSON-RPC errors from the MCP server
+	if mw := p.config.ErrorMiddleware; mw != nil {
+		if id := callMiddleware(req.log, "ErrorMiddleware", func() { response = applyErrorMiddleware(response, req.method, mw) }); id != "" {
+			response = middlewareError(requestID, id)
+		} else {
+			response = p.checkMiddlewareResponse(req.log, "ErrorMiddleware", requestID, response)
+		}
+	}
+
+	// Point resource URIs at the proxy's externally visible address
+	if len(p.config.ResourceURIRewrite) > 0 {
+		response = rewriteResourceURIs(response, req.method, p.config.ResourceURIRewrite)
+	}
 
+	// Add the prompts and resources the proxy serves itself
+	if p.static != nil {
+		if req.method == "initialize" {
+			response = p.static.advertise(response)
+		}
+		response = p.static.merge(req.log, req.method, req.msg, response)
+	}
+
+	// Apply response middleware if configured
+	if mw := p.config.ResponseMiddleware; mw != nil {
+		if id := callMiddleware(req.log, "ResponseMiddleware", func() { response = mw(response) }); id != "" {
+			response = middlewareError(requestID, id)
+		} else {
+			response = p.checkMiddlewareResponse(req.log, "ResponseMiddleware", requestID, response)
+		}
+	}
+
+	// Wait for slow clients if too many responses are waiting to be written
+	p.buffered.acquire(len(response), p.stopping)
+	req.response <- response
+	return original
+}
+
+// readResponse reads messages from the MCP server until the response to the
+// request with the given ID, which it returns with its sequence number.
+// Notifications read meanwhile are published to the notification streams.
+func (p *MCPProxy) readResponse(b *backend, log Logger, requestID interface{}) (json.RawMessage, uint64, error) {
+	skipNotifications := p.dynamic.Load().SkipNotifications
 	for {
-		line, err := p.stdout.ReadBytes('\n')
+		// responseData aliases the reader's buffers; it is copied out only
+		// once it is known to be the response, so skipped notifications
+		// never allocate.
+		responseData, err := b.stdout.ReadFrame()
+		if err == nil || errors.As(err, new(*frameTooLargeError)) {
+			p.seq++
+		}
+		var tooLarge *frameTooLargeError
+		if errors.As(err, &tooLarge) {
+			// The message was discarded, but the stream is intact. Work out
+			// from its head whether it was our response: anything with a
+			// method is a notification or a server-initiated request.
+			env, _ := scanEnvelope(tooLarge.Head)
+			if env.Method != "" {
+				log.Warn("Dropped oversized message", "method", env.Method, "error", err)
+				continue
+			}
+			log.Warn("Dropped oversized response", "id", env.ID, "error", err)
+			b.completed.add(formatID(env.ID))
+			return jsonRPCError(requestID, -32603,
+				fmt.Sprintf("Response from MCP server exceeded the %d byte limit", tooLarge.Limit)), p.seq, nil
+		}
+		if errors.Is(err, errMalformedFrame) {
+			log.Warn("Skipped malformed message from MCP server", "error", err)
+			continue
+		}
 		if err != nil {
-			return nil, fmt.Errorf("error reading from MCP server: %w", err)
+			// Its stdout is closed once the MCP server has been reaped, which
+			// may happen before the read starts
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, os.ErrClosed) {
+				b.killIfLingering()
+				return nil, 0, &BackendError{Err: fmt.Errorf("error reading from MCP server: %w", err), Exit: p.awaitExitInfo(b)}
+			}
+			return nil, 0, fmt.Errorf("error reading from MCP server: %w", err)
 		}
 
-		responseData := line[:len(line)-1]
-		log.Printf("[%s] Received: %s", p.config.ServerName, string(responseData))
+		p.logBody(log, "Received", responseData)
+		p.recorder.record(b.cmd.Process.Pid, "received", responseData)
 
 		// Parse the response to check if it has an ID
 		var respMsg MCPMessage
-		json.Unmarshal(responseData, &respMsg)
+		if json.Unmarshal(responseData, &respMsg) != nil {
+			if p.config.DebugLogStdout {
+				p.output.add(b.cmd.Process.Pid, "stdout", string(responseData))
+			}
+			if response, drop := p.junkLine(b, log, responseData, requestID); response != nil {
+				return response, p.seq, nil
+			} else if drop {
+				continue
+			}
+		} else {
+			b.spoken, b.junk = true, 0
+		}
 
 		// Always skip notifications (messages without ID)
 		// Notifications are server-initiated messages that don't correspond to any request
-		if respMsg.ID == nil {
-			log.Printf("[%s] Skipping notification while waiting for response", p.config.ServerName)
+		if !respMsg.HasID {
+			if p.notifications.active() {
+				m := sequencedMessage{seq: p.seq, msg: copyMessage(responseData)}
+				if p.config.ShareSubscriptions {
+					p.notifications.publishTo(m, log, p.subscriber(m.msg))
+				} else {
+					p.notifications.publish(m, log)
+				}
+			} else {
+				log.Debug("Skipping notification while waiting for response")
+			}
 			continue
 		}
 
+		// A null id is what servers answer with when they could not read the
+		// id of a request, e.g. with a parse error. Requests are sent one at
+		// a time, so it is most likely about the one waiting.
+		if respMsg.ID == nil && requestID != nil {
+			log.Warn("MCP server answered with a null id, taking it for the response to the waiting request", "expected", requestID)
+			b.completed.add(formatID(requestID))
+			return withID(copyMessage(responseData), requestID), p.seq, nil
+		}
+
+		// Buggy servers may answer a request twice. The extra answer must not
+		// be taken for the response to a later request.
+		id := formatID(respMsg.ID)
+		matches := id == formatID(requestID)
+		if !matches && b.completed.contains(id) {
+			log.Warn("Discarding duplicate response", "id", respMsg.ID)
+			continue
+		}
+		b.completed.add(id)
+		if matches {
+			b.desyncs = 0
+		} else if response := p.desyncedResponse(b, log, respMsg.ID, requestID); response != nil {
+			return response, p.seq, nil
+		}
+
 		// If SkipNotifications is disabled, return the first response with an ID
 		// This is suitable for MCP servers that don't emit notifications between request/response
-		if !p.config.SkipNotifications {
-			return responseData, nil
+		if !skipNotifications {
+			return copyMessage(responseData), p.seq, nil
 		}
 
 		// When SkipNotifications is enabled, also verify the response ID matches the request ID
 		// This handles servers that may send multiple responses or out-of-order responses
-		if respMsg.ID == requestID || formatID(respMsg.ID) == formatID(requestID) {
-			return responseData, nil
+		if matches {
+			return copyMessage(responseData), p.seq, nil
 		}
 
 		// Mismatched ID - log warning and return anyway to prevent hanging
-		log.Printf("[%s] Warning: received response with unexpected ID %v (expected %v)",
-			p.config.ServerName, respMsg.ID, requestID)
-		return responseData, nil
+		log.Warn("Received response with unexpected ID", "id", respMsg.ID, "expected", requestID)
+		return copyMessage(responseData), p.seq, nil
+	}
+}
+
+// copyMessage returns a copy of data that does not alias any read buffer and
+// can safely be handed to the HTTP handler goroutine.
+func copyMessage(data []byte) json.RawMessage {
+	return append(json.RawMessage(make([]byte, 0, len(data))), data...)
+}
+
+// RPCError is a JSON-RPC error object.
+type RPCError struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("JSON-RPC error %d: %s", e.Code, e.Message)
+}
+
+// jsonRPCError builds a JSON-RPC error response for the request with the
+// given ID.
+func jsonRPCError(id interface{}, code int, message string) json.RawMessage {
+	data, _ := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      id,
+		"error":   &RPCError{Code: code, Message: message},
+	})
+	return data
+}
+
+// DefaultErrorCodeToStatus maps the standard JSON-RPC error codes to HTTP
+// statuses, for use as Config.ErrorCodeToStatus.
+var DefaultErrorCodeToStatus = map[int]int{
+	-32700: http.StatusBadRequest,          // parse error
+	-32600: http.StatusBadRequest,          // invalid request
+	-32601: http.StatusNotFound,            // method not found
+	-32602: http.StatusBadRequest,          // invalid params
+	-32603: http.StatusInternalServerError, // internal error
+}
+
+// rpcErrorCode returns the code of the JSON-RPC error in response, and
+// whether it is an error response.
+func rpcErrorCode(response json.RawMessage) (int, bool) {
+	if !bytes.Contains(response, []byte(`"error"`)) {
+		return 0, false
+	}
+	var msg struct {
+		Error *RPCError `json:"error"`
+	}
+	if json.Unmarshal(response, &msg) != nil || msg.Error == nil {
+		return 0, false
+	}
+	return msg.Error.Code, true
+}
+
+// rpcErrorCodeHeader carries the code of JSON-RPC error responses.
+const rpcErrorCodeHeader = "X-JSONRPC-Error-Code"
+
+// countRPCError sets the rpcErrorCodeHeader of a JSON-RPC error response with
+// code, and counts it.
+func (p *MCPProxy) countRPCError(w http.ResponseWriter, code int) {
+	w.Header().Set(rpcErrorCodeHeader, strconv.Itoa(code))
+	p.metrics.rpcErrors.Inc(strconv.Itoa(code))
+}
+
+// validateErrorStatuses checks that cfg.ErrorCodeToStatus maps to valid
+// HTTP statuses.
+func validateErrorStatuses(cfg Config) error {
+	for code, status := range cfg.ErrorCodeToStatus {
+		if status < 200 || status > 599 {
+			return fmt.Errorf("ErrorCodeToStatus maps %d to invalid HTTP status %d", code, status)
+		}
+	}
+	return nil
+}
+
+// applyErrorMiddleware passes the error member of response, if any, through
+// mw and returns the response with the error replaced. Responses without an
+// error, or for which mw returns nil, are returned unchanged.
+func applyErrorMiddleware(response json.RawMessage, method string, mw func(string, *RPCError) *RPCError) json.RawMessage {
+	if !bytes.Contains(response, []byte(`"error"`)) {
+		return response
+	}
+
+	var msg map[string]json.RawMessage
+	if json.Unmarshal(response, &msg) != nil || msg["error"] == nil {
+		return response
 	}
+	var rpcErr RPCError
+	if json.Unmarshal(msg["error"], &rpcErr) != nil {
+		return response
+	}
+
+	mapped := mw(method, &rpcErr)
+	if mapped == nil {
+		return response
+	}
+	errData, err := json.Marshal(mapped)
+	if err != nil {
+		return response
+	}
+	msg["error"] = errData
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return response
+	}
+	return data
 }
 
 // formatID converts an interface{} ID to a comparable string.
@@ -227,11 +1487,12 @@ func formatID(id interface{}) string {
 
 // Handle is the HTTP handler for MCP requests.
 func (p *MCPProxy) Handle(w http.ResponseWriter, r *http.Request) {
+	// Settings are read once so a concurrent Reload cannot mix old and new
+	dc := p.dynamic.Load()
+
 	// Handle CORS if enabled
-	if p.config.EnableCORS {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	if dc.EnableCORS {
+		setCORSHeaders(w)
 
 		if r.Method == "OPTIONS" {
 			w.WriteHeader(http.StatusOK)
@@ -239,77 +1500,396 @@ func (p *MCPProxy) Handle(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	log.Printf("[%s] HTTP request from %s %s", p.config.ServerName, r.RemoteAddr, r.URL.Path)
+	p.log.Debug("HTTP request", "remote", r.RemoteAddr, "path", r.URL.Path, "identity", identity(r))
+
+	if !p.checkProtocolVersion(w, r) {
+		return
+	}
+
+	if r.Method == http.MethodDelete && p.config.EnableNotificationStream {
+		p.endSession(w, r)
+		return
+	}
+
+	// A GET without a body can only be meant to open the stream
+	if r.Method == http.MethodGet && p.config.EnableNotificationStream && (wantsEventStream(r) || r.ContentLength == 0) {
+		p.handleNotificationStream(w, r)
+		return
+	}
+
+	var body io.Reader = r.Body
+	if dc.MaxRequestBytes > 0 {
+		body = http.MaxBytesReader(w, r.Body, dc.MaxRequestBytes)
+	}
+
+	// Large bodies are streamed to the MCP server when their id can be found
+	// at the start of the body; otherwise they fall back to buffering.
+	if p.canStream(dc) && (r.ContentLength < 0 || r.ContentLength > dc.StreamThreshold) {
+		prefix, err := peekBody(body)
+		if err != nil {
+			p.rejectBody(w, err)
+			return
+		}
+		rest := io.MultiReader(bytes.NewReader(prefix), body)
+		if len(prefix) == streamPeekSize {
+			if env, ok := scanEnvelope(prefix); ok {
+				p.handleStream(w, r, dc, env, rest)
+				return
+			}
+			p.log.Info("Request id not found at the start of the body, buffering it", "peekBytes", streamPeekSize)
+		}
+		body = rest
+	}
 
 	// Read HTTP JSON body
 	var msg json.RawMessage
-	if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
-		log.Printf("[%s] Failed to decode HTTP body: %v", p.config.ServerName, err)
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if err := json.NewDecoder(body).Decode(&msg); err != nil {
+		p.rejectBody(w, err)
 		return
 	}
+	if isStringBody(msg) {
+		var ok bool
+		if msg, ok = p.unwrapStringBody(w, r, dc, msg); !ok {
+			return
+		}
+	}
+	if isBatch(msg) {
+		p.handleBatch(w, r, dc, msg)
+		return
+	}
+	p.handleMessage(w, r, dc, msg)
+}
 
-	log.Printf("[%s] Received HTTP request: %s", p.config.ServerName, string(msg))
-
+// handleMessage answers a single JSON-RPC message.
+func (p *MCPProxy) handleMessage(w http.ResponseWriter, r *http.Request, dc *dynamicConfig, msg json.RawMessage) {
 	// Check if this is a request (has ID) or notification (no ID)
 	var mcpMsg MCPMessage
 	json.Unmarshal(msg, &mcpMsg)
-	isRequest := mcpMsg.ID != nil
+	r = p.withTraceID(r, msg)
+	r = p.withMethodLogLevel(r, mcpMsg.Method)
+	r = p.withSession(r, mcpMsg.Method, msg)
+	if len(p.config.ResourceURIRewrite) > 0 {
+		msg = restoreResourceURI(msg, mcpMsg.Method, p.config.ResourceURIRewrite)
+	}
+	if len(p.config.MetaHeaders) > 0 {
+		msg = copyMetaHeaders(msg, r.Header, p.config.MetaHeaders)
+	}
+	if p.config.EnvironmentLabel != "" {
+		msg = setEnvironment(msg, p.config.EnvironmentLabel)
+	}
+
+	p.logBody(p.logFor(r), "Received HTTP request", msg)
+
+	w, finish := p.observe(w, func() RequestInfo { return requestInfo(r, msg, mcpMsg) })
+	defer finish()
+	p.metrics.requests.Inc(mcpMsg.Method)
+	p.metrics.countIdentity(identity(r))
+
+	if !p.checkParams(w, r, msg, mcpMsg) {
+		return
+	}
+	if p.filter(w, r, msg, mcpMsg) {
+		return
+	}
+	if p.serveStatic(w, r, dc, msg, mcpMsg) {
+		return
+	}
+	if p.shareSubscription(w, r, msg, mcpMsg) {
+		return
+	}
+	r, answered := p.memoized(w, r, dc, msg, mcpMsg)
+	if answered {
+		return
+	}
+
+	// Identical idempotent requests already in flight share one call
+	if dc.coalesces(mcpMsg.ID, msg) {
+		p.forwardCoalesced(w, r, dc, msg, mcpMsg.ID)
+		return
+	}
 
 	// Send request to MCP server
-	req := &request{
+	p.forward(w, r, &request{
 		msg:       msg,
-		isRequest: isRequest,
+		method:    mcpMsg.Method,
+		isRequest: mcpMsg.HasID,
 		response:  make(chan json.RawMessage, 1),
+		unwrap:    dc.UnwrapSingleContent && wantsRawContent(r),
+	})
+}
+
+// handleStream forwards a request whose body is streamed to the MCP server.
+func (p *MCPProxy) handleStream(w http.ResponseWriter, r *http.Request, dc *dynamicConfig, env envelope, body io.Reader) {
+	r = p.withMethodLogLevel(r, env.Method)
+	p.logFor(r).Debug("Streaming HTTP request", "id", env.ID, "method", env.Method)
+	w, finish := p.observe(w, func() RequestInfo {
+		return RequestInfo{Method: env.Method, ID: formatID(env.ID), Identity: identity(r), Size: r.ContentLength, Streamed: true}
+	})
+	defer finish()
+	p.metrics.requests.Inc(env.Method)
+	p.metrics.countIdentity(identity(r))
+
+	p.forward(w, r, &request{
+		body:      newJSONValidator(body),
+		id:        env.ID,
+		method:    env.Method,
+		isRequest: env.HasID,
+		response:  make(chan json.RawMessage, 1),
+		unwrap:    dc.UnwrapSingleContent && wantsRawContent(r),
+	})
+}
+
+// prepare sets up req, sent on behalf of the client request r, for the
+// queue: its logger, priority lane, deadline and queue timeout, and lists
+// it at /debug/inflight. done must be called once req is finished with.
+func (p *MCPProxy) prepare(r *http.Request, req *request) (done func()) {
+	req.log = p.logFor(r)
+	req.lane = p.priority(r)
+	req.deadline, _ = r.Context().Deadline()
+	untrack := p.inflight.track(r, req)
+	if timeout := p.dynamic.Load().QueueTimeout; timeout > 0 && req.isRequest && req.body == nil {
+		req.queueTimeout = timeout
+		req.queueExpired = make(chan struct{})
+		timer := time.AfterFunc(timeout, func() { close(req.queueExpired) })
+		return func() {
+			timer.Stop()
+			untrack()
+		}
 	}
-	p.requests <- req
+	return untrack
+}
 
-	// Wait for response (only if it's a request)
-	if isRequest {
-		response, ok := <-req.response
-		if !ok {
-			log.Printf("[%s] Failed to get response from MCP server", p.config.ServerName)
-			http.Error(w, "Failed to get response", http.StatusInternalServerError)
+// forward queues req for the MCP server and writes the outcome to w.
+func (p *MCPProxy) forward(w http.ResponseWriter, r *http.Request, req *request) {
+	req.gone = r.Context().Done()
+	defer p.prepare(r, req)()
+	if err := p.admitRequest(req.method); err != nil {
+		p.failRequest(w, r, req.requestID(), err)
+		return
+	}
+	if err := p.enqueue(req); err != nil {
+		if errors.Is(err, context.Canceled) {
+			p.logFor(r).Info("Client went away before the request was queued", "method", req.method)
 			return
 		}
+		if errors.Is(err, ErrQueueFull) {
+			p.expireInQueue(req)
+		}
+		p.failRequest(w, r, req.requestID(), err)
+		return
+	}
 
-		log.Printf("[%s] Sending HTTP response: %s", p.config.ServerName, string(response))
+	// Wait for response (only if it's a request)
+	if req.isRequest {
+		// Stop waiting if the client goes away. Streamed requests must be
+		// waited for regardless, since the body is still being read.
+		var cancelled <-chan struct{}
+		if req.body == nil {
+			cancelled = r.Context().Done()
+		}
 
-		w.Header().Set("Content-Type", "application/json")
-		w.Write(response)
+		queueExpired := req.queueExpired
+		for {
+			select {
+			case response, ok := <-req.response:
+				p.recordQueueWait(r, req)
+				w.Header().Set("Server-Timing", serverTiming(req, time.Now()))
+				if p.config.EnableNotificationStream {
+					setSequenceHeader(w, req.seq)
+				}
+				if !ok {
+					p.failRequest(w, r, req.requestID(), req.err)
+					return
+				}
+				p.writeResponse(w, r, req.method, p.summarizeResult(r.Context(), req, response), req.unwrap)
+				p.buffered.release(len(response))
+			case <-cancelled:
+				p.logFor(r).Info("Client went away before the response", "error", r.Context().Err())
+				req.abandoned.Store(true)
+				go p.discardResponse(req)
+			case <-queueExpired:
+				if p.expireInQueue(req) {
+					p.failRequest(w, r, req.requestID(), &TimeoutError{Stage: "queue", Timeout: req.queueTimeout})
+					return
+				}
+				// It was sent to the MCP server just in time
+				queueExpired = nil
+				continue
+			}
+			return
+		}
 	} else {
 		// For notifications, wait for processing to complete and return 202 Accepted
 		<-req.response
-		log.Printf("[%s] Notification processed", p.config.ServerName)
+		if req.err != nil {
+			p.failRequest(w, r, nil, req.err)
+			return
+		}
+		p.logFor(r).Debug("Notification processed")
 		w.WriteHeader(http.StatusAccepted)
 	}
 }
 
+// writeResponse sends a response from the MCP server to the client, as raw
+// content if unwrap is set and the response allows it.
+func (p *MCPProxy) writeResponse(w http.ResponseWriter, r *http.Request, method string, response json.RawMessage, unwrap bool) {
+	setNegotiatedVersion(w, method, response)
+	p.setSession(w, r, method, response)
+	p.subscribed(r, response)
+	p.memoize(r, response)
+	if p.setCacheHeaders(w, r, method, response) {
+		return
+	}
+
+	if unwrap {
+		if content, contentType, ok := unwrapSingleContent(response); ok {
+			p.logFor(r).Debug("Sending unwrapped content", "contentType", contentType, "bytes", len(content))
+			setRawContentHeaders(w, contentType)
+			w.Write(content)
+			return
+		}
+		p.logFor(r).Debug("Response is not a single content block, sending JSON")
+	}
+
+	p.logBody(p.logFor(r), "Sending HTTP response", response)
+
+	markRPCError(w, response)
+	w.Header().Set("Content-Type", "application/json")
+	if code, ok := rpcErrorCode(response); ok {
+		p.countRPCError(w, code)
+		if status, ok := p.config.ErrorCodeToStatus[code]; ok {
+			w.WriteHeader(status)
+		}
+	}
+	w.Write(response)
+}
+
+// failRequest answers a request that did not get a response with a
+// JSON-RPC error for id, whose code and HTTP status are those ErrorClasses
+// gives err. Errors of no class are not detailed to the client.
+func (p *MCPProxy) failRequest(w http.ResponseWriter, r *http.Request, id interface{}, err error) {
+	if isBodyError(err) {
+		p.rejectBody(w, err)
+		return
+	}
+	class := ClassifyError(err)
+	message := "Failed to get response from MCP server"
+	switch class.Err {
+	case nil:
+		p.logFor(r).Error(message, "error", err)
+	case ErrDispatcherStopped:
+		p.logFor(r).Error("Rejecting request, the request dispatcher stopped")
+		message = err.Error()
+	default:
+		p.logFor(r).Warn("Rejecting request", "error", err, "code", class.Code)
+		message = err.Error()
+	}
+	p.countRPCError(w, class.Code)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(class.Status)
+	response, _ := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      id,
+		"error":   &RPCError{Code: class.Code, Message: message, Data: errorData(err)},
+	})
+	w.Write(response)
+}
+
+// isBodyError reports whether err is about the request body rather than the
+// MCP server: the body is too large or not valid JSON.
+func isBodyError(err error) bool {
+	return errors.As(err, new(*http.MaxBytesError)) || errors.As(err, new(*json.SyntaxError)) ||
+		errors.As(err, new(*jsonSyntaxError))
+}
+
+// rejectBody reports a failure to read the HTTP request body. An empty body,
+// a common client mistake, is answered with a JSON-RPC parse error saying
+// so rather than the decoder's EOF, and so is a body that is not JSON,
+// whether it was buffered or streamed.
+func (p *MCPProxy) rejectBody(w http.ResponseWriter, err error) {
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &maxErr) {
+		p.log.Warn("Request body too large", "limit", maxErr.Limit)
+		http.Error(w, fmt.Sprintf("Request body exceeds %d bytes", maxErr.Limit), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if errors.Is(err, io.EOF) {
+		p.log.Warn("Rejecting request with an empty body")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(jsonRPCError(nil, -32700, "Parse error: the request body is empty, expected a JSON-RPC message"))
+		return
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) || isBodyError(err) {
+		p.log.Warn("Rejecting request that is not valid JSON", "error", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(jsonRPCError(nil, -32700, "Parse error: "+err.Error()))
+		return
+	}
+	p.log.Warn("Failed to decode HTTP body", "error", err)
+	http.Error(w, err.Error(), http.StatusBadRequest)
+}
+
 // Run starts the MCP proxy server with the given configuration.
 // This is a convenience function that creates the proxy and starts the HTTP server.
 func Run(cfg Config) error {
-	if cfg.Port == "" {
-		cfg.Port = "8080"
-	}
+	logger := newLogger(cfg)
+	logger.Info("MCP Streamable HTTP Proxy starting", "version", VersionString())
 
-	log.Printf("[%s] MCP Streamable HTTP Proxy starting...", cfg.ServerName)
+	// The proxy listens while it waits for the services the MCP server
+	// needs, so that /readyz tells what it is waiting for. Invalid
+	// settings are reported by NewMCPProxy.
+	var handler switchHandler
+	var served chan error
+	var ln net.Listener
+	if resolved, err := resolveConfig(cfg); err == nil && len(resolved.WaitFor) > 0 {
+		if ln, err = net.Listen("tcp", ":"+resolved.Port); err != nil {
+			return err
+		}
+		deps := newDependencies(resolved.WaitFor)
+		handler.set(deps)
+		served = make(chan error, 1)
+		go func() { served <- http.Serve(ln, &handler) }()
+		logger.Info("Waiting for dependencies", "targets", resolved.WaitFor, "timeout", resolved.WaitForTimeout)
+		if err := deps.wait(resolved.WaitForTimeout, logger); err != nil {
+			ln.Close()
+			return err
+		}
+	}
 
 	proxy, err := NewMCPProxy(cfg)
 	if err != nil {
+		if ln != nil {
+			ln.Close()
+		}
 		return fmt.Errorf("failed to create proxy: %w", err)
 	}
+	defer proxy.Close()
+	cfg = proxy.config
 
-	// Register extra routes first (so they take precedence over the catch-all)
-	for path, handler := range cfg.ExtraRoutes {
-		log.Printf("[%s] Registering extra route: %s", cfg.ServerName, path)
-		http.HandleFunc(path, handler)
+	if cfg.ConfigFile != "" {
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		// Closing hup once no more signals are sent on it ends the
+		// goroutine reloading the configuration.
+		defer func() {
+			signal.Stop(hup)
+			close(hup)
+		}()
+		go func() {
+			for range hup {
+				proxy.Reload()
+			}
+		}()
 	}
 
-	// Register the main handler
-	http.HandleFunc("/", proxy.Handle)
+	handler.set(proxy.Handler())
 
-	log.Printf("[%s] Listening on port %s", cfg.ServerName, cfg.Port)
-	log.Printf("[%s] HTTP endpoint: http://localhost:%s/", cfg.ServerName, cfg.Port)
+	proxy.log.Info("Listening", "port", cfg.Port, "endpoint", "http://localhost:"+cfg.Port+"/")
 
-	return http.ListenAndServe(":"+cfg.Port, nil)
+	if served != nil {
+		return <-served
+	}
+	return http.ListenAndServe(":"+cfg.Port, &handler)
 }
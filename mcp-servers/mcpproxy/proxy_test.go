@@ -3,11 +3,14 @@ package mcpproxy
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strconv"
 	"strings"
+	"syscall"
 	"testing"
 )
 
@@ -53,6 +56,12 @@ func TestMCPMessageParsing(t *testing.T) {
 			expectID: true,
 			idValue:  "abc",
 		},
+		{
+			name:     "request with null id",
+			json:     `{"jsonrpc":"2.0","id":null,"method":"initialize"}`,
+			expectID: true,
+			idValue:  nil,
+		},
 		{
 			name:     "notification without id",
 			json:     `{"jsonrpc":"2.0","method":"notifications/initialized"}`,
@@ -69,12 +78,11 @@ func TestMCPMessageParsing(t *testing.T) {
 				t.Fatalf("Failed to unmarshal: %v", err)
 			}
 
-			hasID := msg.ID != nil
-			if hasID != tt.expectID {
-				t.Errorf("Expected hasID=%v, got %v", tt.expectID, hasID)
+			if msg.HasID != tt.expectID {
+				t.Errorf("Expected hasID=%v, got %v", tt.expectID, msg.HasID)
 			}
 
-			if tt.expectID && msg.ID != tt.idValue {
+			if msg.ID != tt.idValue {
 				t.Errorf("Expected ID=%v, got %v", tt.idValue, msg.ID)
 			}
 		})
@@ -307,6 +315,31 @@ func TestHandleInvalidJSON(t *testing.T) {
 	}
 }
 
+func TestHandleEmptyBody(t *testing.T) {
+	proxy := newFakeProxy(t, "ack", Config{})
+
+	for _, body := range []string{"", "  \n"} {
+		req := httptest.NewRequest("POST", "/", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		proxy.Handle(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for body %q, got %d", body, w.Code)
+		}
+		var resp struct {
+			ID    interface{} `json:"id"`
+			Error *RPCError   `json:"error"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Error == nil || resp.Error.Code != -32700 || resp.ID != nil {
+			t.Fatalf("Expected a JSON-RPC parse error for body %q, got %s", body, w.Body.String())
+		}
+		if !strings.Contains(resp.Error.Message, "body is empty") {
+			t.Errorf("Expected the error to say the body is empty, got %q", resp.Error.Message)
+		}
+	}
+}
+
 func TestRequestMiddlewareIDChange(t *testing.T) {
 	// This tests that if RequestMiddleware modifies the request ID,
 	// readResponse uses the modified ID for matching, not the original
@@ -436,9 +469,9 @@ func TestIsRequestDetection(t *testing.T) {
 			isRequest: false,
 		},
 		{
-			name:      "notification with null id",
+			name:      "request with null id",
 			json:      `{"jsonrpc":"2.0","id":null,"method":"test"}`,
-			isRequest: false,
+			isRequest: true,
 		},
 	}
 
@@ -446,7 +479,7 @@ func TestIsRequestDetection(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			var msg MCPMessage
 			json.Unmarshal([]byte(tt.json), &msg)
-			isRequest := msg.ID != nil
+			isRequest := msg.HasID
 
 			if isRequest != tt.isRequest {
 				t.Errorf("Expected isRequest=%v, got %v", tt.isRequest, isRequest)
@@ -454,3 +487,208 @@ func TestIsRequestDetection(t *testing.T) {
 		})
 	}
 }
+
+func TestNullID(t *testing.T) {
+	logs := &recordingLogger{}
+	proxy := newFakeProxy(t, "reflect", Config{Logger: logs})
+	tests := []struct {
+		name     string
+		clientID string // the id member sent by the client, if any
+		serverID string // the id the MCP server answers with, if not the client's
+		status   int
+		want     string
+	}{
+		{"notification", ``, ``, http.StatusAccepted, ``},
+		{"null id", `"id":null,`, ``, http.StatusOK, `{"id":null,"jsonrpc":"2.0","result":{"n":2}}`},
+		{"id", `"id":3,`, ``, http.StatusOK, `{"id":3,"jsonrpc":"2.0","result":{"n":3}}`},
+		{"null id answered with null", `"id":null,`, `null`, http.StatusOK, `{"id":null,"jsonrpc":"2.0","result":{"n":4}}`},
+		{"id answered with null", `"id":5,`, `null`, http.StatusOK, `{"id":5,"jsonrpc":"2.0","result":{"n":5}}`},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := fmt.Sprintf(`{"result":{"n":%d}}`, i+1)
+			if tt.serverID != "" {
+				params = fmt.Sprintf(`{"id":%s,"result":{"n":%d}}`, tt.serverID, i+1)
+			}
+			w := postJSON(proxy, fmt.Sprintf(`{"jsonrpc":"2.0",%s"method":"tools/call","params":%s}`, tt.clientID, params))
+			if w.Code != tt.status || strings.TrimSpace(w.Body.String()) != tt.want {
+				t.Errorf("Expected %d %s, got %d %s", tt.status, tt.want, w.Code, w.Body.String())
+			}
+		})
+	}
+	waitForLog(t, logs, "MCP server answered with a null id, taking it for the response to the waiting request server=test expected=5")
+
+	// A request with a null id is answered within a batch too
+	w := postJSON(proxy, `[{"jsonrpc":"2.0","id":null,"method":"ping"},{"jsonrpc":"2.0","method":"notifications/x"}]`)
+	if got := strings.TrimSpace(w.Body.String()); got != `[{"id":null,"jsonrpc":"2.0","result":{}}]` {
+		t.Errorf("Expected the response to the null id, got %s", got)
+	}
+}
+
+func TestCloseStopsChild(t *testing.T) {
+	checkGoroutines(t)
+	proxy, err := NewMCPProxy(Config{
+		ServerName:  "test",
+		CommandPath: "cat",
+	})
+	if err != nil {
+		t.Fatalf("NewMCPProxy failed: %v", err)
+	}
+	pid := proxy.backend.cmd.Process.Pid
+
+	if err := proxy.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	if proxy.backend.cmd.ProcessState == nil {
+		t.Fatal("Expected child to be reaped after Close")
+	}
+	if err := syscall.Kill(pid, 0); err == nil {
+		t.Errorf("Expected child %d to be gone after Close", pid)
+	}
+
+	// Close is idempotent, even when called concurrently
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() { errs <- proxy.Close() }()
+	}
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			t.Errorf("Second Close failed: %v", err)
+		}
+	}
+}
+
+func TestHandleAfterClose(t *testing.T) {
+	proxy, err := NewMCPProxy(Config{
+		ServerName:  "test",
+		CommandPath: "cat",
+	})
+	if err != nil {
+		t.Fatalf("NewMCPProxy failed: %v", err)
+	}
+	proxy.Close()
+
+	req := httptest.NewRequest("POST", "/", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"test"}`))
+	w := httptest.NewRecorder()
+	proxy.Handle(w, req)
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503 after Close, got %d", w.Code)
+	}
+}
+
+func TestErrorMiddleware(t *testing.T) {
+	var gotMethod string
+	proxy := newFakeProxy(t, "reflect", Config{
+		ErrorMiddleware: func(method string, rpcErr *RPCError) *RPCError {
+			gotMethod = method
+			if rpcErr.Code != -32000 {
+				return nil
+			}
+			return &RPCError{Code: -32001, Message: "friendly: " + rpcErr.Message, Data: json.RawMessage(`{"hint":"retry"}`)}
+		},
+	})
+
+	w := postJSON(proxy, `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"error":{"code":-32000,"message":"cryptic"}}}`)
+	var resp struct {
+		ID    int      `json:"id"`
+		Error RPCError `json:"error"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to parse response %q: %v", w.Body.String(), err)
+	}
+	if gotMethod != "tools/call" {
+		t.Errorf("Expected middleware to see method tools/call, got %q", gotMethod)
+	}
+	if resp.ID != 1 || resp.Error.Code != -32001 || resp.Error.Message != "friendly: cryptic" || string(resp.Error.Data) != `{"hint":"retry"}` {
+		t.Errorf("Unexpected mapped response: %s", w.Body.String())
+	}
+
+	// Returning nil keeps the original error
+	w = postJSON(proxy, `{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"error":{"code":-32601,"message":"unknown"}}}`)
+	if !strings.Contains(w.Body.String(), `"message":"unknown"`) {
+		t.Errorf("Expected original error, got %s", w.Body.String())
+	}
+
+	// Successful responses are not touched
+	gotMethod = ""
+	postJSON(proxy, `{"jsonrpc":"2.0","id":3,"method":"ping","params":{"result":{"error":"not an rpc error"}}}`)
+	if gotMethod != "" {
+		t.Errorf("Expected middleware not to run for results, ran for %q", gotMethod)
+	}
+}
+
+func TestErrorCodeToStatus(t *testing.T) {
+	codes := map[int]int{-32000: http.StatusServiceUnavailable}
+	for code, status := range DefaultErrorCodeToStatus {
+		codes[code] = status
+	}
+	proxy := newFakeProxy(t, "reflect", Config{ErrorCodeToStatus: codes})
+
+	tests := []struct {
+		params string
+		status int
+	}{
+		{`{"error":{"code":-32601,"message":"unknown"}}`, http.StatusNotFound},
+		{`{"error":{"code":-32602,"message":"bad params"}}`, http.StatusBadRequest},
+		{`{"error":{"code":-32603,"message":"internal"}}`, http.StatusInternalServerError},
+		{`{"error":{"code":-32000,"message":"busy"}}`, http.StatusServiceUnavailable},
+		{`{"error":{"code":-32099,"message":"unmapped"}}`, http.StatusOK},
+		{`{"result":{"error":"not an rpc error"}}`, http.StatusOK},
+	}
+	for i, tt := range tests {
+		w := postJSON(proxy, fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":"tools/call","params":%s}`, i, tt.params))
+		if w.Code != tt.status {
+			t.Errorf("%s: expected status %d, got %d", tt.params, tt.status, w.Code)
+		}
+		if !strings.Contains(w.Body.String(), `"jsonrpc"`) {
+			t.Errorf("%s: expected the JSON-RPC response as the body, got %s", tt.params, w.Body.String())
+		}
+	}
+
+	// Without a mapping, errors are sent with 200
+	proxy = newFakeProxy(t, "reflect", Config{})
+	if w := postJSON(proxy, `{"jsonrpc":"2.0","id":1,"method":"x","params":{"error":{"code":-32601,"message":"unknown"}}}`); w.Code != http.StatusOK {
+		t.Errorf("Expected 200 without a mapping, got %d", w.Code)
+	}
+
+	cfg := fakeConfig("reflect")
+	cfg.ErrorCodeToStatus = map[int]int{-32601: 42}
+	if _, err := NewMCPProxy(cfg); err == nil {
+		t.Error("Expected an invalid status to be rejected")
+	}
+}
+
+func TestMapJSONRPCErrorsToHTTP(t *testing.T) {
+	proxy := newFakeProxy(t, "reflect", Config{MapJSONRPCErrorsToHTTP: true})
+	for i, tt := range []struct {
+		code   int
+		status int
+	}{
+		{-32600, http.StatusBadRequest},
+		{-32601, http.StatusNotFound},
+		{-32603, http.StatusBadGateway},
+		{-32099, http.StatusOK},
+	} {
+		w := postJSON(proxy, fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":"x","params":{"error":{"code":%d,"message":"m"}}}`, i, tt.code))
+		if w.Code != tt.status || w.Header().Get(rpcErrorCodeHeader) != strconv.Itoa(tt.code) {
+			t.Errorf("Expected %d with code %d, got %d %v", tt.status, tt.code, w.Code, w.Header())
+		}
+	}
+
+	// Error codes are reported and counted without a mapping too
+	proxy = newFakeProxy(t, "reflect", Config{})
+	w := postJSON(proxy, `{"jsonrpc":"2.0","id":1,"method":"x","params":{"error":{"code":-32601,"message":"unknown"}}}`)
+	if w.Code != http.StatusOK || w.Header().Get(rpcErrorCodeHeader) != "-32601" {
+		t.Errorf("Expected 200 with code -32601, got %d %v", w.Code, w.Header())
+	}
+	if w := postJSON(proxy, `{"jsonrpc":"2.0","id":2,"method":"x"}`); w.Header().Get(rpcErrorCodeHeader) != "" {
+		t.Errorf("Expected no error code on a result, got %v", w.Header())
+	}
+	w = httptest.NewRecorder()
+	proxy.metrics.handle(w, httptest.NewRequest("GET", "/metrics", nil))
+	if !strings.Contains(w.Body.String(), `mcp_proxy_rpc_errors_total{server="test",code="-32601"} 1`) {
+		t.Errorf("Expected the error to be counted, got:\n%s", w.Body.String())
+	}
+}
@@ -0,0 +1,104 @@
+package mcpproxy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// errRequestExpiredCode is the JSON-RPC error code of requests shed for
+// Config.MaxQueueAge.
+const errRequestExpiredCode = -32000
+
+// dequeue claims req for sending it to the MCP server and records how long
+// it waited. It reports false if req already timed out in the queue, in
+// which case its client has been answered and it is skipped.
+func (p *MCPProxy) dequeue(req *request) bool {
+	if !req.claimed.CompareAndSwap(false, true) {
+		req.finish()
+		return false
+	}
+	p.metrics.queueWait.Add(req.started.Sub(req.enqueued).Seconds(), req.method)
+	p.metrics.dequeued.Inc(req.method)
+	return true
+}
+
+// expireInQueue claims req for failing it once QueueTimeout has passed. It
+// reports false if processRequests got to it first.
+func (p *MCPProxy) expireInQueue(req *request) bool {
+	if !req.claimed.CompareAndSwap(false, true) {
+		return false
+	}
+	req.log.Warn("Request timed out in queue", "method", req.method, "timeout", req.queueTimeout)
+	p.metrics.shed.Inc(req.method, "queue_timeout")
+	return true
+}
+
+// shed skips req instead of sending it to the MCP server if nobody is
+// waiting for its response any more: its client went away, or it spent
+// longer than MaxQueueAge in the queue. It reports whether req was skipped,
+// in which case its response channel has been closed.
+func (p *MCPProxy) shed(req *request) bool {
+	if req.abandoned.Load() {
+		req.log.Info("Skipping request, its client went away", "method", req.method)
+		p.metrics.shed.Inc(req.method, "abandoned")
+		req.finish()
+		return true
+	}
+
+	wait := req.started.Sub(req.enqueued)
+	if p.config.MaxQueueAge <= 0 || wait <= p.config.MaxQueueAge {
+		return false
+	}
+	req.log.Warn("Request expired in queue", "method", req.method, "wait", wait)
+	p.metrics.shed.Inc(req.method, "expired")
+
+	response := jsonRPCError(req.requestID(), errRequestExpiredCode,
+		fmt.Sprintf("request expired in queue after %v", wait.Round(time.Millisecond)))
+	p.buffered.acquire(len(response), p.stopping)
+	req.response <- response
+	req.finish()
+	return true
+}
+
+// serverTiming returns a Server-Timing header value with the time req spent
+// in the queue and with the MCP server, up to finished.
+func serverTiming(req *request, finished time.Time) string {
+	return fmt.Sprintf("queue;dur=%.3f, backend;dur=%.3f",
+		milliseconds(req.started.Sub(req.enqueued)), milliseconds(finished.Sub(req.started)))
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+type timingKey struct{}
+
+// requestTiming collects durations of a request for the access log written
+// by Handler.
+type requestTiming struct {
+	queueWait time.Duration
+	priority  string
+}
+
+// withTiming returns r with an empty requestTiming.
+func withTiming(r *http.Request) (*http.Request, *requestTiming) {
+	timing := &requestTiming{}
+	return r.WithContext(context.WithValue(r.Context(), timingKey{}, timing)), timing
+}
+
+// recordQueueWait notes for the access log how long req waited in the
+// queue, and in which priority lane, if r was served by Handler.
+func (p *MCPProxy) recordQueueWait(r *http.Request, req *request) {
+	timing, ok := r.Context().Value(timingKey{}).(*requestTiming)
+	if !ok {
+		return
+	}
+	if !req.started.IsZero() {
+		timing.queueWait = req.started.Sub(req.enqueued)
+	}
+	if p.lanes != nil {
+		timing.priority = laneNames[req.lane]
+	}
+}
@@ -0,0 +1,192 @@
+package mcpproxy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMaxQueueAge(t *testing.T) {
+	proxy := newFakeProxy(t, "slow", Config{MaxQueueAge: 100 * time.Millisecond, EnableMetrics: true})
+
+	var wg sync.WaitGroup
+	var slow, stale *httptest.ResponseRecorder
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		slow = postJSON(proxy, `{"jsonrpc":"2.0","id":1,"method":"x","params":{"delayMs":300}}`)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	go func() {
+		defer wg.Done()
+		stale = postJSON(proxy, `{"jsonrpc":"2.0","id":2,"method":"x"}`)
+	}()
+	wg.Wait()
+
+	if !strings.Contains(slow.Body.String(), `"calls":1`) {
+		t.Errorf("Expected the first request to complete, got %s", slow.Body.String())
+	}
+	if body := stale.Body.String(); !strings.Contains(body, `"id":2`) || !strings.Contains(body, `"code":-32000`) || !strings.Contains(body, "request expired in queue") {
+		t.Errorf("Expected the queued request to expire, got %s", body)
+	}
+
+	// The expired request never reached the MCP server, and fresh ones
+	// still do
+	w := postJSON(proxy, `{"jsonrpc":"2.0","id":3,"method":"x"}`)
+	if !strings.Contains(w.Body.String(), `"calls":2`) {
+		t.Errorf("Expected the MCP server to have seen two requests, got %s", w.Body.String())
+	}
+	if timing := w.Header().Get("Server-Timing"); !strings.Contains(timing, "queue;dur=") || !strings.Contains(timing, "backend;dur=") {
+		t.Errorf("Expected queue wait in Server-Timing, got %q", timing)
+	}
+	w = httptest.NewRecorder()
+	proxy.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if !strings.Contains(w.Body.String(), `mcp_proxy_requests_shed_total{server="test",method="x",reason="expired"} 1`) {
+		t.Errorf("Expected the expired request to be counted, got:\n%s", w.Body.String())
+	}
+}
+
+func TestAbandonedRequestsAreSkipped(t *testing.T) {
+	proxy := newFakeProxy(t, "slow", Config{})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		postJSON(proxy, `{"jsonrpc":"2.0","id":1,"method":"x","params":{"delayMs":300}}`)
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r := httptest.NewRequest("POST", "/", strings.NewReader(`{"jsonrpc":"2.0","id":2,"method":"x"}`)).WithContext(ctx)
+	r.Header.Set("Content-Type", "application/json")
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+	}()
+	proxy.Handler().ServeHTTP(httptest.NewRecorder(), r)
+	<-done
+
+	w := postJSON(proxy, `{"jsonrpc":"2.0","id":3,"method":"x"}`)
+	if !strings.Contains(w.Body.String(), `"calls":2`) {
+		t.Errorf("Expected the abandoned request to be skipped, got %s", w.Body.String())
+	}
+}
+
+func TestQueueTimeout(t *testing.T) {
+	proxy := newFakeProxy(t, "hang", Config{QueueTimeout: 200 * time.Millisecond, EnableMetrics: true})
+
+	// The first request is sent to the MCP server, which never answers and
+	// stalls the queue behind it
+	go postJSON(proxy, `{"jsonrpc":"2.0","id":0,"method":"x"}`)
+	time.Sleep(50 * time.Millisecond)
+
+	// More requests than the queue holds, so some wait for room in it
+	const n = 120
+	start := time.Now()
+	var wg sync.WaitGroup
+	codes := make([]int, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			codes[i] = postJSON(proxy, fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":"x"}`, i+1)).Code
+		}(i)
+	}
+	wg.Wait()
+
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Expected queued requests to fail fast, took %v", elapsed)
+	}
+	for i, code := range codes {
+		if code != http.StatusServiceUnavailable {
+			t.Errorf("Expected request %d to fail with 503, got %d", i+1, code)
+		}
+	}
+	w := httptest.NewRecorder()
+	proxy.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	body := w.Body.String()
+	if !strings.Contains(body, fmt.Sprintf(`mcp_proxy_requests_shed_total{server="test",method="x",reason="queue_timeout"} %d`, n)) {
+		t.Errorf("Expected the timed out requests to be counted, got:\n%s", body)
+	}
+	if !strings.Contains(body, `mcp_proxy_requests_dequeued_total{server="test",method="x"} 1`) {
+		t.Errorf("Expected only the first request to be dequeued, got:\n%s", body)
+	}
+}
+
+func TestQueueTimeoutDoesNotLimitResponseTime(t *testing.T) {
+	proxy := newFakeProxy(t, "slow", Config{QueueTimeout: 100 * time.Millisecond})
+
+	w := postJSON(proxy, `{"jsonrpc":"2.0","id":1,"method":"x","params":{"delayMs":300}}`)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"calls":1`) {
+		t.Errorf("Expected the response, got %d %s", w.Code, w.Body.String())
+	}
+}
+
+// fillQueue sends more requests than the queue holds to proxy, whose MCP
+// server never answers, and returns once some wait for room in it. done
+// is closed when they have all returned.
+func fillQueue(t *testing.T, proxy *MCPProxy, ctx context.Context) (done chan struct{}) {
+	t.Helper()
+	const n = 103
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			r := httptest.NewRequest("POST", "/", strings.NewReader(fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":"x"}`, i)))
+			r.Header.Set("Content-Type", "application/json")
+			proxy.Handle(httptest.NewRecorder(), r.WithContext(ctx))
+		}(i)
+	}
+	done = make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for len(proxy.requests) < cap(proxy.requests) {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the queue to fill up, it holds %d", len(proxy.requests))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return done
+}
+
+func TestCloseWithFullQueue(t *testing.T) {
+	proxy := newFakeProxy(t, "hang", Config{})
+	done := fillQueue(t, proxy, context.Background())
+
+	closed := make(chan struct{})
+	go func() {
+		proxy.Close()
+		close(closed)
+	}()
+	for _, ch := range []chan struct{}{closed, done} {
+		select {
+		case <-ch:
+		case <-time.After(10 * time.Second):
+			t.Fatal("Expected Close and the waiting requests to return")
+		}
+	}
+}
+
+func TestClientGoneWhileQueueFull(t *testing.T) {
+	proxy := newFakeProxy(t, "hang", Config{})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := fillQueue(t, proxy, ctx)
+
+	// Requests waiting for room in the queue return as soon as their
+	// client goes away
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the requests of gone clients to return")
+	}
+}
@@ -0,0 +1,41 @@
+package mcpproxy
+
+import (
+	"os/exec"
+	"sync"
+)
+
+// children tracks the processes the proxy started itself, which are reaped
+// by their exec.Cmd. The PID 1 reaper leaves them alone so that cmd.Wait
+// still gets their exit status.
+var children = struct {
+	sync.Mutex
+	pids map[int]bool
+}{pids: make(map[int]bool)}
+
+// startChild starts cmd and records it as the proxy's own child until
+// childReaped is called. Holding the lock across Start keeps the reaper
+// from seeing the process exit before it is recorded.
+func startChild(cmd *exec.Cmd) error {
+	children.Lock()
+	defer children.Unlock()
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	children.pids[cmd.Process.Pid] = true
+	return nil
+}
+
+// childReaped forgets a child started with startChild once cmd.Wait has
+// returned.
+func childReaped(cmd *exec.Cmd) {
+	children.Lock()
+	delete(children.pids, cmd.Process.Pid)
+	children.Unlock()
+}
+
+// isOwnChild reports whether pid was started with startChild and is not
+// reaped yet. children must be locked.
+func isOwnChild(pid int) bool {
+	return children.pids[pid]
+}
@@ -0,0 +1,87 @@
+//go:build linux
+
+package mcpproxy
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// reapInterval is how often the PID 1 reaper looks for zombies even without
+// a SIGCHLD, since one signal may stand for several exits.
+const reapInterval = 5 * time.Second
+
+var reaperOnce sync.Once
+
+// startReaper reaps orphaned processes when the proxy runs as PID 1, as it
+// does in a container without an init process. Processes the MCP server
+// leaves behind, e.g. the children of a wrapper script or of a shell, are
+// reparented to PID 1 when their parent exits and stay zombies unless PID 1
+// waits for them. The proxy's own children are left to their exec.Cmd.
+func startReaper(logger Logger) {
+	if os.Getpid() != 1 {
+		return
+	}
+	reaperOnce.Do(func() {
+		logger.Info("Running as PID 1, reaping orphaned processes")
+		sigchld := make(chan os.Signal, 1)
+		signal.Notify(sigchld, syscall.SIGCHLD)
+		go func() {
+			ticker := time.NewTicker(reapInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-sigchld:
+				case <-ticker.C:
+				}
+				for _, pid := range reapOrphans() {
+					logger.Info("Reaped orphaned process", "pid", pid)
+				}
+			}
+		}()
+	})
+}
+
+// reapOrphans reaps exited children that were not started with startChild
+// and returns their pids. It stops at the first exited child of the proxy's
+// own, which is reaped by cmd.Wait shortly; the next call picks up from
+// there.
+func reapOrphans() []int {
+	children.Lock()
+	defer children.Unlock()
+
+	var reaped []int
+	for {
+		pid, err := peekExited()
+		if err != nil || pid == 0 || isOwnChild(pid) {
+			return reaped
+		}
+		var status syscall.WaitStatus
+		if _, err := syscall.Wait4(pid, &status, syscall.WNOHANG, nil); err != nil {
+			return reaped
+		}
+		reaped = append(reaped, pid)
+	}
+}
+
+// pAll is P_ALL for waitid(2): wait for any child.
+const pAll = 0
+
+// peekExited returns the pid of an exited child without reaping it, or 0 if
+// there is none.
+func peekExited() (int, error) {
+	// siginfo_t is 128 bytes; si_pid follows three ints, aligned to the
+	// size of a pointer.
+	var info [128]byte
+	_, _, errno := syscall.Syscall6(syscall.SYS_WAITID, pAll, 0, uintptr(unsafe.Pointer(&info[0])),
+		syscall.WEXITED|syscall.WNOHANG|syscall.WNOWAIT, 0, 0)
+	if errno != 0 {
+		return 0, errno
+	}
+	offset := (12 + unsafe.Sizeof(uintptr(0)) - 1) &^ (unsafe.Sizeof(uintptr(0)) - 1)
+	return int(*(*int32)(unsafe.Pointer(&info[offset]))), nil
+}
@@ -0,0 +1,59 @@
+//go:build linux
+
+package mcpproxy
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rh-ai-kickstart/ai-architecture-charts/mcp-servers/mcpproxy/internal/fakebackend"
+)
+
+// waitZombie waits until pid has exited without being reaped.
+func waitZombie(t *testing.T, pid int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		stat, _ := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+		if strings.Contains(string(stat), ") Z ") {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Process %d did not exit", pid)
+}
+
+func TestReapOrphans(t *testing.T) {
+	path, _ := fakebackend.Command("version")
+
+	// A process the proxy did not start itself is reaped
+	orphan := exec.Command(path, fakebackend.Arg, "version")
+	if err := orphan.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	waitZombie(t, orphan.Process.Pid)
+	if reaped := reapOrphans(); len(reaped) != 1 || reaped[0] != orphan.Process.Pid {
+		t.Errorf("Expected PID %d to be reaped, got %v", orphan.Process.Pid, reaped)
+	}
+	if _, err := os.Stat(fmt.Sprintf("/proc/%d", orphan.Process.Pid)); !os.IsNotExist(err) {
+		t.Errorf("Expected the zombie to be gone, got %v", err)
+	}
+
+	// The proxy's own children are left to cmd.Wait
+	own := exec.Command(path, fakebackend.Arg, "version")
+	if err := startChild(own); err != nil {
+		t.Fatalf("startChild failed: %v", err)
+	}
+	waitZombie(t, own.Process.Pid)
+	if reaped := reapOrphans(); len(reaped) != 0 {
+		t.Errorf("Expected nothing to be reaped, got %v", reaped)
+	}
+	if err := own.Wait(); err != nil {
+		t.Errorf("Expected cmd.Wait to get the exit status, got %v", err)
+	}
+	childReaped(own)
+}
@@ -0,0 +1,7 @@
+//go:build !linux
+
+package mcpproxy
+
+// startReaper does nothing outside Linux, where the proxy does not run as
+// PID 1 of a container.
+func startReaper(logger Logger) {}
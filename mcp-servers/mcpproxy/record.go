@@ -0,0 +1,233 @@
+package mcpproxy
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults for Config.RecordMaxSize and Config.RecordMaxFiles.
+const (
+	defaultRecordMaxSize  = 100 << 20
+	defaultRecordMaxFiles = 5
+)
+
+// rotatedTimeFormat stamps the names of rotated recordings. It sorts in
+// time order and holds no characters that are special in file names.
+const rotatedTimeFormat = "20060102T150405.000"
+
+// recordEntry is a line of Config.RecordFile.
+type recordEntry struct {
+	Time      time.Time       `json:"time"`
+	PID       int             `json:"pid"`
+	Direction string          `json:"direction"` // "sent" or "received"
+	Message   json.RawMessage `json:"message"`
+}
+
+// recorder appends the messages exchanged with the MCP server to
+// Config.RecordFile, rotating it once it reaches Config.RecordMaxSize.
+// Rotated files are compressed, and the oldest removed, by a goroutine of
+// their own so that writing the recording never waits for gzip. All methods
+// are safe for concurrent use, and do nothing on a nil recorder.
+type recorder struct {
+	path     string
+	maxSize  int64
+	maxFiles int
+	redactor *redactor
+	log      Logger
+
+	mu   sync.Mutex
+	file *os.File // nil once closed
+	size int64
+
+	rotated chan string   // rotated files waiting to be compressed
+	done    chan struct{} // closed once compress returns
+}
+
+// newRecorder opens the recording for cfg, redacting with redactor, or
+// returns nil if there is none.
+func newRecorder(cfg Config, log Logger, redactor *redactor) (*recorder, error) {
+	if cfg.RecordFile == "" {
+		return nil, nil
+	}
+	r := &recorder{
+		path:     cfg.RecordFile,
+		maxSize:  cfg.RecordMaxSize,
+		maxFiles: cfg.RecordMaxFiles,
+		redactor: redactor,
+		log:      log,
+		rotated:  make(chan string, 16),
+		done:     make(chan struct{}),
+	}
+	file, err := os.OpenFile(r.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	r.file, r.size = file, info.Size()
+	go r.compress()
+	return r, nil
+}
+
+// record appends msg, sent to or received from the MCP server with process
+// id pid, with secrets redacted as in the log. A message that is not JSON,
+// such as a stray line on stdout, is recorded as a string.
+func (r *recorder) record(pid int, direction string, msg []byte) {
+	if r == nil {
+		return
+	}
+	message := []byte(r.redactor.redact(string(msg)))
+	if !json.Valid(message) {
+		message, _ = json.Marshal(string(message))
+	}
+	line, _ := json.Marshal(recordEntry{Time: time.Now(), PID: pid, Direction: direction, Message: message})
+	line = append(line, '\n')
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return
+	}
+	if r.size > 0 && r.size+int64(len(line)) > r.maxSize {
+		if err := r.rotate(); err != nil {
+			r.log.Error("Failed to rotate recording, stopping it", "file", r.path, "error", err)
+			return
+		}
+	}
+	n, err := r.file.Write(line)
+	r.size += int64(n)
+	if err != nil {
+		r.log.Warn("Failed to write recording", "file", r.path, "error", err)
+	}
+}
+
+// rotate renames the recording with a timestamp, queues it for compression
+// and starts a new one. r.mu must be held. If no new recording can be
+// started, r.file is left nil and nothing more is recorded.
+func (r *recorder) rotate() error {
+	r.file.Close()
+	r.file = nil
+	name := r.rotatedName(time.Now())
+	if err := os.Rename(r.path, name); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(r.path, os.O_WRONLY|os.O_TRUNC|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	r.file, r.size = file, 0
+	r.rotated <- name
+	return nil
+}
+
+// rotatedName returns the name the recording is rotated to at now, e.g.
+// "calls-20261016T101500.123.jsonl" for "calls.jsonl", made unique among the
+// rotated files that exist.
+func (r *recorder) rotatedName(now time.Time) string {
+	ext := filepath.Ext(r.path)
+	base := strings.TrimSuffix(r.path, ext)
+	for {
+		name := base + "-" + now.UTC().Format(rotatedTimeFormat) + ext
+		if !fileExists(name) && !fileExists(name+".gz") {
+			return name
+		}
+		now = now.Add(time.Millisecond)
+	}
+}
+
+// compress gzips each rotated recording, then removes the oldest compressed
+// ones beyond RecordMaxFiles, until close.
+func (r *recorder) compress() {
+	defer close(r.done)
+	for name := range r.rotated {
+		if err := gzipFile(name); err != nil {
+			r.log.Warn("Failed to compress rotated recording", "file", name, "error", err)
+		}
+		r.prune()
+	}
+}
+
+// prune removes the oldest compressed recordings beyond RecordMaxFiles.
+func (r *recorder) prune() {
+	ext := filepath.Ext(r.path)
+	base := strings.TrimSuffix(r.path, ext)
+	names, err := filepath.Glob(escapeGlob(base) + "-*" + escapeGlob(ext) + ".gz")
+	if err != nil || len(names) <= r.maxFiles {
+		return
+	}
+	sort.Strings(names)
+	for _, name := range names[:len(names)-r.maxFiles] {
+		if err := os.Remove(name); err != nil {
+			r.log.Warn("Failed to remove old recording", "file", name, "error", err)
+		}
+	}
+}
+
+// close closes the recording and waits for rotated files to be compressed.
+func (r *recorder) close() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	if r.file != nil {
+		r.file.Close()
+		r.file = nil
+	}
+	close(r.rotated)
+	r.mu.Unlock()
+	<-r.done
+}
+
+// gzipFile replaces name with name.gz.
+func gzipFile(name string) error {
+	in, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(name+".gz", os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(out)
+	_, err = io.Copy(zw, in)
+	if cerr := zw.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(name + ".gz")
+		return err
+	}
+	return os.Remove(name)
+}
+
+func fileExists(name string) bool {
+	_, err := os.Lstat(name)
+	return err == nil
+}
+
+// escapeGlob escapes the characters of s that filepath.Match treats as
+// special.
+func escapeGlob(s string) string {
+	var b strings.Builder
+	for _, c := range s {
+		if strings.ContainsRune(`*?[\`, c) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
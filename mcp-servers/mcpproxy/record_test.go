@@ -0,0 +1,120 @@
+package mcpproxy
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// readRecording returns the entries of a recording, gzipped if its name
+// says so.
+func readRecording(t *testing.T, name string) []recordEntry {
+	t.Helper()
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var scanner *bufio.Scanner
+	if strings.HasSuffix(name, ".gz") {
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatalf("%s is not gzipped: %v", name, err)
+		}
+		scanner = bufio.NewScanner(zr)
+	} else {
+		scanner = bufio.NewScanner(f)
+	}
+	var entries []recordEntry
+	for scanner.Scan() {
+		var entry recordEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatalf("Invalid line in %s: %s", name, scanner.Text())
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestRecordFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "calls.jsonl")
+	proxy := newFakeProxy(t, "reflect", Config{RecordFile: path, RedactValues: []string{"s3cret"}})
+
+	postJSON(proxy, `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"token":"s3cret"}}`)
+	proxy.Close()
+
+	entries := readRecording(t, path)
+	if len(entries) != 2 || entries[0].Direction != "sent" || entries[1].Direction != "received" {
+		t.Fatalf("Expected the request and its response, got %+v", entries)
+	}
+	pid := proxy.Status().PID
+	for _, entry := range entries {
+		if entry.PID != pid || entry.Time.IsZero() {
+			t.Errorf("Expected the time and pid %d, got %+v", pid, entry)
+		}
+		if strings.Contains(string(entry.Message), "s3cret") {
+			t.Errorf("Expected the token to be redacted, got %s", entry.Message)
+		}
+	}
+	if !strings.Contains(string(entries[0].Message), `"token":"`+redacted+`"`) {
+		t.Errorf("Expected the request as sent, got %s", entries[0].Message)
+	}
+}
+
+func TestRecordRotation(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "calls.jsonl")
+	r, err := newRecorder(Config{RecordFile: path, RecordMaxSize: 1000, RecordMaxFiles: 2}, &recordingLogger{}, newRedactor(Config{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Each entry takes about 150 bytes, so 6 fit in a file and the 7th
+	// starts a new one
+	msg := []byte(`{"jsonrpc":"2.0","id":1,"result":{"text":"` + strings.Repeat("x", 50) + `"}}`)
+	size := func() int64 {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return info.Size()
+	}
+	var last int64
+	for i := 0; ; i++ {
+		r.record(1, "received", msg)
+		if size() < last {
+			break
+		}
+		if last = size(); last > 1000 {
+			t.Fatalf("Recording grew to %d bytes without rotating", last)
+		}
+		if i > 100 {
+			t.Fatal("Recording was not rotated")
+		}
+	}
+	if len(readRecording(t, path)) != 1 {
+		t.Errorf("Expected the new recording to hold the last entry")
+	}
+
+	// Rotated files are compressed, and only the newest are kept
+	for i := 0; i < 30; i++ {
+		r.record(1, "sent", msg)
+	}
+	r.close()
+	rotated, _ := filepath.Glob(filepath.Join(dir, "calls-*.jsonl.gz"))
+	sort.Strings(rotated)
+	if len(rotated) != 2 {
+		t.Fatalf("Expected 2 rotated recordings, got %v", rotated)
+	}
+	if files, _ := os.ReadDir(dir); len(files) != 3 {
+		t.Errorf("Expected the recording and 2 rotated ones, got %d files", len(files))
+	}
+	if entries := readRecording(t, rotated[1]); len(entries) == 0 || entries[0].Direction != "sent" {
+		t.Errorf("Expected the newest rotated recording to hold the later entries, got %+v", entries)
+	}
+}
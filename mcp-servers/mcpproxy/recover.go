@@ -0,0 +1,120 @@
+package mcpproxy
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"runtime/debug"
+	"strings"
+)
+
+func middlewarePanicMessage(correlationID string) string {
+	return fmt.Sprintf("Internal error in proxy middleware (correlation id %s)", correlationID)
+}
+
+// callMiddleware calls fn, which runs the middleware called name, logging
+// instead of crashing if it panics. It returns the correlation id the panic
+// was logged with, or "" if fn returned normally. Clients only get the
+// correlation id; the stack trace goes to the log.
+func callMiddleware(log Logger, name string, fn func()) (correlationID string) {
+	defer func() {
+		if v := recover(); v != nil {
+			correlationID = newCorrelationID()
+			log.Error("Middleware panicked", "middleware", name, "correlationId", correlationID,
+				"panic", v, "stack", string(debug.Stack()))
+		}
+	}()
+	fn()
+	return ""
+}
+
+// middlewareError returns the internal error (-32603) sent in place of the
+// response to the request with the given id when a middleware panicked.
+func middlewareError(id interface{}, correlationID string) json.RawMessage {
+	return jsonRPCError(id, -32603, middlewarePanicMessage(correlationID))
+}
+
+// checkMiddlewareResponse checks that response, as returned by the
+// middleware called name, is still the response to the request with the
+// given id. A missing or changed id or jsonrpc member is logged, counted in
+// mcp_proxy_middleware_misbehaviors_total and put right, or with
+// Config.StrictMiddleware answered with an internal error (-32603) instead.
+// A response that is not a JSON object cannot be put right.
+func (p *MCPProxy) checkMiddlewareResponse(log Logger, name string, id interface{}, response json.RawMessage) json.RawMessage {
+	var problems []string
+	var msg map[string]json.RawMessage
+	if json.Unmarshal(response, &msg) != nil || msg == nil {
+		problems = append(problems, "not a JSON object")
+	} else {
+		var got interface{}
+		if raw, ok := msg["id"]; !ok {
+			problems = append(problems, "dropped the id")
+		} else if json.Unmarshal(raw, &got) != nil || formatID(got) != formatID(id) {
+			problems = append(problems, "changed the id to "+string(raw))
+		}
+		var version string
+		if json.Unmarshal(msg["jsonrpc"], &version); version != "2.0" {
+			problems = append(problems, "dropped or changed jsonrpc")
+		}
+	}
+	if len(problems) == 0 {
+		return response
+	}
+
+	p.metrics.middlewareMisbehaved.Inc(name)
+	if msg == nil || p.config.StrictMiddleware {
+		log.Error("Middleware returned an invalid response, failing the request", "middleware", name, "id", formatID(id), "problems", strings.Join(problems, ", "))
+		return jsonRPCError(id, -32603, fmt.Sprintf("Internal error: %s returned an invalid response", name))
+	}
+	log.Error("Middleware returned an invalid response, repairing it", "middleware", name, "id", formatID(id), "problems", strings.Join(problems, ", "))
+	msg["jsonrpc"] = json.RawMessage(`"2.0"`)
+	msg["id"] = mustMarshal(id)
+	return mustMarshal(msg)
+}
+
+// failMiddleware completes req, which was not sent because its
+// RequestMiddleware panicked.
+func (p *MCPProxy) failMiddleware(req *request, correlationID string) {
+	if !req.isRequest {
+		req.err = &MiddlewareError{Middleware: "RequestMiddleware", CorrelationID: correlationID}
+		req.finish()
+		return
+	}
+	response := middlewareError(req.requestID(), correlationID)
+	p.buffered.acquire(len(response), p.stopping)
+	req.response <- response
+	req.finish()
+}
+
+func newCorrelationID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// recoverDispatcher is deferred by processRequests, which must never stop
+// while the proxy is open or requests would hang. If it panicked, current
+// is failed, the proxy reports itself unhealthy at /healthz so that it gets
+// restarted, and every request queued from then on is failed until Close.
+func (p *MCPProxy) recoverDispatcher(current **request) {
+	v := recover()
+	if v == nil {
+		return
+	}
+	p.dispatcherStopped.Store(true)
+	p.log.Error("Request dispatcher panicked, failing all requests until the proxy is restarted",
+		"panic", v, "stack", string(debug.Stack()))
+
+	if req := *current; req != nil {
+		req.fail(ErrDispatcherStopped)
+	}
+	if p.lanes != nil {
+		for p.lanes.len() > 0 {
+			p.lanes.pop().fail(ErrDispatcherStopped)
+		}
+	}
+	for req := range p.requests {
+		req.fail(ErrDispatcherStopped)
+	}
+}
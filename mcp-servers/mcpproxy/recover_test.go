@@ -0,0 +1,121 @@
+package mcpproxy
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestMiddlewarePanics(t *testing.T) {
+	logs := &recordingLogger{}
+	proxy := newFakeProxy(t, "reflect", Config{
+		Logger: logs,
+		RequestMiddleware: func(b []byte) []byte {
+			if bytes.Contains(b, []byte(`"badRequest"`)) {
+				panic("malformed request")
+			}
+			return b
+		},
+		ResponseMiddleware: func(b []byte) []byte {
+			if bytes.Contains(b, []byte(`"badResponse"`)) {
+				panic("malformed response")
+			}
+			return b
+		},
+	})
+
+	correlationID := regexp.MustCompile(`correlation id ([0-9a-f]+)`)
+	for _, method := range []string{"badRequest", "badResponse"} {
+		w := postJSON(proxy, `{"jsonrpc":"2.0","id":1,"method":"x","params":{"result":{"`+method+`":true}}}`)
+		body := w.Body.String()
+		m := correlationID.FindStringSubmatch(body)
+		if w.Code != http.StatusOK || !strings.Contains(body, `"code":-32603`) || !strings.Contains(body, `"id":1`) || m == nil {
+			t.Fatalf("Expected an internal error with a correlation id for %s, got %d %s", method, w.Code, body)
+		}
+		if strings.Contains(body, "malformed") || strings.Contains(body, "goroutine") {
+			t.Errorf("Expected the panic to stay out of the response, got %s", body)
+		}
+		if !strings.Contains(logs.String(), "correlationId="+m[1]+" panic=malformed") || !strings.Contains(logs.String(), "stack=goroutine") {
+			t.Errorf("Expected the panic and its stack in the log under %s, got:\n%s", m[1], logs.String())
+		}
+	}
+
+	// A notification is failed without reaching the MCP server
+	if w := postJSON(proxy, `{"jsonrpc":"2.0","method":"notifications/x","params":{"badRequest":true}}`); w.Code != http.StatusInternalServerError || !correlationID.MatchString(w.Body.String()) {
+		t.Errorf("Expected 500 with a correlation id for the notification, got %d %s", w.Code, w.Body.String())
+	}
+
+	// Subsequent requests still work
+	if w := postJSON(proxy, `{"jsonrpc":"2.0","id":2,"method":"x","params":{"result":{"ok":true}}}`); !strings.Contains(w.Body.String(), `"result":{"ok":true}`) {
+		t.Errorf("Expected the next request to succeed, got %s", w.Body.String())
+	}
+}
+
+func TestDispatcherPanic(t *testing.T) {
+	logs := &recordingLogger{}
+	proxy := newFakeProxy(t, "reflect", Config{Logger: logs})
+
+	// A nil request stands in for a bug in processRequests
+	proxy.requests <- nil
+
+	if w := postJSON(proxy, `{"jsonrpc":"2.0","id":1,"method":"x"}`); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 once the dispatcher stopped, got %d %s", w.Code, w.Body.String())
+	}
+	w := httptest.NewRecorder()
+	proxy.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/healthz", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected /healthz to fail, got %d %s", w.Code, w.Body.String())
+	}
+	if !strings.Contains(logs.String(), "ERROR Request dispatcher panicked") {
+		t.Errorf("Expected the panic to be logged, got:\n%s", logs.String())
+	}
+}
+
+func TestMiddlewareResponseChecked(t *testing.T) {
+	// breakResponse makes ResponseMiddleware apply the edit named in the
+	// response to it.
+	breakResponse := func(b []byte) []byte {
+		for _, edit := range []struct{ name, from, to string }{
+			{"dropId", `"id":1,`, ``},
+			{"changeId", `"id":1,`, `"id":2,`},
+			{"dropJsonrpc", `"jsonrpc":"2.0",`, ``},
+			{"notJson", string(b), `oops`},
+		} {
+			if bytes.Contains(b, []byte(edit.name)) {
+				return bytes.Replace(b, []byte(edit.from), []byte(edit.to), 1)
+			}
+		}
+		return b
+	}
+
+	logs := &recordingLogger{}
+	proxy := newFakeProxy(t, "reflect", Config{Logger: logs, ResponseMiddleware: breakResponse})
+	for _, edit := range []string{"dropId", "changeId", "dropJsonrpc"} {
+		w := postJSON(proxy, `{"jsonrpc":"2.0","id":1,"method":"x","params":{"result":{"`+edit+`":true}}}`)
+		if body := w.Body.String(); !strings.Contains(body, `"id":1`) || !strings.Contains(body, `"jsonrpc":"2.0"`) || !strings.Contains(body, `"result":{"`+edit+`":true}`) {
+			t.Errorf("%s: expected the response to be repaired, got %s", edit, body)
+		}
+	}
+	waitForLog(t, logs, "Middleware returned an invalid response, repairing it server=test middleware=ResponseMiddleware id=1 problems=changed the id to 2")
+	w := httptest.NewRecorder()
+	proxy.metrics.handle(w, httptest.NewRequest("GET", "/metrics", nil))
+	if want := `mcp_proxy_middleware_misbehaviors_total{server="test",middleware="ResponseMiddleware"} 3`; !strings.Contains(w.Body.String(), want) {
+		t.Errorf("Expected %s, got:\n%s", want, w.Body.String())
+	}
+
+	// A response that is not JSON cannot be repaired
+	if w := postJSON(proxy, `{"jsonrpc":"2.0","id":1,"method":"x","params":{"result":{"notJson":true}}}`); rpcErrorOf(t, w) != -32603 {
+		t.Errorf("Expected an internal error, got %s", w.Body.String())
+	}
+
+	strict := newFakeProxy(t, "reflect", Config{ResponseMiddleware: breakResponse, StrictMiddleware: true})
+	for _, edit := range []string{"dropId", "changeId", "dropJsonrpc"} {
+		w := postJSON(strict, `{"jsonrpc":"2.0","id":1,"method":"x","params":{"result":{"`+edit+`":true}}}`)
+		if rpcErrorOf(t, w) != -32603 || !strings.Contains(w.Body.String(), `"id":1`) || !strings.Contains(w.Body.String(), "ResponseMiddleware") {
+			t.Errorf("%s: expected an internal error, got %s", edit, w.Body.String())
+		}
+	}
+}
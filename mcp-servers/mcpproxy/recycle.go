@@ -0,0 +1,48 @@
+package mcpproxy
+
+import "time"
+
+var (
+	// recycleCheckInterval is how often recycleBackends checks the age of
+	// the MCP server, and whether it is idle once it is due.
+	recycleCheckInterval = time.Second
+
+	// maxRecycleDelay bounds how long a recycle due waits for the MCP
+	// server to be idle, together with a tenth of MaxSubprocessLifetime.
+	maxRecycleDelay = 5 * time.Minute
+)
+
+// recycleBackends replaces the MCP server whenever it has run for
+// Config.MaxSubprocessLifetime, at a moment when no client request is in
+// flight if one comes soon enough, until the proxy is closed.
+func (p *MCPProxy) recycleBackends() {
+	defer close(p.recycled)
+	lifetime := p.config.MaxSubprocessLifetime
+	maxDelay := min(maxRecycleDelay, lifetime/10)
+	ticker := time.NewTicker(min(recycleCheckInterval, lifetime))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-p.stopping:
+			return
+		}
+
+		status := p.Status()
+		if status.State != StateRunning {
+			continue
+		}
+		due := status.StartedAt.Add(lifetime)
+		if time.Now().Before(due) {
+			continue
+		}
+		if !p.inflight.empty() && time.Since(due) < maxDelay {
+			continue
+		}
+
+		p.log.Info("Recycling MCP server", "pid", status.PID, "age", time.Since(status.StartedAt).Round(time.Second), "idle", p.inflight.empty())
+		if err := p.Restart("reached MaxSubprocessLifetime"); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package mcpproxy
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// waitForRestarts waits until the MCP server has been restarted n times and
+// is running again.
+func waitForRestarts(t *testing.T, proxy *MCPProxy, n int) BackendStatus {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		status := proxy.Status()
+		if status.Restarts >= n && status.State == StateRunning {
+			return status
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %d restarts, got %+v", n, status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestMaxSubprocessLifetime(t *testing.T) {
+	fastRestarts(t)
+	logs := &recordingLogger{}
+	proxy := newFakeProxy(t, "exit", Config{MaxSubprocessLifetime: 300 * time.Millisecond, Logger: logs})
+	first := servedBy(t, proxy)
+
+	status := waitForRestarts(t, proxy, 1)
+	if status.PID == first || status.Crashes != 0 || status.LastExit.Reason != ExitReasonStopped {
+		t.Errorf("Expected the MCP server to be recycled, got %+v", status)
+	}
+	if pid := servedBy(t, proxy); pid != status.PID {
+		t.Errorf("Expected the new MCP server %d to answer, got %d", status.PID, pid)
+	}
+	waitForLog(t, logs, "Recycling MCP server server=test pid="+strconv.Itoa(first))
+	if !strings.Contains(logs.String(), "idle=true") {
+		t.Errorf("Expected the idle MCP server to be recycled, got:\n%s", logs.String())
+	}
+
+	// It goes on for every new MCP server
+	waitForRestarts(t, proxy, 2)
+}
+
+func TestMaxSubprocessLifetimeDrains(t *testing.T) {
+	fastRestarts(t)
+	proxy := newFakeProxy(t, "slow", Config{MaxSubprocessLifetime: 200 * time.Millisecond})
+
+	// A call in flight when the lifetime is up is answered by the old MCP
+	// server before it is recycled
+	w := postJSON(proxy, `{"jsonrpc":"2.0","id":1,"method":"x","params":{"delayMs":1000}}`)
+	if w.Code != 200 || !strings.Contains(w.Body.String(), `"calls":1`) {
+		t.Fatalf("Expected the call to succeed, got %d %s", w.Code, w.Body.String())
+	}
+	waitForRestarts(t, proxy, 1)
+	w = postJSON(proxy, `{"jsonrpc":"2.0","id":2,"method":"x"}`)
+	if !strings.Contains(w.Body.String(), `"calls":1`) {
+		t.Errorf("Expected a new MCP server to answer, got %s", w.Body.String())
+	}
+}
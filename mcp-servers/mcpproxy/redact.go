@@ -0,0 +1,196 @@
+package mcpproxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// redacted replaces secrets in the log.
+const redacted = "[REDACTED]"
+
+// defaultRedactPatterns are always redacted: the credentials of HTTP
+// Authorization headers, wherever an MCP server or a client echoes them.
+var defaultRedactPatterns = []string{
+	`(?i)(\b(?:bearer|basic)\s+)[A-Za-z0-9._~+/=-]{8,}`,
+	`(?i)(\bauthorization\\?"?\s*[:=]\s*\\?"?)[^\s"\\,}]+(?:\s+[^\s"\\,}]+)?`,
+}
+
+// maxAddedRedactValues bounds the secrets added to a redactor after it is
+// created, such as refreshed tokens. The oldest are dropped first: they have
+// long expired by then.
+const maxAddedRedactValues = 16
+
+// redactor replaces secrets in the text of log messages, see
+// Config.RedactPatterns and Config.RedactValues. It is shared by everything
+// the proxy logs or records, so that secrets added later, such as refreshed
+// tokens, are redacted everywhere. All methods are safe for concurrent use.
+type redactor struct {
+	rules atomic.Pointer[redactRules]
+
+	mu       sync.Mutex // serializes changes to the rules
+	patterns []*regexp.Regexp
+	static   []string // the values of the configuration
+	added    []string // the values added since, oldest first
+}
+
+// redactRules are the secrets a redactor replaces, swapped as a whole.
+type redactRules struct {
+	patterns []*regexp.Regexp
+	values   *strings.Replacer // nil if there are none
+}
+
+// newRedactor returns the redactor for cfg, whose patterns have been
+// checked by validateRedactPatterns.
+func newRedactor(cfg Config) *redactor {
+	r := &redactor{}
+	r.reconfigure(cfg)
+	return r
+}
+
+// reconfigure redacts the patterns and values of cfg, whose patterns have
+// been checked by validateRedactPatterns, instead of those of the previous
+// configuration. Values added since are kept.
+func (r *redactor) reconfigure(cfg Config) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.patterns = nil
+	for _, pattern := range append(defaultRedactPatterns[:len(defaultRedactPatterns):len(defaultRedactPatterns)], cfg.RedactPatterns...) {
+		r.patterns = append(r.patterns, regexp.MustCompile(pattern))
+	}
+	r.static = append([]string{cfg.AuthToken, cfg.AdminToken}, cfg.RedactValues...)
+	r.update()
+}
+
+// add redacts values from now on, besides those already redacted.
+func (r *redactor) add(values ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, value := range values {
+		if value != "" && !contains(r.added, value) {
+			r.added = append(r.added, value)
+		}
+	}
+	if n := len(r.added) - maxAddedRedactValues; n > 0 {
+		r.added = append([]string(nil), r.added[n:]...)
+	}
+	r.update()
+}
+
+// update swaps in the rules made of the patterns and values. r.mu must be
+// held.
+func (r *redactor) update() {
+	rules := &redactRules{patterns: r.patterns}
+	var oldnew []string
+	for _, value := range append(r.static[:len(r.static):len(r.static)], r.added...) {
+		if value != "" {
+			oldnew = append(oldnew, value, redacted)
+		}
+	}
+	if len(oldnew) > 0 {
+		rules.values = strings.NewReplacer(oldnew...)
+	}
+	r.rules.Store(rules)
+}
+
+// validateRedactPatterns checks that every pattern in cfg.RedactPatterns
+// compiles.
+func validateRedactPatterns(cfg Config) error {
+	for _, pattern := range cfg.RedactPatterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("invalid redact pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// redact returns s with the literal secrets, then every match of the
+// patterns, replaced. The text matched by a pattern's first group is kept.
+func (r *redactor) redact(s string) string {
+	rules := r.rules.Load()
+	if rules.values != nil {
+		s = rules.values.Replace(s)
+	}
+	for _, re := range rules.patterns {
+		matches := re.FindAllStringSubmatchIndex(s, -1)
+		if matches == nil {
+			continue
+		}
+		var b strings.Builder
+		last := 0
+		for _, m := range matches {
+			keep := m[0]
+			if len(m) > 2 && m[3] >= 0 {
+				keep = m[3]
+			}
+			b.WriteString(s[last:keep])
+			b.WriteString(redacted)
+			last = m[1]
+		}
+		b.WriteString(s[last:])
+		s = b.String()
+	}
+	return s
+}
+
+// value returns v redacted if it holds text: strings, byte slices, errors
+// and Stringers. Other values are returned as is.
+func (r *redactor) value(v interface{}) interface{} {
+	switch v := v.(type) {
+	case string:
+		return r.redact(v)
+	case []byte:
+		return r.redact(string(v))
+	case json.RawMessage:
+		return r.redact(string(v))
+	case error:
+		return r.redact(v.Error())
+	case fmt.Stringer:
+		return r.redact(v.String())
+	}
+	return v
+}
+
+// redactingLogger redacts messages and values before passing them on.
+type redactingLogger struct {
+	next Logger
+	r    *redactor
+}
+
+func (l redactingLogger) Debug(msg string, kv ...interface{}) {
+	l.next.Debug(l.r.redact(msg), l.values(kv)...)
+}
+
+func (l redactingLogger) Info(msg string, kv ...interface{}) {
+	l.next.Info(l.r.redact(msg), l.values(kv)...)
+}
+
+func (l redactingLogger) Warn(msg string, kv ...interface{}) {
+	l.next.Warn(l.r.redact(msg), l.values(kv)...)
+}
+
+func (l redactingLogger) Error(msg string, kv ...interface{}) {
+	l.next.Error(l.r.redact(msg), l.values(kv)...)
+}
+
+// values redacts the values of the alternating keys and values kv.
+func (l redactingLogger) values(kv []interface{}) []interface{} {
+	out := make([]interface{}, len(kv))
+	for i, v := range kv {
+		if i%2 == 1 {
+			v = l.r.value(v)
+		}
+		out[i] = v
+	}
+	return out
+}
+
+// AddRedactValues redacts values from the log from now on, besides
+// Config.RedactValues, e.g. credentials rotated while the proxy runs. Only
+// the latest few added are kept.
+func (p *MCPProxy) AddRedactValues(values ...string) {
+	p.redactor.add(values...)
+}
@@ -0,0 +1,99 @@
+package mcpproxy
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rh-ai-kickstart/ai-architecture-charts/mcp-servers/mcpproxy/internal/fakebackend"
+)
+
+func TestRedact(t *testing.T) {
+	r := newRedactor(Config{
+		AuthToken:      "client-secret",
+		RedactValues:   []string{"s3cr3t!value"},
+		RedactPatterns: []string{`(key=)\w+`, `tok_[a-z]+`},
+	})
+	for _, tc := range []struct {
+		in, want string
+	}{
+		{"no secrets here", "no secrets here"},
+		{"failed with s3cr3t!value twice: s3cr3t!value", "failed with [REDACTED] twice: [REDACTED]"},
+		{"Authorization: Bearer abcdefgh12345678", "Authorization: [REDACTED]"},
+		{`{"headers":{"Authorization":"token 0123456789abcdef"}}`, `{"headers":{"Authorization":"[REDACTED]"}}`},
+		{`"authorization\": \"Basic dXNlcjpwYXNz\"`, `"authorization\": \"[REDACTED]\"`},
+		{"sent bearer abcdefgh12345678 upstream", "sent bearer [REDACTED] upstream"},
+		{"auth token client-secret rejected", "auth token [REDACTED] rejected"},
+		{"url?key=abc123&x=1", "url?key=[REDACTED]&x=1"},
+		{"use tok_abc", "use [REDACTED]"},
+	} {
+		if got := r.redact(tc.in); got != tc.want {
+			t.Errorf("redact(%q) = %q, expected %q", tc.in, got, tc.want)
+		}
+	}
+
+	if got := r.value(errors.New("bad s3cr3t!value")); got != "bad [REDACTED]" {
+		t.Errorf("Expected errors to be redacted, got %v", got)
+	}
+	if got := r.value(42); got != 42 {
+		t.Errorf("Expected other values to be left alone, got %v", got)
+	}
+
+	// Secrets added later are redacted along with the configured ones, and
+	// only the latest are kept
+	for i := 0; i <= maxAddedRedactValues; i++ {
+		r.add(fmt.Sprintf("later-secret-%d", i))
+	}
+	if got := r.redact("later-secret-0 later-secret-1 s3cr3t!value"); got != "later-secret-0 [REDACTED] [REDACTED]" {
+		t.Errorf("Expected the latest added secrets to be redacted, got %q", got)
+	}
+
+	if err := validateRedactPatterns(Config{RedactPatterns: []string{"("}}); err == nil {
+		t.Error("Expected an invalid pattern to be rejected")
+	}
+}
+
+func TestRedactedLog(t *testing.T) {
+	const secret = "plant3d-Secret.value"
+	logs := &recordingLogger{}
+	path, args := fakebackend.Command("reflect")
+	proxy, err := NewMCPProxy(Config{
+		ServerName:   "test",
+		CommandPath:  "echo using " + secret + " >&2; exec " + path,
+		CommandArgs:  args,
+		UseShell:     true,
+		Logger:       logs,
+		RedactValues: []string{secret},
+	})
+	if err != nil {
+		t.Fatalf("NewMCPProxy failed: %v", err)
+	}
+	defer proxy.Close()
+
+	w := postJSON(proxy, `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"result":{"content":[{"type":"text","text":"bad credentials `+secret+`"}]}}}`)
+	if !strings.Contains(w.Body.String(), secret) {
+		t.Fatalf("Expected the response itself to be left alone, got %s", w.Body.String())
+	}
+	waitForLog(t, logs, "MCP server stderr")
+	waitForLog(t, logs, "Sending HTTP response")
+
+	if strings.Contains(logs.String(), secret) {
+		t.Errorf("Expected the secret to be redacted from the log, got:\n%s", logs.String())
+	}
+	if !strings.Contains(logs.String(), "line=using [REDACTED]") {
+		t.Errorf("Expected the redacted stderr line in the log, got:\n%s", logs.String())
+	}
+}
+
+func waitForLog(t *testing.T, logs *recordingLogger, want string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(logs.String(), want) {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %q in the log, got:\n%s", want, logs.String())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,87 @@
+package mcpproxy
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// handshake is the initialization of the MCP server as last completed by a
+// client, see Config.ReplayInitialize. It is only used by the
+// processRequests goroutine, which sends requests one at a time, so
+// concurrent initialize requests are recorded in the order the MCP server
+// answered them.
+type handshake struct {
+	params      json.RawMessage // of the initialize request, nil until one succeeded
+	initialized bool            // notifications/initialized was sent after it
+	replays     int             // numbers the ids of replayed requests
+}
+
+// record notes the client message msg with the given method, sent to the
+// MCP server, and the response it got, if it is part of the handshake.
+func (h *handshake) record(method string, msg, response json.RawMessage) {
+	switch method {
+	case "initialize":
+		if response == nil {
+			return
+		}
+		if _, failed := rpcErrorCode(response); failed {
+			return
+		}
+		var req struct {
+			Params json.RawMessage `json:"params"`
+		}
+		json.Unmarshal(msg, &req)
+		h.params = req.Params
+		h.initialized = false
+	case "notifications/initialized":
+		h.initialized = h.params != nil
+	}
+}
+
+// replayInitialize initializes b, a restarted MCP server, the way the
+// previous one was initialized, before req is sent to it. Nothing is
+// replayed to the first MCP server, before any client initialized, or if
+// req itself is an initialize request.
+func (p *MCPProxy) replayInitialize(b *backend, req *request) {
+	if b.initialized {
+		return
+	}
+	b.initialized = true
+	if req.method == "initialize" || p.handshake.params == nil {
+		return
+	}
+
+	p.handshake.replays++
+	id := fmt.Sprintf("mcp-proxy-initialize-%d", p.handshake.replays)
+	initialize, _ := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      id,
+		"method":  "initialize",
+		"params":  p.handshake.params,
+	})
+	p.logBody(req.log, "Replaying", initialize)
+	if err := b.writer.WriteFrame(initialize); err != nil {
+		req.log.Error("Error replaying initialize", "error", err)
+		return
+	}
+	p.recorder.record(b.cmd.Process.Pid, "sent", initialize)
+	response, _, err := p.readResponse(b, req.log, id)
+	if err != nil {
+		req.log.Error("Error replaying initialize", "error", err)
+		return
+	}
+	if code, failed := rpcErrorCode(response); failed {
+		req.log.Error("Restarted MCP server rejected the replayed initialize", "code", code)
+		return
+	}
+
+	if p.handshake.initialized {
+		initialized, _ := json.Marshal(map[string]interface{}{"jsonrpc": "2.0", "method": "notifications/initialized"})
+		if err := b.writer.WriteFrame(initialized); err != nil {
+			req.log.Error("Error replaying notifications/initialized", "error", err)
+			return
+		}
+		p.recorder.record(b.cmd.Process.Pid, "sent", initialized)
+	}
+	req.log.Info("Replayed initialize to the restarted MCP server", "notified", p.handshake.initialized)
+}
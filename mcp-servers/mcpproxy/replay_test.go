@@ -0,0 +1,55 @@
+package mcpproxy
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReplayInitialize(t *testing.T) {
+	fastRestarts(t)
+	proxy := newFakeProxy(t, "stateful", Config{MaxRestarts: 1, ReplayInitialize: true})
+
+	postJSON(proxy, `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-03-26","clientInfo":{"name":"inspector"}}}`)
+	postJSON(proxy, `{"jsonrpc":"2.0","method":"notifications/initialized"}`)
+	w := postJSON(proxy, `{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"query"}}`)
+	if !strings.Contains(w.Body.String(), `"client":"inspector"`) {
+		t.Fatalf("Expected the MCP server to be initialized, got %s", w.Body.String())
+	}
+
+	restartStateful(t, proxy)
+
+	// The client does not initialize again
+	w = postJSON(proxy, `{"jsonrpc":"2.0","id":4,"method":"tools/call","params":{"name":"query"}}`)
+	if body := w.Body.String(); !strings.Contains(body, `"id":4`) || !strings.Contains(body, `"client":"inspector"`) {
+		t.Errorf("Expected the restarted MCP server to be initialized, got %s", body)
+	}
+}
+
+func TestNoReplayWithoutInitialize(t *testing.T) {
+	fastRestarts(t)
+	proxy := newFakeProxy(t, "stateful", Config{MaxRestarts: 1, ReplayInitialize: true})
+
+	restartStateful(t, proxy)
+
+	// No client initialized, so there is nothing to replay
+	w := postJSON(proxy, `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"query"}}`)
+	if !strings.Contains(w.Body.String(), "Server not initialized") {
+		t.Errorf("Expected the MCP server to be uninitialized, got %s", w.Body.String())
+	}
+}
+
+// restartStateful makes the "stateful" fake backend exit and waits until it
+// has been restarted.
+func restartStateful(t *testing.T, proxy *MCPProxy) {
+	t.Helper()
+	pid := proxy.currentBackend().cmd.Process.Pid
+	postJSON(proxy, `{"jsonrpc":"2.0","id":"exit","method":"tools/call","params":{"name":"exit"}}`)
+	deadline := time.Now().Add(5 * time.Second)
+	for proxy.Status().State != StateRunning || proxy.currentBackend().cmd.Process.Pid == pid {
+		if time.Now().After(deadline) {
+			t.Fatalf("MCP server was not restarted, status: %+v", proxy.Status())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
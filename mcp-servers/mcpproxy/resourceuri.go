@@ -0,0 +1,155 @@
+package mcpproxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// resourceURIMembers maps the methods whose results carry resource URIs to
+// the result member listing them.
+var resourceURIMembers = map[string]string{
+	"resources/list": "resources",
+	"resources/read": "contents",
+}
+
+// resourceURIParams lists the methods whose params.uri names a resource by
+// the URI the client was given.
+var resourceURIParams = []string{"resources/read", "resources/subscribe", "resources/unsubscribe"}
+
+// validateResourceURIRewrite checks that cfg.ResourceURIRewrite maps hosts
+// to distinct hosts, so that rewritten URIs can be mapped back.
+func validateResourceURIRewrite(cfg Config) error {
+	seen := make(map[string]string)
+	for from, to := range cfg.ResourceURIRewrite {
+		for _, host := range []string{from, to} {
+			if host == "" || strings.ContainsAny(host, "/?#@") {
+				return fmt.Errorf("ResourceURIRewrite: %q is not a host", host)
+			}
+		}
+		if other, ok := seen[to]; ok {
+			return fmt.Errorf("ResourceURIRewrite maps both %q and %q to %q", other, from, to)
+		}
+		seen[to] = from
+	}
+	return nil
+}
+
+// rewriteResourceURIs rewrites the URIs in a resources/list or
+// resources/read response according to hosts. Other responses, and
+// responses mentioning none of the hosts, are returned unchanged.
+func rewriteResourceURIs(response json.RawMessage, method string, hosts map[string]string) json.RawMessage {
+	member, ok := resourceURIMembers[method]
+	if !ok || !mentionsAny(response, hosts) {
+		return response
+	}
+
+	var msg map[string]json.RawMessage
+	if json.Unmarshal(response, &msg) != nil || msg["result"] == nil {
+		return response
+	}
+	var result map[string]json.RawMessage
+	if json.Unmarshal(msg["result"], &result) != nil {
+		return response
+	}
+	var items []map[string]json.RawMessage
+	if json.Unmarshal(result[member], &items) != nil {
+		return response
+	}
+
+	changed := false
+	for _, item := range items {
+		var uri string
+		if json.Unmarshal(item["uri"], &uri) != nil {
+			continue
+		}
+		if rewritten, ok := rewriteHost(uri, hosts); ok {
+			item["uri"], _ = json.Marshal(rewritten)
+			changed = true
+		}
+	}
+	if !changed {
+		return response
+	}
+
+	var err error
+	if result[member], err = json.Marshal(items); err != nil {
+		return response
+	}
+	if msg["result"], err = json.Marshal(result); err != nil {
+		return response
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return response
+	}
+	return data
+}
+
+// restoreResourceURI maps params.uri of a request for a resource back to
+// the URI the MCP server knows it by, undoing rewriteResourceURIs.
+func restoreResourceURI(msg json.RawMessage, method string, hosts map[string]string) json.RawMessage {
+	if !contains(resourceURIParams, method) {
+		return msg
+	}
+
+	var req map[string]json.RawMessage
+	if json.Unmarshal(msg, &req) != nil || req["params"] == nil {
+		return msg
+	}
+	var params map[string]json.RawMessage
+	if json.Unmarshal(req["params"], &params) != nil {
+		return msg
+	}
+	var uri string
+	if json.Unmarshal(params["uri"], &uri) != nil {
+		return msg
+	}
+
+	reverse := make(map[string]string, len(hosts))
+	for from, to := range hosts {
+		reverse[to] = from
+	}
+	original, ok := rewriteHost(uri, reverse)
+	if !ok {
+		return msg
+	}
+
+	var err error
+	params["uri"], _ = json.Marshal(original)
+	if req["params"], err = json.Marshal(params); err != nil {
+		return msg
+	}
+	data, err := json.Marshal(req)
+	if err != nil {
+		return msg
+	}
+	return data
+}
+
+// rewriteHost replaces the host of uri by its mapping in hosts, if it has
+// one. Hosts are matched exactly, including the port.
+func rewriteHost(uri string, hosts map[string]string) (string, bool) {
+	u, err := url.Parse(uri)
+	if err != nil || u.Host == "" {
+		return uri, false
+	}
+	to, ok := hosts[u.Host]
+	if !ok {
+		return uri, false
+	}
+	u.Host = to
+	return u.String(), true
+}
+
+// mentionsAny reports whether response contains any of the keys of hosts.
+func mentionsAny(response json.RawMessage, hosts map[string]string) bool {
+	for from := range hosts {
+		if bytes.Contains(response, []byte(from)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,68 @@
+package mcpproxy
+
+import (
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestResourceURIRewriteList(t *testing.T) {
+	proxy := newFakeProxy(t, "reflect", Config{
+		ResourceURIRewrite: map[string]string{"localhost:3000": "mcp.example.com"},
+	})
+
+	w := postJSON(proxy, `{"jsonrpc":"2.0","id":1,"method":"resources/list","params":{"result":{"resources":[`+
+		`{"uri":"http://localhost:3000/docs/a.md?v=2","name":"a","mimeType":"text/markdown"},`+
+		`{"uri":"http://localhost:4000/b","name":"b"},`+
+		`{"uri":"file:///etc/c","name":"c"}]}}}`)
+	body := w.Body.String()
+	for _, want := range []string{`"uri":"http://mcp.example.com/docs/a.md?v=2"`, `"mimeType":"text/markdown"`, `"uri":"http://localhost:4000/b"`, `"uri":"file:///etc/c"`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected %s in %s", want, body)
+		}
+	}
+
+	// Other methods are left alone
+	w = postJSON(proxy, `{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"result":{"resources":[{"uri":"http://localhost:3000/a"}]}}}`)
+	if !strings.Contains(w.Body.String(), `"uri":"http://localhost:3000/a"`) {
+		t.Errorf("Expected tools/call to be unchanged, got %s", w.Body.String())
+	}
+}
+
+func TestResourceURIRewriteRead(t *testing.T) {
+	var mu sync.Mutex
+	var sent []string
+	proxy := newFakeProxy(t, "reflect", Config{
+		ResourceURIRewrite: map[string]string{"localhost:3000": "mcp.example.com"},
+		RequestMiddleware: func(b []byte) []byte {
+			mu.Lock()
+			sent = append(sent, string(b))
+			mu.Unlock()
+			return b
+		},
+	})
+
+	w := postJSON(proxy, `{"jsonrpc":"2.0","id":1,"method":"resources/read","params":{"uri":"http://mcp.example.com/docs/a.md",`+
+		`"result":{"contents":[{"uri":"http://localhost:3000/docs/a.md","text":"hello"}]}}}`)
+	if body := w.Body.String(); !strings.Contains(body, `"uri":"http://mcp.example.com/docs/a.md"`) || !strings.Contains(body, `"text":"hello"`) {
+		t.Errorf("Expected the content URI to be rewritten, got %s", body)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(sent) != 1 || !strings.Contains(sent[0], `"uri":"http://localhost:3000/docs/a.md"`) {
+		t.Errorf("Expected the MCP server to be asked for its own URI, got %q", sent)
+	}
+}
+
+func TestInvalidResourceURIRewrite(t *testing.T) {
+	for _, hosts := range []map[string]string{
+		{"localhost:3000": "https://mcp.example.com"},
+		{"": "mcp.example.com"},
+		{"a:1": "mcp.example.com", "b:1": "mcp.example.com"},
+	} {
+		if _, err := resolveConfig(Config{ResourceURIRewrite: hosts}); err == nil {
+			t.Errorf("Expected %v to be rejected", hosts)
+		}
+	}
+}
@@ -0,0 +1,334 @@
+package mcpproxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults of RouterConfig.
+const (
+	defaultFanOutTimeout = 10 * time.Second
+	defaultToolSeparator = "__"
+)
+
+// maxRouterRequestBytes limits the requests a Router reads to route them.
+// Each proxy still applies its own MaxRequestBytes.
+const maxRouterRequestBytes = 16 << 20
+
+// fanOutErrorsKey is the _meta member of a merged result listing the
+// proxies that failed to answer, see RouterConfig.FanOut.
+const fanOutErrorsKey = "mcp-proxy/errors"
+
+// namespacedMembers are the result members of list methods whose entries
+// are named, and so are prefixed with their proxy's name when merged.
+var namespacedMembers = []string{"tools", "prompts"}
+
+// RouterConfig configures a Router.
+type RouterConfig struct {
+	// FanOut lists the methods sent to every proxy at once, whose results
+	// are merged into one (default: initialize and tools/list). Array
+	// members such as tools are concatenated in the order of the proxy
+	// names, with the names of tools and prompts prefixed by their proxy's
+	// name and Separator. Other members are taken from the first proxy
+	// that answered, except nextCursor: only the first page of each proxy
+	// is listed. Proxies that fail, answer with an error or time out are
+	// left out and listed in the result's _meta under "mcp-proxy/errors",
+	// each as {"backend", "code", "message"}. If all of them fail, the
+	// response is an error -32603 with that list as its data.
+	FanOut []string
+
+	// FanOutTimeout bounds how long each proxy may take to answer a
+	// fanned-out request (default 10s). A proxy that takes longer is
+	// reported as failed.
+	FanOutTimeout time.Duration
+
+	// Default names the proxy serving requests that neither fan out nor
+	// name a tool or prompt, such as ping, and GET requests for the
+	// notification stream (default: the first proxy by name).
+	Default string
+
+	// Separator joins a proxy's name to the names of its tools and prompts,
+	// e.g. "github__get_me" (default "__"). Proxy names must not contain it.
+	Separator string
+}
+
+// Router serves the proxies of a Manager at a single MCP endpoint. Requests
+// for methods in FanOut go to every proxy; tools/call and prompts/get go to
+// the proxy their namespaced name belongs to, with the name it knows;
+// notifications go to every proxy; anything else goes to the Default one.
+// Each proxy authenticates and handles the request as it would on its own
+// endpoint, so clients must hold credentials every proxy accepts.
+type Router struct {
+	cfg      RouterConfig
+	names    []string // sorted
+	handlers map[string]http.Handler
+}
+
+// Router returns a Router over the proxies added to m so far.
+func (m *Manager) Router(cfg RouterConfig) (*Router, error) {
+	if cfg.FanOut == nil {
+		cfg.FanOut = []string{"initialize", "tools/list"}
+	}
+	if cfg.FanOutTimeout <= 0 {
+		cfg.FanOutTimeout = defaultFanOutTimeout
+	}
+	if cfg.Separator == "" {
+		cfg.Separator = defaultToolSeparator
+	}
+
+	rt := &Router{cfg: cfg, names: m.Names(), handlers: make(map[string]http.Handler)}
+	if len(rt.names) == 0 {
+		return nil, errors.New("router has no proxies")
+	}
+	for _, name := range rt.names {
+		if strings.Contains(name, cfg.Separator) {
+			return nil, fmt.Errorf("proxy name %q contains the separator %q", name, cfg.Separator)
+		}
+		rt.handlers[name] = m.Proxy(name).Handler()
+	}
+	if rt.cfg.Default == "" {
+		rt.cfg.Default = rt.names[0]
+	} else if rt.handlers[rt.cfg.Default] == nil {
+		return nil, fmt.Errorf("default proxy %q is not registered", rt.cfg.Default)
+	}
+	return rt, nil
+}
+
+// ServeHTTP routes a request to the MCP endpoint of one or more proxies.
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		rt.forward(w, r, rt.cfg.Default, nil)
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRouterRequestBytes))
+	if err != nil {
+		http.Error(w, "Error reading request", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	var msg MCPMessage
+	if json.Unmarshal(body, &msg) != nil {
+		rt.forward(w, r, rt.cfg.Default, body)
+		return
+	}
+	switch {
+	case !msg.HasID && msg.Method != "":
+		rt.notify(w, r, body)
+	case contains(rt.cfg.FanOut, msg.Method):
+		rt.fanOut(w, r, body, msg)
+	case msg.Method == "tools/call" || msg.Method == "prompts/get":
+		rt.routeByName(w, r, body, msg)
+	default:
+		rt.forward(w, r, rt.cfg.Default, body)
+	}
+}
+
+// forward serves r, with body if it is not nil, by the named proxy's MCP
+// endpoint.
+func (rt *Router) forward(w http.ResponseWriter, r *http.Request, name string, body []byte) {
+	r2 := r.Clone(r.Context())
+	r2.URL.Path = "/"
+	r2.URL.RawPath = ""
+	if body != nil {
+		r2.Body = io.NopCloser(bytes.NewReader(body))
+		r2.ContentLength = int64(len(body))
+	}
+	rt.handlers[name].ServeHTTP(w, r2)
+}
+
+// notify sends a notification to every proxy.
+func (rt *Router) notify(w http.ResponseWriter, r *http.Request, body []byte) {
+	status := http.StatusAccepted
+	for _, name := range rt.names {
+		rec := newResponseBuffer()
+		rt.forward(rec, r, name, body)
+		if rec.status >= 300 {
+			status = rec.status
+		}
+	}
+	w.WriteHeader(status)
+}
+
+// routeByName forwards a tools/call or prompts/get request to the proxy its
+// namespaced name belongs to, with the name the proxy knows.
+func (rt *Router) routeByName(w http.ResponseWriter, r *http.Request, body []byte, msg MCPMessage) {
+	var req struct {
+		Params struct {
+			Name string `json:"name"`
+		} `json:"params"`
+	}
+	json.Unmarshal(body, &req)
+	name, tool, ok := strings.Cut(req.Params.Name, rt.cfg.Separator)
+	if !ok || rt.handlers[name] == nil {
+		writeRouterResponse(w, jsonRPCError(msg.ID, -32602, fmt.Sprintf("Unknown tool or prompt %q", req.Params.Name)))
+		return
+	}
+	rt.forward(w, r, name, setParam(body, "name", tool))
+}
+
+// fanOutError is how a proxy that failed a fanned-out request is reported.
+type fanOutError struct {
+	Backend string `json:"backend"`
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// fanOut sends a request to every proxy concurrently and answers with their
+// merged results, see RouterConfig.FanOut.
+func (rt *Router) fanOut(w http.ResponseWriter, r *http.Request, body []byte, msg MCPMessage) {
+	results := make([]json.RawMessage, len(rt.names))
+	errs := make([]*fanOutError, len(rt.names))
+	var wg sync.WaitGroup
+	for i, name := range rt.names {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(r.Context(), rt.cfg.FanOutTimeout)
+			defer cancel()
+			results[i], errs[i] = rt.call(r.WithContext(ctx), name, body)
+		}(i, name)
+	}
+	wg.Wait()
+
+	var failed []*fanOutError
+	for _, err := range errs {
+		if err != nil {
+			failed = append(failed, err)
+		}
+	}
+	if len(failed) == len(rt.names) {
+		data, _ := json.Marshal(failed)
+		response, _ := json.Marshal(map[string]interface{}{"jsonrpc": "2.0", "id": msg.ID,
+			"error": &RPCError{Code: -32603, Message: "No backend answered " + msg.Method, Data: data}})
+		writeRouterResponse(w, response)
+		return
+	}
+	merged := rt.merge(results)
+	if len(failed) > 0 {
+		meta, _ := merged["_meta"].(map[string]interface{})
+		if meta == nil {
+			meta = make(map[string]interface{})
+		}
+		meta[fanOutErrorsKey] = failed
+		merged["_meta"] = meta
+	}
+	response, _ := json.Marshal(map[string]interface{}{"jsonrpc": "2.0", "id": msg.ID, "result": merged})
+	writeRouterResponse(w, response)
+}
+
+// call sends a request to the named proxy and returns its result, or why it
+// has none.
+func (rt *Router) call(r *http.Request, name string, body []byte) (json.RawMessage, *fanOutError) {
+	rec := newResponseBuffer()
+	rt.forward(rec, r, name, body)
+	fail := func(code int, format string, args ...interface{}) (json.RawMessage, *fanOutError) {
+		return nil, &fanOutError{Backend: name, Code: code, Message: fmt.Sprintf(format, args...)}
+	}
+	if rec.body.Len() == 0 && r.Context().Err() != nil {
+		return fail(-32603, "no answer within %s", rt.cfg.FanOutTimeout)
+	}
+
+	var resp struct {
+		Result json.RawMessage `json:"result"`
+		Error  *RPCError       `json:"error"`
+	}
+	if json.Unmarshal(rec.body.Bytes(), &resp) != nil {
+		return fail(-32603, "HTTP %d: %s", rec.status, strings.TrimSpace(rec.body.String()))
+	}
+	if resp.Error != nil {
+		return fail(resp.Error.Code, "%s", resp.Error.Message)
+	}
+	return resp.Result, nil
+}
+
+// merge merges the results of the proxies, nil for those that failed, in
+// the order of their names.
+func (rt *Router) merge(results []json.RawMessage) map[string]interface{} {
+	merged := make(map[string]interface{})
+	for i, result := range results {
+		var members map[string]json.RawMessage
+		if json.Unmarshal(result, &members) != nil {
+			continue
+		}
+		for key, value := range members {
+			var list []interface{}
+			if json.Unmarshal(value, &list) != nil {
+				if _, ok := merged[key]; !ok && key != "nextCursor" {
+					merged[key] = value
+				}
+				continue
+			}
+			if contains(namespacedMembers, key) {
+				for _, entry := range list {
+					if named, ok := entry.(map[string]interface{}); ok {
+						if name, ok := named["name"].(string); ok {
+							named["name"] = rt.names[i] + rt.cfg.Separator + name
+						}
+					}
+				}
+			}
+			existing, _ := merged[key].([]interface{})
+			merged[key] = append(existing, list...)
+		}
+	}
+	if meta, ok := merged["_meta"].(json.RawMessage); ok {
+		var m map[string]interface{}
+		if json.Unmarshal(meta, &m) == nil {
+			merged["_meta"] = m
+		}
+	}
+	return merged
+}
+
+// setParam returns msg with params.<key> set to value, or msg unchanged if
+// it cannot be parsed.
+func setParam(msg []byte, key string, value interface{}) []byte {
+	var req map[string]json.RawMessage
+	var params map[string]json.RawMessage
+	if json.Unmarshal(msg, &req) != nil || json.Unmarshal(req["params"], &params) != nil {
+		return msg
+	}
+	var err error
+	if params[key], err = json.Marshal(value); err != nil {
+		return msg
+	}
+	if req["params"], err = json.Marshal(params); err != nil {
+		return msg
+	}
+	data, err := json.Marshal(req)
+	if err != nil {
+		return msg
+	}
+	return data
+}
+
+func writeRouterResponse(w http.ResponseWriter, response json.RawMessage) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(response)
+}
+
+// responseBuffer is an http.ResponseWriter keeping the response of a proxy
+// to a request the Router sent to several of them.
+type responseBuffer struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newResponseBuffer() *responseBuffer {
+	return &responseBuffer{header: make(http.Header), status: http.StatusOK}
+}
+
+func (b *responseBuffer) Header() http.Header { return b.header }
+
+func (b *responseBuffer) Write(p []byte) (int, error) { return b.body.Write(p) }
+
+func (b *responseBuffer) WriteHeader(status int) { b.status = status }
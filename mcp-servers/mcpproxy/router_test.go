@@ -0,0 +1,119 @@
+package mcpproxy
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rh-ai-kickstart/ai-architecture-charts/mcp-servers/mcpproxy/internal/fakebackend"
+)
+
+func newTestRouter(t *testing.T, modes map[string]string, cfg RouterConfig) (*Manager, *Router) {
+	t.Helper()
+	checkGoroutines(t)
+	m := NewManager()
+	t.Cleanup(func() { m.Close() })
+	for name, mode := range modes {
+		path, args := fakebackend.Command(mode)
+		if _, err := m.Add(name, "/"+name, Config{CommandPath: path, CommandArgs: args}); err != nil {
+			t.Fatalf("Add %s failed: %v", name, err)
+		}
+	}
+	rt, err := m.Router(cfg)
+	if err != nil {
+		t.Fatalf("Router failed: %v", err)
+	}
+	return m, rt
+}
+
+func routerPost(rt *Router, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("POST", "/mcp", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	rt.ServeHTTP(w, r)
+	return w
+}
+
+func TestRouterFanOut(t *testing.T) {
+	m, rt := newTestRouter(t, map[string]string{"github": "mcp", "oracle": "mcp", "stuck": "hang"},
+		RouterConfig{FanOutTimeout: 200 * time.Millisecond})
+
+	var resp struct {
+		ID     int `json:"id"`
+		Result struct {
+			Tools []struct {
+				Name string `json:"name"`
+			} `json:"tools"`
+			Meta map[string][]fanOutError `json:"_meta"`
+		} `json:"result"`
+	}
+	w := routerPost(rt, `{"jsonrpc":"2.0","id":7,"method":"tools/list"}`)
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Invalid response %q", w.Body.String())
+	}
+	var names []string
+	for _, tool := range resp.Result.Tools {
+		names = append(names, tool.Name)
+	}
+	if got := strings.Join(names, ","); resp.ID != 7 || got != "github__echo,github__fail,oracle__echo,oracle__fail" {
+		t.Errorf("Expected the namespaced tools of both backends, got %s", w.Body.String())
+	}
+	errs := resp.Result.Meta[fanOutErrorsKey]
+	if len(errs) != 1 || errs[0].Backend != "stuck" || errs[0].Code != -32603 || !strings.Contains(errs[0].Message, "200ms") {
+		t.Errorf("Expected the stuck backend to be reported, got %+v", errs)
+	}
+
+	// Tool calls go to the backend the tool belongs to, with its own name
+	w = routerPost(rt, `{"jsonrpc":"2.0","id":8,"method":"tools/call","params":{"name":"oracle__echo","arguments":{"x":1}}}`)
+	if body := w.Body.String(); !strings.Contains(body, `"id":8`) || !strings.Contains(body, `{\"x\":1}`) {
+		t.Errorf("Expected the echoed arguments, got %s", body)
+	}
+	if n := m.Proxy("oracle").metrics.requests.Value("tools/call"); n != 1 {
+		t.Errorf("Expected the call to reach oracle, got %v calls", n)
+	}
+	if n := m.Proxy("github").metrics.requests.Value("tools/call"); n != 0 {
+		t.Errorf("Expected the call not to reach github, got %v calls", n)
+	}
+
+	for _, name := range []string{"echo", "unknown__echo"} {
+		w = routerPost(rt, `{"jsonrpc":"2.0","id":9,"method":"tools/call","params":{"name":"`+name+`"}}`)
+		if body := w.Body.String(); !strings.Contains(body, `"code":-32602`) {
+			t.Errorf("Expected tool %s to be unknown, got %s", name, body)
+		}
+	}
+}
+
+func TestRouterAllFailed(t *testing.T) {
+	_, rt := newTestRouter(t, map[string]string{"a": "hang", "b": "hang"}, RouterConfig{FanOutTimeout: 50 * time.Millisecond})
+
+	var resp struct {
+		Error struct {
+			Code int           `json:"code"`
+			Data []fanOutError `json:"data"`
+		} `json:"error"`
+	}
+	w := routerPost(rt, `{"jsonrpc":"2.0","id":1,"method":"tools/list"}`)
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Error.Code != -32603 || len(resp.Error.Data) != 2 {
+		t.Errorf("Expected an error listing both backends, got %s", w.Body.String())
+	}
+}
+
+func TestRouterConfig(t *testing.T) {
+	m := NewManager()
+	t.Cleanup(func() { m.Close() })
+	if _, err := m.Router(RouterConfig{}); err == nil {
+		t.Error("Expected a router without proxies to be rejected")
+	}
+	path, args := fakebackend.Command("mcp")
+	if _, err := m.Add("git__hub", "/github", Config{CommandPath: path, CommandArgs: args}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Router(RouterConfig{}); err == nil {
+		t.Error("Expected a proxy name containing the separator to be rejected")
+	}
+	if _, err := m.Router(RouterConfig{Separator: ".", Default: "oracle"}); err == nil {
+		t.Error("Expected an unknown default proxy to be rejected")
+	}
+}
@@ -0,0 +1,396 @@
+package mcpproxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Route is an additional HTTP route, see Config.Routes.
+type Route struct {
+	// Pattern is the path to serve, as for http.ServeMux, optionally
+	// preceded by a method and a space, e.g. "POST /sse". A path can have
+	// routes for several methods, and a route without a method serves the
+	// methods that have none. Other methods are answered with 405 Method
+	// Not Allowed. A GET route also serves HEAD.
+	Pattern string
+
+	Handler http.HandlerFunc
+
+	// Auth requires the same authentication as the MCP endpoint, see
+	// AuthToken and Authenticator.
+	Auth bool
+
+	// CORS adds the CORS headers when EnableCORS is set and answers CORS
+	// preflight requests, as for the MCP endpoint.
+	CORS bool
+}
+
+// extraRoutes returns the routes from cfg.ExtraRoutes, which have no
+// middleware, followed by cfg.Routes.
+func extraRoutes(cfg Config) []Route {
+	patterns := make([]string, 0, len(cfg.ExtraRoutes))
+	for pattern := range cfg.ExtraRoutes {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+
+	routes := make([]Route, 0, len(patterns)+len(cfg.Routes))
+	for _, pattern := range patterns {
+		routes = append(routes, Route{Pattern: pattern, Handler: cfg.ExtraRoutes[pattern]})
+	}
+	return append(routes, cfg.Routes...)
+}
+
+// splitPattern splits a route pattern into its method, "" if it has none,
+// and path.
+func splitPattern(pattern string) (method, path string) {
+	if method, path, ok := strings.Cut(pattern, " "); ok {
+		return method, strings.TrimLeft(path, " ")
+	}
+	return "", pattern
+}
+
+// validateRoutes checks that the ExtraRoutes and Routes of cfg have valid
+// and distinct patterns.
+func validateRoutes(cfg Config) error {
+	seen := make(map[string]bool)
+	reserved := legacySSEPaths(cfg)
+	for _, route := range extraRoutes(cfg) {
+		method, path := splitPattern(route.Pattern)
+		if !strings.HasPrefix(path, "/") {
+			return fmt.Errorf("route %q: path must start with /", route.Pattern)
+		}
+		if method != strings.ToUpper(method) {
+			return fmt.Errorf("route %q: method must be upper case", route.Pattern)
+		}
+		if route.Handler == nil {
+			return fmt.Errorf("route %q has no handler", route.Pattern)
+		}
+		if contains(reserved, path) {
+			return fmt.Errorf("route %q conflicts with LegacySSECompat or DeprecateSSE", route.Pattern)
+		}
+		key := method + " " + path
+		if seen[key] {
+			return fmt.Errorf("route %q is registered twice", route.Pattern)
+		}
+		seen[key] = true
+	}
+	return nil
+}
+
+// routeMethods dispatches the requests for one path of the extra routes by
+// method.
+type routeMethods struct {
+	handlers map[string]http.HandlerFunc // "" for any other method
+	cors     bool                        // some route has CORS set
+}
+
+func (m *routeMethods) ServeHTTP(w http.ResponseWriter, r *http.Request, p *MCPProxy) {
+	h, ok := m.handlers[r.Method]
+	if !ok && r.Method == http.MethodHead {
+		h, ok = m.handlers[http.MethodGet]
+	}
+	if !ok {
+		h, ok = m.handlers[""]
+	}
+	if ok {
+		h(w, r)
+		return
+	}
+
+	if r.Method == http.MethodOptions && m.cors && p.dynamic.Load().EnableCORS {
+		setCORSHeaders(w)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	w.Header().Set("Allow", strings.Join(m.allowed(), ", "))
+	http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+}
+
+// allowed returns the methods m serves, for the Allow header.
+func (m *routeMethods) allowed() []string {
+	var methods []string
+	for method := range m.handlers {
+		methods = append(methods, method)
+		if method == http.MethodGet {
+			if _, ok := m.handlers[http.MethodHead]; !ok {
+				methods = append(methods, http.MethodHead)
+			}
+		}
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+// routeHandler wraps the handler of route in the middleware it asks for.
+func (p *MCPProxy) routeHandler(route Route) http.HandlerFunc {
+	h := route.Handler
+	if route.CORS {
+		next := h
+		h = func(w http.ResponseWriter, r *http.Request) {
+			if p.dynamic.Load().EnableCORS {
+				setCORSHeaders(w)
+				if r.Method == http.MethodOptions {
+					w.WriteHeader(http.StatusOK)
+					return
+				}
+			}
+			next(w, r)
+		}
+	}
+	if route.Auth {
+		h = p.authenticated(h)
+	}
+	return h
+}
+
+// setCORSHeaders adds the CORS headers sent when EnableCORS is set.
+func setCORSHeaders(w http.ResponseWriter) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, MCP-Protocol-Version, Mcp-Session-Id")
+}
+
+// Handler returns an http.Handler serving the MCP endpoint at "/" along with
+// the configured ExtraRoutes and Routes. Without a Config.BasePath, the MCP
+// endpoint is also served at legacyMCPPath. Other paths are answered with
+// 404 Not Found, after normalization, see Config.BasePath. Every request is
+// recorded in the access log.
+func (p *MCPProxy) Handler() http.Handler {
+	mux := http.NewServeMux()
+	routes := make(map[string]bool)
+
+	var paths []string
+	byPath := make(map[string]*routeMethods)
+	for _, route := range extraRoutes(p.config) {
+		p.log.Info("Registering extra route", "pattern", route.Pattern, "auth", route.Auth, "cors", route.CORS)
+		method, path := splitPattern(route.Pattern)
+		m, ok := byPath[path]
+		if !ok {
+			m = &routeMethods{handlers: make(map[string]http.HandlerFunc)}
+			byPath[path] = m
+			paths = append(paths, path)
+		}
+		m.handlers[method] = p.routeHandler(route)
+		m.cors = m.cors || route.CORS
+	}
+	for _, path := range paths {
+		m := byPath[path]
+		if h, ok := m.handlers[""]; ok && len(m.handlers) == 1 {
+			mux.HandleFunc(path, h)
+		} else {
+			mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) { m.ServeHTTP(w, r, p) })
+		}
+		routes[path] = true
+	}
+
+	if p.config.DeprecateSSE {
+		mux.HandleFunc(legacySSEPath, p.handleDeprecatedSSE)
+		routes[legacySSEPath] = true
+	}
+	if p.config.LegacySSECompat {
+		path := legacySSEPath
+		if p.config.DeprecateSSE {
+			path = movedLegacySSEPath
+		}
+		mux.HandleFunc(path, p.authenticated(p.handleLegacySSE))
+		routes[path] = true
+	}
+
+	if p.config.EnableMetrics {
+		mux.HandleFunc("/metrics", p.handleMetrics)
+		routes["/metrics"] = true
+	}
+
+	if p.config.ConfigFile != "" {
+		mux.HandleFunc("/admin/reload", p.authenticated(p.admin(p.handleReload)))
+		routes["/admin/reload"] = true
+	}
+
+	mux.HandleFunc("/admin/inflight", p.authenticated(p.admin(p.handleInflight)))
+	routes["/admin/inflight"] = true
+
+	mux.HandleFunc("/status", p.authenticated(p.handleStatus))
+	mux.HandleFunc("/healthz", p.handleHealthz)
+	mux.HandleFunc("/readyz", p.handleReadyz)
+	routes["/status"] = true
+	routes["/healthz"] = true
+	routes["/readyz"] = true
+
+	if p.config.EnableDebugEndpoints {
+		mux.HandleFunc("/debug/raw", p.authenticated(p.admin(p.handleDebugRaw)))
+		mux.HandleFunc("/debug/logs", p.authenticated(p.admin(p.handleDebugLogs)))
+		routes["/debug/raw"] = true
+		routes["/debug/logs"] = true
+	}
+
+	if p.config.EnableConfigEndpoint {
+		mux.HandleFunc("/config", p.authenticated(p.handleConfig))
+		routes["/config"] = true
+	}
+
+	if p.config.EnableOpenAPI {
+		mux.HandleFunc(openAPIPath, p.authenticated(p.handleOpenAPI))
+		routes[openAPIPath] = true
+	}
+
+	// Register the main handler. It only serves "/", the catch-all of the
+	// mux, and legacyMCPPath, so that unknown paths are not taken for the
+	// MCP endpoint.
+	mcp := p.authenticated(p.Handle)
+	legacy := p.config.BasePath == ""
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" && !(legacy && r.URL.Path == legacyMCPPath) {
+			p.handleNotFound(w, r)
+			return
+		}
+		mcp(w, r)
+	})
+
+	strict, base := p.config.StrictSlash, p.config.BasePath
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		r, id := withIdentity(r)
+		r, timing := withTiming(r)
+		rec := &statusRecorder{ResponseWriter: w}
+
+		w.Header().Set("X-MCP-Proxy", "mcpproxy/"+Version)
+		path := normalizePath(r.URL.Path, base)
+		if alt, ok := slashVariant(path, routes); ok && !strict {
+			path = alt
+		}
+		if path != r.URL.Path {
+			r2 := r.Clone(r.Context())
+			r2.URL.Path = path
+			r2.URL.RawPath = ""
+			r = r2
+		}
+		mux.ServeHTTP(rec, r)
+
+		kv := []interface{}{"identity", id.name, "remote", r.RemoteAddr, "method", r.Method, "path", r.URL.Path,
+			"status", rec.statusCode(), "duration", time.Since(start).Round(time.Millisecond)}
+		if timing.queueWait > 0 {
+			kv = append(kv, "queueWait", timing.queueWait.Round(time.Millisecond))
+		}
+		if timing.priority != "" {
+			kv = append(kv, "priority", timing.priority)
+		}
+		p.log.Info("Access", kv...)
+	})
+}
+
+// statusRecorder records the status code written through it for the
+// access log.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	if s.status == 0 {
+		s.status = code
+	}
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	return s.ResponseWriter.Write(b)
+}
+
+// Flush lets streaming handlers flush through the recorder.
+func (s *statusRecorder) Flush() {
+	if f, ok := s.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// FlushError is Flush reporting whether it failed, for
+// http.ResponseController.
+func (s *statusRecorder) FlushError() error {
+	return http.NewResponseController(s.ResponseWriter).Flush()
+}
+
+// Unwrap gives http.ResponseController access to the underlying writer.
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+func (s *statusRecorder) statusCode() int {
+	if s.status == 0 {
+		return http.StatusOK
+	}
+	return s.status
+}
+
+// legacyMCPPath is where clients and routers built for earlier versions,
+// which served the MCP endpoint at every path, still send MCP requests.
+const legacyMCPPath = "/mcp"
+
+// validateBasePath checks that cfg.BasePath, if set, is a path without a
+// trailing slash.
+func validateBasePath(cfg Config) error {
+	if cfg.BasePath != "" && (!strings.HasPrefix(cfg.BasePath, "/") || strings.HasSuffix(cfg.BasePath, "/")) {
+		return fmt.Errorf("invalid BasePath %q: must start with / and not end with one", cfg.BasePath)
+	}
+	return nil
+}
+
+// normalizePath returns the request path as routed, whatever gateway it
+// came through: runs of slashes collapse into one, "" is "/", and base,
+// the Config.BasePath, is stripped if path starts with it.
+func normalizePath(path, base string) string {
+	for strings.Contains(path, "//") {
+		path = strings.ReplaceAll(path, "//", "/")
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	if base != "" && (path == base || strings.HasPrefix(path, base+"/")) {
+		path = strings.TrimPrefix(path, base)
+		if path == "" {
+			path = "/"
+		}
+	}
+	return path
+}
+
+// handleNotFound answers requests to paths that are neither the MCP
+// endpoint nor any other route with 404 Not Found, telling clients where
+// the MCP endpoint is.
+func (p *MCPProxy) handleNotFound(w http.ResponseWriter, r *http.Request) {
+	p.log.Debug("Unknown path", "path", r.URL.Path, "method", r.Method, "remote", r.RemoteAddr)
+	endpoint := "/"
+	if p.config.BasePath != "" {
+		endpoint = p.config.BasePath
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusNotFound)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error":    "Not found: " + r.URL.Path,
+		"endpoint": endpoint,
+	})
+}
+
+// slashVariant returns path with its trailing slash added or removed when
+// only that variant is a registered route. This avoids both "/foo/" being
+// unknown for a "/foo" route and ServeMux answering "/foo" with a
+// redirect to "/foo/", which clients do not follow for POST.
+func slashVariant(path string, routes map[string]bool) (string, bool) {
+	if path == "/" || routes[path] {
+		return "", false
+	}
+	var alt string
+	if strings.HasSuffix(path, "/") {
+		alt = strings.TrimRight(path, "/")
+	} else {
+		alt = path + "/"
+	}
+	return alt, alt != "" && routes[alt]
+}
@@ -0,0 +1,218 @@
+package mcpproxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newRoutedProxy(t *testing.T, strict bool) http.Handler {
+	proxy := newFakeProxy(t, "reflect", Config{
+		StrictSlash: strict,
+		ExtraRoutes: map[string]http.HandlerFunc{
+			"/sse": func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusGone)
+			},
+			"/admin/": func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusTeapot)
+			},
+		},
+	})
+	return proxy.Handler()
+}
+
+func TestTrailingSlashInsensitiveRoutes(t *testing.T) {
+	handler := newRoutedProxy(t, false)
+
+	tests := []struct {
+		method string
+		path   string
+		status int
+	}{
+		{"GET", "/sse", http.StatusGone},
+		{"GET", "/sse/", http.StatusGone},
+		{"POST", "/sse//", http.StatusGone},
+		{"POST", "/admin", http.StatusTeapot},
+		{"GET", "/admin/", http.StatusTeapot},
+		{"GET", "/admin/sub", http.StatusTeapot},
+		{"GET", "/", http.StatusBadRequest}, // MCP endpoint without a body
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		if w.Code != tt.status {
+			t.Errorf("%s %s: expected status %d, got %d", tt.method, tt.path, tt.status, w.Code)
+		}
+	}
+}
+
+func TestStrictSlash(t *testing.T) {
+	handler := newRoutedProxy(t, true)
+
+	tests := []struct {
+		method string
+		path   string
+		status int
+	}{
+		{"GET", "/sse", http.StatusGone},
+		{"GET", "/sse/", http.StatusNotFound},
+		{"GET", "/admin", http.StatusMovedPermanently},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		if w.Code != tt.status {
+			t.Errorf("%s %s: expected status %d, got %d", tt.method, tt.path, tt.status, w.Code)
+		}
+	}
+}
+
+func TestMethodRoutes(t *testing.T) {
+	respond := func(status int) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(status) }
+	}
+	proxy := newFakeProxy(t, "reflect", Config{
+		AuthToken:  "s3cret",
+		EnableCORS: true,
+		ExtraRoutes: map[string]http.HandlerFunc{
+			"/legacy": respond(http.StatusGone),
+		},
+		Routes: []Route{
+			// Deprecation notices that differ by method
+			{Pattern: "GET /sse", Handler: respond(http.StatusOK)},
+			{Pattern: "POST /sse", Handler: respond(http.StatusGone)},
+			// An admin route behind the proxy's authentication
+			{Pattern: "POST /admin/flush", Handler: respond(http.StatusNoContent), Auth: true},
+			{Pattern: "/things", Handler: respond(http.StatusAccepted), CORS: true},
+		},
+	})
+	handler := proxy.Handler()
+
+	tests := []struct {
+		method string
+		path   string
+		token  string
+		status int
+		allow  string
+		cors   bool
+	}{
+		{"GET", "/legacy", "", http.StatusGone, "", false},
+		{"POST", "/legacy", "", http.StatusGone, "", false},
+		{"GET", "/sse", "", http.StatusOK, "", false},
+		{"HEAD", "/sse", "", http.StatusOK, "", false},
+		{"POST", "/sse/", "", http.StatusGone, "", false},
+		{"DELETE", "/sse", "", http.StatusMethodNotAllowed, "GET, HEAD, POST", false},
+		{"OPTIONS", "/sse", "", http.StatusMethodNotAllowed, "GET, HEAD, POST", false},
+		{"POST", "/admin/flush", "", http.StatusUnauthorized, "", false},
+		{"POST", "/admin/flush", "s3cret", http.StatusNoContent, "", false},
+		{"GET", "/admin/flush", "s3cret", http.StatusMethodNotAllowed, "POST", false},
+		{"GET", "/things", "", http.StatusAccepted, "", true},
+		{"OPTIONS", "/things", "", http.StatusOK, "", true},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		if tt.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		if w.Code != tt.status {
+			t.Errorf("%s %s: expected status %d, got %d", tt.method, tt.path, tt.status, w.Code)
+		}
+		if got := w.Header().Get("Allow"); got != tt.allow {
+			t.Errorf("%s %s: expected Allow %q, got %q", tt.method, tt.path, tt.allow, got)
+		}
+		if got := w.Header().Get("Access-Control-Allow-Origin") != ""; got != tt.cors {
+			t.Errorf("%s %s: expected CORS headers %v, got %v", tt.method, tt.path, tt.cors, got)
+		}
+	}
+}
+
+func TestInvalidRoutes(t *testing.T) {
+	h := func(w http.ResponseWriter, r *http.Request) {}
+	tests := []Config{
+		{Routes: []Route{{Pattern: "GET sse", Handler: h}}},
+		{Routes: []Route{{Pattern: "get /sse", Handler: h}}},
+		{Routes: []Route{{Pattern: "/sse"}}},
+		{
+			ExtraRoutes: map[string]http.HandlerFunc{"POST /sse": h},
+			Routes:      []Route{{Pattern: "POST  /sse", Handler: h}},
+		},
+	}
+	for _, cfg := range tests {
+		if err := validateRoutes(cfg); err == nil {
+			t.Errorf("Expected %+v to be rejected", cfg.Routes)
+		}
+	}
+}
+
+func TestPathNormalization(t *testing.T) {
+	handler := newFakeProxy(t, "reflect", Config{BasePath: "/mcp"}).Handler()
+
+	tests := []struct {
+		path   string
+		status int
+	}{
+		{"", http.StatusOK},
+		{"/", http.StatusOK},
+		{"//", http.StatusOK},
+		{"/mcp", http.StatusOK},
+		{"/mcp/", http.StatusOK},
+		{"//mcp", http.StatusOK},
+		{"/mcp//", http.StatusOK},
+		{"/healthz", http.StatusOK},
+		{"//healthz", http.StatusOK},
+		{"/mcp/healthz", http.StatusOK},
+		{"/mcp//healthz/", http.StatusOK},
+		{"/mcpx", http.StatusNotFound},
+		{"/mcp/mcp", http.StatusNotFound},
+		{"/unknown", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		method := "POST"
+		if strings.HasSuffix(strings.TrimRight(tt.path, "/"), "healthz") {
+			method = "GET"
+		}
+		req := httptest.NewRequest(method, "/", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"ping"}`))
+		req.URL.Path = tt.path
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		if w.Code != tt.status {
+			t.Errorf("%s %q: expected status %d, got %d %s", method, tt.path, tt.status, w.Code, w.Body.String())
+		}
+		if tt.status == http.StatusNotFound {
+			var body map[string]string
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body["endpoint"] != "/mcp" {
+				t.Errorf("%q: expected a JSON body pointing at the MCP endpoint, got %s", tt.path, w.Body.String())
+			}
+		}
+	}
+
+	if _, err := NewMCPProxy(Config{CommandPath: "true", BasePath: "/mcp/"}); err == nil {
+		t.Error("Expected a BasePath ending with a slash to be rejected")
+	}
+}
+
+func TestLegacyMCPPath(t *testing.T) {
+	handler := newFakeProxy(t, "reflect", Config{}).Handler()
+	for path, status := range map[string]int{"/mcp": http.StatusOK, "//mcp": http.StatusOK, "/mcp/x": http.StatusNotFound} {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"ping"}`))
+		req.URL.Path = path
+		handler.ServeHTTP(w, req)
+		if w.Code != status {
+			t.Errorf("%q: expected status %d, got %d %s", path, status, w.Code, w.Body.String())
+		}
+	}
+}
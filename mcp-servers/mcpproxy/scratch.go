@@ -0,0 +1,136 @@
+package mcpproxy
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// defaultScratchEnvVar is where the MCP server finds its scratch directory
+// unless Config.ScratchEnvVar says otherwise.
+const defaultScratchEnvVar = "MCP_SCRATCH_DIR"
+
+// scratchCheckInterval is how often the size of a scratch directory is
+// measured.
+var scratchCheckInterval = 30 * time.Second
+
+// scratchRemoveBackoff is how long a failed removal of a scratch directory
+// waits before the first retry; the wait doubles with each retry.
+var scratchRemoveBackoff = time.Second
+
+// scratchRemoveAttempts is how many times removing a scratch directory is
+// tried before giving up.
+const scratchRemoveAttempts = 5
+
+// scratchDir is the scratch directory of one MCP server process, see
+// Config.ScratchRoot.
+type scratchDir struct {
+	path  string
+	quota int64
+	size  atomic.Int64 // bytes at the last measurement
+	log   Logger
+}
+
+// newScratchDir creates a scratch directory under cfg.ScratchRoot, or
+// returns nil if it is not set.
+func newScratchDir(cfg Config, log Logger) (*scratchDir, error) {
+	if cfg.ScratchRoot == "" {
+		return nil, nil
+	}
+	root, err := ExpandPath(cfg.ScratchRoot)
+	if err != nil {
+		return nil, err
+	}
+	// The MCP server runs in the directory, so its path must not be relative
+	if root, err = filepath.Abs(root); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, err
+	}
+	path, err := os.MkdirTemp(root, "mcp-scratch-")
+	if err != nil {
+		return nil, err
+	}
+	log.Debug("Created scratch directory", "path", path)
+	return &scratchDir{path: path, quota: cfg.ScratchQuotaBytes, log: log}, nil
+}
+
+// bytes returns the size of s at its last measurement, or 0 if s is nil.
+func (s *scratchDir) bytes() int64 {
+	if s == nil {
+		return 0
+	}
+	return s.size.Load()
+}
+
+// watch measures s every scratchCheckInterval until done is closed, and
+// warns whenever it grows over its quota.
+func (s *scratchDir) watch(done <-chan struct{}) {
+	ticker := time.NewTicker(scratchCheckInterval)
+	defer ticker.Stop()
+	over := false
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+		size := dirSize(s.path)
+		s.size.Store(size)
+		if s.quota <= 0 {
+			continue
+		}
+		if size > s.quota && !over {
+			s.log.Warn("Scratch directory is over its quota", "path", s.path, "bytes", size, "quota", s.quota)
+		}
+		over = size > s.quota
+	}
+}
+
+// remove deletes s, retrying failures with a backoff.
+func (s *scratchDir) remove() {
+	delay := scratchRemoveBackoff
+	for attempt := 1; ; attempt++ {
+		err := os.RemoveAll(s.path)
+		if err == nil {
+			s.size.Store(0)
+			s.log.Debug("Removed scratch directory", "path", s.path)
+			return
+		}
+		if attempt == scratchRemoveAttempts {
+			s.log.Error("Failed to remove scratch directory, giving up", "path", s.path, "attempts", attempt, "error", err)
+			return
+		}
+		s.log.Warn("Failed to remove scratch directory, retrying", "path", s.path, "retryIn", delay, "error", err)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// dirSize returns the total size of the regular files under path. Files
+// that disappear while it is measured are skipped.
+func dirSize(path string) int64 {
+	var total int64
+	filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			total += info.Size()
+		}
+		return nil
+	})
+	return total
+}
+
+// validateScratch checks the scratch directory settings of cfg.
+func validateScratch(cfg Config) error {
+	if cfg.ScratchQuotaBytes < 0 {
+		return fmt.Errorf("ScratchQuotaBytes must not be negative, got %d", cfg.ScratchQuotaBytes)
+	}
+	return nil
+}
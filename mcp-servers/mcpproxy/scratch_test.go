@@ -0,0 +1,95 @@
+package mcpproxy
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// serverEnv returns the value of the environment variable name in the MCP
+// server of an "env" proxy.
+func serverEnv(t *testing.T, proxy *MCPProxy, name string) string {
+	t.Helper()
+	w := postJSON(proxy, `{"jsonrpc":"2.0","id":1,"method":"x","params":{"name":"`+name+`"}}`)
+	var resp struct {
+		Result struct {
+			Value string `json:"value"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Unexpected response %d %s", w.Code, w.Body.String())
+	}
+	return resp.Result.Value
+}
+
+func waitForRemoval(t *testing.T, path string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %s to be removed", path)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestScratchDir(t *testing.T) {
+	saved := scratchCheckInterval
+	scratchCheckInterval = 10 * time.Millisecond
+	t.Cleanup(func() { scratchCheckInterval = saved })
+
+	root := t.TempDir()
+	logs := &recordingLogger{}
+	proxy := newFakeProxy(t, "env", Config{ScratchRoot: root, ScratchQuotaBytes: 10, Logger: logs})
+
+	dir := serverEnv(t, proxy, defaultScratchEnvVar)
+	if filepath.Dir(dir) != root {
+		t.Fatalf("Expected a scratch directory under %s, got %q", root, dir)
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		t.Fatalf("Expected the scratch directory to exist: %v", err)
+	}
+	if pwd := serverEnv(t, proxy, "PWD"); pwd != dir {
+		t.Errorf("Expected the MCP server to run in %s, got %s", dir, pwd)
+	}
+
+	// Growing over the quota is reported
+	if err := os.WriteFile(filepath.Join(dir, "spool.txt"), make([]byte, 100), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	waitForLog(t, logs, "Scratch directory is over its quota")
+	if bytes := proxy.Status().ScratchBytes; bytes != 100 {
+		t.Errorf("Expected 100 scratch bytes at /status, got %d", bytes)
+	}
+
+	// A restarted MCP server gets a new directory and the old one is removed
+	if err := proxy.Restart("test"); err != nil {
+		t.Fatalf("Restart failed: %v", err)
+	}
+	waitForRemoval(t, dir)
+	next := serverEnv(t, proxy, defaultScratchEnvVar)
+	if next == dir || filepath.Dir(next) != root {
+		t.Errorf("Expected a new scratch directory under %s, got %q", root, next)
+	}
+
+	proxy.Close()
+	waitForRemoval(t, next)
+}
+
+func TestScratchEnvVar(t *testing.T) {
+	proxy := newFakeProxy(t, "env", Config{ScratchRoot: t.TempDir(), ScratchEnvVar: "SPOOL_DIR"})
+	if dir := serverEnv(t, proxy, "SPOOL_DIR"); dir == "" {
+		t.Error("Expected the scratch directory in SPOOL_DIR")
+	}
+
+	// Nothing is created by default
+	proxy = newFakeProxy(t, "env", Config{})
+	if dir := serverEnv(t, proxy, defaultScratchEnvVar); dir != "" {
+		t.Errorf("Expected no scratch directory by default, got %q", dir)
+	}
+}
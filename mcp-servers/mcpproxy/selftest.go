@@ -0,0 +1,165 @@
+package mcpproxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// selfTestProtocolVersion is the MCP protocol version SelfTest asks for.
+const selfTestProtocolVersion = "2025-03-26"
+
+// SelfTestOptions configures SelfTest.
+type SelfTestOptions struct {
+	// Timeout bounds the whole test, including starting the MCP server
+	// (default: 60s).
+	Timeout time.Duration
+
+	// Tool, if set, is called with Arguments after tools/list. It should
+	// be harmless, e.g. a ping or a trivial query.
+	Tool      string
+	Arguments json.RawMessage
+}
+
+// SelfTest starts the MCP server described by cfg without listening on any
+// port, checks that it answers initialize and tools/list, optionally calls
+// a tool, and writes a report to w. It returns an error if any step fails.
+func SelfTest(cfg Config, opts SelfTestOptions, w io.Writer) error {
+	if opts.Timeout <= 0 {
+		opts.Timeout = 60 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), opts.Timeout)
+	defer cancel()
+
+	fmt.Fprintf(w, "Self-test of %s (%s)\n", cfg.ServerName, VersionString())
+	report := func(step string, start time.Time, detail string, err error) error {
+		elapsed := time.Since(start).Round(time.Millisecond)
+		if err != nil {
+			fmt.Fprintf(w, "  %-12s FAIL  %v (%v)\nFAIL\n", step, err, elapsed)
+			return fmt.Errorf("%s: %w", step, err)
+		}
+		fmt.Fprintf(w, "  %-12s ok    %s (%v)\n", step, detail, elapsed)
+		return nil
+	}
+
+	start := time.Now()
+	proxy, err := NewMCPProxy(cfg)
+	if err != nil {
+		return report("start", start, "", err)
+	}
+	defer proxy.Close()
+	report("start", start, fmt.Sprintf("PID %d", proxy.Status().PID), nil)
+
+	start = time.Now()
+	var initResult struct {
+		ProtocolVersion string `json:"protocolVersion"`
+		ServerInfo      struct {
+			Name    string `json:"name"`
+			Version string `json:"version"`
+		} `json:"serverInfo"`
+	}
+	err = proxy.call(ctx, "initialize", map[string]interface{}{
+		"protocolVersion": selfTestProtocolVersion,
+		"capabilities":    map[string]interface{}{},
+		"clientInfo":      map[string]interface{}{"name": "mcpproxy-selftest", "version": Version},
+	}, &initResult)
+	if err == nil {
+		err = proxy.notify(ctx, "notifications/initialized")
+	}
+	if err := report("initialize", start, fmt.Sprintf("server %s %s, protocol %s",
+		initResult.ServerInfo.Name, initResult.ServerInfo.Version, initResult.ProtocolVersion), err); err != nil {
+		return err
+	}
+
+	start = time.Now()
+	var tools struct {
+		Tools []struct {
+			Name string `json:"name"`
+		} `json:"tools"`
+	}
+	err = proxy.call(ctx, "tools/list", map[string]interface{}{}, &tools)
+	if err := report("tools/list", start, fmt.Sprintf("%d tools", len(tools.Tools)), err); err != nil {
+		return err
+	}
+
+	if opts.Tool != "" {
+		start = time.Now()
+		args := opts.Arguments
+		if len(args) == 0 {
+			args = json.RawMessage("{}")
+		}
+		var result struct {
+			IsError bool `json:"isError"`
+		}
+		err = proxy.call(ctx, "tools/call", map[string]interface{}{"name": opts.Tool, "arguments": args}, &result)
+		if err == nil && result.IsError {
+			err = errors.New("tool returned an error result")
+		}
+		if err := report("tools/call", start, opts.Tool, err); err != nil {
+			return err
+		}
+	} else {
+		fmt.Fprintf(w, "  %-12s skip  no tool configured\n", "tools/call")
+	}
+
+	fmt.Fprintln(w, "PASS")
+	return nil
+}
+
+// call sends a JSON-RPC request straight to the MCP server, bypassing HTTP,
+// and decodes its result into result.
+func (p *MCPProxy) call(ctx context.Context, method string, params interface{}, result interface{}) error {
+	msg, err := json.Marshal(map[string]interface{}{"jsonrpc": "2.0", "id": method, "method": method, "params": params})
+	if err != nil {
+		return err
+	}
+	response, err := p.roundTrip(ctx, &request{msg: msg, method: method, isRequest: true, response: make(chan json.RawMessage, 1)})
+	if err != nil {
+		return err
+	}
+
+	var resp struct {
+		Result json.RawMessage `json:"result"`
+		Error  *RPCError       `json:"error"`
+	}
+	if err := json.Unmarshal(response, &resp); err != nil {
+		return fmt.Errorf("invalid response: %w", err)
+	}
+	if resp.Error != nil {
+		return resp.Error
+	}
+	return json.Unmarshal(resp.Result, result)
+}
+
+// notify sends a JSON-RPC notification straight to the MCP server.
+func (p *MCPProxy) notify(ctx context.Context, method string) error {
+	msg, _ := json.Marshal(map[string]interface{}{"jsonrpc": "2.0", "method": method})
+	_, err := p.roundTrip(ctx, &request{msg: msg, method: method, response: make(chan json.RawMessage, 1)})
+	return err
+}
+
+// roundTrip queues req and waits for its response, which is nil for
+// notifications.
+func (p *MCPProxy) roundTrip(ctx context.Context, req *request) (json.RawMessage, error) {
+	req.gone = ctx.Done()
+	if err := p.enqueue(req); err != nil {
+		return nil, err
+	}
+	select {
+	case response, ok := <-req.response:
+		if !ok && req.isRequest {
+			if req.err == nil {
+				return nil, errors.New("no response from MCP server")
+			}
+			return nil, req.err
+		}
+		p.buffered.release(len(response))
+		return response, req.err
+	case <-ctx.Done():
+		go p.discardResponse(req)
+		return nil, ctx.Err()
+	}
+}
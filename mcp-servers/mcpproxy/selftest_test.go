@@ -0,0 +1,46 @@
+package mcpproxy
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSelfTest(t *testing.T) {
+	var out strings.Builder
+	err := SelfTest(fakeConfig("mcp"), SelfTestOptions{Tool: "echo", Arguments: json.RawMessage(`{"x":1}`)}, &out)
+	if err != nil {
+		t.Fatalf("SelfTest failed: %v\n%s", err, out.String())
+	}
+	for _, want := range []string{"server fake 1.0, protocol 2025-03-26", "2 tools", "tools/call   ok    echo", "PASS"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected %q in report:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestSelfTestFailures(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+		opts SelfTestOptions
+		want string
+	}{
+		{"tool error result", fakeConfig("mcp"), SelfTestOptions{Tool: "fail"}, "tools/call: tool returned an error result"},
+		{"missing binary", Config{ServerName: "test", CommandPath: "/nonexistent"}, SelfTestOptions{}, "start:"},
+		{"timeout", fakeConfig("hang"), SelfTestOptions{Timeout: 100 * time.Millisecond}, "context deadline exceeded"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out strings.Builder
+			err := SelfTest(tt.cfg, tt.opts, &out)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Expected error containing %q, got %v\n%s", tt.want, err, out.String())
+			}
+			if !strings.HasSuffix(out.String(), "FAIL\n") {
+				t.Errorf("Expected report to end in FAIL:\n%s", out.String())
+			}
+		})
+	}
+}
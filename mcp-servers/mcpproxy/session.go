@@ -0,0 +1,181 @@
+package mcpproxy
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sync"
+)
+
+// sessionHeader carries the session id the proxy assigns in the response
+// to initialize, which clients send back on later requests, as of the
+// Streamable HTTP transport. See Config.EnableNotificationStream.
+const sessionHeader = "Mcp-Session-Id"
+
+// maxSessions bounds how many sessions are remembered. The oldest are
+// forgotten first, and their clients are then treated like clients that
+// send no session id.
+const maxSessions = 1024
+
+// session is what the proxy remembers about a client that initialized.
+type session struct {
+	// notifications is set if the client advertised that it handles
+	// messages from the server, see clientSession.
+	notifications bool
+}
+
+// sessionRegistry holds the sessions assigned to clients by id.
+type sessionRegistry struct {
+	mu    sync.Mutex
+	byID  map[string]*session
+	order []string // ids, oldest first
+}
+
+// add registers s and returns its new id, along with the id of the oldest
+// session if it was forgotten to make room.
+func (reg *sessionRegistry) add(s *session) (id, evicted string) {
+	id = newSessionID()
+
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	if reg.byID == nil {
+		reg.byID = make(map[string]*session)
+	}
+	// 128 random bits do not collide in practice, but a session must never
+	// be handed to a second client
+	for reg.byID[id] != nil {
+		id = newSessionID()
+	}
+	if len(reg.order) >= maxSessions {
+		evicted = reg.order[0]
+		delete(reg.byID, evicted)
+		reg.order = reg.order[1:]
+	}
+	reg.byID[id] = s
+	reg.order = append(reg.order, id)
+	return id, evicted
+}
+
+// remove forgets the session with the given id, reporting whether it was
+// known.
+func (reg *sessionRegistry) remove(id string) bool {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	if reg.byID[id] == nil {
+		return false
+	}
+	delete(reg.byID, id)
+	for i, other := range reg.order {
+		if other == id {
+			reg.order = append(reg.order[:i:i], reg.order[i+1:]...)
+			break
+		}
+	}
+	return true
+}
+
+// sessionIDBytes is how many random bytes a session id holds.
+const sessionIDBytes = 16
+
+// newSessionID returns a random session id, hex-encoded so that it is safe
+// in headers and URLs. Ids come from crypto/rand rather than a counter, so
+// that no client can guess another's session and take it over.
+func newSessionID() string {
+	var b [sessionIDBytes]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic("failed to generate a session id: " + err.Error())
+	}
+	return hex.EncodeToString(b[:])
+}
+
+// get returns the session with the given id, or nil if it is unknown.
+func (reg *sessionRegistry) get(id string) *session {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	return reg.byID[id]
+}
+
+// clientSession returns the session for an initialize request msg. MCP has
+// no capability for receiving notifications, so a client that declares any
+// capability, such as roots, sampling or elicitation, is taken for a full
+// MCP client that listens to the server. One that declares none only sends
+// requests and reads their responses, and gets no notifications.
+func clientSession(msg json.RawMessage) *session {
+	var req struct {
+		Params struct {
+			Capabilities map[string]json.RawMessage `json:"capabilities"`
+		} `json:"params"`
+	}
+	json.Unmarshal(msg, &req)
+	return &session{notifications: len(req.Params.Capabilities) > 0}
+}
+
+type sessionKey struct{}
+
+// withSession returns r carrying the session for its message msg if it is
+// an initialize request, for setSession to register once the MCP server
+// accepts it. The session travels with its own request, so concurrent
+// initialize requests, even when coalesced, each get their own. Sessions
+// are only assigned with EnableNotificationStream, the only feature they
+// serve.
+func (p *MCPProxy) withSession(r *http.Request, method string, msg json.RawMessage) *http.Request {
+	if method != "initialize" || !p.config.EnableNotificationStream {
+		return r
+	}
+	return r.WithContext(context.WithValue(r.Context(), sessionKey{}, clientSession(msg)))
+}
+
+// setSession registers the session of a successful initialize request and
+// sets its id in the response header.
+func (p *MCPProxy) setSession(w http.ResponseWriter, r *http.Request, method string, response json.RawMessage) {
+	s, ok := r.Context().Value(sessionKey{}).(*session)
+	if !ok || method != "initialize" {
+		return
+	}
+	var msg struct {
+		Result json.RawMessage `json:"result"`
+	}
+	if json.Unmarshal(response, &msg) != nil || msg.Result == nil {
+		return
+	}
+	id, evicted := p.sessions.add(s)
+	w.Header().Set(sessionHeader, id)
+	p.logFor(r).Info("Session started", "session", id, "notifications", s.notifications)
+	if evicted != "" && p.config.ShareSubscriptions {
+		// Not to hold up the response with unsubscribing the MCP server
+		go p.dropSubscriptions(evicted, "session forgotten for a newer one")
+	}
+}
+
+// endSession serves a DELETE of the MCP endpoint, by which a client ends
+// the session in its Mcp-Session-Id header, dropping its subscriptions.
+func (p *MCPProxy) endSession(w http.ResponseWriter, r *http.Request) {
+	id := r.Header.Get(sessionHeader)
+	if id == "" {
+		http.Error(w, "Missing "+sessionHeader+" header", http.StatusBadRequest)
+		return
+	}
+	if !p.sessions.remove(id) {
+		http.Error(w, "Unknown session", http.StatusNotFound)
+		return
+	}
+	p.logFor(r).Info("Session ended", "session", id)
+	if p.config.ShareSubscriptions {
+		p.dropSubscriptions(id, "session ended")
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// acceptsNotifications reports whether notifications may be streamed to
+// the client making r: clients without a session, or with one that is
+// forgotten, get them as before sessions existed.
+func (p *MCPProxy) acceptsNotifications(r *http.Request) bool {
+	id := r.Header.Get(sessionHeader)
+	if id == "" {
+		return true
+	}
+	s := p.sessions.get(id)
+	return s == nil || s.notifications
+}
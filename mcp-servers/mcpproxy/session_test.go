@@ -0,0 +1,81 @@
+package mcpproxy
+
+import (
+	"encoding/hex"
+	"sync"
+	"testing"
+)
+
+func TestNewSessionID(t *testing.T) {
+	const goroutines, perGoroutine = 8, 2000
+	ids := make(chan string, goroutines*perGoroutine)
+	var wg sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < perGoroutine; j++ {
+				ids <- newSessionID()
+			}
+		}()
+	}
+	wg.Wait()
+	close(ids)
+
+	seen := make(map[string]bool)
+	var ones, bits int
+	for id := range ids {
+		if seen[id] {
+			t.Fatalf("Session id %s generated twice", id)
+		}
+		seen[id] = true
+		b, err := hex.DecodeString(id)
+		if err != nil || len(b) != sessionIDBytes {
+			t.Fatalf("Expected %d hex-encoded bytes, got %q", sessionIDBytes, id)
+		}
+		for _, c := range b {
+			for ; c != 0; c &= c - 1 {
+				ones++
+			}
+		}
+		bits += 8 * len(b)
+	}
+
+	// Random bits are set about half of the time
+	if share := float64(ones) / float64(bits); share < 0.49 || share > 0.51 {
+		t.Errorf("Expected about half of the bits to be set, got %.3f", share)
+	}
+}
+
+func TestSessionRegistry(t *testing.T) {
+	var reg sessionRegistry
+	first, _ := reg.add(&session{notifications: true})
+	second, _ := reg.add(&session{})
+	if first == second || reg.get(first) == nil || !reg.get(first).notifications || reg.get(second) == nil {
+		t.Fatalf("Expected two distinct sessions, got %s and %s", first, second)
+	}
+	if reg.get("0") != nil {
+		t.Error("Expected an unknown id to have no session")
+	}
+
+	// The oldest sessions are forgotten first
+	var evicted []string
+	for i := 0; i < maxSessions-1; i++ {
+		if _, id := reg.add(&session{}); id != "" {
+			evicted = append(evicted, id)
+		}
+	}
+	if reg.get(first) != nil || len(reg.byID) != maxSessions {
+		t.Errorf("Expected the oldest session to be forgotten, with %d remembered", len(reg.byID))
+	}
+	if len(evicted) != 1 || evicted[0] != first {
+		t.Errorf("Expected the oldest session to be reported forgotten, got %v", evicted)
+	}
+
+	if !reg.remove(second) || reg.get(second) != nil || len(reg.order) != maxSessions-1 {
+		t.Error("Expected the session to be removed")
+	}
+	if reg.remove(second) {
+		t.Error("Expected a removed session to be unknown")
+	}
+}
@@ -0,0 +1,237 @@
+package mcpproxy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+var (
+	// standbyCheckInterval is how often the warm standby MCP server is
+	// pinged to check that it is still healthy.
+	standbyCheckInterval = 30 * time.Second
+
+	// standbyPingTimeout is how long a standby MCP server has to answer a
+	// ping, including the first one after it starts.
+	standbyPingTimeout = 2 * time.Minute
+)
+
+// standby holds the warm standby MCP server, see Config.WarmStandby. It is
+// kept by keepStandby, whose goroutine alone uses the pipes of the standby
+// until restart takes it over for processRequests.
+type standby struct {
+	mu      sync.Mutex
+	backend *backend // nil while none is ready
+	env     []string // the token environment backend was started with
+	pings   int      // numbers the ids of health checks
+
+	taken chan struct{} // signaled when restart takes the standby
+	done  chan struct{} // closed once keepStandby returns
+}
+
+// newStandby returns the standby holder for cfg, or nil if there is none.
+func newStandby(cfg Config) *standby {
+	if !cfg.WarmStandby {
+		return nil
+	}
+	return &standby{taken: make(chan struct{}, 1), done: make(chan struct{})}
+}
+
+// take removes the standby MCP server and returns it, or nil if none is
+// ready or s is nil. A standby started with a token other than env, the
+// current one, is stopped rather than returned.
+func (s *standby) take(env []string) *backend {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	b, stale := s.backend, !slices.Equal(s.env, env)
+	s.backend = nil
+	s.mu.Unlock()
+	if b == nil {
+		return nil
+	}
+	select {
+	case s.taken <- struct{}{}:
+	default:
+	}
+
+	select {
+	case <-b.exited:
+		return nil
+	default:
+	}
+	if stale {
+		go b.stop(closeGracePeriod)
+		return nil
+	}
+	return b
+}
+
+// put makes b, started with env, the standby MCP server.
+func (s *standby) put(b *backend, env []string) {
+	s.mu.Lock()
+	s.backend, s.env = b, env
+	s.mu.Unlock()
+}
+
+// remove removes b if it is still the standby MCP server, reporting
+// whether it was.
+func (s *standby) remove(b *backend) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.backend != b {
+		return false
+	}
+	s.backend = nil
+	return true
+}
+
+// pid returns the process id of the standby MCP server, 0 if there is none.
+func (s *standby) pid() int {
+	if s == nil {
+		return 0
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.backend == nil {
+		return 0
+	}
+	return s.backend.cmd.Process.Pid
+}
+
+// keepStandby keeps a warm standby MCP server ready once the first one has
+// started, replacing it whenever it is taken over, exits or fails its
+// health check, until the proxy is closed.
+func (p *MCPProxy) keepStandby() {
+	s := p.standby
+	defer close(s.done)
+	select {
+	case <-p.started:
+	case <-p.stopping:
+		return
+	}
+
+	delay := restartBackoff
+	for {
+		env := p.tokens.env()
+		b, err := p.warmStandby(env)
+		if err != nil {
+			p.log.Warn("Failed to start warm standby MCP server, retrying", "retryIn", delay, "error", err)
+			select {
+			case <-time.After(delay):
+			case <-p.stopping:
+				return
+			}
+			delay = min(delay*2, maxRestartBackoff)
+			continue
+		}
+		delay = restartBackoff
+		s.put(b, env)
+		if !p.watchStandby(b, env) {
+			return
+		}
+	}
+}
+
+// warmStandby starts a standby MCP server with env and waits until it
+// answers a ping.
+func (p *MCPProxy) warmStandby(env []string) (*backend, error) {
+	b, err := launchBackend(p.config, p.backendLogger(), debugLogger{p.log}, p.output, env)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.pingStandby(b); err != nil {
+		b.stop(0)
+		return nil, err
+	}
+	p.log.Info("Warm standby MCP server is ready", "pid", b.cmd.Process.Pid)
+	return b, nil
+}
+
+// watchStandby health-checks b, the standby MCP server started with env,
+// every standbyCheckInterval until it is taken over, exits or fails a
+// check, when another is to be started. It returns false once the proxy is
+// closing, having stopped b.
+func (p *MCPProxy) watchStandby(b *backend, env []string) bool {
+	s := p.standby
+	ticker := time.NewTicker(standbyCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stopping:
+			if s.remove(b) {
+				b.stop(closeGracePeriod)
+			}
+			return false
+		case <-s.taken:
+			if !s.remove(b) {
+				return true
+			}
+			// A signal left over from an earlier standby
+			s.put(b, env)
+		case <-b.exited:
+			if s.remove(b) {
+				p.log.Warn("Warm standby MCP server exited, starting another", "status", exitStatus(b.exitErr))
+			}
+			return true
+		case <-ticker.C:
+			// The standby is set aside during the check, so a restart
+			// meanwhile starts a new MCP server instead
+			if !s.remove(b) {
+				return true
+			}
+			if err := p.pingStandby(b); err != nil {
+				p.log.Warn("Warm standby MCP server failed its health check, replacing it", "pid", b.cmd.Process.Pid, "error", err)
+				b.stop(0)
+				return true
+			}
+			s.put(b, env)
+		}
+	}
+}
+
+// pingStandby sends a ping to b, a standby MCP server, and waits up to
+// standbyPingTimeout for the response. Anything else b writes meanwhile,
+// such as a banner, is skipped. b must be stopped if the ping fails, as it
+// may still be read from.
+func (p *MCPProxy) pingStandby(b *backend) error {
+	s := p.standby
+	s.mu.Lock()
+	s.pings++
+	id := fmt.Sprintf("mcp-proxy-standby-%d", s.pings)
+	s.mu.Unlock()
+
+	ping, _ := json.Marshal(map[string]interface{}{"jsonrpc": "2.0", "id": id, "method": "ping"})
+	result := make(chan error, 1)
+	go func() {
+		if err := b.writer.WriteFrame(ping); err != nil {
+			result <- err
+			return
+		}
+		for {
+			frame, err := b.stdout.ReadFrame()
+			if errors.Is(err, errMalformedFrame) {
+				continue
+			}
+			if err != nil {
+				result <- err
+				return
+			}
+			if env, ok := scanEnvelope(frame); ok && formatID(env.ID) == formatID(id) {
+				b.spoken = true
+				result <- nil
+				return
+			}
+		}
+	}()
+	select {
+	case err := <-result:
+		return err
+	case <-time.After(standbyPingTimeout):
+		return errors.New("no response to ping")
+	}
+}
@@ -0,0 +1,100 @@
+package mcpproxy
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+)
+
+// waitForStandby waits until proxy has a warm standby other than the one
+// with pid old, and returns its pid.
+func waitForStandby(t *testing.T, proxy *MCPProxy, old int) int {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		if pid := proxy.Status().StandbyPID; pid != 0 && pid != old {
+			return pid
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected a new warm standby, got %+v", proxy.Status())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// servedBy returns the pid of the "exit" MCP server that answers a request.
+func servedBy(t *testing.T, proxy *MCPProxy) int {
+	t.Helper()
+	w := postJSON(proxy, `{"jsonrpc":"2.0","id":1,"method":"x"}`)
+	var resp struct {
+		Result struct {
+			PID int `json:"pid"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Result.PID == 0 {
+		t.Fatalf("Unexpected response %d %s", w.Code, w.Body.String())
+	}
+	return resp.Result.PID
+}
+
+func TestWarmStandby(t *testing.T) {
+	// A cold restart would take longer than the test waits
+	saved := restartBackoff
+	restartBackoff = time.Minute
+	t.Cleanup(func() { restartBackoff = saved })
+
+	proxy := newFakeProxy(t, "exit", Config{
+		MaxRestarts:      5,
+		WarmStandby:      true,
+		ResponseCacheKey: func(string, json.RawMessage) (string, time.Duration) { return "", 0 },
+	})
+	standbyPID := waitForStandby(t, proxy, 0)
+	proxy.memo.put("key", json.RawMessage(`{}`), time.Now().Add(time.Hour))
+
+	// The MCP server dies in the middle of a call, and the standby answers
+	// the next one
+	w := postJSON(proxy, `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"exitCode":1}}`)
+	if rpcErrorOf(t, w) != -32002 {
+		t.Errorf("Expected the call to fail, got %d %s", w.Code, w.Body.String())
+	}
+	start := time.Now()
+	if pid := servedBy(t, proxy); pid != standbyPID {
+		t.Errorf("Expected the standby %d to take over, got %d", standbyPID, pid)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("Expected the standby to take over at once, took %v", d)
+	}
+	if proxy.memo.get("key", time.Now()) != nil {
+		t.Error("Expected the response cache to be cleared")
+	}
+
+	// Another standby is warmed for the next restart
+	next := waitForStandby(t, proxy, standbyPID)
+	if err := proxy.Restart("test"); err != nil {
+		t.Fatalf("Restart failed: %v", err)
+	}
+	if pid := servedBy(t, proxy); pid != next {
+		t.Errorf("Expected the standby %d to take over, got %d", next, pid)
+	}
+	if status := proxy.Status(); status.Restarts != 2 {
+		t.Errorf("Expected 2 restarts, got %+v", status)
+	}
+}
+
+func TestWarmStandbyReplaced(t *testing.T) {
+	saved := standbyCheckInterval
+	standbyCheckInterval = 20 * time.Millisecond
+	t.Cleanup(func() { standbyCheckInterval = saved })
+
+	proxy := newFakeProxy(t, "exit", Config{WarmStandby: true})
+	standbyPID := waitForStandby(t, proxy, 0)
+
+	// A standby that dies is replaced without disturbing the MCP server
+	process, _ := os.FindProcess(standbyPID)
+	process.Kill()
+	waitForStandby(t, proxy, standbyPID)
+	if status := proxy.Status(); status.Restarts != 0 || status.State != StateRunning {
+		t.Errorf("Expected the MCP server to keep running, got %+v", status)
+	}
+}
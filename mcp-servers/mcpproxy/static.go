@@ -0,0 +1,425 @@
+package mcpproxy
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"unicode/utf8"
+)
+
+// staticPromptPrefix namespaces the names of Config.StaticPrompts, so that
+// they do not collide with the prompts of the MCP server.
+const staticPromptPrefix = "proxy/"
+
+// staticResourceHost is the host of the URIs of Config.StaticResources,
+// e.g. proxy://static/runbooks/restart.md.
+const staticResourceHost = "static"
+
+// staticListMembers maps the list methods static content is merged into to
+// the result member listing the entries, and the member identifying them.
+var staticListMembers = map[string][2]string{
+	"prompts/list":   {"prompts", "name"},
+	"resources/list": {"resources", "uri"},
+}
+
+// promptFile is a prompt as read from the files of Config.StaticPrompts.
+type promptFile struct {
+	Name        string           `json:"name"`
+	Description string           `json:"description,omitempty"`
+	Arguments   []promptArgument `json:"arguments,omitempty"`
+
+	// Template is the text of the prompt, a Go text/template executed with
+	// the arguments of prompts/get by name, e.g. {{.service}}. Arguments
+	// the client leaves out are empty.
+	Template string `json:"template"`
+}
+
+// promptArgument is an argument of a promptFile.
+type promptArgument struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+}
+
+type staticPrompt struct {
+	promptFile
+	tmpl *template.Template
+}
+
+type staticResource struct {
+	uri      string
+	name     string
+	mimeType string
+	data     []byte
+}
+
+// staticContent holds the prompts and resources the proxy serves itself,
+// see Config.StaticPrompts and Config.StaticResources.
+type staticContent struct {
+	prompts   map[string]*staticPrompt   // by namespaced name
+	resources map[string]*staticResource // by URI
+
+	// entries are the list entries for the static content by list method,
+	// in the order they are appended.
+	entries map[string][]map[string]json.RawMessage
+
+	// conflicts holds the names and URIs of entries of the MCP server
+	// hidden by static ones, so that each is only logged once.
+	conflicts sync.Map
+}
+
+// loadStatic reads the files of cfg.StaticPrompts and cfg.StaticResources,
+// or returns nil if neither is set.
+func loadStatic(cfg Config) (*staticContent, error) {
+	if cfg.StaticPrompts == "" && cfg.StaticResources == "" {
+		return nil, nil
+	}
+	s := &staticContent{
+		prompts:   make(map[string]*staticPrompt),
+		resources: make(map[string]*staticResource),
+		entries:   make(map[string][]map[string]json.RawMessage),
+	}
+	if cfg.StaticPrompts != "" {
+		if err := s.loadPrompts(cfg.StaticPrompts); err != nil {
+			return nil, fmt.Errorf("StaticPrompts: %w", err)
+		}
+	}
+	if cfg.StaticResources != "" {
+		if err := s.loadResources(cfg.StaticResources); err != nil {
+			return nil, fmt.Errorf("StaticResources: %w", err)
+		}
+	}
+	return s, nil
+}
+
+// loadPrompts reads the prompts in path, a JSON file holding a prompt or an
+// array of prompts, or a directory of such files named *.json.
+func (s *staticContent) loadPrompts(path string) error {
+	files := []string{path}
+	if info, err := os.Stat(path); err != nil {
+		return err
+	} else if info.IsDir() {
+		if files, err = filepath.Glob(filepath.Join(escapeGlob(path), "*.json")); err != nil {
+			return err
+		}
+	}
+
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		var prompts []promptFile
+		data = bytes.TrimSpace(data)
+		if bytes.HasPrefix(data, []byte("[")) {
+			err = json.Unmarshal(data, &prompts)
+		} else {
+			prompts = make([]promptFile, 1)
+			err = json.Unmarshal(data, &prompts[0])
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		for _, prompt := range prompts {
+			if err := s.addPrompt(prompt); err != nil {
+				return fmt.Errorf("%s: %w", file, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (s *staticContent) addPrompt(prompt promptFile) error {
+	if prompt.Name == "" {
+		return errors.New("prompt without a name")
+	}
+	name := staticPromptPrefix + prompt.Name
+	if _, ok := s.prompts[name]; ok {
+		return fmt.Errorf("prompt %q is defined twice", prompt.Name)
+	}
+	for _, arg := range prompt.Arguments {
+		if arg.Name == "" {
+			return fmt.Errorf("prompt %q has an argument without a name", prompt.Name)
+		}
+	}
+	tmpl, err := template.New(name).Option("missingkey=zero").Parse(prompt.Template)
+	if err != nil {
+		return fmt.Errorf("prompt %q: %w", prompt.Name, err)
+	}
+
+	prompt.Name = name
+	s.prompts[name] = &staticPrompt{promptFile: prompt, tmpl: tmpl}
+	entry := map[string]json.RawMessage{"name": mustMarshal(name)}
+	if prompt.Description != "" {
+		entry["description"] = mustMarshal(prompt.Description)
+	}
+	if len(prompt.Arguments) > 0 {
+		entry["arguments"] = mustMarshal(prompt.Arguments)
+	}
+	s.entries["prompts/list"] = append(s.entries["prompts/list"], entry)
+	return nil
+}
+
+// loadResources reads the file path, or every file in the directory path
+// and its subdirectories, as resources named by their path relative to it.
+func (s *staticContent) loadResources(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return s.addResource(filepath.Base(path), path)
+	}
+	return filepath.WalkDir(path, func(file string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		rel, err := filepath.Rel(path, file)
+		if err != nil {
+			return err
+		}
+		return s.addResource(filepath.ToSlash(rel), file)
+	})
+}
+
+func (s *staticContent) addResource(name, file string) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	mimeType := mime.TypeByExtension(filepath.Ext(name))
+	if mimeType == "" {
+		mimeType = http.DetectContentType(data)
+	}
+	uri := (&url.URL{Scheme: "proxy", Host: staticResourceHost, Path: "/" + name}).String()
+	s.resources[uri] = &staticResource{uri: uri, name: name, mimeType: mimeType, data: data}
+	s.entries["resources/list"] = append(s.entries["resources/list"], map[string]json.RawMessage{
+		"uri":      mustMarshal(uri),
+		"name":     mustMarshal(name),
+		"mimeType": mustMarshal(mimeType),
+		"size":     mustMarshal(len(data)),
+	})
+	return nil
+}
+
+// merge adds the static entries to the response to a prompts/list or
+// resources/list request msg, on its first page, and drops the entries of
+// the MCP server that static ones hide. If the MCP server does not
+// implement the method, the response lists the static entries alone.
+// Other responses are returned unchanged.
+func (s *staticContent) merge(log Logger, method string, msg, response json.RawMessage) json.RawMessage {
+	members, ok := staticListMembers[method]
+	if !ok || len(s.entries[method]) == 0 {
+		return response
+	}
+	member, key := members[0], members[1]
+	firstPage := !hasCursor(msg)
+
+	var resp map[string]json.RawMessage
+	if json.Unmarshal(response, &resp) != nil {
+		return response
+	}
+	result := make(map[string]json.RawMessage)
+	if resp["result"] != nil {
+		if json.Unmarshal(resp["result"], &result) != nil {
+			return response
+		}
+	} else if code, ok := rpcErrorCode(response); !ok || code != -32601 || !firstPage {
+		return response
+	}
+	var items []map[string]json.RawMessage
+	if result[member] != nil && json.Unmarshal(result[member], &items) != nil {
+		return response
+	}
+
+	merged := make([]map[string]json.RawMessage, 0, len(items)+len(s.entries[method]))
+	for _, item := range items {
+		var id string
+		json.Unmarshal(item[key], &id)
+		if s.hides(id) {
+			if _, logged := s.conflicts.LoadOrStore(id, true); !logged {
+				log.Warn("Static entry conflicts with the MCP server's, hiding the server's", "method", method, key, id)
+			}
+			continue
+		}
+		merged = append(merged, item)
+	}
+	if firstPage {
+		merged = append(merged, s.entries[method]...)
+	}
+
+	delete(resp, "error")
+	result[member] = mustMarshal(merged)
+	resp["result"] = mustMarshal(result)
+	return mustMarshal(resp)
+}
+
+// hides reports whether a static prompt or resource has the name or URI id.
+func (s *staticContent) hides(id string) bool {
+	_, prompt := s.prompts[id]
+	_, resource := s.resources[id]
+	return prompt || resource
+}
+
+// advertise adds the prompts and resources capabilities for the static
+// content to the response to initialize, if the MCP server lacks them.
+func (s *staticContent) advertise(response json.RawMessage) json.RawMessage {
+	var resp struct {
+		Result map[string]json.RawMessage `json:"result"`
+	}
+	if json.Unmarshal(response, &resp) != nil || resp.Result == nil {
+		return response
+	}
+	capabilities := make(map[string]json.RawMessage)
+	if resp.Result["capabilities"] != nil && json.Unmarshal(resp.Result["capabilities"], &capabilities) != nil {
+		return response
+	}
+	changed := false
+	for capability, n := range map[string]int{"prompts": len(s.prompts), "resources": len(s.resources)} {
+		if n > 0 && capabilities[capability] == nil {
+			capabilities[capability] = json.RawMessage(`{}`)
+			changed = true
+		}
+	}
+	if !changed {
+		return response
+	}
+
+	var msg map[string]json.RawMessage
+	if json.Unmarshal(response, &msg) != nil {
+		return response
+	}
+	resp.Result["capabilities"] = mustMarshal(capabilities)
+	msg["result"] = mustMarshal(resp.Result)
+	return mustMarshal(msg)
+}
+
+// answer returns the response to a prompts/get or resources/read request
+// msg for static content, or nil if it is for the MCP server.
+func (s *staticContent) answer(method string, id interface{}, msg json.RawMessage) json.RawMessage {
+	var req struct {
+		Params struct {
+			Name      string            `json:"name"`
+			Arguments map[string]string `json:"arguments"`
+			URI       string            `json:"uri"`
+		} `json:"params"`
+	}
+	switch method {
+	case "prompts/get", "resources/read":
+	default:
+		return nil
+	}
+	if json.Unmarshal(msg, &req) != nil {
+		return nil
+	}
+
+	var result interface{}
+	switch method {
+	case "prompts/get":
+		prompt, ok := s.prompts[req.Params.Name]
+		if !ok {
+			return nil
+		}
+		text, err := prompt.render(req.Params.Arguments)
+		if err != nil {
+			return jsonRPCError(id, -32602, err.Error())
+		}
+		result = map[string]interface{}{
+			"description": prompt.Description,
+			"messages": []interface{}{map[string]interface{}{
+				"role":    "user",
+				"content": map[string]string{"type": "text", "text": text},
+			}},
+		}
+	case "resources/read":
+		resource, ok := s.resources[req.Params.URI]
+		if !ok {
+			return nil
+		}
+		content := map[string]string{"uri": resource.uri, "mimeType": resource.mimeType}
+		if utf8.Valid(resource.data) {
+			content["text"] = string(resource.data)
+		} else {
+			content["blob"] = base64.StdEncoding.EncodeToString(resource.data)
+		}
+		result = map[string]interface{}{"contents": []interface{}{content}}
+	}
+	return mustMarshal(map[string]interface{}{"jsonrpc": "2.0", "id": id, "result": result})
+}
+
+// render executes the template of p with args, which must include the
+// required arguments.
+func (p *staticPrompt) render(args map[string]string) (string, error) {
+	var missing []string
+	for _, arg := range p.Arguments {
+		if _, ok := args[arg.Name]; arg.Required && !ok {
+			missing = append(missing, arg.Name)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return "", fmt.Errorf("prompt %q: missing required arguments: %s", p.Name, strings.Join(missing, ", "))
+	}
+	var text strings.Builder
+	if err := p.tmpl.Execute(&text, args); err != nil {
+		return "", fmt.Errorf("prompt %q: %w", p.Name, err)
+	}
+	return text.String(), nil
+}
+
+// serveStatic answers a prompts/get or resources/read request for static
+// content, reporting whether it did. The response goes through
+// ResponseMiddleware like those of the MCP server.
+func (p *MCPProxy) serveStatic(w http.ResponseWriter, r *http.Request, dc *dynamicConfig, msg json.RawMessage, mcpMsg MCPMessage) bool {
+	if p.static == nil || !mcpMsg.HasID {
+		return false
+	}
+	response := p.static.answer(mcpMsg.Method, mcpMsg.ID, msg)
+	if response == nil {
+		return false
+	}
+	log := p.logFor(r)
+	log.Debug("Answering from static content", "method", mcpMsg.Method)
+	if mw := p.config.ResponseMiddleware; mw != nil {
+		if id := callMiddleware(log, "ResponseMiddleware", func() { response = mw(response) }); id != "" {
+			response = middlewareError(mcpMsg.ID, id)
+		} else {
+			response = p.checkMiddlewareResponse(log, "ResponseMiddleware", mcpMsg.ID, response)
+		}
+	}
+	p.writeResponse(w, r, mcpMsg.Method, response, dc.UnwrapSingleContent && wantsRawContent(r))
+	return true
+}
+
+// hasCursor reports whether the list request msg asks for a page after the
+// first one.
+func hasCursor(msg json.RawMessage) bool {
+	var req struct {
+		Params struct {
+			Cursor string `json:"cursor"`
+		} `json:"params"`
+	}
+	json.Unmarshal(msg, &req)
+	return req.Params.Cursor != ""
+}
+
+// mustMarshal encodes v, which can always be encoded.
+func mustMarshal(v interface{}) json.RawMessage {
+	data, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
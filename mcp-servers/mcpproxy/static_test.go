@@ -0,0 +1,135 @@
+package mcpproxy
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeStatic writes the files for StaticPrompts and StaticResources to a
+// temporary directory and returns their paths.
+func writeStatic(t *testing.T) (prompts, resources string) {
+	t.Helper()
+	dir := t.TempDir()
+	prompts = filepath.Join(dir, "prompts")
+	resources = filepath.Join(dir, "runbooks")
+	for name, content := range map[string]string{
+		"prompts/incident.json": `{
+			"name": "incident",
+			"description": "Standard incident analysis",
+			"arguments": [{"name": "service", "required": true}, {"name": "severity"}],
+			"template": "Analyze the incident on {{.service}}{{if .severity}} ({{.severity}}){{end}}."
+		}`,
+		"prompts/more.json":        `[{"name": "summary", "template": "Summarize."}]`,
+		"runbooks/restart.md":      "# Restart\n",
+		"runbooks/db/failover.txt": "Fail over.",
+	} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return prompts, resources
+}
+
+func TestStaticPrompts(t *testing.T) {
+	prompts, resources := writeStatic(t)
+	logs := &recordingLogger{}
+	proxy := newFakeProxy(t, "reflect", Config{StaticPrompts: prompts, StaticResources: resources, Logger: logs})
+
+	// The static prompts follow the MCP server's, hiding one with the
+	// same name
+	w := postJSON(proxy, `{"jsonrpc":"2.0","id":1,"method":"prompts/list","params":{"result":{"prompts":[{"name":"review"},{"name":"proxy/summary"}]}}}`)
+	var list struct {
+		Result struct {
+			Prompts []struct {
+				Name string `json:"name"`
+			} `json:"prompts"`
+		} `json:"result"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &list)
+	var names []string
+	for _, prompt := range list.Result.Prompts {
+		names = append(names, prompt.Name)
+	}
+	if got := strings.Join(names, ","); got != "review,proxy/incident,proxy/summary" {
+		t.Errorf("Expected the merged prompts, got %s", w.Body.String())
+	}
+	waitForLog(t, logs, "Static entry conflicts with the MCP server's, hiding the server's server=test method=prompts/list name=proxy/summary")
+
+	// Later pages are left alone
+	w = postJSON(proxy, `{"jsonrpc":"2.0","id":2,"method":"prompts/list","params":{"cursor":"2","result":{"prompts":[{"name":"other"}]}}}`)
+	if strings.Contains(w.Body.String(), "proxy/") {
+		t.Errorf("Expected no static prompts on the second page, got %s", w.Body.String())
+	}
+
+	w = postJSON(proxy, `{"jsonrpc":"2.0","id":3,"method":"prompts/get","params":{"name":"proxy/incident","arguments":{"service":"checkout"},"error":{"code":1,"message":"reached the MCP server"}}}`)
+	if !strings.Contains(w.Body.String(), `"text":"Analyze the incident on checkout."`) {
+		t.Errorf("Expected the rendered prompt, got %s", w.Body.String())
+	}
+	w = postJSON(proxy, `{"jsonrpc":"2.0","id":4,"method":"prompts/get","params":{"name":"proxy/incident","arguments":{"severity":"high"}}}`)
+	if code := rpcErrorOf(t, w); code != -32602 || !strings.Contains(w.Body.String(), "service") {
+		t.Errorf("Expected the missing argument to be rejected, got %s", w.Body.String())
+	}
+
+	// The capability is advertised even if the MCP server has none
+	w = postJSON(proxy, `{"jsonrpc":"2.0","id":5,"method":"initialize","params":{"result":{"capabilities":{"tools":{}}}}}`)
+	if !strings.Contains(w.Body.String(), `"prompts":{}`) || !strings.Contains(w.Body.String(), `"resources":{}`) {
+		t.Errorf("Expected the prompts and resources capabilities, got %s", w.Body.String())
+	}
+}
+
+func TestStaticResources(t *testing.T) {
+	_, resources := writeStatic(t)
+	proxy := newFakeProxy(t, "reflect", Config{StaticResources: resources})
+
+	// Without resources of its own, the MCP server only lists the static ones
+	w := postJSON(proxy, `{"jsonrpc":"2.0","id":1,"method":"resources/list","params":{"error":{"code":-32601,"message":"Method not found"}}}`)
+	for _, uri := range []string{"proxy://static/restart.md", "proxy://static/db/failover.txt"} {
+		if !strings.Contains(w.Body.String(), `"uri":"`+uri+`"`) {
+			t.Errorf("Expected %s to be listed, got %s", uri, w.Body.String())
+		}
+	}
+	if strings.Contains(w.Body.String(), "error") {
+		t.Errorf("Expected a result, got %s", w.Body.String())
+	}
+
+	w = postJSON(proxy, `{"jsonrpc":"2.0","id":2,"method":"resources/read","params":{"uri":"proxy://static/restart.md"}}`)
+	if !strings.Contains(w.Body.String(), `"text":"# Restart\n"`) || !strings.Contains(w.Body.String(), `"mimeType":"text/`) {
+		t.Errorf("Expected the runbook, got %s", w.Body.String())
+	}
+
+	// Other resources and prompts are the MCP server's
+	w = postJSON(proxy, `{"jsonrpc":"2.0","id":3,"method":"resources/read","params":{"uri":"file:///x","result":{"contents":[]}}}`)
+	if !strings.Contains(w.Body.String(), `"contents":[]`) {
+		t.Errorf("Expected the MCP server's answer, got %s", w.Body.String())
+	}
+	w = postJSON(proxy, `{"jsonrpc":"2.0","id":4,"method":"prompts/list","params":{"error":{"code":-32601,"message":"Method not found"}}}`)
+	if code := rpcErrorOf(t, w); code != -32601 {
+		t.Errorf("Expected the MCP server's error without static prompts, got %s", w.Body.String())
+	}
+}
+
+func TestLoadStaticErrors(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"unnamed.json":   `{"template": "x"}`,
+		"template.json":  `{"name": "x", "template": "{{.a"}`,
+		"twice.json":     `[{"name": "x"}, {"name": "x"}]`,
+		"arguments.json": `{"name": "x", "arguments": [{"description": "y"}]}`,
+	} {
+		path := filepath.Join(dir, name)
+		os.WriteFile(path, []byte(content), 0o644)
+		if _, err := loadStatic(Config{StaticPrompts: path}); err == nil {
+			t.Errorf("Expected %s to be rejected", name)
+		}
+	}
+	if _, err := loadStatic(Config{StaticResources: filepath.Join(dir, "missing")}); err == nil {
+		t.Error("Expected a missing StaticResources to be rejected")
+	}
+}
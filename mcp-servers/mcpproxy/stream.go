@@ -0,0 +1,89 @@
+package mcpproxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+)
+
+// streamPeekSize is how much of a large request body is read up front to
+// find its id and method before the rest is streamed.
+const streamPeekSize = 64 << 10
+
+// envelope holds the routing members of a JSON-RPC message found by
+// scanEnvelope.
+type envelope struct {
+	ID     interface{}
+	Method string
+	HasID  bool // see MCPMessage.HasID
+}
+
+// canStream reports whether request bodies may bypass buffering.
+func (p *MCPProxy) canStream(dc *dynamicConfig) bool {
+	if dc.StreamThreshold <= 0 {
+		return false
+	}
+	if p.config.RequestFilter != nil || len(p.config.MetaHeaders) > 0 || p.config.EnvironmentLabel != "" ||
+		p.config.ResponseCacheKey != nil || p.config.StrictParams || p.config.Framing == framingContentLength {
+		return false
+	}
+	if p.config.NormalizeIDType != "" && p.config.NormalizeIDType != idTypeNone {
+		return false
+	}
+	return p.config.RequestMiddleware == nil || p.config.RequestMiddlewareStreamingSafe
+}
+
+// peekBody reads up to streamPeekSize bytes from body. A short read is not
+// an error; the caller decides by the length whether more data may follow.
+func peekBody(body io.Reader) ([]byte, error) {
+	prefix := make([]byte, streamPeekSize)
+	n, err := io.ReadFull(body, prefix)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = nil
+	}
+	return prefix[:n], err
+}
+
+// scanEnvelope decodes the top-level members at the start of a JSON-RPC
+// object in prefix until it has seen both "id" and "method", or reaches a
+// member that does not fit in prefix (typically a large "params"). It
+// reports ok once the id member has been seen, since that is enough to tell
+// a request from a notification.
+func scanEnvelope(prefix []byte) (env envelope, ok bool) {
+	dec := json.NewDecoder(bytes.NewReader(prefix))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return env, false
+	}
+
+	var sawMethod bool
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return env, ok
+		}
+		key, _ := tok.(string)
+
+		switch key {
+		case "id":
+			if dec.Decode(&env.ID) != nil {
+				return env, false
+			}
+			env.HasID, ok = true, true
+		case "method":
+			if dec.Decode(&env.Method) != nil {
+				return env, ok
+			}
+			sawMethod = true
+		default:
+			var skip json.RawMessage
+			if dec.Decode(&skip) != nil {
+				return env, ok
+			}
+		}
+
+		if ok && sawMethod {
+			return env, true
+		}
+	}
+	return env, ok
+}
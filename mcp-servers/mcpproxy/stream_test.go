@@ -0,0 +1,222 @@
+package mcpproxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestScanEnvelope(t *testing.T) {
+	tests := []struct {
+		name   string
+		prefix string
+		ok     bool
+		id     interface{}
+		method string
+	}{
+		{"id first", `{"jsonrpc":"2.0","id":7,"method":"tools/call","params":{"data":"xx`, true, float64(7), "tools/call"},
+		{"method first", `{"method":"tools/call","id":"a","params":{"da`, true, "a", "tools/call"},
+		{"id after params", `{"jsonrpc":"2.0","method":"tools/call","params":{"data":"xx`, false, nil, "tools/call"},
+		{"null id", `{"jsonrpc":"2.0","id":null,"method":"x","params":[`, true, nil, "x"},
+		{"not an object", `["batch"`, false, nil, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env, ok := scanEnvelope([]byte(tt.prefix))
+			if ok != tt.ok {
+				t.Fatalf("scanEnvelope ok = %v, want %v", ok, tt.ok)
+			}
+			if env.ID != tt.id || env.Method != tt.method || env.HasID != tt.ok {
+				t.Errorf("scanEnvelope = %+v, want id %v method %q", env, tt.id, tt.method)
+			}
+		})
+	}
+}
+
+func TestNewlineStripper(t *testing.T) {
+	in := "{\n  \"id\": 1,\r\n  \"text\": \"a\\nb\"\n}"
+	out, _ := io.ReadAll(&newlineStripper{r: strings.NewReader(in)})
+
+	if strings.ContainsAny(string(out), "\r\n") {
+		t.Errorf("Expected no raw newlines, got %q", out)
+	}
+	var v map[string]interface{}
+	if err := json.Unmarshal(out, &v); err != nil || v["text"] != "a\nb" {
+		t.Errorf("Expected stripped JSON to keep escaped newlines, got %v (%v)", v, err)
+	}
+}
+
+// largeRequestBody returns a tools/call request of exactly size bytes
+// without materializing it in memory.
+func largeRequestBody(id, size int) io.Reader {
+	head := fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":"tools/call","params":{"name":"upload","arguments":{"data":"`, id)
+	tail := `"}}}`
+	filler := io.LimitReader(repeatReader('A'), int64(size-len(head)-len(tail)))
+	return io.MultiReader(strings.NewReader(head), filler, strings.NewReader(tail))
+}
+
+type repeatReader byte
+
+func (r repeatReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = byte(r)
+	}
+	return len(p), nil
+}
+
+func postLarge(proxy *MCPProxy, id, size int) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/", largeRequestBody(id, size))
+	req.ContentLength = int64(size)
+	w := httptest.NewRecorder()
+	proxy.Handle(w, req)
+	return w
+}
+
+func TestStreamLargeRequest(t *testing.T) {
+	proxy := newFakeProxy(t, "ack", Config{StreamThreshold: 1 << 20})
+
+	const size = 4 << 20
+	w := postLarge(proxy, 42, size)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var resp struct {
+		ID     int `json:"id"`
+		Result struct {
+			Size int `json:"size"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Invalid response %q: %v", w.Body.String(), err)
+	}
+	if resp.ID != 42 || resp.Result.Size != size {
+		t.Errorf("Expected backend to receive id 42 with %d bytes, got %+v", size, resp)
+	}
+
+	// Framing is intact for the next, buffered request
+	req := httptest.NewRequest("POST", "/", strings.NewReader(`{"jsonrpc":"2.0","id":43,"method":"ping"}`))
+	w = httptest.NewRecorder()
+	proxy.Handle(w, req)
+	if !strings.Contains(w.Body.String(), `"id":43`) {
+		t.Errorf("Expected response to follow-up request, got %q", w.Body.String())
+	}
+}
+
+func TestStreamMemoryIsFlat(t *testing.T) {
+	proxy := newFakeProxy(t, "ack", Config{StreamThreshold: 1 << 20, Logger: &recordingLogger{}})
+
+	for i, size := range []int{8 << 20, 32 << 20} {
+		var before, after runtime.MemStats
+		runtime.GC()
+		runtime.ReadMemStats(&before)
+
+		w := postLarge(proxy, i+1, size)
+
+		runtime.ReadMemStats(&after)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200 for %d bytes, got %d", size, w.Code)
+		}
+
+		allocated := after.TotalAlloc - before.TotalAlloc
+		t.Logf("%d byte body: %d bytes allocated", size, allocated)
+		if allocated > 2<<20 {
+			t.Errorf("Streaming %d bytes allocated %d bytes, expected flat usage", size, allocated)
+		}
+	}
+}
+
+func TestStreamRespectsMaxRequestBytes(t *testing.T) {
+	proxy := newFakeProxy(t, "ack", Config{
+		StreamThreshold: 1 << 20,
+		MaxRequestBytes: 2 << 20,
+	})
+
+	w := postLarge(proxy, 1, 4<<20)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("Expected status 413, got %d", w.Code)
+	}
+
+	// The truncated frame must not break the next request
+	req := httptest.NewRequest("POST", "/", strings.NewReader(`{"jsonrpc":"2.0","id":2,"method":"ping"}`))
+	w = httptest.NewRecorder()
+	proxy.Handle(w, req)
+	if !strings.Contains(w.Body.String(), `"id":2`) {
+		t.Errorf("Expected response to follow-up request, got %q", w.Body.String())
+	}
+}
+
+func TestStreamRejectsInvalidJSON(t *testing.T) {
+	proxy := newFakeProxy(t, "ack", Config{StreamThreshold: 1 << 20})
+
+	const size = 2 << 20
+	for name, body := range map[string]io.Reader{
+		// A raw newline inside the string, which WriteStream would have
+		// turned into a space
+		"control character": io.MultiReader(io.LimitReader(largeRequestBody(1, size), size-100), strings.NewReader("\n\"}}}")),
+		"cut short":         io.LimitReader(largeRequestBody(1, size), size-1),
+		// Rejected the same way when buffered
+		"small": strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":`),
+	} {
+		req := httptest.NewRequest("POST", "/", body)
+		req.ContentLength = -1
+		w := httptest.NewRecorder()
+		proxy.Handle(w, req)
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), `"code":-32700`) {
+			t.Errorf("%s: expected status 400 with a parse error, got %d %s", name, w.Code, w.Body.String())
+		}
+	}
+
+	// The invalid frames must not break the next request
+	w := postJSON(proxy, `{"jsonrpc":"2.0","id":3,"method":"ping"}`)
+	if !strings.Contains(w.Body.String(), `"id":3`) {
+		t.Errorf("Expected response to follow-up request, got %q", w.Body.String())
+	}
+
+	// As when buffered, what follows the message is ignored
+	req := httptest.NewRequest("POST", "/", io.MultiReader(largeRequestBody(4, size), strings.NewReader(`{"id":5}`)))
+	req.ContentLength = -1
+	w = httptest.NewRecorder()
+	proxy.Handle(w, req)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"id":4`) || !strings.Contains(w.Body.String(), `"size":2097152`) {
+		t.Errorf("Expected the message before the trailing data to be answered, got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestStreamFallsBackToBuffering(t *testing.T) {
+	middlewareCalls := 0
+	proxy := newFakeProxy(t, "ack", Config{
+		StreamThreshold: 1 << 10,
+		RequestMiddleware: func(msg []byte) []byte {
+			middlewareCalls++
+			return msg
+		},
+	})
+
+	w := postLarge(proxy, 5, 256<<10)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	if middlewareCalls != 1 {
+		t.Errorf("Expected RequestMiddleware to force buffering and run once, ran %d times", middlewareCalls)
+	}
+}
+
+func TestMaxRequestBytesBuffered(t *testing.T) {
+	proxy := newFakeProxy(t, "ack", Config{MaxRequestBytes: 64})
+
+	body := `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"data":"` + strings.Repeat("x", 100) + `"}}`
+	req := httptest.NewRequest("POST", "/", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	proxy.Handle(w, req)
+
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status 413, got %d", w.Code)
+	}
+}
@@ -0,0 +1,41 @@
+package mcpproxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+)
+
+// isStringBody reports whether the request body msg is a JSON string
+// rather than a JSON-RPC message.
+func isStringBody(msg json.RawMessage) bool {
+	msg = bytes.TrimSpace(msg)
+	return len(msg) > 0 && msg[0] == '"'
+}
+
+// unwrapStringBody returns the JSON-RPC message held by the string body
+// msg, which a client encoded twice, see Config.DisableUnwrapStringBodies.
+// Only one level is unwrapped, and the message must be a JSON object
+// within MaxRequestBytes. Otherwise the request is rejected on w and ok is
+// false.
+func (p *MCPProxy) unwrapStringBody(w http.ResponseWriter, r *http.Request, dc *dynamicConfig, msg json.RawMessage) (json.RawMessage, bool) {
+	var s string
+	json.Unmarshal(msg, &s)
+	inner := bytes.TrimSpace([]byte(s))
+
+	if p.config.DisableUnwrapStringBodies || len(inner) == 0 || inner[0] != '{' || !json.Valid(inner) {
+		p.log.Warn("Rejecting request body that is a JSON string", "identity", identity(r), "remote", r.RemoteAddr, "userAgent", r.UserAgent())
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(jsonRPCError(nil, -32600, "Invalid Request: the body is a JSON string, expected a JSON-RPC message"))
+		return nil, false
+	}
+	if dc.MaxRequestBytes > 0 && int64(len(inner)) > dc.MaxRequestBytes {
+		p.rejectBody(w, &http.MaxBytesError{Limit: dc.MaxRequestBytes})
+		return nil, false
+	}
+
+	p.log.Warn("Unwrapping request body encoded as a JSON string, the client encodes its messages twice",
+		"identity", identity(r), "remote", r.RemoteAddr, "userAgent", r.UserAgent())
+	return json.RawMessage(inner), true
+}
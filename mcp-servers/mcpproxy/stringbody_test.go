@@ -0,0 +1,55 @@
+package mcpproxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestUnwrapStringBodies(t *testing.T) {
+	logs := &recordingLogger{}
+	proxy := newFakeProxy(t, "ack", Config{MaxRequestBytes: 200, Logger: logs})
+	message := `{"jsonrpc":"2.0","id":1,"method":"ping"}`
+	wrapped, _ := json.Marshal(message)
+
+	// A message encoded twice is handled like the message
+	w := postJSON(proxy, string(wrapped))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"size":`+strconv.Itoa(len(message))) {
+		t.Errorf("Expected the unwrapped message to be forwarded, got %d %s", w.Code, w.Body.String())
+	}
+	waitForLog(t, logs, "Unwrapping request body encoded as a JSON string")
+
+	// Normal objects are left alone
+	w = postJSON(proxy, message)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"size":`+strconv.Itoa(len(message))) {
+		t.Errorf("Expected the message to be forwarded, got %d %s", w.Code, w.Body.String())
+	}
+
+	// Strings holding anything but a JSON object are rejected, and only one
+	// level is unwrapped
+	twice, _ := json.Marshal(string(wrapped))
+	for _, body := range []string{`"hello"`, `"{not json"`, `"[1]"`, string(twice)} {
+		w = postJSON(proxy, body)
+		if w.Code != http.StatusBadRequest || rpcErrorOf(t, w) != -32600 {
+			t.Errorf("Expected %s to be rejected, got %d %s", body, w.Code, w.Body.String())
+		}
+	}
+
+	// The size limit applies to the message
+	large, _ := json.Marshal(`{"jsonrpc":"2.0","id":2,"method":"ping","params":{"data":"` + strings.Repeat("x", 180) + `"}}`)
+	w = postJSON(proxy, string(large))
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413 for a message over the limit, got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestDisableUnwrapStringBodies(t *testing.T) {
+	proxy := newFakeProxy(t, "ack", Config{DisableUnwrapStringBodies: true})
+	wrapped, _ := json.Marshal(`{"jsonrpc":"2.0","id":1,"method":"ping"}`)
+	w := postJSON(proxy, string(wrapped))
+	if w.Code != http.StatusBadRequest || rpcErrorOf(t, w) != -32600 {
+		t.Errorf("Expected the wrapped message to be rejected, got %d %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,383 @@
+package mcpproxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// subscriptionGrace is how long the subscriptions of a session outlive its
+// last notification stream, so that a client reconnecting keeps them. See
+// Config.ShareSubscriptions.
+var subscriptionGrace = time.Minute
+
+// validateShareSubscriptions checks that cfg.ShareSubscriptions has the
+// notification streams it delivers updates on.
+func validateShareSubscriptions(cfg Config) error {
+	if cfg.ShareSubscriptions && !cfg.EnableNotificationStream {
+		return errors.New("ShareSubscriptions requires EnableNotificationStream")
+	}
+	return nil
+}
+
+// subscriptionRegistry holds the resources clients subscribed to by
+// session, see Config.ShareSubscriptions. The MCP server is subscribed to
+// every URI with at least one subscriber. Clients without a session id
+// share the session "".
+type subscriptionRegistry struct {
+	mu        sync.Mutex
+	byURI     map[string]map[string]bool // sessions by URI
+	bySession map[string]map[string]bool // URIs by session
+
+	// streams counts the open notification streams of each session, and
+	// expiries calls expire with the sessions that subscribed but have had
+	// none for subscriptionGrace.
+	streams  map[string]int
+	expiries map[string]*time.Timer
+	expire   func(session string)
+
+	// changing serializes the changes to the subscription of the MCP
+	// server to each URI, see lock.
+	changing map[string]*uriLock
+}
+
+// uriLock is held while the subscription of the MCP server to a URI is
+// decided and changed. waiters counts the holder and those waiting for it.
+type uriLock struct {
+	mu      sync.Mutex
+	waiters int
+}
+
+// lock serializes changes to the subscription to uri, so that a subscribe
+// and an unsubscribe reach the MCP server in the order they were decided
+// in. The returned function releases it.
+func (reg *subscriptionRegistry) lock(uri string) (unlock func()) {
+	reg.mu.Lock()
+	if reg.changing == nil {
+		reg.changing = make(map[string]*uriLock)
+	}
+	l := reg.changing[uri]
+	if l == nil {
+		l = &uriLock{}
+		reg.changing[uri] = l
+	}
+	l.waiters++
+	reg.mu.Unlock()
+
+	l.mu.Lock()
+	return func() {
+		l.mu.Unlock()
+		reg.mu.Lock()
+		if l.waiters--; l.waiters == 0 {
+			delete(reg.changing, uri)
+		}
+		reg.mu.Unlock()
+	}
+}
+
+// subscribed reports whether the MCP server is subscribed to uri.
+func (reg *subscriptionRegistry) subscribed(uri string) bool {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	return len(reg.byURI[uri]) > 0
+}
+
+// has reports whether session subscribed to uri.
+func (reg *subscriptionRegistry) has(session, uri string) bool {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	return reg.byURI[uri][session]
+}
+
+func (reg *subscriptionRegistry) add(session, uri string) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	if reg.byURI == nil {
+		reg.byURI = make(map[string]map[string]bool)
+		reg.bySession = make(map[string]map[string]bool)
+	}
+	if reg.byURI[uri] == nil {
+		reg.byURI[uri] = make(map[string]bool)
+	}
+	if reg.bySession[session] == nil {
+		reg.bySession[session] = make(map[string]bool)
+	}
+	reg.byURI[uri][session] = true
+	reg.bySession[session][uri] = true
+	// A client may subscribe before it opens its stream, but one that
+	// never does is gone
+	if reg.streams[session] == 0 {
+		reg.startExpiryLocked(session)
+	}
+}
+
+// remove drops the subscription of session to uri, reporting whether it
+// was the last one, so that the MCP server must be unsubscribed.
+func (reg *subscriptionRegistry) remove(session, uri string) bool {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	return reg.removeLocked(session, uri)
+}
+
+func (reg *subscriptionRegistry) removeLocked(session, uri string) bool {
+	delete(reg.byURI[uri], session)
+	delete(reg.bySession[session], uri)
+	if len(reg.bySession[session]) == 0 {
+		delete(reg.bySession, session)
+	}
+	if len(reg.byURI[uri]) > 0 {
+		return false
+	}
+	delete(reg.byURI, uri)
+	return true
+}
+
+// drop removes every subscription of session and returns the URIs left
+// without subscribers.
+func (reg *subscriptionRegistry) drop(session string) []string {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	if timer, ok := reg.expiries[session]; ok {
+		timer.Stop()
+		delete(reg.expiries, session)
+	}
+	var last []string
+	for uri := range reg.bySession[session] {
+		if reg.removeLocked(session, uri) {
+			last = append(last, uri)
+		}
+	}
+	sort.Strings(last)
+	return last
+}
+
+// uris returns the URIs the MCP server is subscribed to.
+func (reg *subscriptionRegistry) uris() []string {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	uris := make([]string, 0, len(reg.byURI))
+	for uri := range reg.byURI {
+		uris = append(uris, uri)
+	}
+	sort.Strings(uris)
+	return uris
+}
+
+// clear forgets every subscription.
+func (reg *subscriptionRegistry) clear() {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	reg.byURI = nil
+	reg.bySession = nil
+}
+
+// streamOpened notes a notification stream opened by session, keeping its
+// subscriptions.
+func (reg *subscriptionRegistry) streamOpened(session string) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	if reg.streams == nil {
+		reg.streams = make(map[string]int)
+	}
+	reg.streams[session]++
+	if timer, ok := reg.expiries[session]; ok {
+		timer.Stop()
+		delete(reg.expiries, session)
+	}
+}
+
+// streamClosed notes that a notification stream of session closed. Once
+// it has had none for subscriptionGrace, its subscriptions expire.
+func (reg *subscriptionRegistry) streamClosed(session string) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	reg.streams[session]--
+	if reg.streams[session] > 0 {
+		return
+	}
+	delete(reg.streams, session)
+	reg.startExpiryLocked(session)
+}
+
+// startExpiryLocked calls expire with session once it has had no
+// notification stream for subscriptionGrace, unless it is already due to
+// expire. reg.mu must be held.
+func (reg *subscriptionRegistry) startExpiryLocked(session string) {
+	if _, ok := reg.expiries[session]; ok || reg.expire == nil {
+		return
+	}
+	if reg.expiries == nil {
+		reg.expiries = make(map[string]*time.Timer)
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(subscriptionGrace, func() {
+		reg.mu.Lock()
+		if reg.expiries[session] != timer || reg.streams[session] > 0 {
+			reg.mu.Unlock()
+			return
+		}
+		delete(reg.expiries, session)
+		reg.mu.Unlock()
+		reg.expire(session)
+	})
+	reg.expiries[session] = timer
+}
+
+// subscriptionChange is a subscription forwarded to the MCP server, for
+// subscribed to record once it succeeds.
+type subscriptionChange struct {
+	session string
+	uri     string
+}
+
+type subscriptionKey struct{}
+
+// shareSubscription answers the resources/subscribe and
+// resources/unsubscribe requests msg with Config.ShareSubscriptions,
+// reporting whether it did. A subscribe to a URI the MCP server is not
+// subscribed to yet is forwarded, with r carrying the change for subscribed
+// to record, as is the unsubscribe of its last subscriber; the others are
+// answered by the proxy. Changes to the subscription to a URI are decided
+// and forwarded one at a time.
+func (p *MCPProxy) shareSubscription(w http.ResponseWriter, r *http.Request, msg json.RawMessage, mcpMsg MCPMessage) bool {
+	if !p.config.ShareSubscriptions || !mcpMsg.HasID {
+		return false
+	}
+	if mcpMsg.Method != "resources/subscribe" && mcpMsg.Method != "resources/unsubscribe" {
+		return false
+	}
+	var req struct {
+		Params struct {
+			URI string `json:"uri"`
+		} `json:"params"`
+	}
+	if json.Unmarshal(msg, &req) != nil || req.Params.URI == "" {
+		return false
+	}
+	uri, session := req.Params.URI, r.Header.Get(sessionHeader)
+	log := p.logFor(r)
+	defer p.subscriptions.lock(uri)()
+
+	forward := false
+	switch mcpMsg.Method {
+	case "resources/subscribe":
+		if !p.subscriptions.subscribed(uri) {
+			r = r.WithContext(context.WithValue(r.Context(), subscriptionKey{}, &subscriptionChange{session: session, uri: uri}))
+			forward = true
+			break
+		}
+		p.subscriptions.add(session, uri)
+		log.Debug("Sharing the subscription of the MCP server", "uri", uri, "session", session)
+	case "resources/unsubscribe":
+		switch {
+		case !p.subscriptions.has(session, uri):
+			forward = true
+		case p.subscriptions.remove(session, uri):
+			log.Debug("Unsubscribing the MCP server, the last subscriber left", "uri", uri, "session", session)
+			forward = true
+		default:
+			log.Debug("Keeping the subscription of the MCP server for other clients", "uri", uri, "session", session)
+		}
+	}
+	if forward {
+		p.forward(w, r, &request{msg: msg, method: mcpMsg.Method, isRequest: true, response: make(chan json.RawMessage, 1)})
+		return true
+	}
+	response, _ := json.Marshal(map[string]interface{}{"jsonrpc": "2.0", "id": mcpMsg.ID, "result": struct{}{}})
+	p.writeResponse(w, r, mcpMsg.Method, response, false)
+	return true
+}
+
+// subscribed records the subscription r carries once the MCP server
+// accepted it.
+func (p *MCPProxy) subscribed(r *http.Request, response json.RawMessage) {
+	change, ok := r.Context().Value(subscriptionKey{}).(*subscriptionChange)
+	if !ok {
+		return
+	}
+	if _, failed := rpcErrorCode(response); failed {
+		return
+	}
+	p.subscriptions.add(change.session, change.uri)
+	p.logFor(r).Info("Subscribed the MCP server to a resource", "uri", change.uri, "session", change.session)
+}
+
+// subscriber returns a function reporting whether the stream of a session
+// is to receive the notification msg: notifications/resources/updated only
+// go to the sessions subscribed to the resource, everything else to all.
+// It returns nil for all.
+func (p *MCPProxy) subscriber(msg json.RawMessage) func(session string) bool {
+	var n struct {
+		Method string `json:"method"`
+		Params struct {
+			URI string `json:"uri"`
+		} `json:"params"`
+	}
+	if json.Unmarshal(msg, &n) != nil || n.Method != "notifications/resources/updated" {
+		return nil
+	}
+	return func(session string) bool { return p.subscriptions.has(session, n.Params.URI) }
+}
+
+// dropSubscriptions drops the subscriptions of session, which is gone for
+// the given reason, unsubscribing the MCP server from the URIs it was the
+// last subscriber to.
+func (p *MCPProxy) dropSubscriptions(session, reason string) {
+	uris := p.subscriptions.drop(session)
+	if len(uris) == 0 {
+		return
+	}
+	p.log.Info("Dropping the subscriptions of a session", "session", session, "reason", reason, "uris", uris)
+	p.unsubscribe(uris)
+}
+
+// expireSubscriptions drops the subscriptions of session, which has had no
+// notification stream for subscriptionGrace.
+func (p *MCPProxy) expireSubscriptions(session string) {
+	p.dropSubscriptions(session, "no notification stream")
+}
+
+// unsubscribe unsubscribes the MCP server from uris, unless a client
+// subscribed to them again meanwhile.
+func (p *MCPProxy) unsubscribe(uris []string) {
+	for _, uri := range uris {
+		unlock := p.subscriptions.lock(uri)
+		if !p.subscriptions.subscribed(uri) {
+			if err := p.call(context.Background(), "resources/unsubscribe", map[string]string{"uri": uri}, new(json.RawMessage)); err != nil {
+				p.log.Warn("Failed to unsubscribe the MCP server", "uri", uri, "error", err)
+			}
+		}
+		unlock()
+	}
+}
+
+// resubscribe subscribes a restarted MCP server to the resources clients
+// are subscribed to. With ReplayInitialize the subscribes follow the
+// replayed handshake; without it the MCP server cannot take them before a
+// client initializes it again, so the subscriptions are forgotten and
+// clients must subscribe again.
+func (p *MCPProxy) resubscribe() {
+	uris := p.subscriptions.uris()
+	if len(uris) == 0 {
+		return
+	}
+	if !p.config.ReplayInitialize {
+		p.log.Warn("Forgetting resource subscriptions, the restarted MCP server is not initialized", "uris", uris)
+		p.subscriptions.clear()
+		return
+	}
+	for _, uri := range uris {
+		unlock := p.subscriptions.lock(uri)
+		err := p.call(context.Background(), "resources/subscribe", map[string]string{"uri": uri}, new(json.RawMessage))
+		unlock()
+		if err != nil {
+			p.log.Warn("Failed to subscribe the restarted MCP server", "uri", uri, "error", err)
+			continue
+		}
+		p.log.Info("Subscribed the restarted MCP server to a resource", "uri", uri)
+	}
+}
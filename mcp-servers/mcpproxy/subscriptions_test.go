@@ -0,0 +1,252 @@
+package mcpproxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const subscribedURI = "file:///runbook.md"
+
+// postSession posts body to proxy as the client with the given session id.
+func postSession(proxy *MCPProxy, session, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(sessionHeader, session)
+	w := httptest.NewRecorder()
+	proxy.Handle(w, req)
+	return w
+}
+
+// startSession initializes a client that takes notifications and returns
+// its session id.
+func startSession(t *testing.T, proxy *MCPProxy) string {
+	t.Helper()
+	w := postJSON(proxy, `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"capabilities":{"roots":{}}}}`)
+	session := w.Header().Get(sessionHeader)
+	if session == "" {
+		t.Fatalf("Expected a session, got %d %s", w.Code, w.Body.String())
+	}
+	postSession(proxy, session, `{"jsonrpc":"2.0","method":"notifications/initialized"}`)
+	return session
+}
+
+// subscription is what the "resources" fake backend reports on touch.
+type subscription struct {
+	Subscribes int      `json:"subscribes"`
+	Subscribed []string `json:"subscribed"`
+}
+
+// touch makes the MCP server send an update for subscribedURI if it is
+// subscribed to it, and returns its subscriptions.
+func touch(t *testing.T, proxy *MCPProxy) subscription {
+	t.Helper()
+	w := postJSON(proxy, `{"jsonrpc":"2.0","id":"touch","method":"touch","params":{"uri":"`+subscribedURI+`"}}`)
+	var resp struct {
+		Result subscription `json:"result"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Unexpected response %d %s", w.Code, w.Body.String())
+	}
+	return resp.Result
+}
+
+// expectUpdate waits for an update on events, or makes sure none comes if
+// want is false.
+func expectUpdate(t *testing.T, name string, events <-chan streamEvent, want bool) {
+	t.Helper()
+	timeout := 5 * time.Second
+	if !want {
+		timeout = 100 * time.Millisecond
+	}
+	select {
+	case ev := <-events:
+		if !want || ev.method != "notifications/resources/updated" {
+			t.Errorf("%s: unexpected event %+v", name, ev)
+		}
+	case <-time.After(timeout):
+		if want {
+			t.Errorf("%s: expected an update", name)
+		}
+	}
+}
+
+func TestShareSubscriptions(t *testing.T) {
+	fastRestarts(t)
+	proxy := newFakeProxy(t, "resources", Config{EnableNotificationStream: true, ShareSubscriptions: true, ReplayInitialize: true})
+	server := httptest.NewServer(proxy.Handler())
+	t.Cleanup(server.Close)
+
+	a, b, other := startSession(t, proxy), startSession(t, proxy), startSession(t, proxy)
+	streamA, streamB, streamOther := openSessionStream(t, server, a), openSessionStream(t, server, b), openSessionStream(t, server, other)
+	subscribe := `{"jsonrpc":"2.0","id":2,"method":"resources/subscribe","params":{"uri":"` + subscribedURI + `"}}`
+	unsubscribe := `{"jsonrpc":"2.0","id":3,"method":"resources/unsubscribe","params":{"uri":"` + subscribedURI + `"}}`
+
+	// Only the first subscribe reaches the MCP server
+	for _, session := range []string{a, b} {
+		if w := postSession(proxy, session, subscribe); !strings.Contains(w.Body.String(), `"result":{}`) {
+			t.Fatalf("Expected the subscribe to succeed, got %s", w.Body.String())
+		}
+	}
+	if s := touch(t, proxy); s.Subscribes != 1 {
+		t.Errorf("Expected one subscribe sent to the MCP server, got %+v", s)
+	}
+	expectUpdate(t, "a", streamA, true)
+	expectUpdate(t, "b", streamB, true)
+	expectUpdate(t, "other", streamOther, false)
+
+	// A restarted MCP server is subscribed again
+	if err := proxy.Restart("test"); err != nil {
+		t.Fatal(err)
+	}
+	waitForRestarts(t, proxy, 1)
+	deadline := time.Now().Add(5 * time.Second)
+	for s := touch(t, proxy); len(s.Subscribed) == 0; s = touch(t, proxy) {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the restarted MCP server to be subscribed, got %+v", s)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	expectUpdate(t, "a after the restart", streamA, true)
+	expectUpdate(t, "b after the restart", streamB, true)
+
+	// The MCP server stays subscribed until the last subscriber leaves
+	postSession(proxy, a, unsubscribe)
+	if s := touch(t, proxy); len(s.Subscribed) != 1 {
+		t.Errorf("Expected the MCP server to stay subscribed for b, got %+v", s)
+	}
+	expectUpdate(t, "b", streamB, true)
+	expectUpdate(t, "a after unsubscribing", streamA, false)
+
+	postSession(proxy, b, unsubscribe)
+	if s := touch(t, proxy); len(s.Subscribed) != 0 {
+		t.Errorf("Expected the MCP server to be unsubscribed, got %+v", s)
+	}
+}
+
+func TestShareSubscriptionsExpire(t *testing.T) {
+	saved := subscriptionGrace
+	subscriptionGrace = 50 * time.Millisecond
+	t.Cleanup(func() { subscriptionGrace = saved })
+
+	proxy := newFakeProxy(t, "resources", Config{EnableNotificationStream: true, ShareSubscriptions: true})
+	server := httptest.NewServer(proxy.Handler())
+	t.Cleanup(server.Close)
+
+	// A session whose stream goes away without unsubscribing loses its
+	// subscriptions
+	session := startSession(t, proxy)
+	stream := openSessionStream(t, server, session)
+	postSession(proxy, session, `{"jsonrpc":"2.0","id":2,"method":"resources/subscribe","params":{"uri":"`+subscribedURI+`"}}`)
+	if s := touch(t, proxy); len(s.Subscribed) != 1 {
+		t.Fatalf("Expected the MCP server to be subscribed, got %+v", s)
+	}
+	expectUpdate(t, "session", stream, true)
+	server.CloseClientConnections()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for s := touch(t, proxy); len(s.Subscribed) != 0; s = touch(t, proxy) {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the MCP server to be unsubscribed, got %+v", s)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestShareSubscriptionsEndWithSession(t *testing.T) {
+	saved := subscriptionGrace
+	subscriptionGrace = 50 * time.Millisecond
+	t.Cleanup(func() { subscriptionGrace = saved })
+
+	proxy := newFakeProxy(t, "resources", Config{EnableNotificationStream: true, ShareSubscriptions: true})
+	subscribe := `{"jsonrpc":"2.0","id":2,"method":"resources/subscribe","params":{"uri":"` + subscribedURI + `"}}`
+	unsubscribed := func(what string) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for s := touch(t, proxy); len(s.Subscribed) != 0; s = touch(t, proxy) {
+			if time.Now().After(deadline) {
+				t.Fatalf("Expected the MCP server to be unsubscribed %s, got %+v", what, s)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	// A client ending its session loses its subscriptions
+	session := startSession(t, proxy)
+	postSession(proxy, session, subscribe)
+	if s := touch(t, proxy); len(s.Subscribed) != 1 {
+		t.Fatalf("Expected the MCP server to be subscribed, got %+v", s)
+	}
+	end := func() int {
+		req := httptest.NewRequest("DELETE", "/", nil)
+		req.Header.Set(sessionHeader, session)
+		w := httptest.NewRecorder()
+		proxy.Handler().ServeHTTP(w, req)
+		return w.Code
+	}
+	if code := end(); code != http.StatusNoContent {
+		t.Errorf("Expected the session to end, got %d", code)
+	}
+	unsubscribed("once the session ended")
+	if code := end(); code != http.StatusNotFound {
+		t.Errorf("Expected an ended session to be unknown, got %d", code)
+	}
+
+	// So do clients that never open a notification stream, with a session
+	// or without
+	postSession(proxy, startSession(t, proxy), subscribe)
+	unsubscribed("without a notification stream")
+	postJSON(proxy, subscribe)
+	unsubscribed("for clients without a session id")
+}
+
+func TestShareSubscriptionsSerializesChanges(t *testing.T) {
+	proxy := newFakeProxy(t, "resources", Config{EnableNotificationStream: true, ShareSubscriptions: true})
+	subscribe := `{"jsonrpc":"2.0","id":2,"method":"resources/subscribe","params":{"uri":"` + subscribedURI + `"}}`
+	unsubscribe := `{"jsonrpc":"2.0","id":3,"method":"resources/unsubscribe","params":{"uri":"` + subscribedURI + `"}}`
+
+	// Clients subscribing and unsubscribing at once leave the MCP server
+	// subscribed exactly when the last of them to change stays subscribed
+	for round := 0; round < 5; round++ {
+		sessions := make([]string, 8)
+		for i := range sessions {
+			sessions[i] = startSession(t, proxy)
+		}
+		var wg sync.WaitGroup
+		for i, session := range sessions {
+			wg.Add(1)
+			go func(i int, session string) {
+				defer wg.Done()
+				for j := 0; j < 5; j++ {
+					postSession(proxy, session, subscribe)
+					postSession(proxy, session, unsubscribe)
+				}
+				if i%2 == 0 {
+					postSession(proxy, session, subscribe)
+				}
+			}(i, session)
+		}
+		wg.Wait()
+		if s := touch(t, proxy); len(s.Subscribed) != 1 {
+			t.Fatalf("Expected the MCP server to be subscribed for the clients that stayed, got %+v", s)
+		}
+		for i, session := range sessions {
+			if i%2 == 0 {
+				postSession(proxy, session, unsubscribe)
+			}
+		}
+		if s := touch(t, proxy); len(s.Subscribed) != 0 {
+			t.Fatalf("Expected the MCP server to be unsubscribed once all clients left, got %+v", s)
+		}
+	}
+}
+
+func TestValidateShareSubscriptions(t *testing.T) {
+	if err := validateShareSubscriptions(Config{ShareSubscriptions: true}); err == nil {
+		t.Error("Expected ShareSubscriptions without EnableNotificationStream to be rejected")
+	}
+}
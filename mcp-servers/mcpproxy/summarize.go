@@ -0,0 +1,198 @@
+package mcpproxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// defaultSummarizerTimeout is the default Summarizer.Timeout.
+const defaultSummarizerTimeout = 30 * time.Second
+
+// Outcomes counted in mcp_proxy_summarizer_results_total.
+const (
+	summaryPassed     = "passed"
+	summarySummarized = "summarized"
+	summaryTruncated  = "truncated"
+)
+
+// Summarizer configures a service that oversized text results of tools/call
+// are summarized by before they reach the client, see Config.Summarizer.
+//
+// The proxy POSTs {"tool": name, "text": text, "maxBytes": Threshold} to
+// URL, and expects 200 OK with {"summary": text}.
+type Summarizer struct {
+	// URL is the http or https endpoint of the service.
+	URL string
+
+	// Threshold is the size in bytes of the text content of a result
+	// beyond which it is summarized.
+	Threshold int
+
+	// Timeout bounds each call to the service (default 30s). A tool call
+	// with a timeout of its own, see ToolCallTimeout, is given no more
+	// than what is left of it.
+	Timeout time.Duration
+
+	// Tools lists the tools whose results are summarized, all if empty.
+	Tools []string
+}
+
+// summarizerFile is the JSON form of Summarizer in Config.ConfigFile.
+type summarizerFile struct {
+	URL       string   `json:"url"`
+	Threshold int      `json:"threshold"`
+	Timeout   duration `json:"timeout"`
+	Tools     []string `json:"tools"`
+}
+
+// summarizerView is Summarizer as served at /config.
+type summarizerView struct {
+	URL       string   `json:"url"`
+	Threshold int      `json:"threshold"`
+	Timeout   string   `json:"timeout"`
+	Tools     []string `json:"tools"`
+}
+
+func newSummarizerView(s *Summarizer) *summarizerView {
+	if s == nil {
+		return nil
+	}
+	return &summarizerView{URL: s.URL, Threshold: s.Threshold, Timeout: s.Timeout.String(), Tools: nonNil(s.Tools)}
+}
+
+// validateSummarizer checks cfg.Summarizer.
+func validateSummarizer(cfg Config) error {
+	s := cfg.Summarizer
+	if s == nil {
+		return nil
+	}
+	if u, err := url.Parse(s.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("Summarizer.URL must be an http or https URL, got %q", s.URL)
+	}
+	if s.Threshold <= 0 {
+		return errors.New("Summarizer.Threshold must be positive")
+	}
+	return nil
+}
+
+// summarizes reports whether results of tool are summarized when too large.
+func (s *Summarizer) summarizes(tool string) bool {
+	return s != nil && (len(s.Tools) == 0 || slices.Contains(s.Tools, tool))
+}
+
+// summarizeResult returns response, the response to req, with the text
+// content of its result replaced by a summary from Config.Summarizer if it
+// exceeds the threshold, or by the text truncated to the threshold if the
+// summarizer fails. Other content blocks are kept. ctx ends when the
+// client no longer waits for the response.
+func (p *MCPProxy) summarizeResult(ctx context.Context, req *request, response json.RawMessage) json.RawMessage {
+	s := p.config.Summarizer
+	if req.method != "tools/call" || !s.summarizes(req.tool) {
+		return response
+	}
+	start, end, ok := findResult(response)
+	if !ok {
+		return response
+	}
+	var result map[string]json.RawMessage
+	var content []map[string]interface{}
+	if json.Unmarshal(response[start:end], &result) != nil || json.Unmarshal(result["content"], &content) != nil {
+		return response
+	}
+	var texts []string
+	var others []map[string]interface{}
+	for _, block := range content {
+		if text, ok := block["text"].(string); ok && block["type"] == "text" {
+			texts = append(texts, text)
+		} else {
+			others = append(others, block)
+		}
+	}
+	text := strings.Join(texts, "\n")
+	if len(text) <= s.Threshold {
+		p.metrics.summarizer.Inc(req.tool, summaryPassed)
+		return response
+	}
+
+	outcome := summarySummarized
+	summary, err := p.summarize(ctx, req, text)
+	if err == nil {
+		summary = fmt.Sprintf("%s\n\n[Summarized by the proxy from %d bytes of output]", summary, len(text))
+	} else {
+		req.log.Warn("Failed to summarize tool result, truncating it", "tool", req.tool, "bytes", len(text), "error", err)
+		outcome = summaryTruncated
+		summary = fmt.Sprintf("%s\n\n[Truncated by the proxy from %d to %d bytes]", truncateUTF8(text, s.Threshold), len(text), s.Threshold)
+	}
+	p.metrics.summarizer.Inc(req.tool, outcome)
+
+	blocks := append([]map[string]interface{}{{"type": "text", "text": summary}}, others...)
+	result["content"], _ = json.Marshal(blocks)
+	data, err := json.Marshal(result)
+	if err != nil {
+		return response
+	}
+	return spliceResult(response, start, end, data)
+}
+
+// summarize asks the summarizer for a summary of text, a result of the tool
+// req called, within Summarizer.Timeout and the time left of the call's
+// own timeout.
+func (p *MCPProxy) summarize(ctx context.Context, req *request, text string) (string, error) {
+	s := p.config.Summarizer
+	timeout := s.Timeout
+	if callTimeout := req.callTimeout; callTimeout > 0 && !req.started.IsZero() {
+		left := time.Until(req.started.Add(callTimeout))
+		if left <= 0 {
+			return "", errors.New("no time left of the tool call timeout")
+		}
+		timeout = min(timeout, left)
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	body, _ := json.Marshal(map[string]interface{}{"tool": req.tool, "text": text, "maxBytes": s.Threshold})
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	var answer struct {
+		Summary string `json:"summary"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&answer); err != nil {
+		return "", fmt.Errorf("invalid response: %w", err)
+	}
+	if answer.Summary == "" {
+		return "", errors.New("empty summary")
+	}
+	return answer.Summary, nil
+}
+
+// truncateUTF8 returns the longest prefix of s of at most n bytes that does
+// not split a character.
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
@@ -0,0 +1,134 @@
+package mcpproxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// echoText calls the echo tool of the "mcp" fake backend, whose result
+// holds a text block of about size bytes, and returns that block's text.
+func echoText(t *testing.T, proxy *MCPProxy, size int) string {
+	t.Helper()
+	w := postJSON(proxy, fmt.Sprintf(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"echo","arguments":{"text":"%s"}}}`, strings.Repeat("é", size/2)))
+	var resp struct {
+		ID     int `json:"id"`
+		Result struct {
+			Content []struct {
+				Text string `json:"text"`
+			} `json:"content"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.ID != 1 || len(resp.Result.Content) != 1 {
+		t.Fatalf("Unexpected response %d %s", w.Code, w.Body.String())
+	}
+	return resp.Result.Content[0].Text
+}
+
+func TestSummarizer(t *testing.T) {
+	var summarized []string
+	summarizer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Tool     string `json:"tool"`
+			Text     string `json:"text"`
+			MaxBytes int    `json:"maxBytes"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		summarized = append(summarized, req.Tool)
+		if req.MaxBytes != 100 {
+			http.Error(w, "bad maxBytes", http.StatusBadRequest)
+			return
+		}
+		fmt.Fprintf(w, `{"summary":"%d bytes from %s"}`, len(req.Text), req.Tool)
+	}))
+	defer summarizer.Close()
+
+	proxy := newFakeProxy(t, "mcp", Config{Summarizer: &Summarizer{URL: summarizer.URL, Threshold: 100, Tools: []string{"echo"}}})
+
+	if text := echoText(t, proxy, 50); !strings.HasPrefix(text, `{"text":"éé`) {
+		t.Errorf("Expected a small result to be passed through, got %q", text)
+	}
+	if len(summarized) != 0 {
+		t.Errorf("Expected no call to the summarizer, got %v", summarized)
+	}
+
+	text := echoText(t, proxy, 1000)
+	if want := "1011 bytes from echo\n\n[Summarized by the proxy from 1011 bytes of output]"; text != want {
+		t.Errorf("Expected %q, got %q", want, text)
+	}
+
+	// Other tools are left alone
+	w := postJSON(proxy, `{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"fail"}}`)
+	if !strings.Contains(w.Body.String(), `"text":"failed"`) || len(summarized) != 1 {
+		t.Errorf("Expected the result of fail to be passed through, got %s", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	proxy.metrics.handle(w, httptest.NewRequest("GET", "/metrics", nil))
+	for _, want := range []string{
+		`mcp_proxy_summarizer_results_total{server="test",tool="echo",outcome="passed"} 1`,
+		`mcp_proxy_summarizer_results_total{server="test",tool="echo",outcome="summarized"} 1`,
+	} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("Expected %s, got:\n%s", want, w.Body.String())
+		}
+	}
+}
+
+func TestSummarizerFallback(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "overloaded", http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+
+	// The text is truncated without splitting a character
+	proxy := newFakeProxy(t, "mcp", Config{Summarizer: &Summarizer{URL: failing.URL, Threshold: 101}})
+	text := echoText(t, proxy, 1000)
+	if want := `{"text":"` + strings.Repeat("é", 46) + "\n\n[Truncated by the proxy from 1011 to 101 bytes]"; text != want {
+		t.Errorf("Expected %q, got %q", want, text)
+	}
+
+	w := httptest.NewRecorder()
+	proxy.metrics.handle(w, httptest.NewRequest("GET", "/metrics", nil))
+	if want := `mcp_proxy_summarizer_results_total{server="test",tool="echo",outcome="truncated"} 1`; !strings.Contains(w.Body.String(), want) {
+		t.Errorf("Expected %s, got:\n%s", want, w.Body.String())
+	}
+}
+
+func TestSummarizerDeadline(t *testing.T) {
+	hanging := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The client going away is only noticed once the body is read
+		io.ReadAll(r.Body)
+		<-r.Context().Done()
+	}))
+	defer hanging.Close()
+
+	// The summarizer only gets what is left of the tool call timeout
+	proxy := newFakeProxy(t, "mcp", Config{
+		ToolCallTimeout: 300 * time.Millisecond,
+		Summarizer:      &Summarizer{URL: hanging.URL, Threshold: 100, Timeout: time.Minute},
+	})
+	start := time.Now()
+	if text := echoText(t, proxy, 1000); !strings.Contains(text, "[Truncated by the proxy") {
+		t.Errorf("Expected the result to be truncated, got %q", text)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("Expected the summarizer to be given up on with the tool call timeout, took %v", d)
+	}
+}
+
+func TestValidateSummarizer(t *testing.T) {
+	for _, s := range []*Summarizer{
+		{URL: "summarizer:8080", Threshold: 100},
+		{URL: "http://summarizer:8080"},
+	} {
+		if err := validateSummarizer(Config{Summarizer: s}); err == nil {
+			t.Errorf("Expected %+v to be rejected", s)
+		}
+	}
+}
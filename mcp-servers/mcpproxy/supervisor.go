@@ -0,0 +1,451 @@
+package mcpproxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Backend states reported in BackendStatus.
+const (
+	StateIdle       = "idle"       // not started yet, see Config.LazyStart
+	StateStarting   = "starting"   // starting for the first request
+	StateRunning    = "running"    // the MCP server is up
+	StateRestarting = "restarting" // waiting to start a replacement
+	StateExited     = "exited"     // exited and MaxRestarts is 0
+	StateFailed     = "failed"     // crashed more than MaxRestarts times in a row
+	StateStopped    = "stopped"    // the proxy was closed
+)
+
+var (
+	// restartBackoff is the delay before restarting after a clean exit or
+	// a first crash. It doubles with each further consecutive crash, up to
+	// maxRestartBackoff.
+	restartBackoff    = 500 * time.Millisecond
+	maxRestartBackoff = 30 * time.Second
+
+	// stableRunTime is how long the MCP server must run before its next
+	// crash is no longer considered part of a crash loop.
+	stableRunTime = time.Minute
+)
+
+// BackendStatus describes the MCP server subprocess, as served at /status.
+type BackendStatus struct {
+	State     string    `json:"state"`
+	PID       int       `json:"pid,omitempty"`
+	StartedAt time.Time `json:"startedAt"`
+
+	// Restarts counts all restarts, Crashes the consecutive crashes that
+	// count toward MaxRestarts. Clean exits do not count as crashes.
+	Restarts int `json:"restarts"`
+	Crashes  int `json:"crashes"`
+
+	LastExit *ExitInfo `json:"lastExit,omitempty"`
+
+	// ScratchBytes is the size of the running MCP server's scratch
+	// directory, see Config.ScratchRoot.
+	ScratchBytes int64 `json:"scratchBytes,omitempty"`
+
+	// CircuitBreaker is the state of the circuit breaker, one of the
+	// Breaker constants, see Config.CircuitBreakerFailures.
+	CircuitBreaker string `json:"circuitBreaker,omitempty"`
+
+	// StandbyPID is the process id of the warm standby MCP server, if one
+	// is ready, see Config.WarmStandby.
+	StandbyPID int `json:"standbyPid,omitempty"`
+}
+
+// ExitInfo describes how the MCP server last exited.
+type ExitInfo struct {
+	Code  int       `json:"code"` // -1 if it was killed by a signal
+	Clean bool      `json:"clean"`
+	Error string    `json:"error,omitempty"`
+	At    time.Time `json:"at"`
+
+	// Reason classifies the exit as one of the ExitReason constants, and
+	// Description says what happened in words. Signal is the number of
+	// the signal that killed the MCP server, if any.
+	Reason      string `json:"reason"`
+	Description string `json:"description"`
+	Signal      int    `json:"signal,omitempty"`
+}
+
+// Status returns the current state of the MCP server subprocess.
+func (p *MCPProxy) Status() BackendStatus {
+	p.backendMu.Lock()
+	defer p.backendMu.Unlock()
+	status := p.status
+	status.ScratchBytes = p.backend.scratchBytes()
+	status.CircuitBreaker = p.breaker.State()
+	status.StandbyPID = p.standby.pid()
+	if status.LastExit != nil {
+		exit := *status.LastExit
+		status.LastExit = &exit
+	}
+	return status
+}
+
+// Restart replaces the MCP server with a new instance, for instance to pick
+// up changed credentials. Requests queued before it are answered by the
+// current instance first, and later ones wait for the new one. The current
+// instance is stopped as by Close, and replaced even if MaxRestarts is 0;
+// this does not count as a crash. Restart returns once it has exited. It
+// does nothing if the MCP server is not running, such as before LazyStart
+// starts it.
+func (p *MCPProxy) Restart(reason string) error {
+	req := &request{method: "restart", restart: reason, response: make(chan json.RawMessage)}
+	if err := p.enqueue(req); err != nil {
+		return err
+	}
+	<-req.response
+	return nil
+}
+
+// replaceBackend stops the running MCP server for Restart, for supervise to
+// start another. It is only called by processRequests.
+func (p *MCPProxy) replaceBackend(reason string) {
+	b := p.currentBackend()
+	if b == nil {
+		return
+	}
+	select {
+	case <-b.exited:
+		return
+	default:
+	}
+	p.log.Info("Replacing MCP server", "reason", reason, "pid", b.cmd.Process.Pid)
+	b.replaced.Store(true)
+	b.stop(closeGracePeriod)
+}
+
+// liveBackend returns the backend to send the next request to, starting the
+// MCP server if LazyStart deferred it and waiting while it is being
+// restarted. It returns nil if the MCP server is not running and will not be
+// restarted, or could not be started lazily.
+func (p *MCPProxy) liveBackend() *backend {
+	// Only processRequests moves the state out of idle.
+	p.backendMu.Lock()
+	idle := p.status.State == StateIdle
+	p.backendMu.Unlock()
+	if idle && !p.startLazily() {
+		return nil
+	}
+
+	p.backendMu.Lock()
+	defer p.backendMu.Unlock()
+	for {
+		select {
+		case <-p.backend.exited:
+		default:
+			return p.backend
+		}
+		// The exit may not have been handled by supervise yet, in which
+		// case the state is still running.
+		if p.status.State != StateRunning && p.status.State != StateRestarting {
+			return nil
+		}
+		p.backendCond.Wait()
+	}
+}
+
+// startLazily starts the first MCP server for Config.LazyStart. It returns
+// false, leaving the state idle, if the server could not be started.
+func (p *MCPProxy) startLazily() bool {
+	p.log.Info("Starting MCP server for the first request")
+	p.setState(StateStarting)
+	b, err := startBackend(p.config, p.backendLogger(), p.output, p.tokens.env())
+	if err != nil {
+		p.log.Error("Failed to start MCP server", "error", err)
+		if !p.isClosed() {
+			p.setState(StateIdle)
+		}
+		return false
+	}
+
+	p.backendMu.Lock()
+	if p.isClosed() {
+		p.backendMu.Unlock()
+		b.stop(0)
+		return false
+	}
+	p.backend = b
+	p.status.State = StateRunning
+	p.status.PID = b.cmd.Process.Pid
+	p.status.StartedAt = time.Now()
+	p.backendCond.Broadcast()
+	p.backendMu.Unlock()
+
+	close(p.started)
+	p.stateChanged(StateStarting, StateRunning)
+	return true
+}
+
+// supervise waits for the MCP server to exit and restarts it, unless
+// MaxRestarts is 0 or it has crashed too often. It returns once the proxy
+// is closed.
+func (p *MCPProxy) supervise() {
+	defer close(p.supervised)
+
+	select {
+	case <-p.started:
+	case <-p.stopping:
+		p.setState(StateStopped)
+		return
+	}
+
+	for {
+		b := p.currentBackend()
+		p.awaitExit(b)
+		if p.isClosed() {
+			p.endBurst()
+			p.setState(StateStopped)
+			return
+		}
+
+		exit := p.exitInfo(b)
+		p.backendMu.Lock()
+		early := exit.At.Sub(p.status.StartedAt) < stableRunTime
+		p.backendMu.Unlock()
+
+		log := p.log
+		switch {
+		case !p.config.CoalesceRestarts || !early:
+			p.endBurst()
+		case p.burst.restarts > 0:
+			log = debugLogger{p.log}
+		case p.burst.since.IsZero():
+			p.burst.since = exit.At
+		}
+		if b.replaced.Load() {
+			log.Info("MCP server was stopped to be replaced", "status", exit.Error)
+		} else if b.abandoned.Load() {
+			log.Warn("MCP server was killed to abandon a timed-out tool call", "status", exit.Error)
+		} else if b.desynced.Load() {
+			log.Warn("MCP server was killed to resynchronize its stdout", "status", exit.Error)
+		} else if exit.Clean {
+			log.Info("MCP server exited cleanly", "status", exit.Error)
+		} else {
+			log.Error("MCP server crashed", "status", exit.Error, "reason", exit.Reason, "description", exit.Description)
+		}
+		p.metrics.backendExits.Inc(exit.Reason)
+
+		p.backendMu.Lock()
+		p.status.LastExit = exit
+		if !exit.Clean {
+			if !early {
+				p.status.Crashes = 0
+			}
+			p.status.Crashes++
+		}
+		p.backendMu.Unlock()
+
+		if !p.restart(b.abandoned.Load() || b.desynced.Load() || b.replaced.Load()) {
+			p.endBurst()
+			<-p.stopping
+			p.setState(StateStopped)
+			return
+		}
+	}
+}
+
+// restartBurst is a run of restarts of an MCP server that keeps exiting
+// within stableRunTime of starting, see Config.CoalesceRestarts.
+type restartBurst struct {
+	since    time.Time // the first early exit, zero if there is no burst
+	last     time.Time // the last restart
+	restarts int       // restarts since since
+}
+
+// awaitExit waits for b to exit or the proxy to close. A burst of restarts
+// ends once b has run for stableRunTime.
+func (p *MCPProxy) awaitExit(b *backend) {
+	if !p.burst.since.IsZero() {
+		p.backendMu.Lock()
+		stable := time.NewTimer(time.Until(p.status.StartedAt.Add(stableRunTime)))
+		p.backendMu.Unlock()
+		defer stable.Stop()
+		select {
+		case <-b.exited:
+			return
+		case <-p.stopping:
+			return
+		case <-stable.C:
+			p.endBurst()
+		}
+	}
+	select {
+	case <-b.exited:
+	case <-p.stopping:
+	}
+}
+
+// endBurst ends the current burst of restarts, logging how many there were
+// if they were not all logged.
+func (p *MCPProxy) endBurst() {
+	if p.burst.restarts > 1 {
+		d := p.burst.last.Sub(p.burst.since).Round(time.Millisecond)
+		p.log.Warn(fmt.Sprintf("MCP server restarted %d times in %s", p.burst.restarts, d),
+			"restarts", p.burst.restarts, "duration", d)
+	}
+	p.burst = restartBurst{}
+}
+
+// restart starts a replacement MCP server after a backoff, retrying failed
+// starts as crashes. It returns false if the MCP server is not to be
+// restarted or the proxy was closed. forced restarts even if MaxRestarts is
+// 0, for a server that was killed by the proxy rather than exiting.
+func (p *MCPProxy) restart(forced bool) bool {
+	for {
+		p.backendMu.Lock()
+		crashes := p.status.Crashes
+		oom := p.status.LastExit != nil && p.status.LastExit.Reason == ExitReasonOOM
+		p.backendMu.Unlock()
+
+		switch {
+		case p.config.MaxRestarts <= 0 && !forced:
+			p.setState(StateExited)
+			return false
+		case crashes > p.config.MaxRestarts:
+			p.log.Error("MCP server crashed too many times in a row, giving up", "crashes", crashes)
+			p.setState(StateFailed)
+			return false
+		}
+
+		// A warm standby takes over at once, see Config.WarmStandby
+		b := p.standby.take(p.tokens.env())
+		if b != nil {
+			p.log.Info("Switching to the warm standby MCP server", "pid", b.cmd.Process.Pid)
+			p.memo.clear()
+		} else {
+			// Within a burst, restarts back off whether or not they follow a
+			// crash, and only the first is logged, along with those at the
+			// maximum backoff, which are far apart.
+			p.setState(StateRestarting)
+			delay := restartDelay(crashes)
+			log, events := p.log, p.backendLogger()
+			if !p.burst.since.IsZero() {
+				delay = max(delay, restartDelay(p.burst.restarts+1))
+				if p.burst.restarts > 0 && delay < maxRestartBackoff {
+					log, events = debugLogger{log}, debugLogger{events}
+				}
+			}
+			if oom {
+				delay = max(delay, p.config.OOMRestartDelay)
+			}
+			log.Info("Restarting MCP server", "delay", delay)
+			select {
+			case <-time.After(delay):
+			case <-p.stopping:
+				return false
+			}
+
+			var err error
+			b, err = launchBackend(p.config, p.backendLogger(), events, p.output, p.tokens.env())
+			if err != nil {
+				p.log.Error("Failed to restart MCP server", "error", err)
+				p.backendMu.Lock()
+				p.status.Crashes++
+				p.backendMu.Unlock()
+				continue
+			}
+		}
+
+		p.backendMu.Lock()
+		if p.isClosed() {
+			p.backendMu.Unlock()
+			b.stop(0)
+			return false
+		}
+		p.backend = b
+		old := p.status.State
+		p.status.State = StateRunning
+		p.status.PID = b.cmd.Process.Pid
+		p.status.StartedAt = time.Now()
+		p.status.Restarts++
+		p.backendCond.Broadcast()
+		p.backendMu.Unlock()
+		if !p.burst.since.IsZero() {
+			p.burst.restarts++
+			p.burst.last = time.Now()
+		}
+		p.stateChanged(old, StateRunning)
+		if p.config.ShareSubscriptions {
+			go p.resubscribe()
+		}
+		return true
+	}
+}
+
+// restartDelay returns the backoff before a restart following the given
+// number of consecutive crashes.
+func restartDelay(crashes int) time.Duration {
+	delay := restartBackoff
+	for i := 1; i < crashes && delay < maxRestartBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, maxRestartBackoff)
+}
+
+// setState updates the reported state and wakes up liveBackend.
+func (p *MCPProxy) setState(state string) {
+	p.backendMu.Lock()
+	old := p.status.State
+	p.status.State = state
+	p.backendCond.Broadcast()
+	p.backendMu.Unlock()
+	p.stateChanged(old, state)
+}
+
+// exitInfo classifies the exit of b, which must have been reaped. Being
+// killed to abandon a tool call or to resynchronize counts as a clean exit.
+func (p *MCPProxy) exitInfo(b *backend) *ExitInfo {
+	code := -1
+	if b.cmd.ProcessState != nil {
+		code = b.cmd.ProcessState.ExitCode()
+	}
+	exit := &ExitInfo{
+		Code:  code,
+		Clean: code == 0 || (code > 0 && containsInt(p.config.CleanExitCodes, code)) || b.abandoned.Load() || b.desynced.Load() || b.replaced.Load(),
+		Error: exitStatus(b.exitErr),
+		At:    time.Now(),
+	}
+	classifyExit(exit, b.cmd.ProcessState, b.stopped.Load())
+	return exit
+}
+
+// exitInfoWait is how long awaitExitInfo waits for the MCP server to exit
+// once its stdout has closed.
+var exitInfoWait = time.Second
+
+// awaitExitInfo waits up to exitInfoWait for b to exit and classifies its
+// exit, for the requests that failed because of it. It returns nil if b is
+// still running.
+func (p *MCPProxy) awaitExitInfo(b *backend) *ExitInfo {
+	select {
+	case <-b.exited:
+		return p.exitInfo(b)
+	case <-time.After(exitInfoWait):
+		return nil
+	}
+}
+
+func containsInt(list []int, n int) bool {
+	for _, item := range list {
+		if item == n {
+			return true
+		}
+	}
+	return false
+}
+
+// handleStatus serves GET /status.
+func (p *MCPProxy) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(p.Status())
+}
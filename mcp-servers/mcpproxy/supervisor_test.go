@@ -0,0 +1,313 @@
+package mcpproxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rh-ai-kickstart/ai-architecture-charts/mcp-servers/mcpproxy/internal/fakebackend"
+)
+
+// fastRestarts shortens the restart backoff for the duration of the test.
+func fastRestarts(t *testing.T) {
+	saved := restartBackoff
+	restartBackoff = 10 * time.Millisecond
+	t.Cleanup(func() { restartBackoff = saved })
+}
+
+// exitBackend makes the fake backend exit with code and waits until the
+// proxy has handled the exit.
+func exitBackend(t *testing.T, proxy *MCPProxy, code int) BackendStatus {
+	t.Helper()
+	before := proxy.Status()
+	postJSON(proxy, fmt.Sprintf(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"exitCode":%d}}`, code))
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		status := proxy.Status()
+		if status.Restarts > before.Restarts || (status.State != StateRunning && status.State != StateRestarting) {
+			return status
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("MCP server exit was not handled, status: %+v", proxy.Status())
+	return BackendStatus{}
+}
+
+func TestRestartWhileOutputHeldOpen(t *testing.T) {
+	// The stderr reader of the first server must not outlive it
+	checkGoroutines(t)
+	fastRestarts(t)
+	saved := pipeDrainGrace
+	pipeDrainGrace = 50 * time.Millisecond
+	t.Cleanup(func() { pipeDrainGrace = saved })
+
+	// The background sleep inherits the server's stdout and stderr and
+	// outlives it
+	path, args := fakebackend.Command("exit")
+	proxy, err := NewMCPProxy(Config{
+		ServerName:  "test",
+		CommandPath: "sleep 5 & exec " + path,
+		CommandArgs: args,
+		UseShell:    true,
+		MaxRestarts: 1,
+	})
+	if err != nil {
+		t.Fatalf("NewMCPProxy failed: %v", err)
+	}
+	t.Cleanup(func() { proxy.Close() })
+
+	if status := exitBackend(t, proxy, 0); status.State != StateRunning || status.Restarts != 1 {
+		t.Fatalf("Expected the exited server to be reaped and restarted, got %+v", status)
+	}
+}
+
+func TestCleanExitCodes(t *testing.T) {
+	fastRestarts(t)
+	proxy := newFakeProxy(t, "exit", Config{MaxRestarts: 1, CleanExitCodes: []int{3}})
+
+	// Clean exits are restarted without counting as crashes
+	for i := 1; i <= 2; i++ {
+		status := exitBackend(t, proxy, 3)
+		if status.State != StateRunning || status.Restarts != i || status.Crashes != 0 {
+			t.Fatalf("Expected restart %d after a clean exit, got %+v", i, status)
+		}
+		if status.LastExit == nil || status.LastExit.Code != 3 || !status.LastExit.Clean {
+			t.Errorf("Expected a clean exit with code 3, got %+v", status.LastExit)
+		}
+	}
+
+	w := postJSON(proxy, `{"jsonrpc":"2.0","id":2,"method":"ping"}`)
+	var resp struct {
+		Result struct {
+			PID int `json:"pid"`
+		} `json:"result"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.Result.PID != proxy.Status().PID {
+		t.Errorf("Expected the restarted server to answer, got %s", w.Body.String())
+	}
+
+	// Other codes are crashes, and more than MaxRestarts in a row are fatal
+	if status := exitBackend(t, proxy, 1); status.State != StateRunning || status.Crashes != 1 || status.LastExit.Clean {
+		t.Fatalf("Expected a restart after the first crash, got %+v", status)
+	}
+	if status := exitBackend(t, proxy, 1); status.State != StateFailed || status.Crashes != 2 {
+		t.Fatalf("Expected to give up after the second crash, got %+v", status)
+	}
+
+	if w := postJSON(proxy, `{"jsonrpc":"2.0","id":3,"method":"ping"}`); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 once the server has failed, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	proxy.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/status", nil))
+	var status BackendStatus
+	if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil {
+		t.Fatalf("Failed to parse /status: %v", err)
+	}
+	if status.State != StateFailed || status.Restarts != 3 || status.LastExit == nil || status.LastExit.Clean {
+		t.Errorf("Unexpected /status: %s", w.Body.String())
+	}
+}
+
+func TestNoRestartsByDefault(t *testing.T) {
+	fastRestarts(t)
+	proxy := newFakeProxy(t, "exit", Config{})
+
+	if status := exitBackend(t, proxy, 0); status.State != StateExited || status.Restarts != 0 {
+		t.Fatalf("Expected the server to stay down, got %+v", status)
+	}
+	if w := postJSON(proxy, `{"jsonrpc":"2.0","id":2,"method":"ping"}`); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 after the server exited, got %d", w.Code)
+	}
+}
+
+func TestRestart(t *testing.T) {
+	fastRestarts(t)
+	proxy := newFakeProxy(t, "exit", Config{})
+	pid := func() int {
+		t.Helper()
+		var resp struct {
+			Result struct {
+				PID int `json:"pid"`
+			} `json:"result"`
+		}
+		w := postJSON(proxy, `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{}}`)
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Result.PID == 0 {
+			t.Fatalf("Unexpected response %d %s", w.Code, w.Body.String())
+		}
+		return resp.Result.PID
+	}
+
+	first := pid()
+	if err := proxy.Restart("new credentials"); err != nil {
+		t.Fatalf("Restart failed: %v", err)
+	}
+	if second := pid(); second == first {
+		t.Errorf("Expected a new MCP server, got PID %d again", second)
+	}
+	if status := proxy.Status(); status.State != StateRunning || status.Restarts != 1 || status.Crashes != 0 || !status.LastExit.Clean {
+		t.Errorf("Expected a clean replacement even without MaxRestarts, got %+v", status)
+	}
+
+	proxy.Close()
+	if err := proxy.Restart("closed"); err == nil {
+		t.Error("Expected Restart to fail once the proxy is closed")
+	}
+}
+
+func TestRestartDelay(t *testing.T) {
+	tests := []struct {
+		crashes int
+		want    time.Duration
+	}{
+		{0, restartBackoff},
+		{1, restartBackoff},
+		{2, 2 * restartBackoff},
+		{3, 4 * restartBackoff},
+		{100, maxRestartBackoff},
+	}
+	for _, tt := range tests {
+		if got := restartDelay(tt.crashes); got != tt.want {
+			t.Errorf("restartDelay(%d) = %v, want %v", tt.crashes, got, tt.want)
+		}
+	}
+}
+
+func TestCoalescedRestarts(t *testing.T) {
+	checkGoroutines(t)
+	fastRestarts(t)
+	saved := stableRunTime
+	stableRunTime = 500 * time.Millisecond
+	t.Cleanup(func() { stableRunTime = saved })
+
+	// The MCP server exits as soon as it starts, five times, then stays up
+	const flaps = 5
+	counter := filepath.Join(t.TempDir(), "runs")
+	path, args := fakebackend.Command("ack")
+	logs := &recordingLogger{}
+	proxy, err := NewMCPProxy(Config{
+		ServerName: "test",
+		CommandPath: fmt.Sprintf(`n=$(cat %[1]s 2>/dev/null || echo 0); echo $((n+1)) > %[1]s; [ "$n" -ge %[2]d ] && exec %[3]s %[4]s; exit 0`,
+			counter, flaps, path, strings.Join(args, " ")),
+		UseShell:         true,
+		Logger:           logs,
+		MaxRestarts:      1,
+		CoalesceRestarts: true,
+	})
+	if err != nil {
+		t.Fatalf("NewMCPProxy failed: %v", err)
+	}
+	defer proxy.Close()
+
+	waitForLog(t, logs, fmt.Sprintf("WARN MCP server restarted %d times in", flaps))
+	if status := proxy.Status(); status.State != StateRunning || status.Restarts != flaps || status.Crashes != 0 {
+		t.Errorf("Expected the MCP server to be running after %d restarts, got %+v", flaps, status)
+	}
+
+	// Only the first exit and restart are logged at their usual level
+	for _, line := range []string{"INFO MCP server exited cleanly", "INFO Restarting MCP server"} {
+		if n := strings.Count(logs.String(), line); n != 1 {
+			t.Errorf("Expected %q once, got %d times:\n%s", line, n, logs.String())
+		}
+	}
+
+	// The backoff doubled with each restart although the exits were clean:
+	// 10+20+40+80+160ms
+	var d time.Duration
+	for _, line := range strings.Split(logs.String(), "\n") {
+		if strings.Contains(line, "times in") {
+			d, _ = time.ParseDuration(line[strings.LastIndex(line, "duration=")+len("duration="):])
+		}
+	}
+	if d < 300*time.Millisecond {
+		t.Errorf("Expected the restarts to back off, they took %s", d)
+	}
+}
+
+func TestLazyStart(t *testing.T) {
+	var launches atomic.Int32
+	proxy := newFakeProxy(t, "exit", Config{
+		LazyStart: true,
+		Launcher: LauncherFunc(func(ctx context.Context, path string, args []string) *exec.Cmd {
+			launches.Add(1)
+			return execLauncher{}.Command(ctx, path, args)
+		}),
+	})
+
+	if n := launches.Load(); n != 0 {
+		t.Fatalf("Expected no process before the first request, got %d launches", n)
+	}
+	if status := proxy.Status(); status.State != StateIdle || status.PID != 0 {
+		t.Errorf("Expected an idle MCP server, got %+v", status)
+	}
+	for _, path := range []string{"/healthz", "/readyz"} {
+		w := httptest.NewRecorder()
+		proxy.Handler().ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != http.StatusOK {
+			t.Errorf("Expected %s to pass before the first request, got %d", path, w.Code)
+		}
+	}
+
+	var pids []int
+	for i := 1; i <= 2; i++ {
+		w := postJSON(proxy, fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":"ping"}`, i))
+		var resp struct {
+			Result struct {
+				PID int `json:"pid"`
+			} `json:"result"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		pids = append(pids, resp.Result.PID)
+	}
+	if n := launches.Load(); n != 1 {
+		t.Errorf("Expected one launch for two requests, got %d", n)
+	}
+	if status := proxy.Status(); status.State != StateRunning || pids[0] == 0 || pids[0] != pids[1] || pids[0] != status.PID {
+		t.Errorf("Expected both requests to reach the started server, got pids %v and %+v", pids, status)
+	}
+}
+
+func TestLazyStartClosedUnused(t *testing.T) {
+	cfg := fakeConfig("exit")
+	cfg.LazyStart = true
+	proxy, err := NewMCPProxy(cfg)
+	if err != nil {
+		t.Fatalf("NewMCPProxy failed: %v", err)
+	}
+	if err := proxy.Close(); err != nil {
+		t.Errorf("Close failed: %v", err)
+	}
+	if state := proxy.Status().State; state != StateStopped {
+		t.Errorf("Expected the stopped state, got %s", state)
+	}
+}
+
+func TestLazyStartFailure(t *testing.T) {
+	cfg := fakeConfig("exit")
+	cfg.LazyStart = true
+	cfg.CommandPath = "/nonexistent/mcp-server"
+	proxy, err := NewMCPProxy(cfg)
+	if err != nil {
+		t.Fatalf("NewMCPProxy failed: %v", err)
+	}
+	defer proxy.Close()
+
+	for i := 0; i < 2; i++ {
+		if w := postJSON(proxy, `{"jsonrpc":"2.0","id":1,"method":"ping"}`); w.Code != http.StatusServiceUnavailable {
+			t.Errorf("Expected 503 when the MCP server cannot start, got %d", w.Code)
+		}
+		if state := proxy.Status().State; state != StateIdle {
+			t.Errorf("Expected the idle state after a failed start, got %s", state)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package mcpproxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// errToolCallTimeoutCode is the JSON-RPC error code of tool calls that ran
+// over Config.ToolCallTimeout.
+const errToolCallTimeoutCode = -32001
+
+// defaultCancelGracePeriod is the default Config.CancelGracePeriod.
+const defaultCancelGracePeriod = 5 * time.Second
+
+// Outcomes of a tool call that timed out.
+const (
+	timeoutCancelled = "cancelled" // the MCP server answered the ping
+	timeoutRestarted = "restarted" // the MCP server was killed
+)
+
+// cancelPings numbers the pings sent after cancelling a call.
+var cancelPings atomic.Uint64
+
+// callDeadline escalates a tool call that runs over its timeout: first it
+// is cancelled, then the MCP server is killed if it does not answer the
+// ping sent along within the grace period. Its timers run on their own
+// goroutines while processRequests waits for the response, and only write
+// to the MCP server until processRequests has settled the deadline, so
+// that the two never write at the same time.
+type callDeadline struct {
+	tool    string
+	timeout time.Duration
+	pingID  string
+
+	mu      sync.Mutex
+	timer   *time.Timer
+	settled bool
+	outcome string // "" while the call has not timed out
+}
+
+// toolCallTimeout returns the timeout of req under d, or 0 if it has none.
+func (d *dynamicConfig) toolCallTimeout(req *request) time.Duration {
+	if req.method != "tools/call" {
+		return 0
+	}
+	if timeout, ok := d.ToolTimeouts[req.tool]; ok {
+		return timeout
+	}
+	return d.ToolCallTimeout
+}
+
+// deadlineFormat is the format of params._meta.deadline, RFC 3339 with
+// milliseconds.
+const deadlineFormat = "2006-01-02T15:04:05.000Z07:00"
+
+// propagateDeadline sets params._meta.deadline and timeoutMs of msg, the
+// request req about to be sent, see Config.PropagateDeadlines. The
+// deadline of the client's request context has been running since req was
+// queued, while the tool call timeout starts now.
+func (p *MCPProxy) propagateDeadline(msg json.RawMessage, req *request) json.RawMessage {
+	now := time.Now()
+	deadline := req.deadline
+	if timeout := req.callTimeout; timeout > 0 && (deadline.IsZero() || now.Add(timeout).Before(deadline)) {
+		deadline = now.Add(timeout)
+	}
+	if deadline.IsZero() {
+		return msg
+	}
+	return editMeta(msg, func(meta map[string]json.RawMessage) {
+		var set string
+		if json.Unmarshal(meta["deadline"], &set) == nil {
+			if t, err := time.Parse(time.RFC3339Nano, set); err == nil && !t.After(deadline) {
+				return
+			}
+		}
+		timeout := deadline.Sub(now).Milliseconds()
+		if timeout < 0 {
+			timeout = 0
+		}
+		meta["deadline"], _ = json.Marshal(deadline.UTC().Format(deadlineFormat))
+		meta["timeoutMs"], _ = json.Marshal(timeout)
+	})
+}
+
+// toolName returns the name of the tool a buffered tools/call calls.
+func toolName(msg json.RawMessage) string {
+	var call struct {
+		Params struct {
+			Name string `json:"name"`
+		} `json:"params"`
+	}
+	json.Unmarshal(msg, &call)
+	return call.Params.Name
+}
+
+// startDeadline starts the timeout of req, which has just been sent to b.
+func (p *MCPProxy) startDeadline(b *backend, req *request, requestID interface{}, timeout time.Duration) *callDeadline {
+	d := &callDeadline{
+		tool:    req.tool,
+		timeout: timeout,
+		pingID:  "mcp-proxy-ping-" + strconv.FormatUint(cancelPings.Add(1), 10),
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.timer = time.AfterFunc(timeout, func() { p.cancelCall(b, req, d, requestID) })
+	return d
+}
+
+// cancelCall asks the MCP server to abandon the call, and pings it to learn
+// whether it did: a server stuck in the call cannot answer.
+func (p *MCPProxy) cancelCall(b *backend, req *request, d *callDeadline, requestID interface{}) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.settled {
+		return
+	}
+	log := req.log
+	req.markCancelled()
+	log.Warn("Tool call timed out, cancelling it", "tool", d.tool, "id", requestID, "timeout", d.timeout)
+	d.outcome = timeoutCancelled
+
+	cancel, _ := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "notifications/cancelled",
+		"params": map[string]interface{}{
+			"requestId": requestID,
+			"reason":    fmt.Sprintf("timed out after %v", d.timeout),
+		},
+	})
+	ping, _ := json.Marshal(map[string]interface{}{"jsonrpc": "2.0", "id": d.pingID, "method": "ping"})
+	for _, msg := range []json.RawMessage{cancel, ping} {
+		if err := b.writer.WriteFrame(msg); err != nil {
+			log.Error("Error writing to stdin", "error", err)
+			break
+		}
+		p.recorder.record(b.cmd.Process.Pid, "sent", msg)
+	}
+	d.timer = time.AfterFunc(p.config.CancelGracePeriod, func() { p.abandonCall(b, log, d) })
+}
+
+// abandonCall kills the MCP server, which did not respond within the grace
+// period after the call was cancelled. supervise restarts it.
+func (p *MCPProxy) abandonCall(b *backend, log Logger, d *callDeadline) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.settled {
+		return
+	}
+	log.Error("MCP server did not abort the cancelled tool call, restarting it",
+		"tool", d.tool, "pid", b.cmd.Process.Pid, "grace", p.config.CancelGracePeriod)
+	d.outcome = timeoutRestarted
+	b.abandoned.Store(true)
+	b.stopped.Store(true)
+	b.cmd.Process.Kill()
+}
+
+// settleDeadline stops the timers of d once readResponse has returned
+// response and err for the call. If the call timed out, it first reads on
+// until the reply to the ping, so that the late response to the call is
+// not taken for the response to the next request, and returns the timeout
+// error in place of the response.
+func (p *MCPProxy) settleDeadline(b *backend, req *request, requestID interface{}, d *callDeadline, response json.RawMessage, err error) (json.RawMessage, error) {
+	var outcome string
+	for {
+		d.mu.Lock()
+		outcome = d.outcome
+		if outcome == "" || err != nil || isResponseTo(response, d.pingID) {
+			d.settled = true
+			d.timer.Stop()
+			d.mu.Unlock()
+			break
+		}
+		d.mu.Unlock()
+		response, _, err = p.readResponse(b, req.log, d.pingID)
+	}
+
+	if outcome == "" {
+		return response, err
+	}
+	if err != nil {
+		// However it came to exit, the MCP server is gone.
+		outcome = timeoutRestarted
+	}
+	p.metrics.toolTimeouts.Inc(d.tool, outcome)
+	return toolCallTimeoutError(requestID, d.timeout, outcome), nil
+}
+
+// isResponseTo reports whether msg is the response to the request with the
+// given id.
+func isResponseTo(msg json.RawMessage, id interface{}) bool {
+	var m MCPMessage
+	return json.Unmarshal(msg, &m) == nil && m.HasID && formatID(m.ID) == formatID(id)
+}
+
+// toolCallTimeoutError returns the error sent to the client of a tool call
+// that timed out with the given outcome.
+func toolCallTimeoutError(id interface{}, timeout time.Duration, outcome string) json.RawMessage {
+	message := fmt.Sprintf("Tool call timed out after %v and was cancelled", timeout)
+	if outcome == timeoutRestarted {
+		message = fmt.Sprintf("Tool call timed out after %v and the MCP server did not abort it, so it was restarted", timeout)
+	}
+	data, _ := json.Marshal(map[string]string{"outcome": outcome, "timeout": timeout.String()})
+	response, _ := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      id,
+		"error":   &RPCError{Code: errToolCallTimeoutCode, Message: message, Data: data},
+	})
+	return response
+}
@@ -0,0 +1,174 @@
+package mcpproxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestToolCallTimeoutCancelled(t *testing.T) {
+	proxy := newFakeProxy(t, "stuck", Config{
+		ToolTimeouts:  map[string]time.Duration{"query": 100 * time.Millisecond},
+		EnableMetrics: true,
+	})
+	pid := proxy.currentBackend().cmd.Process.Pid
+
+	w := postJSON(proxy, `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"query"}}`)
+	body := w.Body.String()
+	if !strings.Contains(body, `"id":1`) || !strings.Contains(body, `"code":-32001`) || !strings.Contains(body, `"outcome":"cancelled"`) {
+		t.Fatalf("Expected a cancelled timeout error, got %s", body)
+	}
+
+	// The MCP server was told which request to cancel, and the reply to the
+	// ping was not taken for the response to the next request
+	w = postJSON(proxy, `{"jsonrpc":"2.0","id":2,"method":"tools/list"}`)
+	if body := w.Body.String(); !strings.Contains(body, `"id":2`) || !strings.Contains(body, `"cancelled":[1]`) {
+		t.Errorf("Expected the MCP server to have been sent notifications/cancelled, got %s", body)
+	}
+	if proxy.currentBackend().cmd.Process.Pid != pid {
+		t.Error("Expected the MCP server not to be restarted")
+	}
+
+	w = httptest.NewRecorder()
+	proxy.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if !strings.Contains(w.Body.String(), `mcp_proxy_tool_call_timeouts_total{server="test",tool="query",outcome="cancelled"} 1`) {
+		t.Errorf("Expected the timeout to be counted, got:\n%s", w.Body.String())
+	}
+}
+
+func TestToolCallTimeoutRestarted(t *testing.T) {
+	fastRestarts(t)
+	proxy := newFakeProxy(t, "hang", Config{
+		ToolCallTimeout:   100 * time.Millisecond,
+		CancelGracePeriod: 100 * time.Millisecond,
+		EnableMetrics:     true,
+	})
+	pid := proxy.currentBackend().cmd.Process.Pid
+
+	w := postJSON(proxy, `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"query"}}`)
+	body := w.Body.String()
+	if !strings.Contains(body, `"code":-32001`) || !strings.Contains(body, `"outcome":"restarted"`) {
+		t.Fatalf("Expected a restarted timeout error, got %s", body)
+	}
+
+	// The MCP server is restarted although MaxRestarts is 0, and the kill
+	// does not count as a crash
+	deadline := time.Now().Add(5 * time.Second)
+	for proxy.Status().State != StateRunning || proxy.currentBackend().cmd.Process.Pid == pid {
+		if time.Now().After(deadline) {
+			t.Fatalf("MCP server was not restarted, status: %+v", proxy.Status())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if status := proxy.Status(); status.Restarts != 1 || status.Crashes != 0 {
+		t.Errorf("Expected one restart and no crashes, got %+v", status)
+	}
+
+	w = httptest.NewRecorder()
+	proxy.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if !strings.Contains(w.Body.String(), `mcp_proxy_tool_call_timeouts_total{server="test",tool="query",outcome="restarted"} 1`) {
+		t.Errorf("Expected the timeout to be counted, got:\n%s", w.Body.String())
+	}
+}
+
+func TestToolCallWithinTimeout(t *testing.T) {
+	proxy := newFakeProxy(t, "mcp", Config{ToolCallTimeout: time.Second})
+
+	w := postJSON(proxy, `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"echo","arguments":{"a":1}}}`)
+	if body := w.Body.String(); !strings.Contains(body, `"result"`) || strings.Contains(body, "-32001") {
+		t.Errorf("Expected the tool result, got %s", body)
+	}
+}
+
+// sentMeta posts body to proxy, whose MCP server runs in "meta" mode, with
+// the given request context, and returns the _meta the server received.
+func sentMeta(t *testing.T, proxy *MCPProxy, ctx context.Context, body string) map[string]interface{} {
+	t.Helper()
+	r := httptest.NewRequest("POST", "/", strings.NewReader(body)).WithContext(ctx)
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	proxy.Handle(w, r)
+	var resp struct {
+		Result struct {
+			Meta map[string]interface{} `json:"meta"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Unexpected response %d: %s", w.Code, w.Body.String())
+	}
+	return resp.Result.Meta
+}
+
+func TestPropagateDeadlines(t *testing.T) {
+	proxy := newFakeProxy(t, "meta", Config{PropagateDeadlines: true, ToolCallTimeout: 2 * time.Second})
+
+	// _meta is created for params without one
+	before := time.Now()
+	meta := sentMeta(t, proxy, context.Background(), `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"q"}}`)
+	deadline, err := time.Parse(deadlineFormat, fmt.Sprint(meta["deadline"]))
+	if err != nil || deadline.Before(before.Add(2*time.Second).Truncate(time.Millisecond)) || deadline.After(time.Now().Add(2*time.Second)) {
+		t.Errorf("Expected a deadline 2s after the call was sent, got %v", meta)
+	}
+	if ms, _ := meta["timeoutMs"].(float64); ms <= 1900 || ms > 2000 {
+		t.Errorf("Expected timeoutMs of the tool call timeout, got %v", meta)
+	}
+	if !strings.HasSuffix(fmt.Sprint(meta["deadline"]), "Z") || len(fmt.Sprint(meta["deadline"])) != len("2006-01-02T15:04:05.000Z") {
+		t.Errorf("Expected an RFC 3339 UTC time in milliseconds, got %v", meta["deadline"])
+	}
+
+	// A shorter deadline from the client is kept as is, along with the rest
+	// of its _meta
+	short := time.Now().Add(500 * time.Millisecond).UTC().Format(deadlineFormat)
+	meta = sentMeta(t, proxy, context.Background(), `{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"q","_meta":{"deadline":"`+
+		short+`","timeoutMs":500,"traceId":"t1"}}}`)
+	if meta["deadline"] != short || meta["timeoutMs"] != float64(500) || meta["traceId"] != "t1" {
+		t.Errorf("Expected the client's deadline to be preserved, got %v", meta)
+	}
+
+	// A longer one is shortened to the proxy's
+	long := time.Now().Add(time.Hour).UTC().Format(deadlineFormat)
+	meta = sentMeta(t, proxy, context.Background(), `{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"q","_meta":{"deadline":"`+
+		long+`","traceId":"t1"}}}`)
+	if meta["deadline"] == long || meta["timeoutMs"] == nil || meta["traceId"] != "t1" {
+		t.Errorf("Expected the client's deadline not to be extended, got %v", meta)
+	}
+
+	// Without a timeout in effect nothing is added
+	if meta := sentMeta(t, proxy, context.Background(), `{"jsonrpc":"2.0","id":4,"method":"tools/list"}`); meta != nil {
+		t.Errorf("Expected no _meta without a deadline, got %v", meta)
+	}
+
+	// Nor without PropagateDeadlines
+	proxy = newFakeProxy(t, "meta", Config{ToolCallTimeout: 2 * time.Second})
+	if meta := sentMeta(t, proxy, context.Background(), `{"jsonrpc":"2.0","id":5,"method":"tools/call","params":{"name":"q"}}`); meta != nil {
+		t.Errorf("Expected no _meta by default, got %v", meta)
+	}
+}
+
+func TestPropagateDeadlinesAfterQueueing(t *testing.T) {
+	proxy := newFakeProxy(t, "meta", Config{PropagateDeadlines: true})
+
+	// The client's deadline runs while the request waits behind a slow one
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		sentMeta(t, proxy, context.Background(), `{"jsonrpc":"2.0","id":1,"method":"x","params":{"delayMs":500}}`)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	want, _ := ctx.Deadline()
+	meta := sentMeta(t, proxy, ctx, `{"jsonrpc":"2.0","id":2,"method":"x"}`)
+	<-done
+
+	if meta["deadline"] != want.UTC().Format(deadlineFormat) {
+		t.Errorf("Expected the client's deadline, got %v", meta)
+	}
+	if ms, _ := meta["timeoutMs"].(float64); ms <= 0 || ms > 1650 {
+		t.Errorf("Expected timeoutMs to discount the time queued, got %v", meta)
+	}
+}
@@ -0,0 +1,160 @@
+package mcpproxy
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Defaults of the token refresh schedule, see Config.TokenRefresher.
+const (
+	defaultTokenRefreshMargin   = 5 * time.Minute
+	defaultTokenRefreshInterval = time.Hour // for tokens without an expiry
+)
+
+// tokenRefreshTimeout bounds each call to Config.TokenRefresher.
+const tokenRefreshTimeout = 30 * time.Second
+
+// tokenRetryDelay is how long a failed refresh waits before it is retried,
+// at most; it is retried sooner if the token expires before.
+var tokenRetryDelay = 30 * time.Second
+
+// minTokenRefreshDelay is the shortest wait between refreshes, however soon
+// the token expires.
+var minTokenRefreshDelay = time.Second
+
+// tokenSource holds the token obtained from Config.TokenRefresher, which
+// every MCP server is started with.
+type tokenSource struct {
+	refresher func(ctx context.Context) (string, time.Time, error)
+	envVar    string
+	margin    time.Duration
+	redactor  *redactor // redacts every token obtained
+
+	mu     sync.Mutex
+	token  string
+	expiry time.Time // zero if the token does not expire
+}
+
+// newTokenSource returns the token source configured by cfg, adding its
+// tokens to r, or nil if it has no TokenRefresher.
+func newTokenSource(cfg Config, r *redactor) *tokenSource {
+	if cfg.TokenRefresher == nil {
+		return nil
+	}
+	margin := cfg.TokenRefreshMargin
+	if margin <= 0 {
+		margin = defaultTokenRefreshMargin
+	}
+	return &tokenSource{refresher: cfg.TokenRefresher, envVar: cfg.TokenEnvVar, margin: margin, redactor: r}
+}
+
+// validateTokenRefresher checks that cfg names the variable holding the
+// tokens of its TokenRefresher.
+func validateTokenRefresher(cfg Config) error {
+	if cfg.TokenRefresher != nil && !isEnvName(cfg.TokenEnvVar) {
+		return errors.New("TokenRefresher requires TokenEnvVar to name an environment variable")
+	}
+	return nil
+}
+
+// refresh obtains a new token and reports whether it differs from the
+// current one.
+func (t *tokenSource) refresh(ctx context.Context) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, tokenRefreshTimeout)
+	defer cancel()
+	token, expiry, err := t.refresher(ctx)
+	if err == nil && token == "" {
+		err = errors.New("empty token")
+	}
+	if err != nil {
+		return false, err
+	}
+	t.redactor.add(token)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	changed := token != t.token
+	t.token, t.expiry = token, expiry
+	return changed, nil
+}
+
+// env returns the environment variable setting the current token for the
+// MCP server, nil if t is.
+func (t *tokenSource) env() []string {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return []string{t.envVar + "=" + t.token}
+}
+
+// next returns how long to wait before the next refresh: until the margin
+// before the token expires, or a quarter of the time left if that is
+// shorter, so short-lived tokens are not refreshed continuously. Failed
+// refreshes are retried after tokenRetryDelay, or sooner while the token
+// is still valid.
+func (t *tokenSource) next(failed bool) time.Duration {
+	t.mu.Lock()
+	expiry := t.expiry
+	t.mu.Unlock()
+
+	if expiry.IsZero() {
+		if failed {
+			return tokenRetryDelay
+		}
+		return defaultTokenRefreshInterval
+	}
+	left := time.Until(expiry)
+	switch {
+	case !failed:
+		return max(left-min(t.margin, left/4), minTokenRefreshDelay)
+	case left > 0:
+		return max(min(tokenRetryDelay, left/2), minTokenRefreshDelay)
+	default:
+		return tokenRetryDelay
+	}
+}
+
+// refreshTokens refreshes the token on schedule until the proxy is closed,
+// restarting the MCP server whenever it changes so it uses the new one.
+func (p *MCPProxy) refreshTokens() {
+	defer close(p.refreshed)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-p.stopping
+		cancel()
+	}()
+
+	failed := false
+	for {
+		timer := time.NewTimer(p.tokens.next(failed))
+		select {
+		case <-p.stopping:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		changed, err := p.tokens.refresh(ctx)
+		failed = err != nil
+		switch {
+		case failed:
+			p.metrics.tokenRefreshes.Inc("error")
+			if ctx.Err() == nil {
+				p.log.Error("Failed to refresh token", "error", err)
+			}
+		case changed:
+			p.metrics.tokenRefreshes.Inc("ok")
+			p.log.Info("Refreshed token, restarting MCP server", "env", p.tokens.envVar)
+			if p.Restart("token refreshed") != nil {
+				return
+			}
+		default:
+			p.metrics.tokenRefreshes.Inc("unchanged")
+		}
+	}
+}
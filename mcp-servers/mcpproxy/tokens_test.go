@@ -0,0 +1,186 @@
+package mcpproxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rh-ai-kickstart/ai-architecture-charts/mcp-servers/mcpproxy/internal/fakebackend"
+)
+
+// fakeRefresher hands out token-1, token-2 and so on, each expiring after
+// lifetime, failing while fail is set.
+type fakeRefresher struct {
+	mu       sync.Mutex
+	calls    int
+	lifetime time.Duration
+	fail     bool
+}
+
+func (f *fakeRefresher) refresh(ctx context.Context) (string, time.Time, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.fail {
+		return "", time.Time{}, errors.New("token service unavailable")
+	}
+	f.calls++
+	return fmt.Sprintf("token-%d", f.calls), time.Now().Add(f.lifetime), nil
+}
+
+func (f *fakeRefresher) setFail(fail bool) {
+	f.mu.Lock()
+	f.fail = fail
+	f.mu.Unlock()
+}
+
+// serverToken returns the token the MCP server of an "env" proxy was
+// started with.
+func serverToken(t *testing.T, proxy *MCPProxy) string {
+	t.Helper()
+	w := postJSON(proxy, `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"TEST_TOKEN"}}`)
+	var resp struct {
+		Result struct {
+			Value string `json:"value"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Unexpected response %d %s", w.Code, w.Body.String())
+	}
+	return resp.Result.Value
+}
+
+func TestTokenRefresher(t *testing.T) {
+	fastRestarts(t)
+	minDelay, retry := minTokenRefreshDelay, tokenRetryDelay
+	minTokenRefreshDelay, tokenRetryDelay = time.Millisecond, 20*time.Millisecond
+	t.Cleanup(func() { minTokenRefreshDelay, tokenRetryDelay = minDelay, retry })
+
+	// Tokens are refreshed a quarter of their lifetime before they expire,
+	// here every 900ms
+	f := &fakeRefresher{lifetime: 1200 * time.Millisecond}
+	proxy := newFakeProxy(t, "env", Config{TokenRefresher: f.refresh, TokenEnvVar: "TEST_TOKEN"})
+	if token := serverToken(t, proxy); token != "token-1" {
+		t.Fatalf("Expected the first server to get the first token, got %q", token)
+	}
+
+	// The server is restarted with each new token
+	newToken := func(old string) string {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			if token := serverToken(t, proxy); token != old {
+				return token
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("Expected the server to be restarted with a token other than %s", old)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	if token := newToken("token-1"); token != "token-2" {
+		t.Errorf("Expected the second token, got %q", token)
+	}
+	if status := proxy.Status(); status.Crashes != 0 || status.Restarts == 0 {
+		t.Errorf("Expected restarts that do not count as crashes, got %+v", status)
+	}
+
+	// Failures keep the current token and are retried
+	f.setFail(true)
+	current := serverToken(t, proxy)
+	deadline := time.Now().Add(5 * time.Second)
+	for proxy.metrics.tokenRefreshes.Value("error") < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected failed refreshes to be counted and retried")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if token := serverToken(t, proxy); token != current {
+		t.Errorf("Expected the server to keep %s while refreshes fail, got %q", current, token)
+	}
+	f.setFail(false)
+	newToken(current)
+}
+
+func TestRefreshedTokensAreRedacted(t *testing.T) {
+	fastRestarts(t)
+	minDelay := minTokenRefreshDelay
+	minTokenRefreshDelay = time.Millisecond
+	t.Cleanup(func() { minTokenRefreshDelay = minDelay })
+
+	// Each MCP server prints the token it was started with
+	var calls int
+	var mu sync.Mutex
+	refresher := func(ctx context.Context) (string, time.Time, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		return fmt.Sprintf("refreshed-Secret.%d", calls), time.Now().Add(400 * time.Millisecond), nil
+	}
+	logs := &recordingLogger{}
+	path, args := fakebackend.Command("reflect")
+	proxy, err := NewMCPProxy(Config{
+		ServerName:     "test",
+		CommandPath:    "echo using $TEST_TOKEN >&2; exec " + path,
+		CommandArgs:    args,
+		UseShell:       true,
+		Logger:         logs,
+		TokenRefresher: refresher,
+		TokenEnvVar:    "TEST_TOKEN",
+	})
+	if err != nil {
+		t.Fatalf("NewMCPProxy failed: %v", err)
+	}
+	defer proxy.Close()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for strings.Count(logs.String(), "line=using [REDACTED]") < 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected servers started with refreshed tokens to log them redacted, got:\n%s", logs.String())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if strings.Contains(logs.String(), "refreshed-Secret") {
+		t.Errorf("Expected refreshed tokens to be redacted from the log, got:\n%s", logs.String())
+	}
+}
+
+func TestTokenRefresherRequired(t *testing.T) {
+	f := &fakeRefresher{lifetime: time.Hour}
+	if _, err := NewMCPProxy(Config{ServerName: "test", CommandPath: "cat", TokenRefresher: f.refresh}); err == nil {
+		t.Error("Expected a TokenRefresher without TokenEnvVar to be rejected")
+	}
+
+	f.setFail(true)
+	if _, err := NewMCPProxy(Config{ServerName: "test", CommandPath: "cat", TokenRefresher: f.refresh, TokenEnvVar: "TEST_TOKEN"}); err == nil {
+		t.Error("Expected NewMCPProxy to fail without a first token")
+	}
+}
+
+func TestTokenRefreshSchedule(t *testing.T) {
+	ts := &tokenSource{margin: 5 * time.Minute}
+	for _, tc := range []struct {
+		lifetime time.Duration
+		failed   bool
+		min, max time.Duration
+	}{
+		{time.Hour, false, 54 * time.Minute, 55 * time.Minute},
+		{8 * time.Minute, false, 5*time.Minute + 50*time.Second, 6 * time.Minute},
+		{time.Hour, true, tokenRetryDelay - time.Second, tokenRetryDelay},
+		{-time.Minute, true, tokenRetryDelay, tokenRetryDelay},
+		{0, false, defaultTokenRefreshInterval, defaultTokenRefreshInterval},
+	} {
+		ts.expiry = time.Time{}
+		if tc.lifetime != 0 {
+			ts.expiry = time.Now().Add(tc.lifetime)
+		}
+		if next := ts.next(tc.failed); next < tc.min || next > tc.max {
+			t.Errorf("Expected a token valid for %s (failed %t) to be refreshed in %s to %s, got %s",
+				tc.lifetime, tc.failed, tc.min, tc.max, next)
+		}
+	}
+}
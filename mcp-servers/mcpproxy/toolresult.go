@@ -0,0 +1,93 @@
+package mcpproxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// The values of Config.ToolResultProcessorErrors.
+const (
+	toolResultPassthrough = "passthrough"
+	toolResultFail        = "fail"
+)
+
+// validateToolResultProcessorErrors checks cfg.ToolResultProcessorErrors.
+func validateToolResultProcessorErrors(cfg Config) error {
+	switch cfg.ToolResultProcessorErrors {
+	case "", toolResultPassthrough, toolResultFail:
+		return nil
+	}
+	return fmt.Errorf("invalid ToolResultProcessorErrors %q: expected %q or %q",
+		cfg.ToolResultProcessorErrors, toolResultPassthrough, toolResultFail)
+}
+
+// processToolResult runs the processor registered for the tool req called,
+// if any, on the result of response, the response to req with the given
+// id, and splices its output back in place of the result. Responses without
+// a result, such as errors, are returned unchanged, and so is response if
+// the processor fails, unless Config.ToolResultProcessorErrors is "fail".
+func (p *MCPProxy) processToolResult(req *request, requestID interface{}, response json.RawMessage) json.RawMessage {
+	process, ok := p.config.ToolResultProcessors[req.tool]
+	if !ok || req.method != "tools/call" {
+		return response
+	}
+	start, end, ok := findResult(response)
+	if !ok {
+		return response
+	}
+
+	var processed []byte
+	var err error
+	if id := callMiddleware(req.log, "ToolResultProcessors", func() { processed, err = process(response[start:end]) }); id != "" {
+		return middlewareError(requestID, id)
+	}
+	if err == nil && !json.Valid(processed) {
+		err = errors.New("processor returned invalid JSON")
+	}
+	if err != nil {
+		if p.config.ToolResultProcessorErrors == toolResultFail {
+			req.log.Error("Tool result processor failed", "tool", req.tool, "error", err)
+			return jsonRPCError(requestID, -32603, fmt.Sprintf("Failed to process the result of tool %q", req.tool))
+		}
+		req.log.Warn("Tool result processor failed, returning the result unchanged", "tool", req.tool, "error", err)
+		return response
+	}
+
+	return spliceResult(response, start, end, bytes.TrimSpace(processed))
+}
+
+// spliceResult returns response with the bytes from start to end, the value
+// of its result member as found by findResult, replaced by result.
+func spliceResult(response json.RawMessage, start, end int, result []byte) json.RawMessage {
+	spliced := make([]byte, 0, len(response)-(end-start)+len(result))
+	spliced = append(spliced, response[:start]...)
+	spliced = append(spliced, result...)
+	return append(spliced, response[end:]...)
+}
+
+// findResult returns the offsets of the value of the top-level "result"
+// member of response, so that it can be replaced leaving the other members
+// exactly as they were.
+func findResult(response json.RawMessage) (start, end int, ok bool) {
+	dec := json.NewDecoder(bytes.NewReader(response))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return 0, 0, false
+	}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return 0, 0, false
+		}
+		var value json.RawMessage
+		if dec.Decode(&value) != nil {
+			return 0, 0, false
+		}
+		if tok == "result" {
+			end := int(dec.InputOffset())
+			return end - len(value), end, true
+		}
+	}
+	return 0, 0, false
+}
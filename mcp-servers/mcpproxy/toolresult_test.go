@@ -0,0 +1,76 @@
+package mcpproxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestToolResultSplicing(t *testing.T) {
+	upper := func(result []byte) ([]byte, error) { return bytes.ToUpper(result), nil }
+	p := &MCPProxy{config: Config{ToolResultProcessors: map[string]func([]byte) ([]byte, error){"echo": upper}}}
+	req := &request{method: "tools/call", tool: "echo", log: &recordingLogger{}}
+
+	for _, tc := range []struct{ response, want string }{
+		{
+			`{"jsonrpc":"2.0","id":7,"result":{"text":"hi"}}`,
+			`{"jsonrpc":"2.0","id":7,"result":{"TEXT":"HI"}}`,
+		},
+		{
+			// Other members keep their order, spacing and escapes
+			"{ \"result\" :\t{\"text\": \"hi\"} ,\n \"id\":\"a\\u0062\", \"_x\":{\"result\":1},\"jsonrpc\" : \"2.0\"}",
+			"{ \"result\" :\t{\"TEXT\": \"HI\"} ,\n \"id\":\"a\\u0062\", \"_x\":{\"result\":1},\"jsonrpc\" : \"2.0\"}",
+		},
+		{
+			// Errors have no result to process
+			`{"jsonrpc":"2.0","id":7,"error":{"code":-32000,"message":"no"}}`,
+			`{"jsonrpc":"2.0","id":7,"error":{"code":-32000,"message":"no"}}`,
+		},
+	} {
+		if got := p.processToolResult(req, 7, json.RawMessage(tc.response)); string(got) != tc.want {
+			t.Errorf("Expected %s, got %s", tc.want, got)
+		}
+	}
+
+	// Other tools are left alone
+	other := &request{method: "tools/call", tool: "other", log: &recordingLogger{}}
+	if got := p.processToolResult(other, 7, json.RawMessage(`{"id":7,"result":{"a":1}}`)); string(got) != `{"id":7,"result":{"a":1}}` {
+		t.Errorf("Expected the response unchanged, got %s", got)
+	}
+}
+
+func TestToolResultProcessors(t *testing.T) {
+	failing := func([]byte) ([]byte, error) { return nil, errors.New("boom") }
+	processors := map[string]func([]byte) ([]byte, error){
+		"echo": func(result []byte) ([]byte, error) {
+			return []byte(`{"content":[{"type":"text","text":"processed"}]}`), nil
+		},
+		"fail": failing,
+	}
+	logs := &recordingLogger{}
+	proxy := newFakeProxy(t, "mcp", Config{ToolResultProcessors: processors, Logger: logs})
+
+	w := postJSON(proxy, `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"echo","arguments":{}}}`)
+	if want := `{"id":1,"jsonrpc":"2.0","result":{"content":[{"type":"text","text":"processed"}]}}`; strings.TrimSpace(w.Body.String()) != want {
+		t.Errorf("Expected %s, got %s", want, w.Body.String())
+	}
+
+	// By default a failing processor passes the result through
+	w = postJSON(proxy, `{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"fail"}}`)
+	if !strings.Contains(w.Body.String(), `"text":"failed"`) {
+		t.Errorf("Expected the original result, got %s", w.Body.String())
+	}
+	waitForLog(t, logs, "Tool result processor failed, returning the result unchanged server=test tool=fail error=boom")
+
+	proxy = newFakeProxy(t, "mcp", Config{ToolResultProcessors: processors, ToolResultProcessorErrors: "fail"})
+	w = postJSON(proxy, `{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"fail"}}`)
+	if code := rpcErrorOf(t, w); code != -32603 || !strings.Contains(w.Body.String(), `result of tool \"fail\"`) {
+		t.Errorf("Expected the call to fail, got %d %s", w.Code, w.Body.String())
+	}
+
+	if _, err := NewMCPProxy(Config{CommandPath: "cat", ToolResultProcessorErrors: "drop"}); err == nil {
+		t.Error("Expected an invalid ToolResultProcessorErrors to be rejected")
+	}
+}
@@ -0,0 +1,119 @@
+package mcpproxy
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strconv"
+)
+
+// inlineContentTypes are the MIME types unwrapped content is served as
+// inline. A browser renders none of them as an active document, as it
+// would HTML or SVG from an MCP server, with the proxy's origin; content
+// of any other type is served as a download of application/octet-stream.
+var inlineContentTypes = map[string]bool{
+	"text/plain":       true,
+	"text/csv":         true,
+	"application/json": true,
+	"application/pdf":  true,
+	"image/png":        true,
+	"image/jpeg":       true,
+	"image/gif":        true,
+	"image/webp":       true,
+	"audio/mpeg":       true,
+	"audio/ogg":        true,
+	"audio/wav":        true,
+	"audio/webm":       true,
+}
+
+// contentBlock is the subset of an MCP tool result content block needed to
+// return it unwrapped.
+type contentBlock struct {
+	Type     string `json:"type"`
+	Text     string `json:"text"`
+	Data     string `json:"data"`
+	MimeType string `json:"mimeType"`
+	Resource *struct {
+		MimeType string  `json:"mimeType"`
+		Text     *string `json:"text"`
+		Blob     string  `json:"blob"`
+	} `json:"resource"`
+}
+
+// wantsRawContent reports whether the client asked for unwrapped content.
+func wantsRawContent(r *http.Request) bool {
+	if raw, err := strconv.ParseBool(r.Header.Get("X-MCP-Raw")); err == nil && raw {
+		return true
+	}
+	raw, err := strconv.ParseBool(r.URL.Query().Get("raw"))
+	return err == nil && raw
+}
+
+// unwrapSingleContent extracts the decoded bytes and MIME type of a tool
+// result consisting of exactly one content block. It returns ok=false for
+// errors, tool errors, multi-block results and unknown block types.
+func unwrapSingleContent(response []byte) (content []byte, contentType string, ok bool) {
+	var msg struct {
+		Error  json.RawMessage `json:"error"`
+		Result *struct {
+			Content []contentBlock `json:"content"`
+			IsError bool           `json:"isError"`
+		} `json:"result"`
+	}
+	if json.Unmarshal(response, &msg) != nil || msg.Error != nil || msg.Result == nil {
+		return nil, "", false
+	}
+	if msg.Result.IsError || len(msg.Result.Content) != 1 {
+		return nil, "", false
+	}
+
+	block := msg.Result.Content[0]
+	switch block.Type {
+	case "text":
+		return []byte(block.Text), "text/plain; charset=utf-8", true
+	case "image", "audio":
+		data, err := base64.StdEncoding.DecodeString(block.Data)
+		if err != nil {
+			return nil, "", false
+		}
+		return data, mimeTypeOrDefault(block.MimeType), true
+	case "resource":
+		if block.Resource == nil {
+			return nil, "", false
+		}
+		if block.Resource.Text != nil {
+			contentType := block.Resource.MimeType
+			if contentType == "" {
+				contentType = "text/plain; charset=utf-8"
+			}
+			return []byte(*block.Resource.Text), contentType, true
+		}
+		data, err := base64.StdEncoding.DecodeString(block.Resource.Blob)
+		if err != nil {
+			return nil, "", false
+		}
+		return data, mimeTypeOrDefault(block.Resource.MimeType), true
+	}
+	return nil, "", false
+}
+
+// setRawContentHeaders sets the headers of unwrapped content of the given
+// MIME type, see inlineContentTypes. The content is sandboxed in any case.
+func setRawContentHeaders(w http.ResponseWriter, contentType string) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || !inlineContentTypes[mediaType] {
+		contentType = "application/octet-stream"
+		w.Header().Set("Content-Disposition", "attachment")
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "sandbox")
+}
+
+func mimeTypeOrDefault(mimeType string) string {
+	if mimeType == "" {
+		return "application/octet-stream"
+	}
+	return mimeType
+}
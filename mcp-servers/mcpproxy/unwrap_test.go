@@ -0,0 +1,145 @@
+package mcpproxy
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestUnwrapSingleContent(t *testing.T) {
+	tests := []struct {
+		name        string
+		response    string
+		ok          bool
+		content     string
+		contentType string
+	}{
+		{
+			name:        "image",
+			response:    `{"jsonrpc":"2.0","id":1,"result":{"content":[{"type":"image","data":"iVBORw==","mimeType":"image/png"}]}}`,
+			ok:          true,
+			content:     "\x89PNG",
+			contentType: "image/png",
+		},
+		{
+			name:        "text",
+			response:    `{"jsonrpc":"2.0","id":1,"result":{"content":[{"type":"text","text":"hello"}]}}`,
+			ok:          true,
+			content:     "hello",
+			contentType: "text/plain; charset=utf-8",
+		},
+		{
+			name:        "resource blob",
+			response:    `{"jsonrpc":"2.0","id":1,"result":{"content":[{"type":"resource","resource":{"uri":"file:///a.pdf","mimeType":"application/pdf","blob":"JVBERg=="}}]}}`,
+			ok:          true,
+			content:     "%PDF",
+			contentType: "application/pdf",
+		},
+		{
+			name:        "resource text",
+			response:    `{"jsonrpc":"2.0","id":1,"result":{"content":[{"type":"resource","resource":{"uri":"file:///a.csv","mimeType":"text/csv","text":"a,b"}}]}}`,
+			ok:          true,
+			content:     "a,b",
+			contentType: "text/csv",
+		},
+		{
+			name:     "multiple blocks",
+			response: `{"jsonrpc":"2.0","id":1,"result":{"content":[{"type":"text","text":"a"},{"type":"text","text":"b"}]}}`,
+		},
+		{
+			name:     "tool error",
+			response: `{"jsonrpc":"2.0","id":1,"result":{"isError":true,"content":[{"type":"text","text":"boom"}]}}`,
+		},
+		{
+			name:     "rpc error",
+			response: `{"jsonrpc":"2.0","id":1,"error":{"code":-32601,"message":"not found"}}`,
+		},
+		{
+			name:     "invalid base64",
+			response: `{"jsonrpc":"2.0","id":1,"result":{"content":[{"type":"image","data":"%%%","mimeType":"image/png"}]}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content, contentType, ok := unwrapSingleContent([]byte(tt.response))
+			if ok != tt.ok {
+				t.Fatalf("unwrapSingleContent ok = %v, want %v", ok, tt.ok)
+			}
+			if string(content) != tt.content || contentType != tt.contentType {
+				t.Errorf("unwrapSingleContent = %q, %q; want %q, %q", content, contentType, tt.content, tt.contentType)
+			}
+		})
+	}
+}
+
+const imageCall = `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"result":{"content":[{"type":"image","data":"iVBORw==","mimeType":"image/png"}]}}}`
+
+func TestHandleUnwrapSingleContent(t *testing.T) {
+	proxy := newFakeProxy(t, "reflect", Config{UnwrapSingleContent: true})
+
+	for _, target := range []string{"/?raw=true", "/"} {
+		req := httptest.NewRequest("POST", target, strings.NewReader(imageCall))
+		if target == "/" {
+			req.Header.Set("X-MCP-Raw", "true")
+		}
+		w := httptest.NewRecorder()
+		proxy.Handle(w, req)
+
+		if w.Header().Get("Content-Type") != "image/png" {
+			t.Errorf("%s: expected Content-Type image/png, got %q", target, w.Header().Get("Content-Type"))
+		}
+		if !bytes.Equal(w.Body.Bytes(), []byte("\x89PNG")) {
+			t.Errorf("%s: expected decoded image bytes, got %q", target, w.Body.Bytes())
+		}
+	}
+}
+
+func TestUnwrappedActiveContentIsDownloaded(t *testing.T) {
+	proxy := newFakeProxy(t, "reflect", Config{UnwrapSingleContent: true})
+
+	for _, tc := range []struct {
+		mimeType, contentType, disposition string
+	}{
+		{"text/html", "application/octet-stream", "attachment"},
+		{"image/svg+xml", "application/octet-stream", "attachment"},
+		{"not a type", "application/octet-stream", "attachment"},
+		{"text/plain; charset=utf-8", "text/plain; charset=utf-8", ""},
+		{"Image/PNG", "Image/PNG", ""},
+	} {
+		call := `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"result":{"content":[{"type":"resource","resource":{"uri":"file:///a","mimeType":"` + tc.mimeType + `","text":"<script>alert(1)</script>"}}]}}}`
+		req := httptest.NewRequest("POST", "/?raw=true", strings.NewReader(call))
+		w := httptest.NewRecorder()
+		proxy.Handle(w, req)
+
+		if got := w.Header().Get("Content-Type"); got != tc.contentType {
+			t.Errorf("%s: expected Content-Type %q, got %q", tc.mimeType, tc.contentType, got)
+		}
+		if got := w.Header().Get("Content-Disposition"); got != tc.disposition {
+			t.Errorf("%s: expected Content-Disposition %q, got %q", tc.mimeType, tc.disposition, got)
+		}
+		if got := w.Header().Get("Content-Security-Policy"); got != "sandbox" {
+			t.Errorf("%s: expected the content to be sandboxed, got %q", tc.mimeType, got)
+		}
+	}
+}
+
+func TestHandleUnwrapKeepsEnvelopeByDefault(t *testing.T) {
+	for _, cfg := range []Config{{UnwrapSingleContent: true}, {UnwrapSingleContent: false}} {
+		proxy := newFakeProxy(t, "reflect", cfg)
+
+		target := "/"
+		if !cfg.UnwrapSingleContent {
+			target = "/?raw=true"
+		}
+		req := httptest.NewRequest("POST", target, strings.NewReader(imageCall))
+		w := httptest.NewRecorder()
+		proxy.Handle(w, req)
+
+		if w.Header().Get("Content-Type") != "application/json" {
+			t.Errorf("UnwrapSingleContent=%v %s: expected JSON envelope, got %q",
+				cfg.UnwrapSingleContent, target, w.Header().Get("Content-Type"))
+		}
+	}
+}
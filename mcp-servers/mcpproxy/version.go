@@ -0,0 +1,82 @@
+package mcpproxy
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Build information, set at link time with e.g.
+//
+//	go build -ldflags "-X github.com/rh-ai-kickstart/ai-architecture-charts/mcp-servers/mcpproxy.Version=v1.2.3"
+var (
+	Version   = "dev"
+	Commit    = "unknown"
+	BuildDate = "unknown"
+)
+
+// backendVersionTimeout bounds how long BackendVersion waits for the MCP
+// server to print its version. JVM-based servers take a few seconds.
+const backendVersionTimeout = 15 * time.Second
+
+// VersionString describes the proxy build on a single line.
+func VersionString() string {
+	return fmt.Sprintf("mcpproxy %s (commit %s, built %s, %s)", Version, Commit, BuildDate, runtime.Version())
+}
+
+// PrintVersion writes the proxy build information to w, followed by the MCP
+// server's version if cfg.BackendVersionArgs is set. Mains use it to
+// implement a --version flag.
+func PrintVersion(w io.Writer, cfg Config) {
+	fmt.Fprintln(w, VersionString())
+	if v := BackendVersion(cfg); v != "" {
+		fmt.Fprintf(w, "%s: %s\n", cfg.ServerName, v)
+	}
+}
+
+// BackendVersion runs the MCP server binary with cfg.BackendVersionArgs,
+// through the configured launcher, and returns the first line it prints, or
+// "" if BackendVersionArgs is unset or the binary does not support it.
+func BackendVersion(cfg Config) string {
+	if len(cfg.BackendVersionArgs) == 0 {
+		return ""
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), backendVersionTimeout)
+	defer cancel()
+
+	cmd, err := backendCommand(ctx, cfg, cfg.BackendVersionArgs)
+	if err != nil {
+		newLogger(cfg).Warn("Could not get MCP server version", "error", err)
+		return ""
+	}
+	// The command is reaped even if something it started keeps its output
+	// open.
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	cmd.WaitDelay = time.Second
+	if err := startChild(cmd); err != nil {
+		newLogger(cfg).Warn("Could not get MCP server version", "error", err)
+		return ""
+	}
+	err = cmd.Wait()
+	childReaped(cmd)
+	if err != nil {
+		newLogger(cfg).Warn("Could not get MCP server version", "error", err)
+		return ""
+	}
+
+	scanner := bufio.NewScanner(&out)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			return line
+		}
+	}
+	return ""
+}
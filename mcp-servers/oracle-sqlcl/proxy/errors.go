@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+
+	"github.com/rh-ai-kickstart/ai-architecture-charts/mcp-servers/mcpproxy"
+)
+
+// oraHints maps common Oracle error codes to messages that make sense to
+// someone who does not know the ORA- catalogue by heart.
+var oraHints = map[string]string{
+	"ORA-00001": "unique constraint violated: a row with the same key already exists",
+	"ORA-00904": "invalid identifier: check the column names in the query",
+	"ORA-00933": "SQL command not properly ended: check the query syntax",
+	"ORA-00942": "table or view does not exist",
+	"ORA-01017": "invalid username or password",
+	"ORA-01031": "insufficient privileges for this operation",
+	"ORA-01722": "invalid number: a value could not be converted to a number",
+	"ORA-12154": "could not resolve the database connect identifier",
+	"ORA-12541": "no listener at the database address: is the database running?",
+	"ORA-12578": "the Oracle wallet could not be opened",
+	"ORA-28000": "the database account is locked",
+	"ORA-28759": "a wallet or TLS certificate file could not be opened",
+}
+
+var oraCode = regexp.MustCompile(`ORA-\d{5}`)
+
+// mapOracleError replaces the message of errors carrying a known ORA- code
+// with a readable hint. The original message is kept in the error data so
+// nothing is lost for debugging.
+func mapOracleError(method string, rpcErr *mcpproxy.RPCError) *mcpproxy.RPCError {
+	if rpcErr.Code == toolCallTimeoutCode {
+		return explainTimeout(rpcErr)
+	}
+	code := oraCode.FindString(rpcErr.Message)
+	hint, ok := oraHints[code]
+	if !ok {
+		return nil
+	}
+
+	data, err := json.Marshal(map[string]interface{}{
+		"oraCode":         code,
+		"originalMessage": rpcErr.Message,
+		"originalData":    rpcErr.Data,
+	})
+	if err != nil {
+		return nil
+	}
+	return &mcpproxy.RPCError{
+		Code:    rpcErr.Code,
+		Message: fmt.Sprintf("%s (%s)", hint, code),
+		Data:    data,
+	}
+}
+
+// toolCallTimeoutCode is the JSON-RPC error code mcpproxy answers queries
+// that ran over ORACLE_QUERY_TIMEOUT with, see mcpproxy.Config.ToolCallTimeout.
+const toolCallTimeoutCode = -32001
+
+// explainTimeout tells the caller of a query that timed out whether its
+// database session survived. When SQLcl did not abort the query, it was
+// restarted, and the connection it held is gone.
+func explainTimeout(rpcErr *mcpproxy.RPCError) *mcpproxy.RPCError {
+	var data struct {
+		Outcome string `json:"outcome"`
+	}
+	json.Unmarshal(rpcErr.Data, &data)
+	if data.Outcome != "restarted" {
+		return nil
+	}
+	return &mcpproxy.RPCError{
+		Code:    rpcErr.Code,
+		Message: rpcErr.Message + ". The database connection was lost: call connect again before running further queries.",
+		Data:    rpcErr.Data,
+	}
+}
+
+// connectionHints explains the likely misconfiguration behind connection
+// errors, which SQLcl reports inside tool results rather than as errors.
+var connectionHints = map[string]string{
+	"ORA-12154": "The connect identifier is not in tnsnames.ora. Check that TNS_ADMIN points to the directory holding tnsnames.ora and that the identifier is spelled as defined there.",
+	"ORA-12541": "Nothing is listening at the database host and port. Check the address in tnsnames.ora or the connection string, and that the database is running.",
+	"ORA-12578": "The wallet could not be opened. Check that WALLET_LOCATION, or the WALLET_LOCATION in sqlnet.ora under TNS_ADMIN, points to a directory holding cwallet.sso.",
+	"ORA-28759": "A wallet file could not be opened. Check that the wallet directory is mounted, holds cwallet.sso and ewallet.p12, and is readable by the container user.",
+}
+
+// addConnectionHint appends a hint to tool results mentioning one of the
+// connectionHints codes: a text content block for the model to read, and
+// the same hint under _meta.oracleConnectionHint for programs. Other
+// responses are returned unchanged.
+func addConnectionHint(response []byte) []byte {
+	code := oraCode.FindString(string(response))
+	hint, ok := connectionHints[code]
+	if !ok {
+		return response
+	}
+
+	var msg map[string]json.RawMessage
+	if json.Unmarshal(response, &msg) != nil || msg["result"] == nil {
+		return response
+	}
+	var result map[string]json.RawMessage
+	if json.Unmarshal(msg["result"], &result) != nil || result["content"] == nil {
+		return response
+	}
+	var content []json.RawMessage
+	if json.Unmarshal(result["content"], &content) != nil {
+		return response
+	}
+
+	block, _ := json.Marshal(map[string]string{"type": "text", "text": fmt.Sprintf("Hint (%s): %s", code, hint)})
+	content = append(content, block)
+	var meta map[string]json.RawMessage
+	json.Unmarshal(result["_meta"], &meta)
+	if meta == nil {
+		meta = make(map[string]json.RawMessage)
+	}
+	meta["oracleConnectionHint"], _ = json.Marshal(map[string]string{"oraCode": code, "hint": hint})
+
+	var err error
+	if result["content"], err = json.Marshal(content); err != nil {
+		return response
+	}
+	if result["_meta"], err = json.Marshal(meta); err != nil {
+		return response
+	}
+	if msg["result"], err = json.Marshal(result); err != nil {
+		return response
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return response
+	}
+	return data
+}
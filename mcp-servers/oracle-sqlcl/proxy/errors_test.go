@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/rh-ai-kickstart/ai-architecture-charts/mcp-servers/mcpproxy"
+)
+
+func TestMapOracleError(t *testing.T) {
+	rpcErr := &mcpproxy.RPCError{
+		Code:    -32000,
+		Message: "Error at line 1: ORA-00942: table or view does not exist",
+	}
+
+	mapped := mapOracleError("tools/call", rpcErr)
+	if mapped == nil {
+		t.Fatal("Expected ORA-00942 to be mapped")
+	}
+	if mapped.Message != "table or view does not exist (ORA-00942)" {
+		t.Errorf("Unexpected message: %q", mapped.Message)
+	}
+	if mapped.Code != rpcErr.Code {
+		t.Errorf("Expected code %d to be kept, got %d", rpcErr.Code, mapped.Code)
+	}
+
+	var data struct {
+		OraCode         string `json:"oraCode"`
+		OriginalMessage string `json:"originalMessage"`
+	}
+	if err := json.Unmarshal(mapped.Data, &data); err != nil {
+		t.Fatalf("Failed to parse data: %v", err)
+	}
+	if data.OraCode != "ORA-00942" || data.OriginalMessage != rpcErr.Message {
+		t.Errorf("Expected the original error in data, got %+v", data)
+	}
+
+	// Unknown codes and non-Oracle errors are left alone
+	for _, msg := range []string{"ORA-99999: something odd", "Method not found"} {
+		if got := mapOracleError("tools/call", &mcpproxy.RPCError{Code: -32601, Message: msg}); got != nil {
+			t.Errorf("Expected %q to be left unmapped, got %+v", msg, got)
+		}
+	}
+}
+
+func TestMapTimeoutError(t *testing.T) {
+	restarted := &mcpproxy.RPCError{Code: -32001, Message: "Tool call timed out after 30s", Data: json.RawMessage(`{"outcome":"restarted"}`)}
+	mapped := mapOracleError("tools/call", restarted)
+	if mapped == nil || !strings.Contains(mapped.Message, "call connect again") || string(mapped.Data) != string(restarted.Data) {
+		t.Errorf("Expected a reconnect hint, got %+v", mapped)
+	}
+
+	cancelled := &mcpproxy.RPCError{Code: -32001, Message: "Tool call timed out after 30s", Data: json.RawMessage(`{"outcome":"cancelled"}`)}
+	if got := mapOracleError("tools/call", cancelled); got != nil {
+		t.Errorf("Expected a cancelled query to keep its error, got %+v", got)
+	}
+}
+
+func TestAddConnectionHint(t *testing.T) {
+	response := `{"jsonrpc":"2.0","id":1,"result":{"content":[{"type":"text","text":"Error: ORA-12578: TNS:wallet open failed"}]}}`
+	var msg struct {
+		Result struct {
+			Content []struct {
+				Text string `json:"text"`
+			} `json:"content"`
+			Meta struct {
+				Hint struct {
+					OraCode string `json:"oraCode"`
+					Hint    string `json:"hint"`
+				} `json:"oracleConnectionHint"`
+			} `json:"_meta"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(addConnectionHint([]byte(response)), &msg); err != nil {
+		t.Fatal(err)
+	}
+	content := msg.Result.Content
+	if len(content) != 2 || content[0].Text != "Error: ORA-12578: TNS:wallet open failed" || !strings.HasPrefix(content[1].Text, "Hint (ORA-12578): The wallet could not be opened") {
+		t.Errorf("Expected a hint after the original content, got %+v", content)
+	}
+	if hint := msg.Result.Meta.Hint; hint.OraCode != "ORA-12578" || hint.Hint != connectionHints["ORA-12578"] {
+		t.Errorf("Expected the hint in _meta, got %+v", hint)
+	}
+
+	// Other errors and responses without content are left alone
+	for _, response := range []string{
+		`{"jsonrpc":"2.0","id":1,"result":{"content":[{"type":"text","text":"ORA-00942: table or view does not exist"}]}}`,
+		`{"jsonrpc":"2.0","id":1,"error":{"code":-32000,"message":"ORA-12154: could not resolve"}}`,
+	} {
+		if got := string(addConnectionHint([]byte(response))); got != response {
+			t.Errorf("Expected %s to be unchanged, got %s", response, got)
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/rh-ai-kickstart/ai-architecture-charts/mcp-servers/mcpproxy"
+)
+
+// Clients ask for a statement to be explained instead of executed with the
+// explainOnlyHeader header, which the proxy copies to params._meta under
+// explainOnlyMeta, or by setting that _meta key themselves.
+const (
+	explainOnlyHeader = "X-Oracle-Explain-Only"
+	explainOnlyMeta   = "oracleExplainOnly"
+)
+
+// requiresApprovalCode is the JSON-RPC error code of explain-only calls
+// whose statement cannot be explained.
+const requiresApprovalCode = -32003
+
+// explainableStatement matches the first keyword of statements that
+// EXPLAIN PLAN accepts and that it is safe to hand to it.
+var explainableStatement = regexp.MustCompile(`(?i)^(SELECT|WITH|INSERT|UPDATE|DELETE|MERGE)\b`)
+
+// explainCall is an explain-only tools/call as the client sent it.
+type explainCall struct {
+	Name      string          `json:"name"`
+	Arguments json.RawMessage `json:"arguments"`
+	Statement string          `json:"-"`
+}
+
+// explainer runs the statements of explain-only run-sql calls through
+// EXPLAIN PLAN and DBMS_XPLAN instead of executing them. Statements that
+// cannot be explained are refused by filter before they are queued; the
+// plan is returned with the original call so that an approval workflow can
+// resubmit it unmodified.
+type explainer struct {
+	mu      sync.Mutex
+	next    int
+	pending map[string]explainCall // by request id
+}
+
+func newExplainer() *explainer {
+	return &explainer{pending: make(map[string]explainCall)}
+}
+
+// toolCall holds the members of a tools/call request the explainer uses.
+type toolCall struct {
+	ID     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+	Params struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+		Meta      struct {
+			ExplainOnly json.RawMessage `json:"oracleExplainOnly"`
+		} `json:"_meta"`
+	} `json:"params"`
+}
+
+// parseExplainOnly returns msg as a tools/call, and whether it asks for its
+// statement to be explained only.
+func parseExplainOnly(msg []byte) (toolCall, bool) {
+	var call toolCall
+	if json.Unmarshal(msg, &call) != nil || call.Method != "tools/call" {
+		return call, false
+	}
+	var flag interface{}
+	json.Unmarshal(call.Params.Meta.ExplainOnly, &flag)
+	switch v := flag.(type) {
+	case bool:
+		return call, v
+	case string:
+		return call, strings.EqualFold(strings.TrimSpace(v), "true")
+	}
+	return call, false
+}
+
+// statement returns the statement an explain-only call would execute, or
+// why it cannot be explained. Only run-sql executes plain SQL; other tools
+// are not execute-type and are let through.
+func (call toolCall) statement() (stmt string, execute bool, reason string) {
+	switch call.Params.Name {
+	case "run-sql":
+	case "run-sqlcl":
+		return "", true, "SQLcl commands cannot be explained"
+	default:
+		return "", false, ""
+	}
+	var args struct {
+		SQL string `json:"sql"`
+	}
+	if json.Unmarshal(call.Params.Arguments, &args) != nil || strings.TrimSpace(args.SQL) == "" {
+		return "", true, "the call has no sql argument"
+	}
+	stmt, reason = explainable(args.SQL)
+	return stmt, true, reason
+}
+
+// explainable returns sql on a single line, ready to follow EXPLAIN PLAN
+// FOR, or why it is refused. It is deliberately strict: SQLcl runs its
+// input as a script, so the statement is joined into one line, which a
+// blank line or a "/" can no longer end, and anything else that could end
+// it or hide part of it, a semicolon or a comment, is refused rather than
+// risk executing it.
+func explainable(sql string) (string, string) {
+	stmt := strings.TrimSpace(sql)
+	stmt = strings.TrimSpace(strings.TrimSuffix(stmt, ";"))
+	switch {
+	case strings.Contains(stmt, ";"):
+		return "", "the sql holds more than one statement"
+	case strings.Contains(stmt, "--") || strings.Contains(stmt, "/*"):
+		return "", "the sql holds comments"
+	case !explainableStatement.MatchString(stmt):
+		return "", "only SELECT, INSERT, UPDATE, DELETE and MERGE statements can be explained"
+	}
+	return strings.Join(strings.Fields(stmt), " "), ""
+}
+
+// filter refuses explain-only calls whose statement cannot be explained,
+// for mcpproxy.Config.RequestFilter.
+func (e *explainer) filter(method string, msg []byte) *mcpproxy.RPCError {
+	call, explainOnly := parseExplainOnly(msg)
+	if !explainOnly {
+		return nil
+	}
+	_, execute, reason := call.statement()
+	if !execute || reason == "" {
+		return nil
+	}
+	data, _ := json.Marshal(map[string]interface{}{
+		"reason":       reason,
+		"originalCall": explainCall{Name: call.Params.Name, Arguments: call.Params.Arguments},
+	})
+	return &mcpproxy.RPCError{
+		Code:    requiresApprovalCode,
+		Message: fmt.Sprintf("Statement requires approval: %s", reason),
+		Data:    data,
+	}
+}
+
+// rewrite replaces the statement of an explain-only run-sql call with a
+// script that explains it and prints the plan, for RequestMiddleware. Calls
+// that filter would have refused are turned into a call of no tool, so
+// that they fail instead of executing.
+func (e *explainer) rewrite(msg []byte) []byte {
+	call, explainOnly := parseExplainOnly(msg)
+	if !explainOnly {
+		return msg
+	}
+	stmt, execute, reason := call.statement()
+	if !execute {
+		return msg
+	}
+	if reason != "" {
+		return setToolCall(msg, "", nil)
+	}
+
+	e.mu.Lock()
+	e.next++
+	statementID := fmt.Sprintf("mcp-proxy-%d", e.next)
+	e.pending[string(call.ID)] = explainCall{Name: call.Params.Name, Arguments: call.Params.Arguments, Statement: stmt}
+	e.mu.Unlock()
+
+	script := fmt.Sprintf("EXPLAIN PLAN SET STATEMENT_ID = '%s' FOR %s;\n"+
+		"SELECT plan_table_output FROM TABLE(DBMS_XPLAN.DISPLAY('PLAN_TABLE', '%s', 'TYPICAL'));",
+		statementID, stmt, statementID)
+	args, _ := json.Marshal(map[string]string{"sql": script})
+	return setToolCall(msg, call.Params.Name, args)
+}
+
+// setToolCall returns msg calling the named tool with args, or without
+// arguments if args is nil.
+func setToolCall(msg []byte, name string, args json.RawMessage) []byte {
+	var req map[string]json.RawMessage
+	var params map[string]json.RawMessage
+	if json.Unmarshal(msg, &req) != nil || json.Unmarshal(req["params"], &params) != nil {
+		return []byte(`{"jsonrpc":"2.0","method":"explain-only/refused"}`)
+	}
+	params["name"], _ = json.Marshal(name)
+	if args != nil {
+		params["arguments"] = args
+	} else {
+		delete(params, "arguments")
+	}
+	req["params"], _ = json.Marshal(params)
+	data, _ := json.Marshal(req)
+	return data
+}
+
+// annotate attaches the original call to the result of an explain-only
+// call, as structuredContent, for ResponseMiddleware. The plan rows the
+// result formatter put there are kept under "plan".
+func (e *explainer) annotate(response []byte) []byte {
+	var msg map[string]json.RawMessage
+	if json.Unmarshal(response, &msg) != nil {
+		return response
+	}
+	e.mu.Lock()
+	call, ok := e.pending[string(msg["id"])]
+	delete(e.pending, string(msg["id"]))
+	e.mu.Unlock()
+	if !ok || msg["result"] == nil {
+		return response
+	}
+
+	var result map[string]json.RawMessage
+	if json.Unmarshal(msg["result"], &result) != nil {
+		return response
+	}
+	content := map[string]interface{}{
+		"explainOnly":  true,
+		"statement":    call.Statement,
+		"originalCall": call,
+	}
+	if plan := result["structuredContent"]; plan != nil {
+		content["plan"] = plan
+	}
+	var err error
+	result["structuredContent"], err = json.Marshal(content)
+	if err != nil {
+		return response
+	}
+	if msg["result"], err = json.Marshal(result); err != nil {
+		return response
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return response
+	}
+	return data
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestExplainable(t *testing.T) {
+	for _, tc := range []struct {
+		sql, want string
+	}{
+		{"select * from emp", "select * from emp"},
+		{"  SELECT ename\n  FROM emp\n\n  WHERE deptno = 10;\n", "SELECT ename FROM emp WHERE deptno = 10"},
+		{"with d as (select 1 x from dual) select x from d", "with d as (select 1 x from dual) select x from d"},
+		{"update emp\n/\nset sal = 0", "update emp / set sal = 0"},
+		{"DELETE FROM emp", "DELETE FROM emp"},
+		{"merge into emp e using dual on (1 = 0) when not matched then insert (id) values (1)", "merge into emp e using dual on (1 = 0) when not matched then insert (id) values (1)"},
+	} {
+		if got, reason := explainable(tc.sql); got != tc.want || reason != "" {
+			t.Errorf("explainable(%q) = %q, %q, expected %q", tc.sql, got, reason, tc.want)
+		}
+	}
+
+	for _, sql := range []string{
+		"drop table emp",
+		"create table t (x number)",
+		"begin delete from emp; end;",
+		"select 1 from dual; drop table emp",
+		"select 1 from dual -- ;\ndrop table emp",
+		"select /* x */ 1 from dual",
+		"selectx from dual",
+		"grant select on emp to public",
+		"truncate table emp",
+		"",
+	} {
+		if got, reason := explainable(sql); reason == "" {
+			t.Errorf("Expected %q to be refused, got %q", sql, got)
+		}
+	}
+}
+
+func TestExplainFilter(t *testing.T) {
+	e := newExplainer()
+
+	for _, msg := range []string{
+		// Not explain-only
+		`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"run-sql","arguments":{"sql":"drop table emp"}}}`,
+		`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"run-sql","arguments":{"sql":"drop table emp"}},"_meta":{"oracleExplainOnly":false}}`,
+		`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"run-sql","arguments":{"sql":"drop table emp"},"_meta":{"oracleExplainOnly":"false"}}}`,
+		// Not an execute-type tool
+		`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"list-connections","_meta":{"oracleExplainOnly":true}}}`,
+		// Explainable
+		`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"run-sql","arguments":{"sql":"select * from emp"},"_meta":{"oracleExplainOnly":"true"}}}`,
+	} {
+		if err := e.filter("tools/call", []byte(msg)); err != nil {
+			t.Errorf("Expected %s to be let through, got %+v", msg, err)
+		}
+	}
+
+	for _, msg := range []string{
+		`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"run-sql","arguments":{"sql":"drop table emp"},"_meta":{"oracleExplainOnly":true}}}`,
+		`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"run-sql","arguments":{"sql":"select 1 from dual; delete from emp"},"_meta":{"oracleExplainOnly":"TRUE"}}}`,
+		`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"run-sql","_meta":{"oracleExplainOnly":true}}}`,
+		`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"run-sqlcl","arguments":{"sqlcl":"ddl emp"},"_meta":{"oracleExplainOnly":true}}}`,
+	} {
+		err := e.filter("tools/call", []byte(msg))
+		if err == nil {
+			t.Errorf("Expected %s to be refused", msg)
+			continue
+		}
+		if err.Code != requiresApprovalCode || !strings.HasPrefix(err.Message, "Statement requires approval") {
+			t.Errorf("Unexpected error for %s: %+v", msg, err)
+		}
+		var data struct {
+			OriginalCall explainCall `json:"originalCall"`
+		}
+		if json.Unmarshal(err.Data, &data) != nil || data.OriginalCall.Name == "" {
+			t.Errorf("Expected the original call in the error data, got %s", err.Data)
+		}
+	}
+}
+
+func TestExplainRewrite(t *testing.T) {
+	e := newExplainer()
+	request := `{"jsonrpc":"2.0","id":7,"method":"tools/call","params":{"name":"run-sql","arguments":{"sql":"select *\nfrom emp;","model":"m"},"_meta":{"oracleExplainOnly":true}}}`
+
+	var msg struct {
+		Params struct {
+			Name      string `json:"name"`
+			Arguments struct {
+				SQL string `json:"sql"`
+			} `json:"arguments"`
+		} `json:"params"`
+	}
+	if err := json.Unmarshal(e.rewrite([]byte(request)), &msg); err != nil {
+		t.Fatal(err)
+	}
+	want := "EXPLAIN PLAN SET STATEMENT_ID = 'mcp-proxy-1' FOR select * from emp;\n" +
+		"SELECT plan_table_output FROM TABLE(DBMS_XPLAN.DISPLAY('PLAN_TABLE', 'mcp-proxy-1', 'TYPICAL'));"
+	if msg.Params.Name != "run-sql" || msg.Params.Arguments.SQL != want {
+		t.Errorf("Unexpected rewritten call: %+v", msg.Params)
+	}
+
+	response := []byte(`{"jsonrpc":"2.0","id":7,"result":{"content":[{"type":"text","text":"Plan hash value: 1"}],"structuredContent":{"columns":["PLAN_TABLE_OUTPUT"],"rows":[]}}}`)
+	var annotated struct {
+		Result struct {
+			StructuredContent struct {
+				ExplainOnly  bool            `json:"explainOnly"`
+				Statement    string          `json:"statement"`
+				OriginalCall json.RawMessage `json:"originalCall"`
+				Plan         json.RawMessage `json:"plan"`
+			} `json:"structuredContent"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(e.annotate(response), &annotated); err != nil {
+		t.Fatal(err)
+	}
+	content := annotated.Result.StructuredContent
+	if !content.ExplainOnly || content.Statement != "select * from emp" || content.Plan == nil {
+		t.Errorf("Unexpected structuredContent: %+v", content)
+	}
+	// The original arguments are returned unmodified, to be resubmitted
+	wantCall := `{"name":"run-sql","arguments":{"sql":"select *\nfrom emp;","model":"m"}}`
+	if !jsonEqual(t, content.OriginalCall, []byte(wantCall)) {
+		t.Errorf("Unexpected original call: %s", content.OriginalCall)
+	}
+
+	// The id was forgotten with the response, and other requests are left alone
+	if got := e.annotate(response); string(got) != string(response) {
+		t.Errorf("Expected a response to an unknown id to be left alone, got %s", got)
+	}
+	plain := `{"jsonrpc":"2.0","id":8,"method":"tools/call","params":{"name":"run-sql","arguments":{"sql":"select 1 from dual"}}}`
+	if got := e.rewrite([]byte(plain)); string(got) != plain {
+		t.Errorf("Expected a call that is not explain-only to be left alone, got %s", got)
+	}
+
+	// A refused call that got past the filter calls no tool
+	refused := `{"jsonrpc":"2.0","id":9,"method":"tools/call","params":{"name":"run-sql","arguments":{"sql":"drop table emp"},"_meta":{"oracleExplainOnly":true}}}`
+	if got := string(e.rewrite([]byte(refused))); strings.Contains(got, "drop") || !strings.Contains(got, `"name":""`) {
+		t.Errorf("Expected the refused call not to reach a tool, got %s", got)
+	}
+}
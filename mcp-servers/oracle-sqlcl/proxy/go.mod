@@ -3,3 +3,7 @@ module github.com/rh-ai-kickstart/ai-architecture-charts/mcp-servers/oracle-sqlc
 go 1.21
 
 require github.com/rh-ai-kickstart/ai-architecture-charts/mcp-servers/mcpproxy v0.0.0-20260112200911-3c502cb8d0cf
+
+// The proxy is built against the mcpproxy in this repository, see the
+// Containerfile.
+replace github.com/rh-ai-kickstart/ai-architecture-charts/mcp-servers/mcpproxy => ../../mcpproxy
@@ -1,18 +1,128 @@
 package main
 
 import (
-	"log"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/rh-ai-kickstart/ai-architecture-charts/mcp-servers/mcpproxy"
 )
 
 func main() {
-	if err := mcpproxy.Run(mcpproxy.Config{
-		ServerName:  "sqlcl",
-		CommandPath: "/opt/oracle/sqlcl/bin/sql",
-		CommandArgs: []string{"-mcp"},
-		PathEnvVar:  "SQL_PATH",
-	}); err != nil {
-		log.Fatalf("Failed to run proxy: %v", err)
+	var readiness func() error
+	if entries, err := walletConfigFromEnv().check(); err != nil {
+		slog.Error("Oracle Net configuration is invalid", "error", err)
+		err = fmt.Errorf("invalid Oracle Net configuration: %w", err)
+		readiness = func() error { return err }
+	} else if entries != nil {
+		slog.Info("Resolved tnsnames.ora entries", "entries", entries)
 	}
+
+	queryTimeout, err := durationFromEnv("ORACLE_QUERY_TIMEOUT")
+	if err != nil {
+		slog.Error("Invalid ORACLE_QUERY_TIMEOUT", "error", err)
+		os.Exit(1)
+	}
+
+	warmStandby, err := boolFromEnv("ORACLE_WARM_STANDBY")
+	if err != nil {
+		slog.Error("Invalid ORACLE_WARM_STANDBY", "error", err)
+		os.Exit(1)
+	}
+
+	maxLifetime, err := durationFromEnv("ORACLE_MAX_LIFETIME")
+	if err != nil {
+		slog.Error("Invalid ORACLE_MAX_LIFETIME", "error", err)
+		os.Exit(1)
+	}
+
+	var waitFor []string
+	if value := os.Getenv("ORACLE_WAIT_FOR"); value != "" {
+		for _, target := range strings.Split(value, ",") {
+			if target = strings.TrimSpace(target); target != "" {
+				waitFor = append(waitFor, target)
+			}
+		}
+	}
+
+	numbers, err := boolFromEnv("ORACLE_RESULT_NUMBERS")
+	if err != nil {
+		slog.Error("Invalid ORACLE_RESULT_NUMBERS", "error", err)
+		os.Exit(1)
+	}
+	formatter, err := newResultFormatter(os.Getenv("ORACLE_RESULT_FORMAT"), numbers)
+	if err != nil {
+		slog.Error("Invalid ORACLE_RESULT_FORMAT", "error", err)
+		os.Exit(1)
+	}
+	// Explain-only calls are rewritten before the formatter sees them, so
+	// that the plan is formatted like any other query result.
+	explain := newExplainer()
+	requestMiddleware := explain.rewrite
+	responseMiddleware := func(response []byte) []byte {
+		return addConnectionHint(explain.annotate(response))
+	}
+	if formatter != nil {
+		requestMiddleware = func(msg []byte) []byte {
+			return formatter.trackRequest(explain.rewrite(msg))
+		}
+		responseMiddleware = func(response []byte) []byte {
+			return addConnectionHint(explain.annotate(formatter.formatResponse(response)))
+		}
+	}
+
+	mcpproxy.Main(mcpproxy.Config{
+		ServerName:         "sqlcl",
+		CommandPath:        "/opt/oracle/sqlcl/bin/sql",
+		CommandArgs:        []string{"-mcp"},
+		PathEnvVar:         "SQL_PATH",
+		BackendVersionArgs: []string{"-V"},
+
+		ErrorMiddleware:    mapOracleError,
+		RequestMiddleware:  requestMiddleware,
+		ResponseMiddleware: responseMiddleware,
+		RequestFilter:      explain.filter,
+		ReadinessCheck:     readiness,
+
+		MetaHeaders: map[string]string{explainOnlyHeader: explainOnlyMeta},
+
+		ToolCallTimeout: queryTimeout,
+		WarmStandby:     warmStandby,
+		WaitFor:         waitFor,
+
+		MaxSubprocessLifetime: maxLifetime,
+
+		// SQLcl prints a banner before its first message
+		StartupGracePeriod: 30 * time.Second,
+	})
+}
+
+// durationFromEnv parses the environment variable name as a duration such
+// as "5m", returning 0 if it is unset.
+func durationFromEnv(name string) (time.Duration, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("%s must not be negative", value)
+	}
+	return d, nil
+}
+
+// boolFromEnv parses the environment variable name as a boolean, returning
+// false if it is unset.
+func boolFromEnv(name string) (bool, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return false, nil
+	}
+	return strconv.ParseBool(value)
 }
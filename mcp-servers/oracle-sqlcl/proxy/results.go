@@ -0,0 +1,446 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Values of ORACLE_RESULT_FORMAT.
+const (
+	resultFormatText       = "text"       // leave query results as SQLcl formats them
+	resultFormatStructured = "structured" // add structuredContent next to the text
+	resultFormatJSON       = "json"       // also replace the text with the JSON rows
+)
+
+// queryTools are the SQLcl tools whose results are query output.
+var queryTools = map[string]bool{
+	"run-sql":   true,
+	"run-sqlcl": true,
+}
+
+// resultFormatter turns the tables SQLcl prints for queries into JSON rows.
+// It sees requests in RequestMiddleware to remember which ids are query
+// tool calls, and rewrites their responses in ResponseMiddleware.
+type resultFormatter struct {
+	replaceText bool
+	numbers     bool // see table.markNumbers
+
+	mu      sync.Mutex
+	queries map[string]bool // ids of query tool calls awaiting a response
+}
+
+// newResultFormatter returns the formatter for the ORACLE_RESULT_FORMAT
+// value format, or nil if results are to be left alone. With numbers,
+// columns holding only numbers are returned as JSON numbers.
+func newResultFormatter(format string, numbers bool) (*resultFormatter, error) {
+	switch format {
+	case "", resultFormatText:
+		return nil, nil
+	case resultFormatStructured, resultFormatJSON:
+		return &resultFormatter{
+			replaceText: format == resultFormatJSON,
+			numbers:     numbers,
+			queries:     make(map[string]bool),
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown result format %q, expected %s, %s or %s",
+		format, resultFormatText, resultFormatStructured, resultFormatJSON)
+}
+
+// trackRequest remembers the id of msg if it calls a query tool.
+func (f *resultFormatter) trackRequest(msg []byte) []byte {
+	var req struct {
+		ID     json.RawMessage `json:"id"`
+		Method string          `json:"method"`
+		Params struct {
+			Name string `json:"name"`
+		} `json:"params"`
+	}
+	if json.Unmarshal(msg, &req) == nil && req.ID != nil && req.Method == "tools/call" && queryTools[req.Params.Name] {
+		f.mu.Lock()
+		f.queries[string(req.ID)] = true
+		f.mu.Unlock()
+	}
+	return msg
+}
+
+// formatResponse adds the rows of the first text block that holds a table
+// to the result of a query tool call as structuredContent. Responses to
+// other requests, error results and text that is not recognized as a table
+// are returned unchanged.
+func (f *resultFormatter) formatResponse(response []byte) []byte {
+	var msg map[string]json.RawMessage
+	if json.Unmarshal(response, &msg) != nil {
+		return response
+	}
+	f.mu.Lock()
+	query := f.queries[string(msg["id"])]
+	delete(f.queries, string(msg["id"]))
+	f.mu.Unlock()
+	if !query || msg["result"] == nil {
+		return response
+	}
+
+	var result map[string]json.RawMessage
+	if json.Unmarshal(msg["result"], &result) != nil || result["content"] == nil {
+		return response
+	}
+	var isError bool
+	json.Unmarshal(result["isError"], &isError)
+	var content []json.RawMessage
+	if isError || json.Unmarshal(result["content"], &content) != nil {
+		return response
+	}
+
+	for i, block := range content {
+		var text struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		}
+		if json.Unmarshal(block, &text) != nil || text.Type != "text" {
+			continue
+		}
+		t, ok := parseTable(text.Text)
+		if !ok {
+			continue
+		}
+		if f.numbers {
+			t.markNumbers()
+		}
+
+		rows, err := json.Marshal(t)
+		if err != nil {
+			return response
+		}
+		result["structuredContent"] = rows
+		if f.replaceText {
+			content[i], _ = json.Marshal(map[string]string{"type": "text", "text": string(rows)})
+			if result["content"], err = json.Marshal(content); err != nil {
+				return response
+			}
+		}
+		if msg["result"], err = json.Marshal(result); err != nil {
+			return response
+		}
+		data, err := json.Marshal(msg)
+		if err != nil {
+			return response
+		}
+		return data
+	}
+	return response
+}
+
+// table is a query result parsed from SQLcl's text output. Values are
+// kept as the strings SQLcl printed; NULLs are nil.
+type table struct {
+	Columns []string    `json:"columns"`
+	Rows    [][]*string `json:"rows"`
+
+	// numeric marks the columns whose values are marshaled as JSON
+	// numbers, see markNumbers.
+	numeric []bool
+}
+
+// numberValue matches the numbers SQLcl prints: an optional sign, digits
+// with an optional fraction, which may lack the integer part as in ".5",
+// and an optional exponent.
+var numberValue = regexp.MustCompile(`^(-?)(\d*)(?:\.(\d*))?([eE][-+]?\d+)?$`)
+
+// jsonNumber returns value as a JSON number, and whether it is a number.
+// Integers with leading zeros, such as "007", are codes rather than numbers.
+func jsonNumber(value string) (json.Number, bool) {
+	m := numberValue.FindStringSubmatch(value)
+	if m == nil || m[2]+m[3] == "" || (len(m[2]) > 1 && m[2][0] == '0') {
+		return "", false
+	}
+	number := m[1] + m[2]
+	if m[2] == "" {
+		number += "0"
+	}
+	if m[3] != "" {
+		number += "." + m[3]
+	}
+	return json.Number(number + m[4]), true
+}
+
+// markNumbers marks the columns of t that hold at least one value and only
+// numbers, so that they are marshaled as JSON numbers. This is a heuristic:
+// a character column whose values all happen to look like numbers is taken
+// for a numeric one.
+func (t *table) markNumbers() {
+	t.numeric = make([]bool, len(t.Columns))
+	for i := range t.Columns {
+		numeric := false
+		for _, row := range t.Rows {
+			if i >= len(row) || row[i] == nil {
+				continue
+			}
+			if _, ok := jsonNumber(*row[i]); !ok {
+				numeric = false
+				break
+			}
+			numeric = true
+		}
+		t.numeric[i] = numeric
+	}
+}
+
+// MarshalJSON marshals t with the values of numeric columns as numbers.
+func (t table) MarshalJSON() ([]byte, error) {
+	rows := make([][]interface{}, len(t.Rows))
+	for i, row := range t.Rows {
+		rows[i] = make([]interface{}, len(row))
+		for j, value := range row {
+			if value == nil {
+				continue
+			}
+			rows[i][j] = *value
+			if j < len(t.numeric) && t.numeric[j] {
+				rows[i][j], _ = jsonNumber(*value)
+			}
+		}
+	}
+	return json.Marshal(struct {
+		Columns []string        `json:"columns"`
+		Rows    [][]interface{} `json:"rows"`
+	}{t.Columns, rows})
+}
+
+// rowCountFooter matches the feedback SQLcl prints after the rows.
+var rowCountFooter = regexp.MustCompile(`^(?:(\d+) rows? selected|no rows selected)\.?$`)
+
+// nullMarker is how SQLcl prints NULL with "set null (null)"; by default
+// NULLs are blank.
+const nullMarker = "(null)"
+
+// parseTable parses the fixed-width table SQLcl prints for a query: one or
+// more header lines, each underlined with a run of "-" (or "_" with
+// sqlformat ansiconsole) per column, the rows, and an optional row count.
+// A row wider than the line size is printed on as many lines as there are
+// header lines, and a value wider than its column continues on the
+// following lines. It reports false for text of any other shape, or whose
+// number of rows does not match the row count.
+func parseTable(text string) (*table, bool) {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	for len(lines) > 0 && isBlank(lines[0]) {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && isBlank(lines[len(lines)-1]) {
+		lines = lines[:len(lines)-1]
+	}
+
+	expected := -1
+	if len(lines) > 0 {
+		if m := rowCountFooter.FindStringSubmatch(strings.TrimSpace(lines[len(lines)-1])); m != nil {
+			expected = 0
+			if m[1] != "" {
+				expected, _ = strconv.Atoi(m[1])
+			}
+			lines = lines[:len(lines)-1]
+		}
+	}
+
+	// The header: a line per part of a wrapped row, each underlined
+	var t table
+	var spans [][]span
+	for len(lines) >= 2 && !isBlank(lines[0]) && !isUnderline(lines[0]) && isUnderline(lines[1]) {
+		lineSpans := underlineSpans(lines[1])
+		names, ok := splitColumns(lines[0], lineSpans)
+		if !ok {
+			return nil, false
+		}
+		for _, name := range names {
+			if name == "" {
+				return nil, false
+			}
+			t.Columns = append(t.Columns, name)
+		}
+		spans = append(spans, lineSpans)
+		lines = lines[2:]
+	}
+	if len(spans) == 0 {
+		return nil, false
+	}
+
+	if len(spans) == 1 {
+		if !t.parseRows(lines, spans[0]) {
+			return nil, false
+		}
+	} else {
+		var data []string
+		for _, line := range lines {
+			if !isBlank(line) {
+				data = append(data, line)
+			}
+		}
+		if len(data)%len(spans) != 0 {
+			return nil, false
+		}
+		for i := 0; i < len(data); i += len(spans) {
+			var row []*string
+			for j, lineSpans := range spans {
+				cells, ok := splitColumns(data[i+j], lineSpans)
+				if !ok {
+					return nil, false
+				}
+				row = append(row, values(cells)...)
+			}
+			t.Rows = append(t.Rows, row)
+		}
+	}
+
+	if t.Rows == nil {
+		t.Rows = [][]*string{}
+	}
+	if expected >= 0 && len(t.Rows) != expected {
+		return nil, false
+	}
+	return &t, true
+}
+
+// parseRows parses lines holding one row each. A value wider than its
+// column continues on the following lines, and the row it is in is
+// followed by a blank line, so only the last row before a blank line can
+// span several lines.
+func (t *table) parseRows(lines []string, spans []span) bool {
+	var block [][]string // fragments of the lines since the last blank line
+	flush := func(wrapped bool) {
+		start := len(block)
+		if wrapped && start > 0 {
+			for start = len(block) - 1; start > 0 && continues(block[start], block[start-1], spans); start-- {
+			}
+		}
+		for _, fragments := range block[:start] {
+			t.Rows = append(t.Rows, values(trimAll(fragments)))
+		}
+		if start < len(block) {
+			row := trimAll(block[start])
+			for _, fragments := range block[start+1:] {
+				for i, fragment := range fragments {
+					row[i] += fragment
+				}
+			}
+			t.Rows = append(t.Rows, values(row))
+		}
+		block = nil
+	}
+	for _, line := range lines {
+		if isBlank(line) {
+			flush(true)
+			continue
+		}
+		fragments, ok := splitFragments(line, spans)
+		if !ok {
+			return false
+		}
+		block = append(block, fragments)
+	}
+	flush(false)
+	return true
+}
+
+// continues reports whether a line split into fragments continues the
+// values of the line split into last: it has a value only in columns that
+// the last line filled to the end.
+func continues(fragments, last []string, spans []span) bool {
+	found := false
+	for i, fragment := range fragments {
+		if fragment == "" {
+			continue
+		}
+		if len([]rune(last[i])) != spans[i].end-spans[i].start {
+			return false
+		}
+		found = true
+	}
+	return found
+}
+
+// span is the range of runes a column takes up in a line.
+type span struct{ start, end int }
+
+// isUnderline reports whether line underlines column headers: runs of "-"
+// or of "_" separated by spaces.
+func isUnderline(line string) bool {
+	if line == "" || (line[0] != '-' && line[0] != '_') {
+		return false
+	}
+	return strings.Trim(line, line[:1]+" ") == ""
+}
+
+func underlineSpans(line string) []span {
+	var spans []span
+	start := -1
+	for i, r := range []rune(strings.TrimRight(line, " ")) {
+		switch {
+		case r != ' ' && start < 0:
+			start = i
+		case r == ' ' && start >= 0:
+			spans = append(spans, span{start, i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		spans = append(spans, span{start, len([]rune(strings.TrimRight(line, " ")))})
+	}
+	return spans
+}
+
+// splitFragments cuts line into the text in each column, with trailing
+// spaces removed; a fragment that fills its column is as wide as it. It reports false if anything is printed between columns,
+// which means the line does not belong to the table.
+func splitFragments(line string, spans []span) ([]string, bool) {
+	runes := []rune(strings.TrimRight(line, " "))
+	fragments := make([]string, len(spans))
+	pos := 0
+	for i, s := range spans {
+		for ; pos < s.start && pos < len(runes); pos++ {
+			if runes[pos] != ' ' {
+				return nil, false
+			}
+		}
+		if s.start < len(runes) {
+			fragments[i] = strings.TrimRight(string(runes[s.start:min(s.end, len(runes))]), " ")
+		}
+		pos = s.end
+	}
+	if pos < len(runes) {
+		return nil, false
+	}
+	return fragments, true
+}
+
+// splitColumns is splitFragments with the values trimmed.
+func splitColumns(line string, spans []span) ([]string, bool) {
+	cells, ok := splitFragments(line, spans)
+	return trimAll(cells), ok
+}
+
+func trimAll(fragments []string) []string {
+	cells := make([]string, len(fragments))
+	for i, fragment := range fragments {
+		cells[i] = strings.TrimSpace(fragment)
+	}
+	return cells
+}
+
+// values converts cells to JSON values, blank cells and nullMarker to
+// NULL.
+func values(cells []string) []*string {
+	row := make([]*string, len(cells))
+	for i, cell := range cells {
+		if cell != "" && cell != nullMarker {
+			row[i] = &cells[i]
+		}
+	}
+	return row
+}
+
+func isBlank(line string) bool {
+	return strings.TrimSpace(line) == ""
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestParseTable parses the SQLcl output samples in testdata/results. A
+// sample with a .json file next to it must parse to that table; one
+// without must be left alone.
+func TestParseTable(t *testing.T) {
+	samples, err := filepath.Glob(filepath.Join("testdata", "results", "*.txt"))
+	if err != nil || len(samples) == 0 {
+		t.Fatalf("No samples found: %v", err)
+	}
+	for _, sample := range samples {
+		name := strings.TrimSuffix(filepath.Base(sample), ".txt")
+		t.Run(name, func(t *testing.T) {
+			text, err := os.ReadFile(sample)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, ok := parseTable(string(text))
+
+			want, err := os.ReadFile(strings.TrimSuffix(sample, ".txt") + ".json")
+			if os.IsNotExist(err) {
+				if ok {
+					t.Errorf("Expected the sample not to be taken for a table, got %+v", got)
+				}
+				return
+			}
+			if !ok {
+				t.Fatal("Expected the sample to parse")
+			}
+			data, _ := json.Marshal(got)
+			if !jsonEqual(t, data, want) {
+				t.Errorf("Unexpected table:\n got: %s\nwant: %s", data, want)
+			}
+		})
+	}
+}
+
+func TestFormatResponse(t *testing.T) {
+	text, err := os.ReadFile(filepath.Join("testdata", "results", "nulls.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, _ := json.Marshal(map[string]interface{}{
+		"content": []map[string]string{{"type": "text", "text": string(text)}},
+	})
+	response := []byte(`{"jsonrpc":"2.0","id":1,"result":` + string(result) + `}`)
+	rows := `{"columns":["ID","NAME","MANAGER_ID"],"rows":[["1","KING",null],["2","BLAKE","1"],["3",null,"1"]]}`
+
+	for _, format := range []string{resultFormatStructured, resultFormatJSON} {
+		t.Run(format, func(t *testing.T) {
+			f, err := newResultFormatter(format, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			f.trackRequest([]byte(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"run-sql","arguments":{"sql":"select * from emp"}}}`))
+
+			var msg struct {
+				Result struct {
+					Content []struct {
+						Text string `json:"text"`
+					} `json:"content"`
+					StructuredContent json.RawMessage `json:"structuredContent"`
+				} `json:"result"`
+			}
+			if err := json.Unmarshal(f.formatResponse(response), &msg); err != nil {
+				t.Fatal(err)
+			}
+			if !jsonEqual(t, msg.Result.StructuredContent, []byte(rows)) {
+				t.Errorf("Unexpected structuredContent: %s", msg.Result.StructuredContent)
+			}
+			wantText := string(text)
+			if format == resultFormatJSON {
+				wantText = rows
+			}
+			if len(msg.Result.Content) != 1 || !jsonOrTextEqual(t, msg.Result.Content[0].Text, wantText) {
+				t.Errorf("Unexpected content: %+v", msg.Result.Content)
+			}
+
+			// The id was forgotten with the response
+			if got := f.formatResponse(response); string(got) != string(response) {
+				t.Errorf("Expected a response to an unknown id to be left alone, got %s", got)
+			}
+		})
+	}
+
+	// Other tools are left alone
+	f, _ := newResultFormatter(resultFormatJSON, false)
+	f.trackRequest([]byte(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"list-connections"}}`))
+	if got := f.formatResponse(response); string(got) != string(response) {
+		t.Errorf("Expected the response to another tool to be left alone, got %s", got)
+	}
+
+	if f, err := newResultFormatter("", false); f != nil || err != nil {
+		t.Errorf("Expected no formatter by default, got %v, %v", f, err)
+	}
+	if _, err := newResultFormatter("csv", false); err == nil {
+		t.Error("Expected an unknown format to be rejected")
+	}
+}
+
+func TestNumericColumns(t *testing.T) {
+	text := `
+ID CODE     PRICE      RATIO NOTE
+-- ------ ------- ---------- ----
+ 1 007      12.50         .5 a
+ 2 010         -3      1E+10
+ 3 (null)               -.25 1
+
+3 rows selected.
+`
+	tbl, ok := parseTable(text)
+	if !ok {
+		t.Fatal("Expected the sample to parse")
+	}
+	tbl.markNumbers()
+	data, err := json.Marshal(tbl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"columns":["ID","CODE","PRICE","RATIO","NOTE"],"rows":[[1,"007",12.50,0.5,"a"],[2,"010",-3,1E+10,null],[3,null,null,-0.25,"1"]]}`
+	if !jsonEqual(t, data, []byte(want)) {
+		t.Errorf("Unexpected table:\n got: %s\nwant: %s", data, want)
+	}
+
+	// Without markNumbers, values are kept as printed
+	f, _ := newResultFormatter(resultFormatStructured, false)
+	f.trackRequest([]byte(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"run-sql"}}`))
+	result, _ := json.Marshal(map[string]interface{}{"content": []map[string]string{{"type": "text", "text": text}}})
+	got := f.formatResponse([]byte(`{"jsonrpc":"2.0","id":1,"result":` + string(result) + `}`))
+	if !strings.Contains(string(got), `"rows":[["1","007","12.50"`) {
+		t.Errorf("Expected values as printed, got %s", got)
+	}
+}
+
+func TestJSONNumber(t *testing.T) {
+	for value, want := range map[string]string{
+		"42": "42", "-7": "-7", "0": "0", "3.14": "3.14", ".5": "0.5", "-.5": "-0.5",
+		"5.": "5", "1.5E+10": "1.5E+10", "0.001": "0.001",
+		"007": "", "abc": "", "": "", ".": "", "-": "", "1,000": "", "1 2": "",
+	} {
+		got, ok := jsonNumber(value)
+		if ok != (want != "") || string(got) != want {
+			t.Errorf("jsonNumber(%q) = %q, %v, want %q", value, got, ok, want)
+		}
+		if ok && !json.Valid([]byte(got)) {
+			t.Errorf("jsonNumber(%q) = %q is not valid JSON", value, got)
+		}
+	}
+}
+
+func jsonEqual(t *testing.T, a, b []byte) bool {
+	t.Helper()
+	var va, vb interface{}
+	if err := json.Unmarshal(a, &va); err != nil {
+		t.Fatalf("Invalid JSON %s: %v", a, err)
+	}
+	if err := json.Unmarshal(b, &vb); err != nil {
+		t.Fatalf("Invalid JSON %s: %v", b, err)
+	}
+	da, _ := json.Marshal(va)
+	db, _ := json.Marshal(vb)
+	return string(da) == string(db)
+}
+
+// jsonOrTextEqual compares got and want as JSON if want is JSON.
+func jsonOrTextEqual(t *testing.T, got, want string) bool {
+	t.Helper()
+	if json.Valid([]byte(want)) {
+		return json.Valid([]byte(got)) && jsonEqual(t, []byte(got), []byte(want))
+	}
+	return got == want
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// walletConfig is the Oracle Net configuration SQLcl picks up from its
+// environment.
+type walletConfig struct {
+	tnsAdmin       string // $TNS_ADMIN, holding tnsnames.ora and sqlnet.ora
+	walletLocation string // $WALLET_LOCATION, holding the auto-login wallet
+}
+
+func walletConfigFromEnv() walletConfig {
+	return walletConfig{
+		tnsAdmin:       os.Getenv("TNS_ADMIN"),
+		walletLocation: os.Getenv("WALLET_LOCATION"),
+	}
+}
+
+// check verifies that the configured directories exist and hold the files
+// SQLcl needs, and returns the names of the entries in tnsnames.ora. With
+// neither variable set there is nothing to check. A wallet is expected in
+// WALLET_LOCATION, or otherwise in TNS_ADMIN when its sqlnet.ora refers to
+// one, as in Autonomous Database wallets.
+func (c walletConfig) check() ([]string, error) {
+	var entries []string
+	walletDir := c.walletLocation
+	if c.tnsAdmin != "" {
+		if err := checkDir("TNS_ADMIN", c.tnsAdmin); err != nil {
+			return nil, err
+		}
+		tnsnames := filepath.Join(c.tnsAdmin, "tnsnames.ora")
+		var err error
+		if entries, err = readTNSNames(tnsnames); err != nil {
+			return nil, fmt.Errorf("TNS_ADMIN=%s: cannot read tnsnames.ora: %w", c.tnsAdmin, err)
+		}
+		if len(entries) == 0 {
+			return nil, fmt.Errorf("TNS_ADMIN=%s: tnsnames.ora defines no connect identifiers", c.tnsAdmin)
+		}
+		if walletDir == "" && sqlnetUsesWallet(filepath.Join(c.tnsAdmin, "sqlnet.ora")) {
+			walletDir = c.tnsAdmin
+		}
+	}
+
+	if walletDir != "" {
+		if err := checkDir("WALLET_LOCATION", walletDir); err != nil {
+			return nil, err
+		}
+		if _, err := os.Stat(filepath.Join(walletDir, "cwallet.sso")); err != nil {
+			return nil, fmt.Errorf("wallet directory %s has no cwallet.sso auto-login wallet: %w", walletDir, err)
+		}
+	}
+	return entries, nil
+}
+
+func checkDir(name, dir string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("%s=%s: %w", name, dir, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s=%s is not a directory", name, dir)
+	}
+	return nil
+}
+
+// tnsEntry matches the start of a tnsnames.ora entry: one or more
+// comma-separated names at the start of a line, followed by "=".
+var tnsEntry = regexp.MustCompile(`^([A-Za-z][\w.$-]*(?:\s*,\s*[A-Za-z][\w.$-]*)*)\s*=`)
+
+// readTNSNames returns the connect identifiers defined in a tnsnames.ora
+// file, leaving out their descriptors, which may hold host names.
+func readTNSNames(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var names []string
+	depth := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		if depth == 0 {
+			if m := tnsEntry.FindStringSubmatch(line); m != nil {
+				for _, name := range strings.Split(m[1], ",") {
+					names = append(names, strings.TrimSpace(name))
+				}
+			}
+		}
+		depth += strings.Count(line, "(") - strings.Count(line, ")")
+	}
+	return names, scanner.Err()
+}
+
+// sqlnetUsesWallet reports whether the sqlnet.ora file at path configures a
+// wallet.
+func sqlnetUsesWallet(path string) bool {
+	data, err := os.ReadFile(path)
+	return err == nil && strings.Contains(strings.ToUpper(string(data)), "WALLET_LOCATION")
+}
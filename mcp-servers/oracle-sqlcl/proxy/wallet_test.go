@@ -0,0 +1,71 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const tnsnames = `# Connect identifiers
+mydb_high =
+  (description=
+    (address=(protocol=tcps)(port=1522)(host=adb.example.com))
+    (connect_data=(service_name=abc_mydb_high.adb.oraclecloud.com)))
+
+mydb_low, mydb_alias = (description=(address=(protocol=tcps)(port=1522)(host=adb.example.com))
+  (connect_data=(service_name=abc_mydb_low.adb.oraclecloud.com)))
+`
+
+// writeFiles creates a directory holding the given files.
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestWalletCheck(t *testing.T) {
+	sqlnet := `WALLET_LOCATION = (SOURCE = (METHOD = file) (METHOD_DATA = (DIRECTORY="?/network/admin")))`
+	complete := writeFiles(t, map[string]string{"tnsnames.ora": tnsnames, "sqlnet.ora": sqlnet, "cwallet.sso": "x"})
+	noWallet := writeFiles(t, map[string]string{"tnsnames.ora": tnsnames, "sqlnet.ora": sqlnet})
+	noSqlnet := writeFiles(t, map[string]string{"tnsnames.ora": tnsnames})
+	wallet := writeFiles(t, map[string]string{"cwallet.sso": "x"})
+	empty := t.TempDir()
+
+	tests := []struct {
+		name    string
+		cfg     walletConfig
+		entries []string
+		err     string
+	}{
+		{"nothing configured", walletConfig{}, nil, ""},
+		{"wallet in TNS_ADMIN", walletConfig{tnsAdmin: complete}, []string{"mydb_high", "mydb_low", "mydb_alias"}, ""},
+		{"missing wallet in TNS_ADMIN", walletConfig{tnsAdmin: noWallet}, nil, "has no cwallet.sso"},
+		{"no wallet needed", walletConfig{tnsAdmin: noSqlnet}, []string{"mydb_high", "mydb_low", "mydb_alias"}, ""},
+		{"separate wallet", walletConfig{tnsAdmin: noWallet, walletLocation: wallet}, []string{"mydb_high", "mydb_low", "mydb_alias"}, ""},
+		{"missing TNS_ADMIN", walletConfig{tnsAdmin: filepath.Join(empty, "nope")}, nil, "TNS_ADMIN=" + filepath.Join(empty, "nope")},
+		{"missing tnsnames.ora", walletConfig{tnsAdmin: empty}, nil, "cannot read tnsnames.ora"},
+		{"empty wallet location", walletConfig{walletLocation: empty}, nil, "has no cwallet.sso"},
+		{"wallet location is a file", walletConfig{walletLocation: filepath.Join(wallet, "cwallet.sso")}, nil, "is not a directory"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := tt.cfg.check()
+			if tt.err == "" && err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Fatalf("Expected an error containing %q, got %v", tt.err, err)
+			}
+			if !reflect.DeepEqual(entries, tt.entries) {
+				t.Errorf("Expected entries %v, got %v", tt.entries, entries)
+			}
+		})
+	}
+}